@@ -3,6 +3,11 @@ package api
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	metrics "github.com/libp2p/go-libp2p-core/metrics"
@@ -44,6 +49,20 @@ type Common interface {
 	// usage and current rate per protocol
 	NetBandwidthStatsByProtocol(ctx context.Context) (map[protocol.ID]metrics.Stats, error)
 
+	// NetBootstrapList returns the bootstrap peers persisted in the repo, which
+	// are dialed in addition to the builtin bootstrappers
+	NetBootstrapList(ctx context.Context) ([]peer.AddrInfo, error)
+	// NetBootstrapAdd adds a peer to the persisted bootstrap list
+	NetBootstrapAdd(ctx context.Context, ai peer.AddrInfo) error
+	// NetBootstrapRemove removes a peer from the persisted bootstrap list
+	NetBootstrapRemove(ctx context.Context, p peer.ID) error
+	// NetKnownMiners lists miners learned through peer exchange
+	NetKnownMiners(ctx context.Context) ([]peer.AddrInfo, error)
+
+	// NetStats returns connection counts, connection manager limits and the
+	// usage of inbound stream limits
+	NetStats(ctx context.Context) (NetStats, error)
+
 	// MethodGroup: Common
 
 	// ID returns peerID of libp2p node backing this API
@@ -51,6 +70,8 @@ type Common interface {
 
 	// Version provides information about API provider
 	Version(context.Context) (Version, error)
+	// BuildInfo returns the commit, features and network of the API provider
+	BuildInfo(context.Context) (BuildInfo, error)
 
 	LogList(context.Context) ([]string, error)
 	LogSetLevel(context.Context, string, string) error
@@ -59,6 +80,36 @@ type Common interface {
 	Shutdown(context.Context) error
 
 	Closing(context.Context) (<-chan struct{}, error)
+
+	// MethodGroup: Debug
+
+	// DebugProfilesList lists the profiles periodically captured by the node
+	DebugProfilesList(context.Context) ([]ProfileInfo, error)
+	// DebugProfileGet returns a captured profile in pprof format
+	DebugProfileGet(ctx context.Context, name string) ([]byte, error)
+	// DebugBackgroundTasks lists the background loops of the node with the
+	// time of their last success and error
+	DebugBackgroundTasks(context.Context) ([]BackgroundTask, error)
+}
+
+// ProfileInfo describes a profile captured by the node
+type ProfileInfo struct {
+	Name string
+	Kind string // cpu, heap or goroutine
+	Time time.Time
+	Size int64
+}
+
+// BackgroundTask is the health of a background loop of the node
+type BackgroundTask struct {
+	Name     string
+	Running  bool
+	Started  time.Time
+	Restarts int
+
+	LastSuccess   time.Time
+	LastError     string
+	LastErrorTime time.Time
 }
 
 // Version provides various build-time information
@@ -70,8 +121,9 @@ type Version struct {
 	//
 	// See APIVersion in build/version.go
 	APIVersion build.Version
-
-	// TODO: git commit / os / genesis cid?
+	// APIFeatures are the features of the API, see FullAPIFeatures in
+	// build/version.go
+	APIFeatures []string
 
 	// Seconds
 	BlockDelay uint64
@@ -81,7 +133,104 @@ func (v Version) String() string {
 	return fmt.Sprintf("%s+api%s", v.Version, v.APIVersion.String())
 }
 
+// Supports returns whether the remote has an API feature
+func (v Version) Supports(feature string) bool {
+	for _, f := range v.APIFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCompatible checks that the remote can serve a client built against API
+// version want, which needs the given features
+func (v Version) CheckCompatible(want build.Version, features ...string) error {
+	if err := v.APIVersion.Compatible(want); err != nil {
+		return err
+	}
+	for _, f := range features {
+		if !v.Supports(f) {
+			return xerrors.Errorf("remote API (version %s) doesn't support %s", v.APIVersion, f)
+		}
+	}
+	return nil
+}
+
+// BuildInfo describes the build of a node, and the network it's on
+type BuildInfo struct {
+	Version    string
+	APIVersion build.Version
+	Commit     string
+	BuildTime  string
+
+	// BuildType is the network the binary was built for, empty for the
+	// default network
+	BuildType string
+	// Features are enabled build and runtime features, e.g. gpu
+	Features []string
+	// ProofParams are the versions of the proof parameters used
+	ProofParams []string
+
+	Network string
+	Genesis cid.Cid
+
+	// Seconds
+	BlockDelay uint64
+}
+
+// CheckNetwork returns an error when nodes built as local and remote can't
+// work together. Network and genesis are only compared when both are known.
+func (local BuildInfo) CheckNetwork(remote BuildInfo) error {
+	if local.BuildType != remote.BuildType {
+		return xerrors.Errorf("remote is built for network '%s', expected '%s'", remote.BuildType, local.BuildType)
+	}
+	if local.BlockDelay != remote.BlockDelay {
+		return xerrors.Errorf("remote block delay is %ds, expected %ds", remote.BlockDelay, local.BlockDelay)
+	}
+	if strings.Join(local.ProofParams, ",") != strings.Join(remote.ProofParams, ",") {
+		return xerrors.Errorf("remote uses proof parameters %v, expected %v", remote.ProofParams, local.ProofParams)
+	}
+	if local.Network != "" && remote.Network != "" && local.Network != remote.Network {
+		return xerrors.Errorf("remote is on network '%s', expected '%s'", remote.Network, local.Network)
+	}
+	if local.Genesis.Defined() && remote.Genesis.Defined() && local.Genesis != remote.Genesis {
+		return xerrors.Errorf("remote genesis is %s, expected %s", remote.Genesis, local.Genesis)
+	}
+	return nil
+}
+
+// NetStats describes the resource usage of the libp2p host
+type NetStats struct {
+	Peers int
+	Conns int
+	// Streams is the number of open streams, inbound and outbound
+	Streams int
+
+	ConnMgrLow  int
+	ConnMgrHigh int
+
+	StreamLimits []StreamLimitStat
+	Bandwidth    metrics.Stats
+}
+
+// StreamLimitStat is the usage of an inbound stream limit
+type StreamLimitStat struct {
+	Protocol   string
+	MaxInbound int
+	Active     int
+	Rejected   uint64
+}
+
 type NatInfo struct {
 	Reachability network.Reachability
 	PublicAddr   string
+
+	// ListenAddrs are the addresses the host listens on
+	ListenAddrs []string
+	// AnnouncedAddrs are the addresses advertised to peers, after applying
+	// the announce / no-announce lists
+	AnnouncedAddrs []string
+	// PortMappings lists ports mapped on the router with UPnP / NAT-PMP
+	PortMappings []string
 }
@@ -147,6 +147,15 @@ type FullNode interface {
 	// GasEstimateMessageGas estimates gas values for unset message gas fields
 	GasEstimateMessageGas(context.Context, *types.Message, *MessageSendSpec, types.TipSetKey) (*types.Message, error)
 
+	// GasTrend returns the base fees of the last lookback epochs, and their
+	// extrapolation over the next horizon epochs
+	GasTrend(ctx context.Context, lookback, horizon abi.ChainEpoch, tsk types.TipSetKey) (*GasTrend, error)
+	// GasShouldSendNow advises whether a message of the given kind ("post",
+	// "provecommit", "precommit" or "other") which must land before the
+	// deadline epoch should be sent now, or when the base fee is expected to
+	// be lower. A zero deadline means no deadline.
+	GasShouldSendNow(ctx context.Context, kind string, deadline abi.ChainEpoch, tsk types.TipSetKey) (*SendAdvice, error)
+
 	// MethodGroup: Sync
 	// The Sync method group contains methods for interacting with and
 	// observing the lotus sync service.
@@ -197,6 +206,18 @@ type FullNode interface {
 	// based on current chain conditions
 	MpoolPushMessage(ctx context.Context, msg *types.Message, spec *MessageSendSpec) (*types.SignedMessage, error)
 
+	// MpoolPendingApprovals lists messages held for approval. With
+	// Approvals.Threshold set, MpoolPushMessage calls moving at least the
+	// threshold return an error, and the message is held until it is approved
+	// or expires. WalletSignMessage refuses such messages, and WalletExport
+	// refuses to export keys.
+	MpoolPendingApprovals(context.Context) ([]PendingApproval, error)
+	// MpoolApprove pushes a message held for approval, sig must be a signature
+	// of one of the configured approvers over the Payload of the action
+	MpoolApprove(ctx context.Context, id uint64, approver address.Address, sig *crypto.Signature) (*types.SignedMessage, error)
+	// MpoolReject drops a message held for approval
+	MpoolReject(context.Context, uint64) error
+
 	// MpoolGetNonce gets next nonce for the specified sender.
 	// Note that this method may not be atomic. Use MpoolPushMessage instead.
 	MpoolGetNonce(context.Context, address.Address) (uint64, error)
@@ -239,6 +260,7 @@ type FullNode interface {
 	// WalletSetDefault marks the given address as as the default one.
 	WalletSetDefault(context.Context, address.Address) error
 	// WalletExport returns the private key of an address in the wallet.
+	// It's refused while Approvals.Threshold is set.
 	WalletExport(context.Context, address.Address) (*types.KeyInfo, error)
 	// WalletImport receives a KeyInfo, which includes a private key, and imports it into the wallet.
 	WalletImport(context.Context, *types.KeyInfo) (address.Address, error)
@@ -278,8 +300,27 @@ type FullNode interface {
 	ClientRetrieveWithEvents(ctx context.Context, order RetrievalOrder, ref *FileRef) (<-chan marketevents.RetrievalEvent, error)
 	// ClientQueryAsk returns a signed StorageAsk from the specified miner.
 	ClientQueryAsk(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error)
-	// ClientCalcCommP calculates the CommP for a specified file
+	// ClientFindMiners queries the asks of all miners with power in parallel, and
+	// returns the asks matching the given constraints, cheapest first.
+	ClientFindMiners(ctx context.Context, params FindMinersParams) ([]MinerAsk, error)
+	// ClientCalcCommP calculates the CommP for a specified file. Results are
+	// cached, see ClientCommPQueue.
 	ClientCalcCommP(ctx context.Context, inpath string) (*CommPRet, error)
+	// ClientCommPQueue schedules the CommP calculation of a file on the node
+	// and returns immediately. The result is cached until the file changes,
+	// so a later ClientCalcCommP for the file, e.g. when proposing a deal,
+	// doesn't read the file again.
+	ClientCommPQueue(ctx context.Context, inpath string) (CommPJob, error)
+	// ClientCommPJobs lists the queued, running and recent CommP calculations
+	ClientCommPJobs(ctx context.Context) ([]CommPJob, error)
+	// ClientDealTransfers returns the transfer protocols a miner accepts deal
+	// data with. With the proposal CID of an offline deal made by this node,
+	// the HTTP push URL of the deal is included if the miner accepts HTTP pushes.
+	ClientDealTransfers(ctx context.Context, miner address.Address, proposal *cid.Cid) (DealTransfers, error)
+	// ClientPushDealData sends the data of an offline deal to the miner, with
+	// the given push protocol, or the first one the miner supports of
+	// libp2p-http and http. It returns the protocol used.
+	ClientPushDealData(ctx context.Context, miner address.Address, proposal cid.Cid, inpath string, protocol string) (string, error)
 	// ClientGenCar generates a CAR file for the specified file.
 	ClientGenCar(ctx context.Context, ref FileRef, outpath string) error
 	// ClientDealSize calculates real deal data size
@@ -453,6 +494,9 @@ type FullNode interface {
 	MarketEnsureAvailable(context.Context, address.Address, address.Address, types.BigInt) (cid.Cid, error)
 	// MarketFreeBalance
 
+	// MarketFundsStatus returns the state of configured market escrow policies
+	MarketFundsStatus(context.Context) ([]MarketEscrowStatus, error)
+
 	// MethodGroup: Paych
 	// The Paych methods are for interacting with and managing payment channels
 
@@ -528,6 +572,40 @@ type MsgLookup struct {
 	Height    abi.ChainEpoch
 }
 
+// BaseFeePoint is the base fee at a height
+type BaseFeePoint struct {
+	Height  abi.ChainEpoch
+	BaseFee abi.TokenAmount
+}
+
+// GasTrend describes recent base fees, see GasTrend
+type GasTrend struct {
+	// History is oldest first, null rounds are skipped
+	History []BaseFeePoint
+
+	Mean abi.TokenAmount
+	Min  abi.TokenAmount
+	Max  abi.TokenAmount
+
+	// ChangePerEpoch is the average relative change of the base fee per epoch
+	// over the history, e.g. -0.01 for a 1% decrease
+	ChangePerEpoch float64
+	// Forecast extrapolates the average change over the following epochs
+	Forecast []BaseFeePoint
+}
+
+// SendAdvice is the result of GasShouldSendNow
+type SendAdvice struct {
+	SendNow bool
+	Reason  string
+
+	BaseFee abi.TokenAmount
+	// ExpectedBaseFee is the lowest base fee forecast before the deadline,
+	// at ExpectedAt
+	ExpectedBaseFee abi.TokenAmount
+	ExpectedAt      abi.ChainEpoch
+}
+
 type MsgGasCost struct {
 	Message            cid.Cid // Can be different than requested, in case it was replaced, but only gas values changed
 	GasUsed            abi.TokenAmount
@@ -663,6 +741,40 @@ type MarketBalance struct {
 	Locked big.Int
 }
 
+// PendingApproval is a message held until it is approved with a second API
+// token
+type PendingApproval struct {
+	ID uint64
+	// Requester identifies the token the message was pushed with
+	Requester string
+	Message   *types.Message
+
+	// Payload is what approvers sign
+	Payload []byte
+
+	Created time.Time
+	Expires time.Time
+}
+
+type MarketEscrowStatus struct {
+	Address address.Address
+	Wallet  address.Address
+
+	Escrow    types.BigInt
+	Locked    types.BigInt
+	Available types.BigInt
+	Checked   time.Time
+
+	MinAvailable types.BigInt
+	TopUpTo      types.BigInt
+	MaxAvailable types.BigInt
+
+	PendingMsg     *cid.Cid
+	LastAction     string
+	LastActionTime time.Time
+	LastErr        string
+}
+
 type MarketDeal struct {
 	Proposal market.DealProposal
 	State    market.DealState
@@ -820,10 +932,51 @@ type DataSize struct {
 	PieceSize   abi.PaddedPieceSize
 }
 
+type FindMinersParams struct {
+	// MinFreeSpace is the size of the largest piece the miner must accept
+	MinFreeSpace abi.PaddedPieceSize
+	// MaxPrice is the max price per GiB per epoch, nil for no limit
+	MaxPrice *types.BigInt
+	// Verified compares MaxPrice with the verified deal price
+	Verified bool
+}
+
+type MinerAsk struct {
+	Miner  address.Address
+	PeerID peer.ID
+	Ask    *storagemarket.StorageAsk
+}
+
 type CommPRet struct {
 	Root cid.Cid
 	Size abi.UnpaddedPieceSize
 }
+
+// CommPJob is a CommP calculation, see ClientCommPQueue
+type CommPJob struct {
+	Path string
+	// State is queued, computing, done or failed
+	State string
+	// Cached is set when the result was computed earlier
+	Cached bool
+
+	Result *CommPRet
+	Error  string
+
+	Queued   time.Time
+	Started  time.Time
+	Finished time.Time
+}
+
+// DealTransfers are the transfer protocols a miner accepts deal data with,
+// see ClientDealTransfers
+type DealTransfers struct {
+	Protocols []string
+
+	// PushURL and PushToken are set for HTTP pushes of a deal's data
+	PushURL   string
+	PushToken string
+}
 type HeadChange struct {
 	Type string
 	Val  *types.TipSet
@@ -3,19 +3,29 @@ package api
 import (
 	"bytes"
 	"context"
+	"io"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/piecestore"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/extern/sector-storage/fsutil"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/ops"
+	"github.com/filecoin-project/lotus/lib/quota"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
 // StorageMiner is a low-level interface to the Filecoin network storage miner node
@@ -26,10 +36,74 @@ type StorageMiner interface {
 
 	ActorSectorSize(context.Context, address.Address) (abi.SectorSize, error)
 
+	// ActorKeyChangePropose proposes setting the worker and control addresses
+	// of the miner. The change can only be executed after the configured
+	// timelock, and once signed by one of the configured approvers. Without
+	// approvers the change is sent right away, with Message set.
+	ActorKeyChangePropose(ctx context.Context, newWorker address.Address, newControlAddrs []address.Address) (KeyChangeProposal, error)
+	ActorKeyChangeList(context.Context) ([]KeyChangeProposal, error)
+	// ActorKeyChangeApprove records an approver's signature over the Payload
+	// of a proposal
+	ActorKeyChangeApprove(ctx context.Context, id uint64, approver address.Address, sig *crypto.Signature) (KeyChangeProposal, error)
+	ActorKeyChangeCancel(ctx context.Context, id uint64) error
+	// ActorKeyChangeExecute sends an approved proposal past its timelock to
+	// the chain
+	ActorKeyChangeExecute(ctx context.Context, id uint64) (cid.Cid, error)
+
+	// AlertRules returns the alert rules for the configured thresholds, in
+	// terms of the metrics reported by the miner
+	AlertRules(context.Context) ([]AlertRule, error)
+
+	// ActorSweep moves funds above the configured floats from the miner
+	// actor, owner and worker to the cold address, see config.SweepConfig.
+	// With dryRun set the planned transfers are recorded but not sent.
+	ActorSweep(ctx context.Context, dryRun bool) (SweepRecord, error)
+	// ActorSweepHistory lists recorded sweeps, oldest first
+	ActorSweepHistory(context.Context) ([]SweepRecord, error)
+
+	// OutboxList lists the messages waiting for an offline signature, and
+	// recently signed or failed ones, see config.SigningConfig
+	OutboxList(context.Context) ([]OutboxMessage, error)
+	// OutboxSign pushes a message of the outbox with its signature, by the
+	// sender over the CID of the unsigned message. Waiting messages are
+	// renumbered when other messages of the sender take their nonce, which
+	// changes their CID.
+	OutboxSign(ctx context.Context, id uint64, sig crypto.Signature) (cid.Cid, error)
+	// OutboxDrop fails a message waiting for a signature, later messages of
+	// the sender are renumbered
+	OutboxDrop(ctx context.Context, id uint64) error
+
+	// CronJobs lists the scheduled jobs, see config.CronConfig
+	CronJobs(context.Context) ([]CronJob, error)
+	// CronRun runs a job now and waits for it to finish
+	CronRun(ctx context.Context, job string) (CronRun, error)
+	// CronHistory lists runs of a job, oldest first
+	CronHistory(ctx context.Context, job string) ([]CronRun, error)
+
+	// NodeConnectionStatus returns the state of the connections to the full
+	// nodes the miner uses, with per-node call stats
+	NodeConnectionStatus(context.Context) ([]NodeEndpointStatus, error)
+
 	MiningBase(context.Context) (*types.TipSet, error)
 
 	// Temp api for testing
+	// Pledged sectors are sealed with the seal proof type of the miner
+	// actor. It's fixed when the actor is created and PreCommitSector rejects
+	// other proof types, so the sector size can't be picked per sector.
 	PledgeSector(context.Context) error
+	// PledgePause stops the auto-pledge loop of 'run --pledge-sector', or
+	// lotus-pledge-controller which reads PledgeStatus on every check, from
+	// pledging sectors until PledgeResume is called, or the miner restarts
+	PledgePause(context.Context) error
+	PledgeResume(context.Context) error
+	PledgeStatus(context.Context) (dtypes.PledgeState, error)
+
+	// ProvingForceSubmit computes and submits proofs for the partitions of
+	// the open deadline dl which weren't proven yet, right away and with
+	// raised fees, when the miner recovers from an outage right before the
+	// challenge window closes. The fee is limited to maxFee, or 4 times
+	// MaxWindowPoStGasFee when it's 0. It returns the PoSt messages.
+	ProvingForceSubmit(ctx context.Context, dl uint64, maxFee abi.TokenAmount) ([]cid.Cid, error)
 
 	// Get the status of a given sector by ID
 	SectorsStatus(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (SectorInfo, error)
@@ -39,6 +113,39 @@ type StorageMiner interface {
 
 	SectorsRefs(context.Context) (map[string][]SealedRef, error)
 
+	// SectorsUpdates returns sector state changes as they happen, until ctx
+	// is cancelled. Updates are dropped for subscribers which don't keep up,
+	// the next update delivered counts them in Dropped.
+	SectorsUpdates(context.Context) (<-chan SectorUpdate, error)
+
+	// SectorsWebhooks returns the delivery state of the sector webhook
+	// endpoints
+	SectorsWebhooks(context.Context) ([]SectorWebhookStatus, error)
+	// SectorsWebhooksReplay resends the sector events since since to the
+	// webhook endpoint url, or all endpoints when url is empty, and returns
+	// the number of events queued for each endpoint. url must be one of the
+	// configured endpoints.
+	SectorsWebhooksReplay(ctx context.Context, since time.Time, url string) (uint64, error)
+
+	// AnalyticsGas returns the gas spent by messages of the miner per day and
+	// subsystem, for the days from from to to
+	AnalyticsGas(ctx context.Context, from, to time.Time) ([]GasReportDay, error)
+
+	// AnalyticsExpiredPreCommits returns the sectors whose precommit expired
+	// on chain before they were proven, oldest first
+	AnalyticsExpiredPreCommits(context.Context) ([]ExpiredPreCommit, error)
+
+	// SectorsSetLabels merges labels into the labels of a sector, labels with
+	// an empty value are removed
+	SectorsSetLabels(ctx context.Context, sid abi.SectorNumber, labels map[string]string) error
+	// SectorsListLabels returns the labels of labelled sectors having every
+	// label of the selector, selector labels with an empty value match any
+	// value
+	SectorsListLabels(ctx context.Context, selector map[string]string) ([]SectorLabels, error)
+	// SectorsQuery returns the sectors matching a query, filtered, sorted and
+	// paginated by the miner
+	SectorsQuery(ctx context.Context, q SectorQuery) (SectorQueryResult, error)
+
 	// SectorStartSealing can be called on sectors in Empty or WaitDeals states
 	// to trigger sealing early
 	SectorStartSealing(context.Context, abi.SectorNumber) error
@@ -55,24 +162,147 @@ type StorageMiner interface {
 	SectorsUpdate(context.Context, abi.SectorNumber, SectorState) error
 	SectorRemove(context.Context, abi.SectorNumber) error
 	SectorMarkForUpgrade(ctx context.Context, id abi.SectorNumber) error
+	// SectorUnsealRange returns length bytes of the unpadded data of a sector
+	// at offset. Only the parts of the sector covering the range are unsealed.
+	SectorUnsealRange(ctx context.Context, id abi.SectorNumber, offset, length uint64) ([]byte, error)
+	// SectorTrimCache trims the cache of a finalized sector, see
+	// storiface.CacheTrimLevel
+	SectorTrimCache(ctx context.Context, id abi.SectorNumber, level storiface.CacheTrimLevel) error
+	// SectorArchive copies the sealed and cache files of a sector to the
+	// external archive. With removeLocal the local copies are removed, which
+	// is only allowed for removed sectors, and sectors terminated or expired
+	// on chain.
+	SectorArchive(ctx context.Context, id abi.SectorNumber, removeLocal bool) error
+	// SectorRecall starts bringing an archived sector back into local
+	// storage, or returns the status of the recall in progress
+	SectorRecall(ctx context.Context, id abi.SectorNumber) (storiface.RecallStatus, error)
+	// SectorArchiveList lists the sectors held by the external archive
+	SectorArchiveList(ctx context.Context) ([]storiface.ArchivedSector, error)
+
+	// External sealing lets an orchestrator seal sectors with its own
+	// workers, while this miner sends the chain messages and proves them.
+	// The orchestrator allocates a sector, declares the pieces it placed in
+	// the sector, padding included, declares the sealed and cache files with
+	// StorageDeclareSector, and hands the sector back with
+	// SectorExternalSealed, after which it is pre-committed.
+
+	// SectorExternalAllocate allocates a sector for external sealing
+	SectorExternalAllocate(ctx context.Context) (abi.SectorID, error)
+	// SectorExternalAddPiece declares the next piece of an external sector
+	SectorExternalAddPiece(ctx context.Context, id abi.SectorNumber, piece ExternalPiece) error
+	// SectorExternalSealed hands a sealed external sector back to the miner
+	SectorExternalSealed(ctx context.Context, id abi.SectorNumber, info ExternalSealedInfo) error
+	// SectorExternalRelease gives up an external sector which wasn't handed
+	// back yet, and removes its files
+	SectorExternalRelease(ctx context.Context, id abi.SectorNumber) error
+
+	// SectorAddPieceToAny adds the piece of a deal to a sector accepting
+	// deals, a new one if needed. Markets nodes add deal data to the sectors
+	// of the sealing miner with it, the data is streamed over HTTP.
+	SectorAddPieceToAny(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, deal PieceDealInfo) (SectorOffset, error)
 
 	StorageList(ctx context.Context) (map[stores.ID][]stores.Decl, error)
 	StorageLocal(ctx context.Context) (map[stores.ID]string, error)
 	StorageStat(ctx context.Context, id stores.ID) (fsutil.FsStat, error)
 
-	// WorkerConnect tells the node to connect to workers RPC
+	// WorkerConnect tells the node to connect to workers RPC, it fails when
+	// workers need approval, they then connect with WorkerConnectRegistered
 	WorkerConnect(context.Context, string) error
+	// WorkerRegister announces a worker to the miner, it should connect with
+	// WorkerConnectRegistered once it's accepted
+	WorkerRegister(context.Context, WorkerRegistration) (WorkerRegState, error)
+	// WorkerConnectRegistered connects to the accepted worker with the
+	// registration ID, at the URL it registered with
+	WorkerConnectRegistered(ctx context.Context, id string) error
+	// WorkerRegistrations lists the workers which registered
+	WorkerRegistrations(context.Context) ([]WorkerRegistration, error)
+	// WorkerRegistrationAccept lets a registered worker connect
+	WorkerRegistrationAccept(ctx context.Context, id string) error
+	// WorkerRegistrationDeny stops a registered worker from connecting, and
+	// disconnects it
+	WorkerRegistrationDeny(ctx context.Context, id string) error
+	// WorkerTaskAffinity returns which workers task types are pinned to
+	WorkerTaskAffinity(context.Context) (WorkerTaskAffinity, error)
+	// WorkerTaskSet enables or disables task types on the workers with the
+	// given hostname, on top of Workers.Tasks in the config
+	WorkerTaskSet(ctx context.Context, hostname string, tasks []sealtasks.TaskType, enabled bool) error
+	// WorkerTaskReset removes the settings of WorkerTaskSet for the task
+	// types, or all task types when none are given
+	WorkerTaskReset(ctx context.Context, hostname string, tasks []sealtasks.TaskType) error
+	// WorkerStats returns the resources in use on each connected worker, and
+	// lists the registered workers waiting for approval with their
+	// Registration ID set, keyed from storiface.PendingWorkerIDs
 	WorkerStats(context.Context) (map[uint64]storiface.WorkerStats, error)
 	WorkerJobs(context.Context) (map[uint64][]storiface.WorkerJob, error)
+	// WorkerSummaries returns the resources in use and the jobs of each
+	// worker, counted by task type
+	WorkerSummaries(context.Context) ([]storiface.WorkerSummary, error)
+
+	// WorkerTokenCreate creates an API token for the named worker, which can
+	// be revoked with WorkerTokenRevoke without rotating the API secret.
+	// Worker tokens can't be used to create further tokens.
+	WorkerTokenCreate(ctx context.Context, name string, perms []auth.Permission) ([]byte, error)
+	WorkerTokenList(ctx context.Context) ([]WorkerToken, error)
+	// WorkerTokenRevoke revokes the token with the ID, or all tokens of the
+	// worker with the name, and drops the workers connected with them
+	WorkerTokenRevoke(ctx context.Context, nameOrID string) error
+	// WorkerEnergy returns the energy used by sealing tasks on workers with
+	// energy metering enabled
+	WorkerEnergy(context.Context) (map[uint64]storiface.WorkerEnergy, error)
+	// WorkerBenchTransfer runs test transfers of each size with the /remote
+	// endpoint of a worker in both directions
+	WorkerBenchTransfer(ctx context.Context, worker uint64, sizes []uint64, pings int) ([]storiface.TransferBench, error)
+
+	// OperationsList returns running and recently finished long operations,
+	// like sealing tasks, fetches and data transfers, with their progress
+	OperationsList(context.Context) ([]ops.Status, error)
+	// OperationStatus returns the status of an operation by its ID
+	OperationStatus(ctx context.Context, id string) (ops.Status, error)
+
+	// AuthNewWithQuota creates a token limited by a quota, for sharing API
+	// access with partners
+	AuthNewWithQuota(ctx context.Context, perms []auth.Permission, q quota.Quota) ([]byte, error)
+	// TokenUsage returns usage counters of a token created with a quota
+	TokenUsage(ctx context.Context, token string) (quota.Usage, error)
 
 	// SealingSchedDiag dumps internal sealing scheduler state
 	SealingSchedDiag(context.Context) (interface{}, error)
+	// SealingSchedExplain explains how the scheduler handled the task with the
+	// given ID (see SealingSchedDiag for IDs of queued tasks)
+	SealingSchedExplain(ctx context.Context, taskID uint64) (storiface.SchedExplanation, error)
+	// SealingSchedSectorHistory returns the recent scheduling decisions for
+	// tasks of a sector, oldest first
+	SealingSchedSectorHistory(ctx context.Context, sector abi.SectorNumber) ([]storiface.SchedExplanation, error)
+	// SealingDrain stops assigning sealing tasks to workers, tasks already
+	// assigned keep running (see WorkerJobs). New tasks stay queued until the
+	// miner restarts.
+	SealingDrain(context.Context) error
+	// SealingTuneReport summarizes the performance of recorded sealing tasks
+	// by worker, with suggested tuning changes
+	SealingTuneReport(context.Context) (TuneReport, error)
+	// SealingTuneApply applies tuning changes, e.g. suggested ones. Worker
+	// settings are picked up by workers when they start, an empty Suggested
+	// value removes the setting.
+	SealingTuneApply(ctx context.Context, changes []TuneSuggestion) error
+	// SealingTuning returns the tuning settings applied for a worker
+	SealingTuning(ctx context.Context, hostname string) (map[string]string, error)
+
+	// ConfigReload re-reads the config file and applies the settings which
+	// can change without a restart, like a SIGHUP of the miner process
+	ConfigReload(context.Context) (ConfigReload, error)
+	// SyncLag returns how far the chain head of the full node is behind, the
+	// miner doesn't send messages while it's more than Startup.MaxSyncLag
+	// epochs behind, PoSt and sealing messages wait for it to catch up
+	SyncLag(context.Context) (SyncLag, error)
 
 	stores.SectorIndex
 
 	MarketImportDealData(ctx context.Context, propcid cid.Cid, path string) error
 	MarketListDeals(ctx context.Context) ([]MarketDeal, error)
 	MarketListRetrievalDeals(ctx context.Context) ([]retrievalmarket.ProviderDealState, error)
+	// MarketRetrievalStats returns the retrieval serving limits and the
+	// current load, per client
+	MarketRetrievalStats(ctx context.Context) (RetrievalStats, error)
 	MarketGetDealUpdates(ctx context.Context) (<-chan storagemarket.MinerDeal, error)
 	MarketListIncompleteDeals(ctx context.Context) ([]storagemarket.MinerDeal, error)
 	MarketSetAsk(ctx context.Context, price types.BigInt, verifiedPrice types.BigInt, duration abi.ChainEpoch, minPieceSize abi.PaddedPieceSize, maxPieceSize abi.PaddedPieceSize) error
@@ -81,6 +311,23 @@ type StorageMiner interface {
 	MarketGetRetrievalAsk(ctx context.Context) (*retrievalmarket.Ask, error)
 	MarketListDataTransfers(ctx context.Context) ([]DataTransferChannel, error)
 	MarketDataTransferUpdates(ctx context.Context) (<-chan DataTransferChannel, error)
+	// MarketSetDealLabels merges labels into the labels of a deal, see
+	// SectorsSetLabels
+	MarketSetDealLabels(ctx context.Context, propCid cid.Cid, labels map[string]string) error
+	// MarketListDealLabels returns the labels of labelled deals matching the
+	// selector, see SectorsListLabels
+	MarketListDealLabels(ctx context.Context, selector map[string]string) ([]DealLabels, error)
+	// MarketInspectDeal reports where the data of a deal is stored, and
+	// whether it can be retrieved. With blocks the block index of the piece is
+	// listed, which scans the index entries of all pieces.
+	MarketInspectDeal(ctx context.Context, dealID abi.DealID, blocks bool) (*DealInspection, error)
+	// MarketDealPayments reconciles the payments expected for the published
+	// deals of the miner with the ones settled by the market actor at the
+	// chain head
+	MarketDealPayments(ctx context.Context) (*DealPaymentReport, error)
+	// MarketDealPaymentHistory returns the totals of past deal payment
+	// reports, which the miner records hourly, oldest first
+	MarketDealPaymentHistory(ctx context.Context) ([]DealPaymentReport, error)
 
 	DealsImportData(ctx context.Context, dealPropCid cid.Cid, file string) error
 	DealsList(ctx context.Context) ([]MarketDeal, error)
@@ -95,12 +342,259 @@ type StorageMiner interface {
 	DealsConsiderOfflineRetrievalDeals(context.Context) (bool, error)
 	DealsSetConsiderOfflineRetrievalDeals(context.Context, bool) error
 
+	// DealsIntakeEnqueue queues a signed offline deal proposal, made with the
+	// client by an external order system, with the file holding the deal data.
+	// It returns the proposal CID, which identifies the deal in the markets
+	// API, immediately. The data is imported once the client proposed the
+	// deal to the miner. State changes of the deal are POSTed as JSON to
+	// callbackURL, if one is given, with the deal ID once it's published.
+	// Failed callbacks are retried, also after restarts, for up to a day.
+	DealsIntakeEnqueue(ctx context.Context, proposal market.ClientDealProposal, file string, callbackURL string) (cid.Cid, error)
+	DealsIntakeList(context.Context) ([]DealIntake, error)
+	DealsIntakeGet(ctx context.Context, proposalCid cid.Cid) (DealIntake, error)
+
 	StorageAddLocal(ctx context.Context, path string) error
 
 	PiecesListPieces(ctx context.Context) ([]cid.Cid, error)
 	PiecesListCidInfos(ctx context.Context) ([]cid.Cid, error)
 	PiecesGetPieceInfo(ctx context.Context, pieceCid cid.Cid) (*piecestore.PieceInfo, error)
 	PiecesGetCIDInfo(ctx context.Context, payloadCid cid.Cid) (*piecestore.CIDInfo, error)
+	// PiecesBuildIndex indexes the payload blocks of the deal pieces in a
+	// sector, for sectors sealed before indexes were kept. Unsealed copies of the
+	// pieces are created when missing.
+	PiecesBuildIndex(ctx context.Context, sector abi.SectorNumber) ([]PieceIndex, error)
+	// PiecesLocateBlock returns where a payload block is in the unpadded data of
+	// a sector, see SectorUnsealRange
+	PiecesLocateBlock(ctx context.Context, sector abi.SectorNumber, block cid.Cid) (SectorBlockLocation, error)
+}
+
+// DealIntake is an offline deal submitted through the deal intake queue
+type DealIntake struct {
+	ProposalCid cid.Cid
+	Proposal    market.ClientDealProposal
+	Path        string
+	CallbackURL string
+
+	// Proposed is set once the client proposed the deal to the miner
+	Proposed bool
+	Imported bool
+	Err      string
+
+	State   storagemarket.StorageDealStatus
+	Message string
+	DealID  abi.DealID
+
+	Created time.Time
+	Updated time.Time
+}
+
+// AlertRule is an alert on the metrics reported by the miner
+type AlertRule struct {
+	Name string
+	// Expr is a PromQL expression, the alert fires while it has results
+	Expr     string
+	For      time.Duration
+	Severity string
+	Summary  string
+}
+
+type SweepKind string
+
+const (
+	// SweepWithdraw withdraws available balance from the miner actor to the owner
+	SweepWithdraw SweepKind = "withdraw"
+	// SweepSend sends funds to the cold address
+	SweepSend SweepKind = "send"
+)
+
+type SweepTransfer struct {
+	Kind   SweepKind
+	From   address.Address
+	To     address.Address
+	Amount abi.TokenAmount
+
+	// Message is set once the transfer was pushed
+	Message *cid.Cid
+}
+
+// TuneReport summarizes recorded sealing tasks, see SealingTuneReport
+type TuneReport struct {
+	Runs  int
+	Since time.Time
+
+	Stages      []TuneStage
+	Suggestions []TuneSuggestion
+}
+
+// TuneStage is the performance of a task type on a worker
+type TuneStage struct {
+	Worker string
+	Task   sealtasks.TaskType
+
+	Runs   int
+	Failed int
+	Median time.Duration
+
+	// BestParallel is the number of tasks running at once with which the
+	// worker finished the most tasks per hour, Throughput
+	BestParallel int
+	Throughput   float64
+}
+
+// TuneSuggestion is a change of a tuning setting
+type TuneSuggestion struct {
+	// Worker is the hostname of the worker the setting applies to, settings
+	// of the miner have no worker
+	Worker    string
+	Setting   string
+	Current   string
+	Suggested string
+	Reason    string
+}
+
+// ConfigReload lists the settings which changed in the config file since it
+// was last loaded, as Section.Field
+type ConfigReload struct {
+	// Applied took effect, Restart only take effect when the miner restarts
+	Applied []string
+	Restart []string
+}
+
+type WorkerRegState string
+
+const (
+	WorkerRegPending  WorkerRegState = "pending"
+	WorkerRegAccepted WorkerRegState = "accepted"
+	WorkerRegDenied   WorkerRegState = "denied"
+)
+
+// WorkerRegistration is a worker which announced itself to the miner, see
+// WorkerRegister
+type WorkerRegistration struct {
+	// ID is chosen by the worker, and kept in its repo
+	ID        string
+	Hostname  string
+	URL       string
+	Tasks     []sealtasks.TaskType
+	Resources storiface.WorkerResources
+	// Paths are the local storage paths of the worker
+	Paths []string
+
+	State      WorkerRegState
+	Registered time.Time
+	LastSeen   time.Time
+}
+
+// WorkerTaskAffinity pins task types to workers, see WorkerTaskAffinity
+type WorkerTaskAffinity struct {
+	// Groups are named sets of worker hostnames
+	Groups map[string][]string
+	// Tasks lists the worker hostnames or groups each task type is pinned to
+	Tasks map[sealtasks.TaskType][]string
+	// Overrides enable or disable task types on workers by hostname, see
+	// WorkerTaskSet
+	Overrides map[string]map[sealtasks.TaskType]bool
+}
+
+// SyncLag is how far the chain head of the full node is behind the current
+// epoch
+type SyncLag struct {
+	Head abi.ChainEpoch
+	Lag  abi.ChainEpoch
+	// MaxLag is negative when messages are sent regardless of the lag
+	MaxLag abi.ChainEpoch
+	InSync bool
+}
+
+// OutboxMessage is a message sent with an offline signature, see OutboxList
+type OutboxMessage struct {
+	ID uint64
+	// Method is the name of the method called, e.g. PreCommitSector
+	Method string
+	// Message has its nonce and gas set, the signature is over its CID
+	Message *types.Message
+	Created time.Time
+
+	Signature *crypto.Signature
+	// Signed is the CID of the signed message pushed to the mpool
+	Signed *cid.Cid
+	// Error is why the message failed, or was dropped
+	Error string
+}
+
+// Pending is true while the message waits for a signature
+func (m OutboxMessage) Pending() bool {
+	return m.Signed == nil && m.Error == ""
+}
+
+// SweepRecord is a sweep of rewards to the cold address, see ActorSweep
+type SweepRecord struct {
+	ID        uint64
+	Time      time.Time
+	DryRun    bool
+	Transfers []SweepTransfer
+
+	// Approved is false when the approval hook rejected the sweep
+	Approved bool
+	Error    string
+}
+
+// CronJob is a scheduled task of the miner, see config.CronConfig
+type CronJob struct {
+	Name     string
+	Schedule string
+	// Task is the built-in task, or the shell command the job runs
+	Task string
+
+	Next    time.Time
+	Running bool
+	LastRun *CronRun
+}
+
+// CronRun is a run of a scheduled job
+type CronRun struct {
+	Job      string
+	Started  time.Time
+	Finished time.Time
+	// Manual is set for runs started with CronRun
+	Manual bool
+
+	// Output of the task, truncated
+	Output string
+	Error  string
+}
+
+// NodeEndpointStatus is the state of the connection to a full node
+type NodeEndpointStatus struct {
+	// Name is the address of the node
+	Name    string
+	Healthy bool
+	// Latency is the average ChainHead round trip
+	Latency time.Duration
+	Height  abi.ChainEpoch
+
+	Calls     uint64
+	Errors    uint64
+	InFlight  int
+	LastError string
+}
+
+// KeyChangeProposal is a pending change of the miner's worker and control
+// addresses, see ActorKeyChangePropose
+type KeyChangeProposal struct {
+	ID              uint64
+	NewWorker       address.Address
+	NewControlAddrs []address.Address
+
+	// Payload is what approvers sign
+	Payload []byte
+
+	Proposed     time.Time
+	ExecuteAfter time.Time
+
+	Approver  *address.Address
+	Cancelled bool
+	Message   *cid.Cid
 }
 
 type SealRes struct {
@@ -119,6 +613,248 @@ type SectorLog struct {
 	Message string
 }
 
+// SectorUpdate is a sector state change, see SectorsUpdates
+type SectorUpdate struct {
+	Sector abi.SectorNumber
+	From   SectorState
+	To     SectorState
+	Time   time.Time
+	Error  string
+
+	// Dropped is the number of updates dropped before this one because the
+	// subscriber didn't keep up, any sector may have changed meanwhile
+	Dropped uint64
+}
+
+// SectorEvent is the body POSTed to sector webhook endpoints. Events are
+// delivered at least once, in Seq order; receivers should ignore events with
+// a Seq they already processed.
+type SectorEvent struct {
+	Seq uint64
+	SectorUpdate
+}
+
+// SectorWebhookStatus is the delivery state of a sector webhook endpoint
+type SectorWebhookStatus struct {
+	URL string
+	// Next is the Seq of the next event to deliver, Pending the number of
+	// events waiting for delivery
+	Next    uint64
+	Pending uint64
+
+	LastAttempt time.Time
+	LastError   string
+}
+
+// RetrievalStats are the retrieval serving limits, 0 for no limit, and their
+// usage, see MarketRetrievalStats
+type RetrievalStats struct {
+	Active       int
+	MaxActive    int
+	MaxPerClient int
+
+	// RunningUnseals are pieces being read from sectors, QueuedUnseals
+	// reads waiting for a slot
+	RunningUnseals int
+	QueuedUnseals  int
+	MaxUnseals     int
+
+	// RejectedBusy and RejectedClient count the retrievals rejected at the
+	// MaxActive and MaxPerClient limits since the miner started
+	RejectedBusy   uint64
+	RejectedClient uint64
+
+	Clients []RetrievalClientStats
+}
+
+// RetrievalClientStats is the retrieval load of a client
+type RetrievalClientStats struct {
+	Client peer.ID
+
+	Active         int
+	RunningUnseals int
+	QueuedUnseals  int
+}
+
+// GasSpend is the gas spent by a set of messages
+type GasSpend struct {
+	Messages           int64
+	GasUsed            int64
+	BaseFeeBurn        abi.TokenAmount
+	OverEstimationBurn abi.TokenAmount
+	MinerTip           abi.TokenAmount
+}
+
+// Total returns the FIL spent on the messages
+func (s GasSpend) Total() abi.TokenAmount {
+	return big.Sum(zeroIfNil(s.BaseFeeBurn), zeroIfNil(s.OverEstimationBurn), zeroIfNil(s.MinerTip))
+}
+
+func (s *GasSpend) Add(o GasSpend) {
+	s.Messages += o.Messages
+	s.GasUsed += o.GasUsed
+	s.BaseFeeBurn = big.Add(zeroIfNil(s.BaseFeeBurn), zeroIfNil(o.BaseFeeBurn))
+	s.OverEstimationBurn = big.Add(zeroIfNil(s.OverEstimationBurn), zeroIfNil(o.OverEstimationBurn))
+	s.MinerTip = big.Add(zeroIfNil(s.MinerTip), zeroIfNil(o.MinerTip))
+}
+
+func zeroIfNil(v abi.TokenAmount) abi.TokenAmount {
+	if v.Int == nil {
+		return big.Zero()
+	}
+	return v
+}
+
+// GasReportDay is the gas spent in a day (UTC), by subsystem
+type GasReportDay struct {
+	Day        time.Time
+	Subsystems map[string]GasSpend
+}
+
+// ExpiredPreCommit is a sector whose precommit expired on chain before it was
+// proven, the deposit was burnt and the sector removed
+type ExpiredPreCommit struct {
+	Sector  abi.SectorNumber
+	Deposit abi.TokenAmount
+	Deals   []abi.DealID
+	Time    time.Time
+}
+
+// ExternalPiece is a piece of an externally sealed sector
+type ExternalPiece struct {
+	Piece abi.PieceInfo
+
+	// DealID is 0 for padding pieces
+	DealID       abi.DealID
+	PublishCid   *cid.Cid
+	KeepUnsealed bool
+}
+
+// PieceDealInfo is the deal of a piece added with SectorAddPieceToAny
+type PieceDealInfo struct {
+	PublishCid   *cid.Cid
+	DealID       abi.DealID
+	StartEpoch   abi.ChainEpoch
+	EndEpoch     abi.ChainEpoch
+	KeepUnsealed bool
+}
+
+// SectorOffset is where SectorAddPieceToAny placed a piece
+type SectorOffset struct {
+	Sector abi.SectorNumber
+	Offset abi.PaddedPieceSize
+}
+
+// ExternalSealedInfo is the result of sealing an external sector
+type ExternalSealedInfo struct {
+	TicketValue abi.SealRandomness
+	TicketEpoch abi.ChainEpoch
+	CommR       cid.Cid
+	CommD       cid.Cid
+}
+
+type SectorLabels struct {
+	Sector abi.SectorNumber
+	Labels map[string]string
+}
+
+// SectorQuery selects sectors in SectorsQuery, filters which aren't set match
+// all sectors
+type SectorQuery struct {
+	States []SectorState
+	// DealClient matches sectors with deals of the client
+	DealClient *address.Address
+	// ExpirationFrom and ExpirationTo bound the on-chain expiration epoch,
+	// 0 is unbounded
+	ExpirationFrom abi.ChainEpoch
+	ExpirationTo   abi.ChainEpoch
+	// StoragePath matches sectors with files in the storage path
+	StoragePath stores.ID
+	// Labels is a label selector, see SectorsListLabels
+	Labels map[string]string
+	// Text matches sectors whose number, state, or a label key or value
+	// contains it, ignoring case
+	Text string
+
+	// SortBy is number (the default), expiration or state
+	SortBy string
+	Desc   bool
+	Offset int
+	// Limit of 0 returns all sectors after Offset
+	Limit int
+
+	// Refresh rebuilds the index first, it's otherwise rebuilt in the
+	// background when it's older than 30 seconds
+	Refresh bool
+}
+
+type SectorQueryResult struct {
+	// Total is the number of matching sectors, before pagination
+	Total   int
+	Sectors []SectorMeta
+}
+
+type SectorMeta struct {
+	Sector      abi.SectorNumber
+	State       SectorState
+	Deals       []abi.DealID
+	DealClients []address.Address
+	// Expiration is 0 for sectors which aren't on chain
+	Expiration   abi.ChainEpoch
+	StoragePaths []stores.ID
+	Labels       map[string]string
+	// Updated is the time of the last state machine log entry
+	Updated time.Time
+	LastErr string
+}
+
+type DealLabels struct {
+	ProposalCid cid.Cid
+	Labels      map[string]string
+}
+
+type DealInspection struct {
+	DealID      abi.DealID
+	ProposalCid cid.Cid
+	State       string
+	Message     string
+	Client      address.Address
+	StartEpoch  abi.ChainEpoch
+	EndEpoch    abi.ChainEpoch
+
+	PieceCID    cid.Cid
+	PieceSize   abi.PaddedPieceSize
+	PayloadRoot cid.Cid
+
+	// Indexed is true when the payload blocks of the piece were recorded in
+	// the piece store, Blocks is only filled when requested
+	Indexed bool
+	Blocks  []DealBlock
+
+	Sectors []DealPlacement
+
+	// RetrievalIssues lists what prevents retrievals, if anything
+	RetrievalReady  bool
+	RetrievalIssues []string
+}
+
+// DealBlock is a block of the payload of a deal, offsets are relative to the
+// start of the piece
+type DealBlock struct {
+	Cid    cid.Cid
+	Offset uint64
+	Size   uint64
+}
+
+// DealPlacement is a sector holding the piece of a deal
+type DealPlacement struct {
+	Sector   abi.SectorNumber
+	Offset   abi.PaddedPieceSize
+	Length   abi.PaddedPieceSize
+	State    SectorState
+	Unsealed bool
+}
+
 type SectorInfo struct {
 	SectorID     abi.SectorNumber
 	State        SectorState
@@ -132,6 +868,7 @@ type SectorInfo struct {
 	CommitMsg    *cid.Cid
 	Retries      uint64
 	ToUpgrade    bool
+	Labels       map[string]string
 
 	LastErr string
 
@@ -180,3 +917,105 @@ func (st *SealSeed) Equals(ost *SealSeed) bool {
 }
 
 type SectorState string
+
+// PieceIndex describes the block index of a deal piece in a sector
+type PieceIndex struct {
+	Deal abi.DealID
+	// PieceOffset is the unpadded offset of the piece in the sector
+	PieceOffset abi.UnpaddedPieceSize
+	Blocks      int
+}
+
+// SectorBlockLocation is the location of a payload block in the unpadded data
+// of a sector
+type SectorBlockLocation struct {
+	Sector      abi.SectorNumber
+	Deal        abi.DealID
+	PieceOffset abi.UnpaddedPieceSize
+
+	// Offset of the block data in the sector
+	Offset uint64
+	Size   uint64
+}
+
+type DealPaymentStatus string
+
+const (
+	// DealPaymentPending deals haven't reached their start epoch
+	DealPaymentPending DealPaymentStatus = "pending"
+	DealPaymentActive  DealPaymentStatus = "active"
+	// DealPaymentLate deals are active, but weren't settled for longer than
+	// the market actor settles deals at
+	DealPaymentLate      DealPaymentStatus = "settlement-late"
+	DealPaymentCompleted DealPaymentStatus = "completed"
+	DealPaymentSlashed   DealPaymentStatus = "slashed"
+	// DealPaymentNotActivated deals weren't in a proven sector by their
+	// start epoch, the provider collateral is lost
+	DealPaymentNotActivated DealPaymentStatus = "not-activated"
+	// DealPaymentMissing deals were removed from the market actor before
+	// their end epoch without being seen slashed, the payments are unknown
+	DealPaymentMissing DealPaymentStatus = "missing"
+)
+
+// Shortfall is true for the deals which weren't, or won't be, paid in full
+func (s DealPaymentStatus) Shortfall() bool {
+	switch s {
+	case DealPaymentLate, DealPaymentSlashed, DealPaymentNotActivated, DealPaymentMissing:
+		return true
+	default:
+		return false
+	}
+}
+
+// DealPayment compares what a deal earned until the report epoch with
+// what the market actor paid for it
+type DealPayment struct {
+	DealID        abi.DealID
+	ProposalCid   cid.Cid // undefined for deals without a local record
+	Client        address.Address
+	StartEpoch    abi.ChainEpoch
+	EndEpoch      abi.ChainEpoch
+	PricePerEpoch abi.TokenAmount
+
+	Status DealPaymentStatus
+	// SettledEpoch is the last epoch payments were settled at, -1 if never
+	SettledEpoch abi.ChainEpoch
+
+	// Expected is the price of the epochs stored until the report epoch,
+	// Paid the part of it settled, Lost what won't be paid and the provider
+	// collateral lost. Paid of missing deals is unknown, and left at 0.
+	Expected abi.TokenAmount
+	Paid     abi.TokenAmount
+	Lost     abi.TokenAmount
+	// Upcoming is what active deals earn until their end epoch
+	Upcoming abi.TokenAmount
+}
+
+// DealPaymentReport sums up the deal payments at Epoch, see
+// MarketDealPayments
+type DealPaymentReport struct {
+	Epoch abi.ChainEpoch
+	Deals []DealPayment
+
+	Expected abi.TokenAmount
+	Paid     abi.TokenAmount
+	// Unsettled is expected but not yet paid for active deals, which are
+	// settled periodically
+	Unsettled  abi.TokenAmount
+	Lost       abi.TokenAmount
+	Upcoming   abi.TokenAmount
+	Shortfalls int
+}
+
+// WorkerToken is an API token issued to a seal worker, see WorkerTokenCreate
+type WorkerToken struct {
+	ID      string
+	Name    string
+	Perms   []auth.Permission
+	Created time.Time
+	// Revoked is zero for valid tokens
+	Revoked time.Time
+	// LastUsed is when a request was last made with the token since the
+	// miner started, zero if none was
+	LastUsed time.Time
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -101,3 +102,35 @@ func TestReturnTypes(t *testing.T) {
 	t.Run("miner", tst(new(StorageMiner)))
 	t.Run("worker", tst(new(WorkerAPI)))
 }
+
+func TestBuildInfoCheckNetwork(t *testing.T) {
+	gen, err := cid.Parse("bafy2bzacecnamqgqmifpluoeldx7zzglxcljo6oja4vrmtj7432rphldpdmm2")
+	require.NoError(t, err)
+	other, err := cid.Parse("bafy2bzaceaxm23epjsmh75yvzcecsrbavlmkcxnva66bkdebdcnyw3bjrc74u")
+	require.NoError(t, err)
+
+	local := BuildInfo{
+		ProofParams: []string{"v28"},
+		BlockDelay:  30,
+		Genesis:     gen,
+	}
+
+	remote := local
+	remote.Network = "testnetnet"
+	remote.Features = []string{"gpu"}
+	require.NoError(t, local.CheckNetwork(remote))
+
+	remote.Genesis = cid.Undef
+	require.NoError(t, local.CheckNetwork(remote), "unknown genesis")
+
+	remote.Genesis = other
+	require.Error(t, local.CheckNetwork(remote))
+
+	remote = local
+	remote.BuildType = "2k"
+	require.Error(t, local.CheckNetwork(remote))
+
+	remote = local
+	remote.ProofParams = []string{"v27"}
+	require.Error(t, local.CheckNetwork(remote))
+}
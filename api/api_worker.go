@@ -13,6 +13,7 @@ import (
 	"github.com/filecoin-project/specs-storage/storage"
 
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/ops"
 )
 
 type WorkerAPI interface {
@@ -27,6 +28,9 @@ type WorkerAPI interface {
 
 	storage.Sealer
 
+	// FinalizeSectorTrim is FinalizeSector which trims the cache to level
+	FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error
+
 	MoveStorage(ctx context.Context, sector abi.SectorID, types stores.SectorFileType) error
 
 	UnsealPiece(context.Context, abi.SectorID, storiface.UnpaddedByteIndex, abi.UnpaddedPieceSize, abi.SealRandomness, cid.Cid) error
@@ -36,5 +40,20 @@ type WorkerAPI interface {
 
 	Fetch(context.Context, abi.SectorID, stores.SectorFileType, stores.PathType, stores.AcquireMode) error
 
+	// ChainHeadUpdate is called by the miner for every new chain head
+	ChainHeadUpdate(context.Context, storiface.ChainHead) error
+
+	// TaskEnergy returns the energy used by sealing tasks, when energy
+	// metering is enabled on the worker
+	TaskEnergy(context.Context) (storiface.WorkerEnergy, error)
+
+	// Operations returns running and recently finished operations, with
+	// their progress
+	Operations(context.Context) ([]ops.Status, error)
+
+	// TaskForensics takes the forensics collected for the last failure of a
+	// task on the sector, see storiface.Forensics
+	TaskForensics(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType) (*storiface.Forensics, error)
+
 	Closing(context.Context) (<-chan struct{}, error)
 }
@@ -0,0 +1,58 @@
+package apistruct
+
+import (
+	"reflect"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// DegradedMethods are the methods served by miners running without a full
+// node, they only need local state
+var DegradedMethods = map[string]struct{}{
+	"AuthVerify":           {},
+	"AuthNew":              {},
+	"Version":              {},
+	"LogList":              {},
+	"LogSetLevel":          {},
+	"Shutdown":             {},
+	"Closing":              {},
+	"DebugBackgroundTasks": {},
+}
+
+// DegradedStorMinerAPI serves DegradedMethods of a, all other calls fail with
+// err
+func DegradedStorMinerAPI(a api.Common, err error) api.StorageMiner {
+	var out StorageMinerStruct
+	subsetProxy(a, DegradedMethods, err, &out.Internal)
+	subsetProxy(a, DegradedMethods, err, &out.CommonStruct.Internal)
+	return &out
+}
+
+// subsetProxy serves the methods of in listed in methods, all of them when
+// methods is nil, other calls fail with err
+func subsetProxy(in interface{}, methods map[string]struct{}, err error, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+
+		if _, ok := methods[field.Name]; ok || methods == nil {
+			if m := ra.MethodByName(field.Name); m.IsValid() {
+				rint.Field(f).Set(m)
+				continue
+			}
+		}
+
+		rerr := reflect.ValueOf(&err).Elem()
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			if field.Type.NumOut() == 2 {
+				return []reflect.Value{
+					reflect.Zero(field.Type.Out(0)),
+					rerr,
+				}
+			}
+			return []reflect.Value{rerr}
+		}))
+	}
+}
@@ -0,0 +1,77 @@
+package apistruct
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// ErrNotOnMarketsNode is returned by calls to a markets node which only the
+// sealing miner serves
+var ErrNotOnMarketsNode = xerrors.New("not available on a markets node, call the sealing miner")
+
+// MarketsMethods are the storage miner methods served by markets nodes, next
+// to the common methods. They only need the markets subsystem.
+var MarketsMethods = map[string]struct{}{
+	"ActorAddress":         {},
+	"ActorSectorSize":      {},
+	"NodeConnectionStatus": {},
+
+	"MarketImportDealData":      {},
+	"MarketListDeals":           {},
+	"MarketListRetrievalDeals":  {},
+	"MarketGetDealUpdates":      {},
+	"MarketListIncompleteDeals": {},
+	"MarketSetAsk":              {},
+	"MarketGetAsk":              {},
+	"MarketSetRetrievalAsk":     {},
+	"MarketGetRetrievalAsk":     {},
+	"MarketListDataTransfers":   {},
+	"MarketDataTransferUpdates": {},
+	"MarketSetDealLabels":       {},
+	"MarketListDealLabels":      {},
+	"MarketInspectDeal":         {},
+
+	"DealsImportData":                       {},
+	"DealsList":                             {},
+	"DealsConsiderOnlineStorageDeals":       {},
+	"DealsSetConsiderOnlineStorageDeals":    {},
+	"DealsConsiderOnlineRetrievalDeals":     {},
+	"DealsSetConsiderOnlineRetrievalDeals":  {},
+	"DealsConsiderOfflineStorageDeals":      {},
+	"DealsSetConsiderOfflineStorageDeals":   {},
+	"DealsConsiderOfflineRetrievalDeals":    {},
+	"DealsSetConsiderOfflineRetrievalDeals": {},
+	"DealsIntakeEnqueue":                    {},
+	"DealsIntakeList":                       {},
+	"DealsIntakeGet":                        {},
+	"DealsPieceCidBlocklist":                {},
+	"DealsSetPieceCidBlocklist":             {},
+
+	"SectorsRefs":        {},
+	"PiecesListPieces":   {},
+	"PiecesListCidInfos": {},
+	"PiecesGetPieceInfo": {},
+	"PiecesGetCIDInfo":   {},
+	"PiecesLocateBlock":  {},
+
+	"OperationsList":   {},
+	"OperationStatus":  {},
+	"AuthNewWithQuota": {},
+	"TokenUsage":       {},
+	"ConfigReload":     {},
+	"SyncLag":          {},
+
+	"OutboxList": {},
+	"OutboxSign": {},
+	"OutboxDrop": {},
+}
+
+// MarketsStorMinerAPI serves the common methods and MarketsMethods of a, all
+// other calls fail with ErrNotOnMarketsNode
+func MarketsStorMinerAPI(a api.StorageMiner) api.StorageMiner {
+	var out StorageMinerStruct
+	subsetProxy(a, MarketsMethods, ErrNotOnMarketsNode, &out.Internal)
+	subsetProxy(a, nil, ErrNotOnMarketsNode, &out.CommonStruct.Internal)
+	return &out
+}
@@ -3,6 +3,10 @@ package apistruct
 import (
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/lib/quota"
+	"github.com/filecoin-project/lotus/lib/rpclimit"
+	"github.com/filecoin-project/lotus/lib/rpctrace"
+	"github.com/filecoin-project/lotus/storage/workertokens"
 )
 
 const (
@@ -24,6 +28,40 @@ func PermissionedStorMinerAPI(a api.StorageMiner) api.StorageMiner {
 	return &out
 }
 
+// QuotaStorMinerAPI counts calls made with tokens carrying a quota, calls
+// over the quota fail
+func QuotaStorMinerAPI(a api.StorageMiner, t *quota.Tracker) api.StorageMiner {
+	var out StorageMinerStruct
+	quota.Proxy(t, a, &out.Internal)
+	quota.Proxy(t, a, &out.CommonStruct.Internal)
+	return &out
+}
+
+// WorkerTokenStorMinerAPI checks calls made with worker tokens for
+// revocation, see workertokens.Proxy
+func WorkerTokenStorMinerAPI(a api.StorageMiner, t *workertokens.Tokens) api.StorageMiner {
+	var out StorageMinerStruct
+	workertokens.Proxy(t, a, &out.Internal)
+	workertokens.Proxy(t, a, &out.CommonStruct.Internal)
+	return &out
+}
+
+// LimitedStorMinerAPI rejects calls over the API limits
+func LimitedStorMinerAPI(a api.StorageMiner, l *rpclimit.Limiter) api.StorageMiner {
+	var out StorageMinerStruct
+	rpclimit.Proxy(l, a, &out.Internal)
+	rpclimit.Proxy(l, a, &out.CommonStruct.Internal)
+	return &out
+}
+
+// TracedStorMinerAPI records the calls to the API in a trace file
+func TracedStorMinerAPI(a api.StorageMiner, r *rpctrace.Recorder) api.StorageMiner {
+	var out StorageMinerStruct
+	rpctrace.Proxy(r, a, &out.Internal)
+	rpctrace.Proxy(r, a, &out.CommonStruct.Internal)
+	return &out
+}
+
 func PermissionedFullAPI(a api.FullNode) api.FullNode {
 	var out FullNodeStruct
 	auth.PermissionedProxy(AllPermissions, DefaultPerms, a, &out.Internal)
@@ -31,6 +69,22 @@ func PermissionedFullAPI(a api.FullNode) api.FullNode {
 	return &out
 }
 
+// LimitedFullAPI rejects calls over the API limits
+func LimitedFullAPI(a api.FullNode, l *rpclimit.Limiter) api.FullNode {
+	var out FullNodeStruct
+	rpclimit.Proxy(l, a, &out.Internal)
+	rpclimit.Proxy(l, a, &out.CommonStruct.Internal)
+	return &out
+}
+
+// TracedFullAPI records the calls to the API in a trace file
+func TracedFullAPI(a api.FullNode, r *rpctrace.Recorder) api.FullNode {
+	var out FullNodeStruct
+	rpctrace.Proxy(r, a, &out.Internal)
+	rpctrace.Proxy(r, a, &out.CommonStruct.Internal)
+	return &out
+}
+
 func PermissionedWorkerAPI(a api.WorkerAPI) api.WorkerAPI {
 	var out WorkerStruct
 	auth.PermissionedProxy(AllPermissions, DefaultPerms, a, &out.Internal)
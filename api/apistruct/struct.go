@@ -33,9 +33,12 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/paych"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/ops"
+	"github.com/filecoin-project/lotus/lib/quota"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
@@ -58,16 +61,27 @@ type CommonStruct struct {
 		NetBandwidthStats           func(ctx context.Context) (metrics.Stats, error)                 `perm:"read"`
 		NetBandwidthStatsByPeer     func(ctx context.Context) (map[string]metrics.Stats, error)      `perm:"read"`
 		NetBandwidthStatsByProtocol func(ctx context.Context) (map[protocol.ID]metrics.Stats, error) `perm:"read"`
+		NetBootstrapList            func(ctx context.Context) ([]peer.AddrInfo, error)               `perm:"read"`
+		NetBootstrapAdd             func(ctx context.Context, ai peer.AddrInfo) error                `perm:"admin"`
+		NetBootstrapRemove          func(ctx context.Context, p peer.ID) error                       `perm:"admin"`
+		NetKnownMiners              func(ctx context.Context) ([]peer.AddrInfo, error)               `perm:"read"`
+		NetStats                    func(ctx context.Context) (api.NetStats, error)                  `perm:"read"`
 		NetAgentVersion             func(ctx context.Context, p peer.ID) (string, error)             `perm:"read"`
 
-		ID      func(context.Context) (peer.ID, error)     `perm:"read"`
-		Version func(context.Context) (api.Version, error) `perm:"read"`
+		ID        func(context.Context) (peer.ID, error)       `perm:"read"`
+		Version   func(context.Context) (api.Version, error)   `perm:"read"`
+		BuildInfo func(context.Context) (api.BuildInfo, error) `perm:"read"`
 
 		LogList     func(context.Context) ([]string, error)     `perm:"write"`
 		LogSetLevel func(context.Context, string, string) error `perm:"write"`
 
 		Shutdown func(context.Context) error                    `perm:"admin"`
 		Closing  func(context.Context) (<-chan struct{}, error) `perm:"read"`
+
+		DebugProfilesList func(context.Context) ([]api.ProfileInfo, error) `perm:"admin"`
+		DebugProfileGet   func(context.Context, string) ([]byte, error)    `perm:"admin"`
+
+		DebugBackgroundTasks func(context.Context) ([]api.BackgroundTask, error) `perm:"read"`
 	}
 }
 
@@ -104,6 +118,8 @@ type FullNodeStruct struct {
 		GasEstimateGasLimit   func(context.Context, *types.Message, types.TipSetKey) (int64, error)                                `perm:"read"`
 		GasEstimateFeeCap     func(context.Context, *types.Message, int64, types.TipSetKey) (types.BigInt, error)                  `perm:"read"`
 		GasEstimateMessageGas func(context.Context, *types.Message, *api.MessageSendSpec, types.TipSetKey) (*types.Message, error) `perm:"read"`
+		GasTrend              func(context.Context, abi.ChainEpoch, abi.ChainEpoch, types.TipSetKey) (*api.GasTrend, error)        `perm:"read"`
+		GasShouldSendNow      func(context.Context, string, abi.ChainEpoch, types.TipSetKey) (*api.SendAdvice, error)              `perm:"read"`
 
 		SyncState          func(context.Context) (*api.SyncState, error)                `perm:"read"`
 		SyncSubmitBlock    func(ctx context.Context, blk *types.BlockMsg) error         `perm:"write"`
@@ -121,10 +137,13 @@ type FullNodeStruct struct {
 		MpoolPending func(context.Context, types.TipSetKey) ([]*types.SignedMessage, error) `perm:"read"`
 		MpoolClear   func(context.Context, bool) error                                      `perm:"write"`
 
-		MpoolPush        func(context.Context, *types.SignedMessage) (cid.Cid, error)                              `perm:"write"`
-		MpoolPushMessage func(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error) `perm:"sign"`
-		MpoolGetNonce    func(context.Context, address.Address) (uint64, error)                                    `perm:"read"`
-		MpoolSub         func(context.Context) (<-chan api.MpoolUpdate, error)                                     `perm:"read"`
+		MpoolPush             func(context.Context, *types.SignedMessage) (cid.Cid, error)                                    `perm:"write"`
+		MpoolPushMessage      func(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error)       `perm:"sign"`
+		MpoolPendingApprovals func(context.Context) ([]api.PendingApproval, error)                                            `perm:"read"`
+		MpoolApprove          func(context.Context, uint64, address.Address, *crypto.Signature) (*types.SignedMessage, error) `perm:"sign"`
+		MpoolReject           func(context.Context, uint64) error                                                             `perm:"sign"`
+		MpoolGetNonce         func(context.Context, address.Address) (uint64, error)                                          `perm:"read"`
+		MpoolSub              func(context.Context) (<-chan api.MpoolUpdate, error)                                           `perm:"read"`
 
 		MinerGetBaseInfo func(context.Context, address.Address, abi.ChainEpoch, types.TipSetKey) (*api.MiningBaseInfo, error) `perm:"read"`
 		MinerCreateBlock func(context.Context, *api.BlockTemplate) (*types.BlockMsg, error)                                   `perm:"write"`
@@ -156,7 +175,12 @@ type FullNodeStruct struct {
 		ClientRetrieve                            func(ctx context.Context, order api.RetrievalOrder, ref *api.FileRef) error                                       `perm:"admin"`
 		ClientRetrieveWithEvents                  func(ctx context.Context, order api.RetrievalOrder, ref *api.FileRef) (<-chan marketevents.RetrievalEvent, error) `perm:"admin"`
 		ClientQueryAsk                            func(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error)              `perm:"read"`
+		ClientFindMiners                          func(ctx context.Context, params api.FindMinersParams) ([]api.MinerAsk, error)                                    `perm:"read"`
 		ClientCalcCommP                           func(ctx context.Context, inpath string) (*api.CommPRet, error)                                                   `perm:"read"`
+		ClientCommPQueue                          func(ctx context.Context, inpath string) (api.CommPJob, error)                                                    `perm:"write"`
+		ClientCommPJobs                           func(ctx context.Context) ([]api.CommPJob, error)                                                                 `perm:"read"`
+		ClientDealTransfers                       func(ctx context.Context, miner address.Address, proposal *cid.Cid) (api.DealTransfers, error)                    `perm:"read"`
+		ClientPushDealData                        func(ctx context.Context, miner address.Address, proposal cid.Cid, inpath, protocol string) (string, error)       `perm:"admin"`
 		ClientGenCar                              func(ctx context.Context, ref api.FileRef, outpath string) error                                                  `perm:"write"`
 		ClientDealSize                            func(ctx context.Context, root cid.Cid) (api.DataSize, error)                                                     `perm:"read"`
 		ClientListDataTransfers                   func(ctx context.Context) ([]api.DataTransferChannel, error)                                                      `perm:"write"`
@@ -220,6 +244,7 @@ type FullNodeStruct struct {
 		MsigSwapCancel          func(context.Context, address.Address, address.Address, uint64, address.Address, address.Address) (cid.Cid, error)                               `perm:"sign"`
 
 		MarketEnsureAvailable func(context.Context, address.Address, address.Address, types.BigInt) (cid.Cid, error) `perm:"sign"`
+		MarketFundsStatus     func(context.Context) ([]api.MarketEscrowStatus, error)                                `perm:"read"`
 
 		PaychGet                    func(ctx context.Context, from, to address.Address, amt types.BigInt) (*api.ChannelInfo, error)           `perm:"sign"`
 		PaychGetWaitReady           func(context.Context, cid.Cid) (address.Address, error)                                                   `perm:"sign"`
@@ -252,11 +277,33 @@ type StorageMinerStruct struct {
 		ActorAddress    func(context.Context) (address.Address, error)                 `perm:"read"`
 		ActorSectorSize func(context.Context, address.Address) (abi.SectorSize, error) `perm:"read"`
 
+		ActorKeyChangePropose func(context.Context, address.Address, []address.Address) (api.KeyChangeProposal, error)         `perm:"admin"`
+		ActorKeyChangeList    func(context.Context) ([]api.KeyChangeProposal, error)                                           `perm:"admin"`
+		ActorKeyChangeApprove func(context.Context, uint64, address.Address, *crypto.Signature) (api.KeyChangeProposal, error) `perm:"admin"`
+		ActorKeyChangeCancel  func(context.Context, uint64) error                                                              `perm:"admin"`
+		ActorKeyChangeExecute func(context.Context, uint64) (cid.Cid, error)                                                   `perm:"admin"`
+
+		AlertRules func(context.Context) ([]api.AlertRule, error) `perm:"read"`
+
+		ActorSweep        func(ctx context.Context, dryRun bool) (api.SweepRecord, error) `perm:"admin"`
+		ActorSweepHistory func(context.Context) ([]api.SweepRecord, error)                `perm:"read"`
+
+		OutboxList func(context.Context) ([]api.OutboxMessage, error)               `perm:"read"`
+		OutboxSign func(context.Context, uint64, crypto.Signature) (cid.Cid, error) `perm:"admin"`
+		OutboxDrop func(context.Context, uint64) error                              `perm:"admin"`
+
+		CronJobs    func(context.Context) ([]api.CronJob, error)                 `perm:"read"`
+		CronRun     func(ctx context.Context, job string) (api.CronRun, error)   `perm:"admin"`
+		CronHistory func(ctx context.Context, job string) ([]api.CronRun, error) `perm:"read"`
+
+		NodeConnectionStatus func(context.Context) ([]api.NodeEndpointStatus, error) `perm:"read"`
+
 		MiningBase func(context.Context) (*types.TipSet, error) `perm:"read"`
 
 		MarketImportDealData      func(context.Context, cid.Cid, string) error                                                                                                                                 `perm:"write"`
 		MarketListDeals           func(ctx context.Context) ([]api.MarketDeal, error)                                                                                                                          `perm:"read"`
 		MarketListRetrievalDeals  func(ctx context.Context) ([]retrievalmarket.ProviderDealState, error)                                                                                                       `perm:"read"`
+		MarketRetrievalStats      func(ctx context.Context) (api.RetrievalStats, error)                                                                                                                        `perm:"read"`
 		MarketGetDealUpdates      func(ctx context.Context) (<-chan storagemarket.MinerDeal, error)                                                                                                            `perm:"read"`
 		MarketListIncompleteDeals func(ctx context.Context) ([]storagemarket.MinerDeal, error)                                                                                                                 `perm:"read"`
 		MarketSetAsk              func(ctx context.Context, price types.BigInt, verifiedPrice types.BigInt, duration abi.ChainEpoch, minPieceSize abi.PaddedPieceSize, maxPieceSize abi.PaddedPieceSize) error `perm:"admin"`
@@ -265,12 +312,30 @@ type StorageMinerStruct struct {
 		MarketGetRetrievalAsk     func(ctx context.Context) (*retrievalmarket.Ask, error)                                                                                                                      `perm:"read"`
 		MarketListDataTransfers   func(ctx context.Context) ([]api.DataTransferChannel, error)                                                                                                                 `perm:"write"`
 		MarketDataTransferUpdates func(ctx context.Context) (<-chan api.DataTransferChannel, error)                                                                                                            `perm:"write"`
+		MarketSetDealLabels       func(context.Context, cid.Cid, map[string]string) error                                                                                                                      `perm:"write"`
+		MarketListDealLabels      func(context.Context, map[string]string) ([]api.DealLabels, error)                                                                                                           `perm:"read"`
+		MarketInspectDeal         func(context.Context, abi.DealID, bool) (*api.DealInspection, error)                                                                                                         `perm:"read"`
+		MarketDealPayments        func(context.Context) (*api.DealPaymentReport, error)                                                                                                                        `perm:"read"`
+		MarketDealPaymentHistory  func(context.Context) ([]api.DealPaymentReport, error)                                                                                                                       `perm:"read"`
+
+		PledgeSector func(context.Context) error                       `perm:"write"`
+		PledgePause  func(context.Context) error                       `perm:"write"`
+		PledgeResume func(context.Context) error                       `perm:"write"`
+		PledgeStatus func(context.Context) (dtypes.PledgeState, error) `perm:"read"`
 
-		PledgeSector func(context.Context) error `perm:"write"`
+		ProvingForceSubmit func(ctx context.Context, dl uint64, maxFee abi.TokenAmount) ([]cid.Cid, error) `perm:"admin"`
 
 		SectorsStatus                 func(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (api.SectorInfo, error) `perm:"read"`
 		SectorsList                   func(context.Context) ([]abi.SectorNumber, error)                                             `perm:"read"`
 		SectorsRefs                   func(context.Context) (map[string][]api.SealedRef, error)                                     `perm:"read"`
+		SectorsUpdates                func(context.Context) (<-chan api.SectorUpdate, error)                                        `perm:"read"`
+		SectorsWebhooks               func(context.Context) ([]api.SectorWebhookStatus, error)                                      `perm:"read"`
+		SectorsWebhooksReplay         func(ctx context.Context, since time.Time, url string) (uint64, error)                        `perm:"admin"`
+		AnalyticsGas                  func(ctx context.Context, from, to time.Time) ([]api.GasReportDay, error)                     `perm:"read"`
+		AnalyticsExpiredPreCommits    func(context.Context) ([]api.ExpiredPreCommit, error)                                         `perm:"read"`
+		SectorsSetLabels              func(context.Context, abi.SectorNumber, map[string]string) error                              `perm:"write"`
+		SectorsListLabels             func(context.Context, map[string]string) ([]api.SectorLabels, error)                          `perm:"read"`
+		SectorsQuery                  func(ctx context.Context, q api.SectorQuery) (api.SectorQueryResult, error)                   `perm:"read"`
 		SectorStartSealing            func(context.Context, abi.SectorNumber) error                                                 `perm:"write"`
 		SectorSetSealDelay            func(context.Context, time.Duration) error                                                    `perm:"write"`
 		SectorGetSealDelay            func(context.Context) (time.Duration, error)                                                  `perm:"read"`
@@ -279,12 +344,51 @@ type StorageMinerStruct struct {
 		SectorsUpdate                 func(context.Context, abi.SectorNumber, api.SectorState) error                                `perm:"admin"`
 		SectorRemove                  func(context.Context, abi.SectorNumber) error                                                 `perm:"admin"`
 		SectorMarkForUpgrade          func(ctx context.Context, id abi.SectorNumber) error                                          `perm:"admin"`
-
-		WorkerConnect func(context.Context, string) error                             `perm:"admin"` // TODO: worker perm
-		WorkerStats   func(context.Context) (map[uint64]storiface.WorkerStats, error) `perm:"admin"`
-		WorkerJobs    func(context.Context) (map[uint64][]storiface.WorkerJob, error) `perm:"admin"`
-
-		SealingSchedDiag func(context.Context) (interface{}, error) `perm:"admin"`
+		SectorUnsealRange             func(context.Context, abi.SectorNumber, uint64, uint64) ([]byte, error)                       `perm:"admin"`
+		SectorTrimCache               func(ctx context.Context, id abi.SectorNumber, level storiface.CacheTrimLevel) error          `perm:"admin"`
+		SectorArchive                 func(ctx context.Context, id abi.SectorNumber, removeLocal bool) error                        `perm:"admin"`
+		SectorRecall                  func(ctx context.Context, id abi.SectorNumber) (storiface.RecallStatus, error)                `perm:"admin"`
+		SectorArchiveList             func(ctx context.Context) ([]storiface.ArchivedSector, error)                                 `perm:"read"`
+		SectorExternalAllocate        func(ctx context.Context) (abi.SectorID, error)                                               `perm:"admin"`
+		SectorExternalAddPiece        func(ctx context.Context, id abi.SectorNumber, piece api.ExternalPiece) error                 `perm:"admin"`
+		SectorExternalSealed          func(ctx context.Context, id abi.SectorNumber, info api.ExternalSealedInfo) error             `perm:"admin"`
+		SectorExternalRelease         func(ctx context.Context, id abi.SectorNumber) error                                          `perm:"admin"`
+
+		SectorAddPieceToAny func(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, deal api.PieceDealInfo) (api.SectorOffset, error) `perm:"admin"`
+
+		WorkerConnect            func(context.Context, string) error                                             `perm:"admin"` // TODO: worker perm
+		WorkerRegister           func(context.Context, api.WorkerRegistration) (api.WorkerRegState, error)       `perm:"admin"`
+		WorkerConnectRegistered  func(context.Context, string) error                                             `perm:"admin"`
+		WorkerRegistrations      func(context.Context) ([]api.WorkerRegistration, error)                         `perm:"read"`
+		WorkerRegistrationAccept func(context.Context, string) error                                             `perm:"admin"`
+		WorkerRegistrationDeny   func(context.Context, string) error                                             `perm:"admin"`
+		WorkerTaskAffinity       func(context.Context) (api.WorkerTaskAffinity, error)                           `perm:"read"`
+		WorkerTaskSet            func(context.Context, string, []sealtasks.TaskType, bool) error                 `perm:"admin"`
+		WorkerTaskReset          func(context.Context, string, []sealtasks.TaskType) error                       `perm:"admin"`
+		WorkerStats              func(context.Context) (map[uint64]storiface.WorkerStats, error)                 `perm:"admin"`
+		WorkerJobs               func(context.Context) (map[uint64][]storiface.WorkerJob, error)                 `perm:"admin"`
+		WorkerSummaries          func(context.Context) ([]storiface.WorkerSummary, error)                        `perm:"admin"`
+		WorkerTokenCreate        func(context.Context, string, []auth.Permission) ([]byte, error)                `perm:"admin"`
+		WorkerTokenList          func(context.Context) ([]api.WorkerToken, error)                                `perm:"admin"`
+		WorkerTokenRevoke        func(context.Context, string) error                                             `perm:"admin"`
+		WorkerEnergy             func(context.Context) (map[uint64]storiface.WorkerEnergy, error)                `perm:"admin"`
+		WorkerBenchTransfer      func(context.Context, uint64, []uint64, int) ([]storiface.TransferBench, error) `perm:"admin"`
+
+		OperationsList  func(context.Context) ([]ops.Status, error)       `perm:"read"`
+		OperationStatus func(context.Context, string) (ops.Status, error) `perm:"read"`
+
+		AuthNewWithQuota func(context.Context, []auth.Permission, quota.Quota) ([]byte, error) `perm:"admin"`
+		TokenUsage       func(context.Context, string) (quota.Usage, error)                    `perm:"read"`
+
+		SealingSchedDiag          func(context.Context) (interface{}, error)                                    `perm:"admin"`
+		SealingSchedExplain       func(context.Context, uint64) (storiface.SchedExplanation, error)             `perm:"admin"`
+		SealingSchedSectorHistory func(context.Context, abi.SectorNumber) ([]storiface.SchedExplanation, error) `perm:"admin"`
+		SealingDrain              func(context.Context) error                                                   `perm:"admin"`
+		SealingTuneReport         func(context.Context) (api.TuneReport, error)                                 `perm:"read"`
+		SealingTuneApply          func(context.Context, []api.TuneSuggestion) error                             `perm:"admin"`
+		SealingTuning             func(context.Context, string) (map[string]string, error)                      `perm:"read"`
+		ConfigReload              func(context.Context) (api.ConfigReload, error)                               `perm:"admin"`
+		SyncLag                   func(context.Context) (api.SyncLag, error)                                    `perm:"read"`
 
 		StorageList          func(context.Context) (map[stores.ID][]stores.Decl, error)                                                                                    `perm:"admin"`
 		StorageLocal         func(context.Context) (map[stores.ID]string, error)                                                                                           `perm:"admin"`
@@ -299,25 +403,30 @@ type StorageMinerStruct struct {
 		StorageLock          func(ctx context.Context, sector abi.SectorID, read stores.SectorFileType, write stores.SectorFileType) error                                 `perm:"admin"`
 		StorageTryLock       func(ctx context.Context, sector abi.SectorID, read stores.SectorFileType, write stores.SectorFileType) (bool, error)                         `perm:"admin"`
 
-		DealsImportData                       func(ctx context.Context, dealPropCid cid.Cid, file string) error `perm:"write"`
-		DealsList                             func(ctx context.Context) ([]api.MarketDeal, error)               `perm:"read"`
-		DealsConsiderOnlineStorageDeals       func(context.Context) (bool, error)                               `perm:"read"`
-		DealsSetConsiderOnlineStorageDeals    func(context.Context, bool) error                                 `perm:"admin"`
-		DealsConsiderOnlineRetrievalDeals     func(context.Context) (bool, error)                               `perm:"read"`
-		DealsSetConsiderOnlineRetrievalDeals  func(context.Context, bool) error                                 `perm:"admin"`
-		DealsConsiderOfflineStorageDeals      func(context.Context) (bool, error)                               `perm:"read"`
-		DealsSetConsiderOfflineStorageDeals   func(context.Context, bool) error                                 `perm:"admin"`
-		DealsConsiderOfflineRetrievalDeals    func(context.Context) (bool, error)                               `perm:"read"`
-		DealsSetConsiderOfflineRetrievalDeals func(context.Context, bool) error                                 `perm:"admin"`
-		DealsPieceCidBlocklist                func(context.Context) ([]cid.Cid, error)                          `perm:"read"`
-		DealsSetPieceCidBlocklist             func(context.Context, []cid.Cid) error                            `perm:"admin"`
+		DealsImportData                       func(ctx context.Context, dealPropCid cid.Cid, file string) error                 `perm:"write"`
+		DealsList                             func(ctx context.Context) ([]api.MarketDeal, error)                               `perm:"read"`
+		DealsConsiderOnlineStorageDeals       func(context.Context) (bool, error)                                               `perm:"read"`
+		DealsSetConsiderOnlineStorageDeals    func(context.Context, bool) error                                                 `perm:"admin"`
+		DealsConsiderOnlineRetrievalDeals     func(context.Context) (bool, error)                                               `perm:"read"`
+		DealsSetConsiderOnlineRetrievalDeals  func(context.Context, bool) error                                                 `perm:"admin"`
+		DealsConsiderOfflineStorageDeals      func(context.Context) (bool, error)                                               `perm:"read"`
+		DealsSetConsiderOfflineStorageDeals   func(context.Context, bool) error                                                 `perm:"admin"`
+		DealsConsiderOfflineRetrievalDeals    func(context.Context) (bool, error)                                               `perm:"read"`
+		DealsSetConsiderOfflineRetrievalDeals func(context.Context, bool) error                                                 `perm:"admin"`
+		DealsIntakeEnqueue                    func(context.Context, market.ClientDealProposal, string, string) (cid.Cid, error) `perm:"admin"`
+		DealsIntakeList                       func(context.Context) ([]api.DealIntake, error)                                   `perm:"admin"`
+		DealsIntakeGet                        func(context.Context, cid.Cid) (api.DealIntake, error)                            `perm:"admin"`
+		DealsPieceCidBlocklist                func(context.Context) ([]cid.Cid, error)                                          `perm:"read"`
+		DealsSetPieceCidBlocklist             func(context.Context, []cid.Cid) error                                            `perm:"admin"`
 
 		StorageAddLocal func(ctx context.Context, path string) error `perm:"admin"`
 
-		PiecesListPieces   func(ctx context.Context) ([]cid.Cid, error)                               `perm:"read"`
-		PiecesListCidInfos func(ctx context.Context) ([]cid.Cid, error)                               `perm:"read"`
-		PiecesGetPieceInfo func(ctx context.Context, pieceCid cid.Cid) (*piecestore.PieceInfo, error) `perm:"read"`
-		PiecesGetCIDInfo   func(ctx context.Context, payloadCid cid.Cid) (*piecestore.CIDInfo, error) `perm:"read"`
+		PiecesListPieces   func(ctx context.Context) ([]cid.Cid, error)                                      `perm:"read"`
+		PiecesListCidInfos func(ctx context.Context) ([]cid.Cid, error)                                      `perm:"read"`
+		PiecesGetPieceInfo func(ctx context.Context, pieceCid cid.Cid) (*piecestore.PieceInfo, error)        `perm:"read"`
+		PiecesGetCIDInfo   func(ctx context.Context, payloadCid cid.Cid) (*piecestore.CIDInfo, error)        `perm:"read"`
+		PiecesBuildIndex   func(context.Context, abi.SectorNumber) ([]api.PieceIndex, error)                 `perm:"admin"`
+		PiecesLocateBlock  func(context.Context, abi.SectorNumber, cid.Cid) (api.SectorBlockLocation, error) `perm:"read"`
 	}
 }
 
@@ -331,22 +440,28 @@ type WorkerStruct struct {
 		Paths     func(context.Context) ([]stores.StoragePath, error)            `perm:"admin"`
 		Info      func(context.Context) (storiface.WorkerInfo, error)            `perm:"admin"`
 
-		AddPiece        func(ctx context.Context, sector abi.SectorID, pieceSizes []abi.UnpaddedPieceSize, newPieceSize abi.UnpaddedPieceSize, pieceData storage.Data) (abi.PieceInfo, error)                      `perm:"admin"`
-		SealPreCommit1  func(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error)                                                           `perm:"admin"`
-		SealPreCommit2  func(context.Context, abi.SectorID, storage.PreCommit1Out) (cids storage.SectorCids, err error)                                                                                            `perm:"admin"`
-		SealCommit1     func(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage.SectorCids) (storage.Commit1Out, error) `perm:"admin"`
-		SealCommit2     func(context.Context, abi.SectorID, storage.Commit1Out) (storage.Proof, error)                                                                                                             `perm:"admin"`
-		FinalizeSector  func(context.Context, abi.SectorID, []storage.Range) error                                                                                                                                 `perm:"admin"`
-		ReleaseUnsealed func(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error                                                                                                           `perm:"admin"`
-		Remove          func(ctx context.Context, sector abi.SectorID) error                                                                                                                                       `perm:"admin"`
-		MoveStorage     func(ctx context.Context, sector abi.SectorID, types stores.SectorFileType) error                                                                                                          `perm:"admin"`
-		StorageAddLocal func(ctx context.Context, path string) error                                                                                                                                               `perm:"admin"`
+		AddPiece           func(ctx context.Context, sector abi.SectorID, pieceSizes []abi.UnpaddedPieceSize, newPieceSize abi.UnpaddedPieceSize, pieceData storage.Data) (abi.PieceInfo, error)                      `perm:"admin"`
+		SealPreCommit1     func(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error)                                                           `perm:"admin"`
+		SealPreCommit2     func(context.Context, abi.SectorID, storage.PreCommit1Out) (cids storage.SectorCids, err error)                                                                                            `perm:"admin"`
+		SealCommit1        func(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage.SectorCids) (storage.Commit1Out, error) `perm:"admin"`
+		SealCommit2        func(context.Context, abi.SectorID, storage.Commit1Out) (storage.Proof, error)                                                                                                             `perm:"admin"`
+		FinalizeSector     func(context.Context, abi.SectorID, []storage.Range) error                                                                                                                                 `perm:"admin"`
+		FinalizeSectorTrim func(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error                                                                         `perm:"admin"`
+		ReleaseUnsealed    func(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error                                                                                                           `perm:"admin"`
+		Remove             func(ctx context.Context, sector abi.SectorID) error                                                                                                                                       `perm:"admin"`
+		MoveStorage        func(ctx context.Context, sector abi.SectorID, types stores.SectorFileType) error                                                                                                          `perm:"admin"`
+		StorageAddLocal    func(ctx context.Context, path string) error                                                                                                                                               `perm:"admin"`
 
 		UnsealPiece func(context.Context, abi.SectorID, storiface.UnpaddedByteIndex, abi.UnpaddedPieceSize, abi.SealRandomness, cid.Cid) error `perm:"admin"`
 		ReadPiece   func(context.Context, io.Writer, abi.SectorID, storiface.UnpaddedByteIndex, abi.UnpaddedPieceSize) (bool, error)           `perm:"admin"`
 
 		Fetch func(context.Context, abi.SectorID, stores.SectorFileType, stores.PathType, stores.AcquireMode) error `perm:"admin"`
 
+		ChainHeadUpdate func(context.Context, storiface.ChainHead) error                                      `perm:"admin"`
+		TaskEnergy      func(context.Context) (storiface.WorkerEnergy, error)                                 `perm:"admin"`
+		Operations      func(context.Context) ([]ops.Status, error)                                           `perm:"admin"`
+		TaskForensics   func(context.Context, abi.SectorID, sealtasks.TaskType) (*storiface.Forensics, error) `perm:"admin"`
+
 		Closing func(context.Context) (<-chan struct{}, error) `perm:"admin"`
 	}
 }
@@ -397,6 +512,26 @@ func (c *CommonStruct) NetBandwidthStats(ctx context.Context) (metrics.Stats, er
 	return c.Internal.NetBandwidthStats(ctx)
 }
 
+func (c *CommonStruct) NetBootstrapList(ctx context.Context) ([]peer.AddrInfo, error) {
+	return c.Internal.NetBootstrapList(ctx)
+}
+
+func (c *CommonStruct) NetBootstrapAdd(ctx context.Context, ai peer.AddrInfo) error {
+	return c.Internal.NetBootstrapAdd(ctx, ai)
+}
+
+func (c *CommonStruct) NetBootstrapRemove(ctx context.Context, p peer.ID) error {
+	return c.Internal.NetBootstrapRemove(ctx, p)
+}
+
+func (c *CommonStruct) NetKnownMiners(ctx context.Context) ([]peer.AddrInfo, error) {
+	return c.Internal.NetKnownMiners(ctx)
+}
+
+func (c *CommonStruct) NetStats(ctx context.Context) (api.NetStats, error) {
+	return c.Internal.NetStats(ctx)
+}
+
 func (c *CommonStruct) NetBandwidthStatsByPeer(ctx context.Context) (map[string]metrics.Stats, error) {
 	return c.Internal.NetBandwidthStatsByPeer(ctx)
 }
@@ -419,6 +554,10 @@ func (c *CommonStruct) Version(ctx context.Context) (api.Version, error) {
 	return c.Internal.Version(ctx)
 }
 
+func (c *CommonStruct) BuildInfo(ctx context.Context) (api.BuildInfo, error) {
+	return c.Internal.BuildInfo(ctx)
+}
+
 func (c *CommonStruct) LogList(ctx context.Context) ([]string, error) {
 	return c.Internal.LogList(ctx)
 }
@@ -435,6 +574,18 @@ func (c *CommonStruct) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return c.Internal.Closing(ctx)
 }
 
+func (c *CommonStruct) DebugProfilesList(ctx context.Context) ([]api.ProfileInfo, error) {
+	return c.Internal.DebugProfilesList(ctx)
+}
+
+func (c *CommonStruct) DebugProfileGet(ctx context.Context, name string) ([]byte, error) {
+	return c.Internal.DebugProfileGet(ctx, name)
+}
+
+func (c *CommonStruct) DebugBackgroundTasks(ctx context.Context) ([]api.BackgroundTask, error) {
+	return c.Internal.DebugBackgroundTasks(ctx)
+}
+
 // FullNodeStruct
 
 func (c *FullNodeStruct) ClientListImports(ctx context.Context) ([]api.Import, error) {
@@ -488,10 +639,30 @@ func (c *FullNodeStruct) ClientRetrieveWithEvents(ctx context.Context, order api
 func (c *FullNodeStruct) ClientQueryAsk(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error) {
 	return c.Internal.ClientQueryAsk(ctx, p, miner)
 }
+
+func (c *FullNodeStruct) ClientFindMiners(ctx context.Context, params api.FindMinersParams) ([]api.MinerAsk, error) {
+	return c.Internal.ClientFindMiners(ctx, params)
+}
 func (c *FullNodeStruct) ClientCalcCommP(ctx context.Context, inpath string) (*api.CommPRet, error) {
 	return c.Internal.ClientCalcCommP(ctx, inpath)
 }
 
+func (c *FullNodeStruct) ClientCommPQueue(ctx context.Context, inpath string) (api.CommPJob, error) {
+	return c.Internal.ClientCommPQueue(ctx, inpath)
+}
+
+func (c *FullNodeStruct) ClientCommPJobs(ctx context.Context) ([]api.CommPJob, error) {
+	return c.Internal.ClientCommPJobs(ctx)
+}
+
+func (c *FullNodeStruct) ClientDealTransfers(ctx context.Context, miner address.Address, proposal *cid.Cid) (api.DealTransfers, error) {
+	return c.Internal.ClientDealTransfers(ctx, miner, proposal)
+}
+
+func (c *FullNodeStruct) ClientPushDealData(ctx context.Context, miner address.Address, proposal cid.Cid, inpath string, protocol string) (string, error) {
+	return c.Internal.ClientPushDealData(ctx, miner, proposal, inpath, protocol)
+}
+
 func (c *FullNodeStruct) ClientGenCar(ctx context.Context, ref api.FileRef, outpath string) error {
 	return c.Internal.ClientGenCar(ctx, ref, outpath)
 }
@@ -524,6 +695,14 @@ func (c *FullNodeStruct) GasEstimateMessageGas(ctx context.Context, msg *types.M
 	return c.Internal.GasEstimateMessageGas(ctx, msg, spec, tsk)
 }
 
+func (c *FullNodeStruct) GasTrend(ctx context.Context, lookback, horizon abi.ChainEpoch, tsk types.TipSetKey) (*api.GasTrend, error) {
+	return c.Internal.GasTrend(ctx, lookback, horizon, tsk)
+}
+
+func (c *FullNodeStruct) GasShouldSendNow(ctx context.Context, kind string, deadline abi.ChainEpoch, tsk types.TipSetKey) (*api.SendAdvice, error) {
+	return c.Internal.GasShouldSendNow(ctx, kind, deadline, tsk)
+}
+
 func (c *FullNodeStruct) GasEstimateGasLimit(ctx context.Context, msg *types.Message, tsk types.TipSetKey) (int64, error) {
 	return c.Internal.GasEstimateGasLimit(ctx, msg, tsk)
 }
@@ -556,6 +735,18 @@ func (c *FullNodeStruct) MpoolPushMessage(ctx context.Context, msg *types.Messag
 	return c.Internal.MpoolPushMessage(ctx, msg, spec)
 }
 
+func (c *FullNodeStruct) MpoolPendingApprovals(ctx context.Context) ([]api.PendingApproval, error) {
+	return c.Internal.MpoolPendingApprovals(ctx)
+}
+
+func (c *FullNodeStruct) MpoolApprove(ctx context.Context, id uint64, approver address.Address, sig *crypto.Signature) (*types.SignedMessage, error) {
+	return c.Internal.MpoolApprove(ctx, id, approver, sig)
+}
+
+func (c *FullNodeStruct) MpoolReject(ctx context.Context, id uint64) error {
+	return c.Internal.MpoolReject(ctx, id)
+}
+
 func (c *FullNodeStruct) MpoolSub(ctx context.Context) (<-chan api.MpoolUpdate, error) {
 	return c.Internal.MpoolSub(ctx)
 }
@@ -956,6 +1147,10 @@ func (c *FullNodeStruct) MarketEnsureAvailable(ctx context.Context, addr, wallet
 	return c.Internal.MarketEnsureAvailable(ctx, addr, wallet, amt)
 }
 
+func (c *FullNodeStruct) MarketFundsStatus(ctx context.Context) ([]api.MarketEscrowStatus, error) {
+	return c.Internal.MarketFundsStatus(ctx)
+}
+
 func (c *FullNodeStruct) PaychGet(ctx context.Context, from, to address.Address, amt types.BigInt) (*api.ChannelInfo, error) {
 	return c.Internal.PaychGet(ctx, from, to, amt)
 }
@@ -1030,6 +1225,66 @@ func (c *StorageMinerStruct) MiningBase(ctx context.Context) (*types.TipSet, err
 	return c.Internal.MiningBase(ctx)
 }
 
+func (c *StorageMinerStruct) ActorKeyChangePropose(ctx context.Context, newWorker address.Address, newControlAddrs []address.Address) (api.KeyChangeProposal, error) {
+	return c.Internal.ActorKeyChangePropose(ctx, newWorker, newControlAddrs)
+}
+
+func (c *StorageMinerStruct) ActorKeyChangeList(ctx context.Context) ([]api.KeyChangeProposal, error) {
+	return c.Internal.ActorKeyChangeList(ctx)
+}
+
+func (c *StorageMinerStruct) ActorKeyChangeApprove(ctx context.Context, id uint64, approver address.Address, sig *crypto.Signature) (api.KeyChangeProposal, error) {
+	return c.Internal.ActorKeyChangeApprove(ctx, id, approver, sig)
+}
+
+func (c *StorageMinerStruct) ActorKeyChangeCancel(ctx context.Context, id uint64) error {
+	return c.Internal.ActorKeyChangeCancel(ctx, id)
+}
+
+func (c *StorageMinerStruct) ActorKeyChangeExecute(ctx context.Context, id uint64) (cid.Cid, error) {
+	return c.Internal.ActorKeyChangeExecute(ctx, id)
+}
+
+func (c *StorageMinerStruct) AlertRules(ctx context.Context) ([]api.AlertRule, error) {
+	return c.Internal.AlertRules(ctx)
+}
+
+func (c *StorageMinerStruct) ActorSweep(ctx context.Context, dryRun bool) (api.SweepRecord, error) {
+	return c.Internal.ActorSweep(ctx, dryRun)
+}
+
+func (c *StorageMinerStruct) ActorSweepHistory(ctx context.Context) ([]api.SweepRecord, error) {
+	return c.Internal.ActorSweepHistory(ctx)
+}
+
+func (c *StorageMinerStruct) OutboxList(ctx context.Context) ([]api.OutboxMessage, error) {
+	return c.Internal.OutboxList(ctx)
+}
+
+func (c *StorageMinerStruct) OutboxSign(ctx context.Context, id uint64, sig crypto.Signature) (cid.Cid, error) {
+	return c.Internal.OutboxSign(ctx, id, sig)
+}
+
+func (c *StorageMinerStruct) OutboxDrop(ctx context.Context, id uint64) error {
+	return c.Internal.OutboxDrop(ctx, id)
+}
+
+func (c *StorageMinerStruct) CronJobs(ctx context.Context) ([]api.CronJob, error) {
+	return c.Internal.CronJobs(ctx)
+}
+
+func (c *StorageMinerStruct) CronRun(ctx context.Context, job string) (api.CronRun, error) {
+	return c.Internal.CronRun(ctx, job)
+}
+
+func (c *StorageMinerStruct) CronHistory(ctx context.Context, job string) ([]api.CronRun, error) {
+	return c.Internal.CronHistory(ctx, job)
+}
+
+func (c *StorageMinerStruct) NodeConnectionStatus(ctx context.Context) ([]api.NodeEndpointStatus, error) {
+	return c.Internal.NodeConnectionStatus(ctx)
+}
+
 func (c *StorageMinerStruct) ActorSectorSize(ctx context.Context, addr address.Address) (abi.SectorSize, error) {
 	return c.Internal.ActorSectorSize(ctx, addr)
 }
@@ -1038,6 +1293,22 @@ func (c *StorageMinerStruct) PledgeSector(ctx context.Context) error {
 	return c.Internal.PledgeSector(ctx)
 }
 
+func (c *StorageMinerStruct) PledgePause(ctx context.Context) error {
+	return c.Internal.PledgePause(ctx)
+}
+
+func (c *StorageMinerStruct) PledgeResume(ctx context.Context) error {
+	return c.Internal.PledgeResume(ctx)
+}
+
+func (c *StorageMinerStruct) PledgeStatus(ctx context.Context) (dtypes.PledgeState, error) {
+	return c.Internal.PledgeStatus(ctx)
+}
+
+func (c *StorageMinerStruct) ProvingForceSubmit(ctx context.Context, dl uint64, maxFee abi.TokenAmount) ([]cid.Cid, error) {
+	return c.Internal.ProvingForceSubmit(ctx, dl, maxFee)
+}
+
 // Get the status of a given sector by ID
 func (c *StorageMinerStruct) SectorsStatus(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (api.SectorInfo, error) {
 	return c.Internal.SectorsStatus(ctx, sid, showOnChainInfo)
@@ -1052,6 +1323,38 @@ func (c *StorageMinerStruct) SectorsRefs(ctx context.Context) (map[string][]api.
 	return c.Internal.SectorsRefs(ctx)
 }
 
+func (c *StorageMinerStruct) SectorsUpdates(ctx context.Context) (<-chan api.SectorUpdate, error) {
+	return c.Internal.SectorsUpdates(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsWebhooks(ctx context.Context) ([]api.SectorWebhookStatus, error) {
+	return c.Internal.SectorsWebhooks(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsWebhooksReplay(ctx context.Context, since time.Time, url string) (uint64, error) {
+	return c.Internal.SectorsWebhooksReplay(ctx, since, url)
+}
+
+func (c *StorageMinerStruct) AnalyticsGas(ctx context.Context, from, to time.Time) ([]api.GasReportDay, error) {
+	return c.Internal.AnalyticsGas(ctx, from, to)
+}
+
+func (c *StorageMinerStruct) AnalyticsExpiredPreCommits(ctx context.Context) ([]api.ExpiredPreCommit, error) {
+	return c.Internal.AnalyticsExpiredPreCommits(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsSetLabels(ctx context.Context, sid abi.SectorNumber, labels map[string]string) error {
+	return c.Internal.SectorsSetLabels(ctx, sid, labels)
+}
+
+func (c *StorageMinerStruct) SectorsQuery(ctx context.Context, q api.SectorQuery) (api.SectorQueryResult, error) {
+	return c.Internal.SectorsQuery(ctx, q)
+}
+
+func (c *StorageMinerStruct) SectorsListLabels(ctx context.Context, selector map[string]string) ([]api.SectorLabels, error) {
+	return c.Internal.SectorsListLabels(ctx, selector)
+}
+
 func (c *StorageMinerStruct) SectorStartSealing(ctx context.Context, number abi.SectorNumber) error {
 	return c.Internal.SectorStartSealing(ctx, number)
 }
@@ -1080,14 +1383,86 @@ func (c *StorageMinerStruct) SectorRemove(ctx context.Context, number abi.Sector
 	return c.Internal.SectorRemove(ctx, number)
 }
 
+func (c *StorageMinerStruct) SectorTrimCache(ctx context.Context, number abi.SectorNumber, level storiface.CacheTrimLevel) error {
+	return c.Internal.SectorTrimCache(ctx, number, level)
+}
+
+func (c *StorageMinerStruct) SectorArchive(ctx context.Context, number abi.SectorNumber, removeLocal bool) error {
+	return c.Internal.SectorArchive(ctx, number, removeLocal)
+}
+
+func (c *StorageMinerStruct) SectorRecall(ctx context.Context, number abi.SectorNumber) (storiface.RecallStatus, error) {
+	return c.Internal.SectorRecall(ctx, number)
+}
+
+func (c *StorageMinerStruct) SectorArchiveList(ctx context.Context) ([]storiface.ArchivedSector, error) {
+	return c.Internal.SectorArchiveList(ctx)
+}
+
+func (c *StorageMinerStruct) SectorExternalAllocate(ctx context.Context) (abi.SectorID, error) {
+	return c.Internal.SectorExternalAllocate(ctx)
+}
+
+func (c *StorageMinerStruct) SectorExternalAddPiece(ctx context.Context, id abi.SectorNumber, piece api.ExternalPiece) error {
+	return c.Internal.SectorExternalAddPiece(ctx, id, piece)
+}
+
+func (c *StorageMinerStruct) SectorExternalSealed(ctx context.Context, id abi.SectorNumber, info api.ExternalSealedInfo) error {
+	return c.Internal.SectorExternalSealed(ctx, id, info)
+}
+
+func (c *StorageMinerStruct) SectorExternalRelease(ctx context.Context, id abi.SectorNumber) error {
+	return c.Internal.SectorExternalRelease(ctx, id)
+}
+
+func (c *StorageMinerStruct) SectorAddPieceToAny(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, deal api.PieceDealInfo) (api.SectorOffset, error) {
+	return c.Internal.SectorAddPieceToAny(ctx, size, r, deal)
+}
+
 func (c *StorageMinerStruct) SectorMarkForUpgrade(ctx context.Context, number abi.SectorNumber) error {
 	return c.Internal.SectorMarkForUpgrade(ctx, number)
 }
 
+func (c *StorageMinerStruct) SectorUnsealRange(ctx context.Context, id abi.SectorNumber, offset, length uint64) ([]byte, error) {
+	return c.Internal.SectorUnsealRange(ctx, id, offset, length)
+}
+
 func (c *StorageMinerStruct) WorkerConnect(ctx context.Context, url string) error {
 	return c.Internal.WorkerConnect(ctx, url)
 }
 
+func (c *StorageMinerStruct) WorkerRegister(ctx context.Context, reg api.WorkerRegistration) (api.WorkerRegState, error) {
+	return c.Internal.WorkerRegister(ctx, reg)
+}
+
+func (c *StorageMinerStruct) WorkerConnectRegistered(ctx context.Context, id string) error {
+	return c.Internal.WorkerConnectRegistered(ctx, id)
+}
+
+func (c *StorageMinerStruct) WorkerRegistrations(ctx context.Context) ([]api.WorkerRegistration, error) {
+	return c.Internal.WorkerRegistrations(ctx)
+}
+
+func (c *StorageMinerStruct) WorkerRegistrationAccept(ctx context.Context, id string) error {
+	return c.Internal.WorkerRegistrationAccept(ctx, id)
+}
+
+func (c *StorageMinerStruct) WorkerRegistrationDeny(ctx context.Context, id string) error {
+	return c.Internal.WorkerRegistrationDeny(ctx, id)
+}
+
+func (c *StorageMinerStruct) WorkerTaskAffinity(ctx context.Context) (api.WorkerTaskAffinity, error) {
+	return c.Internal.WorkerTaskAffinity(ctx)
+}
+
+func (c *StorageMinerStruct) WorkerTaskSet(ctx context.Context, hostname string, tasks []sealtasks.TaskType, enabled bool) error {
+	return c.Internal.WorkerTaskSet(ctx, hostname, tasks, enabled)
+}
+
+func (c *StorageMinerStruct) WorkerTaskReset(ctx context.Context, hostname string, tasks []sealtasks.TaskType) error {
+	return c.Internal.WorkerTaskReset(ctx, hostname, tasks)
+}
+
 func (c *StorageMinerStruct) WorkerStats(ctx context.Context) (map[uint64]storiface.WorkerStats, error) {
 	return c.Internal.WorkerStats(ctx)
 }
@@ -1096,10 +1471,82 @@ func (c *StorageMinerStruct) WorkerJobs(ctx context.Context) (map[uint64][]stori
 	return c.Internal.WorkerJobs(ctx)
 }
 
+func (c *StorageMinerStruct) WorkerSummaries(ctx context.Context) ([]storiface.WorkerSummary, error) {
+	return c.Internal.WorkerSummaries(ctx)
+}
+
+func (c *StorageMinerStruct) WorkerTokenCreate(ctx context.Context, name string, perms []auth.Permission) ([]byte, error) {
+	return c.Internal.WorkerTokenCreate(ctx, name, perms)
+}
+
+func (c *StorageMinerStruct) WorkerTokenList(ctx context.Context) ([]api.WorkerToken, error) {
+	return c.Internal.WorkerTokenList(ctx)
+}
+
+func (c *StorageMinerStruct) WorkerTokenRevoke(ctx context.Context, nameOrID string) error {
+	return c.Internal.WorkerTokenRevoke(ctx, nameOrID)
+}
+
+func (c *StorageMinerStruct) WorkerEnergy(ctx context.Context) (map[uint64]storiface.WorkerEnergy, error) {
+	return c.Internal.WorkerEnergy(ctx)
+}
+
+func (c *StorageMinerStruct) WorkerBenchTransfer(ctx context.Context, worker uint64, sizes []uint64, pings int) ([]storiface.TransferBench, error) {
+	return c.Internal.WorkerBenchTransfer(ctx, worker, sizes, pings)
+}
+
+func (c *StorageMinerStruct) OperationsList(ctx context.Context) ([]ops.Status, error) {
+	return c.Internal.OperationsList(ctx)
+}
+
+func (c *StorageMinerStruct) OperationStatus(ctx context.Context, id string) (ops.Status, error) {
+	return c.Internal.OperationStatus(ctx, id)
+}
+
+func (c *StorageMinerStruct) AuthNewWithQuota(ctx context.Context, perms []auth.Permission, q quota.Quota) ([]byte, error) {
+	return c.Internal.AuthNewWithQuota(ctx, perms, q)
+}
+
+func (c *StorageMinerStruct) TokenUsage(ctx context.Context, token string) (quota.Usage, error) {
+	return c.Internal.TokenUsage(ctx, token)
+}
+
 func (c *StorageMinerStruct) SealingSchedDiag(ctx context.Context) (interface{}, error) {
 	return c.Internal.SealingSchedDiag(ctx)
 }
 
+func (c *StorageMinerStruct) SealingSchedExplain(ctx context.Context, taskID uint64) (storiface.SchedExplanation, error) {
+	return c.Internal.SealingSchedExplain(ctx, taskID)
+}
+
+func (c *StorageMinerStruct) SealingSchedSectorHistory(ctx context.Context, sector abi.SectorNumber) ([]storiface.SchedExplanation, error) {
+	return c.Internal.SealingSchedSectorHistory(ctx, sector)
+}
+
+func (c *StorageMinerStruct) SealingDrain(ctx context.Context) error {
+	return c.Internal.SealingDrain(ctx)
+}
+
+func (c *StorageMinerStruct) SealingTuneReport(ctx context.Context) (api.TuneReport, error) {
+	return c.Internal.SealingTuneReport(ctx)
+}
+
+func (c *StorageMinerStruct) SealingTuneApply(ctx context.Context, changes []api.TuneSuggestion) error {
+	return c.Internal.SealingTuneApply(ctx, changes)
+}
+
+func (c *StorageMinerStruct) SealingTuning(ctx context.Context, hostname string) (map[string]string, error) {
+	return c.Internal.SealingTuning(ctx, hostname)
+}
+
+func (c *StorageMinerStruct) ConfigReload(ctx context.Context) (api.ConfigReload, error) {
+	return c.Internal.ConfigReload(ctx)
+}
+
+func (c *StorageMinerStruct) SyncLag(ctx context.Context) (api.SyncLag, error) {
+	return c.Internal.SyncLag(ctx)
+}
+
 func (c *StorageMinerStruct) StorageAttach(ctx context.Context, si stores.StorageInfo, st fsutil.FsStat) error {
 	return c.Internal.StorageAttach(ctx, si, st)
 }
@@ -1160,6 +1607,10 @@ func (c *StorageMinerStruct) MarketListRetrievalDeals(ctx context.Context) ([]re
 	return c.Internal.MarketListRetrievalDeals(ctx)
 }
 
+func (c *StorageMinerStruct) MarketRetrievalStats(ctx context.Context) (api.RetrievalStats, error) {
+	return c.Internal.MarketRetrievalStats(ctx)
+}
+
 func (c *StorageMinerStruct) MarketGetDealUpdates(ctx context.Context) (<-chan storagemarket.MinerDeal, error) {
 	return c.Internal.MarketGetDealUpdates(ctx)
 }
@@ -1192,6 +1643,26 @@ func (c *StorageMinerStruct) MarketDataTransferUpdates(ctx context.Context) (<-c
 	return c.Internal.MarketDataTransferUpdates(ctx)
 }
 
+func (c *StorageMinerStruct) MarketSetDealLabels(ctx context.Context, propCid cid.Cid, labels map[string]string) error {
+	return c.Internal.MarketSetDealLabels(ctx, propCid, labels)
+}
+
+func (c *StorageMinerStruct) MarketListDealLabels(ctx context.Context, selector map[string]string) ([]api.DealLabels, error) {
+	return c.Internal.MarketListDealLabels(ctx, selector)
+}
+
+func (c *StorageMinerStruct) MarketInspectDeal(ctx context.Context, dealID abi.DealID, blocks bool) (*api.DealInspection, error) {
+	return c.Internal.MarketInspectDeal(ctx, dealID, blocks)
+}
+
+func (c *StorageMinerStruct) MarketDealPayments(ctx context.Context) (*api.DealPaymentReport, error) {
+	return c.Internal.MarketDealPayments(ctx)
+}
+
+func (c *StorageMinerStruct) MarketDealPaymentHistory(ctx context.Context) ([]api.DealPaymentReport, error) {
+	return c.Internal.MarketDealPaymentHistory(ctx)
+}
+
 func (c *StorageMinerStruct) DealsImportData(ctx context.Context, dealPropCid cid.Cid, file string) error {
 	return c.Internal.DealsImportData(ctx, dealPropCid, file)
 }
@@ -1240,6 +1711,18 @@ func (c *StorageMinerStruct) DealsSetConsiderOfflineRetrievalDeals(ctx context.C
 	return c.Internal.DealsSetConsiderOfflineRetrievalDeals(ctx, b)
 }
 
+func (c *StorageMinerStruct) DealsIntakeEnqueue(ctx context.Context, proposal market.ClientDealProposal, file string, callbackURL string) (cid.Cid, error) {
+	return c.Internal.DealsIntakeEnqueue(ctx, proposal, file, callbackURL)
+}
+
+func (c *StorageMinerStruct) DealsIntakeList(ctx context.Context) ([]api.DealIntake, error) {
+	return c.Internal.DealsIntakeList(ctx)
+}
+
+func (c *StorageMinerStruct) DealsIntakeGet(ctx context.Context, proposalCid cid.Cid) (api.DealIntake, error) {
+	return c.Internal.DealsIntakeGet(ctx, proposalCid)
+}
+
 func (c *StorageMinerStruct) StorageAddLocal(ctx context.Context, path string) error {
 	return c.Internal.StorageAddLocal(ctx, path)
 }
@@ -1260,6 +1743,14 @@ func (c *StorageMinerStruct) PiecesGetCIDInfo(ctx context.Context, payloadCid ci
 	return c.Internal.PiecesGetCIDInfo(ctx, payloadCid)
 }
 
+func (c *StorageMinerStruct) PiecesBuildIndex(ctx context.Context, sector abi.SectorNumber) ([]api.PieceIndex, error) {
+	return c.Internal.PiecesBuildIndex(ctx, sector)
+}
+
+func (c *StorageMinerStruct) PiecesLocateBlock(ctx context.Context, sector abi.SectorNumber, block cid.Cid) (api.SectorBlockLocation, error) {
+	return c.Internal.PiecesLocateBlock(ctx, sector, block)
+}
+
 // WorkerStruct
 
 func (w *WorkerStruct) Version(ctx context.Context) (build.Version, error) {
@@ -1302,6 +1793,10 @@ func (w *WorkerStruct) FinalizeSector(ctx context.Context, sector abi.SectorID,
 	return w.Internal.FinalizeSector(ctx, sector, keepUnsealed)
 }
 
+func (w *WorkerStruct) FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error {
+	return w.Internal.FinalizeSectorTrim(ctx, sector, keepUnsealed, level)
+}
+
 func (w *WorkerStruct) ReleaseUnsealed(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error {
 	return w.Internal.ReleaseUnsealed(ctx, sector, safeToFree)
 }
@@ -1330,6 +1825,22 @@ func (w *WorkerStruct) Fetch(ctx context.Context, id abi.SectorID, fileType stor
 	return w.Internal.Fetch(ctx, id, fileType, ptype, am)
 }
 
+func (w *WorkerStruct) ChainHeadUpdate(ctx context.Context, head storiface.ChainHead) error {
+	return w.Internal.ChainHeadUpdate(ctx, head)
+}
+
+func (w *WorkerStruct) TaskEnergy(ctx context.Context) (storiface.WorkerEnergy, error) {
+	return w.Internal.TaskEnergy(ctx)
+}
+
+func (w *WorkerStruct) Operations(ctx context.Context) ([]ops.Status, error) {
+	return w.Internal.Operations(ctx)
+}
+
+func (w *WorkerStruct) TaskForensics(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType) (*storiface.Forensics, error) {
+	return w.Internal.TaskForensics(ctx, sector, task)
+}
+
 func (w *WorkerStruct) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return w.Internal.Closing(ctx)
 }
@@ -1,9 +1,61 @@
 package apistruct
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
 
 func TestPermTags(t *testing.T) {
 	_ = PermissionedFullAPI(&FullNodeStruct{})
 	_ = PermissionedStorMinerAPI(&StorageMinerStruct{})
 	_ = PermissionedWorkerAPI(&WorkerStruct{})
 }
+
+func TestDegraded(t *testing.T) {
+	var c CommonStruct
+	c.Internal.LogList = func(context.Context) ([]string, error) {
+		return []string{"miner"}, nil
+	}
+
+	errDegraded := errors.New("degraded")
+	a := DegradedStorMinerAPI(&c, errDegraded)
+
+	l, err := a.LogList(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, []string{"miner"}, l)
+
+	_, err = a.ActorAddress(context.TODO())
+	require.Equal(t, errDegraded, err)
+	require.Equal(t, errDegraded, a.SectorRemove(context.TODO(), 1))
+}
+
+func TestMarkets(t *testing.T) {
+	internal := reflect.TypeOf(StorageMinerStruct{}.Internal)
+	for m := range MarketsMethods {
+		_, ok := internal.FieldByName(m)
+		require.True(t, ok, "markets method %s is not a storage miner method", m)
+	}
+
+	var sm StorageMinerStruct
+	sm.Internal.MarketGetAsk = func(context.Context) (*storagemarket.SignedStorageAsk, error) {
+		return &storagemarket.SignedStorageAsk{}, nil
+	}
+	sm.CommonStruct.Internal.LogList = func(context.Context) ([]string, error) {
+		return []string{"markets"}, nil
+	}
+	a := MarketsStorMinerAPI(&sm)
+
+	_, err := a.MarketGetAsk(context.TODO())
+	require.NoError(t, err)
+	l, err := a.LogList(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, []string{"markets"}, l)
+
+	require.Equal(t, ErrNotOnMarketsNode, a.SectorRemove(context.TODO(), 1))
+}
@@ -54,20 +54,25 @@ func NewStorageMinerRPC(ctx context.Context, addr string, requestHeader http.Hea
 	return &res, closer, err
 }
 
-func NewWorkerRPC(ctx context.Context, addr string, requestHeader http.Header) (api.WorkerAPI, jsonrpc.ClientCloser, error) {
-	u, err := url.Parse(addr)
+// NewSealerRPC creates a new http jsonrpc client for the storage miner API of
+// a sealing miner, for markets nodes. io.Reader params, the deal data added
+// with SectorAddPieceToAny, are pushed over http.
+func NewSealerRPC(ctx context.Context, addr string, requestHeader http.Header) (api.StorageMiner, jsonrpc.ClientCloser, error) {
+	///rpc/v0 -> /rpc/streams/v0/push
+	push, err := HTTPURL(addr, "../streams/v0/push")
 	if err != nil {
 		return nil, nil, err
 	}
-	switch u.Scheme {
-	case "ws":
-		u.Scheme = "http"
-	case "wss":
-		u.Scheme = "https"
-	}
-	///rpc/v0 -> /rpc/streams/v0/push
 
-	u.Path = path.Join(u.Path, "../streams/v0/push")
+	return NewStorageMinerRPC(ctx, addr, requestHeader, rpcenc.ReaderParamEncoder(push))
+}
+
+func NewWorkerRPC(ctx context.Context, addr string, requestHeader http.Header) (api.WorkerAPI, jsonrpc.ClientCloser, error) {
+	///rpc/v0 -> /rpc/streams/v0/push
+	push, err := HTTPURL(addr, "../streams/v0/push")
+	if err != nil {
+		return nil, nil, err
+	}
 
 	var res apistruct.WorkerStruct
 	closer, err := jsonrpc.NewMergeClient(ctx, addr, "Filecoin",
@@ -75,10 +80,28 @@ func NewWorkerRPC(ctx context.Context, addr string, requestHeader http.Header) (
 			&res.Internal,
 		},
 		requestHeader,
-		rpcenc.ReaderParamEncoder(u.String()),
+		rpcenc.ReaderParamEncoder(push),
 		jsonrpc.WithNoReconnect(),
 		jsonrpc.WithTimeout(30*time.Second),
 	)
 
 	return &res, closer, err
 }
+
+// HTTPURL returns the http URL of the endpoint at rel, relative to the path
+// of the websocket RPC address addr
+func HTTPURL(addr string, rel string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+
+	u.Path = path.Join(u.Path, rel)
+	return u.String(), nil
+}
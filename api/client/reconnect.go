@@ -0,0 +1,336 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = time.Minute
+)
+
+// ErrDisconnected is returned by calls made while a reconnecting client is
+// redialing the full node
+var ErrDisconnected = xerrors.New("full node disconnected")
+
+// Dialer connects to a full node. It should also check the node version, so
+// a node which was upgraded to an incompatible API isn't used.
+type Dialer func(ctx context.Context) (api.FullNode, jsonrpc.ClientCloser, error)
+
+type reconnecting struct {
+	ctx  context.Context
+	dial Dialer
+
+	lk      sync.Mutex
+	node    api.FullNode
+	closer  jsonrpc.ClientCloser
+	lastErr string
+	// ready is closed once node is connected again
+	ready chan struct{}
+}
+
+// reconnectingFullNode is the api.FullNode returned by NewReconnectingFullNode
+type reconnectingFullNode struct {
+	*apistruct.FullNodeStruct
+	r *reconnecting
+}
+
+// NewReconnectingFullNode wraps the full node client n, which was dialed
+// with dial. When a call fails because the connection is lost, e.g. because
+// the daemon restarted, the node is redialed with exponential backoff. Until
+// the node is back calls fail with ErrDisconnected.
+//
+// ChainNotify channels survive reconnects: the subscription is renewed and
+// the head changes missed while disconnected are sent as one notification.
+//
+// The returned closer stops reconnecting and closes the current client.
+func NewReconnectingFullNode(ctx context.Context, n api.FullNode, closer jsonrpc.ClientCloser, dial Dialer) (api.FullNode, jsonrpc.ClientCloser) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r := &reconnecting{
+		ctx:    ctx,
+		dial:   dial,
+		node:   n,
+		closer: closer,
+	}
+
+	out := &reconnectingFullNode{
+		FullNodeStruct: &apistruct.FullNodeStruct{},
+		r:              r,
+	}
+	r.bind(reflect.ValueOf(&out.CommonStruct.Internal).Elem())
+	r.bind(reflect.ValueOf(&out.Internal).Elem())
+	out.Internal.ChainNotify = r.chainNotify
+
+	return out, func() {
+		cancel()
+
+		r.lk.Lock()
+		defer r.lk.Unlock()
+		if r.closer != nil {
+			r.closer()
+			r.closer = nil
+		}
+	}
+}
+
+func (n *reconnectingFullNode) NodeConnectionStatus(ctx context.Context) ([]api.NodeEndpointStatus, error) {
+	node, err := n.r.current()
+	if err != nil {
+		return []api.NodeEndpointStatus{{Name: "default", LastError: err.Error()}}, nil
+	}
+	if rep, ok := node.(NodeStatusReporter); ok {
+		return rep.NodeConnectionStatus(ctx)
+	}
+
+	st := api.NodeEndpointStatus{Name: "default"}
+	start := time.Now()
+	head, err := node.ChainHead(ctx)
+	st.Latency = time.Since(start)
+	if err != nil {
+		st.LastError = err.Error()
+		return []api.NodeEndpointStatus{st}, nil
+	}
+	st.Healthy = true
+	st.Height = head.Height()
+
+	n.r.lk.Lock()
+	st.LastError = n.r.lastErr
+	n.r.lk.Unlock()
+
+	return []api.NodeEndpointStatus{st}, nil
+}
+
+func (r *reconnecting) bind(internal reflect.Value) {
+	for i := 0; i < internal.NumField(); i++ {
+		f := internal.Field(i)
+		if f.Kind() != reflect.Func {
+			continue
+		}
+
+		method := internal.Type().Field(i).Name
+		ftyp := f.Type()
+		f.Set(reflect.MakeFunc(ftyp, func(args []reflect.Value) []reflect.Value {
+			node, err := r.current()
+			if err != nil {
+				err = xerrors.Errorf("calling %s: %w", method, err)
+				rerr := reflect.ValueOf(&err).Elem()
+				if ftyp.NumOut() == 2 {
+					return []reflect.Value{reflect.Zero(ftyp.Out(0)), rerr}
+				}
+				return []reflect.Value{rerr}
+			}
+
+			res := reflect.ValueOf(node).MethodByName(method).Call(args)
+			if len(res) > 0 {
+				if err, _ := res[len(res)-1].Interface().(error); connectionLost(err) {
+					r.failed(node, err)
+				}
+			}
+			return res
+		}))
+	}
+}
+
+// connectionLost reports whether err means the connection to the node is
+// gone, as opposed to the node returning an error
+func connectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var cerr *jsonrpc.ErrClient
+	return xerrors.As(err, &cerr) || strings.Contains(err.Error(), "websocket connection closed")
+}
+
+// current returns the connected node, or ErrDisconnected while redialing
+func (r *reconnecting) current() (api.FullNode, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if r.node == nil {
+		return nil, ErrDisconnected
+	}
+	return r.node, nil
+}
+
+// failed starts redialing when node is still the current node
+func (r *reconnecting) failed(node api.FullNode, err error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if r.node != node || r.ctx.Err() != nil {
+		return
+	}
+
+	log.Warnw("lost connection to full node, reconnecting", "error", err)
+
+	r.node = nil
+	r.lastErr = err.Error()
+	if r.closer != nil {
+		r.closer()
+		r.closer = nil
+	}
+	r.ready = make(chan struct{})
+	go r.reconnect(r.ready)
+}
+
+func (r *reconnecting) reconnect(ready chan struct{}) {
+	delay := reconnectMinDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return
+		}
+
+		node, closer, err := r.dial(r.ctx)
+		if err != nil {
+			log.Warnw("reconnecting to full node", "error", err, "retry", delay)
+
+			r.lk.Lock()
+			r.lastErr = err.Error()
+			r.lk.Unlock()
+
+			if delay *= 2; delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+			continue
+		}
+
+		r.lk.Lock()
+		if r.ctx.Err() != nil {
+			r.lk.Unlock()
+			closer()
+			return
+		}
+		r.node, r.closer = node, closer
+		r.lk.Unlock()
+
+		log.Info("reconnected to full node")
+		close(ready)
+		return
+	}
+}
+
+// wait returns the current node, waiting for a reconnect when node failed
+func (r *reconnecting) wait(ctx context.Context, node api.FullNode) (api.FullNode, error) {
+	if _, err := node.Version(ctx); connectionLost(err) {
+		r.failed(node, err)
+	}
+
+	r.lk.Lock()
+	cur, ready := r.node, r.ready
+	r.lk.Unlock()
+
+	if cur != nil {
+		return cur, nil
+	}
+
+	select {
+	case <-ready:
+		return r.current()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.ctx.Done():
+		return nil, r.ctx.Err()
+	}
+}
+
+func (r *reconnecting) chainNotify(ctx context.Context) (<-chan []*api.HeadChange, error) {
+	node, err := r.current()
+	if err != nil {
+		return nil, xerrors.Errorf("calling ChainNotify: %w", err)
+	}
+
+	in, err := node.ChainNotify(ctx)
+	if err != nil {
+		if connectionLost(err) {
+			r.failed(node, err)
+		}
+		return nil, err
+	}
+
+	out := make(chan []*api.HeadChange)
+	go func() {
+		defer close(out)
+
+		var head types.TipSetKey
+		for {
+			for changes := range in {
+				for _, c := range changes {
+					if c.Type == store.HCRevert {
+						head = c.Val.Parents()
+					} else {
+						head = c.Val.Key()
+					}
+				}
+
+				select {
+				case out <- changes:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			node, in, err = r.resubscribe(ctx, node, head, out)
+			if err != nil {
+				log.Warnw("renewing ChainNotify subscription failed, closing channel", "error", err)
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// resubscribe renews a ChainNotify subscription after its channel closed, once
+// the node is connected. The changes from head to the current head are sent
+// to out.
+func (r *reconnecting) resubscribe(ctx context.Context, node api.FullNode, head types.TipSetKey, out chan<- []*api.HeadChange) (api.FullNode, <-chan []*api.HeadChange, error) {
+	node, err := r.wait(ctx, node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in, err := node.ChainNotify(ctx)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("calling ChainNotify: %w", err)
+	}
+
+	cur, ok := <-in
+	if !ok || len(cur) != 1 || cur[0].Type != store.HCCurrent {
+		return nil, nil, xerrors.Errorf("expected a current head notification")
+	}
+
+	path, err := node.ChainGetPath(ctx, head, cur[0].Val.Key())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting changes missed while disconnected: %w", err)
+	}
+
+	if len(path) > 0 {
+		select {
+		case out <- path:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	return node, in, nil
+}
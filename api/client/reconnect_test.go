@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+func init() {
+	reconnectMinDelay = time.Millisecond
+}
+
+func TestReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts1 := mock.TipSet(mock.MkBlock(nil, 1, 1))
+	ts2 := mock.TipSet(mock.MkBlock(ts1, 1, 2))
+
+	var down bool
+	old := &apistruct.FullNodeStruct{}
+	old.Internal.ChainHead = func(ctx context.Context) (*types.TipSet, error) {
+		if down {
+			return nil, &jsonrpc.ErrClient{}
+		}
+		return ts1, nil
+	}
+	notifs := make(chan []*api.HeadChange, 1)
+	notifs <- []*api.HeadChange{{Type: store.HCCurrent, Val: ts1}}
+	old.Internal.ChainNotify = func(ctx context.Context) (<-chan []*api.HeadChange, error) {
+		return notifs, nil
+	}
+	old.CommonStruct.Internal.Version = func(ctx context.Context) (api.Version, error) {
+		return api.Version{}, &jsonrpc.ErrClient{}
+	}
+
+	restarted := &apistruct.FullNodeStruct{}
+	restarted.Internal.ChainHead = func(ctx context.Context) (*types.TipSet, error) {
+		return ts2, nil
+	}
+	restarted.Internal.ChainNotify = func(ctx context.Context) (<-chan []*api.HeadChange, error) {
+		ch := make(chan []*api.HeadChange, 1)
+		ch <- []*api.HeadChange{{Type: store.HCCurrent, Val: ts2}}
+		return ch, nil
+	}
+	restarted.Internal.ChainGetPath = func(ctx context.Context, from, to types.TipSetKey) ([]*api.HeadChange, error) {
+		require.Equal(t, ts1.Key(), from)
+		require.Equal(t, ts2.Key(), to)
+		return []*api.HeadChange{{Type: store.HCApply, Val: ts2}}, nil
+	}
+
+	var dials int
+	ready := make(chan struct{})
+	dial := func(ctx context.Context) (api.FullNode, jsonrpc.ClientCloser, error) {
+		dials++
+		if dials == 1 {
+			return nil, nil, xerrors.New("connection refused")
+		}
+		<-ready
+		return restarted, func() {}, nil
+	}
+
+	fn, closer := NewReconnectingFullNode(ctx, old, func() {}, dial)
+	defer closer()
+
+	ch, err := fn.ChainNotify(ctx)
+	require.NoError(t, err)
+	require.Equal(t, store.HCCurrent, (<-ch)[0].Type)
+
+	down = true
+	_, err = fn.ChainHead(ctx)
+	var cerr *jsonrpc.ErrClient
+	require.True(t, xerrors.As(err, &cerr))
+
+	_, err = fn.ChainHead(ctx)
+	require.True(t, xerrors.Is(err, ErrDisconnected))
+
+	// the subscription is renewed with the changes missed meanwhile
+	close(notifs)
+	close(ready)
+
+	select {
+	case changes := <-ch:
+		require.Len(t, changes, 1)
+		require.Equal(t, store.HCApply, changes[0].Type)
+		require.Equal(t, ts2, changes[0].Val)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not renewed")
+	}
+
+	head, err := fn.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ts2, head)
+	require.Equal(t, 2, dials)
+
+	sts, err := fn.(NodeStatusReporter).NodeConnectionStatus(ctx)
+	require.NoError(t, err)
+	require.True(t, sts[0].Healthy)
+	require.Equal(t, "connection refused", sts[0].LastError)
+}
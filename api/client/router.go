@@ -0,0 +1,359 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+)
+
+var log = logging.Logger("rpcrouter")
+
+const (
+	probeInterval = 5 * time.Second
+	probeTimeout  = 5 * time.Second
+	// nodes further behind the best known head are considered unhealthy
+	maxHeightLag = 3
+)
+
+// latencySensitive calls are routed to the lowest-latency healthy node
+var latencySensitive = map[string]bool{
+	"ChainHead":        true,
+	"ChainNotify":      true,
+	"MpoolPush":        true,
+	"MpoolPushMessage": true,
+	"MpoolGetNonce":    true,
+	"SyncSubmitBlock":  true,
+	"MinerCreateBlock": true,
+	"MinerGetBaseInfo": true,
+}
+
+// heavyCalls are routed away from the lowest-latency node, so they don't slow
+// down latency sensitive calls
+var heavyCalls = map[string]bool{
+	"StateCompute":            true,
+	"StateReplay":             true,
+	"StateCall":               true,
+	"StateSearchMsg":          true,
+	"StateListMiners":         true,
+	"StateListActors":         true,
+	"StateListMessages":       true,
+	"StateMarketDeals":        true,
+	"StateMarketParticipants": true,
+	"StateMinerSectors":       true,
+	"StateMinerActiveSectors": true,
+	"StateChangedActors":      true,
+	"StateAllMinerFaults":     true,
+	"StateReadState":          true,
+	"ChainExport":             true,
+}
+
+// noFailover reports whether a call may have had side effects when it failed
+// on the client side, so it's not retried on another node. Retrying these
+// could e.g. send the same message twice with different nonces.
+func noFailover(method string) bool {
+	switch method {
+	case "MpoolPushMessage", "MarketEnsureAvailable":
+		return true
+	}
+	return strings.HasPrefix(method, "Paych") || strings.HasPrefix(method, "Msig")
+}
+
+// NodeStatusReporter is implemented by full node clients which can report
+// the state of their connection
+type NodeStatusReporter interface {
+	NodeConnectionStatus(ctx context.Context) ([]api.NodeEndpointStatus, error)
+}
+
+type endpoint struct {
+	name string
+	node reflect.Value
+
+	lk       sync.Mutex
+	healthy  bool
+	probed   bool
+	latency  time.Duration
+	height   abi.ChainEpoch
+	calls    uint64
+	errors   uint64
+	inflight int
+	lastErr  string
+}
+
+func (e *endpoint) status() api.NodeEndpointStatus {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	return api.NodeEndpointStatus{
+		Name:      e.name,
+		Healthy:   e.healthy,
+		Latency:   e.latency,
+		Height:    e.height,
+		Calls:     e.calls,
+		Errors:    e.errors,
+		InFlight:  e.inflight,
+		LastError: e.lastErr,
+	}
+}
+
+func (e *endpoint) failed(err error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+
+	e.healthy = false
+	e.errors++
+	e.lastErr = err.Error()
+}
+
+type router struct {
+	endpoints []*endpoint
+	nodes     []api.FullNode
+
+	// failover sends all calls to the first healthy node
+	failover bool
+}
+
+// routedFullNode is the api.FullNode returned by NewFullNodeRouter
+type routedFullNode struct {
+	*apistruct.FullNodeStruct
+	r *router
+}
+
+func (n *routedFullNode) NodeConnectionStatus(ctx context.Context) ([]api.NodeEndpointStatus, error) {
+	out := make([]api.NodeEndpointStatus, len(n.r.endpoints))
+	for i, e := range n.r.endpoints {
+		out[i] = e.status()
+	}
+	return out, nil
+}
+
+// NewFullNodeRouter returns a full node API which routes every call to one of
+// the given nodes. Nodes are probed with ChainHead to track their latency and
+// sync state. Latency sensitive calls, like MpoolPush and ChainHead, go to the
+// lowest-latency healthy node, heavy state queries go to the other healthy
+// nodes. A call which fails on the client side, e.g. because the node went
+// down, is retried on the next node.
+//
+// The router stops probing when ctx is cancelled.
+func NewFullNodeRouter(ctx context.Context, names []string, nodes []api.FullNode) (api.FullNode, error) {
+	return newRouter(ctx, names, nodes, false)
+}
+
+// NewFullNodeFailover returns a full node API which sends every call to the
+// first healthy node, in the order the nodes are given. Nodes are probed like
+// with NewFullNodeRouter, so a node which is unreachable or falls behind the
+// others is skipped until it catches up again, and a call which fails on the
+// client side is retried on the next node.
+func NewFullNodeFailover(ctx context.Context, names []string, nodes []api.FullNode) (api.FullNode, error) {
+	return newRouter(ctx, names, nodes, true)
+}
+
+func newRouter(ctx context.Context, names []string, nodes []api.FullNode, failover bool) (api.FullNode, error) {
+	if len(names) != len(nodes) || len(nodes) == 0 {
+		return nil, xerrors.Errorf("expected a name for each of at least one node")
+	}
+
+	r := &router{nodes: nodes, failover: failover}
+	for i, n := range nodes {
+		r.endpoints = append(r.endpoints, &endpoint{
+			name: names[i],
+			node: reflect.ValueOf(n),
+			// optimistic until the first probe
+			healthy: true,
+		})
+	}
+
+	out := &routedFullNode{
+		FullNodeStruct: &apistruct.FullNodeStruct{},
+		r:              r,
+	}
+	r.bind(reflect.ValueOf(&out.CommonStruct.Internal).Elem())
+	r.bind(reflect.ValueOf(&out.Internal).Elem())
+
+	r.probe(ctx)
+	go r.run(ctx)
+
+	return out, nil
+}
+
+func (r *router) bind(internal reflect.Value) {
+	for i := 0; i < internal.NumField(); i++ {
+		f := internal.Field(i)
+		if f.Kind() != reflect.Func {
+			continue
+		}
+
+		method := internal.Type().Field(i).Name
+		f.Set(reflect.MakeFunc(f.Type(), func(args []reflect.Value) []reflect.Value {
+			return r.call(method, args)
+		}))
+	}
+}
+
+func (r *router) call(method string, args []reflect.Value) []reflect.Value {
+	var res []reflect.Value
+	for i, e := range r.order(method) {
+		m := e.node.MethodByName(method)
+		if !m.IsValid() {
+			continue
+		}
+
+		e.lk.Lock()
+		e.calls++
+		e.inflight++
+		e.lk.Unlock()
+
+		res = m.Call(args)
+
+		e.lk.Lock()
+		e.inflight--
+		e.lk.Unlock()
+
+		if len(res) == 0 {
+			return res
+		}
+		err, _ := res[len(res)-1].Interface().(error)
+
+		var cerr *jsonrpc.ErrClient
+		if err == nil || !xerrors.As(err, &cerr) {
+			return res
+		}
+
+		e.failed(err)
+		if noFailover(method) || i == len(r.endpoints)-1 {
+			return res
+		}
+		log.Warnw("full node call failed, trying next node", "method", method, "node", e.name, "error", err)
+	}
+
+	return res
+}
+
+// order returns the endpoints in the order a call should try them
+func (r *router) order(method string) []*endpoint {
+	type candidate struct {
+		e     *endpoint
+		st    api.NodeEndpointStatus
+		ready bool
+	}
+
+	cands := make([]candidate, len(r.endpoints))
+	for i, e := range r.endpoints {
+		st := e.status()
+		cands[i] = candidate{e: e, st: st, ready: st.Healthy}
+	}
+
+	// healthy first, then by latency
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].ready != cands[j].ready {
+			return cands[i].ready
+		}
+		return !r.failover && cands[i].st.Latency < cands[j].st.Latency
+	})
+
+	if !r.failover && heavyCalls[method] && !latencySensitive[method] {
+		var healthy int
+		for _, c := range cands {
+			if c.ready {
+				healthy++
+			}
+		}
+
+		if healthy > 1 {
+			// move the fastest node after the other healthy ones, which are
+			// ordered by the number of calls in flight
+			others := append([]candidate{}, cands[1:healthy]...)
+			sort.SliceStable(others, func(i, j int) bool {
+				return others[i].st.InFlight < others[j].st.InFlight
+			})
+			cands = append(append(others, cands[0]), cands[healthy:]...)
+		}
+	}
+
+	out := make([]*endpoint, len(cands))
+	for i, c := range cands {
+		out[i] = c.e
+	}
+	return out
+}
+
+func (r *router) run(ctx context.Context) {
+	tick := time.NewTicker(probeInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			r.probe(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *router) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range r.endpoints {
+		wg.Add(1)
+		go func(e *endpoint, n api.FullNode) {
+			defer wg.Done()
+
+			pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			head, err := n.ChainHead(pctx)
+			took := time.Since(start)
+
+			e.lk.Lock()
+			defer e.lk.Unlock()
+
+			if err != nil {
+				if e.healthy {
+					log.Warnw("full node unhealthy", "node", e.name, "error", err)
+				}
+				e.healthy = false
+				e.lastErr = err.Error()
+				return
+			}
+
+			if !e.probed {
+				e.latency = took
+			} else {
+				// exponential moving average, so a single slow probe doesn't reorder nodes
+				e.latency = (e.latency*7 + took*3) / 10
+			}
+			e.probed = true
+			e.height = head.Height()
+			e.healthy = true
+		}(r.endpoints[i], r.nodes[i])
+	}
+	wg.Wait()
+
+	// nodes which are behind aren't healthy
+	var best abi.ChainEpoch
+	for _, e := range r.endpoints {
+		if st := e.status(); st.Healthy && st.Height > best {
+			best = st.Height
+		}
+	}
+	for _, e := range r.endpoints {
+		e.lk.Lock()
+		if e.healthy && e.height+maxHeightLag < best {
+			e.healthy = false
+			e.lastErr = "node is behind the best known head"
+		}
+		e.lk.Unlock()
+	}
+}
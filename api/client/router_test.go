@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+type testNode struct {
+	apistruct.FullNodeStruct
+
+	delay   time.Duration
+	down    bool
+	pushes  int
+	queries int
+}
+
+func newTestNode(delay time.Duration) *testNode {
+	n := &testNode{delay: delay}
+	head := mock.TipSet(mock.MkBlock(nil, 1, 1))
+
+	n.Internal.ChainHead = func(ctx context.Context) (*types.TipSet, error) {
+		time.Sleep(n.delay)
+		return head, nil
+	}
+	n.Internal.MpoolPush = func(ctx context.Context, sm *types.SignedMessage) (cid.Cid, error) {
+		if n.down {
+			return cid.Undef, &jsonrpc.ErrClient{}
+		}
+		n.pushes++
+		return sm.Cid(), nil
+	}
+	n.Internal.StateListMiners = func(ctx context.Context, tsk types.TipSetKey) ([]address.Address, error) {
+		n.queries++
+		return nil, nil
+	}
+	n.Internal.MpoolPushMessage = func(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+		return nil, &jsonrpc.ErrClient{}
+	}
+	return n
+}
+
+func TestRouter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fast := newTestNode(0)
+	slow := newTestNode(20 * time.Millisecond)
+
+	fn, err := NewFullNodeRouter(ctx, []string{"slow", "fast"}, []api.FullNode{slow, fast})
+	require.NoError(t, err)
+
+	to, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	sm := &types.SignedMessage{Message: types.Message{To: to, From: to}}
+
+	// latency sensitive calls go to the fastest node
+	_, err = fn.MpoolPush(ctx, sm)
+	require.NoError(t, err)
+	require.Equal(t, 1, fast.pushes)
+
+	// heavy calls go to the others
+	_, err = fn.StateListMiners(ctx, types.EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, 1, slow.queries)
+	require.Equal(t, 0, fast.queries)
+
+	// client errors fail over to the next node
+	fast.down = true
+	_, err = fn.MpoolPush(ctx, sm)
+	require.NoError(t, err)
+	require.Equal(t, 1, slow.pushes)
+
+	// unless the call may have had side effects
+	_, err = fn.MpoolPushMessage(ctx, &sm.Message, nil)
+	var cerr *jsonrpc.ErrClient
+	require.True(t, xerrors.As(err, &cerr))
+
+	sts, err := fn.(NodeStatusReporter).NodeConnectionStatus(ctx)
+	require.NoError(t, err)
+	require.Len(t, sts, 2)
+	require.Equal(t, "fast", sts[1].Name)
+	require.False(t, sts[1].Healthy)
+	require.Equal(t, uint64(1), sts[1].Errors)
+	require.Equal(t, uint64(1), sts[0].Errors)
+	require.Equal(t, uint64(3), sts[0].Calls)
+}
+
+func TestFailover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary := newTestNode(20 * time.Millisecond)
+	backup := newTestNode(0)
+
+	fn, err := NewFullNodeFailover(ctx, []string{"primary", "backup"}, []api.FullNode{primary, backup})
+	require.NoError(t, err)
+
+	to, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	sm := &types.SignedMessage{Message: types.Message{To: to, From: to}}
+
+	// all calls go to the first node, even when it's slower
+	_, err = fn.MpoolPush(ctx, sm)
+	require.NoError(t, err)
+	_, err = fn.StateListMiners(ctx, types.EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, 1, primary.pushes)
+	require.Equal(t, 1, primary.queries)
+
+	// and fail over to the next one when it's unreachable
+	primary.down = true
+	_, err = fn.MpoolPush(ctx, sm)
+	require.NoError(t, err)
+	require.Equal(t, 1, backup.pushes)
+
+	_, err = fn.MpoolPush(ctx, sm)
+	require.NoError(t, err)
+	require.Equal(t, 2, backup.pushes)
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// unixSockets maps placeholder hosts to the unix sockets of API endpoints
+var unixSockets sync.Map
+
+// UnixSocketHost returns the host to use in URLs of an API endpoint served on
+// a unix socket. The websocket dialer used by jsonrpc, and the default http
+// transport, used e.g. to push io.Reader params, connect to the socket for
+// this host.
+func UnixSocketHost(path string) string {
+	h := sha256.Sum256([]byte(path))
+	host := hex.EncodeToString(h[:8]) + ".unix.lotus"
+	unixSockets.Store(host, path)
+	return host
+}
+
+func init() {
+	websocket.DefaultDialer.NetDialContext = unixDialer(websocket.DefaultDialer.NetDialContext)
+	websocket.DefaultDialer.Proxy = unixProxy(websocket.DefaultDialer.Proxy)
+
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.DialContext = unixDialer(t.DialContext)
+		t.Proxy = unixProxy(t.Proxy)
+	}
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func unixDialer(next dialFunc) dialFunc {
+	if next == nil {
+		next = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if path, ok := unixSockets.Load(host); ok {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path.(string))
+		}
+		return next(ctx, network, addr)
+	}
+}
+
+func unixProxy(next func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(r *http.Request) (*url.URL, error) {
+		if _, ok := unixSockets.Load(r.URL.Hostname()); ok || next == nil {
+			return nil, nil
+		}
+		return next(r)
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+)
+
+func TestUnixSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "apiclient")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	path := filepath.Join(dir, "api.sock")
+	lst, err := net.Listen("unix", path)
+	require.NoError(t, err)
+
+	common := &apistruct.CommonStruct{}
+	common.Internal.Version = func(ctx context.Context) (api.Version, error) {
+		return api.Version{Version: "unix"}, nil
+	}
+
+	rpcServer := jsonrpc.NewServer()
+	rpcServer.Register("Filecoin", common)
+
+	mux := http.NewServeMux()
+	mux.Handle("/rpc/v0", rpcServer)
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(lst) //nolint:errcheck
+	defer srv.Close() //nolint:errcheck
+
+	host := UnixSocketHost(path)
+
+	c, closer, err := NewCommonRPC(ctx, "ws://"+host+"/rpc/v0", nil)
+	require.NoError(t, err)
+	defer closer()
+
+	v, err := c.Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "unix", v.Version)
+
+	resp, err := http.Get("http://" + host + "/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "pong", string(b))
+}
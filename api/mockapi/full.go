@@ -0,0 +1,251 @@
+package mockapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+// FullNode is an api.FullNode double with a deterministic chain, and miner
+// state keyed by miner address.
+//
+// Backed methods: Version, ChainHead, ChainGetTipSet, ChainGetTipSetByHeight,
+// StateMinerInfo, StateMinerPower, StateMinerSectors, StateMinerActiveSectors
+// and StateSectorGetInfo.
+type FullNode struct {
+	apistruct.FullNodeStruct
+	*Script
+
+	lk      sync.Mutex
+	chain   []*types.TipSet
+	tipsets map[types.TipSetKey]*types.TipSet
+	miners  map[address.Address]*minerState
+}
+
+type minerState struct {
+	info    miner.MinerInfo
+	power   api.MinerPower
+	sectors map[abi.SectorNumber]*miner.SectorOnChainInfo
+}
+
+var _ api.FullNode = &FullNode{}
+
+// NewFullNode returns a FullNode with a chain made of the genesis tipset
+func NewFullNode() *FullNode {
+	n := &FullNode{
+		Script:  newScript(),
+		tipsets: map[types.TipSetKey]*types.TipSet{},
+		miners:  map[address.Address]*minerState{},
+	}
+
+	n.Script.install(&n.CommonStruct.Internal)
+	n.Script.install(&n.FullNodeStruct.Internal)
+
+	n.Handle("Version", func(context.Context) (api.Version, error) {
+		return api.Version{Version: build.UserVersion(), APIVersion: build.FullAPIVersion}, nil
+	})
+	n.Handle("ChainHead", n.chainHead)
+	n.Handle("ChainGetTipSet", n.chainGetTipSet)
+	n.Handle("ChainGetTipSetByHeight", n.chainGetTipSetByHeight)
+	n.Handle("StateMinerInfo", n.stateMinerInfo)
+	n.Handle("StateMinerPower", n.stateMinerPower)
+	n.Handle("StateMinerSectors", n.stateMinerSectors)
+	n.Handle("StateMinerActiveSectors", n.stateMinerActiveSectors)
+	n.Handle("StateSectorGetInfo", n.stateSectorGetInfo)
+
+	n.SetHead(mock.TipSet(mock.MkBlock(nil, 1, 0)))
+	return n
+}
+
+// Advance extends the chain by epochs single block tipsets, and returns the
+// new head. The same calls always produce the same tipsets.
+func (n *FullNode) Advance(epochs int) *types.TipSet {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	head := n.chain[len(n.chain)-1]
+	for i := 0; i < epochs; i++ {
+		head = mock.TipSet(mock.MkBlock(head, 1, uint64(head.Height())+1))
+		n.addTipSet(head)
+	}
+	return head
+}
+
+// SetHead makes ts the chain head, ts doesn't need to extend the current head
+func (n *FullNode) SetHead(ts *types.TipSet) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	n.addTipSet(ts)
+}
+
+func (n *FullNode) addTipSet(ts *types.TipSet) {
+	n.chain = append(n.chain, ts)
+	n.tipsets[ts.Key()] = ts
+}
+
+// SetMiner sets the info and power returned for maddr
+func (n *FullNode) SetMiner(maddr address.Address, info miner.MinerInfo, power api.MinerPower) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	m := n.miner(maddr)
+	m.info, m.power = info, power
+}
+
+// AddSectors adds on-chain sectors to maddr, replacing sectors with the same
+// numbers
+func (n *FullNode) AddSectors(maddr address.Address, sectors ...*miner.SectorOnChainInfo) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	m := n.miner(maddr)
+	for _, s := range sectors {
+		m.sectors[s.SectorNumber] = s
+	}
+}
+
+func (n *FullNode) miner(maddr address.Address) *minerState {
+	m, ok := n.miners[maddr]
+	if !ok {
+		m = &minerState{sectors: map[abi.SectorNumber]*miner.SectorOnChainInfo{}}
+		n.miners[maddr] = m
+	}
+	return m
+}
+
+func (n *FullNode) chainHead(context.Context) (*types.TipSet, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	return n.chain[len(n.chain)-1], nil
+}
+
+func (n *FullNode) chainGetTipSet(ctx context.Context, tsk types.TipSetKey) (*types.TipSet, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	return n.loadTipSet(tsk)
+}
+
+func (n *FullNode) loadTipSet(tsk types.TipSetKey) (*types.TipSet, error) {
+	if tsk == types.EmptyTSK {
+		return n.chain[len(n.chain)-1], nil
+	}
+
+	ts, ok := n.tipsets[tsk]
+	if !ok {
+		return nil, xerrors.Errorf("tipset %s not found", tsk)
+	}
+	return ts, nil
+}
+
+func (n *FullNode) chainGetTipSetByHeight(ctx context.Context, h abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	ts, err := n.loadTipSet(tsk)
+	if err != nil {
+		return nil, err
+	}
+	if h > ts.Height() {
+		return nil, xerrors.Errorf("looking for tipset with height greater than start point")
+	}
+
+	for ts.Height() > h {
+		ts, err = n.loadTipSet(ts.Parents())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+func (n *FullNode) stateMiner(maddr address.Address, tsk types.TipSetKey) (*minerState, error) {
+	if _, err := n.loadTipSet(tsk); err != nil {
+		return nil, err
+	}
+
+	m, ok := n.miners[maddr]
+	if !ok {
+		return nil, xerrors.Errorf("actor %s not found", maddr)
+	}
+	return m, nil
+}
+
+func (n *FullNode) stateMinerInfo(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (miner.MinerInfo, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	m, err := n.stateMiner(maddr, tsk)
+	if err != nil {
+		return miner.MinerInfo{}, err
+	}
+	return m.info, nil
+}
+
+func (n *FullNode) stateMinerPower(ctx context.Context, maddr address.Address, tsk types.TipSetKey) (*api.MinerPower, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	m, err := n.stateMiner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	pow := m.power
+	return &pow, nil
+}
+
+func (n *FullNode) stateMinerSectors(ctx context.Context, maddr address.Address, filter *bitfield.BitField, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	m, err := n.stateMiner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*miner.SectorOnChainInfo, 0, len(m.sectors))
+	for num, s := range m.sectors {
+		if filter != nil {
+			set, err := filter.IsSet(uint64(num))
+			if err != nil {
+				return nil, xerrors.Errorf("checking sector filter: %w", err)
+			}
+			if !set {
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SectorNumber < out[j].SectorNumber })
+	return out, nil
+}
+
+func (n *FullNode) stateMinerActiveSectors(ctx context.Context, maddr address.Address, tsk types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	return n.stateMinerSectors(ctx, maddr, nil, tsk)
+}
+
+func (n *FullNode) stateSectorGetInfo(ctx context.Context, maddr address.Address, num abi.SectorNumber, tsk types.TipSetKey) (*miner.SectorOnChainInfo, error) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	m, err := n.stateMiner(maddr, tsk)
+	if err != nil {
+		return nil, err
+	}
+	return m.sectors[num], nil
+}
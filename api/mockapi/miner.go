@@ -0,0 +1,147 @@
+package mockapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/extern/sector-storage/fsutil"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+)
+
+// Miner is an api.StorageMiner double for a single miner actor.
+//
+// Backed methods: Version, ActorAddress, ActorSectorSize, SectorsList,
+// SectorsStatus, StorageList and StorageStat.
+type Miner struct {
+	apistruct.StorageMinerStruct
+	*Script
+
+	maddr address.Address
+	ssize abi.SectorSize
+
+	lk      sync.Mutex
+	sectors map[abi.SectorNumber]api.SectorInfo
+	storage map[stores.ID]minerStorage
+}
+
+type minerStorage struct {
+	decls []stores.Decl
+	stat  fsutil.FsStat
+}
+
+var _ api.StorageMiner = &Miner{}
+
+// NewMiner returns a Miner for maddr, with no sectors or storage
+func NewMiner(maddr address.Address, ssize abi.SectorSize) *Miner {
+	m := &Miner{
+		Script:  newScript(),
+		maddr:   maddr,
+		ssize:   ssize,
+		sectors: map[abi.SectorNumber]api.SectorInfo{},
+		storage: map[stores.ID]minerStorage{},
+	}
+
+	m.Script.install(&m.CommonStruct.Internal)
+	m.Script.install(&m.StorageMinerStruct.Internal)
+
+	m.Handle("Version", func(context.Context) (api.Version, error) {
+		return api.Version{Version: build.UserVersion(), APIVersion: build.MinerAPIVersion}, nil
+	})
+	m.Handle("ActorAddress", func(context.Context) (address.Address, error) {
+		return m.maddr, nil
+	})
+	m.Handle("ActorSectorSize", m.actorSectorSize)
+	m.Handle("SectorsList", m.sectorsList)
+	m.Handle("SectorsStatus", m.sectorsStatus)
+	m.Handle("StorageList", m.storageList)
+	m.Handle("StorageStat", m.storageStat)
+
+	return m
+}
+
+// SetSectors adds sectors, replacing sectors with the same SectorID
+func (m *Miner) SetSectors(sectors ...api.SectorInfo) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for _, s := range sectors {
+		m.sectors[s.SectorID] = s
+	}
+}
+
+// RemoveSector removes a sector set with SetSectors
+func (m *Miner) RemoveSector(num abi.SectorNumber) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	delete(m.sectors, num)
+}
+
+// SetStorage sets the declarations and filesystem stats of a storage path
+func (m *Miner) SetStorage(id stores.ID, decls []stores.Decl, stat fsutil.FsStat) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.storage[id] = minerStorage{decls: decls, stat: stat}
+}
+
+func (m *Miner) actorSectorSize(ctx context.Context, maddr address.Address) (abi.SectorSize, error) {
+	if maddr != m.maddr {
+		return 0, xerrors.Errorf("actor %s not found", maddr)
+	}
+	return m.ssize, nil
+}
+
+func (m *Miner) sectorsList(context.Context) ([]abi.SectorNumber, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := make([]abi.SectorNumber, 0, len(m.sectors))
+	for num := range m.sectors {
+		out = append(out, num)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+func (m *Miner) sectorsStatus(ctx context.Context, num abi.SectorNumber, showOnChainInfo bool) (api.SectorInfo, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	s, ok := m.sectors[num]
+	if !ok {
+		return api.SectorInfo{}, xerrors.Errorf("sector %d not found", num)
+	}
+	return s, nil
+}
+
+func (m *Miner) storageList(context.Context) (map[stores.ID][]stores.Decl, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := map[stores.ID][]stores.Decl{}
+	for id, st := range m.storage {
+		out[id] = append([]stores.Decl{}, st.decls...)
+	}
+	return out, nil
+}
+
+func (m *Miner) storageStat(ctx context.Context, id stores.ID) (fsutil.FsStat, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	st, ok := m.storage[id]
+	if !ok {
+		return fsutil.FsStat{}, xerrors.Errorf("storage %s not found", id)
+	}
+	return st.stat, nil
+}
@@ -0,0 +1,97 @@
+package mockapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+func TestFullNodeChain(t *testing.T) {
+	ctx := context.Background()
+
+	n := NewFullNode()
+	head := n.Advance(5)
+	require.Equal(t, abi.ChainEpoch(5), head.Height())
+	require.Equal(t, head.Key(), NewFullNode().Advance(5).Key(), "chains are deterministic")
+
+	ts, err := n.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, head, ts)
+
+	ts, err = n.ChainGetTipSetByHeight(ctx, 2, types.EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, abi.ChainEpoch(2), ts.Height())
+
+	got, err := n.ChainGetTipSet(ctx, ts.Key())
+	require.NoError(t, err)
+	require.Equal(t, ts, got)
+}
+
+func TestFullNodeMiners(t *testing.T) {
+	ctx := context.Background()
+	maddr := mock.Address(1000)
+
+	n := NewFullNode()
+	n.SetMiner(maddr, miner.MinerInfo{SectorSize: 2048}, api.MinerPower{HasMinPower: true})
+	n.AddSectors(maddr, &miner.SectorOnChainInfo{SectorNumber: 3}, &miner.SectorOnChainInfo{SectorNumber: 1})
+
+	info, err := n.StateMinerInfo(ctx, maddr, types.EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, abi.SectorSize(2048), info.SectorSize)
+
+	_, err = n.StateMinerPower(ctx, mock.Address(1001), types.EmptyTSK)
+	require.Error(t, err)
+
+	sectors, err := n.StateMinerSectors(ctx, maddr, nil, types.EmptyTSK)
+	require.NoError(t, err)
+	require.Len(t, sectors, 2)
+	require.Equal(t, abi.SectorNumber(1), sectors[0].SectorNumber)
+
+	filter := bitfield.NewFromSet([]uint64{3})
+	sectors, err = n.StateMinerSectors(ctx, maddr, &filter, types.EmptyTSK)
+	require.NoError(t, err)
+	require.Len(t, sectors, 1)
+	require.Equal(t, abi.SectorNumber(3), sectors[0].SectorNumber)
+}
+
+func TestScript(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewMiner(mock.Address(1000), 2048)
+	m.SetSectors(api.SectorInfo{SectorID: 2}, api.SectorInfo{SectorID: 1})
+
+	sectors, err := m.SectorsList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{1, 2}, sectors)
+
+	_, err = m.SectorsRefs(ctx)
+	require.True(t, xerrors.Is(err, ErrNotScripted))
+
+	boom := xerrors.New("boom")
+	m.Fail("SectorsList", boom)
+	_, err = m.SectorsList(ctx)
+	require.Equal(t, boom, err)
+
+	m.Fail("SectorsList", nil)
+	m.Handle("SectorsList", func(context.Context) ([]abi.SectorNumber, error) {
+		return []abi.SectorNumber{7}, nil
+	})
+	sectors, err = m.SectorsList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{7}, sectors)
+	require.Equal(t, 3, m.Calls("SectorsList"))
+
+	require.Panics(t, func() {
+		m.Handle("SectorsList", func() {})
+	})
+}
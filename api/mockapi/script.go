@@ -0,0 +1,117 @@
+// Package mockapi provides scriptable in-memory implementations of
+// api.FullNode and api.StorageMiner for unit-testing code which talks to lotus
+// nodes without running a devnet.
+//
+// Every API method goes through a Script. A few methods are backed by the
+// state kept in the double (chain heads, miners, sectors), others can be
+// scripted with Handle, and any method can be made to fail with Fail. Methods
+// which aren't scripted return ErrNotScripted.
+package mockapi
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrNotScripted is returned by methods with no behavior set
+var ErrNotScripted = xerrors.New("method not scripted")
+
+// Script dispatches the calls made to an API double
+type Script struct {
+	lk sync.Mutex
+
+	types    map[string]reflect.Type
+	handlers map[string]reflect.Value
+	fails    map[string]error
+	calls    map[string]int
+}
+
+func newScript() *Script {
+	return &Script{
+		types:    map[string]reflect.Type{},
+		handlers: map[string]reflect.Value{},
+		fails:    map[string]error{},
+		calls:    map[string]int{},
+	}
+}
+
+// Handle sets the implementation of method, fn must have the same signature
+// as the method, without the receiver. Panics when it doesn't.
+func (s *Script) Handle(method string, fn interface{}) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	typ, ok := s.types[method]
+	if !ok {
+		panic(fmt.Sprintf("mockapi: unknown method %s", method))
+	}
+	if ft := reflect.TypeOf(fn); ft != typ {
+		panic(fmt.Sprintf("mockapi: %s handler has type %s, expected %s", method, ft, typ))
+	}
+
+	s.handlers[method] = reflect.ValueOf(fn)
+}
+
+// Fail makes method return err until Fail is called again with a nil error
+func (s *Script) Fail(method string, err error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if _, ok := s.types[method]; !ok {
+		panic(fmt.Sprintf("mockapi: unknown method %s", method))
+	}
+
+	if err == nil {
+		delete(s.fails, method)
+		return
+	}
+	s.fails[method] = err
+}
+
+// Calls returns the number of times method was called
+func (s *Script) Calls(method string) int {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	return s.calls[method]
+}
+
+// install routes all the methods of an apistruct Internal struct through the
+// script
+func (s *Script) install(internal interface{}) {
+	rint := reflect.ValueOf(internal).Elem()
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		name := field.Name
+
+		s.types[name] = field.Type
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) []reflect.Value {
+			return s.call(name, field.Type, args)
+		}))
+	}
+}
+
+func (s *Script) call(name string, typ reflect.Type, args []reflect.Value) []reflect.Value {
+	s.lk.Lock()
+	s.calls[name]++
+	err, failing := s.fails[name]
+	h, handled := s.handlers[name]
+	s.lk.Unlock()
+
+	if !failing {
+		if handled {
+			return h.Call(args)
+		}
+		err = xerrors.Errorf("%s: %w", name, ErrNotScripted)
+	}
+
+	rerr := reflect.ValueOf(&err).Elem()
+	if typ.NumOut() == 2 {
+		return []reflect.Value{reflect.Zero(typ.Out(0)), rerr}
+	}
+	return []reflect.Value{rerr}
+}
@@ -0,0 +1,91 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"golang.org/x/xerrors"
+)
+
+// BuildTime is set by the build system
+var BuildTime string
+
+// BuildTypeName returns the name of the network the binary was built for,
+// empty for the default network
+func BuildTypeName() string {
+	return strings.TrimPrefix(buildType(), "+")
+}
+
+// Features returns the enabled build and runtime features
+func Features() []string {
+	var out []string
+	if t := BuildTypeName(); t != "" {
+		out = append(out, t)
+	}
+	if InsecurePoStValidation {
+		out = append(out, "insecure-post")
+	}
+	if os.Getenv("BELLMAN_NO_GPU") == "" {
+		out = append(out, "gpu")
+	}
+	return out
+}
+
+// ProofParamVersions returns the versions of the proof parameters the build
+// uses, e.g. v28
+func ProofParamVersions() ([]string, error) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(ParametersJSON(), &params); err != nil {
+		return nil, xerrors.Errorf("parsing parameters.json: %w", err)
+	}
+
+	vers := map[string]struct{}{}
+	for name := range params {
+		vers[strings.SplitN(name, "-", 2)[0]] = struct{}{}
+	}
+
+	out := make([]string, 0, len(vers))
+	for v := range vers {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+var builtinGenesis struct {
+	once sync.Once
+	c    cid.Cid
+	err  error
+}
+
+// BuiltinGenesisCid returns the cid of the built-in genesis block, cid.Undef
+// when the build doesn't have one
+func BuiltinGenesisCid() (cid.Cid, error) {
+	builtinGenesis.once.Do(func() {
+		genBytes := MaybeGenesis()
+		if len(genBytes) == 0 {
+			builtinGenesis.c = cid.Undef
+			return
+		}
+
+		h, _, err := car.ReadHeader(bufio.NewReader(bytes.NewReader(genBytes)))
+		if err != nil {
+			builtinGenesis.err = xerrors.Errorf("reading built-in genesis: %w", err)
+			return
+		}
+		if len(h.Roots) != 1 {
+			builtinGenesis.err = xerrors.Errorf("expected 1 root in built-in genesis, got %d", len(h.Roots))
+			return
+		}
+		builtinGenesis.c = h.Roots[0]
+	})
+
+	return builtinGenesis.c, builtinGenesis.err
+}
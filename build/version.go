@@ -56,6 +56,22 @@ func (ve Version) EqMajorMinor(v2 Version) bool {
 	return ve&minorMask == v2&minorMask
 }
 
+// Compatible checks that a remote implementing API version ve can serve a
+// client built against API version want: the major versions must be equal,
+// and the remote minor version at least the one of the client.
+func (ve Version) Compatible(want Version) error {
+	rmj, rmi, _ := ve.Ints()
+	wmj, wmi, _ := want.Ints()
+
+	if rmj != wmj {
+		return xerrors.Errorf("remote API version %s has a different major version than %s", ve, want)
+	}
+	if rmi < wmi {
+		return xerrors.Errorf("remote API version %s is older than %s", ve, want)
+	}
+	return nil
+}
+
 type NodeType int
 
 const (
@@ -81,11 +97,53 @@ func VersionForType(nodeType NodeType) (Version, error) {
 	}
 }
 
-// semver versions of the rpc api exposed
+// FeaturesForType returns the API features of a node type
+func FeaturesForType(nodeType NodeType) []string {
+	switch nodeType {
+	case NodeFull:
+		return FullAPIFeatures
+	case NodeMiner:
+		return MinerAPIFeatures
+	default:
+		return nil
+	}
+}
+
+// semver versions of the rpc api exposed. Also below 1.0, breaking changes
+// bump the major version, and backwards compatible additions, like new
+// methods or fields, the minor version; see Version.Compatible.
+var (
+	FullAPIVersion   = newVer(0, 17, 0)
+	MinerAPIVersion  = newVer(0, 16, 0)
+	WorkerAPIVersion = newVer(0, 16, 0)
+)
+
+// API features of this fork, advertised next to the API version. Clients
+// check for a feature before using the methods it covers, so they keep
+// working with nodes which were built from a different branch with the same
+// API version.
+const (
+	FeatureGasTrend       = "gas-trend"
+	FeatureCommPQueue     = "commp-queue"
+	FeatureDealTransfers  = "deal-transfers"
+	FeatureSectorWebhooks = "sector-webhooks"
+	FeatureAutotune       = "autotune"
+	FeatureConfigReload   = "config-reload"
+	FeatureOutbox         = "outbox"
+	FeatureSyncLag        = "sync-lag"
+	FeatureWorkerRegister = "worker-register"
+	FeatureWorkerTasks    = "worker-tasks"
+	FeatureDealPayments   = "deal-payments"
+	FeatureWorkerList     = "worker-list"
+	FeatureWorkerTokens   = "worker-tokens"
+	FeatureSectorArchive  = "sector-archive"
+	FeatureBuildInfo      = "build-info"
+	FeaturePaymentHistory = "deal-payment-history"
+)
+
 var (
-	FullAPIVersion   = newVer(0, 16, 0)
-	MinerAPIVersion  = newVer(0, 15, 0)
-	WorkerAPIVersion = newVer(0, 15, 0)
+	FullAPIFeatures  = []string{FeatureGasTrend, FeatureCommPQueue, FeatureDealTransfers, FeatureBuildInfo}
+	MinerAPIFeatures = []string{FeatureSectorWebhooks, FeatureAutotune, FeatureConfigReload, FeatureOutbox, FeatureSyncLag, FeatureWorkerRegister, FeatureWorkerTasks, FeatureDealPayments, FeatureWorkerList, FeatureWorkerTokens, FeatureSectorArchive, FeatureBuildInfo, FeaturePaymentHistory}
 )
 
 //nolint:varcheck,deadcode
@@ -0,0 +1,18 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionCompatible(t *testing.T) {
+	want := newVer(0, 16, 2)
+
+	require.NoError(t, newVer(0, 16, 2).Compatible(want))
+	require.NoError(t, newVer(0, 16, 0).Compatible(want), "patch versions don't matter")
+	require.NoError(t, newVer(0, 17, 0).Compatible(want), "newer minor versions serve older clients")
+
+	require.Error(t, newVer(0, 15, 9).Compatible(want))
+	require.Error(t, newVer(1, 16, 2).Compatible(want))
+}
@@ -15,10 +15,13 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/watchdog"
 )
 
 var log = logging.Logger("events")
 
+var eventsWatchdog = watchdog.Register("chain-events", 5*time.Minute)
+
 // HeightHandler `curH`-`ts.Height` = `confidence`
 type HeightHandler func(ctx context.Context, ts *types.TipSet, curH abi.ChainEpoch) error
 type RevertHandler func(ctx context.Context, ts *types.TipSet) error
@@ -109,6 +112,9 @@ func (e *Events) listenHeadChangesOnce(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// cancelling closes notifs, listenHeadChanges then subscribes again
+	defer eventsWatchdog.OnRestart(cancel)()
+
 	notifs, err := e.api.ChainNotify(ctx)
 	if err != nil {
 		// TODO: retry
@@ -151,9 +157,11 @@ func (e *Events) listenHeadChangesOnce(ctx context.Context) error {
 			}
 		}
 
+		done := eventsWatchdog.Busy()
 		if err := e.headChange(rev, app); err != nil {
 			log.Warnf("headChange failed: %s", err)
 		}
+		done()
 
 		// sync with fake chainstore (for tests)
 		if fcs, ok := e.api.(interface{ notifDone() }); ok {
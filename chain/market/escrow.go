@@ -0,0 +1,282 @@
+package market
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/crash"
+)
+
+// EscrowPolicy keeps the available (escrow minus locked) market balance of
+// an address within bounds
+type EscrowPolicy struct {
+	// Address is the client or miner address with the escrow balance
+	Address address.Address
+	// Wallet sends top-up and withdrawal messages. For miners withdrawals
+	// must be sent by the owner or worker, and go to the owner.
+	Wallet address.Address
+
+	// MinAvailable triggers a top-up to TopUpTo when available funds drop
+	// below it
+	MinAvailable abi.TokenAmount
+	TopUpTo      abi.TokenAmount
+	// MaxAvailable triggers a withdrawal down to TopUpTo when available funds
+	// exceed it; zero disables withdrawals
+	MaxAvailable abi.TokenAmount
+}
+
+func (p *EscrowPolicy) validate() error {
+	if p.TopUpTo.LessThan(p.MinAvailable) {
+		return xerrors.Errorf("escrow policy for %s: TopUpTo is less than MinAvailable", p.Address)
+	}
+	if !p.MaxAvailable.IsZero() && p.MaxAvailable.LessThan(p.TopUpTo) {
+		return xerrors.Errorf("escrow policy for %s: MaxAvailable is less than TopUpTo", p.Address)
+	}
+	return nil
+}
+
+type escrowAPI interface {
+	fundMgrAPI
+	StateSearchMsg(context.Context, cid.Cid) (*api.MsgLookup, error)
+}
+
+// EscrowManager periodically applies escrow policies, so deals don't fail on
+// insufficient market balance and excess funds don't sit idle in escrow
+type EscrowManager struct {
+	api      escrowAPI
+	fm       *FundMgr
+	interval time.Duration
+
+	lk       sync.Mutex
+	policies []EscrowPolicy
+	status   map[address.Address]*api.MarketEscrowStatus
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewEscrowManager(eapi escrowAPI, fm *FundMgr, policies []EscrowPolicy, interval time.Duration) (*EscrowManager, error) {
+	em := &EscrowManager{
+		api:      eapi,
+		fm:       fm,
+		interval: interval,
+
+		policies: policies,
+		status:   map[address.Address]*api.MarketEscrowStatus{},
+
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	for _, p := range policies {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := em.status[p.Address]; ok {
+			return nil, xerrors.Errorf("duplicate escrow policy for %s", p.Address)
+		}
+		em.status[p.Address] = &api.MarketEscrowStatus{
+			Address:      p.Address,
+			Wallet:       p.Wallet,
+			Escrow:       big.Zero(),
+			Locked:       big.Zero(),
+			Available:    big.Zero(),
+			MinAvailable: p.MinAvailable,
+			TopUpTo:      p.TopUpTo,
+			MaxAvailable: p.MaxAvailable,
+		}
+	}
+
+	return em, nil
+}
+
+func (em *EscrowManager) Run(ctx context.Context) {
+	defer close(em.stopped)
+
+	if len(em.policies) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-em.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	crash.Run(ctx, "market-escrow", em.run)
+}
+
+func (em *EscrowManager) run(ctx context.Context) error {
+	t := time.NewTicker(em.interval)
+	defer t.Stop()
+
+	for {
+		ok := true
+		for _, p := range em.policies {
+			if err := em.apply(ctx, p); err != nil {
+				log.Errorf("applying escrow policy for %s: %+v", p.Address, err)
+				em.setErr(p.Address, err)
+				crash.Failure(ctx, xerrors.Errorf("applying escrow policy for %s: %w", p.Address, err))
+				ok = false
+			}
+		}
+		if ok {
+			crash.Success(ctx)
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (em *EscrowManager) Stop(ctx context.Context) error {
+	close(em.stop)
+
+	select {
+	case <-em.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (em *EscrowManager) apply(ctx context.Context, p EscrowPolicy) error {
+	em.lk.Lock()
+	pending := em.status[p.Address].PendingMsg
+	em.lk.Unlock()
+
+	if pending != nil {
+		lookup, err := em.api.StateSearchMsg(ctx, *pending)
+		if err != nil {
+			return xerrors.Errorf("searching for message %s: %w", *pending, err)
+		}
+		if lookup == nil {
+			return nil // still waiting
+		}
+
+		em.lk.Lock()
+		em.status[p.Address].PendingMsg = nil
+		if lookup.Receipt.ExitCode != 0 {
+			em.status[p.Address].LastErr = xerrors.Errorf("message %s failed with exit code %d", *pending, lookup.Receipt.ExitCode).Error()
+		}
+		em.lk.Unlock()
+	}
+
+	bal, err := em.api.StateMarketBalance(ctx, p.Address, types.EmptyTSK)
+	if err != nil {
+		return xerrors.Errorf("getting market balance: %w", err)
+	}
+	avail := big.Sub(bal.Escrow, bal.Locked)
+
+	em.lk.Lock()
+	st := em.status[p.Address]
+	st.Escrow = bal.Escrow
+	st.Locked = bal.Locked
+	st.Available = avail
+	st.Checked = time.Now()
+	em.lk.Unlock()
+
+	var action string
+	var msg cid.Cid
+	switch {
+	case avail.LessThan(p.MinAvailable):
+		msg, err = em.fm.EnsureAvailable(ctx, p.Address, p.Wallet, p.TopUpTo)
+		if err != nil {
+			return xerrors.Errorf("adding funds: %w", err)
+		}
+		action = "top-up of " + types.FIL(big.Sub(p.TopUpTo, avail)).String()
+	case !p.MaxAvailable.IsZero() && avail.GreaterThan(p.MaxAvailable):
+		amt := big.Sub(avail, p.TopUpTo)
+		msg, err = em.withdraw(ctx, p, amt)
+		if err != nil {
+			return xerrors.Errorf("withdrawing funds: %w", err)
+		}
+		action = "withdrawal of " + types.FIL(amt).String()
+	default:
+		return nil
+	}
+
+	if msg == cid.Undef {
+		return nil
+	}
+
+	log.Infow("escrow policy action", "address", p.Address, "action", action, "message", msg)
+
+	em.lk.Lock()
+	st.PendingMsg = &msg
+	st.LastAction = action
+	st.LastActionTime = time.Now()
+	st.LastErr = ""
+	em.lk.Unlock()
+
+	return nil
+}
+
+func (em *EscrowManager) withdraw(ctx context.Context, p EscrowPolicy, amt abi.TokenAmount) (cid.Cid, error) {
+	params, aerr := actors.SerializeParams(&market0.WithdrawBalanceParams{
+		ProviderOrClientAddress: p.Address,
+		Amount:                  amt,
+	})
+	if aerr != nil {
+		return cid.Undef, aerr
+	}
+
+	smsg, err := em.api.MpoolPushMessage(ctx, &types.Message{
+		To:     market.Address,
+		From:   p.Wallet,
+		Value:  big.Zero(),
+		Method: builtin.MethodsMarket.WithdrawBalance,
+		Params: params,
+	}, nil)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	return smsg.Cid(), nil
+}
+
+func (em *EscrowManager) setErr(addr address.Address, err error) {
+	em.lk.Lock()
+	defer em.lk.Unlock()
+
+	em.status[addr].LastErr = err.Error()
+}
+
+// Status returns the last observed balances and actions of all policies
+func (em *EscrowManager) Status() []api.MarketEscrowStatus {
+	em.lk.Lock()
+	defer em.lk.Unlock()
+
+	out := make([]api.MarketEscrowStatus, 0, len(em.policies))
+	for _, p := range em.policies {
+		st := *em.status[p.Address]
+		if st.PendingMsg != nil {
+			c := *st.PendingMsg
+			st.PendingMsg = &c
+		}
+		out = append(out, st)
+	}
+
+	return out
+}
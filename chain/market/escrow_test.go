@@ -0,0 +1,83 @@
+package market
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+type fakeEscrowAPI struct {
+	fakeAPI
+	lookup *api.MsgLookup
+}
+
+func (fapi *fakeEscrowAPI) StateSearchMsg(context.Context, cid.Cid) (*api.MsgLookup, error) {
+	return fapi.lookup, nil
+}
+
+func TestEscrowPolicy(t *testing.T) {
+	ctx := context.Background()
+	addr := tutils.NewIDAddr(t, 101)
+	wallet := tutils.NewIDAddr(t, 102)
+
+	policy := EscrowPolicy{
+		Address:      addr,
+		Wallet:       wallet,
+		MinAvailable: abi.NewTokenAmount(100),
+		TopUpTo:      abi.NewTokenAmount(200),
+		MaxAvailable: abi.NewTokenAmount(500),
+	}
+
+	newManager := func(bal api.MarketBalance) (*fakeEscrowAPI, *EscrowManager) {
+		fapi := &fakeEscrowAPI{fakeAPI: fakeAPI{returnedBalance: bal}}
+		em, err := NewEscrowManager(fapi, newFundMgr(fapi), []EscrowPolicy{policy}, 0)
+		require.NoError(t, err)
+		return fapi, em
+	}
+
+	t.Run("within bounds", func(t *testing.T) {
+		fapi, em := newManager(api.MarketBalance{Escrow: abi.NewTokenAmount(300), Locked: abi.NewTokenAmount(0)})
+		require.NoError(t, em.apply(ctx, policy))
+		require.Nil(t, fapi.receivedMessage)
+		require.Equal(t, abi.NewTokenAmount(300), em.Status()[0].Available)
+	})
+
+	t.Run("top up", func(t *testing.T) {
+		fapi, em := newManager(api.MarketBalance{Escrow: abi.NewTokenAmount(150), Locked: abi.NewTokenAmount(100)})
+		require.NoError(t, em.apply(ctx, policy))
+		require.NotNil(t, fapi.receivedMessage)
+		require.Equal(t, builtin.MethodsMarket.AddBalance, fapi.receivedMessage.Method)
+		require.Equal(t, abi.NewTokenAmount(150), fapi.receivedMessage.Value)
+		require.NotNil(t, em.Status()[0].PendingMsg)
+
+		// nothing is sent while the previous message is pending
+		fapi.receivedMessage = nil
+		require.NoError(t, em.apply(ctx, policy))
+		require.Nil(t, fapi.receivedMessage)
+	})
+
+	t.Run("withdraw", func(t *testing.T) {
+		fapi, em := newManager(api.MarketBalance{Escrow: abi.NewTokenAmount(800), Locked: abi.NewTokenAmount(100)})
+		require.NoError(t, em.apply(ctx, policy))
+		require.NotNil(t, fapi.receivedMessage)
+		require.Equal(t, builtin.MethodsMarket.WithdrawBalance, fapi.receivedMessage.Method)
+		require.Equal(t, wallet, fapi.receivedMessage.From)
+		require.True(t, fapi.receivedMessage.Value.IsZero())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		bad := policy
+		bad.TopUpTo = big.NewInt(50)
+		_, err := NewEscrowManager(&fakeEscrowAPI{}, nil, []EscrowPolicy{bad}, 0)
+		require.Error(t, err)
+	})
+}
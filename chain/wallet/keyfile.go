@@ -0,0 +1,208 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// Encrypted key files follow the Web3 Secret Storage format (version 3), the
+// private key is encrypted with AES-128-CTR under a key derived from the
+// passphrase with scrypt, and authenticated with a keccak256 MAC. The key type
+// and address are stored in the clear, so files can be told apart without the
+// passphrase.
+
+const keyFileVersion = 3
+
+// scrypt parameters of new key files, as used by most Web3 Secret Storage
+// implementations
+const (
+	scryptN     = 1 << 18
+	scryptR     = 8
+	scryptP     = 1
+	scryptDKLen = 32
+)
+
+type keyFile struct {
+	Version int           `json:"version"`
+	ID      string        `json:"id"`
+	Address string        `json:"address"`
+	KeyType string        `json:"keytype"`
+	Crypto  keyFileCrypto `json:"crypto"`
+}
+
+type keyFileCrypto struct {
+	Cipher       string `json:"cipher"`
+	CipherText   string `json:"ciphertext"`
+	CipherParams struct {
+		IV string `json:"iv"`
+	} `json:"cipherparams"`
+	KDF       string `json:"kdf"`
+	KDFParams struct {
+		N     int    `json:"n"`
+		R     int    `json:"r"`
+		P     int    `json:"p"`
+		DKLen int    `json:"dklen"`
+		Salt  string `json:"salt"`
+	} `json:"kdfparams"`
+	MAC string `json:"mac"`
+}
+
+// EncryptKey encodes a key as an encrypted key file
+func EncryptKey(ki *types.KeyInfo, passphrase string) ([]byte, error) {
+	return encryptKey(ki, passphrase, scryptN, scryptP)
+}
+
+func encryptKey(ki *types.KeyInfo, passphrase string, n, p int) ([]byte, error) {
+	k, err := NewKey(*ki)
+	if err != nil {
+		return nil, xerrors.Errorf("loading key: %w", err)
+	}
+
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	dk, err := scrypt.Key([]byte(passphrase), salt, n, scryptR, p, scryptDKLen)
+	if err != nil {
+		return nil, xerrors.Errorf("deriving key: %w", err)
+	}
+
+	ct, err := aesCTR(dk[:16], iv, ki.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	f := keyFile{
+		Version: keyFileVersion,
+		ID:      uuid.New().String(),
+		Address: k.Address.String(),
+		KeyType: ki.Type,
+	}
+	f.Crypto.Cipher = "aes-128-ctr"
+	f.Crypto.CipherText = hex.EncodeToString(ct)
+	f.Crypto.CipherParams.IV = hex.EncodeToString(iv)
+	f.Crypto.KDF = "scrypt"
+	f.Crypto.KDFParams.N = n
+	f.Crypto.KDFParams.R = scryptR
+	f.Crypto.KDFParams.P = p
+	f.Crypto.KDFParams.DKLen = scryptDKLen
+	f.Crypto.KDFParams.Salt = hex.EncodeToString(salt)
+	f.Crypto.MAC = hex.EncodeToString(keyFileMAC(dk, ct))
+
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// DecryptKey decodes an encrypted key file
+func DecryptKey(data []byte, passphrase string) (*types.KeyInfo, error) {
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, xerrors.Errorf("decoding key file: %w", err)
+	}
+
+	if f.Version != keyFileVersion {
+		return nil, xerrors.Errorf("unsupported key file version %d", f.Version)
+	}
+	if f.Crypto.Cipher != "aes-128-ctr" {
+		return nil, xerrors.Errorf("unsupported cipher '%s'", f.Crypto.Cipher)
+	}
+	if f.Crypto.KDF != "scrypt" {
+		return nil, xerrors.Errorf("unsupported kdf '%s'", f.Crypto.KDF)
+	}
+	if f.KeyType != KTBLS && f.KeyType != KTSecp256k1 {
+		return nil, xerrors.Errorf("unsupported key type '%s'", f.KeyType)
+	}
+
+	kp := f.Crypto.KDFParams
+	salt, err := hex.DecodeString(kp.Salt)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding salt: %w", err)
+	}
+	iv, err := hex.DecodeString(f.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding iv: %w", err)
+	}
+	ct, err := hex.DecodeString(f.Crypto.CipherText)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding ciphertext: %w", err)
+	}
+	mac, err := hex.DecodeString(f.Crypto.MAC)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding mac: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, xerrors.Errorf("invalid iv length %d", len(iv))
+	}
+	if kp.DKLen < 32 {
+		return nil, xerrors.Errorf("derived key too short: %d", kp.DKLen)
+	}
+
+	dk, err := scrypt.Key([]byte(passphrase), salt, kp.N, kp.R, kp.P, kp.DKLen)
+	if err != nil {
+		return nil, xerrors.Errorf("deriving key: %w", err)
+	}
+	if !bytes.Equal(keyFileMAC(dk, ct), mac) {
+		return nil, xerrors.New("wrong passphrase or corrupted key file")
+	}
+
+	pk, err := aesCTR(dk[:16], iv, ct)
+	if err != nil {
+		return nil, err
+	}
+
+	ki := &types.KeyInfo{
+		Type:       f.KeyType,
+		PrivateKey: pk,
+	}
+
+	k, err := NewKey(*ki)
+	if err != nil {
+		return nil, xerrors.Errorf("loading key: %w", err)
+	}
+	if f.Address != "" {
+		// either network prefix
+		addr, err := address.NewFromString(f.Address)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing key file address: %w", err)
+		}
+		if addr != k.Address {
+			return nil, xerrors.Errorf("key is for address %s, file says %s", k.Address, f.Address)
+		}
+	}
+
+	return ki, nil
+}
+
+func aesCTR(key, iv, in []byte) ([]byte, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(b, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+func keyFileMAC(dk, ct []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(dk[16:32]) //nolint:errcheck
+	h.Write(ct)        //nolint:errcheck
+	return h.Sum(nil)
+}
@@ -0,0 +1,31 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+)
+
+func TestKeyFile(t *testing.T) {
+	pk, err := sigs.Generate(crypto.SigTypeSecp256k1)
+	require.NoError(t, err)
+	ki := &types.KeyInfo{Type: KTSecp256k1, PrivateKey: pk}
+
+	// light scrypt parameters, the standard ones take a while
+	b, err := encryptKey(ki, "hunter2", 1<<10, 1)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), hex.EncodeToString(pk))
+
+	out, err := DecryptKey(b, "hunter2")
+	require.NoError(t, err)
+	require.Equal(t, ki, out)
+
+	_, err = DecryptKey(b, "hunter3")
+	require.Error(t, err)
+}
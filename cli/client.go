@@ -18,7 +18,6 @@ import (
 	"github.com/docker/go-units"
 	"github.com/fatih/color"
 	datatransfer "github.com/filecoin-project/go-data-transfer"
-	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-cidutil/cidenc"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -72,15 +71,20 @@ var clientCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		WithCategory("storage", clientDealCmd),
 		WithCategory("storage", clientQueryAskCmd),
+		WithCategory("storage", clientFindMinersCmd),
 		WithCategory("storage", clientListDeals),
 		WithCategory("storage", clientGetDealCmd),
+		WithCategory("storage", clientTransfersCmd),
+		WithCategory("storage", clientPushDataCmd),
 		WithCategory("data", clientImportCmd),
 		WithCategory("data", clientDropCmd),
 		WithCategory("data", clientLocalCmd),
 		WithCategory("retrieval", clientFindCmd),
 		WithCategory("retrieval", clientRetrieveCmd),
 		WithCategory("util", clientCommPCmd),
+		WithCategory("util", clientCommPJobsCmd),
 		WithCategory("util", clientCarGenCmd),
+		WithCategory("util", clientPrepareCmd),
 		WithCategory("util", clientInfoCmd),
 		WithCategory("util", clientListTransfers),
 	},
@@ -180,10 +184,19 @@ var clientDropCmd = &cli.Command{
 
 var clientCommPCmd = &cli.Command{
 	Name:      "commP",
+	Aliases:   []string{"commp"},
 	Usage:     "Calculate the piece-cid (commP) of a CAR file",
-	ArgsUsage: "[inputFile]",
+	ArgsUsage: "[inputFile...]",
+	Description: `The files are read by the node, which calculates several files in parallel.
+   Results are cached until a file changes: with --queue the command returns
+   once the files are scheduled, so large files can be prepared before the
+   deals for them are proposed.`,
 	Flags: []cli.Flag{
 		&CidBaseFlag,
+		&cli.BoolFlag{
+			Name:  "queue",
+			Usage: "schedule the calculation and return immediately",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		api, closer, err := GetFullNodeAPI(cctx)
@@ -193,11 +206,64 @@ var clientCommPCmd = &cli.Command{
 		defer closer()
 		ctx := ReqContext(cctx)
 
-		if cctx.Args().Len() != 1 {
-			return fmt.Errorf("usage: commP <inputPath>")
+		if cctx.Args().Len() == 0 {
+			return fmt.Errorf("usage: commP <inputPath>...")
+		}
+
+		if cctx.Bool("queue") {
+			for _, p := range cctx.Args().Slice() {
+				j, err := api.ClientCommPQueue(ctx, p)
+				if err != nil {
+					return xerrors.Errorf("queueing %s: %w", p, err)
+				}
+				fmt.Printf("%s: %s\n", j.Path, j.State)
+			}
+			return nil
 		}
 
-		ret, err := api.ClientCalcCommP(ctx, cctx.Args().Get(0))
+		encoder, err := GetCidEncoder(cctx)
+		if err != nil {
+			return err
+		}
+
+		// queue all files first, so they are calculated in parallel
+		for _, p := range cctx.Args().Slice() {
+			if _, err := api.ClientCommPQueue(ctx, p); err != nil {
+				return xerrors.Errorf("queueing %s: %w", p, err)
+			}
+		}
+
+		for _, p := range cctx.Args().Slice() {
+			ret, err := api.ClientCalcCommP(ctx, p)
+			if err != nil {
+				return xerrors.Errorf("calculating commP of %s: %w", p, err)
+			}
+
+			if cctx.Args().Len() > 1 {
+				fmt.Println(p)
+			}
+			fmt.Println("CID: ", encoder.Encode(ret.Root))
+			fmt.Println("Piece size: ", types.SizeStr(types.NewInt(uint64(ret.Size))))
+		}
+		return nil
+	},
+}
+
+var clientCommPJobsCmd = &cli.Command{
+	Name:  "commP-jobs",
+	Usage: "List the commP calculations of the node",
+	Flags: []cli.Flag{
+		&CidBaseFlag,
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		jobs, err := api.ClientCommPJobs(ctx)
 		if err != nil {
 			return err
 		}
@@ -207,9 +273,28 @@ var clientCommPCmd = &cli.Command{
 			return err
 		}
 
-		fmt.Println("CID: ", encoder.Encode(ret.Root))
-		fmt.Println("Piece size: ", types.SizeStr(types.NewInt(uint64(ret.Size))))
-		return nil
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "Path\tState\tTook\tPiece CID\tPiece Size")
+		for _, j := range jobs {
+			took, cid, size := "", "", ""
+			switch {
+			case j.Cached:
+				took = "cached"
+			case !j.Finished.IsZero():
+				took = j.Finished.Sub(j.Started).Truncate(time.Millisecond).String()
+			case !j.Started.IsZero():
+				took = time.Since(j.Started).Truncate(time.Second).String()
+			}
+			if j.Result != nil {
+				cid = encoder.Encode(j.Result.Root)
+				size = types.SizeStr(types.NewInt(uint64(j.Result.Size)))
+			}
+			if j.Error != "" {
+				cid = j.Error
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", j.Path, j.State, took, cid, size)
+		}
+		return w.Flush()
 	},
 }
 
@@ -289,8 +374,30 @@ var clientLocalCmd = &cli.Command{
 var clientDealCmd = &cli.Command{
 	Name:      "deal",
 	Usage:     "Initialize storage deal with a miner",
-	ArgsUsage: "[dataCid miner price duration]",
+	ArgsUsage: "[dataCid|file miner price duration]",
+	Description: `Proposes a storage deal for previously imported data, or for a file which
+   is imported first. Funds are added to market escrow as needed, and data is
+   transferred to the miner once the deal is accepted.
+
+   Price and duration can be passed as arguments or with --price and
+   --duration. With --wait the command tracks the deal until it's active.`,
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "price",
+			Usage: "price per GiB per epoch, in FIL",
+		},
+		&cli.Int64Flag{
+			Name:  "duration",
+			Usage: "deal duration in epochs",
+		},
+		&cli.BoolFlag{
+			Name:  "car",
+			Usage: "when proposing a deal for a file, import it as a car file",
+		},
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "wait for the deal to become active",
+		},
 		&cli.StringFlag{
 			Name:  "manual-piece-cid",
 			Usage: "manually specify piece commitment for data (dataCid must be to a car file)",
@@ -336,13 +443,18 @@ var clientDealCmd = &cli.Command{
 		defer closer()
 		ctx := ReqContext(cctx)
 
-		if cctx.NArg() != 4 {
-			return xerrors.New("expected 4 args: dataCid, miner, price, duration")
+		priceStr, durStr := cctx.String("price"), fmt.Sprint(cctx.Int64("duration"))
+		switch {
+		case cctx.NArg() == 4:
+			priceStr, durStr = cctx.Args().Get(2), cctx.Args().Get(3)
+		case cctx.NArg() == 2 && cctx.IsSet("price") && cctx.IsSet("duration"):
+		default:
+			return xerrors.New("expected 4 args: dataCid, miner, price, duration; or 2 args with --price and --duration")
 		}
 
 		// [data, miner, price, dur]
 
-		data, err := cid.Parse(cctx.Args().Get(0))
+		data, err := dealDataRoot(ctx, api, cctx.Args().Get(0), cctx.Bool("car"))
 		if err != nil {
 			return err
 		}
@@ -352,12 +464,12 @@ var clientDealCmd = &cli.Command{
 			return err
 		}
 
-		price, err := types.ParseFIL(cctx.Args().Get(2))
+		price, err := types.ParseFIL(priceStr)
 		if err != nil {
 			return err
 		}
 
-		dur, err := strconv.ParseInt(cctx.Args().Get(3), 10, 32)
+		dur, err := strconv.ParseInt(durStr, 10, 32)
 		if err != nil {
 			return err
 		}
@@ -456,10 +568,82 @@ var clientDealCmd = &cli.Command{
 
 		fmt.Println(encoder.Encode(*proposal))
 
-		return nil
+		if !cctx.Bool("wait") {
+			return nil
+		}
+
+		return waitDealActive(ctx, api, *proposal)
 	},
 }
 
+// dealDataRoot returns the root of the data to make a deal for. arg is either
+// the root CID of imported data, or a path to a file which gets imported.
+func dealDataRoot(ctx context.Context, api lapi.FullNode, arg string, car bool) (cid.Cid, error) {
+	if _, err := os.Stat(arg); err != nil {
+		return cid.Parse(arg)
+	}
+
+	absPath, err := filepath.Abs(arg)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	res, err := api.ClientImport(ctx, lapi.FileRef{
+		Path:  absPath,
+		IsCAR: car,
+	})
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("importing %s: %w", arg, err)
+	}
+
+	fmt.Printf("Imported %s as import %d, root %s\n", arg, res.ImportID, res.Root)
+	return res.Root, nil
+}
+
+func waitDealActive(ctx context.Context, api lapi.FullNode, proposal cid.Cid) error {
+	updates, err := api.ClientGetDealUpdates(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting deal updates: %w", err)
+	}
+
+	di, err := api.ClientGetDealInfo(ctx, proposal)
+	if err != nil {
+		return xerrors.Errorf("getting deal info: %w", err)
+	}
+
+	last := storagemarket.StorageDealUnknown
+	for {
+		if di.State != last {
+			fmt.Printf("%s: %s %s\n", time.Now().Format("15:04:05"), storagemarket.DealStates[di.State], di.Message)
+			last = di.State
+		}
+
+		switch di.State {
+		case storagemarket.StorageDealActive:
+			fmt.Printf("Deal %d active\n", di.DealID)
+			return nil
+		case storagemarket.StorageDealProposalNotFound,
+			storagemarket.StorageDealProposalRejected,
+			storagemarket.StorageDealExpired,
+			storagemarket.StorageDealSlashed,
+			storagemarket.StorageDealError:
+			return xerrors.Errorf("deal failed: %s: %s", storagemarket.DealStates[di.State], di.Message)
+		}
+
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				return xerrors.New("deal updates channel closed")
+			}
+			if u.ProposalCid == proposal {
+				di = &u
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func interactiveDeal(cctx *cli.Context) error {
 	api, closer, err := GetFullNodeAPI(cctx)
 	if err != nil {
@@ -665,6 +849,11 @@ var clientFindCmd = &cli.Command{
 			Name:  "pieceCid",
 			Usage: "require data to be retrieved from a specific Piece CID",
 		},
+		&cli.StringFlag{
+			Name:  "select",
+			Usage: "how to order discovered miners: 'price' or 'latency'",
+			Value: "price",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if !cctx.Args().Present() {
@@ -748,6 +937,11 @@ var clientRetrieveCmd = &cli.Command{
 			Name:  "pieceCid",
 			Usage: "require data to be retrieved from a specific Piece CID",
 		},
+		&cli.StringFlag{
+			Name:  "select",
+			Usage: "order in which discovered miners are tried: 'price' or 'latency'",
+			Value: "price",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if cctx.NArg() != 2 {
@@ -797,95 +991,208 @@ var clientRetrieveCmd = &cli.Command{
 			pieceCid = &parsed
 		}
 
-		var offer api.QueryOffer
-		minerStrAddr := cctx.String("miner")
-		if minerStrAddr == "" { // Local discovery
-			offers, err := fapi.ClientFindData(ctx, file, pieceCid)
-
-			var cleaned []api.QueryOffer
-			// filter out offers that errored
-			for _, o := range offers {
-				if o.Err == "" {
-					cleaned = append(cleaned, o)
-				}
+		maxPrice := types.FromFil(DefaultMaxRetrievePrice)
+
+		if cctx.String("maxPrice") != "" {
+			maxPriceFil, err := types.ParseFIL(cctx.String("maxPrice"))
+			if err != nil {
+				return xerrors.Errorf("parsing maxPrice: %w", err)
 			}
 
-			offers = cleaned
+			maxPrice = types.BigInt(maxPriceFil)
+		}
 
-			// sort by price low to high
-			sort.Slice(offers, func(i, j int) bool {
-				return offers[i].MinPrice.LessThan(offers[j].MinPrice)
-			})
+		ref := &lapi.FileRef{
+			Path:  cctx.Args().Get(1),
+			IsCAR: cctx.Bool("car"),
+		}
+
+		minerStrAddr := cctx.String("miner")
+		if minerStrAddr != "" { // Directed retrieval
+			minerAddr, err := address.NewFromString(minerStrAddr)
 			if err != nil {
 				return err
 			}
+			offer, err := fapi.ClientMinerQueryOffer(ctx, minerAddr, file, pieceCid)
+			if err != nil {
+				return err
+			}
+			if offer.Err != "" {
+				return fmt.Errorf("The received offer errored: %s", offer.Err)
+			}
+			if offer.MinPrice.GreaterThan(maxPrice) {
+				return xerrors.Errorf("failed to find offer satisfying maxPrice: %s", maxPrice)
+			}
+
+			return retrieveFromOffer(ctx, fapi, offer, payer, ref)
+		}
+
+		// Discovery, with fallback to other miners on failure
+		tried, err := loadRetrievalTried(ref.Path)
+		if err != nil {
+			return err
+		}
+
+		offers, err := findRetrievalOffers(ctx, fapi, file, pieceCid, cctx.String("select"))
+		if err != nil {
+			return err
+		}
+
+		var candidates []retrievalCandidate
+		skipped := 0
+		for _, o := range offers {
+			if o.offer.MinPrice.GreaterThan(maxPrice) {
+				continue
+			}
+			if tried[o.offer.Miner] {
+				fmt.Printf("Skipping %s, it failed in a previous attempt\n", o.offer.Miner)
+				skipped++
+				continue
+			}
+			candidates = append(candidates, o)
+		}
 
-			// TODO: parse offer strings from `client find`, make this smarter
-			if len(offers) < 1 {
+		if len(candidates) == 0 {
+			switch {
+			case len(offers) == 0:
 				fmt.Println("Failed to find file")
 				return nil
+			case skipped > 0:
+				return xerrors.Errorf("all matching miners failed in previous attempts, remove %s to retry them", retrievalTriedPath(ref.Path))
+			default:
+				return xerrors.Errorf("failed to find offer satisfying maxPrice: %s", maxPrice)
 			}
-			offer = offers[0]
-		} else { // Directed retrieval
-			minerAddr, err := address.NewFromString(minerStrAddr)
-			if err != nil {
+		}
+
+		for i, c := range candidates {
+			fmt.Printf("Retrieving from %s (%d/%d): price %s, query latency %s\n",
+				c.offer.Miner, i+1, len(candidates), types.FIL(c.offer.MinPrice), c.latency.Round(time.Millisecond))
+
+			err := retrieveFromOffer(ctx, fapi, c.offer, payer, ref)
+			if err == nil {
+				return clearRetrievalTried(ref.Path)
+			}
+			if ctx.Err() != nil {
 				return err
 			}
-			offer, err = fapi.ClientMinerQueryOffer(ctx, minerAddr, file, pieceCid)
-			if err != nil {
+
+			fmt.Printf("Retrieval from %s failed: %s\n", c.offer.Miner, err)
+			tried[c.offer.Miner] = true
+			if err := saveRetrievalTried(ref.Path, tried); err != nil {
 				return err
 			}
 		}
-		if offer.Err != "" {
-			return fmt.Errorf("The received offer errored: %s", offer.Err)
+
+		return xerrors.Errorf("retrieval failed from all %d miners", len(candidates))
+	},
+}
+
+var clientTransfersCmd = &cli.Command{
+	Name:      "transfers",
+	Usage:     "List the protocols a miner accepts deal data with",
+	ArgsUsage: "[minerAddress]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "proposal",
+			Usage: "proposal CID of an offline deal, to get its HTTP push URL",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return xerrors.New("expected miner address as the only arg")
 		}
 
-		maxPrice := types.FromFil(DefaultMaxRetrievePrice)
+		maddr, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
 
-		if cctx.String("maxPrice") != "" {
-			maxPriceFil, err := types.ParseFIL(cctx.String("maxPrice"))
+		var proposal *cid.Cid
+		if cctx.IsSet("proposal") {
+			c, err := cid.Parse(cctx.String("proposal"))
 			if err != nil {
-				return xerrors.Errorf("parsing maxPrice: %w", err)
+				return xerrors.Errorf("parsing proposal cid: %w", err)
 			}
+			proposal = &c
+		}
 
-			maxPrice = types.BigInt(maxPriceFil)
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
 		}
+		defer closer()
+		ctx := ReqContext(cctx)
 
-		if offer.MinPrice.GreaterThan(maxPrice) {
-			return xerrors.Errorf("failed to find offer satisfying maxPrice: %s", maxPrice)
+		if err := RequireAPIFeature(ctx, api, build.FeatureDealTransfers); err != nil {
+			return err
 		}
 
-		ref := &lapi.FileRef{
-			Path:  cctx.Args().Get(1),
-			IsCAR: cctx.Bool("car"),
+		t, err := api.ClientDealTransfers(ctx, maddr, proposal)
+		if err != nil {
+			return err
+		}
+
+		if len(t.Protocols) == 0 {
+			fmt.Println("Miner doesn't accept deal data")
+		}
+		for _, p := range t.Protocols {
+			fmt.Println(p)
+		}
+		if t.PushURL != "" {
+			fmt.Printf("Push URL: %s\n", t.PushURL)
+		}
+		return nil
+	},
+}
+
+var clientPushDataCmd = &cli.Command{
+	Name:      "push-data",
+	Usage:     "Send the data of an offline deal to the miner",
+	ArgsUsage: "[proposalCid] [minerAddress] [carFile]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "protocol",
+			Usage: "push protocol to use, libp2p-http or http; by default the first one the miner supports",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 3 {
+			return xerrors.New("expected 3 args: proposalCid, minerAddress, carFile")
 		}
-		updates, err := fapi.ClientRetrieveWithEvents(ctx, offer.Order(payer), ref)
+
+		proposal, err := cid.Parse(cctx.Args().Get(0))
 		if err != nil {
-			return xerrors.Errorf("error setting up retrieval: %w", err)
-		}
-
-		for {
-			select {
-			case evt, ok := <-updates:
-				if ok {
-					fmt.Printf("> Recv: %s, Paid %s, %s (%s)\n",
-						types.SizeStr(types.NewInt(evt.BytesReceived)),
-						types.FIL(evt.FundsSpent),
-						retrievalmarket.ClientEvents[evt.Event],
-						retrievalmarket.DealStatuses[evt.Status],
-					)
-				} else {
-					fmt.Println("Success")
-					return nil
-				}
+			return xerrors.Errorf("parsing proposal cid: %w", err)
+		}
 
-				if evt.Err != "" {
-					return xerrors.Errorf("retrieval failed: %s", evt.Err)
-				}
-			case <-ctx.Done():
-				return xerrors.Errorf("retrieval timed out")
-			}
+		maddr, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return err
 		}
+
+		path, err := filepath.Abs(cctx.Args().Get(2))
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if err := RequireAPIFeature(ctx, api, build.FeatureDealTransfers); err != nil {
+			return err
+		}
+
+		protocol, err := api.ClientPushDealData(ctx, maddr, proposal, path, cctx.String("protocol"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Sent deal data with %s\n", protocol)
+		return nil
 	},
 }
 
@@ -972,6 +1279,69 @@ var clientQueryAskCmd = &cli.Command{
 	},
 }
 
+var clientFindMinersCmd = &cli.Command{
+	Name:  "find-miners",
+	Usage: "Query asks of all miners with power and list the ones matching given constraints",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "min-free-space",
+			Usage: "only list miners accepting pieces at least this large (e.g. 32GiB)",
+		},
+		&cli.StringFlag{
+			Name:  "max-price",
+			Usage: "only list miners asking at most this price per GiB per epoch (FIL)",
+		},
+		&cli.BoolFlag{
+			Name:  "verified",
+			Usage: "compare max-price with the verified deal price",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		var params lapi.FindMinersParams
+		if s := cctx.String("min-free-space"); s != "" {
+			size, err := units.RAMInBytes(s)
+			if err != nil {
+				return xerrors.Errorf("parsing min-free-space: %w", err)
+			}
+			params.MinFreeSpace = abi.PaddedPieceSize(size)
+		}
+		if s := cctx.String("max-price"); s != "" {
+			price, err := types.ParseFIL(s)
+			if err != nil {
+				return xerrors.Errorf("parsing max-price: %w", err)
+			}
+			p := abi.TokenAmount(price)
+			params.MaxPrice = &p
+		}
+		params.Verified = cctx.Bool("verified")
+
+		asks, err := api.ClientFindMiners(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Miner\tPrice/GiB\tVerified Price/GiB\tMin Piece\tMax Piece\n")
+		for _, a := range asks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				a.Miner,
+				types.FIL(a.Ask.Price),
+				types.FIL(a.Ask.VerifiedPrice),
+				types.SizeStr(types.NewInt(uint64(a.Ask.MinPieceSize))),
+				types.SizeStr(types.NewInt(uint64(a.Ask.MaxPieceSize))))
+		}
+
+		return w.Flush()
+	},
+}
+
 var clientListDeals = &cli.Command{
 	Name:  "list-deals",
 	Usage: "List storage market deals",
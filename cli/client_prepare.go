@@ -0,0 +1,448 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/go-units"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-cidutil"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/build"
+)
+
+// prepareEntryOverhead is a rough upper bound of the CAR and DAG bytes added
+// for each file (or file part) packed into a piece
+const prepareEntryOverhead = 256
+
+// prepareManifest maps the files of a prepared directory to the CAR files
+// they were packed into
+type prepareManifest struct {
+	Source string
+	Pieces []preparePiece
+}
+
+type preparePiece struct {
+	Car     string
+	Root    cid.Cid
+	CarSize int64
+
+	// Set with --commp, for use with offline deals
+	PieceCID  *cid.Cid              `json:",omitempty"`
+	PieceSize abi.UnpaddedPieceSize `json:",omitempty"`
+
+	Files []prepareFile
+}
+
+type prepareFile struct {
+	// Path of the file relative to the source directory
+	Path string
+	// Path of the data in the CAR root directory; differs from Path for
+	// parts of split files
+	CarPath string
+	Offset  int64
+	Size    int64
+}
+
+var clientPrepareCmd = &cli.Command{
+	Name:      "prepare",
+	Usage:     "Pack a directory into CAR files sized for storage deals",
+	ArgsUsage: "[inputDir]",
+	Description: `Walks the input directory and packs its files into CAR files, each small
+   enough to fit in a piece of --max-piece-size. Files larger than a piece are
+   split into parts. A manifest.json mapping files to CARs is written next to
+   the CARs in the output directory.
+
+   CARs can be imported with 'client import --car' for online deals, or used
+   directly in offline deals with the piece CIDs computed with --commp.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "max-piece-size",
+			Usage: "padded size of pieces the CARs must fit in",
+			Value: "32GiB",
+		},
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "output directory",
+			Value: ".",
+		},
+		&cli.BoolFlag{
+			Name:  "commp",
+			Usage: "calculate piece CIDs of the CARs using the daemon",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return xerrors.New("expected input directory as the only arg")
+		}
+		ctx := ReqContext(cctx)
+
+		src, err := filepath.Abs(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		mps, err := units.RAMInBytes(cctx.String("max-piece-size"))
+		if err != nil {
+			return xerrors.Errorf("parsing max-piece-size: %w", err)
+		}
+		maxPiece := abi.PaddedPieceSize(mps)
+		if err := maxPiece.Validate(); err != nil {
+			return xerrors.Errorf("invalid max-piece-size: %w", err)
+		}
+		maxCar := int64(maxPiece.Unpadded())
+
+		out, err := filepath.Abs(cctx.String("out"))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return err
+		}
+
+		buckets, err := preparePlan(src, maxCar-maxCar/64)
+		if err != nil {
+			return err
+		}
+
+		mf := prepareManifest{Source: src}
+		for i, bucket := range buckets {
+			carPath := filepath.Join(out, fmt.Sprintf("piece-%04d.car", i))
+
+			root, size, err := prepareWriteCar(ctx, src, carPath, bucket)
+			if err != nil {
+				return xerrors.Errorf("writing %s: %w", carPath, err)
+			}
+			if size > maxCar {
+				return xerrors.Errorf("%s is %d bytes, larger than max piece size allows (%d)", carPath, size, maxCar)
+			}
+
+			piece := preparePiece{
+				Car:     filepath.Base(carPath),
+				Root:    root,
+				CarSize: size,
+				Files:   bucket,
+			}
+
+			if cctx.Bool("commp") {
+				api, closer, err := GetFullNodeAPI(cctx)
+				if err != nil {
+					return err
+				}
+
+				ret, err := api.ClientCalcCommP(ctx, carPath)
+				closer()
+				if err != nil {
+					return xerrors.Errorf("computing commP of %s: %w", carPath, err)
+				}
+
+				piece.PieceCID = &ret.Root
+				piece.PieceSize = ret.Size
+			}
+
+			mf.Pieces = append(mf.Pieces, piece)
+			fmt.Printf("%s: %d files, %s, root %s\n", piece.Car, len(bucket), units.BytesSize(float64(size)), root)
+		}
+
+		b, err := json.MarshalIndent(&mf, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(out, "manifest.json"), b, 0644)
+	},
+}
+
+// preparePlan assigns files in src to buckets of at most budget bytes,
+// splitting files which don't fit in a single bucket
+func preparePlan(src string, budget int64) ([][]prepareFile, error) {
+	var all []prepareFile
+	err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if fi.Size()+prepareEntryOverhead <= budget {
+			all = append(all, prepareFile{Path: rel, CarPath: rel, Size: fi.Size()})
+			return nil
+		}
+
+		partSize := budget - prepareEntryOverhead
+		for off, part := int64(0), 0; off < fi.Size(); off, part = off+partSize, part+1 {
+			size := partSize
+			if fi.Size()-off < size {
+				size = fi.Size() - off
+			}
+			all = append(all, prepareFile{
+				Path:    rel,
+				CarPath: fmt.Sprintf("%s.part%04d", rel, part),
+				Offset:  off,
+				Size:    size,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("walking %s: %w", src, err)
+	}
+	if len(all) == 0 {
+		return nil, xerrors.Errorf("no files found in %s", src)
+	}
+
+	var buckets [][]prepareFile
+	var cur []prepareFile
+	var used int64
+	for _, f := range all {
+		if len(cur) > 0 && used+f.Size+prepareEntryOverhead > budget {
+			buckets = append(buckets, cur)
+			cur, used = nil, 0
+		}
+		cur = append(cur, f)
+		used += f.Size + prepareEntryOverhead
+	}
+
+	return append(buckets, cur), nil
+}
+
+func prepareWriteCar(ctx context.Context, src, carPath string, bucket []prepareFile) (cid.Cid, int64, error) {
+	bodyPath := carPath + ".body"
+	body, err := os.Create(bodyPath)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	defer os.Remove(bodyPath) //nolint:errcheck
+	defer body.Close()        //nolint:errcheck
+
+	cw := &carBodyWriter{
+		w:    bufio.NewWriterSize(body, 1<<20),
+		seen: cid.NewSet(),
+	}
+
+	prefix, err := merkledag.PrefixForCidVersion(1)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	prefix.MhType = mh.BLAKE2B_MIN + 31 // same as used for node imports
+	cb := cidutil.InlineBuilder{
+		Builder: prefix,
+		Limit:   126,
+	}
+
+	root := &prepareDir{}
+	for _, f := range bucket {
+		nd, err := prepareFileNode(src, f, cw, cb)
+		if err != nil {
+			return cid.Undef, 0, xerrors.Errorf("importing %s: %w", f.CarPath, err)
+		}
+		root.add(f.CarPath, nd)
+	}
+
+	// directories aren't inlined, so the root is always a regular CID
+	rnd, err := root.node(ctx, cw, prefix)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	if err := cw.w.Flush(); err != nil {
+		return cid.Undef, 0, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return cid.Undef, 0, err
+	}
+
+	out, err := os.Create(carPath)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	defer out.Close() //nolint:errcheck
+
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{rnd.Cid()}, Version: 1}, out); err != nil {
+		return cid.Undef, 0, err
+	}
+	if _, err := io.Copy(out, body); err != nil {
+		return cid.Undef, 0, err
+	}
+
+	fi, err := out.Stat()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	return rnd.Cid(), fi.Size(), out.Close()
+}
+
+func prepareFileNode(src string, f prepareFile, ds ipld.DAGService, cb cid.Builder) (ipld.Node, error) {
+	fi, err := os.Open(filepath.Join(src, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close() //nolint:errcheck
+
+	r := files.NewReaderFile(io.NewSectionReader(fi, f.Offset, f.Size))
+
+	params := ihelper.DagBuilderParams{
+		Maxlinks:   build.UnixfsLinksPerLevel,
+		RawLeaves:  true,
+		CidBuilder: cb,
+		Dagserv:    ds,
+	}
+
+	db, err := params.New(chunker.NewSizeSplitter(r, int64(build.UnixfsChunkSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	return balanced.Layout(db)
+}
+
+// prepareDir is a directory tree of imported file nodes
+type prepareDir struct {
+	files map[string]ipld.Node
+	dirs  map[string]*prepareDir
+}
+
+func (d *prepareDir) add(p string, nd ipld.Node) {
+	dir, name := path.Split(p)
+	cur := d
+	for _, elem := range splitPath(path.Clean(dir)) {
+		if cur.dirs == nil {
+			cur.dirs = map[string]*prepareDir{}
+		}
+		sub, ok := cur.dirs[elem]
+		if !ok {
+			sub = &prepareDir{}
+			cur.dirs[elem] = sub
+		}
+		cur = sub
+	}
+
+	if cur.files == nil {
+		cur.files = map[string]ipld.Node{}
+	}
+	cur.files[name] = nd
+}
+
+func (d *prepareDir) node(ctx context.Context, ds ipld.DAGService, cb cid.Builder) (ipld.Node, error) {
+	dir := uio.NewDirectory(ds)
+	dir.SetCidBuilder(cb)
+
+	names := make([]string, 0, len(d.dirs))
+	for name := range d.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		nd, err := d.dirs[name].node(ctx, ds, cb)
+		if err != nil {
+			return nil, err
+		}
+		if err := dir.AddChild(ctx, name, nd); err != nil {
+			return nil, err
+		}
+	}
+
+	names = names[:0]
+	for name := range d.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := dir.AddChild(ctx, name, d.files[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	nd, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	return nd, ds.Add(ctx, nd)
+}
+
+func splitPath(p string) []string {
+	if p == "." || p == "/" || p == "" {
+		return nil
+	}
+	dir, name := path.Split(p)
+	return append(splitPath(path.Clean(dir)), name)
+}
+
+// carBodyWriter is a write-only DAGService which appends added blocks to a
+// CAR body, so that large DAGs don't have to be kept in a blockstore
+type carBodyWriter struct {
+	w    *bufio.Writer
+	seen *cid.Set
+}
+
+var _ ipld.DAGService = &carBodyWriter{}
+
+func (cw *carBodyWriter) Add(ctx context.Context, nd ipld.Node) error {
+	if !cw.seen.Visit(nd.Cid()) {
+		return nil
+	}
+	return carutil.LdWrite(cw.w, nd.Cid().Bytes(), nd.RawData())
+}
+
+func (cw *carBodyWriter) AddMany(ctx context.Context, nds []ipld.Node) error {
+	for _, nd := range nds {
+		if err := cw.Add(ctx, nd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *carBodyWriter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return nil, ipld.ErrNotFound
+}
+
+func (cw *carBodyWriter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	for range cids {
+		out <- &ipld.NodeOption{Err: ipld.ErrNotFound}
+	}
+	close(out)
+	return out
+}
+
+func (cw *carBodyWriter) Remove(ctx context.Context, c cid.Cid) error {
+	return xerrors.New("carBodyWriter is append-only")
+}
+
+func (cw *carBodyWriter) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return xerrors.New("carBodyWriter is append-only")
+}
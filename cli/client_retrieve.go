@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type retrievalCandidate struct {
+	offer   api.QueryOffer
+	latency time.Duration
+}
+
+// findRetrievalOffers queries all miners known to have the data: peers found
+// by the node's retrieval discovery, and when the piece is known, providers
+// of active on-chain deals for that piece
+func findRetrievalOffers(ctx context.Context, fapi api.FullNode, root cid.Cid, piece *cid.Cid, sel string) ([]retrievalCandidate, error) {
+	if sel != "price" && sel != "latency" {
+		return nil, xerrors.Errorf("unknown miner selection '%s', expected 'price' or 'latency'", sel)
+	}
+
+	miners := map[address.Address]struct{}{}
+
+	local, err := fapi.ClientFindData(ctx, root, piece)
+	if err != nil {
+		return nil, xerrors.Errorf("finding data: %w", err)
+	}
+	for _, o := range local {
+		if o.Err == "" {
+			miners[o.Miner] = struct{}{}
+		}
+	}
+
+	if piece != nil {
+		deals, err := fapi.StateMarketDeals(ctx, types.EmptyTSK)
+		if err != nil {
+			return nil, xerrors.Errorf("getting market deals: %w", err)
+		}
+		for _, d := range deals {
+			if d.Proposal.PieceCID == *piece && d.State.SectorStartEpoch > 0 && d.State.SlashEpoch < 0 {
+				miners[d.Proposal.Provider] = struct{}{}
+			}
+		}
+	}
+
+	var (
+		lk  sync.Mutex
+		out []retrievalCandidate
+		wg  sync.WaitGroup
+	)
+	for maddr := range miners {
+		wg.Add(1)
+		go func(maddr address.Address) {
+			defer wg.Done()
+
+			start := time.Now()
+			offer, err := fapi.ClientMinerQueryOffer(ctx, maddr, root, piece)
+			if err != nil || offer.Err != "" {
+				return
+			}
+
+			lk.Lock()
+			out = append(out, retrievalCandidate{offer: offer, latency: time.Since(start)})
+			lk.Unlock()
+		}(maddr)
+	}
+	wg.Wait()
+
+	sort.Slice(out, func(i, j int) bool {
+		pi, pj := out[i].offer.MinPrice, out[j].offer.MinPrice
+		if sel == "latency" || pi.Equals(pj) {
+			return out[i].latency < out[j].latency
+		}
+		return pi.LessThan(pj)
+	})
+
+	return out, nil
+}
+
+func retrieveFromOffer(ctx context.Context, fapi api.FullNode, offer api.QueryOffer, payer address.Address, ref *api.FileRef) error {
+	updates, err := fapi.ClientRetrieveWithEvents(ctx, offer.Order(payer), ref)
+	if err != nil {
+		return xerrors.Errorf("error setting up retrieval: %w", err)
+	}
+
+	for {
+		select {
+		case evt, ok := <-updates:
+			if ok {
+				fmt.Printf("> Recv: %s, Paid %s, %s (%s)\n",
+					types.SizeStr(types.NewInt(evt.BytesReceived)),
+					types.FIL(evt.FundsSpent),
+					retrievalmarket.ClientEvents[evt.Event],
+					retrievalmarket.DealStatuses[evt.Status],
+				)
+			} else {
+				fmt.Println("Success")
+				return nil
+			}
+
+			if evt.Err != "" {
+				return xerrors.Errorf("retrieval failed: %s", evt.Err)
+			}
+		case <-ctx.Done():
+			return xerrors.Errorf("retrieval timed out")
+		}
+	}
+}
+
+// Miners which failed to serve a retrieval are recorded next to the output,
+// so that rerunning the command continues with the remaining miners
+
+func retrievalTriedPath(out string) string {
+	return out + ".retrieval-tried"
+}
+
+func loadRetrievalTried(out string) (map[address.Address]bool, error) {
+	tried := map[address.Address]bool{}
+
+	b, err := ioutil.ReadFile(retrievalTriedPath(out))
+	if os.IsNotExist(err) {
+		return tried, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("reading previous attempts: %w", err)
+	}
+
+	var miners []address.Address
+	if err := json.Unmarshal(b, &miners); err != nil {
+		return nil, xerrors.Errorf("decoding previous attempts: %w", err)
+	}
+	for _, m := range miners {
+		tried[m] = true
+	}
+
+	return tried, nil
+}
+
+func saveRetrievalTried(out string, tried map[address.Address]bool) error {
+	miners := make([]address.Address, 0, len(tried))
+	for m := range tried {
+		miners = append(miners, m)
+	}
+
+	b, err := json.Marshal(miners)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(retrievalTriedPath(out), b, 0644)
+}
+
+func clearRetrievalTried(out string) error {
+	if err := os.Remove(retrievalTriedPath(out)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/chain/types"
+	marketevents "github.com/filecoin-project/lotus/markets/loggers"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+// TestClientRetrieveSelect runs client retrieve against a node answering
+// with two miners: a cheap, slow one and an expensive, fast one
+func TestClientRetrieveSelect(t *testing.T) {
+	root, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+
+	payer, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	cheap, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	fast, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	var lk sync.Mutex
+	var retrieved []address.Address
+
+	full := &apistruct.FullNodeStruct{}
+	full.Internal.WalletDefaultAddress = func(ctx context.Context) (address.Address, error) {
+		return payer, nil
+	}
+	full.Internal.ClientFindData = func(ctx context.Context, root cid.Cid, piece *cid.Cid) ([]api.QueryOffer, error) {
+		return []api.QueryOffer{{Miner: cheap}, {Miner: fast}}, nil
+	}
+	full.Internal.ClientMinerQueryOffer = func(ctx context.Context, miner address.Address, root cid.Cid, piece *cid.Cid) (api.QueryOffer, error) {
+		offer := api.QueryOffer{Root: root, Size: 1, Miner: miner, MinPrice: types.NewInt(10)}
+		if miner == cheap {
+			time.Sleep(100 * time.Millisecond)
+			offer.MinPrice = types.NewInt(1)
+		}
+		return offer, nil
+	}
+	full.Internal.ClientRetrieveWithEvents = func(ctx context.Context, order api.RetrievalOrder, ref *api.FileRef) (<-chan marketevents.RetrievalEvent, error) {
+		lk.Lock()
+		retrieved = append(retrieved, order.Miner)
+		lk.Unlock()
+
+		ch := make(chan marketevents.RetrievalEvent)
+		close(ch)
+		return ch, nil
+	}
+
+	rpcServer := jsonrpc.NewServer()
+	rpcServer.Register("Filecoin", full)
+	srv := httptest.NewServer(rpcServer)
+	defer srv.Close()
+
+	maddr := "/ip4/127.0.0.1/tcp/" + srv.URL[strings.LastIndex(srv.URL, ":")+1:] + "/http"
+	require.NoError(t, os.Setenv("FULLNODE_API_INFO", "token:"+maddr))
+	defer os.Unsetenv("FULLNODE_API_INFO") //nolint:errcheck
+
+	dir, err := ioutil.TempDir("", "client-retrieve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	for _, tc := range []struct {
+		sel    string
+		expect address.Address
+	}{
+		{"", cheap},
+		{"price", cheap},
+		{"latency", fast},
+	} {
+		lk.Lock()
+		retrieved = nil
+		lk.Unlock()
+
+		app := cli.NewApp()
+		app.Metadata = map[string]interface{}{"repoType": repo.FullNode}
+		app.Commands = []*cli.Command{clientRetrieveCmd}
+
+		args := []string{"lotus", "retrieve"}
+		if tc.sel != "" {
+			args = append(args, "--select", tc.sel)
+		}
+		args = append(args, root.String(), filepath.Join(dir, "out-"+tc.sel))
+
+		require.NoError(t, app.Run(args), "select %q", tc.sel)
+
+		lk.Lock()
+		require.Equal(t, []address.Address{tc.expect}, retrieved, "select %q", tc.sel)
+		lk.Unlock()
+	}
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/lib/addrutil"
 	"github.com/filecoin-project/lotus/node/repo"
 )
 
@@ -51,12 +52,51 @@ type APIInfo struct {
 	Token []byte
 }
 
+// ParseApiInfo parses a token:multiaddr pair, as in the *_API_INFO env vars
+func ParseApiInfo(s string) (APIInfo, error) {
+	sp := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(sp) != 2 {
+		return APIInfo{}, xerrors.New("missing token or address")
+	}
+	ma, err := multiaddr.NewMultiaddr(sp[1])
+	if err != nil {
+		return APIInfo{}, xerrors.Errorf("parsing multiaddr: %w", err)
+	}
+	return APIInfo{Addr: ma, Token: []byte(sp[0])}, nil
+}
+
 func (a APIInfo) DialArgs() (string, error) {
-	_, addr, err := manet.DialArgs(a.Addr)
+	addr, tls, err := a.host()
 
+	if tls {
+		return "wss://" + addr + "/rpc/v0", err
+	}
 	return "ws://" + addr + "/rpc/v0", err
 }
 
+// HTTPBase returns the base URL of the HTTP endpoints served next to the RPC
+// one, like /debug/pprof
+func (a APIInfo) HTTPBase() (string, error) {
+	addr, tls, err := a.host()
+
+	if tls {
+		return "https://" + addr, err
+	}
+	return "http://" + addr, err
+}
+
+// host returns the host part of the endpoint URLs, and whether the endpoint is
+// served over TLS
+func (a APIInfo) host() (string, bool, error) {
+	if path, unix := addrutil.UnixPath(a.Addr); unix {
+		return client.UnixSocketHost(path), false, nil
+	}
+
+	maddr, tls := addrutil.SplitTLS(a.Addr)
+	_, addr, err := manet.DialArgs(maddr)
+	return addr, tls, err
+}
+
 func (a APIInfo) AuthHeader() http.Header {
 	if len(a.Token) != 0 {
 		headers := http.Header{}
@@ -123,6 +163,17 @@ func envForRepoDeprecation(t repo.RepoType) string {
 }
 
 func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
+	infos, err := GetAPIInfos(ctx, t)
+	if err != nil {
+		return APIInfo{}, err
+	}
+	return infos[0], nil
+}
+
+// GetAPIInfos returns the API info of every endpoint listed in the env var,
+// which takes a comma separated list of token:multiaddr pairs. Otherwise the
+// single endpoint from the flag or the repo is returned.
+func GetAPIInfos(ctx *cli.Context, t repo.RepoType) ([]APIInfo, error) {
 	// Check if there was a flag passed with the listen address of the API
 	// server (only used by the tests)
 	apiFlag := flagForAPI(t)
@@ -132,9 +183,9 @@ func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 
 		apima, err := multiaddr.NewMultiaddr(strma)
 		if err != nil {
-			return APIInfo{}, err
+			return nil, err
 		}
-		return APIInfo{Addr: apima}, nil
+		return []APIInfo{{Addr: apima}}, nil
 	}
 
 	envKey := envForRepo(t)
@@ -148,18 +199,24 @@ func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 		}
 	}
 	if ok {
-		sp := strings.SplitN(env, ":", 2)
-		if len(sp) != 2 {
-			log.Warnf("invalid env(%s) value, missing token or address", envKey)
-		} else {
+		var infos []APIInfo
+		for _, ent := range strings.Split(env, ",") {
+			sp := strings.SplitN(strings.TrimSpace(ent), ":", 2)
+			if len(sp) != 2 {
+				log.Warnf("invalid env(%s) value, missing token or address", envKey)
+				continue
+			}
 			ma, err := multiaddr.NewMultiaddr(sp[1])
 			if err != nil {
-				return APIInfo{}, xerrors.Errorf("could not parse multiaddr from env(%s): %w", envKey, err)
+				return nil, xerrors.Errorf("could not parse multiaddr from env(%s): %w", envKey, err)
 			}
-			return APIInfo{
+			infos = append(infos, APIInfo{
 				Addr:  ma,
 				Token: []byte(sp[0]),
-			}, nil
+			})
+		}
+		if len(infos) > 0 {
+			return infos, nil
 		}
 	}
 
@@ -167,17 +224,17 @@ func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 
 	p, err := homedir.Expand(ctx.String(repoFlag))
 	if err != nil {
-		return APIInfo{}, xerrors.Errorf("could not expand home dir (%s): %w", repoFlag, err)
+		return nil, xerrors.Errorf("could not expand home dir (%s): %w", repoFlag, err)
 	}
 
 	r, err := repo.NewFS(p)
 	if err != nil {
-		return APIInfo{}, xerrors.Errorf("could not open repo at path: %s; %w", p, err)
+		return nil, xerrors.Errorf("could not open repo at path: %s; %w", p, err)
 	}
 
 	ma, err := r.APIEndpoint()
 	if err != nil {
-		return APIInfo{}, xerrors.Errorf("could not get api endpoint: %w", err)
+		return nil, xerrors.Errorf("could not get api endpoint: %w", err)
 	}
 
 	token, err := r.APIToken()
@@ -185,10 +242,10 @@ func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 		log.Warnf("Couldn't load CLI token, capabilities may be limited: %v", err)
 	}
 
-	return APIInfo{
+	return []APIInfo{{
 		Addr:  ma,
 		Token: token,
-	}, nil
+	}}, nil
 }
 
 func GetRawAPI(ctx *cli.Context, t repo.RepoType) (string, http.Header, error) {
@@ -224,13 +281,74 @@ func GetAPI(ctx *cli.Context) (api.Common, jsonrpc.ClientCloser, error) {
 	return client.NewCommonRPC(ctx.Context, addr, headers)
 }
 
+// GetFullNodeAPI connects to the full node. When multiple endpoints are
+// configured, calls are routed between them, see client.NewFullNodeRouter.
 func GetFullNodeAPI(ctx *cli.Context) (api.FullNode, jsonrpc.ClientCloser, error) {
-	addr, headers, err := GetRawAPI(ctx, repo.FullNode)
+	return getFullNodeAPI(ctx, client.NewFullNodeRouter)
+}
+
+// GetFullNodeFailoverAPI is GetFullNodeAPI, but when multiple endpoints are
+// configured all calls go to the first healthy one, see
+// client.NewFullNodeFailover.
+func GetFullNodeFailoverAPI(ctx *cli.Context) (api.FullNode, jsonrpc.ClientCloser, error) {
+	return getFullNodeAPI(ctx, client.NewFullNodeFailover)
+}
+
+func getFullNodeAPI(ctx *cli.Context, route func(context.Context, []string, []api.FullNode) (api.FullNode, error)) (api.FullNode, jsonrpc.ClientCloser, error) {
+	infos, err := GetAPIInfos(ctx, repo.FullNode)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("could not get API info: %w", err)
+	}
+
+	if len(infos) == 1 {
+		addr, err := infos[0].DialArgs()
+		if err != nil {
+			return nil, nil, xerrors.Errorf("could not get DialArgs: %w", err)
+		}
+
+		return client.NewFullNodeRPC(ctx.Context, addr, infos[0].AuthHeader())
+	}
+
+	rctx, cancel := context.WithCancel(ctx.Context)
+	closers := []jsonrpc.ClientCloser{jsonrpc.ClientCloser(cancel)}
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	var names []string
+	var nodes []api.FullNode
+	for _, info := range infos {
+		addr, err := info.DialArgs()
+		if err != nil {
+			closeAll()
+			return nil, nil, xerrors.Errorf("could not get DialArgs: %w", err)
+		}
+
+		n, closer, err := client.NewFullNodeRPC(rctx, addr, info.AuthHeader())
+		if err != nil {
+			log.Warnf("connecting to full node %s: %s", info.Addr, err)
+			continue
+		}
+		closers = append(closers, closer)
+
+		names = append(names, info.Addr.String())
+		nodes = append(nodes, n)
+	}
+
+	if len(nodes) == 0 {
+		closeAll()
+		return nil, nil, xerrors.Errorf("could not connect to any of %d full nodes", len(infos))
+	}
+
+	fn, err := route(rctx, names, nodes)
 	if err != nil {
+		closeAll()
 		return nil, nil, err
 	}
 
-	return client.NewFullNodeRPC(ctx.Context, addr, headers)
+	return fn, closeAll, nil
 }
 
 func GetStorageMinerAPI(ctx *cli.Context, opts ...jsonrpc.Option) (api.StorageMiner, jsonrpc.ClientCloser, error) {
@@ -282,6 +400,7 @@ var CommonCommands = []*cli.Command{
 	logCmd,
 	waitApiCmd,
 	fetchParamCmd,
+	debugCmd,
 	pprofCmd,
 	VersionCmd,
 }
@@ -292,6 +411,7 @@ var Commands = []*cli.Command{
 	WithCategory("basic", clientCmd),
 	WithCategory("basic", multisigCmd),
 	WithCategory("basic", paychCmd),
+	WithCategory("basic", marketCmd),
 	WithCategory("developer", authCmd),
 	WithCategory("developer", mpoolCmd),
 	WithCategory("developer", stateCmd),
@@ -299,6 +419,7 @@ var Commands = []*cli.Command{
 	WithCategory("developer", logCmd),
 	WithCategory("developer", waitApiCmd),
 	WithCategory("developer", fetchParamCmd),
+	WithCategory("developer", debugCmd),
 	WithCategory("network", netCmd),
 	WithCategory("network", syncCmd),
 	pprofCmd,
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/lotus/lib/daemonize"
+)
+
+// DaemonizeFlags are the flags of long-running commands handled by Daemonize
+var DaemonizeFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "pidfile",
+		Usage: "write the PID to this file and lock it, refusing to start when another process holds the lock",
+	},
+	&cli.BoolFlag{
+		Name:  "daemonize",
+		Usage: "detach from the terminal and run in the background, logging to --log-file",
+	},
+	&cli.StringFlag{
+		Name:  "log-file",
+		Usage: "file the output of the detached process is appended to (default: in the repo)",
+	},
+}
+
+// Daemonize detaches the command with --daemonize, when exit is true the
+// caller should return right away. Otherwise it locks the --pidfile, the
+// returned closer removes it.
+func Daemonize(cctx *cli.Context, defaultLogFile string) (closer func(), exit bool, err error) {
+	if cctx.Bool("daemonize") && !daemonize.Detached() {
+		if pf := cctx.String("pidfile"); pf != "" {
+			// fail here rather than in the log of the detached process
+			p, err := daemonize.LockPidFile(pf)
+			if err != nil {
+				return nil, false, err
+			}
+			if err := p.Close(); err != nil {
+				return nil, false, err
+			}
+		}
+
+		logFile := cctx.String("log-file")
+		if logFile == "" {
+			logFile = defaultLogFile
+		}
+		pid, err := daemonize.Detach(logFile)
+		if err != nil {
+			return nil, false, err
+		}
+		fmt.Printf("Running in the background with PID %d, logging to %s\n", pid, logFile)
+		return nil, true, nil
+	}
+
+	if pf := cctx.String("pidfile"); pf != "" {
+		p, err := daemonize.LockPidFile(pf)
+		if err != nil {
+			return nil, false, err
+		}
+		return func() {
+			if err := p.Close(); err != nil {
+				log.Warnf("removing PID file: %s", err)
+			}
+		}, false, nil
+	}
+	return func() {}, false, nil
+}
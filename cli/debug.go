@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var debugCmd = &cli.Command{
+	Name:  "debug",
+	Usage: "Access debugging data collected by the node",
+	Subcommands: []*cli.Command{
+		debugProfilesCmd,
+		debugTasksCmd,
+		debugReplayCmd,
+	},
+}
+
+var debugTasksCmd = &cli.Command{
+	Name:  "tasks",
+	Usage: "List background tasks with their last success and error",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		tasks, err := api.DebugBackgroundTasks(ctx)
+		if err != nil {
+			return err
+		}
+
+		ago := func(t time.Time) string {
+			if t.IsZero() {
+				return "never"
+			}
+			return time.Since(t).Truncate(time.Second).String() + " ago"
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Name\tState\tRestarts\tLast Success\tLast Error\tError\n")
+		for _, t := range tasks {
+			state := "running"
+			if !t.Running {
+				state = "stopped"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", t.Name, state, t.Restarts, ago(t.LastSuccess), ago(t.LastErrorTime), t.LastError)
+		}
+
+		return w.Flush()
+	},
+}
+
+var debugProfilesCmd = &cli.Command{
+	Name:  "profiles",
+	Usage: "Access profiles periodically captured by the node",
+	Subcommands: []*cli.Command{
+		debugProfilesListCmd,
+		debugProfilesGetCmd,
+	},
+}
+
+var debugProfilesListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List captured profiles",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "kind",
+			Usage: "only list profiles of this kind (cpu, heap, goroutine)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		list, err := api.DebugProfilesList(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Name\tKind\tTime\tSize\n")
+		for _, p := range list {
+			if k := cctx.String("kind"); k != "" && p.Kind != k {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.Kind, p.Time.Format(time.RFC3339), types.SizeStr(types.NewInt(uint64(p.Size))))
+		}
+
+		return w.Flush()
+	},
+}
+
+var debugProfilesGetCmd = &cli.Command{
+	Name:      "get",
+	Usage:     "Download a captured profile, for use with `go tool pprof`",
+	ArgsUsage: "[name]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "output file, defaults to the profile name",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return xerrors.Errorf("expected profile name as the only argument")
+		}
+		name := cctx.Args().First()
+
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		b, err := api.DebugProfileGet(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		out := cctx.String("out")
+		if out == "" {
+			out = name
+		}
+
+		if err := ioutil.WriteFile(out, b, 0644); err != nil {
+			return xerrors.Errorf("writing profile: %w", err)
+		}
+
+		fmt.Println("Wrote", out)
+		return nil
+	},
+}
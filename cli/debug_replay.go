@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/lib/rpctrace"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+var debugReplayCmd = &cli.Command{
+	Name:      "replay",
+	Usage:     "Send API calls recorded in a trace file to the node again",
+	ArgsUsage: "<trace file>",
+	Description: `Calls are recorded to a trace file with API.Trace set in the node config.
+   Replaying them against a test instance, e.g. one pointed at with the
+   *_API_INFO env var, reproduces what a client did, and reports the calls
+   whose results differ from the recorded ones.
+
+   Only read calls are sent, unless --write is set. Calls which had secrets
+   redacted, or which stream data, are skipped.`,
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "method",
+			Usage: "only replay calls to these methods",
+		},
+		&cli.BoolFlag{
+			Name:  "write",
+			Usage: "also replay calls which need write, sign or admin permissions, changing the node's state",
+		},
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "print the results of calls which differ",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return xerrors.Errorf("expected the trace file as the only argument")
+		}
+
+		ti, ok := cctx.App.Metadata["repoType"]
+		if !ok {
+			log.Errorf("unknown repo type, are you sure you want to use GetAPI?")
+			ti = repo.FullNode
+		}
+		t, ok := ti.(repo.RepoType)
+		if !ok {
+			log.Errorf("repoType type does not match the type of repo.RepoType")
+		}
+
+		ainfo, err := GetAPIInfo(cctx, t)
+		if err != nil {
+			return xerrors.Errorf("could not get API info: %w", err)
+		}
+		addr, err := ainfo.HTTPBase()
+		if err != nil {
+			return err
+		}
+		addr += "/rpc/v0"
+
+		f, err := os.Open(cctx.Args().First())
+		if err != nil {
+			return xerrors.Errorf("opening trace file: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+
+		methods := map[string]bool{}
+		for _, m := range cctx.StringSlice("method") {
+			methods[m] = true
+		}
+		perms := methodPerms(t)
+
+		var id, replayed, matched, differed, skipped int
+		err = rpctrace.ReadCalls(ReqContext(cctx), f, func(c *rpctrace.Call) error {
+			id++
+			if len(methods) > 0 && !methods[c.Method] {
+				return nil
+			}
+			if !c.Replayable() {
+				skipped++
+				return nil
+			}
+			if p, ok := perms[c.Method]; !cctx.Bool("write") && (!ok || p != apistruct.PermRead) {
+				skipped++
+				return nil
+			}
+
+			res, rerr, err := replayCall(addr, ainfo.AuthHeader(), id, c)
+			if err != nil {
+				return xerrors.Errorf("replaying call %d (%s): %w", id, c.Method, err)
+			}
+			replayed++
+
+			if (rerr != "") == (c.Error != "") && sameJSON(res, c.Result) {
+				matched++
+				return nil
+			}
+			differed++
+
+			fmt.Printf("#%d %s: differs\n", id, c.Method)
+			if cctx.Bool("verbose") {
+				fmt.Printf("\tparams:   %s\n", mustJSON(c.Params))
+				fmt.Printf("\trecorded: %s%s\n", c.Result, c.Error)
+				fmt.Printf("\treplayed: %s%s\n", res, rerr)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d calls replayed, %d matched, %d differed, %d skipped\n", replayed, matched, differed, skipped)
+		return nil
+	},
+}
+
+// replayCall sends a recorded call to the JSON-RPC endpoint at addr, and
+// returns its result or the error returned by the node
+func replayCall(addr string, header http.Header, id int, c *rpctrace.Call) (json.RawMessage, string, error) {
+	params := c.Params
+	if params == nil {
+		params = []json.RawMessage{}
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  "Filecoin." + c.Method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequest("POST", addr, bytes.NewReader(b))
+	if err != nil {
+		return nil, "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	var out struct {
+		Result json.RawMessage
+		Error  *struct {
+			Message string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, "", xerrors.Errorf("decoding response (status %s): %w", resp.Status, err)
+	}
+	if out.Error != nil {
+		return nil, out.Error.Message, nil
+	}
+	return out.Result, "", nil
+}
+
+// methodPerms returns the permission each API method needs, from the perm
+// tags of the API structs
+func methodPerms(t repo.RepoType) map[string]auth.Permission {
+	structs := []interface{}{&apistruct.CommonStruct{}}
+	switch t {
+	case repo.StorageMiner:
+		structs = append(structs, &apistruct.StorageMinerStruct{})
+	default:
+		structs = append(structs, &apistruct.FullNodeStruct{})
+	}
+
+	perms := map[string]auth.Permission{}
+	for _, s := range structs {
+		it := reflect.ValueOf(s).Elem().FieldByName("Internal").Type()
+		for i := 0; i < it.NumField(); i++ {
+			f := it.Field(i)
+			perms[f.Name] = auth.Permission(f.Tag.Get("perm"))
+		}
+	}
+	return perms
+}
+
+// sameJSON compares two results, ignoring formatting. Redacted results match
+// anything.
+func sameJSON(replayed, recorded json.RawMessage) bool {
+	if string(recorded) == `"`+rpctrace.Redacted+`"` {
+		return true
+	}
+	if len(replayed) == 0 {
+		replayed = json.RawMessage("null")
+	}
+	if len(recorded) == 0 {
+		recorded = json.RawMessage("null")
+	}
+
+	var da, db interface{}
+	if json.Unmarshal(replayed, &da) != nil || json.Unmarshal(recorded, &db) != nil {
+		return bytes.Equal(replayed, recorded)
+	}
+	return reflect.DeepEqual(da, db)
+}
+
+func mustJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
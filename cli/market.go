@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var marketCmd = &cli.Command{
+	Name:  "market",
+	Usage: "Interact with the storage market actor",
+	Subcommands: []*cli.Command{
+		marketFundsCmd,
+	},
+}
+
+var marketFundsCmd = &cli.Command{
+	Name:  "funds",
+	Usage: "Manage market escrow funds",
+	Subcommands: []*cli.Command{
+		marketFundsStatusCmd,
+	},
+}
+
+var marketFundsStatusCmd = &cli.Command{
+	Name:      "status",
+	Usage:     "Show escrow balances and the state of configured escrow policies",
+	ArgsUsage: "[address...]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		policies, err := api.MarketFundsStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Address\tEscrow\tLocked\tAvailable\tPolicy (min/top-up/max)\tLast Action\n")
+
+		for _, p := range policies {
+			last := "-"
+			if p.LastAction != "" {
+				last = fmt.Sprintf("%s (%s ago)", p.LastAction, time.Since(p.LastActionTime).Round(time.Second))
+			}
+			if p.PendingMsg != nil {
+				last += ", pending " + p.PendingMsg.String()
+			}
+			if p.LastErr != "" {
+				last += ", error: " + p.LastErr
+			}
+
+			max := "-"
+			if !p.MaxAvailable.IsZero() {
+				max = types.FIL(p.MaxAvailable).String()
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s/%s/%s\t%s\n", p.Address,
+				types.FIL(p.Escrow), types.FIL(p.Locked), types.FIL(p.Available),
+				types.FIL(p.MinAvailable), types.FIL(p.TopUpTo), max,
+				last)
+		}
+
+		for _, a := range cctx.Args().Slice() {
+			addr, err := address.NewFromString(a)
+			if err != nil {
+				return err
+			}
+
+			bal, err := api.StateMarketBalance(ctx, addr, types.EmptyTSK)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t-\t-\n", addr,
+				types.FIL(bal.Escrow), types.FIL(bal.Locked), types.FIL(big.Sub(bal.Escrow, bal.Locked)))
+		}
+
+		return w.Flush()
+	},
+}
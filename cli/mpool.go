@@ -1,11 +1,14 @@
 package cli
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	stdbig "math/big"
+	"os"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
@@ -13,11 +16,13 @@ import (
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
 
 	lapi "github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/messagepool"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/tablewriter"
 )
 
 var mpoolCmd = &cli.Command{
@@ -32,6 +37,8 @@ var mpoolCmd = &cli.Command{
 		mpoolFindCmd,
 		mpoolConfig,
 		mpoolGasPerfCmd,
+		mpoolGasTrendCmd,
+		mpoolApprovalsCmd,
 	},
 }
 
@@ -619,3 +626,186 @@ var mpoolGasPerfCmd = &cli.Command{
 		return nil
 	},
 }
+
+var mpoolGasTrendCmd = &cli.Command{
+	Name:  "gas-trend",
+	Usage: "Show the recent base fee trend, and whether to send a message now",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "lookback",
+			Usage: "number of epochs of base fee history",
+			Value: 120,
+		},
+		&cli.StringFlag{
+			Name:  "kind",
+			Usage: "message kind to advise on: post, provecommit, precommit or other",
+			Value: "other",
+		},
+		&cli.Int64Flag{
+			Name:  "deadline",
+			Usage: "epoch the message must land before, 0 for none",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		trend, err := api.GasTrend(ctx, abi.ChainEpoch(cctx.Int64("lookback")), 0, types.EmptyTSK)
+		if err != nil {
+			return err
+		}
+		if len(trend.History) > 0 {
+			first, last := trend.History[0], trend.History[len(trend.History)-1]
+			fmt.Printf("Base fee:  %s (epochs %d-%d)\n", types.FIL(last.BaseFee), first.Height, last.Height)
+		}
+		fmt.Printf("Mean:      %s\n", types.FIL(trend.Mean))
+		fmt.Printf("Min/Max:   %s / %s\n", types.FIL(trend.Min), types.FIL(trend.Max))
+		fmt.Printf("Trend:     %+.2f%% per epoch\n", trend.ChangePerEpoch*100)
+
+		adv, err := api.GasShouldSendNow(ctx, cctx.String("kind"), abi.ChainEpoch(cctx.Int64("deadline")), types.EmptyTSK)
+		if err != nil {
+			return err
+		}
+		if adv.SendNow {
+			fmt.Printf("Advice:    send now (%s)\n", adv.Reason)
+		} else {
+			fmt.Printf("Advice:    wait (%s), expecting %s", adv.Reason, types.FIL(adv.ExpectedBaseFee))
+			if adv.ExpectedAt > 0 {
+				fmt.Printf(" by epoch %d", adv.ExpectedAt)
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
+var mpoolApprovalsCmd = &cli.Command{
+	Name:  "approvals",
+	Usage: "Manage messages held for approval (see Approvals in the node config)",
+	Subcommands: []*cli.Command{
+		mpoolApprovalsListCmd,
+		mpoolApprovalsApproveCmd,
+		mpoolApprovalsRejectCmd,
+	},
+}
+
+var mpoolApprovalsListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List messages waiting for approval",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		pending, err := api.MpoolPendingApprovals(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("ID"),
+			tablewriter.Col("From"),
+			tablewriter.Col("To"),
+			tablewriter.Col("Value"),
+			tablewriter.Col("Method"),
+			tablewriter.Col("Requester"),
+			tablewriter.Col("Expires"),
+			tablewriter.NewLineCol("Payload"))
+
+		for _, p := range pending {
+			tw.Write(map[string]interface{}{
+				"ID":        p.ID,
+				"From":      p.Message.From,
+				"To":        p.Message.To,
+				"Value":     types.FIL(p.Message.Value),
+				"Method":    p.Message.Method,
+				"Requester": p.Requester,
+				"Expires":   time.Until(p.Expires).Truncate(time.Second),
+				"Payload":   hex.EncodeToString(p.Payload),
+			})
+		}
+
+		return tw.Flush(os.Stdout)
+	},
+}
+
+var mpoolApprovalsApproveCmd = &cli.Command{
+	Name:      "approve",
+	Usage:     "Approve and push a held message, with an approver signature over its payload (see lotus wallet sign)",
+	ArgsUsage: "[id approverAddress hexSignature]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 3 {
+			return ShowHelp(cctx, xerrors.New("must pass the id of the pending action, the approver address and signature"))
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing id: %w", err)
+		}
+
+		approver, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("parsing approver address: %w", err)
+		}
+
+		sigBytes, err := hex.DecodeString(cctx.Args().Get(2))
+		if err != nil {
+			return xerrors.Errorf("decoding signature: %w", err)
+		}
+
+		var sig crypto.Signature
+		if err := sig.UnmarshalBinary(sigBytes); err != nil {
+			return xerrors.Errorf("decoding signature: %w", err)
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		smsg, err := api.MpoolApprove(ctx, id, approver, &sig)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(smsg.Cid())
+		return nil
+	},
+}
+
+var mpoolApprovalsRejectCmd = &cli.Command{
+	Name:      "reject",
+	Usage:     "Drop a held message",
+	ArgsUsage: "[id]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return ShowHelp(cctx, xerrors.New("must pass the id of the pending action"))
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing id: %w", err)
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return api.MpoolReject(ReqContext(cctx), id)
+	},
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	protocol "github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/multiformats/go-multiaddr"
@@ -34,6 +35,8 @@ var netCmd = &cli.Command{
 		netScores,
 		NetReachability,
 		NetBandwidthCmd,
+		NetStatsCmd,
+		NetBootstrapCmd,
 	},
 }
 
@@ -287,6 +290,27 @@ var NetReachability = &cli.Command{
 		if i.PublicAddr != "" {
 			fmt.Println("Public address: ", i.PublicAddr)
 		}
+
+		printAddrs := func(name string, addrs []string) {
+			fmt.Printf("%s:\n", name)
+			if len(addrs) == 0 {
+				fmt.Println("  none")
+			}
+			for _, a := range addrs {
+				fmt.Printf("  %s\n", a)
+			}
+		}
+		printAddrs("Listen addresses", i.ListenAddrs)
+		printAddrs("Announced addresses", i.AnnouncedAddrs)
+		printAddrs("Port mappings (UPnP / NAT-PMP)", i.PortMappings)
+
+		if i.Reachability == network.ReachabilityPrivate && len(i.PortMappings) == 0 {
+			fmt.Println()
+			fmt.Println("The node doesn't seem to be dialable from the internet, and no port mappings")
+			fmt.Println("were created on the router. Enable UPnP or NAT-PMP on the router, or forward")
+			fmt.Println("the listen port manually and set Libp2p.AnnounceAddresses in the config to")
+			fmt.Println("the public address.")
+		}
 		return nil
 	},
 }
@@ -375,3 +399,171 @@ var NetBandwidthCmd = &cli.Command{
 
 	},
 }
+
+var NetStatsCmd = &cli.Command{
+	Name:  "stats",
+	Usage: "Print connection, stream limit and bandwidth usage",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		st, err := api.NetStats(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Peers:       %d\n", st.Peers)
+		fmt.Printf("Connections: %d (low water %d, high water %d)\n", st.Conns, st.ConnMgrLow, st.ConnMgrHigh)
+		fmt.Printf("Streams:     %d\n", st.Streams)
+		fmt.Printf("Bandwidth:   in %s (%s/s), out %s (%s/s)\n",
+			humanize.Bytes(uint64(st.Bandwidth.TotalIn)), humanize.Bytes(uint64(st.Bandwidth.RateIn)),
+			humanize.Bytes(uint64(st.Bandwidth.TotalOut)), humanize.Bytes(uint64(st.Bandwidth.RateOut)))
+
+		if len(st.StreamLimits) == 0 {
+			return nil
+		}
+
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Protocol\tActive\tLimit\tRejected\n")
+		for _, l := range st.StreamLimits {
+			limit := "-"
+			if l.MaxInbound > 0 {
+				limit = fmt.Sprint(l.MaxInbound)
+			}
+			fmt.Fprintf(tw, "%s*\t%d\t%s\t%d\n", l.Protocol, l.Active, limit, l.Rejected)
+		}
+		return tw.Flush()
+	},
+}
+
+var NetBootstrapCmd = &cli.Command{
+	Name:  "bootstrap",
+	Usage: "Manage the bootstrap peers persisted in the repo",
+	Description: `Persisted bootstrap peers are dialed, together with recently seen miners,
+   when the node has few peers, so it stays connected when the builtin
+   bootstrappers are down.`,
+	Subcommands: []*cli.Command{
+		netBootstrapListCmd,
+		netBootstrapAddCmd,
+		netBootstrapRemoveCmd,
+		netKnownMinersCmd,
+	},
+}
+
+func printAddrInfos(infos []peer.AddrInfo) error {
+	for _, ai := range infos {
+		addrs, err := peer.AddrInfoToP2pAddrs(&ai)
+		if err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			fmt.Println(a)
+		}
+	}
+	return nil
+}
+
+var netBootstrapListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List persisted bootstrap peers",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		infos, err := api.NetBootstrapList(ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		return printAddrInfos(infos)
+	},
+}
+
+var netBootstrapAddCmd = &cli.Command{
+	Name:      "add",
+	Usage:     "Add peers to the bootstrap list",
+	ArgsUsage: "[peerMultiaddr ...]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return xerrors.Errorf("must specify at least one peer multiaddr")
+		}
+
+		pis, err := addrutil.ParseAddresses(ctx, cctx.Args().Slice())
+		if err != nil {
+			return err
+		}
+
+		for _, pi := range pis {
+			if err := api.NetBootstrapAdd(ctx, pi); err != nil {
+				return xerrors.Errorf("adding %s: %w", pi.ID, err)
+			}
+			fmt.Printf("added %s\n", pi.ID)
+		}
+		return nil
+	},
+}
+
+var netBootstrapRemoveCmd = &cli.Command{
+	Name:      "remove",
+	Usage:     "Remove peers from the bootstrap list",
+	ArgsUsage: "[peerId ...]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return xerrors.Errorf("must specify at least one peer ID")
+		}
+
+		for _, s := range cctx.Args().Slice() {
+			pid, err := peer.Decode(s)
+			if err != nil {
+				return xerrors.Errorf("parsing peer ID %q: %w", s, err)
+			}
+			if err := api.NetBootstrapRemove(ctx, pid); err != nil {
+				return err
+			}
+			fmt.Printf("removed %s\n", pid)
+		}
+		return nil
+	},
+}
+
+var netKnownMinersCmd = &cli.Command{
+	Name:  "known-miners",
+	Usage: "List miners learned through peer exchange",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		infos, err := api.NetKnownMiners(ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		return printAddrInfos(infos)
+	},
+}
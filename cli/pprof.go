@@ -9,7 +9,6 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/lotus/node/repo"
-	manet "github.com/multiformats/go-multiaddr/net"
 )
 
 var pprofCmd = &cli.Command{
@@ -23,6 +22,12 @@ var pprofCmd = &cli.Command{
 var PprofGoroutines = &cli.Command{
 	Name:  "goroutines",
 	Usage: "Get goroutine stacks",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "addr",
+			Usage: "address of a separate pprof listener, like 127.0.0.1:6060",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		ti, ok := cctx.App.Metadata["repoType"]
 		if !ok {
@@ -37,17 +42,29 @@ var PprofGoroutines = &cli.Command{
 		if err != nil {
 			return xerrors.Errorf("could not get API info: %w", err)
 		}
-		_, addr, err := manet.DialArgs(ainfo.Addr)
+		addr, err := ainfo.HTTPBase()
 		if err != nil {
 			return err
 		}
+		if cctx.IsSet("addr") {
+			addr = "http://" + cctx.String("addr")
+		}
+		addr += "/debug/pprof/goroutine?debug=2"
 
-		addr = "http://" + addr + "/debug/pprof/goroutine?debug=2"
+		req, err := http.NewRequest("GET", addr, nil)
+		if err != nil {
+			return err
+		}
+		req.Header = ainfo.AuthHeader()
 
-		r, err := http.Get(addr) //nolint:gosec
+		r, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return err
 		}
+		if r.StatusCode != http.StatusOK {
+			_ = r.Body.Close()
+			return xerrors.Errorf("getting goroutines: %s", r.Status)
+		}
 
 		if _, err := io.Copy(os.Stdout, r.Body); err != nil {
 			return err
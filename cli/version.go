@@ -1,9 +1,15 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
 )
 
 var VersionCmd = &cli.Command{
@@ -17,16 +23,90 @@ var VersionCmd = &cli.Command{
 		defer closer()
 
 		ctx := ReqContext(cctx)
-		// TODO: print more useful things
 
 		v, err := api.Version(ctx)
 		if err != nil {
 			return err
 		}
-		fmt.Println("Daemon: ", v)
+
+		if !v.Supports(build.FeatureBuildInfo) {
+			fmt.Println("Daemon: ", v)
+		} else {
+			bi, err := api.BuildInfo(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Daemon: ", bi.Version+"+api"+bi.APIVersion.String())
+			if bi.BuildTime != "" {
+				fmt.Println("Built:  ", bi.BuildTime)
+			}
+			fmt.Println("Features:", strings.Join(bi.Features, ", "))
+			fmt.Println("API features:", strings.Join(v.APIFeatures, ", "))
+			fmt.Printf("Network: %s (genesis %s)\n", bi.Network, bi.Genesis)
+		}
 
 		fmt.Print("Local: ")
 		cli.VersionPrinter(cctx)
 		return nil
 	},
 }
+
+// RequireAPIFeature checks that the remote node supports an API feature, for
+// commands using methods the node may not have
+func RequireAPIFeature(ctx context.Context, remote api.Common, feature string) error {
+	v, err := remote.Version(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting remote API version: %w", err)
+	}
+	if !v.Supports(feature) {
+		return xerrors.Errorf("remote node (%s) doesn't support %s, it may need an upgrade", v, feature)
+	}
+	return nil
+}
+
+// CheckRemoteBuild checks the network of a remote node with CheckRemoteNetwork.
+// Nodes without the build-info feature predate BuildInfo, so their network
+// isn't checked.
+func CheckRemoteBuild(ctx context.Context, remote api.Common) error {
+	v, err := remote.Version(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting remote API version: %w", err)
+	}
+	if !v.Supports(build.FeatureBuildInfo) {
+		log.Warnf("remote node (%s) doesn't report its build, not checking its network", v)
+		return nil
+	}
+
+	bi, err := remote.BuildInfo(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting remote build info: %w", err)
+	}
+	return CheckRemoteNetwork(bi)
+}
+
+// CheckRemoteNetwork checks that the remote node is on the network this
+// binary was built for. The genesis is only compared for builds of the
+// default network, other networks are usually started with a custom genesis.
+func CheckRemoteNetwork(remote api.BuildInfo) error {
+	params, err := build.ProofParamVersions()
+	if err != nil {
+		return err
+	}
+
+	local := api.BuildInfo{
+		BuildType:   build.BuildTypeName(),
+		ProofParams: params,
+		BlockDelay:  build.BlockDelaySecs,
+	}
+	if local.BuildType == "" {
+		local.Genesis, err = build.BuiltinGenesisCid()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := local.CheckNetwork(remote); err != nil {
+		return xerrors.Errorf("remote node is on a different network: %w", err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
@@ -226,6 +227,16 @@ var walletExport = &cli.Command{
 	Name:      "export",
 	Usage:     "export keys",
 	ArgsUsage: "[address]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "encrypted",
+			Usage: "export as a passphrase protected key file (Web3 Secret Storage), import with '--format encrypted'",
+		},
+		&cli.StringFlag{
+			Name:  "passphrase-file",
+			Usage: "read the passphrase from a file instead of the terminal",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		api, closer, err := GetFullNodeAPI(cctx)
 		if err != nil {
@@ -248,6 +259,21 @@ var walletExport = &cli.Command{
 			return err
 		}
 
+		if cctx.Bool("encrypted") {
+			pass, err := readPassphrase(cctx, true)
+			if err != nil {
+				return err
+			}
+
+			b, err := wallet.EncryptKey(ki, pass)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(b))
+			return nil
+		}
+
 		b, err := json.Marshal(ki)
 		if err != nil {
 			return err
@@ -265,9 +291,13 @@ var walletImport = &cli.Command{
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "format",
-			Usage: "specify input format for key",
+			Usage: "specify input format for key: hex-lotus, json-lotus, gfc-json or encrypted",
 			Value: "hex-lotus",
 		},
+		&cli.StringFlag{
+			Name:  "passphrase-file",
+			Usage: "read the passphrase of an encrypted key from a file instead of the terminal",
+		},
 		&cli.BoolFlag{
 			Name:  "as-default",
 			Usage: "import the given key as your new default key",
@@ -282,7 +312,14 @@ var walletImport = &cli.Command{
 		ctx := ReqContext(cctx)
 
 		var inpdata []byte
-		if !cctx.Args().Present() || cctx.Args().First() == "-" {
+		if (!cctx.Args().Present() || cctx.Args().First() == "-") && cctx.String("format") == "encrypted" {
+			// key files span multiple lines
+			indata, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			inpdata = indata
+		} else if !cctx.Args().Present() || cctx.Args().First() == "-" {
 			reader := bufio.NewReader(os.Stdin)
 			fmt.Print("Enter private key: ")
 			indata, err := reader.ReadBytes('\n')
@@ -314,6 +351,17 @@ var walletImport = &cli.Command{
 			if err := json.Unmarshal(inpdata, &ki); err != nil {
 				return err
 			}
+		case "encrypted":
+			pass, err := readPassphrase(cctx, false)
+			if err != nil {
+				return err
+			}
+
+			dk, err := wallet.DecryptKey(inpdata, pass)
+			if err != nil {
+				return err
+			}
+			ki = *dk
 		case "gfc-json":
 			var f struct {
 				KeyInfo []struct {
@@ -355,6 +403,47 @@ var walletImport = &cli.Command{
 	},
 }
 
+// readPassphrase reads a key file passphrase from --passphrase-file, or
+// prompts for it on the terminal, twice with confirm
+func readPassphrase(cctx *cli.Context, confirm bool) (string, error) {
+	if f := cctx.String("passphrase-file"); f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", xerrors.Errorf("reading passphrase file: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", xerrors.New("stdin is not a terminal, use --passphrase-file")
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	pass, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", xerrors.New("empty passphrase")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(pass) {
+			return "", xerrors.New("passphrases don't match")
+		}
+	}
+
+	return string(pass), nil
+}
+
 var walletSign = &cli.Command{
 	Name:      "sign",
 	Usage:     "sign a message",
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/lib/lotuslog"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/repo"
+	"github.com/filecoin-project/lotus/storage/pledger"
+)
+
+var log = logging.Logger("main")
+
+func main() {
+	lotuslog.SetupLogLevels()
+
+	local := []*cli.Command{
+		runCmd,
+		checkCmd,
+	}
+
+	app := &cli.App{
+		Name:  "lotus-pledge-controller",
+		Usage: "Pledge committed capacity sectors to keep the workers of a miner busy",
+		Description: `The controller only uses the miner API, so it can run anywhere the API is
+   reachable, and be restarted or reconfigured without touching the miner.
+   It replaces 'lotus-miner run --pledge-sector', which must be off.`,
+		Version: build.UserVersion(),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "miner-repo",
+				Aliases: []string{"storagerepo"},
+				EnvVars: []string{"LOTUS_MINER_PATH", "LOTUS_STORAGE_PATH"},
+				Value:   "~/.lotusminer", // TODO: Consider XDG_DATA_HOME
+				Usage:   "miner repo path, used to find the miner API unless MINER_API_INFO is set",
+			},
+		},
+
+		Commands: local,
+	}
+	app.Setup()
+	app.Metadata["repoType"] = repo.StorageMiner
+
+	if err := app.Run(os.Args); err != nil {
+		log.Warnf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+var runCmd = &cli.Command{
+	Name:  "run",
+	Usage: "Start the controller, SIGHUP reloads the policy file",
+	Flags: policyFlags,
+	Action: func(cctx *cli.Context) error {
+		minerapi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := checkMinerLoop(ctx, minerapi); err != nil {
+			return err
+		}
+
+		policy, err := loadPolicy(cctx)
+		if err != nil {
+			return err
+		}
+		log.Infow("starting pledge controller", "policy", policy)
+
+		var lk sync.Mutex
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		defer signal.Stop(sighup)
+		go func() {
+			for range sighup {
+				p, err := loadPolicy(cctx)
+				if err != nil {
+					log.Errorf("reloading the policy, keeping the current one: %s", err)
+					continue
+				}
+				lk.Lock()
+				policy = p
+				lk.Unlock()
+				log.Infow("reloaded policy", "policy", p)
+			}
+		}()
+
+		pl := pledger.New(minerapi, &minerState{ctx: ctx, api: minerapi}, func() pledger.Policy {
+			lk.Lock()
+			defer lk.Unlock()
+			return policy
+		})
+
+		crash.Run(ctx, "pledge-controller", pl.Run)
+		return nil
+	},
+}
+
+var checkCmd = &cli.Command{
+	Name:  "check",
+	Usage: "Print whether the policy would pledge a sector now, without pledging",
+	Flags: policyFlags,
+	Action: func(cctx *cli.Context) error {
+		minerapi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		policy, err := loadPolicy(cctx)
+		if err != nil {
+			return err
+		}
+
+		pl := pledger.New(minerapi, new(dtypes.PledgeControl), func() pledger.Policy {
+			return policy
+		})
+		reason, err := pl.Check(lcli.ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		if reason != "" {
+			fmt.Println("Not pledging:", reason)
+			return nil
+		}
+		fmt.Println("Would pledge a sector")
+		return nil
+	},
+}
+
+// minerState reads the pause state from the miner on every check, so
+// 'lotus-miner sectors pledge pause' applies to the controller too
+type minerState struct {
+	ctx context.Context
+	api api.StorageMiner
+}
+
+// Paused also holds off while the miner runs its own pledge loop, e.g. after
+// it was restarted with --pledge-sector
+func (s *minerState) Paused() bool {
+	st, err := s.api.PledgeStatus(s.ctx)
+	if err != nil {
+		log.Errorf("not pledging, getting pledge status of the miner: %s", err)
+		return true
+	}
+	if st.Running {
+		log.Error("not pledging, the miner runs its own pledge loop")
+		return true
+	}
+	return st.Paused
+}
+
+func (s *minerState) Pledged() {}
+
+func (s *minerState) Skipped(string) {}
+
+// checkMinerLoop refuses to run next to the pledge loop of the miner, which
+// would pledge sectors for the same idle workers
+func checkMinerLoop(ctx context.Context, minerapi api.StorageMiner) error {
+	st, err := minerapi.PledgeStatus(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting pledge status of the miner: %w", err)
+	}
+	if st.Running {
+		return xerrors.New("the miner runs its own pledge loop, restart it without --pledge-sector (Startup.PledgeSector) first")
+	}
+	return nil
+}
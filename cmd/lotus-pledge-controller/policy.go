@@ -0,0 +1,129 @@
+package main
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/docker/go-units"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/storage/pledger"
+)
+
+// policyFile is the TOML policy file of --policy, flags override its settings
+type policyFile struct {
+	Interval       config.Duration
+	ReserveWorkers int
+	MaxSectors     uint64
+	MinFree        string
+	MaxSealing     int
+	MaxPerHour     int
+	Hours          string
+	IgnoreDeals    bool
+}
+
+var policyFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "policy",
+		Usage: "TOML file with the policy settings, named like the flags in CamelCase, e.g. MaxSealing",
+	},
+	&cli.DurationFlag{
+		Name:  "interval",
+		Usage: "how often to check for idle workers (default 30s)",
+	},
+	&cli.IntFlag{
+		Name:  "reserve-workers",
+		Usage: "number of idle workers to keep free for deals",
+	},
+	&cli.Uint64Flag{
+		Name:  "max-sectors",
+		Usage: "stop pledging once the miner has this many sectors",
+	},
+	&cli.StringFlag{
+		Name:  "min-free",
+		Usage: "stop pledging when sector storage has less free space than this, e.g. 1TiB",
+	},
+	&cli.IntFlag{
+		Name:  "max-sealing",
+		Usage: "don't pledge while this many sectors are sealing, deal sectors included",
+	},
+	&cli.IntFlag{
+		Name:  "max-per-hour",
+		Usage: "pledge at most this many sectors an hour",
+	},
+	&cli.StringFlag{
+		Name:  "hours",
+		Usage: "only pledge in this daily window of local time, e.g. 22:00-06:00",
+	},
+	&cli.BoolFlag{
+		Name:  "ignore-deals",
+		Usage: "pledge even while deal data waits for workers",
+	},
+}
+
+// loadPolicy reads the policy file, if any, and applies the flags
+func loadPolicy(cctx *cli.Context) (pledger.Policy, error) {
+	var pf policyFile
+	if cctx.IsSet("policy") {
+		path, err := homedir.Expand(cctx.String("policy"))
+		if err != nil {
+			return pledger.Policy{}, err
+		}
+		if _, err := toml.DecodeFile(path, &pf); err != nil {
+			return pledger.Policy{}, xerrors.Errorf("reading policy file: %w", err)
+		}
+	}
+
+	if cctx.IsSet("interval") {
+		pf.Interval = config.Duration(cctx.Duration("interval"))
+	}
+	if cctx.IsSet("reserve-workers") {
+		pf.ReserveWorkers = cctx.Int("reserve-workers")
+	}
+	if cctx.IsSet("max-sectors") {
+		pf.MaxSectors = cctx.Uint64("max-sectors")
+	}
+	if cctx.IsSet("min-free") {
+		pf.MinFree = cctx.String("min-free")
+	}
+	if cctx.IsSet("max-sealing") {
+		pf.MaxSealing = cctx.Int("max-sealing")
+	}
+	if cctx.IsSet("max-per-hour") {
+		pf.MaxPerHour = cctx.Int("max-per-hour")
+	}
+	if cctx.IsSet("hours") {
+		pf.Hours = cctx.String("hours")
+	}
+	if cctx.IsSet("ignore-deals") {
+		pf.IgnoreDeals = cctx.Bool("ignore-deals")
+	}
+
+	p := pledger.Policy{
+		Interval:       pledger.DefaultInterval,
+		ReserveWorkers: pf.ReserveWorkers,
+		MaxSectors:     pf.MaxSectors,
+		MaxSealing:     pf.MaxSealing,
+		MaxPerHour:     pf.MaxPerHour,
+		IgnoreDeals:    pf.IgnoreDeals,
+	}
+	if pf.Interval > 0 {
+		p.Interval = time.Duration(pf.Interval)
+	}
+	if pf.MinFree != "" {
+		v, err := units.RAMInBytes(pf.MinFree)
+		if err != nil {
+			return pledger.Policy{}, xerrors.Errorf("parsing MinFree: %w", err)
+		}
+		p.MinFree = v
+	}
+
+	var err error
+	if p.Hours, err = pledger.ParseWindow(pf.Hours); err != nil {
+		return pledger.Policy{}, xerrors.Errorf("parsing Hours: %w", err)
+	}
+	return p, nil
+}
@@ -34,6 +34,8 @@ import (
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/lib/lotuslog"
 	"github.com/filecoin-project/lotus/lib/rpcenc"
+	"github.com/filecoin-project/lotus/lib/tailbuf"
+	"github.com/filecoin-project/lotus/metrics"
 	"github.com/filecoin-project/lotus/node/repo"
 )
 
@@ -44,6 +46,9 @@ const FlagWorkerRepo = "worker-repo"
 // TODO remove after deprecation period
 const FlagWorkerRepoDeprecation = "workerrepo"
 
+// stderrTail is how much stderr output is kept for task forensics
+const stderrTail = 16 << 10
+
 func main() {
 	build.RunningNodeType = build.NodeWorker
 
@@ -129,11 +134,28 @@ var runCmd = &cli.Command{
 			Usage: "enable precommit2 (32G sectors: all cores, 96GiB Memory)",
 			Value: true,
 		},
+		&cli.BoolFlag{
+			Name:  "params-from-miner",
+			Usage: "fetch missing proof parameters from the miner before falling back to the public gateway",
+		},
 		&cli.BoolFlag{
 			Name:  "commit",
 			Usage: "enable commit (32G sectors: all cores or GPUs, 128GiB Memory + 64GiB swap)",
 			Value: true,
 		},
+		&cli.BoolFlag{
+			Name:  "energy-metering",
+			Usage: "record the energy used by sealing tasks (needs readable RAPL counters or nvidia-smi)",
+		},
+		&cli.BoolFlag{
+			Name:  "capture-stderr",
+			Usage: "keep the tail of stderr, where the proofs library logs, to attach to the forensics of failed tasks; stderr is piped through the worker, which still writes it to the original stderr",
+		},
+		&cli.BoolFlag{
+			Name:  "autotune",
+			Usage: "use the tuning settings applied on the miner with 'lotus-miner autotune apply', variables set in the environment take precedence",
+			Value: true,
+		},
 		&cli.IntFlag{
 			Name:  "parallel-fetch-limit",
 			Usage: "maximum fetch operations to run in parallel",
@@ -144,6 +166,11 @@ var runCmd = &cli.Command{
 			Usage: "used when 'listen' is unspecified. must be a valid duration recognized by golang's time.ParseDuration function",
 			Value: "30m",
 		},
+		&cli.DurationFlag{
+			Name:  "api-slow-call",
+			Usage: "log API calls taking longer than this with their parameters, 0 disables the log",
+			Value: 10 * time.Second,
+		},
 	},
 	Before: func(cctx *cli.Context) error {
 		if cctx.IsSet("address") {
@@ -189,13 +216,22 @@ var runCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
-		if v.APIVersion != build.MinerAPIVersion {
-			return xerrors.Errorf("lotus-miner API version doesn't match: expected: %s", api.Version{APIVersion: build.MinerAPIVersion})
+		if err := v.CheckCompatible(build.MinerAPIVersion); err != nil {
+			return xerrors.Errorf("lotus-miner API isn't compatible: %w", err)
+		}
+		if err := lcli.CheckRemoteBuild(ctx, nodeApi); err != nil {
+			return xerrors.Errorf("checking lotus-miner: %w", err)
 		}
 		log.Infof("Remote version %s", v)
 
 		watchMinerConn(ctx, cctx, nodeApi)
 
+		if cctx.Bool("autotune") && v.Supports(build.FeatureAutotune) {
+			if err := applyTuning(ctx, nodeApi); err != nil {
+				log.Warnf("applying tuning settings from the miner: %s", err)
+			}
+		}
+
 		// Check params
 
 		act, err := nodeApi.ActorAddress(ctx)
@@ -208,6 +244,11 @@ var runCmd = &cli.Command{
 		}
 
 		if cctx.Bool("commit") {
+			if cctx.Bool("params-from-miner") {
+				if err := fetchParamsFromMiner(ctx, cctx, uint64(ssize)); err != nil {
+					log.Warnf("fetching params from the miner: %s", err)
+				}
+			}
 			if err := paramfetch.GetParams(ctx, build.ParametersJSON(), uint64(ssize)); err != nil {
 				return xerrors.Errorf("get params: %w", err)
 			}
@@ -342,10 +383,22 @@ var runCmd = &cli.Command{
 
 		// Create / expose the worker
 
+		var stderr func() string
+		if cctx.Bool("capture-stderr") {
+			tail := tailbuf.New(stderrTail)
+			if err := tailbuf.CaptureStderr(tail); err != nil {
+				log.Warnf("not capturing stderr: %s", err)
+			} else {
+				stderr = tail.String
+			}
+		}
+
 		workerApi := &worker{
 			LocalWorker: sectorstorage.NewLocalWorker(sectorstorage.WorkerConfig{
-				SealProof: spt,
-				TaskTypes: taskTypes,
+				SealProof:      spt,
+				TaskTypes:      taskTypes,
+				EnergyMetering: cctx.Bool("energy-metering"),
+				Stderr:         stderr,
 			}, remote, localStore, nodeApi),
 			localStore: localStore,
 			ls:         lr,
@@ -357,7 +410,7 @@ var runCmd = &cli.Command{
 
 		readerHandler, readerServerOpt := rpcenc.ReaderParamDecoder()
 		rpcServer := jsonrpc.NewServer(readerServerOpt)
-		rpcServer.Register("Filecoin", apistruct.PermissionedWorkerAPI(workerApi))
+		rpcServer.Register("Filecoin", apistruct.PermissionedWorkerAPI(metrics.MetricedWorkerAPI(workerApi, cctx.Duration("api-slow-call"))))
 
 		mux.Handle("/rpc/v0", rpcServer)
 		mux.Handle("/rpc/streams/v0/push/{uuid}", readerHandler)
@@ -370,7 +423,7 @@ var runCmd = &cli.Command{
 		}
 
 		srv := &http.Server{
-			Handler: ah,
+			Handler: &metrics.CallerHandler{Next: ah},
 			BaseContext: func(listener net.Listener) context.Context {
 				return ctx
 			},
@@ -419,7 +472,23 @@ var runCmd = &cli.Command{
 		log.Info("Waiting for tasks")
 
 		go func() {
-			if err := nodeApi.WorkerConnect(ctx, "ws://"+address+"/rpc/v0"); err != nil {
+			url := "ws://" + address + "/rpc/v0"
+			if v.Supports(build.FeatureWorkerRegister) {
+				id, err := register(ctx, nodeApi, workerApi, lr.Path(), url)
+				if err != nil {
+					log.Errorf("Registering worker failed: %+v", err)
+					cancel()
+					return
+				}
+
+				if err := nodeApi.WorkerConnectRegistered(ctx, id); err != nil {
+					log.Errorf("Registering worker failed: %+v", err)
+					cancel()
+				}
+				return
+			}
+
+			if err := nodeApi.WorkerConnect(ctx, url); err != nil {
 				log.Errorf("Registering worker failed: %+v", err)
 				cancel()
 				return
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/paramcache"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+// fetchParamsFromMiner copies the proof parameters the worker is missing from
+// the /remote/params endpoint of the miner
+func fetchParamsFromMiner(ctx context.Context, cctx *cli.Context, ssize uint64) error {
+	ainfo, err := lcli.GetAPIInfo(cctx, repo.StorageMiner)
+	if err != nil {
+		return xerrors.Errorf("could not get miner API info: %w", err)
+	}
+
+	addr, err := ainfo.HTTPBase()
+	if err != nil {
+		return err
+	}
+
+	return paramcache.Fetch(ctx, addr+"/remote/params", ainfo.AuthHeader(), build.ParametersJSON(), paramcache.Dir(), ssize)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// registerInterval is how often a pending worker asks the miner whether it's
+// accepted
+const registerInterval = 15 * time.Second
+
+// register announces the worker to the miner, and waits until it's accepted.
+// It returns the registration ID the worker connects with.
+func register(ctx context.Context, nodeApi api.StorageMiner, w *worker, repoPath, url string) (string, error) {
+	id, err := workerID(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := w.Info(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("getting worker info: %w", err)
+	}
+	tt, err := w.TaskTypes(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("getting task types: %w", err)
+	}
+	paths, err := w.Paths(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("getting storage paths: %w", err)
+	}
+
+	reg := api.WorkerRegistration{
+		ID:        id,
+		Hostname:  info.Hostname,
+		URL:       url,
+		Resources: info.Resources,
+	}
+	for t := range tt {
+		reg.Tasks = append(reg.Tasks, t)
+	}
+	sort.Slice(reg.Tasks, func(i, j int) bool {
+		return reg.Tasks[i].Less(reg.Tasks[j])
+	})
+	for _, p := range paths {
+		reg.Paths = append(reg.Paths, p.LocalPath)
+	}
+
+	logged := false
+	for {
+		st, err := nodeApi.WorkerRegister(ctx, reg)
+		if err != nil {
+			return "", xerrors.Errorf("registering with the miner: %w", err)
+		}
+
+		switch st {
+		case api.WorkerRegAccepted:
+			return id, nil
+		case api.WorkerRegDenied:
+			return "", xerrors.Errorf("the miner denied worker %s", id)
+		}
+
+		if !logged {
+			log.Warnf("Waiting for approval, run 'lotus-miner sealing registrations accept %s' on the miner", id)
+			logged = true
+		}
+
+		select {
+		case <-time.After(registerInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// workerID returns the registration ID of the worker, kept in its repo
+func workerID(repoPath string) (string, error) {
+	path := filepath.Join(repoPath, "worker-id")
+
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(b)), nil
+	case !os.IsNotExist(err):
+		return "", xerrors.Errorf("reading worker ID: %w", err)
+	}
+
+	id := uuid.New().String()
+	if err := ioutil.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", xerrors.Errorf("saving worker ID: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/storage/autotune"
+)
+
+// applyTuning sets the tuning settings applied on the miner for this host in
+// the environment, before the proofs library reads them
+func applyTuning(ctx context.Context, nodeApi api.StorageMiner) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	tuning, err := nodeApi.SealingTuning(ctx, hostname)
+	if err != nil {
+		return xerrors.Errorf("getting tuning settings: %w", err)
+	}
+	return autotune.SetEnv(tuning)
+}
@@ -13,7 +13,6 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
-	"github.com/filecoin-project/go-state-types/big"
 
 	"github.com/filecoin-project/specs-actors/actors/builtin"
 	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
@@ -33,6 +32,9 @@ var actorCmd = &cli.Command{
 		actorWithdrawCmd,
 		actorSetPeeridCmd,
 		actorControl,
+		actorChangeWorker,
+		actorKeyChange,
+		actorSweep,
 	},
 }
 
@@ -368,12 +370,12 @@ var actorControlList = &cli.Command{
 
 var actorControlSet = &cli.Command{
 	Name:      "set",
-	Usage:     "Set control address(-es)",
+	Usage:     "Propose setting control address(-es), see 'actor key-change'",
 	ArgsUsage: "[...address]",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
 			Name:  "really-do-it",
-			Usage: "Actually send transaction performing the action",
+			Usage: "Actually propose the change",
 			Value: false,
 		},
 	},
@@ -447,33 +449,16 @@ var actorControlSet = &cli.Command{
 		}
 
 		if !cctx.Bool("really-do-it") {
-			fmt.Println("Pass --really-do-it to actually execute this action")
+			fmt.Println("Pass --really-do-it to actually propose this change")
 			return nil
 		}
 
-		cwp := &miner0.ChangeWorkerAddressParams{
-			NewWorker:       mi.Worker,
-			NewControlAddrs: toSet,
-		}
-
-		sp, err := actors.SerializeParams(cwp)
-		if err != nil {
-			return xerrors.Errorf("serializing params: %w", err)
-		}
-
-		smsg, err := api.MpoolPushMessage(ctx, &types.Message{
-			From:   mi.Owner,
-			To:     maddr,
-			Method: builtin.MethodsMiner.ChangeWorkerAddress,
-
-			Value:  big.Zero(),
-			Params: sp,
-		}, nil)
+		p, err := nodeApi.ActorKeyChangePropose(ctx, mi.Worker, toSet)
 		if err != nil {
-			return xerrors.Errorf("mpool push: %w", err)
+			return xerrors.Errorf("proposing change: %w", err)
 		}
 
-		fmt.Println("Message CID:", smsg.Cid())
+		printKeyChangeNext(p)
 
 		return nil
 	},
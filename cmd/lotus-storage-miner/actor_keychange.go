@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var actorChangeWorker = &cli.Command{
+	Name:      "change-worker",
+	Usage:     "Propose changing the worker address, see 'actor key-change'",
+	ArgsUsage: "[address]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "Actually propose the change",
+			Value: false,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return xerrors.Errorf("expected one argument: new worker address")
+		}
+
+		na, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return xerrors.Errorf("parsing address: %w", err)
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		api, acloser, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer acloser()
+
+		ctx := lcli.ReqContext(cctx)
+
+		maddr, err := nodeApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+
+		mi, err := api.StateMinerInfo(ctx, maddr, types.EmptyTSK)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Worker: %s -> %s\n", mi.Worker, na)
+
+		if !cctx.Bool("really-do-it") {
+			fmt.Println("Pass --really-do-it to actually propose this change")
+			return nil
+		}
+
+		// control addresses are kept as they are
+		p, err := nodeApi.ActorKeyChangePropose(ctx, na, mi.ControlAddresses)
+		if err != nil {
+			return xerrors.Errorf("proposing change: %w", err)
+		}
+
+		printKeyChangeNext(p)
+
+		return nil
+	},
+}
+
+func printKeyChangeNext(p api.KeyChangeProposal) {
+	if p.Message != nil {
+		fmt.Printf("Sent key change %d in message %s, no approvers or timelock are configured\n", p.ID, *p.Message)
+		return
+	}
+
+	fmt.Printf("Proposed key change %d, executable after %s\n", p.ID, p.ExecuteAfter.Format(time.RFC3339))
+	fmt.Println("If KeyChange.Approvers are configured, sign the approval payload with an approver key on a separate machine:")
+	fmt.Printf("  lotus wallet sign <approver> %s\n", hex.EncodeToString(p.Payload))
+	fmt.Printf("and run 'lotus-miner actor key-change approve %d <approver> <signature>'\n", p.ID)
+	fmt.Printf("Then run 'lotus-miner actor key-change execute %d' after the timelock\n", p.ID)
+}
+
+var actorKeyChange = &cli.Command{
+	Name:  "key-change",
+	Usage: "Manage timelocked worker and control address changes",
+	Description: `Worker and control address changes are proposed with 'actor change-worker'
+   and 'actor control set'. A proposal is only sent to the chain after the
+   KeyChange.Timelock from the miner config has passed, and after it was
+   signed by one of the KeyChange.Approvers keys, if any are set. Without
+   approvers and with a zero timelock, changes are sent right away.`,
+	Subcommands: []*cli.Command{
+		actorKeyChangeList,
+		actorKeyChangeApprove,
+		actorKeyChangeExecute,
+		actorKeyChangeCancel,
+	},
+}
+
+var actorKeyChangeList = &cli.Command{
+	Name:  "list",
+	Usage: "List key change proposals",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "print approval payloads",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		props, err := nodeApi.ActorKeyChangeList(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tWorker\tControl\tProposed\tExecute After\tStatus\n")
+
+		for _, p := range props {
+			status := "waiting for approval"
+			switch {
+			case p.Cancelled:
+				status = "cancelled"
+			case p.Message != nil:
+				status = "executed in " + p.Message.String()
+			case p.Approver != nil && time.Now().Before(p.ExecuteAfter):
+				status = "approved by " + p.Approver.String() + ", timelocked"
+			case p.Approver != nil:
+				status = "approved by " + p.Approver.String() + ", ready"
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%v\t%s\t%s\t%s\n", p.ID, p.NewWorker, p.NewControlAddrs,
+				p.Proposed.Format(time.RFC3339), p.ExecuteAfter.Format(time.RFC3339), status)
+			if cctx.Bool("verbose") {
+				fmt.Fprintf(w, "\tpayload: %s\n", hex.EncodeToString(p.Payload))
+			}
+		}
+
+		return w.Flush()
+	},
+}
+
+var actorKeyChangeApprove = &cli.Command{
+	Name:      "approve",
+	Usage:     "Record an approver signature for a key change proposal",
+	ArgsUsage: "[id approverAddress hexSignature]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 3 {
+			return xerrors.Errorf("expected 3 arguments: proposal ID, approver address and signature")
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().Get(0), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing proposal ID: %w", err)
+		}
+
+		approver, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("parsing approver address: %w", err)
+		}
+
+		sigBytes, err := hex.DecodeString(cctx.Args().Get(2))
+		if err != nil {
+			return xerrors.Errorf("decoding signature: %w", err)
+		}
+
+		var sig crypto.Signature
+		if err := sig.UnmarshalBinary(sigBytes); err != nil {
+			return xerrors.Errorf("decoding signature: %w", err)
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		p, err := nodeApi.ActorKeyChangeApprove(ctx, id, approver, &sig)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Key change %d approved, executable after %s\n", p.ID, p.ExecuteAfter.Format(time.RFC3339))
+		return nil
+	},
+}
+
+var actorKeyChangeExecute = &cli.Command{
+	Name:      "execute",
+	Usage:     "Send an approved key change past its timelock to the chain",
+	ArgsUsage: "[id]",
+	Action: func(cctx *cli.Context) error {
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing proposal ID: %w", err)
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		mcid, err := nodeApi.ActorKeyChangeExecute(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Message CID:", mcid)
+		return nil
+	},
+}
+
+var actorKeyChangeCancel = &cli.Command{
+	Name:      "cancel",
+	Usage:     "Cancel a pending key change proposal",
+	ArgsUsage: "[id]",
+	Action: func(cctx *cli.Context) error {
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing proposal ID: %w", err)
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return nodeApi.ActorKeyChangeCancel(lcli.ReqContext(cctx), id)
+	},
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var actorSweep = &cli.Command{
+	Name:  "sweep",
+	Usage: "Move rewards above the configured floats to the cold address",
+	Description: `Sweeps are configured in the Sweep section of the miner config. Scheduled
+   sweeps run every Sweep.Interval once Sweep.ColdAddress is set. Every sweep,
+   including dry runs and ones rejected by Sweep.ApprovalHook, is recorded in the
+   history.`,
+	Subcommands: []*cli.Command{
+		actorSweepRun,
+		actorSweepHistory,
+	},
+}
+
+var actorSweepRun = &cli.Command{
+	Name:  "run",
+	Usage: "Sweep now",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only print and record the planned transfers",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		rec, err := nodeApi.ActorSweep(ctx, cctx.Bool("dry-run"))
+		if err != nil {
+			return err
+		}
+
+		printSweep(rec)
+		return nil
+	},
+}
+
+var actorSweepHistory = &cli.Command{
+	Name:  "history",
+	Usage: "List recorded sweeps",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		recs, err := nodeApi.ActorSweepHistory(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ID\tTime\tTransfers\tTotal\tStatus")
+		for _, rec := range recs {
+			total := types.NewInt(0)
+			for _, t := range rec.Transfers {
+				if t.Kind == api.SweepSend {
+					total = types.BigAdd(total, t.Amount)
+				}
+			}
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", rec.ID, rec.Time.Format("2006-01-02 15:04:05"), len(rec.Transfers), types.FIL(total), sweepStatus(rec))
+		}
+		return tw.Flush()
+	},
+}
+
+func sweepStatus(rec api.SweepRecord) string {
+	switch {
+	case !rec.Approved:
+		return "rejected: " + rec.Error
+	case rec.Error != "":
+		return "failed: " + rec.Error
+	case rec.DryRun:
+		return "dry run"
+	case len(rec.Transfers) == 0:
+		return "nothing to sweep"
+	default:
+		return "sent"
+	}
+}
+
+func printSweep(rec api.SweepRecord) {
+	fmt.Printf("Sweep %d: %s\n", rec.ID, sweepStatus(rec))
+	for _, t := range rec.Transfers {
+		msg := ""
+		if t.Message != nil {
+			msg = t.Message.String()
+		}
+		fmt.Printf("  %-8s %s -> %s: %s %s\n", t.Kind, t.From, t.To, types.FIL(t.Amount), msg)
+	}
+}
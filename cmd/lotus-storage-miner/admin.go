@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var adminCmd = &cli.Command{
+	Name:  "admin",
+	Usage: "Manage the running miner process",
+	Subcommands: []*cli.Command{
+		adminReloadCmd,
+	},
+}
+
+var adminReloadCmd = &cli.Command{
+	Name:  "reload",
+	Usage: "Reload the config file without restarting the miner",
+	Description: `Applies changed log levels (Logging), pledge interval and limits
+   (Startup.Pledge*) and the storage ask (Dealmaking.Ask), the same as sending
+   SIGHUP to the miner process. Sealing settings and most deal acceptance
+   settings are read from the config file whenever they're used. Other changed
+   settings are listed, they take effect when the miner restarts. Running
+   sealing jobs aren't interrupted.`,
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureConfigReload); err != nil {
+			return err
+		}
+
+		res, err := nodeApi.ConfigReload(ctx)
+		if err != nil {
+			return xerrors.Errorf("reloading config: %w", err)
+		}
+
+		if len(res.Applied) == 0 && len(res.Restart) == 0 {
+			fmt.Println("No settings changed")
+			return nil
+		}
+		for _, s := range res.Applied {
+			fmt.Printf("applied: %s\n", s)
+		}
+		for _, s := range res.Restart {
+			fmt.Printf("needs restart: %s\n", s)
+		}
+		return nil
+	},
+}
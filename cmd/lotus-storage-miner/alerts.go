@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/storage/alerts"
+)
+
+var alertsCmd = &cli.Command{
+	Name:  "alerts",
+	Usage: "Manage miner alert rules",
+	Subcommands: []*cli.Command{
+		alertsExportCmd,
+	},
+}
+
+var alertsExportCmd = &cli.Command{
+	Name:  "export",
+	Usage: "Export the miner alert rules for external monitoring",
+	Description: `Renders the alert rules from the [Alerts] section of the miner config,
+   evaluated on the metrics served at /debug/metrics of the miner API.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "prometheus (alerting rules file) or grafana (dashboard JSON)",
+			Value: "prometheus",
+		},
+		&cli.StringFlag{
+			Name:  "datasource",
+			Usage: "grafana datasource of the dashboard panels",
+			Value: "Prometheus",
+		},
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "output file, defaults to stdout",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		rules, err := nodeApi.AlertRules(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting alert rules: %w", err)
+		}
+
+		var out []byte
+		switch cctx.String("format") {
+		case "prometheus":
+			out = alerts.PrometheusRules(rules)
+		case "grafana":
+			out, err = alerts.GrafanaDashboard(rules, cctx.String("datasource"))
+			if err != nil {
+				return xerrors.Errorf("rendering dashboard: %w", err)
+			}
+		default:
+			return xerrors.Errorf("unknown format %q", cctx.String("format"))
+		}
+
+		if path := cctx.String("out"); path != "" {
+			return ioutil.WriteFile(path, out, 0644)
+		}
+
+		fmt.Print(string(out))
+		return nil
+	},
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/storage/gasreport"
+)
+
+var analyticsCmd = &cli.Command{
+	Name:  "analytics",
+	Usage: "Reports on the operation of the miner",
+	Subcommands: []*cli.Command{
+		analyticsGasCmd,
+		analyticsExpiredPreCommitsCmd,
+	},
+}
+
+var gasSubsystems = []string{
+	gasreport.SubsystemPoSt,
+	gasreport.SubsystemPreCommit,
+	gasreport.SubsystemCommit,
+	gasreport.SubsystemMarkets,
+	gasreport.SubsystemAdmin,
+}
+
+var analyticsGasCmd = &cli.Command{
+	Name:  "gas",
+	Usage: "Show the FIL spent on gas, by subsystem",
+	Description: `Messages from the owner, worker and control addresses are attributed by method:
+   post       window PoSt submissions and fault declarations
+   precommit  sector pre-commits
+   commit     sector prove-commits
+   markets    storage market actor messages
+   admin      everything else, e.g. withdrawals and address changes
+
+Days are in UTC.`,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "days",
+			Usage: "number of days to report",
+			Value: 14,
+		},
+		&cli.BoolFlag{
+			Name:  "weekly",
+			Usage: "group days into weeks, starting on monday",
+		},
+		&cli.BoolFlag{
+			Name:  "messages",
+			Usage: "show message counts instead of FIL",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		to := time.Now().UTC()
+		from := to.AddDate(0, 0, -cctx.Int("days")+1)
+		days, err := nodeApi.AnalyticsGas(ctx, from, to)
+		if err != nil {
+			return err
+		}
+
+		label := "Day"
+		if cctx.Bool("weekly") {
+			label = "Week"
+			days = groupWeeks(days)
+		}
+
+		showMsgs := cctx.Bool("messages")
+		cell := func(s api.GasSpend) string {
+			if showMsgs {
+				return fmt.Sprint(s.Messages)
+			}
+			return types.FIL(s.Total()).String()
+		}
+
+		total := api.GasReportDay{Subsystems: map[string]api.GasSpend{}}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprint(tw, label)
+		for _, sub := range gasSubsystems {
+			_, _ = fmt.Fprintf(tw, "\t%s", sub)
+		}
+		_, _ = fmt.Fprintln(tw, "\ttotal")
+
+		for _, d := range days {
+			var dayTotal api.GasSpend
+			_, _ = fmt.Fprint(tw, d.Day.Format("2006-01-02"))
+			for _, sub := range gasSubsystems {
+				s := d.Subsystems[sub]
+				dayTotal.Add(s)
+
+				ts := total.Subsystems[sub]
+				ts.Add(s)
+				total.Subsystems[sub] = ts
+
+				_, _ = fmt.Fprintf(tw, "\t%s", cell(s))
+			}
+			_, _ = fmt.Fprintf(tw, "\t%s\n", cell(dayTotal))
+		}
+
+		var sum api.GasSpend
+		for _, s := range total.Subsystems {
+			sum.Add(s)
+		}
+
+		_, _ = fmt.Fprint(tw, "total")
+		for _, sub := range gasSubsystems {
+			_, _ = fmt.Fprintf(tw, "\t%s", cell(total.Subsystems[sub]))
+		}
+		_, _ = fmt.Fprintf(tw, "\t%s\n", cell(sum))
+
+		if sum.Total().GreaterThan(big.Zero()) {
+			_, _ = fmt.Fprint(tw, "share")
+			for _, sub := range gasSubsystems {
+				share := big.Div(big.Mul(total.Subsystems[sub].Total(), big.NewInt(1000)), sum.Total())
+				_, _ = fmt.Fprintf(tw, "\t%d.%d%%", share.Int64()/10, share.Int64()%10)
+			}
+			_, _ = fmt.Fprintln(tw, "\t100%")
+		}
+
+		return tw.Flush()
+	},
+}
+
+// groupWeeks sums days into weeks starting on monday, days must be sorted
+func groupWeeks(days []api.GasReportDay) []api.GasReportDay {
+	var out []api.GasReportDay
+	for _, d := range days {
+		// days since monday
+		since := (int(d.Day.Weekday()) + 6) % 7
+		week := d.Day.AddDate(0, 0, -since)
+
+		if len(out) == 0 || !out[len(out)-1].Day.Equal(week) {
+			out = append(out, api.GasReportDay{Day: week, Subsystems: map[string]api.GasSpend{}})
+		}
+
+		w := out[len(out)-1]
+		for sub, s := range d.Subsystems {
+			ws := w.Subsystems[sub]
+			ws.Add(s)
+			w.Subsystems[sub] = ws
+		}
+	}
+	return out
+}
+
+var analyticsExpiredPreCommitsCmd = &cli.Command{
+	Name:  "expired-precommits",
+	Usage: "List sectors whose precommit expired before they were proven",
+	Description: `The precommit deposit of these sectors was burnt, the sectors were removed
+   from the sealing pipeline and their files deleted. Deals in them need new
+   sectors, or fail.`,
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		expired, err := nodeApi.AnalyticsExpiredPreCommits(ctx)
+		if err != nil {
+			return err
+		}
+
+		total := big.Zero()
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Sector\tExpired\tDeposit\tDeals")
+		for _, e := range expired {
+			total = big.Add(total, e.Deposit)
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%v\n", e.Sector, e.Time.Format("2006-01-02 15:04"), types.FIL(e.Deposit), e.Deals)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Printf("%d sectors, %s lost\n", len(expired), types.FIL(total))
+		return nil
+	},
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var autotuneCmd = &cli.Command{
+	Name:  "autotune",
+	Usage: "Tune sealing settings from the performance of past sealing tasks",
+	Description: `The miner records every sealing task finished on its workers, with the
+   tuning settings of the worker (FIL_PROOFS_* environment variables of the
+   proofs library) and the number of tasks it ran at once. The report compares
+   the settings tried on each worker, and suggests:
+     - the values tasks finished the fastest with, out of the ones tried
+     - multicore SDR on PC1 workers with many cores, and building PC2 trees on
+       GPUs, for workers which never tried them
+     - a Sealing.MaxSealingSectors keeping PC1 workers at the parallelism
+       they have the best throughput with
+
+   Applied worker settings are used by workers when they start (see the
+   --autotune flag of lotus-worker); variables set in the environment of a
+   worker take precedence. MaxSealingSectors applies right away.`,
+	Subcommands: []*cli.Command{
+		autotuneReportCmd,
+		autotuneApplyCmd,
+	},
+}
+
+var autotuneReportCmd = &cli.Command{
+	Name:  "report",
+	Usage: "Show the performance of sealing tasks by worker, and suggested tuning",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureAutotune); err != nil {
+			return err
+		}
+
+		rep, err := nodeApi.SealingTuneReport(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting tuning report: %w", err)
+		}
+		if rep.Runs == 0 {
+			fmt.Println("No sealing tasks recorded yet")
+			return nil
+		}
+
+		fmt.Printf("%d tasks since %s\n\n", rep.Runs, rep.Since.Format(time.RFC3339))
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "WORKER\tTASK\tRUNS\tFAILED\tMEDIAN\tBEST PARALLEL\tPER HOUR")
+		for _, st := range rep.Stages {
+			best, perHour := "-", "-"
+			if st.BestParallel > 0 {
+				best = fmt.Sprint(st.BestParallel)
+				perHour = fmt.Sprintf("%.2f", st.Throughput)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", st.Worker, st.Task.Short(), st.Runs, st.Failed, st.Median.Round(time.Second), best, perHour)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Println()
+		if len(rep.Suggestions) == 0 {
+			fmt.Println("No tuning suggestions")
+			return nil
+		}
+		printSuggestions(rep.Suggestions)
+		fmt.Println("\nApply with 'lotus-miner autotune apply'")
+		return nil
+	},
+}
+
+var autotuneApplyCmd = &cli.Command{
+	Name:      "apply",
+	Usage:     "Apply suggested tuning",
+	ArgsUsage: "[setting...]",
+	Description: `Applies the suggestions of 'lotus-miner autotune report', only the ones for
+   the given settings when any are passed.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "worker",
+			Usage: "only apply suggestions for the worker with this hostname",
+		},
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "apply the suggestions",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureAutotune); err != nil {
+			return err
+		}
+
+		rep, err := nodeApi.SealingTuneReport(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting tuning report: %w", err)
+		}
+
+		settings := map[string]bool{}
+		for _, s := range cctx.Args().Slice() {
+			settings[s] = true
+		}
+
+		var apply []api.TuneSuggestion
+		for _, s := range rep.Suggestions {
+			if len(settings) > 0 && !settings[s.Setting] {
+				continue
+			}
+			if cctx.IsSet("worker") && s.Worker != cctx.String("worker") {
+				continue
+			}
+			apply = append(apply, s)
+		}
+		if len(apply) == 0 {
+			fmt.Println("No tuning suggestions to apply")
+			return nil
+		}
+
+		printSuggestions(apply)
+		fmt.Println()
+
+		if !cctx.Bool("really-do-it") {
+			fmt.Println("Pass --really-do-it to apply these changes")
+			return nil
+		}
+
+		if err := nodeApi.SealingTuneApply(ctx, apply); err != nil {
+			return xerrors.Errorf("applying tuning: %w", err)
+		}
+
+		fmt.Printf("Applied %d changes, workers use new settings when they restart\n", len(apply))
+		return nil
+	},
+}
+
+func printSuggestions(ss []api.TuneSuggestion) {
+	for _, s := range ss {
+		where := "miner"
+		if s.Worker != "" {
+			where = "worker " + s.Worker
+		}
+		cur := s.Current
+		if cur == "" {
+			cur = "unset"
+		}
+		fmt.Printf("%s: %s %s -> %s\n    %s\n", where, s.Setting, cur, s.Suggested, s.Reason)
+	}
+}
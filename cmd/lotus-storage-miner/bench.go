@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var benchCmd = &cli.Command{
+	Name:  "bench",
+	Usage: "Benchmark the miner setup",
+	Subcommands: []*cli.Command{
+		benchTransferCmd,
+	},
+}
+
+var benchTransferCmd = &cli.Command{
+	Name:  "transfer",
+	Usage: "Measure transfers between the miner and a worker",
+	Description: `Transfers test data between the miner and the /remote endpoint of a worker
+   in both directions, the same path sector files are fetched over. Worker IDs
+   are listed by 'lotus-miner sealing workers'.`,
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:     "worker",
+			Usage:    "ID of the worker to transfer data with",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "size",
+			Usage: "sizes of the test transfers",
+			Value: cli.NewStringSlice("1MiB", "64MiB", "1GiB"),
+		},
+		&cli.IntFlag{
+			Name:  "pings",
+			Usage: "number of empty requests to measure latency with",
+			Value: 5,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		var sizes []uint64
+		for _, s := range cctx.StringSlice("size") {
+			size, err := units.RAMInBytes(s)
+			if err != nil {
+				return xerrors.Errorf("parsing size '%s': %w", s, err)
+			}
+			if size < 0 {
+				return xerrors.Errorf("negative size '%s'", s)
+			}
+			sizes = append(sizes, uint64(size))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		res, err := nodeApi.WorkerBenchTransfer(ctx, cctx.Uint64("worker"), sizes, cctx.Int("pings"))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 {
+			return nil
+		}
+
+		fmt.Printf("Endpoint: %s\n", res[0].URL)
+		fmt.Printf("Latency: %s\n\n", res[0].Latency)
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Size\tDownload\tUpload")
+		for _, r := range res {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n",
+				units.BytesSize(float64(r.Size)),
+				throughput(r.Size, r.Download),
+				throughput(r.Size, r.Upload))
+		}
+		return tw.Flush()
+	},
+}
+
+func throughput(size uint64, took time.Duration) string {
+	if took <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s/s (%s)", units.BytesSize(float64(size)/took.Seconds()), took.Truncate(time.Millisecond))
+}
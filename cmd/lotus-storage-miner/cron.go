@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var cronCmd = &cli.Command{
+	Name:  "cron",
+	Usage: "Manage scheduled jobs",
+	Description: `Jobs are configured in the Cron section of the miner config, each runs either
+   a built-in task (sweep, scrub, compress-caches) or a shell command. The last
+   runs of every job are recorded, failed runs fire the MinerCronJobFailed alert.`,
+	Subcommands: []*cli.Command{
+		cronListCmd,
+		cronRunCmd,
+		cronHistoryCmd,
+	},
+}
+
+var cronListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List scheduled jobs",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		jobs, err := nodeApi.CronJobs(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Name\tSchedule\tTask\tNext\tLast Run")
+		for _, j := range jobs {
+			last := "never"
+			if j.LastRun != nil {
+				last = j.LastRun.Started.Format("2006-01-02 15:04:05") + " " + cronStatus(*j.LastRun)
+			}
+			if j.Running {
+				last = "running"
+			}
+			next := "-"
+			if !j.Next.IsZero() {
+				next = j.Next.Format("2006-01-02 15:04")
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", j.Name, j.Schedule, j.Task, next, last)
+		}
+		return tw.Flush()
+	},
+}
+
+var cronRunCmd = &cli.Command{
+	Name:      "run",
+	Usage:     "Run a job now, and wait for it to finish",
+	ArgsUsage: "<job>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a job name"))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		run, err := nodeApi.CronRun(ctx, cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		if run.Output != "" {
+			fmt.Println(run.Output)
+		}
+		if run.Error != "" {
+			return xerrors.Errorf("job failed after %s: %s", run.Finished.Sub(run.Started), run.Error)
+		}
+		fmt.Printf("job finished in %s\n", run.Finished.Sub(run.Started))
+		return nil
+	},
+}
+
+var cronHistoryCmd = &cli.Command{
+	Name:      "history",
+	Usage:     "List recorded runs of a job",
+	ArgsUsage: "<job>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "output",
+			Usage: "print the output of every run",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a job name"))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		runs, err := nodeApi.CronHistory(ctx, cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		if cctx.Bool("output") {
+			for _, r := range runs {
+				fmt.Printf("%s (%s) %s\n", r.Started.Format("2006-01-02 15:04:05"), r.Finished.Sub(r.Started), cronStatus(r))
+				if r.Output != "" {
+					fmt.Println(r.Output)
+				}
+				fmt.Println()
+			}
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Started\tTook\tManual\tStatus")
+		for _, r := range runs {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", r.Started.Format("2006-01-02 15:04:05"), r.Finished.Sub(r.Started), r.Manual, cronStatus(r))
+		}
+		return tw.Flush()
+	},
+}
+
+func cronStatus(r api.CronRun) string {
+	if r.Error != "" {
+		return "failed: " + r.Error
+	}
+	return "ok"
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/addrutil"
+	"github.com/filecoin-project/lotus/node"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/impl/common"
+	"github.com/filecoin-project/lotus/node/modules"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+// defaultFullNodeRetry is used when Startup.FullNodeRetry isn't set
+const defaultFullNodeRetry = 10 * time.Second
+
+var errDegraded = xerrors.New("miner is running in degraded mode, waiting for the full node to connect")
+
+// errStoppedDegraded is returned by runDegraded when the miner is shut down
+// before the full node connects
+var errStoppedDegraded = xerrors.New("shut down in degraded mode")
+
+// dialFullNode connects to the full node, and checks that it answers
+func dialFullNode(ctx context.Context, cctx *cli.Context, opt config.StartupConfig) (api.FullNode, jsonrpc.ClientCloser, api.Version, error) {
+	dial := lcli.GetFullNodeAPI
+	if opt.FullNodeFailover {
+		dial = lcli.GetFullNodeFailoverAPI
+	}
+
+	nodeApi, closer, err := dial(cctx)
+	if err != nil {
+		return nil, nil, api.Version{}, err
+	}
+
+	v, err := nodeApi.Version(ctx)
+	if err != nil {
+		closer()
+		return nil, nil, api.Version{}, err
+	}
+
+	return nodeApi, closer, v, nil
+}
+
+// minerConfig reads the miner config, before the repo is locked by the node
+func minerConfig(r *repo.FsRepo) (*config.StorageMiner, error) {
+	lr, err := r.Lock(repo.StorageMiner)
+	if err != nil {
+		return nil, err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	c, err := lr.Config()
+	if err != nil {
+		return nil, xerrors.Errorf("reading config: %w", err)
+	}
+	cfg, ok := c.(*config.StorageMiner)
+	if !ok {
+		return nil, xerrors.Errorf("invalid config for repo, got: %T", c)
+	}
+
+	return cfg, nil
+}
+
+// runOptions applies the run flags set on the command line over the startup
+// config
+func runOptions(cctx *cli.Context, cfg config.StartupConfig) config.StartupConfig {
+	setBool := func(flag string, v *bool) {
+		if cctx.IsSet(flag) {
+			*v = cctx.Bool(flag)
+		}
+	}
+	setDuration := func(flag string, v *config.Duration) {
+		if cctx.IsSet(flag) {
+			*v = config.Duration(cctx.Duration(flag))
+		}
+	}
+
+	if cctx.IsSet("fullnode-api") {
+		cfg.FullNodeAPI = cctx.String("fullnode-api")
+	}
+	setBool("fullnode-failover", &cfg.FullNodeFailover)
+	setBool("allow-degraded", &cfg.AllowDegraded)
+	setBool("enable-gpu-proving", &cfg.EnableGPUProving)
+	setBool("manage-fdlimit", &cfg.ManageFDLimit)
+	setBool("pledge-sector", &cfg.PledgeSector)
+	setDuration("pledge-interval", &cfg.PledgeInterval)
+	if cctx.IsSet("pledge-max-sectors") {
+		cfg.PledgeMaxSectors = cctx.Uint64("pledge-max-sectors")
+	}
+	if cctx.IsSet("pledge-min-free") {
+		cfg.PledgeMinFree = cctx.String("pledge-min-free")
+	}
+	if cctx.IsSet("pledge-reserve-workers") {
+		cfg.PledgeReserveWorkers = cctx.Int("pledge-reserve-workers")
+	}
+	setBool("webui", &cfg.WebUI)
+	setDuration("shutdown-grace", &cfg.ShutdownGrace)
+	setDuration("shutdown-timeout", &cfg.ShutdownTimeout)
+	setBool("drain-on-shutdown", &cfg.DrainOnShutdown)
+	setDuration("drain-timeout", &cfg.DrainTimeout)
+	setDuration("api-slow-call", &cfg.APISlowCall)
+	if cctx.IsSet("tls-cert") {
+		cfg.TLSCert = cctx.String("tls-cert")
+	}
+	if cctx.IsSet("tls-key") {
+		cfg.TLSKey = cctx.String("tls-key")
+	}
+	if cctx.IsSet("max-sync-lag") {
+		cfg.MaxSyncLag = cctx.Int64("max-sync-lag")
+	}
+	if cctx.Bool("nosync") {
+		cfg.MaxSyncLag = -1
+	}
+
+	return cfg
+}
+
+// runDegraded serves the local API until the full node connects, the repo is
+// unlocked again before it returns, so the miner node can take over
+func runDegraded(ctx context.Context, cctx *cli.Context, r *repo.FsRepo, opt config.StartupConfig) (api.FullNode, jsonrpc.ClientCloser, api.Version, error) {
+	lr, err := r.Lock(repo.StorageMiner)
+	if err != nil {
+		return nil, nil, api.Version{}, err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	ks, err := lr.KeyStore()
+	if err != nil {
+		return nil, nil, api.Version{}, err
+	}
+	secret, err := modules.APISecret(ks, lr)
+	if err != nil {
+		return nil, nil, api.Version{}, xerrors.Errorf("getting API secret: %w", err)
+	}
+
+	c, err := lr.Config()
+	if err != nil {
+		return nil, nil, api.Version{}, xerrors.Errorf("reading config: %w", err)
+	}
+	listen := c.(*config.StorageMiner).API.ListenAddress
+	if cctx.IsSet("api") {
+		listen = cctx.String("api")
+	}
+	endpoint, err := addrutil.ParseListenAddress(listen)
+	if err != nil {
+		return nil, nil, api.Version{}, xerrors.Errorf("parsing API endpoint: %w", err)
+	}
+	if err := lr.SetAPIEndpoint(apiEndpoint(endpoint, opt)); err != nil {
+		return nil, nil, api.Version{}, xerrors.Errorf("setting API endpoint: %w", err)
+	}
+
+	shutdownChan := make(chan struct{}, 1)
+	capi := &common.CommonAPI{
+		APISecret:    secret,
+		ShutdownChan: dtypes.ShutdownChan(shutdownChan),
+	}
+
+	rpcServer := jsonrpc.NewServer()
+	rpcServer.Register("Filecoin", apistruct.PermissionedStorMinerAPI(apistruct.DegradedStorMinerAPI(capi, errDegraded)))
+
+	mux := http.NewServeMux()
+	mux.Handle("/rpc/v0", rpcServer)
+	srv := &http.Server{Handler: node.CORSHandler(c.(*config.StorageMiner).API.CORS, &auth.Handler{
+		Verify: capi.AuthVerify,
+		Next:   mux.ServeHTTP,
+	})}
+
+	lst, err := listenAPI(endpoint, opt)
+	if err != nil {
+		return nil, nil, api.Version{}, xerrors.Errorf("could not listen: %w", err)
+	}
+	go func() {
+		if err := serve(srv, manet.NetListener(lst), opt); err != nil && err != http.ErrServerClosed {
+			log.Errorf("serving degraded API: %s", err)
+		}
+	}()
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			log.Warnf("shutting down degraded API: %s", err)
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigCh)
+
+	retry := time.Duration(opt.FullNodeRetry)
+	if retry <= 0 {
+		retry = defaultFullNodeRetry
+	}
+	t := time.NewTicker(retry)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-shutdownChan:
+			return nil, nil, api.Version{}, errStoppedDegraded
+		case <-sigCh:
+			return nil, nil, api.Version{}, errStoppedDegraded
+		case <-ctx.Done():
+			return nil, nil, api.Version{}, errStoppedDegraded
+		}
+
+		nodeApi, closer, v, err := dialFullNode(ctx, cctx, opt)
+		if err != nil {
+			log.Debugf("full node still unreachable: %s", err)
+			continue
+		}
+
+		log.Info("full node connected, leaving degraded mode")
+		return nodeApi, closer, v, nil
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var eventsCmd = &cli.Command{
+	Name:  "events",
+	Usage: "Manage sector webhook delivery",
+	Description: `Sector state changes are POSTed to the endpoints in the SectorWebhooks section
+   of the miner config. Events are persisted and retried until the endpoint
+   accepts them; delivered events are kept for the retention period, so an
+   endpoint which lost events can get them again with 'replay'.`,
+	Subcommands: []*cli.Command{
+		eventsStatusCmd,
+		eventsReplayCmd,
+	},
+}
+
+var eventsStatusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "Show the delivery state of the webhook endpoints",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureSectorWebhooks); err != nil {
+			return err
+		}
+
+		st, err := nodeApi.SectorsWebhooks(ctx)
+		if err != nil {
+			return err
+		}
+		if len(st) == 0 {
+			fmt.Println("no webhook endpoints configured")
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "URL\tNext\tPending\tLast Attempt\tError")
+		for _, s := range st {
+			last := "never"
+			if !s.LastAttempt.IsZero() {
+				last = s.LastAttempt.Format("2006-01-02 15:04:05")
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", s.URL, s.Next, s.Pending, last, s.LastError)
+		}
+		return tw.Flush()
+	},
+}
+
+var eventsReplayCmd = &cli.Command{
+	Name:  "replay",
+	Usage: "Resend retained sector events to webhook endpoints",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "resend events since this time (RFC3339), or this long ago, e.g. 6h",
+		},
+		&cli.StringFlag{
+			Name:  "url",
+			Usage: "only resend to this configured endpoint",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if !cctx.IsSet("since") {
+			return xerrors.New("--since is required")
+		}
+		since, err := parseSince(cctx.String("since"), time.Now())
+		if err != nil {
+			return err
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureSectorWebhooks); err != nil {
+			return err
+		}
+
+		n, err := nodeApi.SectorsWebhooksReplay(ctx, since, cctx.String("url"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d events queued since %s\n", n, since.Format(time.RFC3339))
+		return nil
+	},
+}
+
+// parseSince accepts a time or a duration before now
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, xerrors.Errorf("negative duration %s", s)
+		}
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf("parsing since: expected a duration or an RFC3339 time: %w", err)
+	}
+	return t, nil
+}
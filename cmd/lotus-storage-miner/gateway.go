@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+// gatewayCacheTTL limits how often public requests reach the miner
+const gatewayCacheTTL = time.Minute
+
+var gatewayCmd = &cli.Command{
+	Name:  "gateway",
+	Usage: "Serve a public, read-only subset of the miner API",
+	Description: `The gateway connects to the miner API with the local token and serves
+   sector stats, asks and deal status without authentication, e.g. for
+   public status pages. No other methods are reachable through it, so the
+   miner API itself can stay private.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "host address and port the gateway will listen on",
+			Value: "0.0.0.0:2347",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := lcli.ReqContext(cctx)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		address := cctx.String("listen")
+		log.Info("Setting up gateway endpoint at " + address)
+
+		rpcServer := jsonrpc.NewServer()
+		rpcServer.Register("Filecoin", &minerGatewayAPI{api: nodeApi})
+
+		mux := http.NewServeMux()
+		mux.Handle("/rpc/v0", rpcServer)
+
+		srv := &http.Server{
+			Handler: mux,
+			BaseContext: func(listener net.Listener) context.Context {
+				return ctx
+			},
+		}
+
+		go func() {
+			<-ctx.Done()
+			log.Warn("Shutting down...")
+			if err := srv.Shutdown(context.TODO()); err != nil {
+				log.Errorf("shutting down gateway failed: %s", err)
+			}
+		}()
+
+		nl, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+
+		return srv.Serve(nl)
+	},
+}
+
+// GatewayDealStatus is the public part of a storage deal state
+type GatewayDealStatus struct {
+	ProposalCid cid.Cid
+	State       string
+	Message     string
+	PieceCID    cid.Cid
+	DealID      abi.DealID
+}
+
+// minerGatewayAPI is the allow-list of methods served by the gateway. Lists
+// which are expensive to build are cached, so public requests can't load the
+// miner.
+type minerGatewayAPI struct {
+	api api.StorageMiner
+
+	summaryLk sync.Mutex
+	summary   map[api.SectorState]int
+	summaryAt time.Time
+
+	dealsLk sync.Mutex
+	deals   map[cid.Cid]GatewayDealStatus
+	dealsAt time.Time
+}
+
+func (a *minerGatewayAPI) ActorAddress(ctx context.Context) (address.Address, error) {
+	return a.api.ActorAddress(ctx)
+}
+
+func (a *minerGatewayAPI) ActorSectorSize(ctx context.Context) (abi.SectorSize, error) {
+	maddr, err := a.api.ActorAddress(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return a.api.ActorSectorSize(ctx, maddr)
+}
+
+func (a *minerGatewayAPI) MarketGetAsk(ctx context.Context) (*storagemarket.SignedStorageAsk, error) {
+	return a.api.MarketGetAsk(ctx)
+}
+
+func (a *minerGatewayAPI) MarketGetRetrievalAsk(ctx context.Context) (*retrievalmarket.Ask, error) {
+	return a.api.MarketGetRetrievalAsk(ctx)
+}
+
+// SectorsSummary returns the number of sectors in each state
+func (a *minerGatewayAPI) SectorsSummary(ctx context.Context) (map[api.SectorState]int, error) {
+	a.summaryLk.Lock()
+	defer a.summaryLk.Unlock()
+
+	if a.summary != nil && time.Since(a.summaryAt) < gatewayCacheTTL {
+		return a.summary, nil
+	}
+
+	// errors aren't cached, they may be specific to the request, e.g. when
+	// it's cancelled
+	summary, err := a.sectorsSummary(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.summary, a.summaryAt = summary, time.Now()
+	return a.summary, nil
+}
+
+func (a *minerGatewayAPI) sectorsSummary(ctx context.Context) (map[api.SectorState]int, error) {
+	sectors, err := a.api.SectorsList(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	out := map[api.SectorState]int{}
+	for _, s := range sectors {
+		st, err := a.api.SectorsStatus(ctx, s, false)
+		if err != nil {
+			return nil, xerrors.Errorf("getting sector %d status: %w", s, err)
+		}
+		out[st.State]++
+	}
+
+	return out, nil
+}
+
+// DealStatus returns the state of a storage deal by its proposal CID
+func (a *minerGatewayAPI) DealStatus(ctx context.Context, proposal cid.Cid) (*GatewayDealStatus, error) {
+	a.dealsLk.Lock()
+	defer a.dealsLk.Unlock()
+
+	if time.Since(a.dealsAt) >= gatewayCacheTTL {
+		deals, err := a.api.MarketListIncompleteDeals(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("listing deals: %w", err)
+		}
+
+		a.deals = make(map[cid.Cid]GatewayDealStatus, len(deals))
+		for _, d := range deals {
+			a.deals[d.ProposalCid] = GatewayDealStatus{
+				ProposalCid: d.ProposalCid,
+				State:       storagemarket.DealStates[d.State],
+				Message:     d.Message,
+				PieceCID:    d.Proposal.PieceCID,
+				DealID:      d.DealID,
+			}
+		}
+		a.dealsAt = time.Now()
+	}
+
+	d, ok := a.deals[proposal]
+	if !ok {
+		return nil, xerrors.Errorf("deal %s not found", proposal)
+	}
+	return &d, nil
+}
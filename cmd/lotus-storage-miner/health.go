@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/node"
+	"github.com/filecoin-project/lotus/storage"
+)
+
+const (
+	healthTimeout = 5 * time.Second
+	// the full node is considered out of sync when its head is older than
+	// this many epochs
+	healthSyncEpochs = 5
+)
+
+// healthHandler serves /healthz and /readyz without authentication, for
+// Kubernetes probes and load balancers. /healthz reports whether the process
+// serves HTTP at all, /readyz whether the miner can do its work.
+type healthHandler struct {
+	full  api.FullNode
+	miner *storage.Miner
+	drain *node.DrainHandler
+}
+
+type healthStatus struct {
+	Ok bool
+	// Checks maps check names to "ok" or the reason they failed
+	Checks map[string]string
+}
+
+func (h *healthHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, healthStatus{Ok: true, Checks: map[string]string{"rpc": "ok"}})
+}
+
+func (h *healthHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	st := healthStatus{Ok: true, Checks: map[string]string{}}
+	check := func(name, failure string) {
+		if failure == "" {
+			st.Checks[name] = "ok"
+			return
+		}
+		st.Ok = false
+		st.Checks[name] = failure
+	}
+
+	if h.drain.Draining() {
+		check("rpc", "shutting down")
+	} else {
+		check("rpc", "")
+	}
+
+	head, err := h.full.ChainHead(ctx)
+	if err != nil {
+		check("fullnode", err.Error())
+		check("sync", "full node unreachable")
+	} else {
+		check("fullnode", "")
+
+		lag := time.Since(time.Unix(int64(head.MinTimestamp()), 0))
+		if lag > healthSyncEpochs*time.Duration(build.BlockDelaySecs)*time.Second {
+			check("sync", "head is "+lag.Round(time.Second).String()+" old")
+		} else {
+			check("sync", "")
+		}
+	}
+
+	// markets nodes don't seal
+	if h.miner != nil {
+		if h.miner.SealingReady() {
+			check("sealing", "")
+		} else {
+			check("sealing", "not initialized")
+		}
+	}
+
+	writeHealth(w, st)
+}
+
+func writeHealth(w http.ResponseWriter, st healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if !st.Ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		log.Warnf("writing health status: %s", err)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"sort"
+	"text/tabwriter"
 	"time"
 
 	"github.com/fatih/color"
@@ -32,6 +34,7 @@ var infoCmd = &cli.Command{
 	Usage: "Print miner info",
 	Subcommands: []*cli.Command{
 		infoAllCmd,
+		infoNodesCmd,
 	},
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
@@ -77,6 +80,21 @@ func infoCmdAct(cctx *cli.Context) error {
 
 	fmt.Printf("Miner: %s\n", color.BlueString("%s", maddr))
 
+	if v, err := nodeApi.Version(ctx); err == nil && v.Supports(build.FeatureSyncLag) {
+		sl, err := nodeApi.SyncLag(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting sync lag: %w", err)
+		}
+		switch {
+		case !sl.InSync:
+			fmt.Printf("Chain: %s\n", color.RedString("%d epochs behind, not sending messages (max sync lag %d)", sl.Lag, sl.MaxLag))
+		case sl.Lag > 0:
+			fmt.Printf("Chain: %s\n", color.YellowString("%d epochs behind", sl.Lag))
+		default:
+			fmt.Printf("Chain: %s\n", color.GreenString("in sync"))
+		}
+	}
+
 	// Sector size
 	mi, err := api.StateMinerInfo(ctx, maddr, types.EmptyTSK)
 	if err != nil {
@@ -235,6 +253,7 @@ var stateList = []stateMeta{
 
 	{col: color.FgRed, state: sealing.UndefinedSectorState},
 	{col: color.FgYellow, state: sealing.Packing},
+	{col: color.FgYellow, state: sealing.External},
 	{col: color.FgYellow, state: sealing.PreCommit1},
 	{col: color.FgYellow, state: sealing.PreCommit2},
 	{col: color.FgYellow, state: sealing.PreCommitting},
@@ -262,6 +281,7 @@ var stateList = []stateMeta{
 	{col: color.FgRed, state: sealing.RemoveFailed},
 	{col: color.FgRed, state: sealing.DealsExpired},
 	{col: color.FgRed, state: sealing.RecoverDealIDs},
+	{col: color.FgRed, state: sealing.PreCommitExpired},
 }
 
 func init() {
@@ -306,3 +326,32 @@ func sectorsInfo(ctx context.Context, napi api.StorageMiner) error {
 
 	return nil
 }
+
+var infoNodesCmd = &cli.Command{
+	Name:  "nodes",
+	Usage: "Print the state of the connections to full nodes",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		sts, err := nodeApi.NodeConnectionStatus(lcli.ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Node\tHealthy\tLatency\tHeight\tCalls\tErrors\tIn Flight\tLast Error")
+		for _, st := range sts {
+			healthy := "yes"
+			if !st.Healthy {
+				healthy = "no"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", st.Name, healthy, st.Latency.Round(time.Millisecond),
+				st.Height, st.Calls, st.Errors, st.InFlight, st.LastError)
+		}
+		return tw.Flush()
+	},
+}
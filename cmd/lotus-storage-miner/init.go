@@ -56,6 +56,9 @@ import (
 var initCmd = &cli.Command{
 	Name:  "init",
 	Usage: "Initialize a lotus miner repo",
+	Subcommands: []*cli.Command{
+		initMarketsCmd,
+	},
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "actor",
@@ -181,8 +184,12 @@ var initCmd = &cli.Command{
 			return err
 		}
 
-		if !v.APIVersion.EqMajorMinor(build.FullAPIVersion) {
-			return xerrors.Errorf("Remote API version didn't match (expected %s, remote %s)", build.FullAPIVersion, v.APIVersion)
+		if err := v.CheckCompatible(build.FullAPIVersion); err != nil {
+			return xerrors.Errorf("lotus-daemon API isn't compatible: %w", err)
+		}
+
+		if err := lcli.CheckRemoteBuild(ctx, api); err != nil {
+			return err
 		}
 
 		log.Info("Initializing repo")
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/repo"
+	"github.com/filecoin-project/lotus/storage/sectorblocks"
+)
+
+var initMarketsCmd = &cli.Command{
+	Name:  "markets",
+	Usage: "Initialize a markets node for an existing sealing miner",
+	Description: `A markets node runs the storage and retrieval markets of a miner in its own
+   process, with its own repo and libp2p identity. Deal data is added to
+   sectors of the sealing miner over its API, so deal traffic doesn't load
+   the process proving the sectors.
+
+   The peer ID of the miner actor is set to the markets node, so clients make
+   deals with it.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "sealer-api",
+			Usage:    "token:multiaddr of the sealing miner API, with an admin token (Subsystems.SealerAPIInfo)",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "gas-premium",
+			Usage: "set gas premium for the set peer id message",
+			Value: "0",
+		},
+		&cli.BoolFlag{
+			Name:  "nosync",
+			Usage: "don't check full-node sync status",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		gasPrice, err := types.BigFromString(cctx.String("gas-premium"))
+		if err != nil {
+			return xerrors.Errorf("failed to parse gas-price flag: %s", err)
+		}
+
+		ctx := lcli.ReqContext(cctx)
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		v, err := api.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if err := v.CheckCompatible(build.FullAPIVersion); err != nil {
+			return xerrors.Errorf("lotus-daemon API isn't compatible: %w", err)
+		}
+
+		if !cctx.Bool("nosync") {
+			if err := lcli.SyncWait(ctx, api); err != nil {
+				return xerrors.Errorf("sync wait: %w", err)
+			}
+		}
+
+		sealerInfo := cctx.String("sealer-api")
+		builder, scloser, err := dialSealer(ctx, sealerInfo)
+		if err != nil {
+			return xerrors.Errorf("connecting to the sealing miner: %w", err)
+		}
+		scloser()
+		maddr := builder.Address()
+
+		repoPath := cctx.String(FlagMinerRepo)
+		r, err := repo.NewFS(repoPath)
+		if err != nil {
+			return err
+		}
+
+		ok, err := r.Exists()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return xerrors.Errorf("repo at '%s' is already initialized", repoPath)
+		}
+
+		log.Info("Initializing repo")
+
+		if err := r.Init(repo.StorageMiner); err != nil {
+			return err
+		}
+
+		lr, err := r.Lock(repo.StorageMiner)
+		if err != nil {
+			return err
+		}
+		defer lr.Close() //nolint:errcheck
+
+		var cerr error
+		if err := lr.SetConfig(func(c interface{}) {
+			cfg, ok := c.(*config.StorageMiner)
+			if !ok {
+				cerr = xerrors.Errorf("invalid config for repo, got: %T", c)
+				return
+			}
+			cfg.Subsystems.EnableMarkets = true
+			cfg.Subsystems.SealerAPIInfo = sealerInfo
+		}); err != nil {
+			return xerrors.Errorf("setting config: %w", err)
+		}
+		if cerr != nil {
+			return cerr
+		}
+
+		p2pSk, err := makeHostKey(lr)
+		if err != nil {
+			return xerrors.Errorf("make host key: %w", err)
+		}
+
+		peerid, err := peer.IDFromPrivateKey(p2pSk)
+		if err != nil {
+			return xerrors.Errorf("peer ID from private key: %w", err)
+		}
+
+		mds, err := lr.Datastore("/metadata")
+		if err != nil {
+			return err
+		}
+		if err := mds.Put(datastore.NewKey("miner-address"), maddr.Bytes()); err != nil {
+			return err
+		}
+
+		log.Infof("Setting the peer ID of %s to %s", maddr, peerid)
+		if err := configureStorageMiner(ctx, api, maddr, peerid, gasPrice); err != nil {
+			return xerrors.Errorf("failed to configure miner: %w", err)
+		}
+
+		fmt.Printf("Markets node for %s initialized, start it with 'lotus-miner run'.\n", maddr)
+		fmt.Println("Set Subsystems.EnableMarkets = false in the config of the sealing miner and restart it, so it stops handling deals.")
+		return nil
+	},
+}
+
+// dialSealer connects a markets node to the sealing miner, the returned
+// builder adds deal pieces to its sectors
+func dialSealer(ctx context.Context, info string) (*sectorblocks.RemoteBuilder, jsonrpc.ClientCloser, error) {
+	ainfo, err := lcli.ParseApiInfo(info)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("parsing sealer API info: %w", err)
+	}
+	addr, err := ainfo.DialArgs()
+	if err != nil {
+		return nil, nil, err
+	}
+	pieces, err := client.HTTPURL(addr, "../../remote/pieces")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealer, closer, err := client.NewSealerRPC(ctx, addr, ainfo.AuthHeader())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perms, err := sealer.AuthVerify(ctx, string(ainfo.Token))
+	if err != nil {
+		closer()
+		return nil, nil, xerrors.Errorf("checking sealer API token: %w", err)
+	}
+	if !hasPerm(perms, apistruct.PermAdmin) {
+		closer()
+		return nil, nil, xerrors.New("the sealer API token needs admin permission")
+	}
+
+	maddr, err := sealer.ActorAddress(ctx)
+	if err != nil {
+		closer()
+		return nil, nil, xerrors.Errorf("getting actor address of the sealing miner: %w", err)
+	}
+
+	return sectorblocks.NewRemoteBuilder(sealer, maddr, pieces, ainfo.AuthHeader()), closer, nil
+}
+
+func hasPerm(perms []auth.Permission, perm auth.Permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -32,9 +32,20 @@ func main() {
 
 	local := []*cli.Command{
 		initCmd,
+		migrateCmd,
 		runCmd,
 		stopCmd,
+		adminCmd,
+		outboxCmd,
 		configCmd,
+		alertsCmd,
+		cronCmd,
+		eventsCmd,
+		analyticsCmd,
+		autotuneCmd,
+		gatewayCmd,
+		operationsCmd,
+		tokensCmd,
 		lcli.WithCategory("chain", actorCmd),
 		lcli.WithCategory("chain", infoCmd),
 		lcli.WithCategory("market", storageDealsCmd),
@@ -44,6 +55,7 @@ func main() {
 		lcli.WithCategory("storage", provingCmd),
 		lcli.WithCategory("storage", storageCmd),
 		lcli.WithCategory("storage", sealingCmd),
+		lcli.WithCategory("storage", benchCmd),
 		lcli.WithCategory("retrieval", piecesCmd),
 	}
 	jaeger := tracing.SetupJaegerTracing("lotus")
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -23,8 +25,10 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
 	"github.com/filecoin-project/lotus/chain/types"
 	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/storage/labels"
 )
 
 var CidBaseFlag = cli.StringFlag{
@@ -298,7 +302,12 @@ var storageDealsCmd = &cli.Command{
 	Usage: "Manage storage deals and related configuration",
 	Subcommands: []*cli.Command{
 		dealsImportDataCmd,
+		dealsIntakeCmd,
 		dealsListCmd,
+		dealsLabelCmd,
+		dealsInspectCmd,
+		dealsCalcCmd,
+		dealsPaymentsCmd,
 		storageDealSelectionCmd,
 		setAskCmd,
 		getAskCmd,
@@ -338,6 +347,96 @@ var dealsImportDataCmd = &cli.Command{
 	},
 }
 
+var dealsIntakeCmd = &cli.Command{
+	Name:  "intake",
+	Usage: "Manage the offline deal intake queue",
+	Subcommands: []*cli.Command{
+		dealsIntakeAddCmd,
+		dealsIntakeListCmd,
+	},
+}
+
+var dealsIntakeAddCmd = &cli.Command{
+	Name:      "add",
+	Usage:     "Queue a signed offline deal proposal with its data",
+	ArgsUsage: "<proposal JSON file> <data file>",
+	Description: `The proposal file holds the JSON of the signed market.ClientDealProposal
+   the client proposes to the miner. The data is imported once the client
+   proposed the deal.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "callback",
+			Usage: "URL to POST deal state changes to",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		if cctx.Args().Len() < 2 {
+			return fmt.Errorf("must specify proposal and data file paths")
+		}
+
+		pb, err := ioutil.ReadFile(cctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		var proposal market.ClientDealProposal
+		if err := json.Unmarshal(pb, &proposal); err != nil {
+			return xerrors.Errorf("parsing proposal: %w", err)
+		}
+
+		fpath, err := filepath.Abs(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		propCid, err := api.DealsIntakeEnqueue(ctx, proposal, fpath, cctx.String("callback"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(propCid)
+		return nil
+	},
+}
+
+var dealsIntakeListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List deals submitted through the intake queue",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		entries, err := api.DealsIntakeList(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "ProposalCid\tDealId\tProposed\tImported\tState\tUpdated\tMessage\n")
+		for _, e := range entries {
+			msg := e.Message
+			if e.Err != "" {
+				msg = e.Err
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%t\t%t\t%s\t%s\t%s\n", e.ProposalCid, e.DealID, e.Proposed, e.Imported, storagemarket.DealStates[e.State], e.Updated.Format(time.Stamp), msg)
+		}
+
+		return w.Flush()
+	},
+}
+
 var dealsListCmd = &cli.Command{
 	Name:  "list",
 	Usage: "List all deals for this miner",
@@ -350,8 +449,18 @@ var dealsListCmd = &cli.Command{
 			Name:  "watch",
 			Usage: "watch deal updates in real-time, rather than a one time list",
 		},
+		&cli.StringSliceFlag{
+			Name:    "label",
+			Aliases: []string{"l"},
+			Usage:   "only list deals with the label, key=value, or key for any value",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
+		selector, err := labels.Parse(cctx.StringSlice("label"))
+		if err != nil {
+			return err
+		}
+
 		api, closer, err := lcli.GetStorageMinerAPI(cctx)
 		if err != nil {
 			return err
@@ -365,6 +474,18 @@ var dealsListCmd = &cli.Command{
 			return err
 		}
 
+		labelled, err := api.MarketListDealLabels(ctx, selector)
+		if err != nil {
+			return err
+		}
+		dl := dealLabels{
+			filter: len(selector) > 0,
+			labels: make(map[cid.Cid]map[string]string, len(labelled)),
+		}
+		for _, l := range labelled {
+			dl.labels[l.ProposalCid] = l.Labels
+		}
+
 		verbose := cctx.Bool("verbose")
 		watch := cctx.Bool("watch")
 
@@ -378,7 +499,7 @@ var dealsListCmd = &cli.Command{
 				tm.Clear()
 				tm.MoveCursor(1, 1)
 
-				err = outputStorageDeals(tm.Output, deals, verbose)
+				err = outputStorageDeals(tm.Output, deals, dl, verbose)
 				if err != nil {
 					return err
 				}
@@ -388,7 +509,10 @@ var dealsListCmd = &cli.Command{
 				select {
 				case <-ctx.Done():
 					return nil
-				case updated := <-updates:
+				case updated, ok := <-updates:
+					if !ok {
+						return xerrors.Errorf("deal updates channel closed")
+					}
 					var found bool
 					for i, existing := range deals {
 						if existing.ProposalCid.Equals(updated.ProposalCid) {
@@ -404,11 +528,17 @@ var dealsListCmd = &cli.Command{
 			}
 		}
 
-		return outputStorageDeals(os.Stdout, deals, verbose)
+		return outputStorageDeals(os.Stdout, deals, dl, verbose)
 	},
 }
 
-func outputStorageDeals(out io.Writer, deals []storagemarket.MinerDeal, verbose bool) error {
+type dealLabels struct {
+	// only list labelled deals
+	filter bool
+	labels map[cid.Cid]map[string]string
+}
+
+func outputStorageDeals(out io.Writer, deals []storagemarket.MinerDeal, dl dealLabels, verbose bool) error {
 	sort.Slice(deals, func(i, j int) bool {
 		return deals[i].CreationTime.Time().Before(deals[j].CreationTime.Time())
 	})
@@ -416,12 +546,22 @@ func outputStorageDeals(out io.Writer, deals []storagemarket.MinerDeal, verbose
 	w := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
 
 	if verbose {
-		_, _ = fmt.Fprintf(w, "Creation\tProposalCid\tDealId\tState\tClient\tSize\tPrice\tDuration\tMessage\n")
+		_, _ = fmt.Fprintf(w, "Creation\tProposalCid\tDealId\tState\tClient\tSize\tPrice\tDuration\tMessage")
 	} else {
-		_, _ = fmt.Fprintf(w, "ProposalCid\tDealId\tState\tClient\tSize\tPrice\tDuration\n")
+		_, _ = fmt.Fprintf(w, "ProposalCid\tDealId\tState\tClient\tSize\tPrice\tDuration")
 	}
+	showLabels := len(dl.labels) > 0
+	if showLabels {
+		_, _ = fmt.Fprintf(w, "\tLabels")
+	}
+	_, _ = fmt.Fprintln(w)
 
 	for _, deal := range deals {
+		dlabels, labelled := dl.labels[deal.ProposalCid]
+		if dl.filter && !labelled {
+			continue
+		}
+
 		propcid := deal.ProposalCid.String()
 		if !verbose {
 			propcid = "..." + propcid[len(propcid)-8:]
@@ -437,6 +577,9 @@ func outputStorageDeals(out io.Writer, deals []storagemarket.MinerDeal, verbose
 		if verbose {
 			_, _ = fmt.Fprintf(w, "\t%s", deal.Message)
 		}
+		if showLabels {
+			_, _ = fmt.Fprintf(w, "\t%s", labels.String(dlabels))
+		}
 
 		_, _ = fmt.Fprintln(w)
 	}
@@ -444,6 +587,138 @@ func outputStorageDeals(out io.Writer, deals []storagemarket.MinerDeal, verbose
 	return w.Flush()
 }
 
+var dealsLabelCmd = &cli.Command{
+	Name:      "label",
+	Usage:     "Set labels of a deal",
+	ArgsUsage: "<proposal CID> <key=value> [key=value ...]",
+	Description: `Labels are kept by the miner only, they can be used to filter deal lists.
+   Pass key= to remove a label.`,
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() < 2 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a proposal CID and labels"))
+		}
+
+		propCid, err := cid.Decode(cctx.Args().First())
+		if err != nil {
+			return xerrors.Errorf("parsing proposal CID: %w", err)
+		}
+
+		l, err := labels.Parse(cctx.Args().Tail())
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return api.MarketSetDealLabels(lcli.ReqContext(cctx), propCid, l)
+	},
+}
+
+var dealsInspectCmd = &cli.Command{
+	Name:      "inspect",
+	Usage:     "Show where the data of a deal is stored, and whether it can be retrieved",
+	ArgsUsage: "<deal ID>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "blocks",
+			Usage: "list the indexed payload blocks of the piece, slow with many deals",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a deal ID"))
+		}
+
+		dealID, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing deal ID: %w", err)
+		}
+
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		di, err := api.MarketInspectDeal(lcli.ReqContext(cctx), abi.DealID(dealID), cctx.Bool("blocks"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deal:         %d\n", di.DealID)
+		fmt.Printf("Proposal:     %s\n", di.ProposalCid)
+		fmt.Printf("State:        %s\n", di.State)
+		if di.Message != "" {
+			fmt.Printf("Message:      %s\n", di.Message)
+		}
+		fmt.Printf("Client:       %s\n", di.Client)
+		fmt.Printf("Epochs:       %d - %d\n", di.StartEpoch, di.EndEpoch)
+		fmt.Printf("Piece:        %s (%s)\n", di.PieceCID, types.SizeStr(types.NewInt(uint64(di.PieceSize))))
+		if di.PayloadRoot.Defined() {
+			fmt.Printf("Payload root: %s\n", di.PayloadRoot)
+		} else {
+			fmt.Printf("Payload root: unknown\n")
+		}
+
+		switch {
+		case !di.Indexed:
+			fmt.Printf("Block index:  none\n")
+		case cctx.Bool("blocks"):
+			fmt.Printf("Block index:  %d blocks\n", len(di.Blocks))
+		default:
+			fmt.Printf("Block index:  yes (--blocks to list)\n")
+		}
+
+		fmt.Println()
+		if len(di.Sectors) == 0 {
+			fmt.Println("Not placed in a sector")
+		} else {
+			tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "Sector\tOffset\tLength\tState\tUnsealed")
+			for _, p := range di.Sectors {
+				_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%t\n", p.Sector, p.Offset, types.SizeStr(types.NewInt(uint64(p.Length))), p.State, p.Unsealed)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+
+		fmt.Println()
+		if di.RetrievalReady {
+			unsealed := false
+			for _, p := range di.Sectors {
+				unsealed = unsealed || p.Unsealed
+			}
+			if unsealed {
+				fmt.Println("Retrieval:    ready")
+			} else {
+				fmt.Println("Retrieval:    ready, the sector is unsealed on request")
+			}
+		} else {
+			fmt.Println("Retrieval:    not ready")
+			for _, issue := range di.RetrievalIssues {
+				fmt.Printf("  - %s\n", issue)
+			}
+		}
+
+		if len(di.Blocks) > 0 {
+			fmt.Println()
+			tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "Block\tOffset\tSize")
+			for _, b := range di.Blocks {
+				_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\n", b.Cid, b.Offset, b.Size)
+			}
+			return tw.Flush()
+		}
+
+		return nil
+	},
+}
+
 var getBlocklistCmd = &cli.Command{
 	Name:  "get-blocklist",
 	Usage: "List the contents of the miner's piece CID blocklist",
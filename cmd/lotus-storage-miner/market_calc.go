@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-padreader"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var dealsCalcCmd = &cli.Command{
+	Name:  "calc",
+	Usage: "Calculate the collateral, escrow and lockups of a storage deal",
+	Description: `Prices a deal the way the market actor does, with the provider collateral
+   bounds of the current chain head. The payload size is padded to the piece
+   size the deal is made for.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "size",
+			Usage: "payload size, e.g. 30GiB",
+		},
+		&cli.StringFlag{
+			Name:  "duration",
+			Usage: "deal duration",
+			Value: "4320h",
+		},
+		&cli.StringFlag{
+			Name:  "price",
+			Usage: "price per GiB per epoch, in FIL",
+			Value: "0",
+		},
+		&cli.BoolFlag{
+			Name:  "verified",
+			Usage: "calculate for a verified deal",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if !cctx.IsSet("size") {
+			return xerrors.New("--size is required")
+		}
+		size, err := units.RAMInBytes(cctx.String("size"))
+		if err != nil {
+			return xerrors.Errorf("parsing size: %w", err)
+		}
+		if size <= 0 {
+			return xerrors.New("size must be positive")
+		}
+
+		dur, err := time.ParseDuration(cctx.String("duration"))
+		if err != nil {
+			return xerrors.Errorf("parsing duration: %w", err)
+		}
+		epochs := abi.ChainEpoch(dur / (time.Duration(build.BlockDelaySecs) * time.Second))
+		if epochs < build.MinDealDuration {
+			return xerrors.Errorf("minimum deal duration is %d epochs (%s)", build.MinDealDuration, time.Duration(build.MinDealDuration)*time.Duration(build.BlockDelaySecs)*time.Second)
+		}
+
+		price, err := types.ParseFIL(cctx.String("price"))
+		if err != nil {
+			return xerrors.Errorf("parsing price: %w", err)
+		}
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		pieceSize := padreader.PaddedSize(uint64(size)).Padded()
+		bounds, err := api.StateDealProviderCollateralBounds(ctx, pieceSize, cctx.Bool("verified"), types.EmptyTSK)
+		if err != nil {
+			return xerrors.Errorf("getting provider collateral bounds: %w", err)
+		}
+
+		epochPrice := big.Div(big.Mul(abi.TokenAmount(price), big.NewInt(int64(pieceSize))), big.NewInt(1<<30))
+		total := big.Mul(epochPrice, big.NewInt(int64(epochs)))
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "Piece size:\t%s\n", types.SizeStr(types.NewInt(uint64(pieceSize))))
+		_, _ = fmt.Fprintf(w, "Duration:\t%d epochs (%s)\n", epochs, dur)
+		_, _ = fmt.Fprintf(w, "Verified:\t%t\n", cctx.Bool("verified"))
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintf(w, "Price per epoch:\t%s\n", types.FIL(epochPrice))
+		_, _ = fmt.Fprintf(w, "Total storage fee:\t%s\n", types.FIL(total))
+		_, _ = fmt.Fprintf(w, "Provider collateral:\t%s (max %s)\n", types.FIL(bounds.Min), types.FIL(bounds.Max))
+		_, _ = fmt.Fprintf(w, "Client collateral:\t%s\n", types.FIL(big.Zero()))
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintln(w, "Lockups in market escrow:")
+		_, _ = fmt.Fprintf(w, "  client:\t%s\tstorage fee, paid out to the provider as the deal runs\n", types.FIL(total))
+		_, _ = fmt.Fprintf(w, "  provider:\t%s\tcollateral, returned when the deal expires\n", types.FIL(bounds.Min))
+		if cctx.Bool("verified") {
+			_, _ = fmt.Fprintf(w, "  datacap:\t%s\tof the client's datacap, used when the deal is published\n", types.SizeStr(types.NewInt(uint64(pieceSize))))
+		}
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintln(w, "Penalties:")
+		_, _ = fmt.Fprintf(w, "  not activated by the start epoch:\t%s\tprovider collateral slashed, storage fee returned to the client\n", types.FIL(bounds.Min))
+		_, _ = fmt.Fprintf(w, "  sector terminated early:\t%s\tprovider collateral slashed, unearned fee returned to the client\n", types.FIL(bounds.Min))
+		return w.Flush()
+	},
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var dealsPaymentsCmd = &cli.Command{
+	Name:  "payments",
+	Usage: "Compare the payments expected for storage deals with the ones settled on chain",
+	Description: `Lists the published deals of the miner with what they earned until the
+   chain head, what the market actor paid for them, and what was lost:
+
+     active           stored and paid as the market actor settles deals
+     settlement-late  not settled for longer than the market actor settles at
+     slashed          the rest of the payments and the collateral are lost
+     not-activated    not sealed by the start epoch, the collateral is lost
+     missing          removed from the market actor before the end epoch,
+                      the payments are unknown
+
+   The market actor settles active deals once a day, so their last
+   payments are unsettled until then. The miner records the totals hourly,
+   --history lists them.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "shortfalls",
+			Usage: "only list deals which weren't, or won't be, paid in full",
+		},
+		&cli.BoolFlag{
+			Name:  "history",
+			Usage: "list the totals of past reports",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureDealPayments); err != nil {
+			return err
+		}
+
+		if cctx.Bool("history") {
+			if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeaturePaymentHistory); err != nil {
+				return err
+			}
+
+			hist, err := nodeApi.MarketDealPaymentHistory(ctx)
+			if err != nil {
+				return err
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "Epoch\tShortfalls\tExpected\tPaid\tUnsettled\tLost\tUpcoming")
+			for _, r := range hist {
+				_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n", r.Epoch, r.Shortfalls, types.FIL(r.Expected),
+					types.FIL(r.Paid), types.FIL(r.Unsettled), types.FIL(r.Lost), types.FIL(r.Upcoming))
+			}
+			return tw.Flush()
+		}
+
+		rep, err := nodeApi.MarketDealPayments(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Deal\tClient\tEpochs\tStatus\tSettled\tExpected\tPaid\tLost")
+		for _, d := range rep.Deals {
+			if cctx.Bool("shortfalls") && !d.Status.Shortfall() {
+				continue
+			}
+
+			settled := "never"
+			if d.SettledEpoch >= 0 {
+				settled = fmt.Sprint(d.SettledEpoch)
+			}
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%d-%d\t%s\t%s\t%s\t%s\t%s\n", d.DealID, d.Client, d.StartEpoch, d.EndEpoch,
+				d.Status, settled, types.FIL(d.Expected), paid(d), types.FIL(d.Lost))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Println()
+		fmt.Printf("At epoch %d, %d deals, %d shortfalls\n", rep.Epoch, len(rep.Deals), rep.Shortfalls)
+		fmt.Printf("Expected:  %s\n", types.FIL(rep.Expected))
+		fmt.Printf("Paid:      %s\n", types.FIL(rep.Paid))
+		fmt.Printf("Unsettled: %s\n", types.FIL(rep.Unsettled))
+		fmt.Printf("Lost:      %s\n", types.FIL(rep.Lost))
+		fmt.Printf("Upcoming:  %s\n", types.FIL(rep.Upcoming))
+		return nil
+	},
+}
+
+func paid(d api.DealPayment) string {
+	if d.Status == api.DealPaymentMissing {
+		return "unknown"
+	}
+	return types.FIL(d.Paid).String()
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+	"github.com/filecoin-project/lotus/node/modules"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+// migrationManifest describes sectors sealed by another miner implementation.
+// Exporters for other distributions write their sector metadata in this
+// format; differently named fields can be mapped with --map.
+type migrationManifest struct {
+	Miner   address.Address
+	Sectors []json.RawMessage
+}
+
+type migrationSector struct {
+	SectorNumber abi.SectorNumber
+	SealProof    abi.RegisteredSealProof
+
+	CommD cid.Cid
+	CommR cid.Cid
+
+	TicketValue abi.SealRandomness
+	TicketEpoch abi.ChainEpoch
+	SeedValue   abi.InteractiveSealRandomness
+	SeedEpoch   abi.ChainEpoch
+
+	Pieces []migrationPiece
+
+	SealedPath string
+	CachePath  string
+}
+
+type migrationPiece struct {
+	Size     abi.PaddedPieceSize
+	PieceCID cid.Cid
+	DealID   abi.DealID // 0 for pledge pieces
+}
+
+var migrateCmd = &cli.Command{
+	Name:  "migrate",
+	Usage: "Tools for migrating from other miner implementations",
+	Subcommands: []*cli.Command{
+		migrateImportCmd,
+	},
+}
+
+var migrateImportCmd = &cli.Command{
+	Name:      "import",
+	Usage:     "Import sealed sectors and their metadata into this miner repo",
+	ArgsUsage: "[manifest.json]",
+	Description: `Imports sectors sealed by another miner implementation without resealing.
+
+   The manifest lists sector metadata and the paths of sealed and cache files.
+   Every sector is checked against the on-chain state of the miner actor,
+   then its files are placed in the given storage path and its metadata is
+   written to the repo datastore in the Proving state.
+
+   The miner must be stopped while importing.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "storage",
+			Usage:    "storage path of this miner to place sector files in",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "map",
+			Usage: "rename manifest sector fields, e.g. --map sector_id=SectorNumber",
+		},
+		&cli.BoolFlag{
+			Name:  "move",
+			Usage: "move sector files instead of copying them",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("expected 1 argument")
+		}
+
+		fields := map[string]string{}
+		for _, m := range cctx.StringSlice("map") {
+			kv := strings.SplitN(m, "=", 2)
+			if len(kv) != 2 {
+				return xerrors.Errorf("malformed field mapping '%s'", m)
+			}
+			fields[kv[0]] = kv[1]
+		}
+
+		sectors, maddr, err := readMigrationManifest(cctx.Args().First(), fields)
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		r, err := repo.NewFS(cctx.String(FlagMinerRepo))
+		if err != nil {
+			return err
+		}
+
+		lr, err := r.Lock(repo.StorageMiner)
+		if err != nil {
+			return xerrors.Errorf("locking repo (is the miner running?): %w", err)
+		}
+		defer lr.Close() //nolint:errcheck
+
+		mds, err := lr.Datastore("/metadata")
+		if err != nil {
+			return err
+		}
+
+		ma, err := modules.MinerAddress(mds)
+		if err != nil {
+			return xerrors.Errorf("getting miner address: %w", err)
+		}
+		if maddr != address.Undef && maddr != address.Address(ma) {
+			return xerrors.Errorf("manifest is for miner %s, this repo is for %s", maddr, address.Address(ma))
+		}
+		maddr = address.Address(ma)
+
+		mid, err := address.IDFromAddress(maddr)
+		if err != nil {
+			return err
+		}
+
+		spath, err := migrationStoragePath(lr, cctx.String("storage"))
+		if err != nil {
+			return err
+		}
+
+		maxSectorID := abi.SectorNumber(0)
+		for _, s := range sectors {
+			sectorKey := datastore.NewKey(sealing.SectorStorePrefix).ChildString(fmt.Sprint(s.SectorNumber))
+
+			has, err := mds.Has(sectorKey)
+			if err != nil {
+				return xerrors.Errorf("checking sector %d metadata: %w", s.SectorNumber, err)
+			}
+			if has {
+				return xerrors.Errorf("sector %d already exists in this repo", s.SectorNumber)
+			}
+
+			onChain, err := api.StateSectorGetInfo(ctx, maddr, s.SectorNumber, types.EmptyTSK)
+			if err != nil {
+				return xerrors.Errorf("getting on-chain info for sector %d: %w", s.SectorNumber, err)
+			}
+			if onChain == nil {
+				return xerrors.Errorf("sector %d not found on chain", s.SectorNumber)
+			}
+			if onChain.SealedCID != s.CommR {
+				return xerrors.Errorf("sector %d CommR mismatch: manifest %s, chain %s", s.SectorNumber, s.CommR, onChain.SealedCID)
+			}
+			if s.SealProof != onChain.SealProof {
+				return xerrors.Errorf("sector %d seal proof mismatch: manifest %d, chain %d", s.SectorNumber, s.SealProof, onChain.SealProof)
+			}
+
+			ssize, err := s.SealProof.SectorSize()
+			if err != nil {
+				return err
+			}
+
+			var pieces []sealing.Piece
+			for _, p := range s.Pieces {
+				piece := sealing.Piece{
+					Piece: abi.PieceInfo{
+						Size:     p.Size,
+						PieceCID: p.PieceCID,
+					},
+				}
+
+				if p.DealID != 0 {
+					deal, err := api.StateMarketStorageDeal(ctx, p.DealID, types.EmptyTSK)
+					if err != nil {
+						return xerrors.Errorf("getting deal %d for sector %d: %w", p.DealID, s.SectorNumber, err)
+					}
+					if deal.Proposal.PieceCID != p.PieceCID {
+						return xerrors.Errorf("sector %d: deal %d piece CID mismatch", s.SectorNumber, p.DealID)
+					}
+
+					piece.DealInfo = &sealing.DealInfo{
+						DealID: p.DealID,
+						DealSchedule: sealing.DealSchedule{
+							StartEpoch: deal.Proposal.StartEpoch,
+							EndEpoch:   deal.Proposal.EndEpoch,
+						},
+					}
+				}
+
+				pieces = append(pieces, piece)
+			}
+			if len(pieces) == 0 {
+				if len(onChain.DealIDs) > 0 {
+					return xerrors.Errorf("sector %d has deals on chain, but the manifest lists no pieces", s.SectorNumber)
+				}
+
+				pieces = append(pieces, sealing.Piece{
+					Piece: abi.PieceInfo{
+						Size:     abi.PaddedPieceSize(ssize),
+						PieceCID: s.CommD,
+					},
+				})
+			}
+
+			sid := abi.SectorID{Miner: abi.ActorID(mid), Number: s.SectorNumber}
+			if err := migrateSectorFile(s.SealedPath, filepath.Join(spath, stores.FTSealed.String(), stores.SectorName(sid)), cctx.Bool("move")); err != nil {
+				return xerrors.Errorf("placing sealed file of sector %d: %w", s.SectorNumber, err)
+			}
+			if err := migrateSectorFile(s.CachePath, filepath.Join(spath, stores.FTCache.String(), stores.SectorName(sid)), cctx.Bool("move")); err != nil {
+				return xerrors.Errorf("placing cache of sector %d: %w", s.SectorNumber, err)
+			}
+
+			commD, commR := s.CommD, s.CommR
+			info := &sealing.SectorInfo{
+				State:        sealing.Proving,
+				SectorNumber: s.SectorNumber,
+				SectorType:   s.SealProof,
+				Pieces:       pieces,
+				TicketValue:  s.TicketValue,
+				TicketEpoch:  s.TicketEpoch,
+				CommD:        &commD,
+				CommR:        &commR,
+				SeedValue:    s.SeedValue,
+				SeedEpoch:    s.SeedEpoch,
+			}
+
+			b, err := cborutil.Dump(info)
+			if err != nil {
+				return err
+			}
+
+			if err := mds.Put(sectorKey, b); err != nil {
+				return xerrors.Errorf("storing sector %d metadata: %w", s.SectorNumber, err)
+			}
+
+			if s.SectorNumber > maxSectorID {
+				maxSectorID = s.SectorNumber
+			}
+
+			fmt.Printf("imported sector %d\n", s.SectorNumber)
+		}
+
+		return bumpSectorCounter(mds, maxSectorID)
+	},
+}
+
+func readMigrationManifest(path string, fields map[string]string) ([]migrationSector, address.Address, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, address.Undef, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, address.Undef, xerrors.Errorf("reading manifest: %w", err)
+	}
+
+	var mf migrationManifest
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return nil, address.Undef, xerrors.Errorf("decoding manifest: %w", err)
+	}
+
+	out := make([]migrationSector, len(mf.Sectors))
+	for i, raw := range mf.Sectors {
+		if len(fields) > 0 {
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &m); err != nil {
+				return nil, address.Undef, xerrors.Errorf("decoding manifest sector %d: %w", i, err)
+			}
+			for from, to := range fields {
+				if v, ok := m[from]; ok {
+					delete(m, from)
+					m[to] = v
+				}
+			}
+			if raw, err = json.Marshal(m); err != nil {
+				return nil, address.Undef, err
+			}
+		}
+
+		if err := json.Unmarshal(raw, &out[i]); err != nil {
+			return nil, address.Undef, xerrors.Errorf("decoding manifest sector %d: %w", i, err)
+		}
+	}
+
+	return out, mf.Miner, nil
+}
+
+func migrationStoragePath(lr repo.LockedRepo, path string) (string, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return "", err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	sc, err := lr.GetStorage()
+	if err != nil {
+		return "", xerrors.Errorf("getting storage config: %w", err)
+	}
+
+	for _, p := range sc.StoragePaths {
+		if filepath.Clean(p.Path) == path {
+			return path, nil
+		}
+	}
+
+	return "", xerrors.Errorf("%s is not a storage path of this miner, attach it first", path)
+}
+
+func migrateSectorFile(from, to string, move bool) error {
+	if _, err := os.Stat(to); err == nil {
+		return xerrors.Errorf("%s already exists", to)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+
+	if move {
+		return os.Rename(from, to)
+	}
+
+	return filepath.Walk(from, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(to, rel)
+
+		if fi.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+
+		return copyFile(path, dst)
+	})
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// bumpSectorCounter makes sure newly pledged sectors don't reuse numbers of
+// imported ones
+func bumpSectorCounter(mds datastore.Datastore, maxSectorID abi.SectorNumber) error {
+	key := datastore.NewKey(modules.StorageCounterDSPrefix)
+
+	cur, err := mds.Get(key)
+	switch err {
+	case nil:
+		n, _ := binary.Uvarint(cur)
+		if abi.SectorNumber(n) >= maxSectorID {
+			return nil
+		}
+	case datastore.ErrNotFound:
+	default:
+		return xerrors.Errorf("reading sector counter: %w", err)
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	size := binary.PutUvarint(buf, uint64(maxSectorID))
+	return mds.Put(key, buf[:size])
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/ops"
+)
+
+var operationsCmd = &cli.Command{
+	Name:  "operations",
+	Usage: "Show progress of long-running operations",
+	Description: `Sealing tasks, sector fetches and market data transfers report their
+   progress as operations. PC1 progress is estimated from the SDR layers
+   written to the sector cache, fetch and transfer progress from the bytes
+   received. Operations without a known size only show how long they have
+   been running.`,
+	Subcommands: []*cli.Command{
+		operationsListCmd,
+		operationStatusCmd,
+	},
+}
+
+var operationsListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List running operations",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "include operations which finished in the last hour",
+		},
+		&cli.DurationFlag{
+			Name:  "watch",
+			Usage: "refresh the list at this interval",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		for {
+			list, err := nodeApi.OperationsList(ctx)
+			if err != nil {
+				return xerrors.Errorf("listing operations: %w", err)
+			}
+
+			if cctx.IsSet("watch") {
+				// clear the screen
+				fmt.Print("\033[H\033[2J")
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintf(tw, "ID\tSource\tKind\tDescription\tProgress\tElapsed\tETA\tStatus\n")
+			for _, st := range list {
+				if st.Finished && !cctx.Bool("all") {
+					continue
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", st.ID, st.Source, st.Kind, st.Description, progressStr(st), elapsedStr(st), etaStr(st), opStatusStr(st))
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			if !cctx.IsSet("watch") {
+				return nil
+			}
+
+			select {
+			case <-time.After(cctx.Duration("watch")):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	},
+}
+
+var operationStatusCmd = &cli.Command{
+	Name:      "status",
+	Usage:     "Show the status of an operation",
+	ArgsUsage: "[operation id]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("expected an operation ID")
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		st, err := nodeApi.OperationStatus(ctx, cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("ID:          %s\n", st.ID)
+		if st.Source != "" {
+			fmt.Printf("Source:      %s\n", st.Source)
+		}
+		fmt.Printf("Kind:        %s\n", st.Kind)
+		fmt.Printf("Description: %s\n", st.Description)
+		fmt.Printf("Started:     %s (%s ago)\n", st.Started.Format(time.RFC3339), elapsedStr(st))
+		fmt.Printf("Updated:     %s\n", st.Updated.Format(time.RFC3339))
+		fmt.Printf("Progress:    %s\n", progressStr(st))
+		if st.Total > 0 {
+			fmt.Printf("Done:        %s / %s\n", amountStr(st.Done, st.Unit), amountStr(st.Total, st.Unit))
+		} else if st.Done > 0 {
+			fmt.Printf("Done:        %s\n", amountStr(st.Done, st.Unit))
+		}
+		fmt.Printf("ETA:         %s\n", etaStr(st))
+		fmt.Printf("Status:      %s\n", opStatusStr(st))
+		if st.Error != "" {
+			fmt.Printf("Error:       %s\n", st.Error)
+		}
+
+		return nil
+	},
+}
+
+func progressStr(st ops.Status) string {
+	if st.Progress < 0 {
+		if st.Done > 0 {
+			return amountStr(st.Done, st.Unit)
+		}
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", st.Progress*100)
+}
+
+func amountStr(n uint64, unit string) string {
+	if unit == "bytes" {
+		return humanize.IBytes(n)
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+func elapsedStr(st ops.Status) string {
+	end := time.Now()
+	if st.Finished {
+		end = st.Updated
+	}
+	return end.Sub(st.Started).Truncate(time.Second).String()
+}
+
+func etaStr(st ops.Status) string {
+	if st.ETA <= 0 {
+		return "-"
+	}
+	return st.ETA.Truncate(time.Second).String()
+}
+
+func opStatusStr(st ops.Status) string {
+	switch {
+	case st.Error != "":
+		return "failed"
+	case st.Finished:
+		return "done"
+	default:
+		// nothing reported for a while may mean the operation is stuck
+		return fmt.Sprintf("running (updated %s ago)", time.Since(st.Updated).Truncate(time.Second))
+	}
+}
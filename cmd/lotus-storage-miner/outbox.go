@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var outboxCmd = &cli.Command{
+	Name:  "outbox",
+	Usage: "Manage messages waiting for an offline signature",
+	Description: `With Signing.Offline set in the config, messages of the miner are queued
+   in the outbox instead of being signed by the full node. Show a message,
+   sign the printed hex with 'lotus wallet sign' on the machine holding the
+   key, and pass the signature to 'lotus-miner outbox sign'. Messages of the
+   methods in Signing.Bypass, by default PoSt and fault declarations, are
+   signed by the full node right away.`,
+	Subcommands: []*cli.Command{
+		outboxListCmd,
+		outboxShowCmd,
+		outboxSignCmd,
+		outboxDropCmd,
+	},
+}
+
+var outboxListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List messages in the outbox",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "also list signed and failed messages",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureOutbox); err != nil {
+			return err
+		}
+
+		msgs, err := nodeApi.OutboxList(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ID\tCreated\tMethod\tFrom\tTo\tNonce\tValue\tStatus")
+		for _, m := range msgs {
+			if !m.Pending() && !cctx.Bool("all") {
+				continue
+			}
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", m.ID, m.Created.Format("2006-01-02 15:04:05"), m.Method, m.Message.From, m.Message.To, m.Message.Nonce, types.FIL(m.Message.Value), outboxStatus(m))
+		}
+		return tw.Flush()
+	},
+}
+
+var outboxShowCmd = &cli.Command{
+	Name:      "show",
+	Usage:     "Show a message and what to sign",
+	ArgsUsage: "<id>",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureOutbox); err != nil {
+			return err
+		}
+
+		m, err := outboxMessage(cctx, nodeApi)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Message %d: %s\n", m.ID, outboxStatus(m))
+		fmt.Printf("Method:  %s\n", m.Method)
+		fmt.Printf("From:    %s\n", m.Message.From)
+		fmt.Printf("To:      %s\n", m.Message.To)
+		fmt.Printf("Nonce:   %d\n", m.Message.Nonce)
+		fmt.Printf("Value:   %s\n", types.FIL(m.Message.Value))
+		fmt.Printf("Gas:     limit %d, fee cap %s, premium %s\n", m.Message.GasLimit, m.Message.GasFeeCap, m.Message.GasPremium)
+		fmt.Printf("Params:  %x\n", m.Message.Params)
+		fmt.Printf("CID:     %s\n", m.Message.Cid())
+		if m.Signed != nil {
+			fmt.Printf("Signed:  %s\n", m.Signed)
+		}
+
+		if m.Pending() {
+			fmt.Println()
+			fmt.Println("Sign on the machine holding the key with:")
+			fmt.Printf("  lotus wallet sign %s %x\n", m.Message.From, m.Message.Cid().Bytes())
+			fmt.Println("and submit the signature with:")
+			fmt.Printf("  lotus-miner outbox sign %d <signature>\n", m.ID)
+		}
+		return nil
+	},
+}
+
+var outboxSignCmd = &cli.Command{
+	Name:      "sign",
+	Usage:     "Submit the signature of a message",
+	ArgsUsage: "<id> <signature hex, as printed by 'lotus wallet sign'>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 2 {
+			return xerrors.New("expected a message id and a signature")
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureOutbox); err != nil {
+			return err
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().Get(0), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing message id: %w", err)
+		}
+		sb, err := hex.DecodeString(cctx.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("decoding signature: %w", err)
+		}
+		var sig crypto.Signature
+		if err := sig.UnmarshalBinary(sb); err != nil {
+			return xerrors.Errorf("decoding signature: %w", err)
+		}
+
+		c, err := nodeApi.OutboxSign(ctx, id, sig)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pushed message %s\n", c)
+		return nil
+	},
+}
+
+var outboxDropCmd = &cli.Command{
+	Name:      "drop",
+	Usage:     "Drop a message waiting for a signature, the miner gets an error sending it",
+	ArgsUsage: "<id>",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureOutbox); err != nil {
+			return err
+		}
+
+		m, err := outboxMessage(cctx, nodeApi)
+		if err != nil {
+			return err
+		}
+		return nodeApi.OutboxDrop(ctx, m.ID)
+	},
+}
+
+func outboxMessage(cctx *cli.Context, nodeApi api.StorageMiner) (api.OutboxMessage, error) {
+	if cctx.NArg() != 1 {
+		return api.OutboxMessage{}, xerrors.New("expected a message id")
+	}
+	id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+	if err != nil {
+		return api.OutboxMessage{}, xerrors.Errorf("parsing message id: %w", err)
+	}
+
+	msgs, err := nodeApi.OutboxList(lcli.ReqContext(cctx))
+	if err != nil {
+		return api.OutboxMessage{}, err
+	}
+	for _, m := range msgs {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return api.OutboxMessage{}, xerrors.Errorf("outbox message %d not found", id)
+}
+
+func outboxStatus(m api.OutboxMessage) string {
+	switch {
+	case m.Error != "":
+		return "failed: " + m.Error
+	case m.Signed != nil:
+		return "sent"
+	default:
+		return "waiting for a signature"
+	}
+}
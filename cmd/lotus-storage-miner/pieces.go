@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"text/tabwriter"
 
+	"github.com/filecoin-project/go-state-types/abi"
+
 	lcli "github.com/filecoin-project/lotus/cli"
 	"github.com/ipfs/go-cid"
 	"github.com/urfave/cli/v2"
@@ -19,6 +22,8 @@ var piecesCmd = &cli.Command{
 		piecesListCidInfosCmd,
 		piecesInfoCmd,
 		piecesCidInfoCmd,
+		piecesBuildIndexCmd,
+		piecesLocateBlockCmd,
 	},
 }
 
@@ -138,3 +143,80 @@ var piecesCidInfoCmd = &cli.Command{
 		return w.Flush()
 	},
 }
+
+var piecesBuildIndexCmd = &cli.Command{
+	Name:      "build-index",
+	Usage:     "index the payload blocks of the deals in a sector",
+	ArgsUsage: "<sectorNum>",
+	Description: `Deal pieces are indexed when they are added to a sector, this builds the
+   index for sectors sealed before. Pieces are unsealed when the sector has no
+   unsealed copy.`,
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return lcli.ShowHelp(cctx, fmt.Errorf("must specify sector number"))
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse sector number: %w", err)
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		indexes, err := nodeApi.PiecesBuildIndex(ctx, abi.SectorNumber(id))
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Deal\tOffset\tBlocks\n")
+		for _, idx := range indexes {
+			fmt.Fprintf(w, "%d\t%d\t%d\n", idx.Deal, idx.PieceOffset, idx.Blocks)
+		}
+		return w.Flush()
+	},
+}
+
+var piecesLocateBlockCmd = &cli.Command{
+	Name:      "locate-block",
+	Usage:     "find a payload block in the unsealed data of a sector",
+	ArgsUsage: "<sectorNum> <blockCid>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return lcli.ShowHelp(cctx, fmt.Errorf("must specify sector number and block cid"))
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().Get(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("could not parse sector number: %w", err)
+		}
+		c, err := cid.Decode(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		loc, err := nodeApi.PiecesLocateBlock(ctx, abi.SectorNumber(id), c)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deal: %d\n", loc.Deal)
+		fmt.Printf("Piece offset: %d\n", loc.PieceOffset)
+		fmt.Printf("Offset: %d\n", loc.Offset)
+		fmt.Printf("Size: %d\n", loc.Size)
+		fmt.Printf("\nRead with: lotus-miner sectors read %d %d %d\n", loc.Sector, loc.Offset, loc.Size)
+		return nil
+	},
+}
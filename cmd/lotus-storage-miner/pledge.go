@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/storage/pledger"
+)
+
+// pledgePolicy is the policy of the in-process pledge loop of --pledge-sector,
+// lotus-pledge-controller has more settings
+func pledgePolicy(ps dtypes.PledgeSettings) pledger.Policy {
+	return pledger.Policy{
+		Interval:       ps.Interval,
+		ReserveWorkers: ps.ReserveWorkers,
+		MaxSectors:     ps.MaxSectors,
+		MinFree:        ps.MinFree,
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-state-types/abi"
+
 	"github.com/filecoin-project/lotus/api/apibstore"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/store"
@@ -25,6 +27,8 @@ var provingCmd = &cli.Command{
 		provingDeadlinesCmd,
 		provingDeadlineInfoCmd,
 		provingFaultsCmd,
+		provingPenaltyEstimateCmd,
+		provingForceSubmitAllCmd,
 	},
 }
 
@@ -241,6 +245,8 @@ var provingDeadlinesCmd = &cli.Command{
 		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
 		_, _ = fmt.Fprintln(tw, "deadline\tpartitions\tsectors (faults)\tproven partitions")
 
+		var totalParts, maxParts int
+
 		for dlIdx, deadline := range deadlines {
 			partitions, err := api.StateMinerPartitions(ctx, maddr, uint64(dlIdx), types.EmptyTSK)
 			if err != nil {
@@ -271,6 +277,11 @@ var provingDeadlinesCmd = &cli.Command{
 				faults += fc
 			}
 
+			totalParts += len(partitions)
+			if len(partitions) > maxParts {
+				maxParts = len(partitions)
+			}
+
 			var cur string
 			if di.Index == uint64(dlIdx) {
 				cur += "\t(current)"
@@ -278,7 +289,22 @@ var provingDeadlinesCmd = &cli.Command{
 			_, _ = fmt.Fprintf(tw, "%d\t%d\t%d (%d)\t%d%s\n", dlIdx, len(partitions), sectors, faults, provenPartitions, cur)
 		}
 
-		return tw.Flush()
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		// commits are held back for new sectors to land in the least loaded
+		// deadlines, an existing uneven layout can only be improved by
+		// compacting partitions
+		if len(deadlines) == 0 {
+			return nil
+		}
+		balanced := (totalParts + len(deadlines) - 1) / len(deadlines)
+		if maxParts > balanced {
+			fmt.Printf("\nMost partitions in a deadline: %d, %d when balanced; compacting partitions of the largest deadlines may help\n", maxParts, balanced)
+		}
+
+		return nil
 	},
 }
 
@@ -371,3 +397,52 @@ var provingDeadlineInfoCmd = &cli.Command{
 		return nil
 	},
 }
+
+var provingForceSubmitAllCmd = &cli.Command{
+	Name:  "force-submit-all",
+	Usage: "Compute and submit proofs for all unproven partitions of the open deadline now, with raised fees",
+	Description: `For recovering from an outage minutes before a challenge window closes. The
+   proofs are computed right away, replacing a window PoSt the miner is
+   computing for the deadline, and sent with a raised gas premium.`,
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:     "deadline",
+			Usage:    "index of the open deadline, guards against proving for the wrong one",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "max-fee",
+			Usage: "fee limit of each PoSt message in FIL, 4 times MaxWindowPoStGasFee by default",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		maxFee := abi.NewTokenAmount(0)
+		if cctx.IsSet("max-fee") {
+			f, err := types.ParseFIL(cctx.String("max-fee"))
+			if err != nil {
+				return xerrors.Errorf("parsing max-fee: %w", err)
+			}
+			maxFee = abi.TokenAmount(f)
+		}
+
+		msgs, err := nodeApi.ProvingForceSubmit(ctx, cctx.Uint64("deadline"), maxFee)
+		for _, m := range msgs {
+			fmt.Println("Submitted window PoSt:", m)
+		}
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			fmt.Println("Nothing to prove, the partitions of the deadline are proven or have no active sectors")
+		}
+		return nil
+	},
+}
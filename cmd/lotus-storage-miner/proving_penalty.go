@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/dline"
+	"github.com/filecoin-project/go-state-types/network"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api/apibstore"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/power"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/reward"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var provingPenaltyEstimateCmd = &cli.Command{
+	Name:  "penalty-estimate",
+	Usage: "Estimate fault fees and lost rewards of taking the miner offline",
+	Description: `Deadlines with a challenge window overlapping the downtime are counted as
+   missed. Without --start, every deadline opening in the next proving period is
+   tried as a start, to find the cheapest maintenance window.`,
+	Flags: []cli.Flag{
+		&cli.Float64Flag{
+			Name:     "offline-hours",
+			Usage:    "planned downtime in hours",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "start",
+			Usage: "start of the downtime, as an epoch or an RFC3339 time",
+		},
+		&cli.BoolFlag{
+			Name:  "declare-faults",
+			Usage: "assume faults are declared before the downtime starts",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		api, acloser, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer acloser()
+
+		ctx := lcli.ReqContext(cctx)
+
+		maddr, err := getActorAddress(ctx, nodeApi, cctx.String("actor"))
+		if err != nil {
+			return err
+		}
+
+		head, err := api.ChainHead(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting chain head: %w", err)
+		}
+
+		stor := store.ActorStore(ctx, apibstore.NewAPIBlockstore(api))
+
+		mact, err := api.StateGetActor(ctx, maddr, head.Key())
+		if err != nil {
+			return err
+		}
+		mas, err := miner.Load(stor, mact)
+		if err != nil {
+			return err
+		}
+
+		ract, err := api.StateGetActor(ctx, reward.Address, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting reward actor: %w", err)
+		}
+		rst, err := reward.Load(stor, ract)
+		if err != nil {
+			return err
+		}
+
+		pact, err := api.StateGetActor(ctx, power.Address, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting power actor: %w", err)
+		}
+		pst, err := power.Load(stor, pact)
+		if err != nil {
+			return err
+		}
+
+		m := &penaltyModel{
+			declared: cctx.Bool("declare-faults"),
+		}
+
+		if m.reward, err = rst.ThisEpochRewardSmoothed(); err != nil {
+			return xerrors.Errorf("getting reward estimate: %w", err)
+		}
+		if m.netQA, err = pst.TotalPowerSmoothed(); err != nil {
+			return xerrors.Errorf("getting network power estimate: %w", err)
+		}
+		if m.nv, err = api.StateNetworkVersion(ctx, head.Key()); err != nil {
+			return xerrors.Errorf("getting network version: %w", err)
+		}
+		if m.dl, err = api.StateMinerProvingDeadline(ctx, maddr, head.Key()); err != nil {
+			return xerrors.Errorf("getting proving deadline: %w", err)
+		}
+
+		mp, err := api.StateMinerPower(ctx, maddr, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting miner power: %w", err)
+		}
+		m.totalQA = mp.MinerPower.QualityAdjPower
+
+		// split the miner power across deadlines by their active sectors
+		active := make([]uint64, m.dl.WPoStPeriodDeadlines)
+		var totalActive uint64
+		if err := mas.ForEachDeadline(func(dlIdx uint64, dl miner.Deadline) error {
+			return dl.ForEachPartition(func(partIdx uint64, part miner.Partition) error {
+				bf, err := part.ActiveSectors()
+				if err != nil {
+					return err
+				}
+				count, err := bf.Count()
+				if err != nil {
+					return err
+				}
+				active[dlIdx] += count
+				totalActive += count
+				return nil
+			})
+		}); err != nil {
+			return xerrors.Errorf("walking miner deadlines and partitions: %w", err)
+		}
+
+		m.dlPower = make([]abi.StoragePower, len(active))
+		for i, count := range active {
+			m.dlPower[i] = big.Zero()
+			if totalActive > 0 {
+				m.dlPower[i] = big.Div(big.Mul(m.totalQA, big.NewInt(int64(count))), big.NewInt(int64(totalActive)))
+			}
+		}
+
+		duration := abi.ChainEpoch(cctx.Float64("offline-hours") * 3600 / float64(build.BlockDelaySecs))
+		if duration <= 0 {
+			return xerrors.Errorf("offline-hours must be positive")
+		}
+
+		var starts []abi.ChainEpoch
+		if s := cctx.String("start"); s != "" {
+			start, err := parseEpochOrTime(s, head.Height())
+			if err != nil {
+				return err
+			}
+			starts = append(starts, start)
+		} else {
+			// deadline openings in the next proving period, starting with the next one
+			next := m.dl.Open + m.dl.WPoStChallengeWindow
+			for i := uint64(0); i < m.dl.WPoStPeriodDeadlines; i++ {
+				starts = append(starts, next+abi.ChainEpoch(i)*m.dl.WPoStChallengeWindow)
+			}
+		}
+
+		best := -1
+		ests := make([]penaltyEstimate, len(starts))
+		for i, start := range starts {
+			ests[i] = m.estimate(start, duration)
+			if best < 0 || ests[i].total().LessThan(ests[best].total()) {
+				best = i
+			}
+		}
+
+		fmt.Printf("Miner:        %s\n", maddr)
+		fmt.Printf("QA Power:     %s\n", types.SizeStr(m.totalQA))
+		fmt.Printf("Downtime:     %d epochs\n\n", duration)
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Start\tMissed Windows\tFault Fees\tLost Rewards\tTotal\t")
+		for i, est := range ests {
+			mark := ""
+			if len(ests) > 1 && i == best {
+				mark = "(cheapest)"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", lcli.EpochTime(head.Height(), est.start), est.missed,
+				types.FIL(est.faultFees), types.FIL(est.lostRewards), types.FIL(est.total()), mark)
+		}
+		return tw.Flush()
+	},
+}
+
+func parseEpochOrTime(s string, cur abi.ChainEpoch) (abi.ChainEpoch, error) {
+	if e, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return abi.ChainEpoch(e), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, xerrors.Errorf("start must be an epoch or an RFC3339 time: %w", err)
+	}
+
+	return cur + abi.ChainEpoch(time.Until(t)/(time.Duration(build.BlockDelaySecs)*time.Second)), nil
+}
+
+type penaltyModel struct {
+	dl       *dline.Info
+	dlPower  []abi.StoragePower
+	totalQA  abi.StoragePower
+	reward   builtin.FilterEstimate
+	netQA    builtin.FilterEstimate
+	nv       network.Version
+	declared bool
+}
+
+type penaltyEstimate struct {
+	start       abi.ChainEpoch
+	missed      int
+	faultFees   abi.TokenAmount
+	lostRewards abi.TokenAmount
+}
+
+func (e penaltyEstimate) total() abi.TokenAmount {
+	return big.Add(e.faultFees, e.lostRewards)
+}
+
+// estimate computes the cost of being offline for duration epochs from start.
+// The first missed window of a deadline pays the undeclared fault penalty,
+// unless faults were declared, every further window pays the fault fee. No
+// blocks are won while offline, and faulty power doesn't win blocks until it's
+// proven at the first window of its deadline after the downtime.
+func (m *penaltyModel) estimate(start, duration abi.ChainEpoch) penaltyEstimate {
+	end := start + duration
+
+	est := penaltyEstimate{
+		start:       start,
+		faultFees:   big.Zero(),
+		lostRewards: miner0.ExpectedRewardForPower(&m.reward, &m.netQA, m.totalQA, duration),
+	}
+
+	for dlIdx, pow := range m.dlPower {
+		if pow.IsZero() {
+			continue
+		}
+
+		open := m.dl.PeriodStart + abi.ChainEpoch(dlIdx)*m.dl.WPoStChallengeWindow
+		for open+m.dl.WPoStChallengeWindow <= start {
+			open += m.dl.WPoStProvingPeriod
+		}
+		for open > start+m.dl.WPoStProvingPeriod {
+			open -= m.dl.WPoStProvingPeriod
+		}
+
+		missed := 0
+		for ; open < end; open += m.dl.WPoStProvingPeriod {
+			if missed == 0 && !m.declared {
+				est.faultFees = big.Add(est.faultFees, miner0.PledgePenaltyForUndeclaredFault(&m.reward, &m.netQA, pow, m.nv))
+			} else {
+				est.faultFees = big.Add(est.faultFees, miner0.PledgePenaltyForDeclaredFault(&m.reward, &m.netQA, pow, m.nv))
+			}
+			missed++
+		}
+
+		if missed > 0 {
+			recovered := open + m.dl.WPoStChallengeWindow
+			est.lostRewards = big.Add(est.lostRewards, miner0.ExpectedRewardForPower(&m.reward, &m.netQA, pow, recovered-end))
+			est.missed += missed
+		}
+	}
+
+	return est
+}
@@ -20,6 +20,7 @@ var retrievalDealsCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		retrievalDealSelectionCmd,
 		retrievalDealsListCmd,
+		retrievalDealsStatusCmd,
 		retrievalSetAskCmd,
 		retrievalGetAskCmd,
 	},
@@ -122,6 +123,50 @@ var retrievalDealSelectionRejectCmd = &cli.Command{
 	},
 }
 
+var retrievalDealsStatusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "Show the retrieval serving limits and the current load",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		st, err := api.MarketRetrievalStats(lcli.DaemonContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		limit := func(n int) string {
+			if n <= 0 {
+				return "no limit"
+			}
+			return fmt.Sprint(n)
+		}
+
+		fmt.Printf("Retrievals: %d (max %s, %s per client)\n", st.Active, limit(st.MaxActive), limit(st.MaxPerClient))
+		fmt.Printf("Unseals:    %d running, %d queued (max %s)\n", st.RunningUnseals, st.QueuedUnseals, limit(st.MaxUnseals))
+		fmt.Printf("Rejected:   %d at the retrieval limit, %d at the client limit\n", st.RejectedBusy, st.RejectedClient)
+
+		if len(st.Clients) == 0 {
+			return nil
+		}
+
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "Client\tRetrievals\tUnsealing\tQueued")
+		for _, c := range st.Clients {
+			client := c.Client.String()
+			if c.Client == "" {
+				client = "(unknown)"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", client, c.Active, c.RunningUnseals, c.QueuedUnseals)
+		}
+		return w.Flush()
+	},
+}
+
 var retrievalDealsListCmd = &cli.Command{
 	Name:  "list",
 	Usage: "List all active retrieval deals for this miner",
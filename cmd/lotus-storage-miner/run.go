@@ -2,108 +2,266 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
+	"time"
 
+	"contrib.go.opencensus.io/exporter/prometheus"
+	"github.com/coreos/go-systemd/v22/daemon"
 	mux "github.com/gorilla/mux"
-	"github.com/multiformats/go-multiaddr"
+	"github.com/mitchellh/go-homedir"
 	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/urfave/cli/v2"
+	"go.opencensus.io/stats/view"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-jsonrpc"
 	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/filecoin-project/go-state-types/abi"
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/api/client"
 	"github.com/filecoin-project/lotus/build"
 	lcli "github.com/filecoin-project/lotus/cli"
+	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/lib/addrutil"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/lib/quota"
+	"github.com/filecoin-project/lotus/lib/rpcenc"
 	"github.com/filecoin-project/lotus/lib/ulimit"
+	"github.com/filecoin-project/lotus/metrics"
 	"github.com/filecoin-project/lotus/node"
 	"github.com/filecoin-project/lotus/node/impl"
+	"github.com/filecoin-project/lotus/node/modules"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/reload"
 	"github.com/filecoin-project/lotus/node/repo"
+	"github.com/filecoin-project/lotus/node/webui"
+	"github.com/filecoin-project/lotus/storage/outbox"
+	"github.com/filecoin-project/lotus/storage/pledger"
+	"github.com/filecoin-project/lotus/storage/sectorblocks"
+	"github.com/filecoin-project/lotus/storage/syncgate"
+	"github.com/filecoin-project/lotus/storage/workertokens"
 )
 
 var runCmd = &cli.Command{
 	Name:  "run",
 	Usage: "Start a lotus miner process",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:  "api",
-			Usage: "2345",
+			Usage: "address to serve the API on: a port on localhost (2345), host:port (0.0.0.0:2345, [::]:2345), or a multiaddr (/unix/path/to/api.sock for a unix socket); defaults to API.ListenAddress from the config",
 		},
 		&cli.BoolFlag{
 			Name:  "enable-gpu-proving",
-			Usage: "enable use of GPU for mining operations",
-			Value: true,
+			Usage: "enable use of GPU for mining operations (Startup.EnableGPUProving)",
+		},
+		&cli.Int64Flag{
+			Name:  "max-sync-lag",
+			Usage: "epochs the full node may be behind, messages aren't sent while it's further behind; -1 disables the check (Startup.MaxSyncLag)",
+		},
+		&cli.BoolFlag{
+			Name:   "nosync",
+			Usage:  "deprecated, same as --max-sync-lag=-1",
+			Hidden: true,
+		},
+		&cli.StringFlag{
+			Name:  "fullnode-api",
+			Usage: "token:multiaddr of the full node API, a comma separated list connects to several nodes; overrides FULLNODE_API_INFO (Startup.FullNodeAPI)",
+		},
+		&cli.BoolFlag{
+			Name:  "fullnode-failover",
+			Usage: "with several full nodes, use the first one in sync and fail over in order, instead of routing by latency (Startup.FullNodeFailover)",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-degraded",
+			Usage: "serve a minimal API while the full node is unreachable, instead of exiting (Startup.AllowDegraded)",
 		},
 		&cli.BoolFlag{
-			Name:  "nosync",
-			Usage: "don't check full-node sync status",
+			Name:  "webui",
+			Usage: "serve a web UI with sector timelines on /ui, open it with ?token=<API token> (Startup.WebUI)",
+		},
+		&cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "path of a PEM certificate to serve the API over HTTPS with (Startup.TLSCert)",
+		},
+		&cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "path of the PEM key of the TLS certificate (Startup.TLSKey)",
 		},
 		&cli.BoolFlag{
 			Name:  "manage-fdlimit",
-			Usage: "manage open file limit",
-			Value: true,
+			Usage: "manage open file limit (Startup.ManageFDLimit)",
 		},
-	},
+		&cli.BoolFlag{
+			Name:  "pledge-sector",
+			Usage: "keep idle workers busy by pledging committed capacity sectors (Startup.PledgeSector), see lotus-pledge-controller for a separate process with more settings",
+		},
+		&cli.DurationFlag{
+			Name:  "pledge-interval",
+			Usage: "how often --pledge-sector checks for idle workers (Startup.PledgeInterval)",
+		},
+		&cli.Uint64Flag{
+			Name:  "pledge-max-sectors",
+			Usage: "stop pledging once the miner has this many sectors (Startup.PledgeMaxSectors)",
+		},
+		&cli.StringFlag{
+			Name:  "pledge-min-free",
+			Usage: "stop pledging when sector storage has less free space than this, e.g. 1TiB (Startup.PledgeMinFree)",
+		},
+		&cli.IntFlag{
+			Name:  "pledge-reserve-workers",
+			Usage: "number of idle workers to keep free for deals (Startup.PledgeReserveWorkers)",
+		},
+		&cli.DurationFlag{
+			Name:  "shutdown-grace",
+			Usage: "time in-flight API requests get to finish on shutdown (Startup.ShutdownGrace)",
+		},
+		&cli.DurationFlag{
+			Name:  "shutdown-timeout",
+			Usage: "exit forcefully when shutdown takes longer than this (Startup.ShutdownTimeout)",
+		},
+		&cli.BoolFlag{
+			Name:  "drain-on-shutdown",
+			Usage: "on SIGTERM, wait for assigned sealing tasks to finish before shutting down (Startup.DrainOnShutdown)",
+		},
+		&cli.DurationFlag{
+			Name:  "drain-timeout",
+			Usage: "give up waiting for sealing tasks after this long (Startup.DrainTimeout)",
+		},
+		&cli.DurationFlag{
+			Name:  "api-slow-call",
+			Usage: "log API calls taking longer than this with their parameters, 0 disables the log (Startup.APISlowCall)",
+		},
+		&cli.StringFlag{
+			Name:  "pprof-serve",
+			Usage: "where to serve pprof: 'api' on the API endpoint, 'off', or a localhost address like 127.0.0.1:6060 only admin tokens can use (API.Pprof)",
+		},
+	}, lcli.DaemonizeFlags...),
 	Action: func(cctx *cli.Context) error {
-		if !cctx.Bool("enable-gpu-proving") {
-			err := os.Setenv("BELLMAN_NO_GPU", "true")
-			if err != nil {
-				return err
-			}
+		minerRepoPath := cctx.String(FlagMinerRepo)
+		repoDir, err := homedir.Expand(minerRepoPath)
+		if err != nil {
+			return err
 		}
+		closePid, exit, err := lcli.Daemonize(cctx, filepath.Join(repoDir, "miner.log"))
+		if err != nil || exit {
+			return err
+		}
+		defer closePid()
+
+		ctx := lcli.DaemonContext(cctx)
 
-		nodeApi, ncloser, err := lcli.GetFullNodeAPI(cctx)
+		r, err := repo.NewFS(minerRepoPath)
 		if err != nil {
 			return err
 		}
-		defer ncloser()
-		ctx := lcli.DaemonContext(cctx)
 
-		v, err := nodeApi.Version(ctx)
+		ok, err := r.Exists()
 		if err != nil {
 			return err
 		}
+		if !ok {
+			return xerrors.Errorf("repo at '%s' is not initialized, run 'lotus-miner init' to set it up", minerRepoPath)
+		}
 
-		if cctx.Bool("manage-fdlimit") {
-			if _, _, err := ulimit.ManageFdLimit(); err != nil {
-				log.Errorf("setting file descriptor limit: %s", err)
+		cfg, err := minerConfig(r)
+		if err != nil {
+			return err
+		}
+		opt := runOptions(cctx, cfg.Startup)
+		if err := checkTLS(opt); err != nil {
+			return err
+		}
+
+		if !opt.EnableGPUProving {
+			err := os.Setenv("BELLMAN_NO_GPU", "true")
+			if err != nil {
+				return err
 			}
 		}
 
-		if v.APIVersion != build.FullAPIVersion {
-			return xerrors.Errorf("lotus-daemon API version doesn't match: expected: %s", api.Version{APIVersion: build.FullAPIVersion})
+		if opt.FullNodeAPI != "" {
+			if _, ok := os.LookupEnv("FULLNODE_API_INFO"); !ok || cctx.IsSet("fullnode-api") {
+				if err := os.Setenv("FULLNODE_API_INFO", opt.FullNodeAPI); err != nil {
+					return err
+				}
+			}
 		}
 
-		log.Info("Checking full node sync status")
+		nodeApi, ncloser, v, err := dialFullNode(ctx, cctx, opt)
+		if err != nil {
+			if !opt.AllowDegraded {
+				return err
+			}
 
-		if !cctx.Bool("nosync") {
-			if err := lcli.SyncWait(ctx, nodeApi); err != nil {
-				return xerrors.Errorf("sync wait: %w", err)
+			log.Warnf("full node unreachable, starting in degraded mode: %s", err)
+			nodeApi, ncloser, v, err = runDegraded(ctx, cctx, r, opt)
+			if err == errStoppedDegraded {
+				return nil
+			}
+			if err != nil {
+				return xerrors.Errorf("degraded mode: %w", err)
 			}
 		}
+		nodeApi, ncloser = client.NewReconnectingFullNode(ctx, nodeApi, ncloser, func(ctx context.Context) (api.FullNode, jsonrpc.ClientCloser, error) {
+			n, closer, v, err := dialFullNode(ctx, cctx, opt)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := v.CheckCompatible(build.FullAPIVersion); err != nil {
+				closer()
+				return nil, nil, xerrors.Errorf("lotus-daemon API isn't compatible: %w", err)
+			}
+			return n, closer, nil
+		})
+		defer ncloser()
 
-		minerRepoPath := cctx.String(FlagMinerRepo)
-		r, err := repo.NewFS(minerRepoPath)
-		if err != nil {
-			return err
+		if opt.ManageFDLimit {
+			if _, _, err := ulimit.ManageFdLimit(); err != nil {
+				log.Errorf("setting file descriptor limit: %s", err)
+			}
 		}
 
-		ok, err := r.Exists()
+		if err := v.CheckCompatible(build.FullAPIVersion); err != nil {
+			return xerrors.Errorf("lotus-daemon API isn't compatible: %w", err)
+		}
+
+		if err := lcli.CheckRemoteBuild(ctx, nodeApi); err != nil {
+			return xerrors.Errorf("checking lotus-daemon: %w", err)
+		}
+
+		gate := syncgate.New(nodeApi, abi.ChainEpoch(opt.MaxSyncLag))
+		sl, err := gate.Check(ctx)
 		if err != nil {
-			return err
+			return xerrors.Errorf("checking full node sync status: %w", err)
 		}
-		if !ok {
-			return xerrors.Errorf("repo at '%s' is not initialized, run 'lotus-miner init' to set it up", minerRepoPath)
+		if !sl.InSync {
+			log.Warnw("full node is behind, messages aren't sent until it catches up", "head", sl.Head, "lag", sl.Lag, "max-lag", sl.MaxLag)
+			sdNotify(fmt.Sprintf("STATUS=full node is %d epochs behind", sl.Lag))
+		}
+		go gate.Run(ctx)
+		full := &syncgate.FullNode{FullNode: nodeApi, Gate: gate}
+
+		markets := cfg.Subsystems.SealerAPIInfo != ""
+		var sealerBuilder *sectorblocks.RemoteBuilder
+		if markets {
+			builder, scloser, err := dialSealer(ctx, cfg.Subsystems.SealerAPIInfo)
+			if err != nil {
+				return xerrors.Errorf("connecting to the sealing miner: %w", err)
+			}
+			defer scloser()
+
+			log.Infof("running as markets node of sealing miner %s", builder.Address())
+			sealerBuilder = builder
 		}
 
 		shutdownChan := make(chan struct{})
+		pledgeCtl := new(dtypes.PledgeControl)
 
 		var minerapi api.StorageMiner
 		stop, err := node.New(ctx,
@@ -114,9 +272,24 @@ var runCmd = &cli.Command{
 
 			node.ApplyIf(func(s *node.Settings) bool { return cctx.IsSet("api") },
 				node.Override(new(dtypes.APIEndpoint), func() (dtypes.APIEndpoint, error) {
-					return multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/" + cctx.String("api"))
+					return addrutil.ParseListenAddress(cctx.String("api"))
 				})),
-			node.Override(new(api.FullNode), nodeApi),
+			node.Override(new(api.FullNode), full),
+			node.Override(new(*syncgate.Gate), gate),
+			node.If(cfg.Signing.Offline,
+				node.Override(new(*outbox.Outbox), modules.Outbox(full, cfg.Signing)),
+				node.Override(new(api.FullNode), modules.OutboxFullNode(full)),
+			),
+			node.Override(new(*dtypes.PledgeControl), pledgeCtl),
+			node.If(markets,
+				node.Override(new(sectorblocks.SectorBuilder), sealerBuilder),
+			),
+			node.If(opt.TLSCert != "",
+				node.Override(node.SetApiEndpointKey, func(lr repo.LockedRepo, e dtypes.APIEndpoint) error {
+					return lr.SetAPIEndpoint(addrutil.WithTLS(e))
+				}),
+				node.Override(new(sectorstorage.URLs), tlsStorageURLs),
+			),
 		)
 		if err != nil {
 			return err
@@ -139,47 +312,144 @@ var runCmd = &cli.Command{
 
 		log.Infof("Remote version %s", v)
 
-		lst, err := manet.Listen(endpoint)
+		if opt.PledgeSector && markets {
+			log.Warn("not pledging sectors on a markets node, --pledge-sector is for the sealing miner")
+		}
+		if opt.PledgeSector && !markets {
+			// flags override the config file, until its pledge settings change and
+			// it is reloaded
+			ps, err := reload.PledgeSettings(opt)
+			if err != nil {
+				return err
+			}
+			pledgeCtl.SetSettings(ps)
+
+			// the interval and limits are read on every check, so reloaded
+			// settings apply right away
+			pl := pledger.New(minerapi, pledgeCtl, func() pledger.Policy {
+				return pledgePolicy(pledgeCtl.Settings())
+			})
+
+			pledgeCtl.SetRunning(true)
+			go crash.Run(ctx, "pledge-sector", pl.Run)
+		}
+
+		if err := view.Register(metrics.MinerViews...); err != nil {
+			return xerrors.Errorf("registering metric views: %w", err)
+		}
+
+		exporter, err := prometheus.NewExporter(prometheus.Options{
+			Namespace: "lotus",
+		})
+		if err != nil {
+			return xerrors.Errorf("creating prometheus exporter: %w", err)
+		}
+
+		lst, err := listenAPI(endpoint, opt)
 		if err != nil {
 			return xerrors.Errorf("could not listen: %w", err)
 		}
 
 		mux := mux.NewRouter()
 
-		rpcServer := jsonrpc.NewServer()
-		rpcServer.Register("Filecoin", apistruct.PermissionedStorMinerAPI(minerapi))
+		sm := minerapi.(*impl.StorageMinerAPI)
+
+		served := minerapi
+		if markets {
+			served = apistruct.MarketsStorMinerAPI(minerapi)
+		}
+
+		trace, err := node.APITrace(cfg.API, minerRepoPath)
+		if err != nil {
+			return xerrors.Errorf("opening API trace: %w", err)
+		}
+		rpcAPI := served
+		if trace != nil {
+			defer trace.Close() //nolint:errcheck
+			rpcAPI = apistruct.TracedStorMinerAPI(served, trace)
+		}
+		if sm.WorkerTokens != nil {
+			rpcAPI = apistruct.WorkerTokenStorMinerAPI(rpcAPI, sm.WorkerTokens)
+		}
 
-		mux.Handle("/rpc/v0", rpcServer)
-		mux.PathPrefix("/remote").HandlerFunc(minerapi.(*impl.StorageMinerAPI).ServeRemote)
-		mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
+		// markets nodes push deal data for SectorAddPieceToAny as streams
+		readerHandler, readerServerOpt := rpcenc.ReaderParamDecoder()
+		rpcServer := jsonrpc.NewServer(readerServerOpt)
+		limiter := node.RPCLimiter(cfg.API.Limits)
+		rpcServer.Register("Filecoin", apistruct.PermissionedStorMinerAPI(apistruct.LimitedStorMinerAPI(apistruct.QuotaStorMinerAPI(metrics.MetricedStorMinerAPI(rpcAPI, time.Duration(opt.APISlowCall)), sm.Quotas), limiter)))
+
+		// only RPC connections are capped, workers fetch sectors through /remote
+		mux.Handle("/rpc/v0", limiter.Handler(rpcServer))
+		mux.Handle("/rpc/streams/v0/push/{uuid}", readerHandler)
+		mux.PathPrefix("/remote/params").HandlerFunc(sm.ServeParams)
+		if !markets {
+			mux.PathPrefix("/remote/pieces").HandlerFunc(sm.ServePiece)
+			mux.PathPrefix("/remote").HandlerFunc(sm.Quotas.MeterRemote(sm.ServeRemote))
+		}
+		mux.Handle("/debug/metrics", exporter)
+		mux.Handle("/metrics", exporter)
+		if opt.WebUI {
+			mux.PathPrefix("/ui").Handler(webui.New("/ui", served))
+		}
+		if cctx.IsSet("pprof-serve") {
+			cfg.API.Pprof = cctx.String("pprof-serve")
+		}
+		switch cfg.API.Pprof {
+		case node.PprofAPI:
+			mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
+		case node.PprofOff, "":
+		default:
+			psrv, err := node.ServePprof(cfg.API.Pprof, minerapi.AuthVerify)
+			if err != nil {
+				return err
+			}
+			defer psrv.Close() //nolint:errcheck
+		}
 
 		ah := &auth.Handler{
 			Verify: minerapi.AuthVerify,
-			Next:   mux.ServeHTTP,
+			Next: (&quota.Handler{
+				Parse: sm.TokenQuota,
+				Next: &workertokens.Handler{
+					Parse: sm.TokenWorker,
+					Next:  mux,
+				},
+			}).ServeHTTP,
 		}
 
-		srv := &http.Server{Handler: ah}
+		drain := &node.DrainHandler{Next: &metrics.CallerHandler{Next: ah}}
 
-		sigChan := make(chan os.Signal, 2)
-		go func() {
-			select {
-			case sig := <-sigChan:
-				log.Warnw("received shutdown", "signal", sig)
-			case <-shutdownChan:
-				log.Warn("received shutdown")
-			}
+		// health probes bypass auth and draining, /readyz reports draining
+		health := &healthHandler{full: nodeApi, miner: sm.Miner, drain: drain}
+		root := http.NewServeMux()
+		root.HandleFunc("/healthz", health.healthz)
+		root.HandleFunc("/readyz", health.readyz)
+		root.Handle("/", drain)
 
-			log.Warn("Shutting down...")
-			if err := stop(context.TODO()); err != nil {
-				log.Errorf("graceful shutting down failed: %s", err)
-			}
-			if err := srv.Shutdown(context.TODO()); err != nil {
-				log.Errorf("shutting down RPC server failed: %s", err)
-			}
-			log.Warn("Graceful shutdown successful")
-		}()
-		signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+		srv := &http.Server{Handler: node.CORSHandler(cfg.API.CORS, root)}
+
+		shutdownCfg := node.ShutdownConfig{
+			Grace:   time.Duration(opt.ShutdownGrace),
+			Timeout: time.Duration(opt.ShutdownTimeout),
+		}
+		if opt.DrainOnShutdown && !markets {
+			shutdownCfg.Drain = sm.StorageMgr.WaitDrained
+			shutdownCfg.DrainTimeout = time.Duration(opt.DrainTimeout)
+		}
 
-		return srv.Serve(manet.NetListener(lst))
+		shutdownDone := node.MonitorShutdown(shutdownChan, shutdownCfg, drain, srv, stop)
+
+		// the listener is open and the full node checked, readiness means
+		// API requests are served from here on
+		go runSdWatchdog(ctx, nodeApi)
+		sdNotify(daemon.SdNotifyReady + "\nSTATUS=serving the miner API")
+
+		err = serve(srv, manet.NetListener(lst), opt)
+		if err == http.ErrServerClosed {
+			sdNotify(daemon.SdNotifyStopping)
+			<-shutdownDone
+			return nil
+		}
+		return err
 	},
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/watchdog"
+)
+
+// sdHeadEpochs is how many epochs can pass without a chain notification
+// before the miner is considered unhealthy
+const sdHeadEpochs = 10
+
+// sdNotify sends a state to systemd, see sd_notify(3). It does nothing
+// unless the miner runs in a unit with Type=notify.
+func sdNotify(state string) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		log.Warnf("notifying systemd: %s", err)
+	}
+}
+
+// sdWatchdog feeds the systemd watchdog while the miner is healthy, so a
+// unit with WatchdogSec set is restarted when the miner is wedged
+type sdWatchdog struct {
+	full api.FullNode
+
+	lk       sync.Mutex
+	lastHead time.Time
+}
+
+// runSdWatchdog pings the watchdog at half the WatchdogSec of the unit, it
+// returns right away when the watchdog isn't enabled
+func runSdWatchdog(ctx context.Context, full api.FullNode) {
+	timeout, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		log.Warnf("checking systemd watchdog: %s", err)
+		return
+	}
+	if timeout == 0 {
+		return
+	}
+
+	w := &sdWatchdog{full: full, lastHead: time.Now()}
+	go w.followHead(ctx)
+
+	t := time.NewTicker(timeout / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := w.healthy(time.Now()); err != nil {
+			log.Errorw("not feeding the systemd watchdog", "error", err)
+			sdNotify("STATUS=unhealthy: " + err.Error())
+			continue
+		}
+		sdNotify(daemon.SdNotifyWatchdog)
+	}
+}
+
+// healthy checks that chain notifications arrive, and that no monitored loop,
+// e.g. the sealing scheduler, is stuck
+func (w *sdWatchdog) healthy(now time.Time) error {
+	if stuck := watchdog.Stuck(now); len(stuck) > 0 {
+		return xerrors.Errorf("stuck loops: %s", strings.Join(stuck, ", "))
+	}
+
+	w.lk.Lock()
+	since := now.Sub(w.lastHead)
+	w.lk.Unlock()
+
+	if since > sdHeadEpochs*time.Duration(build.BlockDelaySecs)*time.Second {
+		return xerrors.Errorf("no chain notification for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+func (w *sdWatchdog) followHead(ctx context.Context) {
+	for ctx.Err() == nil {
+		notifs, err := w.full.ChainNotify(ctx)
+		if err != nil {
+			log.Warnf("subscribing to chain notifications: %s", err)
+		} else {
+			for range notifs {
+				w.lk.Lock()
+				w.lastHead = time.Now()
+				w.lk.Unlock()
+			}
+		}
+
+		select {
+		case <-time.After(time.Duration(build.BlockDelaySecs) * time.Second):
+		case <-ctx.Done():
+		}
+	}
+}
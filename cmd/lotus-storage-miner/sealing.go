@@ -3,14 +3,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"golang.org/x/xerrors"
 
+	tm "github.com/buger/goterm"
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 
@@ -27,14 +30,30 @@ var sealingCmd = &cli.Command{
 		sealingJobsCmd,
 		sealingWorkersCmd,
 		sealingSchedDiagCmd,
+		sealingSchedExplainCmd,
+		sealingEnergyCmd,
+		sealingRegistrationsCmd,
 	},
 }
 
 var sealingWorkersCmd = &cli.Command{
 	Name:  "workers",
 	Usage: "list workers",
+	Subcommands: []*cli.Command{
+		sealingWorkersListCmd,
+		sealingWorkersTasksCmd,
+	},
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "color"},
+		&cli.BoolFlag{
+			Name:  "watch",
+			Usage: "keep redrawing the list, on sector state changes and every interval",
+		},
+		&cli.DurationFlag{
+			Name:  "interval",
+			Usage: "how often to redraw the list in watch mode",
+			Value: 2 * time.Second,
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		color.NoColor = !cctx.Bool("color")
@@ -45,74 +64,118 @@ var sealingWorkersCmd = &cli.Command{
 		}
 		defer closer()
 
-		ctx := lcli.ReqContext(cctx)
+		if !cctx.Bool("watch") {
+			ctx := lcli.ReqContext(cctx)
+
+			stats, err := nodeApi.WorkerStats(ctx)
+			if err != nil {
+				return err
+			}
+
+			printWorkers(os.Stdout, stats)
+			return nil
+		}
+
+		ctx := lcli.DaemonContext(cctx)
 
-		stats, err := nodeApi.WorkerStats(ctx)
+		// there are no worker stat updates, sector state changes are a good hint
+		// resource use has changed
+		updates, err := nodeApi.SectorsUpdates(ctx)
 		if err != nil {
 			return err
 		}
 
-		type sortableStat struct {
-			id uint64
-			storiface.WorkerStats
-		}
+		t := time.NewTicker(cctx.Duration("interval"))
+		defer t.Stop()
+
+		for {
+			stats, err := nodeApi.WorkerStats(ctx)
+			if err != nil {
+				return err
+			}
 
-		st := make([]sortableStat, 0, len(stats))
-		for id, stat := range stats {
-			st = append(st, sortableStat{id, stat})
+			tm.Clear()
+			tm.MoveCursor(1, 1)
+			printWorkers(tm.Output, stats)
+			tm.Flush()
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-t.C:
+			case _, ok := <-updates:
+				if !ok {
+					return xerrors.Errorf("sector updates channel closed")
+				}
+			}
 		}
+	},
+}
 
-		sort.Slice(st, func(i, j int) bool {
-			return st[i].id < st[j].id
-		})
+func printWorkers(out io.Writer, stats map[uint64]storiface.WorkerStats) {
+	type sortableStat struct {
+		id uint64
+		storiface.WorkerStats
+	}
+
+	st := make([]sortableStat, 0, len(stats))
+	for id, stat := range stats {
+		st = append(st, sortableStat{id, stat})
+	}
+
+	sort.Slice(st, func(i, j int) bool {
+		return st[i].id < st[j].id
+	})
+
+	for _, stat := range st {
+		if stat.Registration != "" {
+			printPendingWorker(out, stat.WorkerStats)
+			continue
+		}
 
-		for _, stat := range st {
-			gpuUse := "not "
-			gpuCol := color.FgBlue
-			if stat.GpuUsed {
-				gpuCol = color.FgGreen
-				gpuUse = ""
-			}
+		gpuUse := "not "
+		gpuCol := color.FgBlue
+		if stat.GpuUsed {
+			gpuCol = color.FgGreen
+			gpuUse = ""
+		}
 
-			fmt.Printf("Worker %d, host %s\n", stat.id, color.MagentaString(stat.Info.Hostname))
+		fmt.Fprintf(out, "Worker %d, host %s\n", stat.id, color.MagentaString(stat.Info.Hostname))
 
-			var barCols = uint64(64)
-			cpuBars := int(stat.CpuUse * barCols / stat.Info.Resources.CPUs)
-			cpuBar := strings.Repeat("|", cpuBars) + strings.Repeat(" ", int(barCols)-cpuBars)
+		var barCols = uint64(64)
+		cpuBars := int(stat.CpuUse * barCols / stat.Info.Resources.CPUs)
+		cpuBar := strings.Repeat("|", cpuBars) + strings.Repeat(" ", int(barCols)-cpuBars)
 
-			fmt.Printf("\tCPU:  [%s] %d core(s) in use\n", color.GreenString(cpuBar), stat.CpuUse)
+		fmt.Fprintf(out, "\tCPU:  [%s] %d core(s) in use\n", color.GreenString(cpuBar), stat.CpuUse)
 
-			ramBarsRes := int(stat.Info.Resources.MemReserved * barCols / stat.Info.Resources.MemPhysical)
-			ramBarsUsed := int(stat.MemUsedMin * barCols / stat.Info.Resources.MemPhysical)
-			ramBar := color.YellowString(strings.Repeat("|", ramBarsRes)) +
-				color.GreenString(strings.Repeat("|", ramBarsUsed)) +
-				strings.Repeat(" ", int(barCols)-ramBarsUsed-ramBarsRes)
+		ramBarsRes := int(stat.Info.Resources.MemReserved * barCols / stat.Info.Resources.MemPhysical)
+		ramBarsUsed := int(stat.MemUsedMin * barCols / stat.Info.Resources.MemPhysical)
+		ramBar := color.YellowString(strings.Repeat("|", ramBarsRes)) +
+			color.GreenString(strings.Repeat("|", ramBarsUsed)) +
+			strings.Repeat(" ", int(barCols)-ramBarsUsed-ramBarsRes)
 
-			vmem := stat.Info.Resources.MemPhysical + stat.Info.Resources.MemSwap
+		vmem := stat.Info.Resources.MemPhysical + stat.Info.Resources.MemSwap
 
-			vmemBarsRes := int(stat.Info.Resources.MemReserved * barCols / vmem)
-			vmemBarsUsed := int(stat.MemUsedMax * barCols / vmem)
-			vmemBar := color.YellowString(strings.Repeat("|", vmemBarsRes)) +
-				color.GreenString(strings.Repeat("|", vmemBarsUsed)) +
-				strings.Repeat(" ", int(barCols)-vmemBarsUsed-vmemBarsRes)
+		vmemBarsRes := int(stat.Info.Resources.MemReserved * barCols / vmem)
+		vmemBarsUsed := int(stat.MemUsedMax * barCols / vmem)
+		vmemBar := color.YellowString(strings.Repeat("|", vmemBarsRes)) +
+			color.GreenString(strings.Repeat("|", vmemBarsUsed)) +
+			strings.Repeat(" ", int(barCols)-vmemBarsUsed-vmemBarsRes)
 
-			fmt.Printf("\tRAM:  [%s] %d%% %s/%s\n", ramBar,
-				(stat.Info.Resources.MemReserved+stat.MemUsedMin)*100/stat.Info.Resources.MemPhysical,
-				types.SizeStr(types.NewInt(stat.Info.Resources.MemReserved+stat.MemUsedMin)),
-				types.SizeStr(types.NewInt(stat.Info.Resources.MemPhysical)))
+		fmt.Fprintf(out, "\tRAM:  [%s] %d%% %s/%s\n", ramBar,
+			(stat.Info.Resources.MemReserved+stat.MemUsedMin)*100/stat.Info.Resources.MemPhysical,
+			types.SizeStr(types.NewInt(stat.Info.Resources.MemReserved+stat.MemUsedMin)),
+			types.SizeStr(types.NewInt(stat.Info.Resources.MemPhysical)))
 
-			fmt.Printf("\tVMEM: [%s] %d%% %s/%s\n", vmemBar,
-				(stat.Info.Resources.MemReserved+stat.MemUsedMax)*100/vmem,
-				types.SizeStr(types.NewInt(stat.Info.Resources.MemReserved+stat.MemUsedMax)),
-				types.SizeStr(types.NewInt(vmem)))
+		fmt.Fprintf(out, "\tVMEM: [%s] %d%% %s/%s\n", vmemBar,
+			(stat.Info.Resources.MemReserved+stat.MemUsedMax)*100/vmem,
+			types.SizeStr(types.NewInt(stat.Info.Resources.MemReserved+stat.MemUsedMax)),
+			types.SizeStr(types.NewInt(vmem)))
 
-			for _, gpu := range stat.Info.Resources.GPUs {
-				fmt.Printf("\tGPU: %s\n", color.New(gpuCol).Sprintf("%s, %sused", gpu, gpuUse))
-			}
+		for _, gpu := range stat.Info.Resources.GPUs {
+			fmt.Fprintf(out, "\tGPU: %s\n", color.New(gpuCol).Sprintf("%s, %sused", gpu, gpuUse))
 		}
-
-		return nil
-	},
+	}
 }
 
 var sealingJobsCmd = &cli.Command{
@@ -214,3 +277,73 @@ var sealingSchedDiagCmd = &cli.Command{
 		return nil
 	},
 }
+
+var sealingSchedExplainCmd = &cli.Command{
+	Name:      "sched-explain",
+	Usage:     "Explain how the scheduler handled a task",
+	ArgsUsage: "[taskID]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the explanation as JSON",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("expected 1 argument: task ID (see sched-diag)")
+		}
+
+		taskID, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing task ID: %w", err)
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		ex, err := nodeApi.SealingSchedExplain(ctx, taskID)
+		if err != nil {
+			return err
+		}
+
+		if cctx.Bool("json") {
+			j, err := json.MarshalIndent(&ex, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(j))
+			return nil
+		}
+
+		fmt.Printf("Task %d: %s for sector %d (priority %d)\n", ex.TaskID, ex.Task.Short(), ex.Sector.Number, ex.Priority)
+		fmt.Printf("Queued:\t\t%s (%s ago)\n", ex.Queued.Format(time.Stamp), time.Since(ex.Queued).Truncate(time.Second))
+		fmt.Printf("Sched passes:\t%d\n", ex.Attempts)
+		if ex.Assigned {
+			fmt.Printf("Assigned:\tworker %d at %s\n", ex.AssignedWorker, ex.AssignedAt.Format(time.Stamp))
+		}
+		fmt.Printf("Reason:\t\t%s\n", ex.Reason)
+
+		if len(ex.Candidates) == 0 {
+			return nil
+		}
+
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintf(tw, "Worker\tHostname\tAccepted\tRank\tReason\n")
+		for _, c := range ex.Candidates {
+			rank := "-"
+			if c.Rank >= 0 {
+				rank = strconv.Itoa(c.Rank)
+			}
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%t\t%s\t%s\n", c.WorkerID, c.Hostname, c.Accepted, rank, c.Reason)
+		}
+
+		return tw.Flush()
+	},
+}
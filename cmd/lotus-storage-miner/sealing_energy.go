@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api/apibstore"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/power"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/reward"
+	"github.com/filecoin-project/lotus/chain/store"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+const joulesPerKWh = 3.6e6
+
+// sectorSealTasks are the tasks every sealed sector goes through once
+var sectorSealTasks = []sealtasks.TaskType{
+	sealtasks.TTPreCommit1,
+	sealtasks.TTPreCommit2,
+	sealtasks.TTCommit1,
+	sealtasks.TTCommit2,
+}
+
+var sealingEnergyCmd = &cli.Command{
+	Name:  "energy",
+	Usage: "show the energy used by sealing tasks",
+	Description: `Workers with energy metering enabled (Storage.EnergyMetering in the miner
+   config, --energy-metering on seal workers) measure the energy used by
+   sealing tasks with RAPL (CPU) and NVML (GPU) counters. Energy is split
+   evenly between tasks running at the same time on a worker.
+
+   The FIL/kWh figure compares the reward expected for a sector's power over
+   --days at the current network reward and power, to the energy used to
+   seal it.`,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "days",
+			Usage: "number of days of expected sector rewards to compare energy use to",
+			Value: 180,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		energy, err := nodeApi.WorkerEnergy(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting worker energy: %w", err)
+		}
+
+		total := map[sealtasks.TaskType]storiface.TaskEnergy{}
+
+		wids := make([]uint64, 0, len(energy))
+		for wid := range energy {
+			wids = append(wids, wid)
+		}
+		sort.Slice(wids, func(i, j int) bool {
+			return wids[i] < wids[j]
+		})
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintf(tw, "Worker\tHost\tMeters\tTask\tTasks\tkWh/Task\tAvg Time\n")
+		for _, wid := range wids {
+			e := energy[wid]
+			meters := strings.Join(e.Meters, ",")
+			if meters == "" {
+				meters = "none"
+			}
+
+			if len(e.Tasks) == 0 {
+				_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t-\t0\t-\t-\n", wid, e.Hostname, meters)
+				continue
+			}
+
+			for _, tt := range sortedTasks(e.Tasks) {
+				te := e.Tasks[tt]
+				_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%.3f\t%s\n", wid, e.Hostname, meters, tt.Short(), te.Tasks, perTaskKWh(te), (te.Duration / timeDivisor(te)).Truncate(1e9))
+
+				t := total[tt]
+				t.Tasks += te.Tasks
+				t.Joules += te.Joules
+				t.Duration += te.Duration
+				total[tt] = t
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		var sectorKWh float64
+		for _, tt := range sectorSealTasks {
+			te, ok := total[tt]
+			if !ok || te.Tasks == 0 {
+				fmt.Printf("\nNo metered %s tasks yet, can't estimate energy per sector\n", tt.Short())
+				return nil
+			}
+			sectorKWh += perTaskKWh(te)
+		}
+
+		fmt.Println()
+		fmt.Printf("Sealing energy per sector: %.3f kWh\n", sectorKWh)
+
+		if sectorKWh == 0 {
+			return nil
+		}
+
+		days := cctx.Int("days")
+		if days <= 0 {
+			return xerrors.Errorf("--days must be positive")
+		}
+
+		api, acloser, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer acloser()
+
+		maddr, err := getActorAddress(ctx, nodeApi, cctx.String("actor"))
+		if err != nil {
+			return err
+		}
+
+		ssize, err := nodeApi.ActorSectorSize(ctx, maddr)
+		if err != nil {
+			return xerrors.Errorf("getting sector size: %w", err)
+		}
+
+		head, err := api.ChainHead(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting chain head: %w", err)
+		}
+
+		stor := store.ActorStore(ctx, apibstore.NewAPIBlockstore(api))
+
+		ract, err := api.StateGetActor(ctx, reward.Address, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting reward actor: %w", err)
+		}
+		rst, err := reward.Load(stor, ract)
+		if err != nil {
+			return err
+		}
+
+		pact, err := api.StateGetActor(ctx, power.Address, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting power actor: %w", err)
+		}
+		pst, err := power.Load(stor, pact)
+		if err != nil {
+			return err
+		}
+
+		rewardEst, err := rst.ThisEpochRewardSmoothed()
+		if err != nil {
+			return xerrors.Errorf("getting reward estimate: %w", err)
+		}
+		netQA, err := pst.TotalPowerSmoothed()
+		if err != nil {
+			return xerrors.Errorf("getting network power estimate: %w", err)
+		}
+
+		// committed capacity, deals would raise the sector's QA power
+		expected := miner0.ExpectedRewardForPower(&rewardEst, &netQA, abi.NewStoragePower(int64(ssize)), abi.ChainEpoch(days)*builtin0.EpochsInDay)
+
+		fil, _ := new(big.Float).Quo(new(big.Float).SetInt(expected.Int), new(big.Float).SetUint64(build.FilecoinPrecision)).Float64()
+
+		fmt.Printf("Expected reward per sector (%d days): %.6f FIL\n", days, fil)
+		fmt.Printf("Reward per sealing kWh: %.6f FIL/kWh\n", fil/sectorKWh)
+
+		return nil
+	},
+}
+
+func sortedTasks(tasks map[sealtasks.TaskType]storiface.TaskEnergy) []sealtasks.TaskType {
+	out := make([]sealtasks.TaskType, 0, len(tasks))
+	for tt := range tasks {
+		out = append(out, tt)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Less(out[j])
+	})
+	return out
+}
+
+func perTaskKWh(te storiface.TaskEnergy) float64 {
+	if te.Tasks == 0 {
+		return 0
+	}
+	return te.Joules / float64(te.Tasks) / joulesPerKWh
+}
+
+func timeDivisor(te storiface.TaskEnergy) time.Duration {
+	if te.Tasks == 0 {
+		return 1
+	}
+	return time.Duration(te.Tasks)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+var sealingRegistrationsCmd = &cli.Command{
+	Name:  "registrations",
+	Usage: "manage workers which registered with the miner",
+	Description: `Workers announce themselves with their tasks, resources and storage paths
+   before connecting. With Workers.RequireApproval set in the config, new
+   workers wait until they're accepted here before they connect and get
+   tasks.`,
+	Subcommands: []*cli.Command{
+		sealingRegistrationsListCmd,
+		sealingRegistrationsAcceptCmd,
+		sealingRegistrationsDenyCmd,
+	},
+}
+
+var sealingRegistrationsListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "list registered workers",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "color"},
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "also print tasks and storage paths",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		color.NoColor = !cctx.Bool("color")
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureWorkerRegister); err != nil {
+			return err
+		}
+
+		regs, err := nodeApi.WorkerRegistrations(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ID\tHostname\tURL\tCPUs\tRAM\tGPUs\tLast Seen\tState")
+		for _, reg := range regs {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%d\t%s\t%s\n", reg.ID, reg.Hostname, reg.URL, reg.Resources.CPUs,
+				types.SizeStr(types.NewInt(reg.Resources.MemPhysical)), len(reg.Resources.GPUs),
+				reg.LastSeen.Format("2006-01-02 15:04:05"), regState(reg.State))
+			if cctx.Bool("verbose") {
+				tasks := make([]string, len(reg.Tasks))
+				for i, t := range reg.Tasks {
+					tasks[i] = t.Short()
+				}
+				_, _ = fmt.Fprintf(tw, "\ttasks: %s\n", strings.Join(tasks, " "))
+				for _, p := range reg.Paths {
+					_, _ = fmt.Fprintf(tw, "\tpath: %s\n", p)
+				}
+			}
+		}
+		return tw.Flush()
+	},
+}
+
+var sealingRegistrationsAcceptCmd = &cli.Command{
+	Name:      "accept",
+	Usage:     "let registered workers connect",
+	ArgsUsage: "<id> [id...]",
+	Action: func(cctx *cli.Context) error {
+		return setRegistrations(cctx, func(nodeApi api.StorageMiner, id string) error {
+			return nodeApi.WorkerRegistrationAccept(lcli.ReqContext(cctx), id)
+		})
+	},
+}
+
+var sealingRegistrationsDenyCmd = &cli.Command{
+	Name:      "deny",
+	Usage:     "stop registered workers from connecting, and disconnect them",
+	ArgsUsage: "<id> [id...]",
+	Action: func(cctx *cli.Context) error {
+		return setRegistrations(cctx, func(nodeApi api.StorageMiner, id string) error {
+			return nodeApi.WorkerRegistrationDeny(lcli.ReqContext(cctx), id)
+		})
+	},
+}
+
+func setRegistrations(cctx *cli.Context, set func(nodeApi api.StorageMiner, id string) error) error {
+	if !cctx.Args().Present() {
+		return xerrors.New("expected worker registration IDs")
+	}
+
+	nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	if err := lcli.RequireAPIFeature(lcli.ReqContext(cctx), nodeApi, build.FeatureWorkerRegister); err != nil {
+		return err
+	}
+
+	for _, id := range cctx.Args().Slice() {
+		if err := set(nodeApi, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printPendingWorker lists a worker waiting for approval below the connected
+// ones in 'sealing workers'
+func printPendingWorker(out io.Writer, st storiface.WorkerStats) {
+	res := st.Info.Resources
+	fmt.Fprintf(out, "Worker %s, host %s: %s\n", st.Registration, color.MagentaString(st.Info.Hostname), regState(api.WorkerRegPending))
+	fmt.Fprintf(out, "\t%d CPUs, %s RAM, %d GPUs, accept with 'lotus-miner sealing registrations accept %s'\n",
+		res.CPUs, types.SizeStr(types.NewInt(res.MemPhysical)), len(res.GPUs), st.Registration)
+}
+
+func regState(st api.WorkerRegState) string {
+	switch st {
+	case api.WorkerRegAccepted:
+		return color.GreenString("%s", st)
+	case api.WorkerRegDenied:
+		return color.RedString("%s", st)
+	default:
+		return color.YellowString("waiting for approval")
+	}
+}
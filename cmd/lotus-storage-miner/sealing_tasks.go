@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+)
+
+var sealingWorkersTasksCmd = &cli.Command{
+	Name:  "tasks",
+	Usage: "list which workers task types are pinned to",
+	Description: `Task types are pinned to workers with Workers.Tasks in the config, e.g. so
+   GPU workers only get C2. The enable and disable commands change this for
+   single workers, by hostname, until reset. Task types are named AP, PC1,
+   PC2, C1, C2, FIN, GET, UNS and RD.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "color"},
+	},
+	Subcommands: []*cli.Command{
+		sealingWorkersTasksEnableCmd,
+		sealingWorkersTasksDisableCmd,
+		sealingWorkersTasksResetCmd,
+	},
+	Action: func(cctx *cli.Context) error {
+		color.NoColor = !cctx.Bool("color")
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureWorkerTasks); err != nil {
+			return err
+		}
+
+		aff, err := nodeApi.WorkerTaskAffinity(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Task\tWorkers")
+		pinned := make([]sealtasks.TaskType, 0, len(aff.Tasks))
+		for tt := range aff.Tasks {
+			pinned = append(pinned, tt)
+		}
+		for _, tt := range sortTaskTypes(pinned) {
+			names := make([]string, len(aff.Tasks[tt]))
+			for i, name := range aff.Tasks[tt] {
+				names[i] = name
+				if hosts, ok := aff.Groups[name]; ok {
+					names[i] = fmt.Sprintf("%s (%s)", name, strings.Join(hosts, ", "))
+				}
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\n", strings.TrimSpace(tt.Short()), strings.Join(names, ", "))
+		}
+		if len(aff.Tasks) == 0 {
+			_, _ = fmt.Fprintln(tw, "any\tany")
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		if len(aff.Overrides) == 0 {
+			return nil
+		}
+
+		hosts := make([]string, 0, len(aff.Overrides))
+		for host := range aff.Overrides {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+
+		fmt.Println()
+		tw = tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Worker\tEnabled\tDisabled")
+		for _, host := range hosts {
+			var tasks []sealtasks.TaskType
+			for tt := range aff.Overrides[host] {
+				tasks = append(tasks, tt)
+			}
+
+			var enabled, disabled []string
+			for _, tt := range sortTaskTypes(tasks) {
+				if aff.Overrides[host][tt] {
+					enabled = append(enabled, color.GreenString(strings.TrimSpace(tt.Short())))
+				} else {
+					disabled = append(disabled, color.RedString(strings.TrimSpace(tt.Short())))
+				}
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", host, strings.Join(enabled, " "), strings.Join(disabled, " "))
+		}
+		return tw.Flush()
+	},
+}
+
+var sealingWorkersTasksEnableCmd = &cli.Command{
+	Name:      "enable",
+	Usage:     "assign task types to the workers with a hostname, even if they're pinned to others",
+	ArgsUsage: "<hostname> <task> [task...]",
+	Action: func(cctx *cli.Context) error {
+		return setWorkerTasks(cctx, 2, func(nodeApi api.StorageMiner, host string, tasks []sealtasks.TaskType) error {
+			return nodeApi.WorkerTaskSet(lcli.ReqContext(cctx), host, tasks, true)
+		})
+	},
+}
+
+var sealingWorkersTasksDisableCmd = &cli.Command{
+	Name:      "disable",
+	Usage:     "stop assigning task types to the workers with a hostname, running tasks finish",
+	ArgsUsage: "<hostname> <task> [task...]",
+	Action: func(cctx *cli.Context) error {
+		return setWorkerTasks(cctx, 2, func(nodeApi api.StorageMiner, host string, tasks []sealtasks.TaskType) error {
+			return nodeApi.WorkerTaskSet(lcli.ReqContext(cctx), host, tasks, false)
+		})
+	},
+}
+
+var sealingWorkersTasksResetCmd = &cli.Command{
+	Name:      "reset",
+	Usage:     "go back to the config for task types of the workers with a hostname, or all task types",
+	ArgsUsage: "<hostname> [task...]",
+	Action: func(cctx *cli.Context) error {
+		return setWorkerTasks(cctx, 1, func(nodeApi api.StorageMiner, host string, tasks []sealtasks.TaskType) error {
+			return nodeApi.WorkerTaskReset(lcli.ReqContext(cctx), host, tasks)
+		})
+	},
+}
+
+func setWorkerTasks(cctx *cli.Context, minArgs int, set func(nodeApi api.StorageMiner, host string, tasks []sealtasks.TaskType) error) error {
+	if cctx.NArg() < minArgs {
+		return xerrors.Errorf("expected a worker hostname and task types")
+	}
+
+	var tasks []sealtasks.TaskType
+	for _, arg := range cctx.Args().Slice()[1:] {
+		tt, err := sealtasks.ParseTask(arg)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, tt)
+	}
+
+	nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	if err := lcli.RequireAPIFeature(lcli.ReqContext(cctx), nodeApi, build.FeatureWorkerTasks); err != nil {
+		return err
+	}
+
+	return set(nodeApi, cctx.Args().First(), tasks)
+}
+
+func sortTaskTypes(tasks []sealtasks.TaskType) []sealtasks.TaskType {
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Less(tasks[j])
+	})
+	return tasks
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+var sealingWorkersListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List each worker with the resources in use and its jobs",
+	Description: `Workers with a job running for longer than --stuck are marked, to find the
+   workers which stopped making progress.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "color"},
+		&cli.DurationFlag{
+			Name:  "stuck",
+			Usage: "mark workers with a job running for longer than this",
+			Value: 12 * time.Hour,
+		},
+		&cli.BoolFlag{
+			Name:  "stuck-only",
+			Usage: "only list the workers marked stuck",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		color.NoColor = !cctx.Bool("color")
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureWorkerList); err != nil {
+			return err
+		}
+
+		workers, err := nodeApi.WorkerSummaries(ctx)
+		if err != nil {
+			return err
+		}
+
+		stuck := cctx.Duration("stuck")
+		for _, w := range workers {
+			isStuck := stuck > 0 && w.Oldest > stuck
+			if cctx.Bool("stuck-only") && !isStuck {
+				continue
+			}
+
+			mark := ""
+			if isStuck {
+				mark = color.RedString(" (stuck, a job runs for %s)", w.Oldest.Truncate(time.Second))
+			}
+			fmt.Printf("Worker %d, host %s%s\n", w.ID, color.MagentaString(w.Info.Hostname), mark)
+
+			res := w.Info.Resources
+			gpu := ""
+			if len(res.GPUs) > 0 {
+				gpu = fmt.Sprintf(", %d GPU(s) not in use", len(res.GPUs))
+				if w.GpuUsed {
+					gpu = fmt.Sprintf(", %d GPU(s) in use", len(res.GPUs))
+				}
+			}
+			fmt.Printf("\tResources: %d/%d cores, RAM %s/%s, VMEM %s/%s%s\n", w.CpuUse, res.CPUs,
+				types.SizeStr(types.NewInt(res.MemReserved+w.MemUsedMin)), types.SizeStr(types.NewInt(res.MemPhysical)),
+				types.SizeStr(types.NewInt(res.MemReserved+w.MemUsedMax)), types.SizeStr(types.NewInt(res.MemPhysical+res.MemSwap)),
+				gpu)
+			fmt.Printf("\tRunning:   %s\n", taskCounts(w.Running))
+			fmt.Printf("\tAssigned:  %s\n", taskCounts(w.Assigned))
+
+			if len(w.Jobs) > 0 {
+				printWorkerJobs(w)
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
+func printWorkerJobs(w storiface.WorkerSummary) {
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "\tID\tSector\tTask\tState\tTime\n")
+	for _, j := range w.Jobs {
+		state := "running"
+		if j.RunWait != 0 {
+			state = fmt.Sprintf("assigned(%d)", j.RunWait-1)
+		}
+		_, _ = fmt.Fprintf(tw, "\t%d\t%d\t%s\t%s\t%s\n", j.ID, j.Sector.Number, j.Task.Short(), state, time.Now().Sub(j.Start).Truncate(time.Millisecond*100))
+	}
+	_ = tw.Flush()
+}
+
+// taskCounts formats job counts by task type, e.g. "PC1 2, PC2 1"
+func taskCounts(counts map[sealtasks.TaskType]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	tts := make([]sealtasks.TaskType, 0, len(counts))
+	for tt := range counts {
+		tts = append(tts, tt)
+	}
+	sortTaskTypes(tts)
+
+	out := make([]string, len(tts))
+	for i, tt := range tts {
+		out[i] = fmt.Sprintf("%s %d", tt.Short(), counts[tt])
+	}
+	return strings.Join(out, ", ")
+}
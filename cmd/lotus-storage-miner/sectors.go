@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strconv"
 	"text/tabwriter"
 	"time"
 
+	tm "github.com/buger/goterm"
+	"github.com/docker/go-units"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 
 	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
@@ -20,7 +26,9 @@ import (
 	"github.com/filecoin-project/lotus/chain/types"
 
 	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+	"github.com/filecoin-project/lotus/storage/labels"
 )
 
 var sectorsCmd = &cli.Command{
@@ -29,14 +37,20 @@ var sectorsCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		sectorsStatusCmd,
 		sectorsListCmd,
+		sectorsQueryCmd,
+		sectorsLabelCmd,
 		sectorsRefsCmd,
 		sectorsUpdateCmd,
 		sectorsPledgeCmd,
 		sectorsRemoveCmd,
 		sectorsMarkForUpgradeCmd,
+		sectorsReadCmd,
 		sectorsStartSealCmd,
 		sectorsSealDelayCmd,
 		sectorsCapacityCollateralCmd,
+		sectorsAuditCmd,
+		sectorsTrimCacheCmd,
+		sectorsArchiveCmd,
 	},
 }
 
@@ -53,6 +67,79 @@ var sectorsPledgeCmd = &cli.Command{
 
 		return nodeApi.PledgeSector(ctx)
 	},
+	Subcommands: []*cli.Command{
+		sectorsPledgePauseCmd,
+		sectorsPledgeResumeCmd,
+		sectorsPledgeStatusCmd,
+	},
+}
+
+var sectorsPledgePauseCmd = &cli.Command{
+	Name:  "pause",
+	Usage: "pause the auto-pledge loop of 'run --pledge-sector' or lotus-pledge-controller until resumed or the miner restarts",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return nodeApi.PledgePause(lcli.ReqContext(cctx))
+	},
+}
+
+var sectorsPledgeResumeCmd = &cli.Command{
+	Name:  "resume",
+	Usage: "resume a paused auto-pledge loop",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return nodeApi.PledgeResume(lcli.ReqContext(cctx))
+	},
+}
+
+var sectorsPledgeStatusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "show the state of the auto-pledge loop",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		st, err := nodeApi.PledgeStatus(lcli.ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !st.Running && st.Paused:
+			fmt.Println("Auto-pledge: not running in the miner, lotus-pledge-controller is paused")
+			return nil
+		case !st.Running:
+			fmt.Println("Auto-pledge: not running in the miner")
+			return nil
+		case st.Paused:
+			fmt.Println("Auto-pledge: paused")
+		default:
+			fmt.Println("Auto-pledge: running")
+		}
+
+		if st.LastPledge.IsZero() {
+			fmt.Println("Last pledge: never")
+		} else {
+			fmt.Printf("Last pledge: %s (%s ago)\n", st.LastPledge.Format(time.RFC3339), time.Since(st.LastPledge).Truncate(time.Second))
+		}
+		if st.LastSkip != "" {
+			fmt.Printf("Last skipped: %s\n", st.LastSkip)
+		}
+		return nil
+	},
 }
 
 var sectorsStatusCmd = &cli.Command{
@@ -144,8 +231,22 @@ var sectorsListCmd = &cli.Command{
 			Name:  "show-removed",
 			Usage: "show removed sectors",
 		},
+		&cli.BoolFlag{
+			Name:  "watch",
+			Usage: "watch sector state changes in real-time, rather than a one time list",
+		},
+		&cli.StringSliceFlag{
+			Name:    "label",
+			Aliases: []string{"l"},
+			Usage:   "only list sectors with the label, key=value, or key for any value",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
+		selector, err := labels.Parse(cctx.StringSlice("label"))
+		if err != nil {
+			return err
+		}
+
 		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
 		if err != nil {
 			return err
@@ -158,67 +259,347 @@ var sectorsListCmd = &cli.Command{
 		}
 		defer closer2()
 
+		watch := cctx.Bool("watch")
+
 		ctx := lcli.ReqContext(cctx)
+		if watch {
+			ctx = lcli.DaemonContext(cctx)
+		}
+
+		var updates <-chan api.SectorUpdate
+		if watch {
+			// subscribe before listing, so no change is missed
+			updates, err = nodeApi.SectorsUpdates(ctx)
+			if err != nil {
+				return err
+			}
+		}
 
-		list, err := nodeApi.SectorsList(ctx)
+		maddr, err := nodeApi.ActorAddress(ctx)
 		if err != nil {
 			return err
 		}
 
-		maddr, err := nodeApi.ActorAddress(ctx)
+		sl := &sectorList{
+			showRemoved: cctx.Bool("show-removed"),
+			selector:    selector,
+			status:      map[abi.SectorNumber]api.SectorInfo{},
+			errs:        map[abi.SectorNumber]error{},
+		}
+		if err := sl.loadChain(ctx, fullApi, maddr); err != nil {
+			return err
+		}
+		if err := sl.loadAll(ctx, nodeApi); err != nil {
+			return err
+		}
+
+		if !watch {
+			return sl.output(os.Stdout)
+		}
+
+		lastChain := time.Now()
+		for {
+			tm.Clear()
+			tm.MoveCursor(1, 1)
+			if err := sl.output(tm.Output); err != nil {
+				return err
+			}
+			tm.Flush()
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case upd, ok := <-updates:
+				if !ok {
+					return xerrors.Errorf("sector updates channel closed")
+				}
+				if upd.Dropped > 0 {
+					// we fell behind, any sector may have changed
+					if err := sl.loadAll(ctx, nodeApi); err != nil {
+						return err
+					}
+				}
+				sl.load(ctx, nodeApi, upd.Sector)
+
+				// the on-chain sets change much slower than sector states
+				if time.Since(lastChain) > sectorsWatchChainInterval {
+					if err := sl.loadChain(ctx, fullApi, maddr); err != nil {
+						return err
+					}
+					lastChain = time.Now()
+				}
+			}
+		}
+	},
+}
+
+const sectorsWatchChainInterval = 30 * time.Second
+
+var sectorsQueryCmd = &cli.Command{
+	Name:  "query",
+	Usage: "Find sectors by state, deal client, expiration, storage path and labels",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "state",
+			Usage: "only list sectors in the state, can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "client",
+			Usage: "only list sectors with deals of the client",
+		},
+		&cli.Int64Flag{
+			Name:  "expiration-from",
+			Usage: "only list sectors expiring at or after the epoch",
+		},
+		&cli.Int64Flag{
+			Name:  "expiration-to",
+			Usage: "only list sectors expiring at or before the epoch",
+		},
+		&cli.StringFlag{
+			Name:  "path",
+			Usage: "only list sectors with files in the storage path, by ID",
+		},
+		&cli.StringSliceFlag{
+			Name:    "label",
+			Aliases: []string{"l"},
+			Usage:   "only list sectors with the label, key=value, or key for any value",
+		},
+		&cli.StringFlag{
+			Name:  "text",
+			Usage: "only list sectors whose number, state or labels contain the text",
+		},
+		&cli.StringFlag{
+			Name:  "sort",
+			Usage: "sort by number, expiration or state",
+			Value: "number",
+		},
+		&cli.BoolFlag{
+			Name:  "desc",
+			Usage: "sort in descending order",
+		},
+		&cli.IntFlag{
+			Name:  "offset",
+			Usage: "skip this many sectors",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "list at most this many sectors, 0 lists all",
+			Value: 50,
+		},
+		&cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "rebuild the sector index before querying",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		selector, err := labels.Parse(cctx.StringSlice("label"))
 		if err != nil {
 			return err
 		}
 
-		activeSet, err := fullApi.StateMinerActiveSectors(ctx, maddr, types.EmptyTSK)
+		q := api.SectorQuery{
+			ExpirationFrom: abi.ChainEpoch(cctx.Int64("expiration-from")),
+			ExpirationTo:   abi.ChainEpoch(cctx.Int64("expiration-to")),
+			StoragePath:    stores.ID(cctx.String("path")),
+			Labels:         selector,
+			Text:           cctx.String("text"),
+			SortBy:         cctx.String("sort"),
+			Desc:           cctx.Bool("desc"),
+			Offset:         cctx.Int("offset"),
+			Limit:          cctx.Int("limit"),
+			Refresh:        cctx.Bool("refresh"),
+		}
+		for _, st := range cctx.StringSlice("state") {
+			q.States = append(q.States, api.SectorState(st))
+		}
+		if cctx.IsSet("client") {
+			client, err := address.NewFromString(cctx.String("client"))
+			if err != nil {
+				return xerrors.Errorf("parsing client address: %w", err)
+			}
+			q.DealClient = &client
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		res, err := nodeApi.SectorsQuery(ctx, q)
 		if err != nil {
 			return err
 		}
-		activeIDs := make(map[abi.SectorNumber]struct{}, len(activeSet))
-		for _, info := range activeSet {
-			activeIDs[info.SectorNumber] = struct{}{}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "Sector\tState\tExpiration\tDeals\tClients\tPaths\tLabels")
+		for _, s := range res.Sectors {
+			expiration := "-"
+			if s.Expiration > 0 {
+				expiration = fmt.Sprint(s.Expiration)
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%v\t%v\t%s\n", s.Sector, s.State, expiration, s.Deals, s.DealClients, s.StoragePaths, labels.String(s.Labels))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if len(res.Sectors) < res.Total {
+			fmt.Printf("\nShowing %d-%d of %d sectors\n", q.Offset+1, q.Offset+len(res.Sectors), res.Total)
 		}
+		return nil
+	},
+}
+
+type sectorList struct {
+	showRemoved bool
+	selector    map[string]string
+
+	status map[abi.SectorNumber]api.SectorInfo
+	errs   map[abi.SectorNumber]error
+
+	active    map[abi.SectorNumber]struct{}
+	committed map[abi.SectorNumber]struct{}
+}
 
-		sset, err := fullApi.StateMinerSectors(ctx, maddr, nil, types.EmptyTSK)
+func (sl *sectorList) loadChain(ctx context.Context, fullApi api.FullNode, maddr address.Address) error {
+	activeSet, err := fullApi.StateMinerActiveSectors(ctx, maddr, types.EmptyTSK)
+	if err != nil {
+		return err
+	}
+	sl.active = make(map[abi.SectorNumber]struct{}, len(activeSet))
+	for _, info := range activeSet {
+		sl.active[info.SectorNumber] = struct{}{}
+	}
+
+	sset, err := fullApi.StateMinerSectors(ctx, maddr, nil, types.EmptyTSK)
+	if err != nil {
+		return err
+	}
+	sl.committed = make(map[abi.SectorNumber]struct{}, len(sset))
+	for _, info := range sset {
+		sl.committed[info.SectorNumber] = struct{}{}
+	}
+
+	return nil
+}
+
+// loadAll loads the status of all sectors matching the selector
+func (sl *sectorList) loadAll(ctx context.Context, nodeApi api.StorageMiner) error {
+	var list []abi.SectorNumber
+	if len(sl.selector) > 0 {
+		labelled, err := nodeApi.SectorsListLabels(ctx, sl.selector)
 		if err != nil {
 			return err
 		}
-		commitedIDs := make(map[abi.SectorNumber]struct{}, len(activeSet))
-		for _, info := range sset {
-			commitedIDs[info.SectorNumber] = struct{}{}
+		for _, l := range labelled {
+			list = append(list, l.Sector)
+		}
+	} else {
+		var err error
+		list, err = nodeApi.SectorsList(ctx)
+		if err != nil {
+			return err
 		}
+	}
 
-		sort.Slice(list, func(i, j int) bool {
-			return list[i] < list[j]
-		})
+	for _, s := range list {
+		sl.load(ctx, nodeApi, s)
+	}
+	return nil
+}
 
-		w := tabwriter.NewWriter(os.Stdout, 8, 4, 1, ' ', 0)
+func (sl *sectorList) load(ctx context.Context, nodeApi api.StorageMiner, s abi.SectorNumber) {
+	st, err := nodeApi.SectorsStatus(ctx, s, false)
+	if err != nil {
+		sl.errs[s] = err
+		return
+	}
+	delete(sl.errs, s)
+	sl.status[s] = st
+}
 
-		for _, s := range list {
-			st, err := nodeApi.SectorsStatus(ctx, s, false)
-			if err != nil {
-				fmt.Fprintf(w, "%d:\tError: %s\n", s, err)
-				continue
-			}
+func (sl *sectorList) output(out io.Writer) error {
+	list := make([]abi.SectorNumber, 0, len(sl.status)+len(sl.errs))
+	for s := range sl.status {
+		list = append(list, s)
+	}
+	for s := range sl.errs {
+		if _, ok := sl.status[s]; !ok {
+			list = append(list, s)
+		}
+	}
 
-			if cctx.Bool("show-removed") || st.State != api.SectorState(sealing.Removed) {
-				_, inSSet := commitedIDs[s]
-				_, inASet := activeIDs[s]
-
-				_, _ = fmt.Fprintf(w, "%d: %s\tsSet: %s\tactive: %s\ttktH: %d\tseedH: %d\tdeals: %v\t toUpgrade:%t\n",
-					s,
-					st.State,
-					yesno(inSSet),
-					yesno(inASet),
-					st.Ticket.Epoch,
-					st.Seed.Epoch,
-					st.Deals,
-					st.ToUpgrade,
-				)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i] < list[j]
+	})
+
+	w := tabwriter.NewWriter(out, 8, 4, 1, ' ', 0)
+
+	for _, s := range list {
+		if err, ok := sl.errs[s]; ok {
+			fmt.Fprintf(w, "%d:\tError: %s\n", s, err)
+			continue
+		}
+		st := sl.status[s]
+		if !labels.Matches(st.Labels, sl.selector) {
+			continue
+		}
+
+		if sl.showRemoved || st.State != api.SectorState(sealing.Removed) {
+			_, inSSet := sl.committed[s]
+			_, inASet := sl.active[s]
+
+			_, _ = fmt.Fprintf(w, "%d: %s\tsSet: %s\tactive: %s\ttktH: %d\tseedH: %d\tdeals: %v\t toUpgrade:%t",
+				s,
+				st.State,
+				yesno(inSSet),
+				yesno(inASet),
+				st.Ticket.Epoch,
+				st.Seed.Epoch,
+				st.Deals,
+				st.ToUpgrade,
+			)
+			if len(st.Labels) > 0 {
+				_, _ = fmt.Fprintf(w, "\tlabels: %s", labels.String(st.Labels))
 			}
+			_, _ = fmt.Fprintln(w)
 		}
+	}
+
+	return w.Flush()
+}
 
-		return w.Flush()
+var sectorsLabelCmd = &cli.Command{
+	Name:      "label",
+	Usage:     "Set labels of a sector",
+	ArgsUsage: "<sectorNum> <key=value> [key=value ...]",
+	Description: `Labels are kept by the miner only, they can be used to filter sector lists,
+   e.g. 'sectors list -l customer=acme'. Pass key= to remove a label.`,
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() < 2 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a sector number and labels"))
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("could not parse sector number: %w", err)
+		}
+
+		l, err := labels.Parse(cctx.Args().Tail())
+		if err != nil {
+			return err
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		return nodeApi.SectorsSetLabels(lcli.ReqContext(cctx), abi.SectorNumber(id), l)
 	},
 }
 
@@ -306,6 +687,54 @@ var sectorsMarkForUpgradeCmd = &cli.Command{
 	},
 }
 
+var sectorsReadCmd = &cli.Command{
+	Name:      "read",
+	Usage:     "Read a range of the unsealed data of a sector, unsealing only the part covering it",
+	ArgsUsage: "<sectorNum> <offset> <length>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "file to write the data to, stdout by default",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 3 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("must pass sector number, offset and length"))
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().Get(0), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("could not parse sector number: %w", err)
+		}
+		offset, err := units.RAMInBytes(cctx.Args().Get(1))
+		if err != nil || offset < 0 {
+			return xerrors.Errorf("could not parse offset '%s'", cctx.Args().Get(1))
+		}
+		length, err := units.RAMInBytes(cctx.Args().Get(2))
+		if err != nil || length <= 0 {
+			return xerrors.Errorf("could not parse length '%s'", cctx.Args().Get(2))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		data, err := nodeApi.SectorUnsealRange(ctx, abi.SectorNumber(id), uint64(offset), uint64(length))
+		if err != nil {
+			return err
+		}
+
+		if out := cctx.String("output"); out != "" {
+			return ioutil.WriteFile(out, data, 0644)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
+
 var sectorsStartSealCmd = &cli.Command{
 	Name:      "seal",
 	Usage:     "Manually start sealing a sector (filling any unused space with junk)",
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+var sectorsArchiveCmd = &cli.Command{
+	Name:  "archive",
+	Usage: "Manage sectors in the external archive",
+	Description: `The archive, set in the [Archive] config section, holds sectors which are
+   rarely read, e.g. terminated sectors kept for their deal data, on tape or
+   cold storage. Reads of sectors only found in the archive, retrievals
+   included, wait for their recall up to Archive.RecallBudget.`,
+	Subcommands: []*cli.Command{
+		sectorsArchivePutCmd,
+		sectorsArchiveRecallCmd,
+		sectorsArchiveListCmd,
+	},
+}
+
+var sectorsArchivePutCmd = &cli.Command{
+	Name:      "put",
+	Usage:     "Copy the sealed and cache files of sectors to the archive",
+	ArgsUsage: "<sectorNum ...>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "remove-local",
+			Usage: "remove the local copies once archived, only for removed sectors and sectors terminated or expired on chain",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		sectors, err := parseSectorNumbers(cctx)
+		if err != nil {
+			return err
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureSectorArchive); err != nil {
+			return err
+		}
+
+		for _, s := range sectors {
+			if err := nodeApi.SectorArchive(ctx, s, cctx.Bool("remove-local")); err != nil {
+				return xerrors.Errorf("archiving sector %d: %w", s, err)
+			}
+			fmt.Printf("sector %d archived\n", s)
+		}
+		return nil
+	},
+}
+
+var sectorsArchiveRecallCmd = &cli.Command{
+	Name:      "recall",
+	Usage:     "Bring archived sectors back into local storage",
+	ArgsUsage: "<sectorNum ...>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "wait",
+			Usage: "wait for the recalls to finish",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		sectors, err := parseSectorNumbers(cctx)
+		if err != nil {
+			return err
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureSectorArchive); err != nil {
+			return err
+		}
+
+		for _, s := range sectors {
+			st, err := nodeApi.SectorRecall(ctx, s)
+			if err != nil {
+				return xerrors.Errorf("recalling sector %d: %w", s, err)
+			}
+			fmt.Printf("sector %d: %s\n", s, recallState(st))
+		}
+
+		if !cctx.Bool("wait") {
+			return nil
+		}
+
+		for _, s := range sectors {
+			for {
+				st, err := nodeApi.SectorRecall(ctx, s)
+				if err != nil {
+					return xerrors.Errorf("recalling sector %d: %w", s, err)
+				}
+				if st.Done {
+					fmt.Printf("sector %d: %s\n", s, recallState(st))
+					break
+				}
+
+				select {
+				case <-time.After(30 * time.Second):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		return nil
+	},
+}
+
+var sectorsArchiveListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List the sectors held by the archive",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureSectorArchive); err != nil {
+			return err
+		}
+
+		archived, err := nodeApi.SectorArchiveList(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "Sector\tLocal\tRecall")
+		for _, a := range archived {
+			recall := "-"
+			if a.Recall != nil {
+				recall = recallState(*a.Recall)
+			}
+			_, _ = fmt.Fprintf(tw, "%d\t%t\t%s\n", a.Sector.Number, a.Local, recall)
+		}
+		return tw.Flush()
+	},
+}
+
+func recallState(st storiface.RecallStatus) string {
+	switch {
+	case st.Error != "":
+		return "failed: " + st.Error
+	case st.Done:
+		return "recalled"
+	}
+
+	readyIn := time.Until(st.ReadyAt)
+	if readyIn <= 0 {
+		return "recalling, staged"
+	}
+	return fmt.Sprintf("recalling, staged in %s", readyIn.Truncate(time.Second))
+}
+
+func parseSectorNumbers(cctx *cli.Context) ([]abi.SectorNumber, error) {
+	if !cctx.Args().Present() {
+		return nil, lcli.ShowHelp(cctx, xerrors.Errorf("expected sector numbers"))
+	}
+
+	var sectors []abi.SectorNumber
+	for _, arg := range cctx.Args().Slice() {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("could not parse sector number: %w", err)
+		}
+		sectors = append(sectors, abi.SectorNumber(id))
+	}
+	return sectors, nil
+}
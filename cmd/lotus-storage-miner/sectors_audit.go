@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+)
+
+type auditIssue struct {
+	sector abi.SectorNumber
+	issue  string
+	fix    string
+}
+
+// states in which a sector is expected to be in the on-chain sector set
+var auditOnChainStates = map[api.SectorState]struct{}{
+	api.SectorState(sealing.Proving):       {},
+	api.SectorState(sealing.Faulty):        {},
+	api.SectorState(sealing.FaultReported): {},
+	api.SectorState(sealing.FaultedFinal):  {},
+}
+
+var sectorsAuditCmd = &cli.Command{
+	Name:  "audit",
+	Usage: "Cross-check local sector metadata against on-chain state",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "expiring-within",
+			Usage: "report sectors expiring within this many epochs",
+			Value: 7 * builtin.EpochsInDay,
+		},
+		&cli.BoolFlag{
+			Name:  "check-deals",
+			Usage: "check deals of on-chain sectors against market state",
+			Value: true,
+		},
+		&cli.BoolFlag{
+			Name:  "check-storage",
+			Usage: "check that sealed and cache files of on-chain sectors are indexed",
+			Value: true,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		fullApi, closer2, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer2()
+
+		ctx := lcli.ReqContext(cctx)
+
+		maddr, err := nodeApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+		mid, err := address.IDFromAddress(maddr)
+		if err != nil {
+			return err
+		}
+
+		head, err := fullApi.ChainHead(ctx)
+		if err != nil {
+			return err
+		}
+
+		onChain, err := fullApi.StateMinerSectors(ctx, maddr, nil, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting on-chain sectors: %w", err)
+		}
+		chainSectors := make(map[abi.SectorNumber]*miner.SectorOnChainInfo, len(onChain))
+		for _, s := range onChain {
+			chainSectors[s.SectorNumber] = s
+		}
+
+		faults, err := fullApi.StateMinerFaults(ctx, maddr, head.Key())
+		if err != nil {
+			return xerrors.Errorf("getting faults: %w", err)
+		}
+		faulty := map[abi.SectorNumber]struct{}{}
+		if err := faults.ForEach(func(s uint64) error {
+			faulty[abi.SectorNumber(s)] = struct{}{}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		list, err := nodeApi.SectorsList(ctx)
+		if err != nil {
+			return err
+		}
+
+		var issues []auditIssue
+		report := func(s abi.SectorNumber, issue, fix string) {
+			issues = append(issues, auditIssue{sector: s, issue: issue, fix: fix})
+		}
+
+		local := map[abi.SectorNumber]struct{}{}
+		for _, s := range list {
+			local[s] = struct{}{}
+
+			st, err := nodeApi.SectorsStatus(ctx, s, false)
+			if err != nil {
+				report(s, fmt.Sprintf("reading local metadata: %s", err), "check the miner metadata datastore")
+				continue
+			}
+
+			oci, ok := chainSectors[s]
+			_, expectOnChain := auditOnChainStates[st.State]
+			switch {
+			case !ok && expectOnChain:
+				report(s, fmt.Sprintf("local state is %s, but the sector isn't on chain", st.State),
+					"if the sector expired or was terminated, remove it with 'sectors remove'")
+				continue
+			case ok && !expectOnChain:
+				if st.State == api.SectorState(sealing.Removed) || st.State == api.SectorState(sealing.Removing) {
+					report(s, fmt.Sprintf("local state is %s, but the sector is still on chain", st.State),
+						"the sector will fault unless it's terminated on chain")
+				} else {
+					report(s, fmt.Sprintf("local state is %s, but the sector is already on chain", st.State),
+						"check the sector log with 'sectors status --log', consider 'sectors update-state' to Proving")
+				}
+			case !ok:
+				continue
+			}
+
+			if st.CommR == nil || !st.CommR.Equals(oci.SealedCID) {
+				report(s, fmt.Sprintf("local CommR %v doesn't match on-chain sealed CID %s", st.CommR, oci.SealedCID),
+					"local metadata or sealed files don't belong to this sector; WindowPoSt will fail for it")
+			}
+
+			if !sameDeals(st.Deals, oci.DealIDs) {
+				report(s, fmt.Sprintf("local deals %v don't match on-chain deals %v", st.Deals, oci.DealIDs),
+					"local deal metadata is stale, retrievals of those deals may fail")
+			}
+		}
+
+		for _, oci := range onChain {
+			s := oci.SectorNumber
+
+			if _, ok := local[s]; !ok {
+				report(s, "on chain, but unknown to this miner",
+					"import the sector metadata with 'migrate import', or the sector will be faulted")
+			}
+
+			if _, ok := faulty[s]; ok {
+				report(s, "faulty on chain",
+					"check storage with 'storage find'; recoveries are declared automatically once the files are readable")
+			}
+
+			if oci.Expiration <= head.Height() {
+				report(s, fmt.Sprintf("expired at epoch %d", oci.Expiration), "remove it with 'sectors remove'")
+			} else if left := oci.Expiration - head.Height(); int64(left) <= cctx.Int64("expiring-within") {
+				report(s, fmt.Sprintf("expires in %d epochs (epoch %d)", left, oci.Expiration),
+					"extend the sector if its storage should be kept")
+			}
+
+			if cctx.Bool("check-storage") {
+				sid := abi.SectorID{Miner: abi.ActorID(mid), Number: s}
+				for _, ft := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+					si, err := nodeApi.StorageFindSector(ctx, sid, ft, oci.SealProof, false)
+					if err != nil {
+						report(s, fmt.Sprintf("finding %s files: %s", ft, err), "check 'storage list'")
+						continue
+					}
+					if len(si) == 0 {
+						report(s, fmt.Sprintf("no storage path has %s files", ft),
+							"attach the storage holding the sector with 'storage attach', or the sector will be faulted")
+					}
+				}
+			}
+
+			if cctx.Bool("check-deals") {
+				for _, did := range oci.DealIDs {
+					d, err := fullApi.StateMarketStorageDeal(ctx, did, head.Key())
+					if err != nil {
+						report(s, fmt.Sprintf("deal %d not found in market state: %s", did, err), "the deal may have expired")
+						continue
+					}
+					if d.Proposal.Provider != maddr {
+						report(s, fmt.Sprintf("deal %d belongs to provider %s", did, d.Proposal.Provider), "on-chain state is inconsistent")
+					}
+					if d.State.SlashEpoch >= 0 {
+						report(s, fmt.Sprintf("deal %d was slashed at epoch %d", did, d.State.SlashEpoch), "")
+					}
+					if d.Proposal.EndEpoch > oci.Expiration {
+						report(s, fmt.Sprintf("deal %d ends at %d, after the sector expires at %d", did, d.Proposal.EndEpoch, oci.Expiration),
+							"extend the sector before it expires")
+					}
+				}
+			}
+		}
+
+		sort.SliceStable(issues, func(i, j int) bool {
+			return issues[i].sector < issues[j].sector
+		})
+
+		fmt.Printf("Audited %d local and %d on-chain sectors at epoch %d: %d issues\n", len(list), len(onChain), head.Height(), len(issues))
+		if len(issues) == 0 {
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Sector\tIssue\tSuggestion\n")
+		for _, i := range issues {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", i.sector, i.issue, i.fix)
+		}
+		return w.Flush()
+	},
+}
+
+func sameDeals(a, b []abi.DealID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := make(map[abi.DealID]int, len(a))
+	for _, d := range a {
+		seen[d]++
+	}
+	for _, d := range b {
+		if seen[d] == 0 {
+			return false
+		}
+		seen[d]--
+	}
+
+	return true
+}
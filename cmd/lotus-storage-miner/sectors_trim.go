@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+)
+
+var sectorsTrimCacheCmd = &cli.Command{
+	Name:  "trim-cache",
+	Usage: "Trim caches of finalized sectors",
+	Description: `Removes the layers, tree-c and tree-d files from caches of proving
+sectors kept with the full cache, leaving only the files needed for PoSt:
+p_aux, t_aux and tree-r-last. Removed files can't be restored.`,
+	ArgsUsage: "[sectorNum ...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "level",
+			Usage: "trim level: post",
+			Value: string(storiface.CacheTrimPoSt),
+		},
+		&cli.BoolFlag{
+			Name:  "cc",
+			Usage: "trim all proving committed capacity sectors",
+		},
+		&cli.BoolFlag{
+			Name:  "deals",
+			Usage: "trim all proving sectors with deals",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		level, err := storiface.ParseCacheTrimLevel(cctx.String("level"))
+		if err != nil {
+			return err
+		}
+		if level == storiface.CacheTrimFull {
+			return xerrors.Errorf("caches of finalized sectors can't be restored to full")
+		}
+
+		if cctx.Args().Present() == (cctx.Bool("cc") || cctx.Bool("deals")) {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("pass either sector numbers, or --cc and/or --deals"))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		var sectors []abi.SectorNumber
+		if cctx.Args().Present() {
+			for _, arg := range cctx.Args().Slice() {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return xerrors.Errorf("could not parse sector number: %w", err)
+				}
+				sectors = append(sectors, abi.SectorNumber(id))
+			}
+		} else {
+			list, err := nodeApi.SectorsList(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, s := range list {
+				st, err := nodeApi.SectorsStatus(ctx, s, false)
+				if err != nil {
+					return xerrors.Errorf("getting status of sector %d: %w", s, err)
+				}
+				if st.State != api.SectorState(sealing.Proving) {
+					continue
+				}
+
+				if hasDeals(st.Deals) && cctx.Bool("deals") || !hasDeals(st.Deals) && cctx.Bool("cc") {
+					sectors = append(sectors, s)
+				}
+			}
+		}
+
+		var failed int
+		for _, s := range sectors {
+			if err := nodeApi.SectorTrimCache(ctx, s, level); err != nil {
+				fmt.Printf("sector %d: %s\n", s, err)
+				failed++
+				continue
+			}
+			fmt.Printf("sector %d: trimmed to %s\n", s, level)
+		}
+
+		if failed > 0 {
+			return xerrors.Errorf("failed to trim %d of %d sectors", failed, len(sectors))
+		}
+		return nil
+	},
+}
+
+func hasDeals(deals []abi.DealID) bool {
+	for _, d := range deals {
+		if d != 0 {
+			return true
+		}
+	}
+	return false
+}
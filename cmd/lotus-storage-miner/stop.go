@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	_ "net/http/pprof"
+	"time"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 
 	lcli "github.com/filecoin-project/lotus/cli"
 )
@@ -11,15 +14,68 @@ import (
 var stopCmd = &cli.Command{
 	Name:  "stop",
 	Usage: "Stop a running lotus miner",
-	Flags: []cli.Flag{},
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "drain",
+			Usage: "stop assigning sealing tasks, and wait for assigned tasks to finish before stopping",
+		},
+		&cli.DurationFlag{
+			Name:  "drain-timeout",
+			Usage: "stop anyway when tasks are still running after this long, 0 waits forever",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
+		ctx := lcli.ReqContext(cctx)
+
+		if cctx.Bool("drain") {
+			nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+			if err != nil {
+				return err
+			}
+			defer closer()
+
+			if err := nodeApi.SealingDrain(ctx); err != nil {
+				return xerrors.Errorf("draining: %w", err)
+			}
+
+			var deadline <-chan time.Time
+			if d := cctx.Duration("drain-timeout"); d > 0 {
+				deadline = time.After(d)
+			}
+
+		wait:
+			for {
+				jobs, err := nodeApi.WorkerJobs(ctx)
+				if err != nil {
+					return xerrors.Errorf("getting worker jobs: %w", err)
+				}
+				var n int
+				for _, wj := range jobs {
+					n += len(wj)
+				}
+				if n == 0 {
+					break
+				}
+				fmt.Printf("Waiting for %d sealing tasks to finish\n", n)
+
+				select {
+				case <-time.After(30 * time.Second):
+				case <-deadline:
+					fmt.Printf("Drain timeout reached with %d tasks running\n", n)
+					break wait
+				case <-ctx.Done():
+					return xerrors.Errorf("interrupted, the miner stays drained until restarted")
+				}
+			}
+		}
+
 		api, closer, err := lcli.GetAPI(cctx)
 		if err != nil {
 			return err
 		}
 		defer closer()
 
-		err = api.Shutdown(lcli.ReqContext(cctx))
+		err = api.Shutdown(ctx)
 		if err != nil {
 			return err
 		}
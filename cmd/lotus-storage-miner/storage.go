@@ -59,6 +59,10 @@ var storageAttachCmd = &cli.Command{
 			Name:  "store",
 			Usage: "(for init) use path for long-term storage",
 		},
+		&cli.BoolFlag{
+			Name:  "replica",
+			Usage: "(for init) the path holds read-only copies of sealed sectors, kept in sync outside of lotus, to balance PoSt reads across",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
@@ -97,9 +101,13 @@ var storageAttachCmd = &cli.Command{
 				Weight:   cctx.Uint64("weight"),
 				CanSeal:  cctx.Bool("seal"),
 				CanStore: cctx.Bool("store"),
+				Replica:  cctx.Bool("replica"),
 			}
 
-			if !(cfg.CanStore || cfg.CanSeal) {
+			if cfg.Replica && (cfg.CanStore || cfg.CanSeal) {
+				return xerrors.Errorf("--replica can't be used with --store or --seal")
+			}
+			if !(cfg.CanStore || cfg.CanSeal || cfg.Replica) {
 				return xerrors.Errorf("must specify at least one of --store of --seal")
 			}
 
@@ -229,6 +237,8 @@ var storageListCmd = &cli.Command{
 					fmt.Print(color.CyanString("Store"))
 				}
 				fmt.Println("")
+			} else if si.Replica {
+				fmt.Println(color.HiYellowString("Use: Replica"))
 			} else {
 				fmt.Print(color.HiYellowString("Use: ReadOnly"))
 			}
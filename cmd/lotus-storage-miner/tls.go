@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"golang.org/x/xerrors"
+
+	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/lib/addrutil"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+// checkTLS makes sure the TLS certificate and key can be loaded, so a bad
+// configuration fails before the node starts
+func checkTLS(opt config.StartupConfig) error {
+	if opt.TLSCert == "" && opt.TLSKey == "" {
+		return nil
+	}
+	if opt.TLSCert == "" || opt.TLSKey == "" {
+		return xerrors.New("serving the API over TLS needs both a certificate and a key")
+	}
+
+	if _, err := tls.LoadX509KeyPair(opt.TLSCert, opt.TLSKey); err != nil {
+		return xerrors.Errorf("loading TLS certificate: %w", err)
+	}
+	return nil
+}
+
+// serve serves srv on lst, over TLS when a certificate is configured
+func serve(srv *http.Server, lst net.Listener, opt config.StartupConfig) error {
+	if opt.TLSCert != "" {
+		return srv.ServeTLS(lst, opt.TLSCert, opt.TLSKey)
+	}
+	return srv.Serve(lst)
+}
+
+// listenAPI listens on the API endpoint
+func listenAPI(endpoint multiaddr.Multiaddr, opt config.StartupConfig) (manet.Listener, error) {
+	if _, unix := addrutil.UnixPath(endpoint); unix && opt.TLSCert != "" {
+		return nil, xerrors.New("the API can't be served over TLS on a unix socket")
+	}
+
+	endpoint, _ = addrutil.SplitTLS(endpoint)
+	return addrutil.Listen(endpoint)
+}
+
+// apiEndpoint is the endpoint written to the repo api file, local clients
+// read it to find the miner
+func apiEndpoint(listen multiaddr.Multiaddr, opt config.StartupConfig) multiaddr.Multiaddr {
+	if opt.TLSCert != "" {
+		return addrutil.WithTLS(listen)
+	}
+	return listen
+}
+
+// tlsStorageURLs advertises the /remote endpoint of the miner with https
+func tlsStorageURLs(lr repo.LockedRepo) (sectorstorage.URLs, error) {
+	c, err := lr.Config()
+	if err != nil {
+		return nil, xerrors.Errorf("reading config: %w", err)
+	}
+	cfg, ok := c.(*config.StorageMiner)
+	if !ok {
+		return nil, xerrors.Errorf("invalid config for repo, got: %T", c)
+	}
+
+	return sectorstorage.URLs{"https://" + cfg.API.RemoteListenAddress + "/remote"}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/lotus/api/apistruct"
+	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/lotus/lib/quota"
+)
+
+var tokensCmd = &cli.Command{
+	Name:  "tokens",
+	Usage: "Manage API tokens with usage quotas, and the tokens of workers",
+	Description: `Tokens with a quota can be handed to partners sharing access to the
+   miner API. Usage is counted in memory, counters reset when the miner
+   restarts.`,
+	Subcommands: []*cli.Command{
+		tokensCreateCmd,
+		tokensUsageCmd,
+		tokensWorkerCmd,
+	},
+}
+
+var tokensCreateCmd = &cli.Command{
+	Name:  "create",
+	Usage: "Create a token limited by a quota",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "perm",
+			Usage: "permission to assign to the token, one of: read, write, sign, admin",
+			Value: "read",
+		},
+		&cli.StringFlag{
+			Name:  "max-remote-bytes-per-day",
+			Usage: "maximum bytes served through /remote per UTC day, e.g. 100GiB (0 for no limit)",
+			Value: "0",
+		},
+		&cli.Uint64Flag{
+			Name:  "max-calls-per-minute",
+			Usage: "maximum RPC calls per minute (0 for no limit)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		idx := 0
+		for i, p := range apistruct.AllPermissions {
+			if auth.Permission(cctx.String("perm")) == p {
+				idx = i + 1
+			}
+		}
+		if idx == 0 {
+			return xerrors.Errorf("--perm flag has to be one of: %s", apistruct.AllPermissions)
+		}
+
+		maxBytes, err := units.RAMInBytes(cctx.String("max-remote-bytes-per-day"))
+		if err != nil {
+			return xerrors.Errorf("parsing max-remote-bytes-per-day: %w", err)
+		}
+
+		// slice on [:idx] so for example: 'sign' gives you [read, write, sign]
+		token, err := nodeApi.AuthNewWithQuota(ctx, apistruct.AllPermissions[:idx], quota.Quota{
+			RemoteBytesPerDay: uint64(maxBytes),
+			CallsPerMinute:    cctx.Uint64("max-calls-per-minute"),
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(token))
+		return nil
+	},
+}
+
+var tokensUsageCmd = &cli.Command{
+	Name:      "usage",
+	Usage:     "Show usage of a token created with a quota",
+	ArgsUsage: "[token]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("expected a token")
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		u, err := nodeApi.TokenUsage(ctx, cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		limit := func(used, max uint64, f func(uint64) string) string {
+			if max == 0 {
+				return f(used) + " (no limit)"
+			}
+			return fmt.Sprintf("%s / %s", f(used), f(max))
+		}
+		num := func(n uint64) string {
+			return fmt.Sprint(n)
+		}
+
+		fmt.Printf("Token ID:           %s\n", u.TokenID)
+		fmt.Printf("Remote bytes today: %s\n", limit(u.RemoteBytesToday, u.Quota.RemoteBytesPerDay, humanize.IBytes))
+		fmt.Printf("Calls this minute:  %s\n", limit(u.CallsThisMinute, u.Quota.CallsPerMinute, num))
+		fmt.Printf("Total remote bytes: %s\n", humanize.IBytes(u.TotalRemoteBytes))
+		fmt.Printf("Total calls:        %d\n", u.TotalCalls)
+		if u.LastUsed.IsZero() {
+			fmt.Printf("Last used:          never\n")
+		} else {
+			fmt.Printf("Last used:          %s (%s ago)\n", u.LastUsed.Format(time.RFC3339), time.Since(u.LastUsed).Truncate(time.Second))
+		}
+
+		return nil
+	},
+}
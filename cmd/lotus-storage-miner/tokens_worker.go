@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/build"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var tokensWorkerCmd = &cli.Command{
+	Name:  "worker",
+	Usage: "Manage revocable API tokens of seal workers",
+	Description: `Each worker can get its own token, set in MINER_API_INFO on the worker
+   machine. Revoking the token of a decommissioned or compromised machine
+   cuts it off without rotating the API secret shared by all other tokens:
+   its requests are refused, and the miner drops the workers it connected.`,
+	Subcommands: []*cli.Command{
+		tokensWorkerCreateCmd,
+		tokensWorkerListCmd,
+		tokensWorkerRevokeCmd,
+	},
+}
+
+var tokensWorkerCreateCmd = &cli.Command{
+	Name:      "create",
+	Usage:     "Create a token for a worker",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "perm",
+			Usage: "permission to assign to the token, one of: read, write, sign, admin",
+			Value: "admin",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a worker name, e.g. its hostname"))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureWorkerTokens); err != nil {
+			return err
+		}
+
+		idx := 0
+		for i, p := range apistruct.AllPermissions {
+			if auth.Permission(cctx.String("perm")) == p {
+				idx = i + 1
+			}
+		}
+		if idx == 0 {
+			return xerrors.Errorf("--perm flag has to be one of: %s", apistruct.AllPermissions)
+		}
+
+		token, err := nodeApi.WorkerTokenCreate(ctx, cctx.Args().First(), apistruct.AllPermissions[:idx])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(token))
+		return nil
+	},
+}
+
+var tokensWorkerListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List the worker tokens, revoked ones included",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureWorkerTokens); err != nil {
+			return err
+		}
+
+		tokens, err := nodeApi.WorkerTokenList(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ID\tName\tPerms\tCreated\tLast Used\tRevoked")
+		for _, t := range tokens {
+			lastUsed := "-"
+			if !t.LastUsed.IsZero() {
+				lastUsed = time.Since(t.LastUsed).Truncate(time.Second).String() + " ago"
+			}
+			revoked := "-"
+			if !t.Revoked.IsZero() {
+				revoked = t.Revoked.Format(time.RFC3339)
+			}
+			perm := "-"
+			if len(t.Perms) > 0 {
+				perm = string(t.Perms[len(t.Perms)-1])
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, perm, t.Created.Format(time.RFC3339), lastUsed, revoked)
+		}
+		return tw.Flush()
+	},
+}
+
+var tokensWorkerRevokeCmd = &cli.Command{
+	Name:      "revoke",
+	Usage:     "Revoke a worker token by ID, or all tokens of a worker by name",
+	ArgsUsage: "<name or ID>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return lcli.ShowHelp(cctx, xerrors.Errorf("expected a worker name or token ID"))
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+		if err := lcli.RequireAPIFeature(ctx, nodeApi, build.FeatureWorkerTokens); err != nil {
+			return err
+		}
+
+		return nodeApi.WorkerTokenRevoke(ctx, cctx.Args().First())
+	},
+}
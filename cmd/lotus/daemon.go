@@ -12,14 +12,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"strings"
+	"time"
 
 	"github.com/filecoin-project/lotus/chain/types"
 
 	paramfetch "github.com/filecoin-project/go-paramfetch"
 	"github.com/mitchellh/go-homedir"
-	"github.com/multiformats/go-multiaddr"
 	"github.com/urfave/cli/v2"
 	"go.opencensus.io/plugin/runmetrics"
 	"go.opencensus.io/stats"
@@ -35,11 +36,13 @@ import (
 	"github.com/filecoin-project/lotus/chain/vm"
 	lcli "github.com/filecoin-project/lotus/cli"
 	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
+	"github.com/filecoin-project/lotus/lib/addrutil"
 	"github.com/filecoin-project/lotus/lib/blockstore"
 	"github.com/filecoin-project/lotus/lib/peermgr"
 	"github.com/filecoin-project/lotus/lib/ulimit"
 	"github.com/filecoin-project/lotus/metrics"
 	"github.com/filecoin-project/lotus/node"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/modules"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/testing"
@@ -71,13 +74,46 @@ var daemonStopCmd = &cli.Command{
 	},
 }
 
+var daemonFinalizeUpgradeCmd = &cli.Command{
+	Name:  "finalize-upgrade",
+	Usage: "Remove datastore keys kept for the previous lotus version",
+	Description: `After an upgrade changing datastore keys, values are written under both
+   the old and the new keys, so the previous version can still be started
+   against the repo. Once the upgrade is known to be good, this command moves
+   the remaining values to the new keys and removes the old ones; previous
+   versions can't use the repo afterwards.
+
+   The daemon must be stopped.`,
+	Action: func(cctx *cli.Context) error {
+		r, err := repo.NewFS(cctx.String("repo"))
+		if err != nil {
+			return xerrors.Errorf("opening fs repo: %w", err)
+		}
+
+		lr, err := r.Lock(repo.FullNode)
+		if err != nil {
+			return xerrors.Errorf("locking repo (is the daemon running?): %w", err)
+		}
+		defer lr.Close() //nolint:errcheck
+
+		v, err := repo.FinalizeSchema(lr)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Datastore schema finalized at version %d\n", v)
+		return nil
+	},
+}
+
 // DaemonCmd is the `go-lotus daemon` command
 var DaemonCmd = &cli.Command{
 	Name:  "daemon",
 	Usage: "Start a lotus daemon process",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:  "api",
+			Usage: "address to serve the API on: a port on localhost (1234), host:port, or a multiaddr, like /unix/path/to/api.sock for a unix socket",
 			Value: "1234",
 		},
 		&cli.StringFlag{
@@ -118,6 +154,10 @@ var DaemonCmd = &cli.Command{
 			Name:  "pprof",
 			Usage: "specify name of file for writing cpu profile to",
 		},
+		&cli.StringFlag{
+			Name:  "pprof-serve",
+			Usage: "where to serve pprof: 'api' on the API endpoint, 'off', or a localhost address like 127.0.0.1:6060 only admin tokens can use (API.Pprof)",
+		},
 		&cli.StringFlag{
 			Name:  "profile",
 			Usage: "specify type of node",
@@ -127,9 +167,34 @@ var DaemonCmd = &cli.Command{
 			Usage: "manage open file limit",
 			Value: true,
 		},
-	},
+		&cli.DurationFlag{
+			Name:  "shutdown-grace",
+			Usage: "time in-flight API requests get to finish on shutdown",
+			Value: node.DefaultShutdownGrace,
+		},
+		&cli.DurationFlag{
+			Name:  "shutdown-timeout",
+			Usage: "exit forcefully when shutdown takes longer than this",
+			Value: node.DefaultShutdownTimeout,
+		},
+		&cli.DurationFlag{
+			Name:  "api-slow-call",
+			Usage: "log API calls taking longer than this with their parameters, 0 disables the log",
+			Value: 10 * time.Second,
+		},
+	}, lcli.DaemonizeFlags...),
 	Action: func(cctx *cli.Context) error {
-		err := runmetrics.Enable(runmetrics.RunMetricOptions{
+		repoDir, err := homedir.Expand(cctx.String("repo"))
+		if err != nil {
+			return err
+		}
+		closePid, exit, err := lcli.Daemonize(cctx, filepath.Join(repoDir, "daemon.log"))
+		if err != nil || exit {
+			return err
+		}
+		defer closePid()
+
+		err = runmetrics.Enable(runmetrics.RunMetricOptions{
 			EnableCPU:    true,
 			EnableMemory: true,
 		})
@@ -184,6 +249,14 @@ var DaemonCmd = &cli.Command{
 			return xerrors.Errorf("repo init error: %w", err)
 		}
 
+		cfg, err := daemonConfig(r)
+		if err != nil {
+			return err
+		}
+		if cctx.IsSet("pprof-serve") {
+			cfg.API.Pprof = cctx.String("pprof-serve")
+		}
+
 		if err := paramfetch.GetParams(lcli.ReqContext(cctx), build.ParametersJSON(), 0); err != nil {
 			return xerrors.Errorf("fetching proof parameters: %w", err)
 		}
@@ -246,8 +319,7 @@ var DaemonCmd = &cli.Command{
 
 			node.ApplyIf(func(s *node.Settings) bool { return cctx.IsSet("api") },
 				node.Override(node.SetApiEndpointKey, func(lr repo.LockedRepo) error {
-					apima, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/" +
-						cctx.String("api"))
+					apima, err := addrutil.ParseListenAddress(cctx.String("api"))
 					if err != nil {
 						return err
 					}
@@ -283,14 +355,42 @@ var DaemonCmd = &cli.Command{
 			return xerrors.Errorf("getting api endpoint: %w", err)
 		}
 
+		trace, err := node.APITrace(cfg.API, cctx.String("repo"))
+		if err != nil {
+			return xerrors.Errorf("opening API trace: %w", err)
+		}
+
 		// TODO: properly parse api endpoint (or make it a URL)
-		return serveRPC(api, stop, endpoint, shutdownChan)
+		return serveRPC(api, stop, endpoint, shutdownChan, node.ShutdownConfig{
+			Grace:   cctx.Duration("shutdown-grace"),
+			Timeout: cctx.Duration("shutdown-timeout"),
+		}, cctx.Duration("api-slow-call"), cfg.API, trace)
 	},
 	Subcommands: []*cli.Command{
 		daemonStopCmd,
+		daemonFinalizeUpgradeCmd,
 	},
 }
 
+func daemonConfig(r *repo.FsRepo) (*config.FullNode, error) {
+	lr, err := r.Lock(repo.FullNode)
+	if err != nil {
+		return nil, err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	c, err := lr.Config()
+	if err != nil {
+		return nil, xerrors.Errorf("reading config: %w", err)
+	}
+	cfg, ok := c.(*config.FullNode)
+	if !ok {
+		return nil, xerrors.Errorf("invalid config for repo, got: %T", c)
+	}
+
+	return cfg, nil
+}
+
 func importKey(ctx context.Context, api api.FullNode, f string) error {
 	f, err := homedir.Expand(f)
 	if err != nil {
@@ -1,13 +1,10 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 	_ "net/http/pprof"
-	"os"
-	"os/signal"
-	"syscall"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
@@ -22,29 +19,43 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/lib/addrutil"
+	"github.com/filecoin-project/lotus/lib/approval"
+	"github.com/filecoin-project/lotus/lib/rpctrace"
+	"github.com/filecoin-project/lotus/metrics"
 	"github.com/filecoin-project/lotus/node"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/impl"
 )
 
 var log = logging.Logger("main")
 
-func serveRPC(a api.FullNode, stop node.StopFunc, addr multiaddr.Multiaddr, shutdownCh <-chan struct{}) error {
+func serveRPC(a api.FullNode, stop node.StopFunc, addr multiaddr.Multiaddr, shutdownCh <-chan struct{}, scfg node.ShutdownConfig, slow time.Duration, apiCfg config.API, trace *rpctrace.Recorder) error {
+	limiter := node.RPCLimiter(apiCfg.Limits)
+
+	served := a
+	if trace != nil {
+		defer trace.Close() //nolint:errcheck
+		served = apistruct.TracedFullAPI(a, trace)
+	}
+
 	rpcServer := jsonrpc.NewServer()
-	rpcServer.Register("Filecoin", apistruct.PermissionedFullAPI(a))
+	rpcServer.Register("Filecoin", apistruct.PermissionedFullAPI(apistruct.LimitedFullAPI(metrics.MetricedFullAPI(served, slow), limiter)))
 
 	ah := &auth.Handler{
 		Verify: a.AuthVerify,
-		Next:   rpcServer.ServeHTTP,
+		Next:   limiter.Handler(&approval.Handler{Next: rpcServer}).ServeHTTP,
 	}
 
-	http.Handle("/rpc/v0", ah)
+	mux := http.NewServeMux()
+	mux.Handle("/rpc/v0", &metrics.CallerHandler{Next: ah})
 
 	importAH := &auth.Handler{
 		Verify: a.AuthVerify,
 		Next:   handleImport(a.(*impl.FullNodeAPI)),
 	}
 
-	http.Handle("/rest/v0/import", importAH)
+	mux.Handle("/rest/v0/import", importAH)
 
 	exporter, err := prometheus.NewExporter(prometheus.Options{
 		Namespace: "lotus",
@@ -53,37 +64,29 @@ func serveRPC(a api.FullNode, stop node.StopFunc, addr multiaddr.Multiaddr, shut
 		log.Fatalf("could not create the prometheus stats exporter: %v", err)
 	}
 
-	http.Handle("/debug/metrics", exporter)
+	mux.Handle("/debug/metrics", exporter)
 
-	lst, err := manet.Listen(addr)
+	switch apiCfg.Pprof {
+	case node.PprofAPI:
+		mux.Handle("/", http.DefaultServeMux) // pprof
+	case node.PprofOff, "":
+	default:
+		psrv, err := node.ServePprof(apiCfg.Pprof, a.AuthVerify)
+		if err != nil {
+			return err
+		}
+		defer psrv.Close() //nolint:errcheck
+	}
+
+	lst, err := addrutil.Listen(addr)
 	if err != nil {
 		return xerrors.Errorf("could not listen: %w", err)
 	}
 
-	srv := &http.Server{Handler: http.DefaultServeMux}
-
-	sigCh := make(chan os.Signal, 2)
-	shutdownDone := make(chan struct{})
-	go func() {
-		select {
-		case sig := <-sigCh:
-			log.Warnw("received shutdown", "signal", sig)
-		case <-shutdownCh:
-			log.Warn("received shutdown")
-		}
+	drain := &node.DrainHandler{Next: mux}
+	srv := &http.Server{Handler: node.CORSHandler(apiCfg.CORS, drain)}
 
-		log.Warn("Shutting down...")
-		if err := srv.Shutdown(context.TODO()); err != nil {
-			log.Errorf("shutting down RPC server failed: %s", err)
-		}
-		if err := stop(context.TODO()); err != nil {
-			log.Errorf("graceful shutting down failed: %s", err)
-		}
-		log.Warn("Graceful shutdown successful")
-		_ = log.Sync() //nolint:errcheck
-		close(shutdownDone)
-	}()
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	shutdownDone := node.MonitorShutdown(shutdownCh, scfg, drain, srv, stop)
 
 	err = srv.Serve(manet.NetListener(lst))
 	if err == http.ErrServerClosed {
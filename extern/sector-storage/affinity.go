@@ -0,0 +1,20 @@
+package sectorstorage
+
+import (
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// SetTaskAffinity sets which workers task types are assigned to, from the
+// next scheduling pass on. Tasks which no connected worker may run stay
+// queued.
+func (m *Manager) SetTaskAffinity(a storiface.TaskAffinity) {
+	m.sched.affinityLk.Lock()
+	defer m.sched.affinityLk.Unlock()
+
+	m.sched.affinity = a
+
+	select {
+	case m.sched.resched <- struct{}{}:
+	default:
+	}
+}
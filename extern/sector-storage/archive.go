@@ -0,0 +1,478 @@
+package sectorstorage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// Archiver is an external archive for sectors which are rarely read, e.g. a
+// tape library, or cold cloud storage. Archived sectors can't be proven
+// until they are recalled, which can take hours.
+type Archiver interface {
+	// Put copies the sealed and cache files of the sector to the archive
+	Put(ctx context.Context, sector abi.SectorID, paths stores.SectorPaths) error
+	// Has returns whether the archive holds the sector
+	Has(ctx context.Context, sector abi.SectorID) (bool, error)
+	// List returns the sectors held by the archive
+	List(ctx context.Context) ([]abi.SectorID, error)
+	// Recall asks the archive to stage the sector for reading, and returns
+	// how long until it's staged, 0 when it can be read right away. Calling
+	// it again while the sector is staged returns the time left.
+	Recall(ctx context.Context, sector abi.SectorID) (time.Duration, error)
+	// Get copies the files of a staged sector to paths, and returns
+	// storiface.ErrRecallPending for sectors which aren't staged yet
+	Get(ctx context.Context, sector abi.SectorID, paths stores.SectorPaths) error
+}
+
+// RecallPollInterval is how often the archive is asked about the progress of
+// recalls
+var RecallPollInterval = time.Minute
+
+// ArchiveCallTimeout bounds the archive calls asking about sectors, and
+// ArchiveCopyTimeout the ones copying a sector, so a hung archive doesn't
+// hold up its callers forever
+var (
+	ArchiveCallTimeout = 10 * time.Minute
+	ArchiveCopyTimeout = 12 * time.Hour
+)
+
+var ErrNoArchiver = errors.New("no sector archive configured")
+
+var errNotArchived = errors.New("sector isn't archived")
+
+// ErrRecallBudget is returned for reads of archived sectors which can't be
+// recalled within the recall budget
+var ErrRecallBudget = errors.New("sector recall exceeds the budget")
+
+type recall struct {
+	status storiface.RecallStatus
+	done   chan struct{}
+
+	// started is closed once the archive was asked for the recall, startErr
+	// is set when that failed
+	started  chan struct{}
+	startErr error
+}
+
+// SetArchiver sets the archive of the miner. Reads of sectors only found in
+// the archive wait up to budget for their recall, before they are scheduled,
+// no budget waits as long as the read allows.
+func (m *Manager) SetArchiver(a Archiver, budget time.Duration) {
+	m.archiveLk.Lock()
+	defer m.archiveLk.Unlock()
+
+	m.archiver = a
+	m.recallBudget = budget
+	if m.archiveCtx == nil {
+		m.archiveCtx, m.archiveCancel = context.WithCancel(context.Background())
+	}
+}
+
+// archiveCall calls the archive with ctx bounded by timeout
+func archiveCall(ctx context.Context, timeout time.Duration, cb func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return cb(ctx)
+}
+
+func (m *Manager) getArchiver() (Archiver, time.Duration, error) {
+	m.archiveLk.Lock()
+	defer m.archiveLk.Unlock()
+
+	if m.archiver == nil {
+		return nil, 0, ErrNoArchiver
+	}
+	return m.archiver, m.recallBudget, nil
+}
+
+// ArchiveSector copies the sealed and cache files of a sector to the archive.
+// With removeLocal the local copies are removed once archived, the sector
+// can't be proven anymore until it's recalled.
+func (m *Manager) ArchiveSector(ctx context.Context, sector abi.SectorID, removeLocal bool) error {
+	a, _, err := m.getArchiver()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	read, write := stores.FTSealed|stores.FTCache, stores.FTNone
+	if removeLocal {
+		read, write = write, read
+	}
+	if err := m.index.StorageLock(ctx, sector, read, write); err != nil {
+		return xerrors.Errorf("acquiring sector lock: %w", err)
+	}
+
+	// fetches the files in the storage of the miner, if they are only
+	// stored by workers
+	paths, _, err := m.storage.AcquireSector(ctx, sector, m.scfg.SealProofType, stores.FTSealed|stores.FTCache, stores.FTNone, stores.PathStorage, stores.AcquireCopy)
+	if err != nil {
+		return xerrors.Errorf("acquiring sector files: %w", err)
+	}
+
+	err = archiveCall(ctx, ArchiveCopyTimeout, func(ctx context.Context) error {
+		return a.Put(ctx, sector, paths)
+	})
+	if err != nil {
+		return xerrors.Errorf("archiving sector %d: %w", sector.Number, err)
+	}
+	log.Infow("sector archived", "sector", sector, "removeLocal", removeLocal)
+
+	if !removeLocal {
+		return nil
+	}
+
+	m.archiveLk.Lock()
+	delete(m.recalls, sector)
+	m.archiveLk.Unlock()
+
+	if err := m.storage.Remove(ctx, sector, stores.FTSealed, true); err != nil {
+		return xerrors.Errorf("removing archived sector (sealed): %w", err)
+	}
+	if err := m.storage.Remove(ctx, sector, stores.FTCache, true); err != nil {
+		return xerrors.Errorf("removing archived sector (cache): %w", err)
+	}
+	return nil
+}
+
+// RecallSector starts bringing an archived sector back into local storage,
+// or returns the status of the recall in progress
+func (m *Manager) RecallSector(ctx context.Context, sector abi.SectorID) (storiface.RecallStatus, error) {
+	r, err := m.startRecall(ctx, sector)
+	if err != nil {
+		return storiface.RecallStatus{}, err
+	}
+
+	m.archiveLk.Lock()
+	defer m.archiveLk.Unlock()
+	return r.status, nil
+}
+
+// ArchivedSectors lists the sectors held by the archive
+func (m *Manager) ArchivedSectors(ctx context.Context) ([]storiface.ArchivedSector, error) {
+	a, _, err := m.getArchiver()
+	if err != nil {
+		return nil, err
+	}
+
+	var sectors []abi.SectorID
+	err = archiveCall(ctx, ArchiveCallTimeout, func(ctx context.Context) (err error) {
+		sectors, err = a.List(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("listing archived sectors: %w", err)
+	}
+
+	out := make([]storiface.ArchivedSector, len(sectors))
+	for i, sector := range sectors {
+		local, err := m.haveLocal(ctx, sector)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = storiface.ArchivedSector{Sector: sector, Local: local}
+
+		m.archiveLk.Lock()
+		if r, ok := m.recalls[sector]; ok {
+			st := r.status
+			out[i].Recall = &st
+		}
+		m.archiveLk.Unlock()
+	}
+	return out, nil
+}
+
+// awaitRecall recalls sectors which are only held by the archive, before a
+// task reading them is scheduled. The wait happens here rather than in the
+// scheduler, so the task doesn't hold on to a worker window or resources
+// while the archive stages the sector.
+func (m *Manager) awaitRecall(ctx context.Context, sector abi.SectorID) error {
+	_, budget, err := m.getArchiver()
+	if err != nil {
+		return nil
+	}
+
+	local, err := m.haveLocal(ctx, sector)
+	if err != nil || local {
+		return err
+	}
+
+	r, err := m.startRecall(ctx, sector)
+	if errors.Is(err, errNotArchived) {
+		// the read fails as it does without an archive
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.archiveLk.Lock()
+	readyIn := time.Until(r.status.ReadyAt)
+	m.archiveLk.Unlock()
+
+	if budget > 0 {
+		if readyIn > budget {
+			return xerrors.Errorf("sector %d is archived, it's staged in %s, over the budget of %s, the recall continues: %w", sector.Number, readyIn.Truncate(time.Second), budget, ErrRecallBudget)
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	log.Infow("waiting for the recall of an archived sector", "sector", sector, "readyIn", readyIn)
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		if budget > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return xerrors.Errorf("sector %d wasn't recalled within the budget of %s, the recall continues: %w", sector.Number, budget, ErrRecallBudget)
+		}
+		return ctx.Err()
+	}
+
+	m.archiveLk.Lock()
+	defer m.archiveLk.Unlock()
+	if r.status.Error != "" {
+		return xerrors.Errorf("recalling sector %d: %s", sector.Number, r.status.Error)
+	}
+	return nil
+}
+
+func (m *Manager) startRecall(ctx context.Context, sector abi.SectorID) (*recall, error) {
+	a, _, err := m.getArchiver()
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := m.haveLocal(ctx, sector)
+	if err != nil {
+		return nil, err
+	}
+
+	m.archiveLk.Lock()
+
+	// a recall is started again when the last one failed, or the recalled
+	// files were removed since
+	if r, ok := m.recalls[sector]; ok && (!r.status.Done || (r.status.Error == "" && local)) {
+		m.archiveLk.Unlock()
+
+		select {
+		case <-r.started:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		m.archiveLk.Lock()
+		defer m.archiveLk.Unlock()
+		if r.startErr != nil {
+			return nil, r.startErr
+		}
+		return r, nil
+	}
+
+	// the archive is called without the lock held, concurrent callers wait
+	// for started
+	now := time.Now()
+	r := &recall{
+		status: storiface.RecallStatus{
+			Sector:  sector,
+			Started: now,
+			ReadyAt: now,
+		},
+		done:    make(chan struct{}),
+		started: make(chan struct{}),
+	}
+	m.recalls[sector] = r
+	m.archiveLk.Unlock()
+
+	readyIn, err := m.askRecall(ctx, a, sector)
+
+	m.archiveLk.Lock()
+	if err != nil {
+		r.startErr = err
+		if m.recalls[sector] == r {
+			delete(m.recalls, sector)
+		}
+	} else {
+		r.status.ReadyAt = time.Now().Add(readyIn)
+	}
+	m.archiveLk.Unlock()
+	close(r.started)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infow("recalling archived sector", "sector", sector, "readyIn", readyIn)
+	go m.completeRecall(a, r)
+
+	return r, nil
+}
+
+// askRecall asks the archive to stage a sector it holds
+func (m *Manager) askRecall(ctx context.Context, a Archiver, sector abi.SectorID) (readyIn time.Duration, err error) {
+	var ok bool
+	err = archiveCall(ctx, ArchiveCallTimeout, func(ctx context.Context) (err error) {
+		ok, err = a.Has(ctx, sector)
+		return err
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("checking the archive for sector %d: %w", sector.Number, err)
+	}
+	if !ok {
+		return 0, xerrors.Errorf("sector %d: %w", sector.Number, errNotArchived)
+	}
+
+	err = archiveCall(ctx, ArchiveCallTimeout, func(ctx context.Context) (err error) {
+		readyIn, err = a.Recall(ctx, sector)
+		return err
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("recalling sector %d: %w", sector.Number, err)
+	}
+	return readyIn, nil
+}
+
+// completeRecall waits for the archive to stage the sector, and copies it to
+// local storage. It stops when the manager is closed.
+func (m *Manager) completeRecall(a Archiver, r *recall) {
+	m.archiveLk.Lock()
+	ctx := m.archiveCtx
+	sector := r.status.Sector
+	m.archiveLk.Unlock()
+
+	finish := func(err error) {
+		m.archiveLk.Lock()
+		r.status.Done = true
+		if err != nil {
+			r.status.Error = err.Error()
+		}
+		m.archiveLk.Unlock()
+		close(r.done)
+	}
+
+	for {
+		m.archiveLk.Lock()
+		wait := time.Until(r.status.ReadyAt)
+		m.archiveLk.Unlock()
+
+		if wait > RecallPollInterval {
+			wait = RecallPollInterval
+		}
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				finish(ctx.Err())
+				return
+			}
+		}
+
+		var readyIn time.Duration
+		err := archiveCall(ctx, ArchiveCallTimeout, func(ctx context.Context) (err error) {
+			readyIn, err = a.Recall(ctx, sector)
+			return err
+		})
+		if err != nil {
+			log.Errorw("recalling archived sector", "sector", sector, "error", err)
+			finish(err)
+			return
+		}
+		if readyIn > 0 {
+			m.archiveLk.Lock()
+			r.status.ReadyAt = time.Now().Add(readyIn)
+			m.archiveLk.Unlock()
+			continue
+		}
+
+		err = m.fetchRecalled(ctx, a, sector)
+		if errors.Is(err, storiface.ErrRecallPending) {
+			m.archiveLk.Lock()
+			r.status.ReadyAt = time.Now().Add(RecallPollInterval)
+			m.archiveLk.Unlock()
+			continue
+		}
+		if err != nil {
+			log.Errorw("copying recalled sector", "sector", sector, "error", err)
+		} else {
+			log.Infow("archived sector recalled", "sector", sector)
+		}
+		finish(err)
+		return
+	}
+}
+
+func (m *Manager) fetchRecalled(ctx context.Context, a Archiver, sector abi.SectorID) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := m.index.StorageLock(ctx, sector, stores.FTNone, stores.FTSealed|stores.FTCache); err != nil {
+		return xerrors.Errorf("acquiring sector lock: %w", err)
+	}
+
+	if local, err := m.haveLocal(ctx, sector); err != nil || local {
+		return err
+	}
+
+	ft := stores.FTSealed | stores.FTCache
+	paths, ids, err := m.localStore.AcquireSector(ctx, sector, m.scfg.SealProofType, stores.FTNone, ft, stores.PathStorage, stores.AcquireMove)
+	if err != nil {
+		return xerrors.Errorf("allocating local storage: %w", err)
+	}
+
+	release, err := m.localStore.Reserve(ctx, sector, m.scfg.SealProofType, ft, ids, stores.FsOverheadFinalized)
+	if err != nil {
+		return xerrors.Errorf("reserving storage space: %w", err)
+	}
+	defer release()
+
+	err = archiveCall(ctx, ArchiveCopyTimeout, func(ctx context.Context) error {
+		return a.Get(ctx, sector, paths)
+	})
+	if err != nil {
+		// don't leave partial copies behind
+		for _, p := range []string{paths.Sealed, paths.Cache} {
+			if rerr := os.RemoveAll(p); rerr != nil {
+				log.Warnf("removing partial copy of recalled sector %s: %s", p, rerr)
+			}
+		}
+		return err
+	}
+
+	for _, fileType := range stores.PathTypes {
+		if fileType&ft == 0 {
+			continue
+		}
+		if err := m.index.StorageDeclareSector(ctx, stores.ID(stores.PathByType(ids, fileType)), sector, fileType, true); err != nil {
+			return xerrors.Errorf("declaring recalled sector: %w", err)
+		}
+	}
+	return nil
+}
+
+// haveLocal returns whether the sealed and cache files of the sector are in
+// the storage of the miner or its workers
+func (m *Manager) haveLocal(ctx context.Context, sector abi.SectorID) (bool, error) {
+	for _, ft := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		si, err := m.index.StorageFindSector(ctx, sector, ft, 0, false)
+		if err != nil {
+			return false, xerrors.Errorf("finding sector %d: %w", sector.Number, err)
+		}
+		if len(si) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
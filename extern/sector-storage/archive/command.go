@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// ExitPending is the exit status of a get for sectors which aren't staged
+// yet (EX_TEMPFAIL)
+const ExitPending = 75
+
+// Command archives sectors with an external program, e.g. the tooling of a
+// tape library. It's run with sectors named like in storage paths:
+//
+//	put <sector> <sealed> <cache>   copies the sealed file and cache directory
+//	has <sector>                    prints yes or no
+//	list                            prints the archived sectors, one per line
+//	recall <sector>                 stages the sector, prints the seconds until
+//	                                it's staged, 0 when it is
+//	get <sector> <sealed> <cache>   copies a staged sector to the paths, exits
+//	                                with ExitPending if it isn't staged yet
+type Command struct {
+	path string
+}
+
+func NewCommand(path string) *Command {
+	return &Command{path: path}
+}
+
+func (c *Command) run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, c.path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == ExitPending {
+			return "", storiface.ErrRecallPending
+		}
+		return "", xerrors.Errorf("archive command %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (c *Command) Put(ctx context.Context, sector abi.SectorID, paths stores.SectorPaths) error {
+	_, err := c.run(ctx, "put", stores.SectorName(sector), paths.Sealed, paths.Cache)
+	return err
+}
+
+func (c *Command) Has(ctx context.Context, sector abi.SectorID) (bool, error) {
+	out, err := c.run(ctx, "has", stores.SectorName(sector))
+	if err != nil {
+		return false, err
+	}
+	switch out {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return false, xerrors.Errorf("archive command has: unexpected output %q", out)
+	}
+}
+
+func (c *Command) List(ctx context.Context) ([]abi.SectorID, error) {
+	out, err := c.run(ctx, "list")
+	if err != nil {
+		return nil, err
+	}
+
+	var sectors []abi.SectorID
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		sector, err := stores.ParseSectorID(line)
+		if err != nil {
+			return nil, xerrors.Errorf("archive command list: %w", err)
+		}
+		sectors = append(sectors, sector)
+	}
+	return sectors, sc.Err()
+}
+
+func (c *Command) Recall(ctx context.Context, sector abi.SectorID) (time.Duration, error) {
+	out, err := c.run(ctx, "recall", stores.SectorName(sector))
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseUint(out, 10, 64)
+	if err != nil {
+		return 0, xerrors.Errorf("archive command recall: unexpected output %q", out)
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+func (c *Command) Get(ctx context.Context, sector abi.SectorID, paths stores.SectorPaths) error {
+	_, err := c.run(ctx, "get", stores.SectorName(sector), paths.Sealed, paths.Cache)
+	return err
+}
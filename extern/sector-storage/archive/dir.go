@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+)
+
+var log = logging.Logger("archive")
+
+// Dir archives sectors to a mounted filesystem, e.g. LTFS on tape, or a
+// gateway to cold cloud storage. Sectors are laid out like in a storage path,
+// in the sealed and cache directories, and can be read right away.
+type Dir struct {
+	root string
+}
+
+func NewDir(root string) (*Dir, error) {
+	for _, ft := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		if err := os.MkdirAll(filepath.Join(root, ft.String()), 0755); err != nil {
+			return nil, xerrors.Errorf("creating archive directory: %w", err)
+		}
+	}
+	return &Dir{root: root}, nil
+}
+
+func (d *Dir) path(sector abi.SectorID, ft stores.SectorFileType) string {
+	return filepath.Join(d.root, ft.String(), stores.SectorName(sector))
+}
+
+func (d *Dir) Put(ctx context.Context, sector abi.SectorID, paths stores.SectorPaths) error {
+	// the cache goes first, so sectors with a sealed file are complete
+	for _, ft := range []stores.SectorFileType{stores.FTCache, stores.FTSealed} {
+		dst := d.path(sector, ft)
+		tmp := filepath.Join(filepath.Dir(dst), ".put-"+filepath.Base(dst))
+
+		if err := os.RemoveAll(tmp); err != nil {
+			return err
+		}
+		if err := copyAll(ctx, stores.PathByType(paths, ft), tmp); err != nil {
+			return xerrors.Errorf("copying %s: %w", ft, err)
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dir) Has(ctx context.Context, sector abi.SectorID) (bool, error) {
+	_, err := os.Stat(d.path(sector, stores.FTSealed))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *Dir) List(ctx context.Context) ([]abi.SectorID, error) {
+	ents, err := ioutil.ReadDir(filepath.Join(d.root, stores.FTSealed.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []abi.SectorID
+	for _, ent := range ents {
+		if strings.HasPrefix(ent.Name(), ".") {
+			continue
+		}
+		sector, err := stores.ParseSectorID(ent.Name())
+		if err != nil {
+			log.Warnf("unexpected file in the sector archive: %s", ent.Name())
+			continue
+		}
+		out = append(out, sector)
+	}
+	return out, nil
+}
+
+func (d *Dir) Recall(ctx context.Context, sector abi.SectorID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (d *Dir) Get(ctx context.Context, sector abi.SectorID, paths stores.SectorPaths) error {
+	for _, ft := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		if err := copyAll(ctx, d.path(sector, ft), stores.PathByType(paths, ft)); err != nil {
+			return xerrors.Errorf("copying %s: %w", ft, err)
+		}
+	}
+	return nil
+}
+
+// copyAll copies the file or directory at src to dst
+func copyAll(ctx context.Context, src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(p, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,224 @@
+package sectorstorage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/archive"
+	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+)
+
+// slowArchive stages sectors by stagedAt
+type slowArchive struct {
+	*archive.Dir
+
+	lk       sync.Mutex
+	stagedAt time.Time
+}
+
+func (a *slowArchive) Recall(ctx context.Context, sector abi.SectorID) (time.Duration, error) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if left := time.Until(a.stagedAt); left > 0 {
+		return left, nil
+	}
+	return 0, nil
+}
+
+func (a *slowArchive) setStagedAt(t time.Time) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.stagedAt = t
+}
+
+func TestArchiveRecall(t *testing.T) {
+	ctx := context.Background()
+
+	poll := RecallPollInterval
+	RecallPollInterval = 10 * time.Millisecond
+	defer func() {
+		RecallPollInterval = poll
+	}()
+
+	st := newTestStorage(t)
+	defer st.cleanup()
+
+	si := stores.NewIndex()
+	lstor, err := stores.NewLocal(ctx, st, si, nil)
+	require.NoError(t, err)
+
+	m := &Manager{
+		scfg:       &ffiwrapper.Config{SealProofType: abi.RegisteredSealProof_StackedDrg2KiBV1},
+		ls:         st,
+		storage:    stores.NewRemote(lstor, si, nil, 6000),
+		localStore: lstor,
+		index:      si,
+		recalls:    map[abi.SectorID]*recall{},
+	}
+
+	sector := abi.SectorID{Miner: 1000, Number: 1}
+
+	// a finalized sector
+	ft := stores.FTSealed | stores.FTCache
+	paths, ids, err := lstor.AcquireSector(ctx, sector, m.scfg.SealProofType, stores.FTNone, ft, stores.PathStorage, stores.AcquireMove)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(paths.Sealed, []byte("sealed"), 0644))
+	require.NoError(t, os.MkdirAll(paths.Cache, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(paths.Cache, "p_aux"), []byte("aux"), 0644))
+	require.NoError(t, si.StorageDeclareSector(ctx, stores.ID(ids.Sealed), sector, stores.FTSealed, true))
+	require.NoError(t, si.StorageDeclareSector(ctx, stores.ID(ids.Cache), sector, stores.FTCache, true))
+
+	require.Error(t, m.ArchiveSector(ctx, sector, true), "no archive configured")
+
+	dir, err := ioutil.TempDir("", "sector-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	darch, err := archive.NewDir(dir)
+	require.NoError(t, err)
+
+	arch := &slowArchive{Dir: darch, stagedAt: time.Now().Add(time.Hour)}
+	m.SetArchiver(arch, time.Minute)
+
+	require.NoError(t, m.ArchiveSector(ctx, sector, true))
+	local, err := m.haveLocal(ctx, sector)
+	require.NoError(t, err)
+	require.False(t, local)
+	_, err = os.Stat(paths.Sealed)
+	require.True(t, os.IsNotExist(err))
+
+	// sectors which aren't archived aren't waited for
+	require.NoError(t, m.awaitRecall(ctx, abi.SectorID{Miner: 1000, Number: 2}))
+
+	// staged in an hour, over the budget
+	err = m.awaitRecall(ctx, sector)
+	require.True(t, xerrors.Is(err, ErrRecallBudget), err)
+
+	archived, err := m.ArchivedSectors(ctx)
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	require.Equal(t, sector, archived[0].Sector)
+	require.False(t, archived[0].Local)
+	require.NotNil(t, archived[0].Recall)
+	require.False(t, archived[0].Recall.Done)
+
+	// the archive revises its estimate, the read waits for the recall
+	arch.setStagedAt(time.Now().Add(50 * time.Millisecond))
+	require.Eventually(t, func() bool {
+		st, err := m.RecallSector(ctx, sector)
+		return err == nil && time.Until(st.ReadyAt) < time.Minute
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, m.awaitRecall(ctx, sector))
+
+	local, err = m.haveLocal(ctx, sector)
+	require.NoError(t, err)
+	require.True(t, local)
+
+	p, _, err := lstor.AcquireSector(ctx, sector, m.scfg.SealProofType, ft, stores.FTNone, stores.PathStorage, stores.AcquireMove)
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(p.Sealed)
+	require.NoError(t, err)
+	require.Equal(t, "sealed", string(b))
+	b, err = ioutil.ReadFile(filepath.Join(p.Cache, "p_aux"))
+	require.NoError(t, err)
+	require.Equal(t, "aux", string(b))
+
+	status, err := m.RecallSector(ctx, sector)
+	require.NoError(t, err)
+	require.True(t, status.Done)
+	require.Empty(t, status.Error)
+}
+
+// blockedArchive blocks recalls until unblock is closed
+type blockedArchive struct {
+	*archive.Dir
+
+	unblock chan struct{}
+}
+
+func (a *blockedArchive) Has(ctx context.Context, sector abi.SectorID) (bool, error) {
+	return true, nil
+}
+
+func (a *blockedArchive) Recall(ctx context.Context, sector abi.SectorID) (time.Duration, error) {
+	select {
+	case <-a.unblock:
+		return time.Hour, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func TestArchiveRecallUnlocked(t *testing.T) {
+	ctx := context.Background()
+
+	st := newTestStorage(t)
+	defer st.cleanup()
+
+	si := stores.NewIndex()
+	lstor, err := stores.NewLocal(ctx, st, si, nil)
+	require.NoError(t, err)
+
+	m := &Manager{
+		scfg:       &ffiwrapper.Config{SealProofType: abi.RegisteredSealProof_StackedDrg2KiBV1},
+		localStore: lstor,
+		index:      si,
+		recalls:    map[abi.SectorID]*recall{},
+	}
+
+	dir, err := ioutil.TempDir("", "sector-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	darch, err := archive.NewDir(dir)
+	require.NoError(t, err)
+
+	arch := &blockedArchive{Dir: darch, unblock: make(chan struct{})}
+	m.SetArchiver(arch, 0)
+	defer m.archiveCancel()
+
+	sector := abi.SectorID{Miner: 1000, Number: 1}
+	started := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := m.RecallSector(ctx, sector)
+			started <- err
+		}()
+	}
+
+	// the archive is called without the lock held
+	require.Eventually(t, func() bool {
+		_, err := m.ArchivedSectors(ctx)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	close(arch.unblock)
+	require.NoError(t, <-started)
+	require.NoError(t, <-started)
+
+	status, err := m.RecallSector(ctx, sector)
+	require.NoError(t, err)
+	require.False(t, status.Done)
+	require.True(t, time.Until(status.ReadyAt) > 50*time.Minute)
+
+	// a short call timeout ends hung calls
+	timeout := ArchiveCallTimeout
+	ArchiveCallTimeout = 10 * time.Millisecond
+	defer func() {
+		ArchiveCallTimeout = timeout
+	}()
+	arch.unblock = make(chan struct{})
+	_, err = m.RecallSector(ctx, abi.SectorID{Miner: 1000, Number: 2})
+	require.True(t, xerrors.Is(err, context.DeadlineExceeded), err)
+}
@@ -0,0 +1,51 @@
+package sectorstorage
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// BenchTransfer runs test transfers of each size with the /remote endpoint of
+// a worker, the endpoint is taken from the first of its storage paths
+func (m *Manager) BenchTransfer(ctx context.Context, worker uint64, sizes []uint64, pings int) ([]storiface.TransferBench, error) {
+	m.sched.workersLk.RLock()
+	wh, ok := m.sched.workers[WorkerID(worker)]
+	m.sched.workersLk.RUnlock()
+	if !ok {
+		return nil, xerrors.Errorf("worker %d not found", worker)
+	}
+
+	paths, err := wh.w.Paths(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting worker paths: %w", err)
+	}
+
+	var url string
+	for _, p := range paths {
+		si, err := m.index.StorageInfo(ctx, p.ID)
+		if err != nil {
+			return nil, xerrors.Errorf("getting storage info of %s: %w", p.ID, err)
+		}
+		if len(si.URLs) > 0 {
+			url = si.URLs[0]
+			break
+		}
+	}
+	if url == "" {
+		return nil, xerrors.Errorf("worker %d (%s) has no storage paths with a remote URL", worker, wh.info.Hostname)
+	}
+
+	out := make([]storiface.TransferBench, 0, len(sizes))
+	for _, size := range sizes {
+		res, err := m.storage.BenchTransfer(ctx, url, size, pings)
+		if err != nil {
+			return nil, xerrors.Errorf("transfer of %d bytes: %w", size, err)
+		}
+		out = append(out, res)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package sectorstorage
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+type cacheTrimCtxKey struct{}
+
+// WithCacheTrim sets the level FinalizeSector trims the sector cache to,
+// CacheTrimPoSt by default
+func WithCacheTrim(ctx context.Context, level storiface.CacheTrimLevel) context.Context {
+	return context.WithValue(ctx, cacheTrimCtxKey{}, level)
+}
+
+func cacheTrimLevel(ctx context.Context) storiface.CacheTrimLevel {
+	if l, ok := ctx.Value(cacheTrimCtxKey{}).(storiface.CacheTrimLevel); ok {
+		return l
+	}
+	return storiface.CacheTrimPoSt
+}
+
+// CacheTrimmer trims caches of finalized sectors
+type CacheTrimmer interface {
+	// TrimCache trims the cache of a finalized sector. Removed files can't
+	// be restored.
+	TrimCache(ctx context.Context, sector abi.SectorID, level storiface.CacheTrimLevel) error
+}
+
+func (m *Manager) TrimCache(ctx context.Context, sector abi.SectorID, level storiface.CacheTrimLevel) error {
+	if level == storiface.CacheTrimFull {
+		return xerrors.New("can't restore a full cache of a finalized sector")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := m.index.StorageLock(ctx, sector, stores.FTNone, stores.FTCache); err != nil {
+		return xerrors.Errorf("acquiring sector lock: %w", err)
+	}
+
+	selector := newExistingSelector(m.index, sector, stores.FTCache, false)
+
+	return m.sched.Schedule(ctx, sector, sealtasks.TTFinalize, selector,
+		schedFetch(sector, stores.FTCache, stores.PathStorage, stores.AcquireMove),
+		func(ctx context.Context, w Worker) error {
+			return w.FinalizeSectorTrim(ctx, sector, nil, level)
+		})
+}
+
+var _ CacheTrimmer = &Manager{}
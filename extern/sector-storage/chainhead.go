@@ -0,0 +1,89 @@
+package sectorstorage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// chainHeadsKept is the number of recent heads kept by workers, enough to
+// draw randomness for epochs within finality
+const chainHeadsKept = 900
+
+var relayTimeout = 30 * time.Second
+
+type chainHeads struct {
+	lk    sync.Mutex
+	heads []storiface.ChainHead
+}
+
+func (c *chainHeads) update(head storiface.ChainHead) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	// drop heads replaced by a reorg
+	for len(c.heads) > 0 && c.heads[len(c.heads)-1].Height >= head.Height {
+		c.heads = c.heads[:len(c.heads)-1]
+	}
+
+	c.heads = append(c.heads, head)
+	if len(c.heads) > chainHeadsKept {
+		c.heads = c.heads[len(c.heads)-chainHeadsKept:]
+	}
+}
+
+func (c *chainHeads) latest() (storiface.ChainHead, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if len(c.heads) == 0 {
+		return storiface.ChainHead{}, false
+	}
+	return c.heads[len(c.heads)-1], true
+}
+
+func (c *chainHeads) at(h abi.ChainEpoch) (storiface.ChainHead, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	for i := len(c.heads) - 1; i >= 0; i-- {
+		if c.heads[i].Height == h {
+			return c.heads[i], true
+		}
+		if c.heads[i].Height < h {
+			break
+		}
+	}
+	return storiface.ChainHead{}, false
+}
+
+// RelayChainHead sends a chain head to all connected workers. Failures are
+// logged only; workers catch up with the next head.
+func (m *Manager) RelayChainHead(ctx context.Context, head storiface.ChainHead) {
+	m.sched.workersLk.RLock()
+	workers := make(map[WorkerID]Worker, len(m.sched.workers))
+	for id, wh := range m.sched.workers {
+		workers[id] = wh.w
+	}
+	m.sched.workersLk.RUnlock()
+
+	var wg sync.WaitGroup
+	for id, w := range workers {
+		wg.Add(1)
+		go func(id WorkerID, w Worker) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, relayTimeout)
+			defer cancel()
+
+			if err := w.ChainHeadUpdate(ctx, head); err != nil {
+				log.Warnw("relaying chain head to worker", "worker", id, "height", head.Height, "error", err)
+			}
+		}(id, w)
+	}
+	wg.Wait()
+}
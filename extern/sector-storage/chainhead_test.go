@@ -0,0 +1,42 @@
+package sectorstorage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+func TestChainHeads(t *testing.T) {
+	var c chainHeads
+
+	_, ok := c.latest()
+	require.False(t, ok)
+
+	for h := 1; h <= chainHeadsKept+10; h++ {
+		c.update(storiface.ChainHead{Height: abi.ChainEpoch(h)})
+	}
+
+	head, ok := c.latest()
+	require.True(t, ok)
+	require.Equal(t, abi.ChainEpoch(chainHeadsKept+10), head.Height)
+
+	_, ok = c.at(5)
+	require.False(t, ok, "old heads are dropped")
+
+	// reorg back to a lower height replaces the newer heads
+	c.update(storiface.ChainHead{Height: 100, Ticket: []byte("fork")})
+	head, ok = c.latest()
+	require.True(t, ok)
+	require.Equal(t, []byte("fork"), head.Ticket)
+
+	_, ok = c.at(101)
+	require.False(t, ok)
+
+	head, ok = c.at(100)
+	require.True(t, ok)
+	require.Equal(t, []byte("fork"), head.Ticket)
+}
@@ -0,0 +1,193 @@
+package sectorstorage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+)
+
+// compressionLockWait is how long CheckProvable waits for a compression pass
+// to release the cache of a sector before reporting it faulty
+var compressionLockWait = time.Minute
+
+// CompressCaches compresses rarely read files in caches of finalized sectors
+// in local storage. Sectors which are in use, or for which skip returns true,
+// e.g. sectors due for proving soon, are left for the next pass.
+func (m *Manager) CompressCaches(ctx context.Context, minAge time.Duration, minSaving float64, skip func(abi.SectorID) bool) (stores.CompressStats, error) {
+	return m.forEachLocalCache(ctx, false, skip, func(dir string) (bool, error) {
+		return stores.HasCompressibleFiles(dir, minAge, m.incompressible)
+	}, func(dir string) (stores.CompressStats, error) {
+		return stores.CompressCache(dir, minAge, minSaving, m.incompressible)
+	})
+}
+
+// DecompressCaches restores all compressed cache files in local storage,
+// e.g. after compression was disabled. Replicas synced from compressed
+// caches are restored too. Sectors are skipped like in CompressCaches.
+func (m *Manager) DecompressCaches(ctx context.Context, skip func(abi.SectorID) bool) (stores.CompressStats, error) {
+	return m.forEachLocalCache(ctx, true, skip, stores.HasCompressedFiles, stores.DecompressCache)
+}
+
+// HasCompressedCaches returns whether any sector cache in local storage has
+// compressed files
+func (m *Manager) HasCompressedCaches(ctx context.Context) (bool, error) {
+	found := false
+	err := m.walkLocalCaches(ctx, true, func(sid abi.SectorID, dir string) (bool, error) {
+		has, err := stores.HasCompressedFiles(dir)
+		found = found || has
+		return !found, err
+	})
+	return found, err
+}
+
+// forEachLocalCache calls cb with the cache of each sector which has work
+// left, and isn't in use, while holding a write lock on it
+func (m *Manager) forEachLocalCache(ctx context.Context, replicas bool, skip func(abi.SectorID) bool, pending func(dir string) (bool, error), cb func(dir string) (stores.CompressStats, error)) (stores.CompressStats, error) {
+	var out stores.CompressStats
+
+	err := m.walkLocalCaches(ctx, replicas, func(sid abi.SectorID, dir string) (bool, error) {
+		// don't lock caches without work, PoSt fault checks only try-lock
+		// them
+		todo, err := pending(dir)
+		if err != nil || !todo {
+			return true, err
+		}
+		if skip != nil && skip(sid) {
+			out.Busy++
+			return true, nil
+		}
+
+		st, err := m.withCacheWriteLock(ctx, sid, func() (stores.CompressStats, error) {
+			return cb(dir)
+		})
+		if err != nil {
+			return false, xerrors.Errorf("sector %d: %w", sid.Number, err)
+		}
+		out.Add(st)
+		return true, nil
+	})
+
+	return out, err
+}
+
+// walkLocalCaches calls cb with each sector cache in local storage until it
+// returns false
+func (m *Manager) walkLocalCaches(ctx context.Context, replicas bool, cb func(sid abi.SectorID, dir string) (bool, error)) error {
+	paths, err := m.localStore.Local(ctx)
+	if err != nil {
+		return xerrors.Errorf("listing local storage: %w", err)
+	}
+
+	for _, path := range paths {
+		if !path.CanStore && !(replicas && path.Replica) {
+			continue
+		}
+
+		cacheDir := filepath.Join(path.LocalPath, stores.FTCache.String())
+		ents, err := ioutil.ReadDir(cacheDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return xerrors.Errorf("listing %s: %w", cacheDir, err)
+		}
+
+		for _, ent := range ents {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			sid, err := stores.ParseSectorID(ent.Name())
+			if err != nil || !ent.IsDir() {
+				continue
+			}
+
+			more, err := cb(sid, filepath.Join(cacheDir, ent.Name()))
+			if err != nil {
+				return err
+			}
+			if !more {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) withCacheWriteLock(ctx context.Context, sid abi.SectorID, cb func() (stores.CompressStats, error)) (stores.CompressStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	locked, err := m.index.StorageTryLock(ctx, sid, stores.FTNone, stores.FTCache)
+	if err != nil {
+		return stores.CompressStats{}, xerrors.Errorf("acquiring sector lock: %w", err)
+	}
+	if !locked {
+		// in use, try again next time
+		return stores.CompressStats{Busy: 1}, nil
+	}
+
+	done := make(chan struct{})
+	m.compressLk.Lock()
+	m.compressing[sid] = done
+	m.compressLk.Unlock()
+
+	defer func() {
+		cancel()
+
+		m.compressLk.Lock()
+		delete(m.compressing, sid)
+		m.compressLk.Unlock()
+		close(done)
+	}()
+
+	return cb()
+}
+
+// tryLockAfterCompression waits for up to compressionLockWait for a
+// compression pass holding the cache of the sector to finish, and then tries
+// to lock it again. It returns false when no pass holds the cache.
+func (m *Manager) tryLockAfterCompression(ctx context.Context, sid abi.SectorID, read stores.SectorFileType, write stores.SectorFileType) (bool, error) {
+	m.compressLk.Lock()
+	done, ok := m.compressing[sid]
+	m.compressLk.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	timer := time.NewTimer(compressionLockWait)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	// the index drops the lock of the pass asynchronously
+	for {
+		locked, err := m.index.StorageTryLock(ctx, sid, read, write)
+		if err != nil || locked {
+			return locked, err
+		}
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-timer.C:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sectorstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+)
+
+func TestTryLockAfterCompression(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &Manager{
+		index:       stores.NewIndex(),
+		compressing: map[abi.SectorID]chan struct{}{},
+	}
+	sid := abi.SectorID{Miner: 1000, Number: 1}
+
+	// no compression pass holds the sector
+	locked, err := m.tryLockAfterCompression(ctx, sid, stores.FTSealed|stores.FTCache, stores.FTNone)
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	holding := make(chan struct{})
+	release := make(chan struct{})
+	passDone := make(chan struct{})
+	go func() {
+		defer close(passDone)
+		_, err := m.withCacheWriteLock(ctx, sid, func() (stores.CompressStats, error) {
+			close(holding)
+			<-release
+			return stores.CompressStats{}, nil
+		})
+		require.NoError(t, err)
+	}()
+	<-holding
+
+	lctx, lcancel := context.WithCancel(ctx)
+	defer lcancel()
+
+	locked, err = m.index.StorageTryLock(lctx, sid, stores.FTSealed|stores.FTCache, stores.FTNone)
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	// fault checks wait for the pass rather than reporting a fault
+	locked, err = m.tryLockAfterCompression(lctx, sid, stores.FTSealed|stores.FTCache, stores.FTNone)
+	require.NoError(t, err)
+	require.True(t, locked)
+	<-passDone
+}
@@ -0,0 +1,47 @@
+package sectorstorage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// drainPoll is the interval at which WaitDrained checks for running tasks
+var drainPoll = time.Second
+
+// Drain stops assigning tasks to workers, so the miner can shut down without
+// aborting sealing work. Tasks already assigned to a worker keep running,
+// new tasks stay queued until the miner restarts.
+func (m *Manager) Drain() {
+	if atomic.CompareAndSwapInt32(&m.sched.draining, 0, 1) {
+		log.Warn("draining: no new tasks will be assigned to workers")
+	}
+}
+
+// Draining returns whether Drain was called
+func (m *Manager) Draining() bool {
+	return atomic.LoadInt32(&m.sched.draining) == 1
+}
+
+// WaitDrained drains the manager, and waits until no tasks are assigned to
+// workers anymore
+func (m *Manager) WaitDrained(ctx context.Context) error {
+	m.Drain()
+
+	for {
+		var n int
+		for _, jobs := range m.WorkerJobs() {
+			n += len(jobs)
+		}
+		if n == 0 {
+			return nil
+		}
+		log.Debugw("draining, waiting for tasks to finish", "tasks", n)
+
+		select {
+		case <-time.After(drainPoll):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package sectorstorage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+var energySampleInterval = 5 * time.Second
+
+// energyMeter measures the energy used by a part of the machine
+type energyMeter interface {
+	Name() string
+	// Sample returns the joules used since the previous sample, dt ago
+	Sample(dt time.Duration) (float64, error)
+}
+
+// raplMeter reads the cumulative CPU package energy counters of Intel RAPL
+// (and AMD, which exposes the same powercap interface)
+type raplMeter struct {
+	domains []string
+	last    map[string]uint64
+}
+
+func newRaplMeter() (*raplMeter, error) {
+	paths, err := filepath.Glob("/sys/class/powercap/intel-rapl:*")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &raplMeter{last: map[string]uint64{}}
+	for _, p := range paths {
+		// only top level package domains, core/dram subdomains are included in them
+		if strings.Count(filepath.Base(p), ":") != 1 {
+			continue
+		}
+		if _, err := readUint(filepath.Join(p, "energy_uj")); err != nil {
+			// newer kernels only let root read the counters
+			log.Warnw("can't read RAPL energy counter", "path", p, "error", err)
+			continue
+		}
+		m.domains = append(m.domains, p)
+	}
+
+	if len(m.domains) == 0 {
+		return nil, xerrors.Errorf("no readable RAPL domains")
+	}
+	return m, nil
+}
+
+func readUint(path string) (uint64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+func (m *raplMeter) Name() string {
+	return "rapl"
+}
+
+func (m *raplMeter) Sample(time.Duration) (float64, error) {
+	var uj uint64
+	for _, d := range m.domains {
+		cur, err := readUint(filepath.Join(d, "energy_uj"))
+		if err != nil {
+			return 0, err
+		}
+
+		last, ok := m.last[d]
+		m.last[d] = cur
+		if !ok {
+			continue
+		}
+
+		if cur < last {
+			// the counter wrapped
+			max, err := readUint(filepath.Join(d, "max_energy_range_uj"))
+			if err != nil {
+				return 0, err
+			}
+			uj += max - last + cur
+			continue
+		}
+		uj += cur - last
+	}
+
+	return float64(uj) / 1e6, nil
+}
+
+// gpuMeter samples the power draw of NVIDIA GPUs through nvidia-smi, which
+// reads it from NVML
+type gpuMeter struct {
+	path string
+}
+
+func newGpuMeter() (*gpuMeter, error) {
+	p, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		return nil, err
+	}
+	return &gpuMeter{path: p}, nil
+}
+
+func (m *gpuMeter) Name() string {
+	return "nvml"
+}
+
+func (m *gpuMeter) Sample(dt time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dt)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, m.path, "--query-gpu=power.draw", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return 0, xerrors.Errorf("running nvidia-smi: %w", err)
+	}
+
+	var watts float64
+	for _, l := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		w, err := strconv.ParseFloat(strings.TrimSpace(string(l)), 64)
+		if err != nil {
+			// e.g. '[Not Supported]'
+			continue
+		}
+		watts += w
+	}
+
+	return watts * dt.Seconds(), nil
+}
+
+func detectEnergyMeters() []energyMeter {
+	var out []energyMeter
+
+	if m, err := newRaplMeter(); err != nil {
+		log.Infow("RAPL energy metering not available", "error", err)
+	} else {
+		out = append(out, m)
+	}
+
+	if m, err := newGpuMeter(); err != nil {
+		log.Infow("GPU energy metering not available", "error", err)
+	} else {
+		out = append(out, m)
+	}
+
+	return out
+}
+
+type energyTask struct {
+	task   sealtasks.TaskType
+	start  time.Time
+	joules float64
+}
+
+// energyTracker attributes the energy used by the machine to the sealing
+// tasks running on it. Meters are only sampled while tasks run, and every
+// sample is split evenly between the tasks running at that time, so numbers
+// are an approximation when tasks of different types overlap.
+type energyTracker struct {
+	meters []energyMeter
+	// sampleLk serializes sampling, a stopped sampler may still be finishing
+	// a sample when the next one starts
+	sampleLk sync.Mutex
+
+	lk     sync.Mutex
+	ctr    uint64
+	active map[uint64]*energyTask
+	totals map[sealtasks.TaskType]storiface.TaskEnergy
+	stop   chan struct{}
+}
+
+func newEnergyTracker(meters []energyMeter) *energyTracker {
+	return &energyTracker{
+		meters: meters,
+		active: map[uint64]*energyTask{},
+		totals: map[sealtasks.TaskType]storiface.TaskEnergy{},
+	}
+}
+
+// track records the energy used until the returned func is called
+func (et *energyTracker) track(task sealtasks.TaskType) func() {
+	if et == nil || len(et.meters) == 0 {
+		return func() {}
+	}
+
+	et.lk.Lock()
+	defer et.lk.Unlock()
+
+	id := et.ctr
+	et.ctr++
+	et.active[id] = &energyTask{task: task, start: time.Now()}
+
+	if et.stop == nil {
+		et.stop = make(chan struct{})
+		go et.sample(et.stop)
+	}
+
+	return func() {
+		et.lk.Lock()
+		defer et.lk.Unlock()
+
+		t := et.active[id]
+		delete(et.active, id)
+
+		tot := et.totals[t.task]
+		tot.Tasks++
+		tot.Joules += t.joules
+		tot.Duration += time.Since(t.start)
+		et.totals[t.task] = tot
+
+		if len(et.active) == 0 {
+			close(et.stop)
+			et.stop = nil
+		}
+	}
+}
+
+func (et *energyTracker) sample(stop chan struct{}) {
+	// baseline for cumulative counters
+	et.sampleLk.Lock()
+	for _, m := range et.meters {
+		_, _ = m.Sample(energySampleInterval)
+	}
+	et.sampleLk.Unlock()
+
+	tick := time.NewTicker(energySampleInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-stop:
+			return
+		}
+
+		var joules float64
+		et.sampleLk.Lock()
+		for _, m := range et.meters {
+			j, err := m.Sample(energySampleInterval)
+			if err != nil {
+				log.Warnw("sampling energy meter", "meter", m.Name(), "error", err)
+				continue
+			}
+			joules += j
+		}
+		et.sampleLk.Unlock()
+
+		et.lk.Lock()
+		if len(et.active) > 0 {
+			share := joules / float64(len(et.active))
+			for _, t := range et.active {
+				t.joules += share
+			}
+		}
+		et.lk.Unlock()
+	}
+}
+
+func (et *energyTracker) stats() storiface.WorkerEnergy {
+	out := storiface.WorkerEnergy{
+		Tasks: map[sealtasks.TaskType]storiface.TaskEnergy{},
+	}
+	if et == nil {
+		return out
+	}
+
+	for _, m := range et.meters {
+		out.Meters = append(out.Meters, m.Name())
+	}
+
+	et.lk.Lock()
+	defer et.lk.Unlock()
+
+	for tt, tot := range et.totals {
+		out.Tasks[tt] = tot
+	}
+	return out
+}
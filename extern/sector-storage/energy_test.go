@@ -0,0 +1,69 @@
+package sectorstorage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+)
+
+type constMeter struct {
+	lk      sync.Mutex
+	samples int
+}
+
+func (m *constMeter) Name() string {
+	return "const"
+}
+
+func (m *constMeter) Sample(time.Duration) (float64, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.samples++
+	return 10, nil
+}
+
+func TestEnergyTracker(t *testing.T) {
+	old := energySampleInterval
+	energySampleInterval = 10 * time.Millisecond
+	defer func() {
+		energySampleInterval = old
+	}()
+
+	m := &constMeter{}
+	et := newEnergyTracker([]energyMeter{m})
+
+	done1 := et.track(sealtasks.TTPreCommit1)
+	done2 := et.track(sealtasks.TTPreCommit2)
+
+	require.Eventually(t, func() bool {
+		m.lk.Lock()
+		defer m.lk.Unlock()
+		return m.samples > 3
+	}, time.Second, time.Millisecond)
+
+	done1()
+	done2()
+
+	st := et.stats()
+	require.Equal(t, []string{"const"}, st.Meters)
+	require.Len(t, st.Tasks, 2)
+
+	pc1, pc2 := st.Tasks[sealtasks.TTPreCommit1], st.Tasks[sealtasks.TTPreCommit2]
+	require.Equal(t, uint64(1), pc1.Tasks)
+	require.Greater(t, pc1.Joules, 0.0)
+	// samples are split evenly between running tasks, PC2 may get one more
+	// sample after PC1 finished
+	require.GreaterOrEqual(t, pc2.Joules, pc1.Joules)
+}
+
+func TestEnergyTrackerDisabled(t *testing.T) {
+	var et *energyTracker
+	et.track(sealtasks.TTCommit2)()
+
+	st := et.stats()
+	require.Empty(t, st.Tasks)
+}
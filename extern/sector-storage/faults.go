@@ -17,7 +17,9 @@ type FaultTracker interface {
 	CheckProvable(ctx context.Context, spt abi.RegisteredSealProof, sectors []abi.SectorID) ([]abi.SectorID, error)
 }
 
-// CheckProvable returns unprovable sectors
+// CheckProvable returns unprovable sectors, the sectors without a copy, primary
+// or replica, passing the checks. Failing replicas are marked so they aren't
+// read for proving.
 func (m *Manager) CheckProvable(ctx context.Context, spt abi.RegisteredSealProof, sectors []abi.SectorID) ([]abi.SectorID, error) {
 	var bad []abi.SectorID
 
@@ -36,6 +38,13 @@ func (m *Manager) CheckProvable(ctx context.Context, spt abi.RegisteredSealProof
 			if err != nil {
 				return xerrors.Errorf("acquiring sector lock: %w", err)
 			}
+			if !locked {
+				// cache compression only holds the lock briefly
+				locked, err = m.tryLockAfterCompression(ctx, sector, stores.FTSealed|stores.FTCache, stores.FTNone)
+				if err != nil {
+					return xerrors.Errorf("acquiring sector lock: %w", err)
+				}
+			}
 
 			if !locked {
 				log.Warnw("CheckProvable Sector FAULT: can't acquire read lock", "sector", sector, "sealed")
@@ -43,42 +52,41 @@ func (m *Manager) CheckProvable(ctx context.Context, spt abi.RegisteredSealProof
 				return nil
 			}
 
+			// a replica passing the checks keeps the sector provable
+			provable := false
+			for _, r := range m.localStore.Replicas(ctx, sector, stores.FTSealed|stores.FTCache) {
+				err := checkSectorFiles(r.Paths, ssize)
+				if err != nil {
+					log.Warnw("CheckProvable: replica copy failed checks", "sector", sector, "replica", r.ID, "error", err)
+				}
+				m.localStore.MarkReplica(r.ID, sector, err == nil)
+				provable = provable || err == nil
+			}
+
 			lp, _, err := m.localStore.AcquireSector(ctx, sector, spt, stores.FTSealed|stores.FTCache, stores.FTNone, stores.PathStorage, stores.AcquireMove)
 			if err != nil {
-				log.Warnw("CheckProvable Sector FAULT: acquire sector in checkProvable", "sector", sector, "error", err)
-				bad = append(bad, sector)
+				if !provable {
+					log.Warnw("CheckProvable Sector FAULT: acquire sector in checkProvable", "sector", sector, "error", err)
+					bad = append(bad, sector)
+				}
 				return nil
 			}
 
 			if lp.Sealed == "" || lp.Cache == "" {
-				log.Warnw("CheckProvable Sector FAULT: cache an/or sealed paths not found", "sector", sector, "sealed", lp.Sealed, "cache", lp.Cache)
-				bad = append(bad, sector)
+				if !provable {
+					log.Warnw("CheckProvable Sector FAULT: cache an/or sealed paths not found", "sector", sector, "sealed", lp.Sealed, "cache", lp.Cache)
+					bad = append(bad, sector)
+				}
 				return nil
 			}
 
-			toCheck := map[string]int64{
-				lp.Sealed:                        1,
-				filepath.Join(lp.Cache, "t_aux"): 0,
-				filepath.Join(lp.Cache, "p_aux"): 0,
-			}
-
-			addCachePathsForSectorSize(toCheck, lp.Cache, ssize)
-
-			for p, sz := range toCheck {
-				st, err := os.Stat(p)
-				if err != nil {
-					log.Warnw("CheckProvable Sector FAULT: sector file stat error", "sector", sector, "sealed", lp.Sealed, "cache", lp.Cache, "file", p, "err", err)
-					bad = append(bad, sector)
+			if err := checkSectorFiles(lp, ssize); err != nil {
+				if provable {
+					log.Warnw("CheckProvable: primary copy failed checks, proving from replicas", "sector", sector, "sealed", lp.Sealed, "cache", lp.Cache, "error", err)
 					return nil
 				}
-
-				if sz != 0 {
-					if st.Size() != int64(ssize)*sz {
-						log.Warnw("CheckProvable Sector FAULT: sector file is wrong size", "sector", sector, "sealed", lp.Sealed, "cache", lp.Cache, "file", p, "size", st.Size(), "expectSize", int64(ssize)*sz)
-						bad = append(bad, sector)
-						return nil
-					}
-				}
+				log.Warnw("CheckProvable Sector FAULT: "+err.Error(), "sector", sector, "sealed", lp.Sealed, "cache", lp.Cache)
+				bad = append(bad, sector)
 			}
 
 			return nil
@@ -91,6 +99,36 @@ func (m *Manager) CheckProvable(ctx context.Context, spt abi.RegisteredSealProof
 	return bad, nil
 }
 
+// checkSectorFiles checks the files of a copy of a sealed sector PoSt reads
+func checkSectorFiles(lp stores.SectorPaths, ssize abi.SectorSize) error {
+	toCheck := map[string]int64{
+		lp.Sealed:                        1,
+		filepath.Join(lp.Cache, "t_aux"): 0,
+		filepath.Join(lp.Cache, "p_aux"): 0,
+	}
+
+	addCachePathsForSectorSize(toCheck, lp.Cache, ssize)
+
+	for p, sz := range toCheck {
+		st, err := os.Stat(p)
+		if os.IsNotExist(err) && stores.CompressibleCacheFile(filepath.Base(p)) && stores.HasCompressed(p) {
+			// compressed at rest, decompressed before proving
+			continue
+		}
+		if err != nil {
+			return xerrors.Errorf("sector file stat error: %w", err)
+		}
+
+		if sz != 0 {
+			if st.Size() != int64(ssize)*sz {
+				return xerrors.Errorf("sector file is wrong size: %s, size %d, expected %d", p, st.Size(), int64(ssize)*sz)
+			}
+		}
+	}
+
+	return nil
+}
+
 func addCachePathsForSectorSize(chk map[string]int64, cacheDir string, ssize abi.SectorSize) {
 	switch ssize {
 	case 2 << 10:
@@ -520,6 +520,13 @@ func (sb *Sealer) SealCommit2(ctx context.Context, sector abi.SectorID, phase1Ou
 }
 
 func (sb *Sealer) FinalizeSector(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range) error {
+	return sb.FinalizeSectorTrim(ctx, sector, keepUnsealed, storiface.CacheTrimPoSt)
+}
+
+// FinalizeSectorTrim is FinalizeSector which trims the cache to the given
+// level. With no keepUnsealed ranges the unsealed copy isn't touched, so it
+// can also trim caches of finalized sectors.
+func (sb *Sealer) FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error {
 	if len(keepUnsealed) > 0 {
 		maxPieceSize := abi.PaddedPieceSize(sb.ssize)
 
@@ -582,7 +589,14 @@ func (sb *Sealer) FinalizeSector(ctx context.Context, sector abi.SectorID, keepU
 	}
 	defer done()
 
-	return ffi.ClearCache(uint64(sb.ssize), paths.Cache)
+	switch level {
+	case storiface.CacheTrimFull:
+		return nil
+	case storiface.CacheTrimPoSt:
+		return ffi.ClearCache(uint64(sb.ssize), paths.Cache)
+	default:
+		return xerrors.Errorf("unknown cache trim level '%s'", level)
+	}
 }
 
 func (sb *Sealer) ReleaseUnsealed(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error {
@@ -31,6 +31,7 @@ import (
 
 	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper/basicfs"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 )
 
 func init() {
@@ -382,6 +383,78 @@ func TestSealPoStNoCommit(t *testing.T) {
 	fmt.Printf("EPoSt: %s\n", epost.Sub(precommit).String())
 }
 
+func TestSealTrimPoSt(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	defer requireFDsClosed(t, openFDs(t))
+
+	if runtime.NumCPU() < 10 && os.Getenv("CI") == "" { // don't bother on slow hardware
+		t.Skip("this is slow")
+	}
+	_ = os.Setenv("RUST_LOG", "info")
+
+	getGrothParamFileAndVerifyingKeys(sectorSize)
+
+	dir, err := ioutil.TempDir("", "sbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	miner := abi.ActorID(123)
+
+	sp := &basicfs.Provider{
+		Root: dir,
+	}
+	sb, err := New(sp, &Config{
+		SealProofType: sealProofType,
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	cleanup := func() {
+		if t.Failed() {
+			fmt.Printf("not removing %s\n", dir)
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}
+	defer cleanup()
+
+	si := abi.SectorID{Miner: miner, Number: 1}
+
+	s := seal{id: si}
+	s.precommit(t, sb, si, func() {})
+
+	require.NoError(t, sb.FinalizeSectorTrim(context.TODO(), si, nil, storiface.CacheTrimFull))
+
+	paths, done, err := sp.AcquireSector(context.TODO(), si, stores.FTCache, 0, stores.PathStorage)
+	require.NoError(t, err)
+	done()
+
+	full, err := ioutil.ReadDir(paths.Cache)
+	require.NoError(t, err)
+
+	post(t, sb, nil, s)
+
+	// trimming a full cache later leaves only the PoSt files
+	require.NoError(t, sb.FinalizeSectorTrim(context.TODO(), si, nil, storiface.CacheTrimPoSt))
+
+	trimmed, err := ioutil.ReadDir(paths.Cache)
+	require.NoError(t, err)
+	require.Less(t, len(trimmed), len(full))
+	for _, f := range []string{"t_aux", "p_aux"} {
+		_, err = os.Stat(filepath.Join(paths.Cache, f))
+		require.NoError(t, err)
+	}
+
+	post(t, sb, nil, s)
+}
+
 func TestSealAndVerify3(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode")
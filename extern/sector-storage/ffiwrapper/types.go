@@ -26,9 +26,15 @@ type StorageSealer interface {
 	storage.Storage
 }
 
+// CacheTrimmer trims caches of sectors, see storiface.CacheTrimLevel
+type CacheTrimmer interface {
+	FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error
+}
+
 type Storage interface {
 	storage.Prover
 	StorageSealer
+	CacheTrimmer
 
 	UnsealPiece(ctx context.Context, sector abi.SectorID, offset storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize, randomness abi.SealRandomness, commd cid.Cid) error
 	ReadPiece(ctx context.Context, writer io.Writer, sector abi.SectorID, offset storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize) (bool, error)
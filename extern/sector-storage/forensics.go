@@ -0,0 +1,180 @@
+package sectorstorage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+const (
+	// maxForensics records are kept on the worker until the miner takes them
+	maxForensics = 16
+	dmesgLines   = 40
+
+	// forensicsTimeout bounds collecting the forensics of a task, the tools
+	// can hang, e.g. nvidia-smi on a failing GPU
+	forensicsTimeout = 10 * time.Second
+)
+
+// forensicsRecorder collects forensics for failed tasks on the worker, the
+// miner takes them with TaskForensics after the task returns
+type forensicsRecorder struct {
+	stderr func() string
+
+	lk      sync.Mutex
+	records []storiface.Forensics
+}
+
+// record collects forensics when err is an abnormal task failure, cancelled
+// tasks are skipped
+func (f *forensicsRecorder) record(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType, inputs map[string]string, err error) {
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	tctx, cancel := context.WithTimeout(context.Background(), forensicsTimeout)
+	defer cancel()
+
+	var dmesg, gpu string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		dmesg = dmesgTail(tctx)
+	}()
+	go func() {
+		defer wg.Done()
+		gpu = gpuState(tctx)
+	}()
+	wg.Wait()
+
+	hostname, _ := os.Hostname()
+	rec := storiface.Forensics{
+		Sector:   sector,
+		Task:     task,
+		Hostname: hostname,
+		Time:     time.Now(),
+		Error:    err.Error(),
+		Inputs:   inputs,
+		Dmesg:    dmesg,
+		GPU:      gpu,
+	}
+	if f.stderr != nil {
+		rec.Stderr = f.stderr()
+	}
+
+	log.Warnw("collected forensics for failed task", "sector", sector, "task", task)
+
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	f.records = append(f.records, rec)
+	if len(f.records) > maxForensics {
+		f.records = f.records[len(f.records)-maxForensics:]
+	}
+}
+
+// take removes and returns the latest record for the task, or nil
+func (f *forensicsRecorder) take(sector abi.SectorID, task sealtasks.TaskType) *storiface.Forensics {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	for i := len(f.records) - 1; i >= 0; i-- {
+		if f.records[i].Sector != sector || f.records[i].Task != task {
+			continue
+		}
+
+		rec := f.records[i]
+		f.records = append(f.records[:i], f.records[i+1:]...)
+		return &rec
+	}
+	return nil
+}
+
+func describePieces(pieces []abi.PieceInfo) string {
+	out := make([]string, len(pieces))
+	for i, p := range pieces {
+		out[i] = fmt.Sprintf("%s:%d", p.PieceCID, p.Size)
+	}
+	return strings.Join(out, ",")
+}
+
+// dmesgTail returns the last kernel messages, which show e.g. MCE, ECC and
+// NVIDIA Xid errors
+func dmesgTail(ctx context.Context) string {
+	out, err := runTool(ctx, "dmesg", "-T")
+	if err != nil {
+		return err.Error()
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	if len(lines) > dmesgLines {
+		lines = lines[len(lines)-dmesgLines:]
+	}
+	return string(bytes.Join(lines, []byte("\n")))
+}
+
+func gpuState(ctx context.Context) string {
+	out, err := runTool(ctx, "nvidia-smi", "--query-gpu=index,name,temperature.gpu,utilization.gpu,memory.used,memory.total,power.draw,clocks_throttle_reasons.active,ecc.errors.uncorrected.volatile.total", "--format=csv")
+	if err != nil {
+		return err.Error()
+	}
+	return string(bytes.TrimSpace(out))
+}
+
+// runTool returns the output of a diagnostic tool, or an error when it
+// doesn't exit before ctx is done. Processes stuck in the kernel can't be
+// killed, so they're left behind rather than waited for.
+func runTool(ctx context.Context, name string, args ...string) ([]byte, error) {
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := exec.CommandContext(ctx, p, args...).Output()
+		done <- result{out, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, xerrors.Errorf("running %s: %w", name, r.err)
+		}
+		return r.out, nil
+	case <-ctx.Done():
+		return nil, xerrors.Errorf("running %s: %w", name, ctx.Err())
+	}
+}
+
+// withForensics attaches the forensics the worker collected for a failed task
+// to err. Workers which don't collect forensics return err unchanged.
+func withForensics(ctx context.Context, w Worker, sector abi.SectorID, task sealtasks.TaskType, err error) error {
+	rec, ferr := w.TaskForensics(ctx, sector, task)
+	if ferr != nil {
+		log.Debugw("getting task forensics", "sector", sector, "task", task, "error", ferr)
+		return err
+	}
+	if rec == nil {
+		return err
+	}
+
+	return &storiface.ForensicError{Err: err, Forensics: *rec}
+}
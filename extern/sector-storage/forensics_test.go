@@ -0,0 +1,60 @@
+package sectorstorage
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+)
+
+func TestForensicsRecorder(t *testing.T) {
+	ctx := context.Background()
+	sector := abi.SectorID{Miner: 1000, Number: 1}
+
+	f := &forensicsRecorder{stderr: func() string { return "tail" }}
+
+	f.record(ctx, sector, sealtasks.TTPreCommit1, nil, nil)
+	require.Nil(t, f.take(sector, sealtasks.TTPreCommit1), "successful tasks aren't recorded")
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	f.record(cctx, sector, sealtasks.TTPreCommit1, nil, xerrors.New("cancelled"))
+	require.Nil(t, f.take(sector, sealtasks.TTPreCommit1), "cancelled tasks aren't recorded")
+
+	f.record(ctx, sector, sealtasks.TTPreCommit1, map[string]string{"ticket": "01"}, xerrors.New("boom"))
+	require.Nil(t, f.take(sector, sealtasks.TTPreCommit2))
+
+	rec := f.take(sector, sealtasks.TTPreCommit1)
+	require.NotNil(t, rec)
+	require.Equal(t, "boom", rec.Error)
+	require.Equal(t, "tail", rec.Stderr)
+	require.Equal(t, "01", rec.Inputs["ticket"])
+	require.Nil(t, f.take(sector, sealtasks.TTPreCommit1), "records are taken once")
+
+	for i := 0; i < maxForensics+4; i++ {
+		f.record(ctx, abi.SectorID{Miner: 1000, Number: abi.SectorNumber(i)}, sealtasks.TTCommit2, nil, xerrors.New("boom"))
+	}
+	require.Len(t, f.records, maxForensics)
+	require.Nil(t, f.take(abi.SectorID{Miner: 1000, Number: 0}, sealtasks.TTCommit2))
+}
+
+func TestRunToolTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := runTool(ctx, "sleep", "10")
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
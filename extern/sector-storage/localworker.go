@@ -2,6 +2,7 @@ package sectorstorage
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"runtime"
@@ -19,6 +20,7 @@ import (
 	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/ops"
 )
 
 var pathTypes = []stores.SectorFileType{stores.FTUnsealed, stores.FTSealed, stores.FTCache}
@@ -26,6 +28,14 @@ var pathTypes = []stores.SectorFileType{stores.FTUnsealed, stores.FTSealed, stor
 type WorkerConfig struct {
 	SealProof abi.RegisteredSealProof
 	TaskTypes []sealtasks.TaskType
+
+	// EnergyMetering records the energy used by sealing tasks with RAPL and
+	// NVML, where available
+	EnergyMetering bool
+
+	// Stderr returns the recent stderr output of the worker process, which is
+	// attached to the forensics of failed tasks; may be nil
+	Stderr func() string
 }
 
 type LocalWorker struct {
@@ -35,6 +45,11 @@ type LocalWorker struct {
 	sindex     stores.SectorIndex
 
 	acceptTasks map[sealtasks.TaskType]struct{}
+
+	heads     chainHeads
+	energy    *energyTracker
+	ops       *ops.Registry
+	forensics *forensicsRecorder
 }
 
 func NewLocalWorker(wcfg WorkerConfig, store stores.Store, local *stores.Local, sindex stores.SectorIndex) *LocalWorker {
@@ -43,7 +58,15 @@ func NewLocalWorker(wcfg WorkerConfig, store stores.Store, local *stores.Local,
 		acceptTasks[taskType] = struct{}{}
 	}
 
+	var energy *energyTracker
+	if wcfg.EnergyMetering {
+		energy = newEnergyTracker(detectEnergyMeters())
+	}
+
 	return &LocalWorker{
+		energy:    energy,
+		ops:       ops.NewRegistry(""),
+		forensics: &forensicsRecorder{stderr: wcfg.Stderr},
 		scfg: &ffiwrapper.Config{
 			SealProofType: wcfg.SealProof,
 		},
@@ -74,6 +97,13 @@ func (l *localWorkerPathProvider) AcquireSector(ctx context.Context, sector abi.
 
 	log.Debugf("acquired sector %d (e:%d; a:%d): %v", sector, existing, allocate, paths)
 
+	if allocate.Has(stores.FTCache) {
+		// only PC1 allocates the cache, track layers it writes there
+		if op := ops.FromContext(ctx); op != nil {
+			go watchPC1Layers(op, paths.Cache, l.w.scfg.SealProofType)
+		}
+	}
+
 	return paths, func() {
 		releaseStorage()
 
@@ -114,6 +144,9 @@ func (l *LocalWorker) AddPiece(ctx context.Context, sector abi.SectorID, epcs []
 }
 
 func (l *LocalWorker) Fetch(ctx context.Context, sector abi.SectorID, fileType stores.SectorFileType, ptype stores.PathType, am stores.AcquireMode) error {
+	// remote fetches register operations of their own
+	ctx = ops.WithRegistry(ctx, l.ops)
+
 	_, done, err := (&localWorkerPathProvider{w: l, op: am}).AcquireSector(ctx, sector, fileType, stores.FTNone, ptype)
 	if err != nil {
 		return err
@@ -123,6 +156,17 @@ func (l *LocalWorker) Fetch(ctx context.Context, sector abi.SectorID, fileType s
 }
 
 func (l *LocalWorker) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (out storage2.PreCommit1Out, err error) {
+	defer l.energy.track(sealtasks.TTPreCommit1)()
+
+	ctx, op := l.startOp(ctx, sealtasks.TTPreCommit1, stores.SectorName(sector))
+	defer func() { op.Finish(err) }()
+	defer func() {
+		l.forensics.record(ctx, sector, sealtasks.TTPreCommit1, map[string]string{
+			"ticket": fmt.Sprintf("%x", ticket),
+			"pieces": describePieces(pieces),
+		}, err)
+	}()
+
 	{
 		// cleanup previous failed attempts if they exist
 		if err := l.storage.Remove(ctx, sector, stores.FTSealed, true); err != nil {
@@ -143,6 +187,16 @@ func (l *LocalWorker) SealPreCommit1(ctx context.Context, sector abi.SectorID, t
 }
 
 func (l *LocalWorker) SealPreCommit2(ctx context.Context, sector abi.SectorID, phase1Out storage2.PreCommit1Out) (cids storage2.SectorCids, err error) {
+	defer l.energy.track(sealtasks.TTPreCommit2)()
+
+	ctx, op := l.startOp(ctx, sealtasks.TTPreCommit2, stores.SectorName(sector))
+	defer func() { op.Finish(err) }()
+	defer func() {
+		l.forensics.record(ctx, sector, sealtasks.TTPreCommit2, map[string]string{
+			"phase1OutBytes": fmt.Sprint(len(phase1Out)),
+		}, err)
+	}()
+
 	sb, err := l.sb()
 	if err != nil {
 		return storage2.SectorCids{}, err
@@ -152,6 +206,20 @@ func (l *LocalWorker) SealPreCommit2(ctx context.Context, sector abi.SectorID, p
 }
 
 func (l *LocalWorker) SealCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage2.SectorCids) (output storage2.Commit1Out, err error) {
+	defer l.energy.track(sealtasks.TTCommit1)()
+
+	ctx, op := l.startOp(ctx, sealtasks.TTCommit1, stores.SectorName(sector))
+	defer func() { op.Finish(err) }()
+	defer func() {
+		l.forensics.record(ctx, sector, sealtasks.TTCommit1, map[string]string{
+			"ticket": fmt.Sprintf("%x", ticket),
+			"seed":   fmt.Sprintf("%x", seed),
+			"commR":  cids.Sealed.String(),
+			"commD":  cids.Unsealed.String(),
+			"pieces": describePieces(pieces),
+		}, err)
+	}()
+
 	sb, err := l.sb()
 	if err != nil {
 		return nil, err
@@ -161,6 +229,16 @@ func (l *LocalWorker) SealCommit1(ctx context.Context, sector abi.SectorID, tick
 }
 
 func (l *LocalWorker) SealCommit2(ctx context.Context, sector abi.SectorID, phase1Out storage2.Commit1Out) (proof storage2.Proof, err error) {
+	defer l.energy.track(sealtasks.TTCommit2)()
+
+	ctx, op := l.startOp(ctx, sealtasks.TTCommit2, stores.SectorName(sector))
+	defer func() { op.Finish(err) }()
+	defer func() {
+		l.forensics.record(ctx, sector, sealtasks.TTCommit2, map[string]string{
+			"phase1OutBytes": fmt.Sprint(len(phase1Out)),
+		}, err)
+	}()
+
 	sb, err := l.sb()
 	if err != nil {
 		return nil, err
@@ -170,12 +248,16 @@ func (l *LocalWorker) SealCommit2(ctx context.Context, sector abi.SectorID, phas
 }
 
 func (l *LocalWorker) FinalizeSector(ctx context.Context, sector abi.SectorID, keepUnsealed []storage2.Range) error {
+	return l.FinalizeSectorTrim(ctx, sector, keepUnsealed, storiface.CacheTrimPoSt)
+}
+
+func (l *LocalWorker) FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage2.Range, level storiface.CacheTrimLevel) error {
 	sb, err := l.sb()
 	if err != nil {
 		return err
 	}
 
-	if err := sb.FinalizeSector(ctx, sector, keepUnsealed); err != nil {
+	if err := sb.FinalizeSectorTrim(ctx, sector, keepUnsealed, level); err != nil {
 		return xerrors.Errorf("finalizing sector: %w", err)
 	}
 
@@ -216,7 +298,17 @@ func (l *LocalWorker) MoveStorage(ctx context.Context, sector abi.SectorID, type
 	return nil
 }
 
-func (l *LocalWorker) UnsealPiece(ctx context.Context, sector abi.SectorID, index storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize, randomness abi.SealRandomness, cid cid.Cid) error {
+func (l *LocalWorker) UnsealPiece(ctx context.Context, sector abi.SectorID, index storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize, randomness abi.SealRandomness, cid cid.Cid) (err error) {
+	ctx, op := l.startOp(ctx, sealtasks.TTUnseal, stores.SectorName(sector))
+	defer func() { op.Finish(err) }()
+	defer func() {
+		l.forensics.record(ctx, sector, sealtasks.TTUnseal, map[string]string{
+			"offset":   fmt.Sprint(index),
+			"size":     fmt.Sprint(size),
+			"pieceCid": cid.String(),
+		}, err)
+	}()
+
 	sb, err := l.sb()
 	if err != nil {
 		return err
@@ -284,9 +376,48 @@ func (l *LocalWorker) Info(context.Context) (storiface.WorkerInfo, error) {
 			CPUs:        uint64(runtime.NumCPU()),
 			GPUs:        gpus,
 		},
+		Tuning: tuningEnv(),
 	}, nil
 }
 
+func tuningEnv() map[string]string {
+	out := map[string]string{}
+	for _, k := range storiface.TuningSettings {
+		if v, ok := os.LookupEnv(k); ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func (l *LocalWorker) TaskEnergy(context.Context) (storiface.WorkerEnergy, error) {
+	return l.energy.stats(), nil
+}
+
+func (l *LocalWorker) TaskForensics(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType) (*storiface.Forensics, error) {
+	return l.forensics.take(sector, task), nil
+}
+
+func (l *LocalWorker) Operations(context.Context) ([]ops.Status, error) {
+	return l.ops.List(), nil
+}
+
+func (l *LocalWorker) ChainHeadUpdate(ctx context.Context, head storiface.ChainHead) error {
+	l.heads.update(head)
+	return nil
+}
+
+// LatestChainHead returns the latest chain head relayed by the miner
+func (l *LocalWorker) LatestChainHead() (storiface.ChainHead, bool) {
+	return l.heads.latest()
+}
+
+// ChainHeadAt returns the relayed chain head at the given height, if it's
+// recent enough to still be kept
+func (l *LocalWorker) ChainHeadAt(h abi.ChainEpoch) (storiface.ChainHead, bool) {
+	return l.heads.at(h)
+}
+
 func (l *LocalWorker) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return make(chan struct{}), nil
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/ipfs/go-cid"
@@ -20,6 +22,7 @@ import (
 	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/ops"
 )
 
 var log = logging.Logger("advmgr")
@@ -30,6 +33,7 @@ type URLs []string
 
 type Worker interface {
 	ffiwrapper.StorageSealer
+	ffiwrapper.CacheTrimmer
 
 	MoveStorage(ctx context.Context, sector abi.SectorID, types stores.SectorFileType) error
 
@@ -44,6 +48,19 @@ type Worker interface {
 
 	Info(context.Context) (storiface.WorkerInfo, error)
 
+	// ChainHeadUpdate receives chain heads relayed by the miner
+	ChainHeadUpdate(context.Context, storiface.ChainHead) error
+
+	// TaskEnergy returns the energy used by finished sealing tasks
+	TaskEnergy(context.Context) (storiface.WorkerEnergy, error)
+
+	// Operations returns running and recently finished operations
+	Operations(context.Context) ([]ops.Status, error)
+
+	// TaskForensics takes the forensics collected for the last failure of a
+	// task on the sector, nil when there are none
+	TaskForensics(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType) (*storiface.Forensics, error)
+
 	// returns channel signalling worker shutdown
 	Closing(context.Context) (<-chan struct{}, error)
 
@@ -58,6 +75,7 @@ type SectorManager interface {
 	ffiwrapper.StorageSealer
 	storage.Prover
 	FaultTracker
+	CacheTrimmer
 }
 
 type WorkerID uint64
@@ -73,6 +91,19 @@ type Manager struct {
 
 	sched *scheduler
 
+	incompressible *stores.Incompressible
+	// compressing are the sectors compression passes hold the cache of
+	compressLk  sync.Mutex
+	compressing map[abi.SectorID]chan struct{}
+
+	archiveLk    sync.Mutex
+	archiver     Archiver
+	recallBudget time.Duration
+	recalls      map[abi.SectorID]*recall
+	// archiveCtx is cancelled on Close, ending the recalls in progress
+	archiveCtx    context.Context
+	archiveCancel context.CancelFunc
+
 	storage.Prover
 }
 
@@ -85,6 +116,17 @@ type SealerConfig struct {
 	AllowPreCommit2 bool
 	AllowCommit     bool
 	AllowUnseal     bool
+
+	// EnergyMetering enables energy metering of sealing tasks on the local worker
+	EnergyMetering bool
+
+	// TaskResources overrides the resources the scheduler assumes tasks
+	// need, by task type short name like PC1, e.g. to pack more PC1 tasks
+	// on machines with less memory than the defaults assume
+	TaskResources map[string]TaskResourceOverride
+	// WorkerResources overrides the resources workers report, by worker
+	// hostname, e.g. to reserve headroom for other processes
+	WorkerResources map[string]WorkerResourceOverride
 }
 
 type StorageAuth http.Header
@@ -113,9 +155,18 @@ func New(ctx context.Context, ls stores.LocalStorage, si stores.SectorIndex, cfg
 
 		sched: newScheduler(cfg.SealProofType),
 
+		incompressible: stores.NewIncompressible(),
+		compressing:    map[abi.SectorID]chan struct{}{},
+
+		recalls: map[abi.SectorID]*recall{},
+
 		Prover: prover,
 	}
 
+	if err := m.sched.setResourceOverrides(sc.TaskResources, sc.WorkerResources); err != nil {
+		return nil, err
+	}
+
 	go m.sched.runSched()
 
 	localTasks := []sealtasks.TaskType{
@@ -138,8 +189,9 @@ func New(ctx context.Context, ls stores.LocalStorage, si stores.SectorIndex, cfg
 	}
 
 	err = m.AddWorker(ctx, NewLocalWorker(WorkerConfig{
-		SealProof: cfg.SealProofType,
-		TaskTypes: localTasks,
+		SealProof:      cfg.SealProofType,
+		TaskTypes:      localTasks,
+		EnergyMetering: sc.EnergyMetering,
 	}, stor, lstor, si))
 	if err != nil {
 		return nil, xerrors.Errorf("adding local worker: %w", err)
@@ -171,6 +223,7 @@ func (m *Manager) AddWorker(ctx context.Context, w Worker) error {
 	if err != nil {
 		return xerrors.Errorf("getting worker info: %w", err)
 	}
+	info.Resources = m.sched.workerResources(info.Hostname, info.Resources)
 
 	m.sched.newWorkers <- &workerHandle{
 		w: w,
@@ -184,6 +237,16 @@ func (m *Manager) AddWorker(ctx context.Context, w Worker) error {
 	return nil
 }
 
+// OnTaskDone sets a callback called with each task finished on a worker,
+// except for cancelled ones. It's called from the scheduler, and must not
+// block.
+func (m *Manager) OnTaskDone(cb func(storiface.TaskRun)) {
+	m.sched.doneLk.Lock()
+	defer m.sched.doneLk.Unlock()
+
+	m.sched.onDone = cb
+}
+
 func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	m.remoteHnd.ServeHTTP(w, r)
 }
@@ -248,6 +311,11 @@ func (m *Manager) ReadPiece(ctx context.Context, sink io.Writer, sector abi.Sect
 	if readOk {
 		return nil
 	}
+
+	if err := m.awaitRecall(ctx, sector); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -438,7 +506,7 @@ func (m *Manager) FinalizeSector(ctx context.Context, sector abi.SectorID, keepU
 	err := m.sched.Schedule(ctx, sector, sealtasks.TTFinalize, selector,
 		schedFetch(sector, stores.FTCache|stores.FTSealed|unsealed, stores.PathSealing, stores.AcquireMove),
 		func(ctx context.Context, w Worker) error {
-			return w.FinalizeSector(ctx, sector, keepUnsealed)
+			return w.FinalizeSectorTrim(ctx, sector, keepUnsealed, cacheTrimLevel(ctx))
 		})
 	if err != nil {
 		return err
@@ -514,7 +582,17 @@ func (m *Manager) SchedDiag(ctx context.Context) (interface{}, error) {
 	return m.sched.Info(ctx)
 }
 
+func (m *Manager) SchedExplain(ctx context.Context, taskID uint64) (storiface.SchedExplanation, error) {
+	return m.sched.Explain(ctx, taskID)
+}
+
 func (m *Manager) Close(ctx context.Context) error {
+	m.archiveLk.Lock()
+	if m.archiveCancel != nil {
+		m.archiveCancel()
+	}
+	m.archiveLk.Unlock()
+
 	return m.sched.Close(ctx)
 }
 
@@ -376,6 +376,10 @@ func (mgr *SectorMgr) FinalizeSector(context.Context, abi.SectorID, []storage.Ra
 	return nil
 }
 
+func (mgr *SectorMgr) TrimCache(context.Context, abi.SectorID, storiface.CacheTrimLevel) error {
+	return nil
+}
+
 func (mgr *SectorMgr) ReleaseUnsealed(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error {
 	return nil
 }
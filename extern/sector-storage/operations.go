@@ -0,0 +1,122 @@
+package sectorstorage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/lib/ops"
+)
+
+var (
+	layerPollInterval = 10 * time.Second
+	opsQueryTimeout   = 10 * time.Second
+)
+
+// pc1Layers is the number of SDR layers PC1 computes for each sector size
+var pc1Layers = map[abi.SectorSize]uint64{
+	2 << 10:   2,
+	8 << 20:   2,
+	512 << 20: 2,
+	32 << 30:  11,
+	64 << 30:  11,
+}
+
+// startOp registers a task with the worker's operation registry. The returned
+// context carries the operation and the registry, so fetches done by the task
+// are reported as operations of their own.
+func (l *LocalWorker) startOp(ctx context.Context, tt sealtasks.TaskType, desc string) (context.Context, *ops.Operation) {
+	op := l.ops.Start(tt.Short(), desc)
+	return ops.WithOperation(ops.WithRegistry(ctx, l.ops), op), op
+}
+
+// watchPC1Layers reports PC1 progress from the layer files written to the
+// sector cache, the proofs library doesn't report progress itself
+func watchPC1Layers(op *ops.Operation, cache string, spt abi.RegisteredSealProof) {
+	ssize, err := spt.SectorSize()
+	if err != nil {
+		return
+	}
+	layers, ok := pc1Layers[ssize]
+	if !ok {
+		return
+	}
+	op.SetTotal(layers, "layers")
+
+	tick := time.NewTicker(layerPollInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-op.Finished():
+			return
+		}
+
+		ents, err := ioutil.ReadDir(cache)
+		if err != nil {
+			continue
+		}
+
+		var written uint64
+		for _, ent := range ents {
+			if strings.HasPrefix(ent.Name(), "sc-02-data-layer-") {
+				written++
+			}
+		}
+		// the last layer file is still being computed
+		if written > 0 {
+			op.SetDone(written - 1)
+		}
+	}
+}
+
+// Operations returns operations of all workers. IDs are prefixed with the
+// worker ID, and the source is the worker hostname. Workers which don't
+// respond in time are left out.
+func (m *Manager) Operations(ctx context.Context) []ops.Status {
+	m.sched.workersLk.RLock()
+	workers := make(map[WorkerID]*workerHandle, len(m.sched.workers))
+	for id, wh := range m.sched.workers {
+		workers[id] = wh
+	}
+	m.sched.workersLk.RUnlock()
+
+	var lk sync.Mutex
+	var out []ops.Status
+
+	var wg sync.WaitGroup
+	for id, wh := range workers {
+		wg.Add(1)
+		go func(id WorkerID, wh *workerHandle) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, opsQueryTimeout)
+			defer cancel()
+
+			sts, err := wh.w.Operations(ctx)
+			if err != nil {
+				log.Warnw("getting worker operations", "worker", id, "error", err)
+				return
+			}
+
+			for i := range sts {
+				sts[i].ID = fmt.Sprintf("%d/%s", id, sts[i].ID)
+				sts[i].Source = wh.info.Hostname
+			}
+
+			lk.Lock()
+			out = append(out, sts...)
+			lk.Unlock()
+		}(id, wh)
+	}
+	wg.Wait()
+
+	return out
+}
@@ -0,0 +1,45 @@
+package sectorstorage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/lib/ops"
+)
+
+func TestWatchPC1Layers(t *testing.T) {
+	old := layerPollInterval
+	layerPollInterval = time.Millisecond
+	defer func() {
+		layerPollInterval = old
+	}()
+
+	cache, err := ioutil.TempDir("", "pc1-layers")
+	require.NoError(t, err)
+	defer os.RemoveAll(cache) // nolint
+
+	r := ops.NewRegistry("")
+	op := r.Start("PC1", "")
+	go watchPC1Layers(op, cache, abi.RegisteredSealProof_StackedDrg32GiBV1)
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(cache, fmt.Sprintf("sc-02-data-layer-%d.dat", i)), nil, 0644))
+	}
+
+	// 3 layers done, the 4th is being computed
+	require.Eventually(t, func() bool {
+		st := op.Status()
+		return st.Total == 11 && st.Done == 3
+	}, time.Second, time.Millisecond)
+
+	op.Finish(nil)
+	require.Equal(t, 1.0, r.List()[0].Progress)
+}
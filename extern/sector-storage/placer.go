@@ -0,0 +1,258 @@
+package sectorstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// Placer decides where tasks run in place of the built-in worker preference
+// order, e.g. an orchestration service of the farm. It's only offered the
+// workers which meet the resource and selector requirements of the task.
+type Placer interface {
+	Place(ctx context.Context, req storiface.PlacementRequest) (storiface.Placement, error)
+}
+
+var (
+	// PlacementTTL is how long answers of the placer are reused for a task
+	// while its candidate workers stay the same
+	PlacementTTL = time.Minute
+	// PlacerFailures is how many placer calls in a row may fail before the
+	// placer is bypassed for PlacerCooldown
+	PlacerFailures = 3
+	PlacerCooldown = time.Minute
+)
+
+// SetPlacer sets a placer consulted for the tasks the scheduler found
+// workers for. It's asked in the background, once per task and set of
+// candidate workers, and tasks wait up to timeout for its answer. Tasks are
+// placed in the built-in order when it doesn't answer in time, or fails.
+func (m *Manager) SetPlacer(p Placer, timeout time.Duration) {
+	m.sched.placerLk.Lock()
+	defer m.sched.placerLk.Unlock()
+
+	m.sched.placer = p
+	m.sched.placerTimeout = timeout
+	m.sched.placements = map[uint64]*placement{}
+	m.sched.placerFailed = 0
+	m.sched.placerBypass = time.Time{}
+}
+
+// placement is an answer of the placer for a task, protected by
+// sched.placerLk
+type placement struct {
+	// candidates are the workers the placer was asked about
+	candidates string
+	asked      time.Time
+
+	done bool
+	pl   storiface.Placement
+	err  error
+}
+
+type httpPlacer struct {
+	url    string
+	header http.Header
+	client http.Client
+}
+
+// NewHTTPPlacer returns a placer which POSTs the placement request as JSON
+// to url, and expects a JSON storiface.Placement in response
+func NewHTTPPlacer(url string, header http.Header) Placer {
+	return &httpPlacer{url: url, header: header}
+}
+
+func (p *httpPlacer) Place(ctx context.Context, req storiface.PlacementRequest) (storiface.Placement, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return storiface.Placement{}, err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(b))
+	if err != nil {
+		return storiface.Placement{}, err
+	}
+	for k, v := range p.header {
+		hreq.Header[k] = v
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(hreq)
+	if err != nil {
+		return storiface.Placement{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return storiface.Placement{}, xerrors.Errorf("placer returned %s: %s", resp.Status, msg)
+	}
+
+	var out storiface.Placement
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return storiface.Placement{}, xerrors.Errorf("decoding placement: %w", err)
+	}
+	return out, nil
+}
+
+// ask gets the placement of a task from the placer, and runs a scheduling
+// pass with the answer
+func (sh *scheduler) ask(placer Placer, timeout time.Duration, task *workerRequest, req storiface.PlacementRequest, p *placement) {
+	ctx, cancel := context.WithTimeout(task.ctx, timeout)
+	pl, err := placer.Place(ctx, req)
+	cancel()
+
+	sh.placerLk.Lock()
+	p.done, p.pl, p.err = true, pl, err
+	switch {
+	case err == nil:
+		sh.placerFailed = 0
+	case task.ctx.Err() == nil:
+		log.Warnw("external placer failed, using the built-in placement", "task", task.taskType, "sector", task.sector, "error", err)
+
+		sh.placerFailed++
+		if sh.placerFailed >= PlacerFailures {
+			log.Errorw("external placer keeps failing, bypassing it", "failures", sh.placerFailed, "cooldown", PlacerCooldown)
+			sh.placerFailed = 0
+			sh.placerBypass = time.Now().Add(PlacerCooldown)
+		}
+	}
+	sh.placerLk.Unlock()
+
+	select {
+	case sh.resched <- struct{}{}:
+	default:
+	}
+}
+
+// forgetPlacement drops the answer of the placer for a task once the task
+// is assigned
+func (sh *scheduler) forgetPlacement(task *workerRequest) {
+	sh.placerLk.Lock()
+	defer sh.placerLk.Unlock()
+
+	delete(sh.placements, task.id)
+}
+
+// place reorders the acceptable windows of a task by the answer of the
+// placer, if one is set. Tasks the placer wasn't asked about yet, or which
+// it hasn't answered for, don't get any windows until it answers or times
+// out. Must be called with sh.workersLk held, before candidates are ranked.
+func (sh *scheduler) place(task *workerRequest, acceptable []int, candidates []storiface.SchedCandidate, candidateIdx map[WorkerID]int) []int {
+	if len(acceptable) == 0 {
+		return acceptable
+	}
+
+	sh.placerLk.Lock()
+	placer, timeout := sh.placer, sh.placerTimeout
+	bypassed := time.Now().Before(sh.placerBypass)
+	sh.placerLk.Unlock()
+
+	if placer == nil || bypassed {
+		return acceptable
+	}
+
+	req := storiface.PlacementRequest{
+		TaskID:   task.id,
+		Sector:   task.sector,
+		Task:     task.taskType,
+		Priority: task.priority,
+	}
+	seen := map[WorkerID]bool{}
+	for _, wnd := range acceptable {
+		wid := sh.openWindows[wnd].worker
+		if seen[wid] {
+			continue
+		}
+		seen[wid] = true
+
+		w := sh.workers[wid]
+		req.Candidates = append(req.Candidates, storiface.PlacementCandidate{
+			WorkerID:  uint64(wid),
+			Hostname:  w.info.Hostname,
+			Resources: w.info.Resources,
+			Running:   w.wt.Running(),
+		})
+	}
+
+	ids := make([]string, len(req.Candidates))
+	for i, c := range req.Candidates {
+		ids[i] = strconv.FormatUint(c.WorkerID, 10)
+	}
+	sort.Strings(ids) // the built-in order changes between passes
+	asking := strings.Join(ids, ",")
+
+	sh.placerLk.Lock()
+	p, ok := sh.placements[task.id]
+	if !ok || p.candidates != asking || (p.done && time.Since(p.asked) > PlacementTTL) {
+		for id, old := range sh.placements {
+			if old.done && time.Since(old.asked) > PlacementTTL {
+				delete(sh.placements, id)
+			}
+		}
+
+		p = &placement{candidates: asking, asked: time.Now()}
+		sh.placements[task.id] = p
+		go sh.ask(placer, timeout, task, req, p)
+	}
+	done, pl, err, waited := p.done, p.pl, p.err, time.Since(p.asked)
+	sh.placerLk.Unlock()
+
+	if !done {
+		if waited < timeout {
+			for _, wnd := range acceptable {
+				candidates[candidateIdx[sh.openWindows[wnd].worker]].Reason = "waiting for the external placer"
+			}
+			return nil
+		}
+		log.Warnw("external placer didn't answer in time, using the built-in placement", "task", task.taskType, "sector", task.sector, "timeout", timeout)
+		return acceptable
+	}
+	if err != nil {
+		return acceptable
+	}
+
+	order := map[WorkerID]int{}
+	for i, wid := range pl.Workers {
+		if _, ok := order[WorkerID(wid)]; !ok {
+			order[WorkerID(wid)] = i
+		}
+	}
+
+	var listed, rest []int
+	for _, wnd := range acceptable {
+		if _, ok := order[sh.openWindows[wnd].worker]; ok {
+			listed = append(listed, wnd)
+		} else {
+			rest = append(rest, wnd)
+		}
+	}
+	// stable, so windows of a worker stay in the built-in order
+	sort.SliceStable(listed, func(i, j int) bool {
+		return order[sh.openWindows[listed[i]].worker] < order[sh.openWindows[listed[j]].worker]
+	})
+
+	for _, wnd := range listed {
+		candidates[candidateIdx[sh.openWindows[wnd].worker]].Reason = "chosen by the external placer"
+	}
+	if !pl.Exclusive {
+		return append(listed, rest...)
+	}
+	for _, wnd := range rest {
+		c := &candidates[candidateIdx[sh.openWindows[wnd].worker]]
+		c.Accepted = false
+		c.Reason = "not chosen by the external placer"
+	}
+	return listed
+}
@@ -0,0 +1,200 @@
+package sectorstorage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+func placerTestSched(n int) *scheduler {
+	sched := newScheduler(abi.RegisteredSealProof_StackedDrg32GiBV1)
+	for i := 0; i < n; i++ {
+		wid := WorkerID(i)
+		sched.workers[wid] = &workerHandle{
+			info: storiface.WorkerInfo{
+				Hostname:  "w",
+				Resources: decentWorkerResources,
+			},
+			preparing: &activeResources{},
+			active:    &activeResources{},
+			wt:        &workTracker{running: map[uint64]storiface.WorkerJob{}},
+		}
+		sched.openWindows = append(sched.openWindows, &schedWindowRequest{
+			worker: wid,
+			done:   make(chan *schedWindow, 1),
+		})
+	}
+
+	placerTestTask(sched, 1)
+	return sched
+}
+
+func placerTestTask(sched *scheduler, id uint64) {
+	req := &workerRequest{
+		id:       id,
+		sector:   abi.SectorID{Miner: 1000, Number: abi.SectorNumber(id)},
+		taskType: sealtasks.TTPreCommit1,
+		sel:      slowishSelector(true),
+		start:    time.Now(),
+		ctx:      context.Background(),
+	}
+	sched.trace.queued(req)
+	sched.schedQueue.Push(req)
+}
+
+// placed waits for the placer to answer and runs the scheduling pass it
+// asks for
+func placed(t *testing.T, sched *scheduler) {
+	select {
+	case <-sched.resched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("placer didn't answer")
+	}
+	sched.trySched()
+}
+
+// assignedTo returns the workers whose windows tasks were assigned to
+func assignedTo(sched *scheduler) []WorkerID {
+	open := map[WorkerID]bool{}
+	for _, wr := range sched.openWindows {
+		open[wr.worker] = true
+	}
+
+	var out []WorkerID
+	for wid := range sched.workers {
+		if !open[wid] {
+			out = append(out, wid)
+		}
+	}
+	return out
+}
+
+func TestHTTPPlacer(t *testing.T) {
+	var got storiface.PlacementRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(storiface.Placement{Workers: []uint64{2}})
+	}))
+	defer srv.Close()
+
+	sched := placerTestSched(3)
+	m := &Manager{sched: sched}
+	m.SetPlacer(NewHTTPPlacer(srv.URL, http.Header{"Authorization": []string{"Bearer tok"}}), 5*time.Second)
+
+	// the task waits for the placer, without blocking the pass
+	sched.trySched()
+	require.Equal(t, 1, sched.schedQueue.Len())
+
+	placed(t, sched)
+
+	require.Equal(t, "Bearer tok", auth)
+	require.Equal(t, sealtasks.TTPreCommit1, got.Task)
+	require.Len(t, got.Candidates, 3)
+	require.Equal(t, []WorkerID{2}, assignedTo(sched))
+
+	ex, err := sched.Explain(context.Background(), 1)
+	require.NoError(t, err)
+	for _, c := range ex.Candidates {
+		if c.WorkerID == 2 {
+			require.Equal(t, 0, c.Rank)
+			require.Equal(t, "chosen by the external placer", c.Reason)
+		}
+	}
+}
+
+type fixedPlacer struct {
+	pl    storiface.Placement
+	err   error
+	delay time.Duration
+}
+
+func (p fixedPlacer) Place(ctx context.Context, req storiface.PlacementRequest) (storiface.Placement, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return storiface.Placement{}, ctx.Err()
+	}
+	return p.pl, p.err
+}
+
+func TestPlacerExclusive(t *testing.T) {
+	sched := placerTestSched(2)
+	m := &Manager{sched: sched}
+	m.SetPlacer(fixedPlacer{pl: storiface.Placement{Exclusive: true}}, time.Second)
+
+	sched.trySched()
+	placed(t, sched)
+	require.Equal(t, 1, sched.schedQueue.Len())
+	require.Len(t, sched.openWindows, 2)
+
+	ex, err := sched.Explain(context.Background(), 1)
+	require.NoError(t, err)
+	for _, c := range ex.Candidates {
+		require.False(t, c.Accepted)
+		require.Equal(t, -1, c.Rank)
+		require.Equal(t, "not chosen by the external placer", c.Reason)
+	}
+}
+
+func TestPlacerFallback(t *testing.T) {
+	sched := placerTestSched(2)
+	m := &Manager{sched: sched}
+	m.SetPlacer(fixedPlacer{pl: storiface.Placement{Exclusive: true}, delay: time.Minute}, 10*time.Millisecond)
+
+	sched.trySched()
+	require.Equal(t, 1, sched.schedQueue.Len())
+
+	placed(t, sched)
+	require.Equal(t, 0, sched.schedQueue.Len())
+	require.Len(t, sched.openWindows, 1)
+}
+
+type countingPlacer struct {
+	calls int64
+}
+
+func (p *countingPlacer) Place(ctx context.Context, req storiface.PlacementRequest) (storiface.Placement, error) {
+	atomic.AddInt64(&p.calls, 1)
+	return storiface.Placement{}, xerrors.New("placer down")
+}
+
+func TestPlacerBypass(t *testing.T) {
+	sched := placerTestSched(PlacerFailures + 1)
+	for id := uint64(2); id <= uint64(PlacerFailures); id++ {
+		placerTestTask(sched, id)
+	}
+
+	p := &countingPlacer{}
+	m := &Manager{sched: sched}
+	m.SetPlacer(p, time.Second)
+
+	sched.trySched()
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&p.calls) == int64(PlacerFailures)
+	}, 5*time.Second, 10*time.Millisecond)
+	placed(t, sched)
+	require.Equal(t, 0, sched.schedQueue.Len())
+
+	// the placer failed for every task, it isn't asked for the next one
+	placerTestTask(sched, uint64(PlacerFailures)+1)
+	sched.trySched()
+	require.Equal(t, 0, sched.schedQueue.Len())
+	require.Equal(t, int64(PlacerFailures), atomic.LoadInt64(&p.calls))
+}
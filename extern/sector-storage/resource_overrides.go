@@ -0,0 +1,173 @@
+package sectorstorage
+
+import (
+	"github.com/docker/go-units"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// TaskResourceOverride changes the resources the scheduler assumes a task
+// type needs, for all sector sizes. Empty fields keep the values of the
+// ResourceTable.
+type TaskResourceOverride struct {
+	// MinMemory, MaxMemory and BaseMinMemory are sizes like "56GiB"
+	MinMemory     string
+	MaxMemory     string
+	BaseMinMemory string
+
+	// Threads is the number of threads a task uses, -1 is all threads of
+	// the worker
+	Threads int
+	// CanGPU sets whether tasks use the GPU of the worker
+	CanGPU *bool
+}
+
+// WorkerResourceOverride declares the resources of a worker in place of the
+// ones it detects. Empty fields keep the detected values.
+type WorkerResourceOverride struct {
+	// MemPhysical and MemSwap are sizes like "512GiB"
+	MemPhysical string
+	MemSwap     string
+	CPUs        uint64
+	// DisableGPUs schedules tasks as if the worker had no GPU
+	DisableGPUs bool
+
+	// ReserveMemory and ReserveCPUs are kept free of tasks as headroom for
+	// other processes on the worker
+	ReserveMemory string
+	ReserveCPUs   uint64
+}
+
+type taskResources struct {
+	minMemory, maxMemory, baseMinMemory uint64
+
+	threads int
+	canGPU  *bool
+}
+
+type workerResources struct {
+	memPhysical, memSwap uint64
+	cpus                 uint64
+	disableGPUs          bool
+
+	reserveMemory uint64
+	reserveCPUs   uint64
+}
+
+// setResourceOverrides must be called before the scheduler runs, the
+// resources of running tasks are freed with the values they were added with
+func (sh *scheduler) setResourceOverrides(tasks map[string]TaskResourceOverride, workers map[string]WorkerResourceOverride) error {
+	sh.taskRes = map[sealtasks.TaskType]taskResources{}
+	for name, o := range tasks {
+		tt, err := sealtasks.ParseTask(name)
+		if err != nil {
+			return xerrors.Errorf("TaskResources: %w", err)
+		}
+
+		tr := taskResources{threads: o.Threads, canGPU: o.CanGPU}
+		for _, s := range []struct {
+			v   string
+			dst *uint64
+		}{{o.MinMemory, &tr.minMemory}, {o.MaxMemory, &tr.maxMemory}, {o.BaseMinMemory, &tr.baseMinMemory}} {
+			if *s.dst, err = parseSize(s.v); err != nil {
+				return xerrors.Errorf("TaskResources.%s: %w", name, err)
+			}
+		}
+		if tr.threads < -1 {
+			return xerrors.Errorf("TaskResources.%s: threads must be -1 or more, got %d", name, tr.threads)
+		}
+		sh.taskRes[tt] = tr
+	}
+
+	sh.workerRes = map[string]workerResources{}
+	for host, o := range workers {
+		wr := workerResources{cpus: o.CPUs, disableGPUs: o.DisableGPUs, reserveCPUs: o.ReserveCPUs}
+		var err error
+		for _, s := range []struct {
+			v   string
+			dst *uint64
+		}{{o.MemPhysical, &wr.memPhysical}, {o.MemSwap, &wr.memSwap}, {o.ReserveMemory, &wr.reserveMemory}} {
+			if *s.dst, err = parseSize(s.v); err != nil {
+				return xerrors.Errorf("WorkerResources.%s: %w", host, err)
+			}
+		}
+		sh.workerRes[host] = wr
+	}
+
+	return nil
+}
+
+func parseSize(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := units.RAMInBytes(s)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, xerrors.Errorf("negative size %q", s)
+	}
+	return uint64(v), nil
+}
+
+// needResources returns the resources a task of the type needs, with the
+// overrides applied
+func (sh *scheduler) needResources(tt sealtasks.TaskType) Resources {
+	r := ResourceTable[tt][sh.spt]
+
+	o, ok := sh.taskRes[tt]
+	if !ok {
+		return r
+	}
+	if o.minMemory > 0 {
+		r.MinMemory = o.minMemory
+	}
+	if o.maxMemory > 0 {
+		r.MaxMemory = o.maxMemory
+	}
+	if r.MaxMemory < r.MinMemory {
+		r.MaxMemory = r.MinMemory
+	}
+	if o.baseMinMemory > 0 {
+		r.BaseMinMemory = o.baseMinMemory
+	}
+	if o.threads != 0 {
+		r.Threads = o.threads
+	}
+	if o.canGPU != nil {
+		r.CanGPU = *o.canGPU
+	}
+	return r
+}
+
+// workerResources returns the resources of a worker, with the declared
+// resources of its hostname applied
+func (sh *scheduler) workerResources(hostname string, r storiface.WorkerResources) storiface.WorkerResources {
+	o, ok := sh.workerRes[hostname]
+	if !ok {
+		return r
+	}
+	if o.memPhysical > 0 {
+		r.MemPhysical = o.memPhysical
+	}
+	if o.memSwap > 0 {
+		r.MemSwap = o.memSwap
+	}
+	if o.cpus > 0 {
+		r.CPUs = o.cpus
+	}
+	if o.disableGPUs {
+		r.GPUs = nil
+	}
+
+	r.MemReserved += o.reserveMemory
+	if o.reserveCPUs < r.CPUs {
+		r.CPUs -= o.reserveCPUs
+	} else if o.reserveCPUs > 0 {
+		r.CPUs = 0
+	}
+	return r
+}
@@ -34,7 +34,23 @@ func (l *readonlyProvider) AcquireSector(ctx context.Context, id abi.SectorID, e
 		return stores.SectorPaths{}, nil, xerrors.Errorf("failed to acquire sector lock")
 	}
 
-	p, _, err := l.stor.AcquireSector(ctx, id, l.spt, existing, allocate, sealing, stores.AcquireMove)
+	p, done, err := l.stor.AcquireReplica(ctx, id, l.spt, existing)
+	if err != nil {
+		return p, cancel, err
+	}
+
+	release := func() {
+		done()
+		cancel()
+	}
+
+	if existing&stores.FTCache != 0 && p.Cache != "" {
+		// cache files may be compressed at rest
+		if _, err := stores.DecompressCache(p.Cache); err != nil {
+			release()
+			return stores.SectorPaths{}, nil, xerrors.Errorf("decompressing sector cache: %w", err)
+		}
+	}
 
-	return p, cancel, err
+	return p, release, nil
 }
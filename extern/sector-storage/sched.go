@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/xerrors"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/watchdog"
 )
 
 type schedPrioCtxKey int
@@ -23,6 +25,8 @@ var DefaultSchedPriority = 0
 var SelectorTimeout = 5 * time.Second
 var InitWait = 3 * time.Second
 
+var schedWatchdog = watchdog.Register("sector-scheduler", 5*time.Minute)
+
 var (
 	SchedWindows = 2
 )
@@ -53,6 +57,19 @@ type WorkerSelector interface {
 type scheduler struct {
 	spt abi.RegisteredSealProof
 
+	nextTaskID uint64 // atomic
+	trace      *schedTrace
+
+	// queue times of tasks checkpointed before a restart, see
+	// RestoreSchedQueue
+	requeueLk    sync.Mutex
+	requeued     map[queuedTaskKey]time.Time
+	requeueUntil time.Time
+
+	// draining is set once no tasks should be assigned to workers anymore,
+	// see Manager.Drain
+	draining int32 // atomic
+
 	workersLk  sync.RWMutex
 	nextWorker WorkerID
 	workers    map[WorkerID]*workerHandle
@@ -64,6 +81,8 @@ type scheduler struct {
 
 	schedule       chan *workerRequest
 	windowRequests chan *schedWindowRequest
+	// resched runs a scheduling pass, e.g. after a task affinity change
+	resched chan struct{}
 
 	// owned by the sh.runSched goroutine
 	schedQueue  *requestQueue
@@ -71,6 +90,25 @@ type scheduler struct {
 
 	info chan func(interface{})
 
+	doneLk sync.Mutex
+	onDone func(storiface.TaskRun)
+
+	placerLk      sync.Mutex
+	placer        Placer
+	placerTimeout time.Duration
+	placements    map[uint64]*placement
+	// placerFailed counts failed placer calls in a row, the placer is
+	// bypassed until placerBypass once there are PlacerFailures of them
+	placerFailed int
+	placerBypass time.Time
+
+	affinityLk sync.Mutex
+	affinity   storiface.TaskAffinity
+
+	// set before the scheduler runs, see setResourceOverrides
+	taskRes   map[sealtasks.TaskType]taskResources
+	workerRes map[string]workerResources
+
 	closing  chan struct{}
 	closed   chan struct{}
 	testSync chan struct{} // used for testing
@@ -89,6 +127,10 @@ type workerHandle struct {
 	wndLk         sync.Mutex
 	activeWindows []*schedWindow
 
+	// tasks which preemptible tasks wait for, protected by
+	// sched.workersLk
+	preempting []*workerRequest
+
 	// stats / tracking
 	wt *workTracker
 
@@ -119,11 +161,15 @@ type activeResources struct {
 }
 
 type workerRequest struct {
+	id       uint64
 	sector   abi.SectorID
 	taskType sealtasks.TaskType
 	priority int // larger values more important
 	sel      WorkerSelector
 
+	preemptible bool
+	preempting  bool // preemptible tasks wait for this one
+
 	prepare WorkerAction
 	work    WorkerAction
 
@@ -144,6 +190,8 @@ func newScheduler(spt abi.RegisteredSealProof) *scheduler {
 	return &scheduler{
 		spt: spt,
 
+		trace: newSchedTrace(),
+
 		nextWorker: 0,
 		workers:    map[WorkerID]*workerHandle{},
 
@@ -154,6 +202,7 @@ func newScheduler(spt abi.RegisteredSealProof) *scheduler {
 
 		schedule:       make(chan *workerRequest),
 		windowRequests: make(chan *schedWindowRequest, 20),
+		resched:        make(chan struct{}, 1),
 
 		schedQueue: &requestQueue{},
 
@@ -167,24 +216,31 @@ func newScheduler(spt abi.RegisteredSealProof) *scheduler {
 func (sh *scheduler) Schedule(ctx context.Context, sector abi.SectorID, taskType sealtasks.TaskType, sel WorkerSelector, prepare WorkerAction, work WorkerAction) error {
 	ret := make(chan workerResponse)
 
-	select {
-	case sh.schedule <- &workerRequest{
+	req := &workerRequest{
+		id:       atomic.AddUint64(&sh.nextTaskID, 1),
 		sector:   sector,
 		taskType: taskType,
 		priority: getPriority(ctx),
 		sel:      sel,
 
+		preemptible: isPreemptible(ctx),
+
 		prepare: prepare,
 		work:    work,
 
-		start: time.Now(),
+		start: sh.queuedSince(sector, taskType),
 
 		ret: ret,
 		ctx: ctx,
-	}:
+	}
+	sh.trace.queued(req)
+
+	select {
+	case sh.schedule <- req:
 	case <-sh.closing:
 		return xerrors.New("closing")
 	case <-ctx.Done():
+		sh.trace.cancelled(req)
 		return ctx.Err()
 	}
 
@@ -194,6 +250,7 @@ func (sh *scheduler) Schedule(ctx context.Context, sector abi.SectorID, taskType
 	case <-sh.closing:
 		return xerrors.New("closing")
 	case <-ctx.Done():
+		sh.trace.cancelled(req)
 		return ctx.Err()
 	}
 }
@@ -207,6 +264,7 @@ func (r *workerRequest) respond(err error) {
 }
 
 type SchedDiagRequestInfo struct {
+	TaskID   uint64
 	Sector   abi.SectorID
 	TaskType sealtasks.TaskType
 	Priority int
@@ -245,8 +303,12 @@ func (sh *scheduler) runSched() {
 		case req := <-sh.windowRequests:
 			sh.openWindows = append(sh.openWindows, req)
 			doSched = true
+		case <-sh.resched:
+			doSched = true
 		case ireq := <-sh.info:
+			done := schedWatchdog.Busy()
 			ireq(sh.diag())
+			done()
 
 		case <-iw:
 			initialised = true
@@ -275,7 +337,9 @@ func (sh *scheduler) runSched() {
 				}
 			}
 
+			done := schedWatchdog.Busy()
 			sh.trySched()
+			done()
 		}
 
 	}
@@ -288,6 +352,7 @@ func (sh *scheduler) diag() SchedDiagInfo {
 		task := (*sh.schedQueue)[sqi]
 
 		out.Requests = append(out.Requests, SchedDiagRequestInfo{
+			TaskID:   task.id,
 			Sector:   task.sector,
 			TaskType: task.taskType,
 			Priority: task.priority,
@@ -310,14 +375,21 @@ func (sh *scheduler) trySched() {
 		- Window request age
 
 		1. For each task in the schedQueue find windows which can handle them
-		1.1. Create list of windows capable of handling a task
+		1.1. Create list of windows capable of handling a task, on workers the
+		     task type isn't kept from (see Manager.SetTaskAffinity)
 		1.2. Sort windows according to task selector preferences
+		1.3. Reorder them by the external placer, if one is set (see Manager.SetPlacer)
 		2. Going through schedQueue again, assign task to first acceptable window
 		   with resources available
 		3. Submit windows with scheduled tasks to workers
 
 	*/
 
+	if atomic.LoadInt32(&sh.draining) == 1 {
+		log.Debugf("SCHED draining, %d tasks stay queued", sh.schedQueue.Len())
+		return
+	}
+
 	windows := make([]schedWindow, len(sh.openWindows))
 	acceptableWindows := make([][]int, sh.schedQueue.Len())
 
@@ -330,6 +402,10 @@ func (sh *scheduler) trySched() {
 		return
 	}
 
+	sh.affinityLk.Lock()
+	affinity := sh.affinity
+	sh.affinityLk.Unlock()
+
 	// Step 1
 	concurrency := len(sh.openWindows)
 	throttle := make(chan struct{}, concurrency)
@@ -347,9 +423,30 @@ func (sh *scheduler) trySched() {
 			}()
 
 			task := (*sh.schedQueue)[sqi]
-			needRes := ResourceTable[task.taskType][sh.spt]
+			needRes := sh.needResources(task.taskType)
 
 			task.indexHeap = sqi
+
+			// scheduling decisions for this task, one entry per worker
+			var candidates []storiface.SchedCandidate
+			candidateIdx := map[WorkerID]int{}
+			candidate := func(wid WorkerID, hostname string) *storiface.SchedCandidate {
+				ci, ok := candidateIdx[wid]
+				if !ok {
+					ci = len(candidates)
+					candidateIdx[wid] = ci
+					candidates = append(candidates, storiface.SchedCandidate{
+						WorkerID: uint64(wid),
+						Hostname: hostname,
+						Rank:     -1,
+					})
+				}
+				return &candidates[ci]
+			}
+			defer func() {
+				sh.trace.considered(task, candidates)
+			}()
+
 			for wnd, windowRequest := range sh.openWindows {
 				worker, ok := sh.workers[windowRequest.worker]
 				if !ok {
@@ -358,8 +455,22 @@ func (sh *scheduler) trySched() {
 					continue
 				}
 
+				c := candidate(windowRequest.worker, worker.info.Hostname)
+				if c.Accepted {
+					// another window of this worker was accepted already
+					acceptableWindows[sqi] = append(acceptableWindows[sqi], wnd)
+					continue
+				}
+
+				if ok, reason := affinity.Allowed(worker.info.Hostname, task.taskType); !ok {
+					c.Reason = reason
+					continue
+				}
+
 				// TODO: allow bigger windows
-				if !windows[wnd].allocated.canHandleRequest(needRes, windowRequest.worker, "schedAcceptable", worker.info.Resources) {
+				if err := windows[wnd].allocated.requestFit(needRes, worker.info.Resources); err != nil {
+					log.Debugf("sched: not scheduling on worker %d for schedAcceptable; %s", windowRequest.worker, err)
+					c.Reason = err.Error()
 					continue
 				}
 
@@ -368,13 +479,17 @@ func (sh *scheduler) trySched() {
 				cancel()
 				if err != nil {
 					log.Errorf("trySched(1) req.sel.Ok error: %+v", err)
+					c.Reason = fmt.Sprintf("selector error: %s", err)
 					continue
 				}
 
 				if !ok {
+					c.Reason = "rejected by task selector (task type or storage locality)"
 					continue
 				}
 
+				c.Accepted = true
+				c.Reason = "resources and selector requirements met"
 				acceptableWindows[sqi] = append(acceptableWindows[sqi], wnd)
 			}
 
@@ -407,6 +522,17 @@ func (sh *scheduler) trySched() {
 				}
 				return r
 			})
+
+			acceptableWindows[sqi] = sh.place(task, acceptableWindows[sqi], candidates, candidateIdx)
+
+			rank := 0
+			for _, wnd := range acceptableWindows[sqi] {
+				c := &candidates[candidateIdx[sh.openWindows[wnd].worker]]
+				if c.Rank < 0 {
+					c.Rank = rank
+					rank++
+				}
+			}
 		}(i)
 	}
 
@@ -420,7 +546,7 @@ func (sh *scheduler) trySched() {
 
 	for sqi := 0; sqi < sh.schedQueue.Len(); sqi++ {
 		task := (*sh.schedQueue)[sqi]
-		needRes := ResourceTable[task.taskType][sh.spt]
+		needRes := sh.needResources(task.taskType)
 
 		selectedWindow := -1
 		for _, wnd := range acceptableWindows[task.indexHeap] {
@@ -434,7 +560,7 @@ func (sh *scheduler) trySched() {
 				continue
 			}
 
-			log.Debugf("SCHED ASSIGNED sqi:%d sector %d task %s to window %d", sqi, task.sector.Number, task.taskType, wnd)
+			log.Debugf("SCHED ASSIGNED sqi:%d task %d sector %d task %s to window %d", sqi, task.id, task.sector.Number, task.taskType, wnd)
 
 			windows[wnd].allocated.add(wr, needRes)
 			// TODO: We probably want to re-sort acceptableWindows here based on new
@@ -452,6 +578,8 @@ func (sh *scheduler) trySched() {
 		}
 
 		windows[selectedWindow].todo = append(windows[selectedWindow].todo, task)
+		sh.trace.assigned(task, sh.openWindows[selectedWindow].worker)
+		sh.forgetPlacement(task)
 
 		sh.schedQueue.Remove(sqi)
 		sqi--
@@ -579,7 +707,7 @@ func (sh *scheduler) runWorker(wid WorkerID) {
 
 					worker.lk.Lock()
 					for t, todo := range firstWindow.todo {
-						needRes := ResourceTable[todo.taskType][sh.spt]
+						needRes := sh.needResources(todo.taskType)
 						if worker.preparing.canHandleRequest(needRes, wid, "startPreparing", worker.info.Resources) {
 							tidx = t
 							break
@@ -629,7 +757,7 @@ func (sh *scheduler) workerCompactWindows(worker *workerHandle, wid WorkerID) in
 			var moved []int
 
 			for ti, todo := range window.todo {
-				needRes := ResourceTable[todo.taskType][sh.spt]
+				needRes := sh.needResources(todo.taskType)
 				if !lower.allocated.canHandleRequest(needRes, wid, "compactWindows", worker.info.Resources) {
 					continue
 				}
@@ -673,7 +801,7 @@ func (sh *scheduler) workerCompactWindows(worker *workerHandle, wid WorkerID) in
 }
 
 func (sh *scheduler) assignWorker(taskDone chan struct{}, wid WorkerID, w *workerHandle, req *workerRequest) error {
-	needRes := ResourceTable[req.taskType][sh.spt]
+	needRes := sh.needResources(req.taskType)
 
 	w.lk.Lock()
 	w.preparing.add(w.info.Resources, needRes)
@@ -705,7 +833,17 @@ func (sh *scheduler) assignWorker(taskDone chan struct{}, wid WorkerID, w *worke
 			return
 		}
 
+		if req.preemptible {
+			sh.waitPreempting(wid, w, req)
+		} else if !w.active.canHandleRequest(needRes, wid, "preemptCheck", w.info.Resources) {
+			sh.preemptFor(w, req)
+		}
+
 		err = w.active.withResources(wid, w.info.Resources, needRes, &sh.workersLk, func() error {
+			if req.preempting {
+				sh.preemptDone(w, req)
+			}
+
 			w.lk.Lock()
 			w.preparing.free(w.info.Resources, needRes)
 			w.lk.Unlock()
@@ -717,8 +855,29 @@ func (sh *scheduler) assignWorker(taskDone chan struct{}, wid WorkerID, w *worke
 			case <-sh.closing:
 			}
 
+			parallel := w.wt.count(req.taskType) + 1
+			start := time.Now()
 			err = req.work(req.ctx, w.wt.worker(w.w))
 
+			if req.ctx.Err() == nil {
+				sh.taskDone(storiface.TaskRun{
+					Task:     req.taskType,
+					Sector:   req.sector,
+					Worker:   w.info.Hostname,
+					CPUs:     w.info.Resources.CPUs,
+					GPUs:     len(w.info.Resources.GPUs),
+					Tuning:   w.info.Tuning,
+					Parallel: parallel,
+					Start:    start,
+					Duration: time.Since(start),
+					Failed:   err != nil,
+				})
+			}
+
+			if err != nil && req.ctx.Err() == nil {
+				err = withForensics(req.ctx, w.w, req.sector, req.taskType, err)
+			}
+
 			select {
 			case req.ret <- workerResponse{err: err}:
 			case <-req.ctx.Done():
@@ -819,6 +978,17 @@ func (sh *scheduler) schedClose() {
 	}
 }
 
+// taskDone passes a finished task to the onDone callback
+func (sh *scheduler) taskDone(run storiface.TaskRun) {
+	sh.doneLk.Lock()
+	cb := sh.onDone
+	sh.doneLk.Unlock()
+
+	if cb != nil {
+		cb(run)
+	}
+}
+
 func (sh *scheduler) Info(ctx context.Context) (interface{}, error) {
 	ch := make(chan interface{}, 1)
 
@@ -0,0 +1,319 @@
+package sectorstorage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// SchedExplainHistory is the number of most recent tasks for which scheduling
+// decisions are kept
+var SchedExplainHistory = 1000
+
+type schedTrace struct {
+	lk sync.Mutex
+
+	order    []uint64
+	entries  map[uint64]*storiface.SchedExplanation
+	restored map[uint64]struct{}
+	dropped  map[uint64]struct{}
+}
+
+func newSchedTrace() *schedTrace {
+	return &schedTrace{
+		entries:  map[uint64]*storiface.SchedExplanation{},
+		restored: map[uint64]struct{}{},
+		dropped:  map[uint64]struct{}{},
+	}
+}
+
+// entry must be called with st.lk held
+func (st *schedTrace) entry(req *workerRequest) *storiface.SchedExplanation {
+	e, ok := st.entries[req.id]
+	if ok {
+		return e
+	}
+
+	e = &storiface.SchedExplanation{
+		TaskID:   req.id,
+		Sector:   req.sector,
+		Task:     req.taskType,
+		Priority: req.priority,
+		Queued:   req.start,
+		Reason:   "waiting for open scheduling windows",
+	}
+	st.entries[req.id] = e
+	st.order = append(st.order, req.id)
+
+	for len(st.order) > SchedExplainHistory {
+		delete(st.entries, st.order[0])
+		delete(st.restored, st.order[0])
+		delete(st.dropped, st.order[0])
+		st.order = st.order[1:]
+	}
+
+	return e
+}
+
+func (st *schedTrace) queued(req *workerRequest) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	st.entry(req)
+}
+
+func (st *schedTrace) considered(req *workerRequest, candidates []storiface.SchedCandidate) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	e := st.entry(req)
+	e.Attempts++
+	e.LastAttempt = time.Now()
+	e.Candidates = candidates
+
+	e.Reason = "no worker accepted the task"
+	for _, c := range candidates {
+		if c.Accepted {
+			e.Reason = "waiting for resources in an acceptable worker window"
+			break
+		}
+	}
+}
+
+func (st *schedTrace) assigned(req *workerRequest, wid WorkerID) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	e := st.entry(req)
+	e.Assigned = true
+	e.AssignedWorker = uint64(wid)
+	e.AssignedAt = time.Now()
+
+	e.Reason = "assigned to the most preferred worker with free window resources"
+	for _, c := range e.Candidates {
+		if c.WorkerID != uint64(wid) {
+			continue
+		}
+		if c.Rank == 0 {
+			e.Reason = "assigned to the most preferred worker"
+		}
+		break
+	}
+}
+
+func (st *schedTrace) preempted(req *workerRequest) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	e := st.entry(req)
+	e.Preempted++
+
+	e.Reason = "preempted by a more important task, waiting for it to get its resources"
+}
+
+// cancelled records that the caller of a task gave up on it. Tasks which
+// were assigned already keep their entry as is.
+func (st *schedTrace) cancelled(req *workerRequest) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	e := st.entry(req)
+	if e.Assigned {
+		return
+	}
+	st.dropped[req.id] = struct{}{}
+
+	e.Reason = "cancelled before it was assigned to a worker"
+}
+
+func (st *schedTrace) explain(id uint64) (storiface.SchedExplanation, bool) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	e, ok := st.entries[id]
+	if !ok {
+		return storiface.SchedExplanation{}, false
+	}
+
+	out := *e
+	out.Candidates = append([]storiface.SchedCandidate(nil), e.Candidates...)
+	return out, true
+}
+
+func (sh *scheduler) Explain(ctx context.Context, taskID uint64) (storiface.SchedExplanation, error) {
+	e, ok := sh.trace.explain(taskID)
+	if !ok {
+		return storiface.SchedExplanation{}, xerrors.Errorf("no scheduling information for task %d", taskID)
+	}
+
+	return e, nil
+}
+
+// SchedSectorHistory returns the recorded scheduling decisions for tasks of
+// a sector, oldest first
+func (m *Manager) SchedSectorHistory(ctx context.Context, sector abi.SectorID) ([]storiface.SchedExplanation, error) {
+	var out []storiface.SchedExplanation
+	for _, e := range m.sched.trace.snapshot() {
+		if e.Sector == sector {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// snapshot returns copies of the recorded entries, oldest first
+func (st *schedTrace) snapshot() []storiface.SchedExplanation {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	out := make([]storiface.SchedExplanation, 0, len(st.order))
+	for _, id := range st.order {
+		e := *st.entries[id]
+		e.Candidates = append([]storiface.SchedCandidate(nil), e.Candidates...)
+		out = append(out, e)
+	}
+	return out
+}
+
+// restore adds entries recorded before a restart, ahead of the current ones
+func (st *schedTrace) restore(entries []storiface.SchedExplanation) {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	var order []uint64
+	for i := range entries {
+		e := entries[i]
+		if _, ok := st.entries[e.TaskID]; ok {
+			continue
+		}
+		e.Reason = "before restart: " + e.Reason
+		st.entries[e.TaskID] = &e
+		st.restored[e.TaskID] = struct{}{}
+		order = append(order, e.TaskID)
+	}
+	st.order = append(order, st.order...)
+
+	for len(st.order) > SchedExplainHistory {
+		delete(st.entries, st.order[0])
+		delete(st.restored, st.order[0])
+		delete(st.dropped, st.order[0])
+		st.order = st.order[1:]
+	}
+}
+
+// waiting returns the tasks queued since the start which weren't assigned to
+// a worker yet. Tasks leave the queue when they're assigned, or when their
+// caller cancels them.
+func (st *schedTrace) waiting() []QueuedTask {
+	st.lk.Lock()
+	defer st.lk.Unlock()
+
+	var out []QueuedTask
+	for _, id := range st.order {
+		e := st.entries[id]
+		if _, ok := st.restored[id]; ok || e.Assigned {
+			continue
+		}
+		if _, ok := st.dropped[id]; ok {
+			continue
+		}
+		out = append(out, QueuedTask{
+			Sector: e.Sector,
+			Task:   e.Task,
+			Queued: e.Queued,
+		})
+	}
+	return out
+}
+
+// QueuedTask is a task waiting in the scheduler queue at a checkpoint
+type QueuedTask struct {
+	Sector abi.SectorID
+	Task   sealtasks.TaskType
+	Queued time.Time
+}
+
+// SchedQueueRestoreWindow is how long after RestoreSchedQueue the tasks sealing
+// issues again take over the queue times of the checkpointed ones
+var SchedQueueRestoreWindow = 10 * time.Minute
+
+type queuedTaskKey struct {
+	sector abi.SectorID
+	task   sealtasks.TaskType
+}
+
+// queuedSince returns when a task was queued before a restart, or now
+func (sh *scheduler) queuedSince(sector abi.SectorID, task sealtasks.TaskType) time.Time {
+	now := time.Now()
+
+	sh.requeueLk.Lock()
+	defer sh.requeueLk.Unlock()
+
+	if now.After(sh.requeueUntil) {
+		sh.requeued = nil
+		return now
+	}
+
+	k := queuedTaskKey{sector, task}
+	if t, ok := sh.requeued[k]; ok {
+		delete(sh.requeued, k)
+		return t
+	}
+	return now
+}
+
+// SchedQueueCheckpoint returns the tasks waiting in the scheduler queue, to be
+// restored with RestoreSchedQueue after a restart
+func (m *Manager) SchedQueueCheckpoint() []QueuedTask {
+	return m.sched.trace.waiting()
+}
+
+// RestoreSchedQueue restores the scheduler queue checkpointed before a
+// restart. Queued tasks belong to the callers which were waiting for them, so
+// they aren't run again; sealing issues them again when it restarts sectors,
+// and those keep their queue times.
+func (m *Manager) RestoreSchedQueue(tasks []QueuedTask) {
+	m.sched.requeueLk.Lock()
+	defer m.sched.requeueLk.Unlock()
+
+	m.sched.requeued = map[queuedTaskKey]time.Time{}
+	for _, t := range tasks {
+		m.sched.requeued[queuedTaskKey{t.Sector, t.Task}] = t.Queued
+	}
+	m.sched.requeueUntil = time.Now().Add(SchedQueueRestoreWindow)
+}
+
+// SchedCheckpoint returns the recorded scheduling decisions, to be restored
+// with RestoreSchedCheckpoint after a restart
+func (m *Manager) SchedCheckpoint() []storiface.SchedExplanation {
+	return m.sched.trace.snapshot()
+}
+
+// RestoreSchedCheckpoint restores scheduling decisions recorded before a
+// restart, so they can still be explained. It should be called before tasks
+// are scheduled; new tasks get ids above the restored ones.
+func (m *Manager) RestoreSchedCheckpoint(entries []storiface.SchedExplanation) {
+	var maxID uint64
+	for _, e := range entries {
+		if e.TaskID > maxID {
+			maxID = e.TaskID
+		}
+	}
+
+	for {
+		cur := atomic.LoadUint64(&m.sched.nextTaskID)
+		if cur >= maxID || atomic.CompareAndSwapUint64(&m.sched.nextTaskID, cur, maxID) {
+			break
+		}
+	}
+
+	m.sched.trace.restore(entries)
+}
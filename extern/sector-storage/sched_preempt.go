@@ -0,0 +1,84 @@
+package sectorstorage
+
+import (
+	"context"
+	"sync"
+)
+
+type schedPreemptCtxKey int
+
+var SchedPreemptibleKey schedPreemptCtxKey
+
+// WithPreemptible marks tasks scheduled with ctx as preemptible. When a more
+// important task waits for resources on a worker, preemptible tasks which
+// haven't started their work stage there yet wait until it got them.
+//
+// Running tasks aren't interrupted: the proofs library doesn't stop PC1 on
+// cancellation and remote workers finish calls regardless of the caller, so
+// preemption only happens at task boundaries.
+func WithPreemptible(ctx context.Context) context.Context {
+	return context.WithValue(ctx, SchedPreemptibleKey, true)
+}
+
+func isPreemptible(ctx context.Context) bool {
+	p, _ := ctx.Value(SchedPreemptibleKey).(bool)
+	return p
+}
+
+// preemptFor registers req, which can't get active resources right now, as
+// waiting on the worker, so preemptible tasks don't take the resources it
+// waits for. Must be called with sh.workersLk held.
+func (sh *scheduler) preemptFor(w *workerHandle, req *workerRequest) {
+	req.preempting = true
+	w.preempting = append(w.preempting, req)
+}
+
+// preemptDone is called when a task registered with preemptFor got its
+// resources. Must be called with sh.workersLk held.
+func (sh *scheduler) preemptDone(w *workerHandle, req *workerRequest) {
+	req.preempting = false
+	for i, r := range w.preempting {
+		if r == req {
+			w.preempting = append(w.preempting[:i], w.preempting[i+1:]...)
+			break
+		}
+	}
+
+	if w.active.cond != nil {
+		w.active.cond.Broadcast()
+	}
+}
+
+// waitPreempting makes the preemptible req wait until it can get its active
+// resources and no more important task waits for resources on the worker, so
+// freed resources go to the more important task first. Must be called with
+// sh.workersLk held.
+func (sh *scheduler) waitPreempting(wid WorkerID, w *workerHandle, req *workerRequest) {
+	needRes := sh.needResources(req.taskType)
+
+	traced := false
+	for {
+		var waitFor *workerRequest
+		for _, r := range w.preempting {
+			if r.priority > req.priority {
+				waitFor = r
+				break
+			}
+		}
+
+		if waitFor == nil && w.active.canHandleRequest(needRes, wid, "preemptible", w.info.Resources) {
+			return
+		}
+
+		if waitFor != nil && !traced {
+			log.Infow("preempting task", "worker", wid, "task", req.taskType, "sector", req.sector, "for", waitFor.taskType, "forSector", waitFor.sector)
+			sh.trace.preempted(req)
+			traced = true
+		}
+
+		if w.active.cond == nil {
+			w.active.cond = sync.NewCond(&sh.workersLk)
+		}
+		w.active.cond.Wait()
+	}
+}
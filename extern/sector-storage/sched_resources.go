@@ -3,6 +3,8 @@ package sectorstorage
 import (
 	"sync"
 
+	"golang.org/x/xerrors"
+
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 )
 
@@ -53,41 +55,47 @@ func (a *activeResources) free(wr storiface.WorkerResources, r Resources) {
 }
 
 func (a *activeResources) canHandleRequest(needRes Resources, wid WorkerID, caller string, res storiface.WorkerResources) bool {
+	if err := a.requestFit(needRes, res); err != nil {
+		log.Debugf("sched: not scheduling on worker %d for %s; %s", wid, caller, err)
+		return false
+	}
+
+	return true
+}
+
+// requestFit returns a non-nil error describing the missing resource when the
+// request can't be handled with resources currently available
+func (a *activeResources) requestFit(needRes Resources, res storiface.WorkerResources) error {
 
 	// TODO: dedupe needRes.BaseMinMemory per task type (don't add if that task is already running)
 	minNeedMem := res.MemReserved + a.memUsedMin + needRes.MinMemory + needRes.BaseMinMemory
 	if minNeedMem > res.MemPhysical {
-		log.Debugf("sched: not scheduling on worker %d for %s; not enough physical memory - need: %dM, have %dM", wid, caller, minNeedMem/mib, res.MemPhysical/mib)
-		return false
+		return xerrors.Errorf("not enough physical memory - need: %dM, have %dM", minNeedMem/mib, res.MemPhysical/mib)
 	}
 
 	maxNeedMem := res.MemReserved + a.memUsedMax + needRes.MaxMemory + needRes.BaseMinMemory
 
 	if maxNeedMem > res.MemSwap+res.MemPhysical {
-		log.Debugf("sched: not scheduling on worker %d for %s; not enough virtual memory - need: %dM, have %dM", wid, caller, maxNeedMem/mib, (res.MemSwap+res.MemPhysical)/mib)
-		return false
+		return xerrors.Errorf("not enough virtual memory - need: %dM, have %dM", maxNeedMem/mib, (res.MemSwap+res.MemPhysical)/mib)
 	}
 
 	if needRes.MultiThread() {
 		if a.cpuUse > 0 {
-			log.Debugf("sched: not scheduling on worker %d for %s; multicore process needs %d threads, %d in use, target %d", wid, caller, res.CPUs, a.cpuUse, res.CPUs)
-			return false
+			return xerrors.Errorf("multicore process needs %d threads, %d in use, target %d", res.CPUs, a.cpuUse, res.CPUs)
 		}
 	} else {
 		if a.cpuUse+uint64(needRes.Threads) > res.CPUs {
-			log.Debugf("sched: not scheduling on worker %d for %s; not enough threads, need %d, %d in use, target %d", wid, caller, needRes.Threads, a.cpuUse, res.CPUs)
-			return false
+			return xerrors.Errorf("not enough threads, need %d, %d in use, target %d", needRes.Threads, a.cpuUse, res.CPUs)
 		}
 	}
 
 	if len(res.GPUs) > 0 && needRes.CanGPU {
 		if a.gpuUsed {
-			log.Debugf("sched: not scheduling on worker %d for %s; GPU in use", wid, caller)
-			return false
+			return xerrors.New("GPU in use")
 		}
 	}
 
-	return true
+	return nil
 }
 
 func (a *activeResources) utilization(wr storiface.WorkerResources) float64 {
@@ -7,6 +7,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,6 +21,7 @@ import (
 	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/ops"
 	"github.com/filecoin-project/specs-storage/storage"
 )
 
@@ -66,6 +68,10 @@ func (s *schedTestWorker) FinalizeSector(ctx context.Context, sector abi.SectorI
 	panic("implement me")
 }
 
+func (s *schedTestWorker) FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error {
+	panic("implement me")
+}
+
 func (s *schedTestWorker) ReleaseUnsealed(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error {
 	panic("implement me")
 }
@@ -121,6 +127,22 @@ func (s *schedTestWorker) Info(ctx context.Context) (storiface.WorkerInfo, error
 	}, nil
 }
 
+func (s *schedTestWorker) ChainHeadUpdate(ctx context.Context, head storiface.ChainHead) error {
+	return nil
+}
+
+func (s *schedTestWorker) TaskEnergy(ctx context.Context) (storiface.WorkerEnergy, error) {
+	return storiface.WorkerEnergy{}, nil
+}
+
+func (s *schedTestWorker) Operations(ctx context.Context) ([]ops.Status, error) {
+	return nil, nil
+}
+
+func (s *schedTestWorker) TaskForensics(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType) (*storiface.Forensics, error) {
+	return nil, nil
+}
+
 func (s *schedTestWorker) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return s.closing, nil
 }
@@ -574,6 +596,238 @@ func BenchmarkTrySched(b *testing.B) {
 	b.Run("200w-400q", test(200, 400))
 }
 
+func TestSchedExplain(t *testing.T) {
+	ctx := context.Background()
+
+	sched := newScheduler(abi.RegisteredSealProof_StackedDrg32GiBV1)
+	sched.workers[0] = &workerHandle{
+		info: storiface.WorkerInfo{
+			Hostname:  "small",
+			Resources: storiface.WorkerResources{MemPhysical: 1 << 30, CPUs: 1},
+		},
+		preparing: &activeResources{},
+		active:    &activeResources{},
+	}
+	sched.workers[1] = &workerHandle{
+		info: storiface.WorkerInfo{
+			Hostname:  "decent",
+			Resources: decentWorkerResources,
+		},
+		preparing: &activeResources{},
+		active:    &activeResources{},
+	}
+
+	for wid := range sched.workers {
+		sched.openWindows = append(sched.openWindows, &schedWindowRequest{
+			worker: wid,
+			done:   make(chan *schedWindow, 1),
+		})
+	}
+
+	req := &workerRequest{
+		id:       1,
+		sector:   abi.SectorID{Miner: 1000, Number: 1},
+		taskType: sealtasks.TTPreCommit1,
+		sel:      slowishSelector(true),
+		start:    time.Now(),
+		ctx:      ctx,
+	}
+	sched.trace.queued(req)
+	sched.schedQueue.Push(req)
+
+	sched.trySched()
+
+	ex, err := sched.Explain(ctx, 1)
+	require.NoError(t, err)
+
+	require.True(t, ex.Assigned)
+	require.Equal(t, uint64(1), ex.AssignedWorker)
+	require.Equal(t, 1, ex.Attempts)
+	require.Len(t, ex.Candidates, 2)
+
+	for _, c := range ex.Candidates {
+		switch c.Hostname {
+		case "small":
+			require.False(t, c.Accepted)
+			require.Equal(t, -1, c.Rank)
+			require.Contains(t, c.Reason, "not enough physical memory")
+		case "decent":
+			require.True(t, c.Accepted)
+			require.Equal(t, 0, c.Rank)
+		default:
+			t.Fatalf("unexpected candidate %s", c.Hostname)
+		}
+	}
+
+	_, err = sched.Explain(ctx, 2)
+	require.Error(t, err)
+}
+
+func TestSchedDrain(t *testing.T) {
+	ctx := context.Background()
+
+	sched := newScheduler(abi.RegisteredSealProof_StackedDrg32GiBV1)
+	sched.workers[0] = &workerHandle{
+		info: storiface.WorkerInfo{
+			Hostname:  "decent",
+			Resources: decentWorkerResources,
+		},
+		preparing: &activeResources{},
+		active:    &activeResources{},
+	}
+	sched.openWindows = append(sched.openWindows, &schedWindowRequest{
+		worker: 0,
+		done:   make(chan *schedWindow, 1),
+	})
+
+	sched.schedQueue.Push(&workerRequest{
+		id:       1,
+		sector:   abi.SectorID{Miner: 1000, Number: 1},
+		taskType: sealtasks.TTPreCommit1,
+		sel:      slowishSelector(true),
+		start:    time.Now(),
+		ctx:      ctx,
+	})
+
+	m := &Manager{sched: sched}
+	m.Drain()
+	require.True(t, m.Draining())
+
+	sched.trySched()
+	require.Equal(t, 1, sched.schedQueue.Len())
+	require.Len(t, sched.openWindows, 1)
+
+	atomic.StoreInt32(&sched.draining, 0)
+	sched.trySched()
+	require.Equal(t, 0, sched.schedQueue.Len())
+}
+
+func TestSchedTaskAffinity(t *testing.T) {
+	ctx := context.Background()
+
+	sched := newScheduler(abi.RegisteredSealProof_StackedDrg32GiBV1)
+	for wid, host := range []string{"gpu", "storage"} {
+		sched.workers[WorkerID(wid)] = &workerHandle{
+			info: storiface.WorkerInfo{
+				Hostname:  host,
+				Resources: decentWorkerResources,
+			},
+			preparing: &activeResources{},
+			active:    &activeResources{},
+		}
+		sched.openWindows = append(sched.openWindows, &schedWindowRequest{
+			worker: WorkerID(wid),
+			done:   make(chan *schedWindow, 1),
+		})
+	}
+
+	m := &Manager{sched: sched}
+	m.SetTaskAffinity(storiface.TaskAffinity{
+		Tasks: map[sealtasks.TaskType][]string{
+			sealtasks.TTPreCommit1: {"storage"},
+		},
+		Overrides: map[string]map[sealtasks.TaskType]bool{
+			"storage": {sealtasks.TTPreCommit1: false},
+		},
+	})
+
+	req := &workerRequest{
+		id:       1,
+		sector:   abi.SectorID{Miner: 1000, Number: 1},
+		taskType: sealtasks.TTPreCommit1,
+		sel:      slowishSelector(true),
+		start:    time.Now(),
+		ctx:      ctx,
+	}
+	sched.trace.queued(req)
+	sched.schedQueue.Push(req)
+
+	// pinned to storage, and disabled there
+	sched.trySched()
+	require.Equal(t, 1, sched.schedQueue.Len())
+
+	ex, err := sched.Explain(ctx, 1)
+	require.NoError(t, err)
+	for _, c := range ex.Candidates {
+		require.False(t, c.Accepted)
+		switch c.Hostname {
+		case "gpu":
+			require.Equal(t, "task type pinned to other workers", c.Reason)
+		case "storage":
+			require.Equal(t, "task type disabled on the worker", c.Reason)
+		}
+	}
+
+	m.SetTaskAffinity(storiface.TaskAffinity{
+		Tasks: map[sealtasks.TaskType][]string{
+			sealtasks.TTPreCommit1: {"storage"},
+		},
+	})
+	sched.trySched()
+	require.Equal(t, 0, sched.schedQueue.Len())
+
+	ex, err = sched.Explain(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, ex.Assigned)
+	require.Equal(t, uint64(1), ex.AssignedWorker)
+}
+
+func TestSchedTraceRestore(t *testing.T) {
+	ctx := context.Background()
+
+	before := newSchedTrace()
+	before.queued(&workerRequest{
+		id:       5,
+		sector:   abi.SectorID{Miner: 1000, Number: 1},
+		taskType: sealtasks.TTPreCommit1,
+		start:    time.Now(),
+	})
+	snap := before.snapshot()
+	require.Len(t, snap, 1)
+
+	m := &Manager{sched: newScheduler(abi.RegisteredSealProof_StackedDrg2KiBV1)}
+	m.RestoreSchedCheckpoint(snap)
+
+	ex, err := m.SchedExplain(ctx, 5)
+	require.NoError(t, err)
+	require.Equal(t, sealtasks.TTPreCommit1, ex.Task)
+	require.Equal(t, "before restart: waiting for open scheduling windows", ex.Reason)
+
+	// new tasks don't reuse ids of restored ones
+	require.Equal(t, uint64(6), atomic.AddUint64(&m.sched.nextTaskID, 1))
+}
+
+func TestSchedQueueRestore(t *testing.T) {
+	sector := abi.SectorID{Miner: 1000, Number: 1}
+	queued := time.Now().Add(-time.Hour)
+
+	before := &Manager{sched: newScheduler(abi.RegisteredSealProof_StackedDrg2KiBV1)}
+	before.sched.trace.queued(&workerRequest{id: 1, sector: sector, taskType: sealtasks.TTPreCommit1, start: queued})
+	before.sched.trace.assigned(&workerRequest{id: 2, sector: sector, taskType: sealtasks.TTAddPiece, start: queued}, 0)
+	before.sched.trace.queued(&workerRequest{id: 3, sector: sector, taskType: sealtasks.TTPreCommit2, start: queued})
+	before.sched.trace.cancelled(&workerRequest{id: 3, sector: sector, taskType: sealtasks.TTPreCommit2, start: queued})
+
+	waiting := before.SchedQueueCheckpoint()
+	require.Equal(t, []QueuedTask{{Sector: sector, Task: sealtasks.TTPreCommit1, Queued: queued}}, waiting, "assigned and cancelled tasks left the queue")
+
+	ex, err := before.SchedExplain(context.Background(), 3)
+	require.NoError(t, err)
+	require.Equal(t, "cancelled before it was assigned to a worker", ex.Reason)
+
+	m := &Manager{sched: newScheduler(abi.RegisteredSealProof_StackedDrg2KiBV1)}
+	m.RestoreSchedCheckpoint(before.SchedCheckpoint())
+	m.RestoreSchedQueue(waiting)
+	require.Empty(t, m.SchedQueueCheckpoint(), "restored tasks aren't checkpointed again")
+
+	// the task issued again after the restart keeps its queue time, once
+	require.Equal(t, queued, m.sched.queuedSince(sector, sealtasks.TTPreCommit1))
+	require.True(t, m.sched.queuedSince(sector, sealtasks.TTPreCommit1).After(queued))
+
+	m.RestoreSchedQueue(waiting)
+	m.sched.requeueUntil = time.Now().Add(-time.Second)
+	require.True(t, m.sched.queuedSince(sector, sealtasks.TTPreCommit1).After(queued), "only right after the restore")
+}
+
 func TestWindowCompact(t *testing.T) {
 	sh := scheduler{
 		spt: abi.RegisteredSealProof_StackedDrg32GiBV1,
@@ -643,3 +897,186 @@ func TestWindowCompact(t *testing.T) {
 		[][]sealtasks.TaskType{{sealtasks.TTPreCommit1, sealtasks.TTPreCommit1, sealtasks.TTAddPiece}, {sealtasks.TTPreCommit1, sealtasks.TTPreCommit2}}),
 	)
 }
+
+func TestSchedPreempt(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 30*time.Second)
+	defer done()
+
+	spt := abi.RegisteredSealProof_StackedDrg32GiBV1
+	index := stores.NewIndex()
+
+	sched := newScheduler(spt)
+	go sched.runSched()
+	defer sched.Close(context.TODO()) // nolint
+
+	// fits two PC1s
+	addTestWorker(t, sched, index, "fred", map[sealtasks.TaskType]struct{}{sealtasks.TTPreCommit1: {}})
+
+	sel := newAllocSelector(index, stores.FTCache, stores.PathSealing)
+	noopAction := func(ctx context.Context, w Worker) error {
+		return nil
+	}
+
+	var lk sync.Mutex
+	var order []abi.SectorNumber
+	runs := map[abi.SectorNumber]int{}
+
+	started := make(chan abi.SectorNumber, 4)
+	release := map[abi.SectorNumber]chan struct{}{}
+	for sn := abi.SectorNumber(1); sn <= 4; sn++ {
+		release[sn] = make(chan struct{})
+	}
+
+	// like ffi PC1 and remote workers, the work ignores ctx
+	work := func(sn abi.SectorNumber) WorkerAction {
+		return func(ctx context.Context, w Worker) error {
+			lk.Lock()
+			order = append(order, sn)
+			runs[sn]++
+			lk.Unlock()
+
+			started <- sn
+			<-release[sn]
+			return nil
+		}
+	}
+
+	results := make(chan error, 4)
+	schedule := func(ctx context.Context, sn abi.SectorNumber) {
+		go func() {
+			results <- sched.Schedule(ctx, abi.SectorID{Miner: 8, Number: sn}, sealtasks.TTPreCommit1, sel, noopAction, work(sn))
+		}()
+	}
+
+	var w *workerHandle
+	require.Eventually(t, func() bool {
+		sched.workersLk.RLock()
+		defer sched.workersLk.RUnlock()
+		for _, wh := range sched.workers {
+			w = wh
+		}
+		return w != nil
+	}, 5*time.Second, time.Millisecond)
+
+	preparing := func() bool {
+		w.lk.Lock()
+		defer w.lk.Unlock()
+		return w.preparing.memUsedMin > 0
+	}
+
+	schedule(WithPreemptible(ctx), 1)
+	require.Equal(t, abi.SectorNumber(1), <-started)
+	schedule(WithPreemptible(ctx), 2)
+	require.Equal(t, abi.SectorNumber(2), <-started)
+
+	// a preemptible task waiting for resources, then a more important one
+	schedule(WithPreemptible(ctx), 4)
+	require.Eventually(t, preparing, 5*time.Second, time.Millisecond)
+	schedule(WithPriority(ctx, 1024), 3)
+	require.Eventually(t, func() bool {
+		sched.workersLk.RLock()
+		defer sched.workersLk.RUnlock()
+		return len(w.preempting) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	// running tasks aren't interrupted, the important task gets the first
+	// freed resources
+	close(release[2])
+	require.Equal(t, abi.SectorNumber(3), <-started)
+	close(release[3])
+	require.Equal(t, abi.SectorNumber(4), <-started)
+	close(release[1])
+	close(release[4])
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, <-results)
+	}
+
+	require.Equal(t, []abi.SectorNumber{1, 2, 3, 4}, order)
+	require.Equal(t, map[abi.SectorNumber]int{1: 1, 2: 1, 3: 1, 4: 1}, runs)
+
+	sched.workersLk.RLock()
+	require.Empty(t, w.preempting)
+	sched.workersLk.RUnlock()
+}
+
+func TestSchedResourceOverrides(t *testing.T) {
+	sched := newScheduler(abi.RegisteredSealProof_StackedDrg32GiBV1)
+
+	noGPU := false
+	require.NoError(t, sched.setResourceOverrides(map[string]TaskResourceOverride{
+		"PC1": {MinMemory: "96GiB", Threads: 2},
+		"PC2": {CanGPU: &noGPU},
+	}, map[string]WorkerResourceOverride{
+		"big": {MemPhysical: "512GiB", CPUs: 64, DisableGPUs: true, ReserveMemory: "16GiB", ReserveCPUs: 4},
+	}))
+
+	pc1 := sched.needResources(sealtasks.TTPreCommit1)
+	require.Equal(t, uint64(96<<30), pc1.MinMemory)
+	require.Equal(t, uint64(96<<30), pc1.MaxMemory, "max memory is raised to the min memory")
+	require.Equal(t, 2, pc1.Threads)
+	require.Equal(t, ResourceTable[sealtasks.TTPreCommit1][sched.spt].BaseMinMemory, pc1.BaseMinMemory)
+
+	require.False(t, sched.needResources(sealtasks.TTPreCommit2).CanGPU)
+	require.Equal(t, ResourceTable[sealtasks.TTCommit2][sched.spt], sched.needResources(sealtasks.TTCommit2))
+
+	wr := sched.workerResources("big", decentWorkerResources)
+	require.Equal(t, uint64(512<<30), wr.MemPhysical)
+	require.Equal(t, decentWorkerResources.MemSwap, wr.MemSwap)
+	require.Equal(t, decentWorkerResources.MemReserved+16<<30, wr.MemReserved)
+	require.Equal(t, uint64(60), wr.CPUs)
+	require.Empty(t, wr.GPUs)
+	require.Equal(t, decentWorkerResources, sched.workerResources("small", decentWorkerResources))
+
+	// two PC1 tasks fit with the declared memory and threads
+	var a activeResources
+	a.add(wr, pc1)
+	require.NoError(t, a.requestFit(pc1, wr))
+
+	require.Error(t, sched.setResourceOverrides(map[string]TaskResourceOverride{"XX": {}}, nil))
+	require.Error(t, sched.setResourceOverrides(nil, map[string]WorkerResourceOverride{"big": {MemSwap: "lots"}}))
+}
+
+func TestWorkerSummaries(t *testing.T) {
+	sched := newScheduler(abi.RegisteredSealProof_StackedDrg32GiBV1)
+	start := time.Now().Add(-time.Hour)
+
+	sched.workers[1] = &workerHandle{
+		info: storiface.WorkerInfo{Hostname: "busy", Resources: decentWorkerResources},
+		wt: &workTracker{running: map[uint64]storiface.WorkerJob{
+			1: {ID: 1, Task: sealtasks.TTPreCommit1, Start: start.Add(30 * time.Minute)},
+			2: {ID: 2, Task: sealtasks.TTPreCommit1, Start: start},
+			3: {ID: 3, Task: sealtasks.TTPreCommit2, Start: start.Add(time.Minute)},
+		}},
+		activeWindows: []*schedWindow{{todo: []*workerRequest{{taskType: sealtasks.TTCommit2, start: start}}}},
+		preparing:     &activeResources{},
+		active:        &activeResources{cpuUse: 3},
+	}
+	sched.workers[0] = &workerHandle{
+		info:      storiface.WorkerInfo{Hostname: "idle", Resources: decentWorkerResources},
+		wt:        &workTracker{running: map[uint64]storiface.WorkerJob{}},
+		preparing: &activeResources{},
+		active:    &activeResources{},
+	}
+
+	m := &Manager{sched: sched}
+	ws := m.WorkerSummaries()
+	require.Len(t, ws, 2)
+
+	require.Equal(t, uint64(0), ws[0].ID)
+	require.Equal(t, "idle", ws[0].Info.Hostname)
+	require.Empty(t, ws[0].Jobs)
+	require.Zero(t, ws[0].Oldest)
+
+	busy := ws[1]
+	require.Equal(t, uint64(3), busy.CpuUse)
+	require.Equal(t, map[sealtasks.TaskType]int{sealtasks.TTPreCommit1: 2, sealtasks.TTPreCommit2: 1}, busy.Running)
+	require.Equal(t, map[sealtasks.TaskType]int{sealtasks.TTCommit2: 1}, busy.Assigned)
+	require.True(t, busy.Oldest >= time.Hour)
+
+	var ids []uint64
+	for _, j := range busy.Jobs {
+		ids = append(ids, j.ID)
+	}
+	require.Equal(t, []uint64{2, 3, 1, 0}, ids, "running oldest first, then assigned")
+}
@@ -1,5 +1,11 @@
 package sealtasks
 
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
 type TaskType string
 
 const (
@@ -61,3 +67,15 @@ func (a TaskType) Short() string {
 
 	return n
 }
+
+// ParseTask parses a task type from its short name, like PC1, or its full
+// name
+func ParseTask(s string) (TaskType, error) {
+	s = strings.TrimSpace(s)
+	for tt, short := range shortNames {
+		if string(tt) == s || strings.EqualFold(strings.TrimSpace(short), s) {
+			return tt, nil
+		}
+	}
+	return "", xerrors.Errorf("unknown task type %q", s)
+}
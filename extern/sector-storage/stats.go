@@ -1,9 +1,17 @@
 package sectorstorage
 
 import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 )
 
+var energyQueryTimeout = 10 * time.Second
+
 func (m *Manager) WorkerStats() map[uint64]storiface.WorkerStats {
 	m.sched.workersLk.RLock()
 	defer m.sched.workersLk.RUnlock()
@@ -49,3 +57,89 @@ func (m *Manager) WorkerJobs() map[uint64][]storiface.WorkerJob {
 
 	return out
 }
+
+// WorkerSummaries returns the state of each worker with its jobs, ordered by
+// worker ID
+func (m *Manager) WorkerSummaries() []storiface.WorkerSummary {
+	stats := m.WorkerStats()
+	jobs := m.WorkerJobs()
+	now := time.Now()
+
+	out := make([]storiface.WorkerSummary, 0, len(stats))
+	for id, st := range stats {
+		ws := storiface.WorkerSummary{
+			ID:          id,
+			WorkerStats: st,
+			Running:     map[sealtasks.TaskType]int{},
+			Assigned:    map[sealtasks.TaskType]int{},
+			Jobs:        jobs[id],
+		}
+		if ws.Jobs == nil {
+			ws.Jobs = []storiface.WorkerJob{}
+		}
+
+		sort.Slice(ws.Jobs, func(i, j int) bool {
+			if ws.Jobs[i].RunWait != ws.Jobs[j].RunWait {
+				return ws.Jobs[i].RunWait < ws.Jobs[j].RunWait
+			}
+			return ws.Jobs[i].Start.Before(ws.Jobs[j].Start)
+		})
+
+		for _, j := range ws.Jobs {
+			if j.RunWait != 0 {
+				ws.Assigned[j.Task]++
+				continue
+			}
+			ws.Running[j.Task]++
+			if d := now.Sub(j.Start); d > ws.Oldest {
+				ws.Oldest = d
+			}
+		}
+
+		out = append(out, ws)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// WorkerEnergy returns the energy used by sealing tasks on each worker.
+// Workers which don't respond in time are left out.
+func (m *Manager) WorkerEnergy(ctx context.Context) map[uint64]storiface.WorkerEnergy {
+	m.sched.workersLk.RLock()
+	workers := make(map[WorkerID]*workerHandle, len(m.sched.workers))
+	for id, wh := range m.sched.workers {
+		workers[id] = wh
+	}
+	m.sched.workersLk.RUnlock()
+
+	var lk sync.Mutex
+	out := map[uint64]storiface.WorkerEnergy{}
+
+	var wg sync.WaitGroup
+	for id, wh := range workers {
+		wg.Add(1)
+		go func(id WorkerID, wh *workerHandle) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, energyQueryTimeout)
+			defer cancel()
+
+			e, err := wh.w.TaskEnergy(ctx)
+			if err != nil {
+				log.Warnw("getting worker task energy", "worker", id, "error", err)
+				return
+			}
+			e.Hostname = wh.info.Hostname
+
+			lk.Lock()
+			out[uint64(id)] = e
+			lk.Unlock()
+		}(id, wh)
+	}
+	wg.Wait()
+
+	return out
+}
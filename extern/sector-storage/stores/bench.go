@@ -0,0 +1,129 @@
+package stores
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/nullreader"
+)
+
+// maxBenchSize limits the size of a single test transfer
+const maxBenchSize = 64 << 30
+
+// GET /remote/bench?size=N, serves N zero bytes
+func (handler *FetchHandler) remoteBenchGet(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseUint(r.FormValue("size"), 10, 64)
+	if err != nil || size > maxBenchSize {
+		w.WriteHeader(400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatUint(size, 10))
+	w.WriteHeader(200)
+	if _, err := io.CopyN(w, nullreader.Reader{}, int64(size)); err != nil {
+		log.Warnf("serving bench transfer: %s", err)
+	}
+}
+
+// PUT /remote/bench, discards the body
+func (handler *FetchHandler) remoteBenchPut(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(r.Body, maxBenchSize)); err != nil {
+		log.Warnf("receiving bench transfer: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+// BenchTransfer measures transfers of size bytes with the /remote endpoint
+// at url in both directions, and the latency of empty requests, taken as the
+// best of pings round trips
+func (r *Remote) BenchTransfer(ctx context.Context, url string, size uint64, pings int) (storiface.TransferBench, error) {
+	url = strings.TrimSuffix(url, "/") + "/bench"
+	out := storiface.TransferBench{URL: url, Size: size}
+
+	for i := 0; i < pings; i++ {
+		took, err := r.benchGet(ctx, url, 0)
+		if err != nil {
+			return storiface.TransferBench{}, xerrors.Errorf("ping: %w", err)
+		}
+		if out.Latency == 0 || took < out.Latency {
+			out.Latency = took
+		}
+	}
+
+	var err error
+	out.Download, err = r.benchGet(ctx, url, size)
+	if err != nil {
+		return storiface.TransferBench{}, xerrors.Errorf("download: %w", err)
+	}
+
+	out.Upload, err = r.benchPut(ctx, url, size)
+	if err != nil {
+		return storiface.TransferBench{}, xerrors.Errorf("upload: %w", err)
+	}
+
+	return out, nil
+}
+
+func (r *Remote) benchGet(ctx context.Context, url string, size uint64) (time.Duration, error) {
+	req, err := http.NewRequest("GET", url+"?size="+strconv.FormatUint(size, 10), nil)
+	if err != nil {
+		return 0, xerrors.Errorf("request: %w", err)
+	}
+	req.Header = r.auth
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, xerrors.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close() // nolint
+
+	if resp.StatusCode != 200 {
+		return 0, xerrors.Errorf("non-200 code: %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return 0, xerrors.Errorf("reading response: %w", err)
+	}
+	if uint64(n) != size {
+		return 0, xerrors.Errorf("got %d bytes, expected %d", n, size)
+	}
+
+	return time.Since(start), nil
+}
+
+func (r *Remote) benchPut(ctx context.Context, url string, size uint64) (time.Duration, error) {
+	req, err := http.NewRequest("PUT", url, io.LimitReader(nullreader.Reader{}, int64(size)))
+	if err != nil {
+		return 0, xerrors.Errorf("request: %w", err)
+	}
+	req.Header = r.auth
+	req.ContentLength = int64(size)
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, xerrors.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close() // nolint
+
+	if resp.StatusCode != 200 {
+		return 0, xerrors.Errorf("non-200 code: %d", resp.StatusCode)
+	}
+
+	return time.Since(start), nil
+}
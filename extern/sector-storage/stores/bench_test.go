@@ -0,0 +1,23 @@
+package stores
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchTransfer(t *testing.T) {
+	srv := httptest.NewServer(&FetchHandler{})
+	defer srv.Close()
+
+	r := &Remote{}
+	res, err := r.BenchTransfer(context.Background(), srv.URL+"/remote", 1<<20, 2)
+	require.NoError(t, err)
+	require.Equal(t, srv.URL+"/remote/bench", res.URL)
+	require.Equal(t, uint64(1<<20), res.Size)
+	require.True(t, res.Latency > 0)
+	require.True(t, res.Download > 0)
+	require.True(t, res.Upload > 0)
+}
@@ -0,0 +1,314 @@
+package stores
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/zstd"
+	"golang.org/x/xerrors"
+)
+
+// CompressedExt is the extension of compressed cache files
+const CompressedExt = ".zst"
+
+// compressionLevel favours speed, cache files are decompressed before every
+// PoSt
+const compressionLevel = 3
+
+// CompressibleCacheFile returns whether a file in a finalized sector cache is
+// compressed at rest. Only tree-r-last files are big enough to matter, they
+// are only read for PoSt. They are Poseidon hashes though, which are close to
+// random: expect savings of a few percent at best, so with a MinSaving above
+// that most files are left alone.
+func CompressibleCacheFile(name string) bool {
+	return strings.HasPrefix(name, "sc-02-data-tree-r-last") && strings.HasSuffix(name, ".dat")
+}
+
+// sealingCacheFile returns whether a file is only present in caches of
+// sectors which aren't finalized yet
+func sealingCacheFile(name string) bool {
+	return strings.HasPrefix(name, "sc-02-data-layer-") || strings.HasPrefix(name, "sc-02-data-tree-c")
+}
+
+// CompressStats summarizes a compression or decompression pass
+type CompressStats struct {
+	Files int
+	// Before and After are the sizes of processed files
+	Before int64
+	After  int64
+	// Skipped counts files which didn't compress well enough
+	Skipped int
+	// Busy counts sectors which were left for the next pass, because they
+	// were in use or due for proving
+	Busy int
+}
+
+func (s *CompressStats) Add(o CompressStats) {
+	s.Files += o.Files
+	s.Before += o.Before
+	s.After += o.After
+	s.Skipped += o.Skipped
+	s.Busy += o.Busy
+}
+
+// Incompressible remembers files which didn't compress well, so they aren't
+// compressed again until they change. A nil Incompressible remembers
+// nothing.
+type Incompressible struct {
+	lk    sync.Mutex
+	files map[string]time.Time
+}
+
+func NewIncompressible() *Incompressible {
+	return &Incompressible{
+		files: map[string]time.Time{},
+	}
+}
+
+func (ic *Incompressible) has(p string, fi os.FileInfo) bool {
+	if ic == nil {
+		return false
+	}
+
+	ic.lk.Lock()
+	defer ic.lk.Unlock()
+
+	mt, ok := ic.files[p]
+	return ok && mt.Equal(fi.ModTime())
+}
+
+func (ic *Incompressible) add(p string, fi os.FileInfo) {
+	if ic == nil {
+		return
+	}
+
+	ic.lk.Lock()
+	defer ic.lk.Unlock()
+
+	ic.files[p] = fi.ModTime()
+}
+
+// CompressCache compresses cache files of a finalized sector which weren't
+// modified for minAge. Files which don't shrink by at least minSaving (0-1)
+// are left as they are, and recorded in skip. Caches of sectors which are
+// still sealing aren't touched. The caller must hold a write lock on the
+// sector cache.
+func CompressCache(dir string, minAge time.Duration, minSaving float64, skip *Incompressible) (CompressStats, error) {
+	var out CompressStats
+
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return out, xerrors.Errorf("reading cache dir: %w", err)
+	}
+
+	for _, ent := range ents {
+		if sealingCacheFile(ent.Name()) {
+			return CompressStats{}, nil
+		}
+	}
+
+	for _, ent := range ents {
+		if ent.IsDir() || !CompressibleCacheFile(ent.Name()) || time.Since(ent.ModTime()) < minAge {
+			continue
+		}
+
+		p := filepath.Join(dir, ent.Name())
+		if skip.has(p, ent) {
+			continue
+		}
+
+		size, err := compressFile(p)
+		if err != nil {
+			return out, xerrors.Errorf("compressing %s: %w", p, err)
+		}
+
+		if float64(size) > float64(ent.Size())*(1-minSaving) {
+			// not worth it, keep the original
+			if err := os.Remove(p + CompressedExt); err != nil {
+				return out, xerrors.Errorf("removing compressed file: %w", err)
+			}
+			skip.add(p, ent)
+			out.Skipped++
+			continue
+		}
+
+		if err := os.Remove(p); err != nil {
+			return out, xerrors.Errorf("removing compressed original: %w", err)
+		}
+
+		out.Files++
+		out.Before += ent.Size()
+		out.After += size
+	}
+
+	return out, nil
+}
+
+// DecompressCache restores compressed files in a sector cache. Concurrent
+// calls on the same cache, e.g. by two PoSt readers holding read locks, each
+// write complete files through temp files, and a compressed file another
+// call removed once it restored it counts as restored.
+func DecompressCache(dir string) (CompressStats, error) {
+	var out CompressStats
+
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return out, xerrors.Errorf("reading cache dir: %w", err)
+	}
+
+	for _, ent := range ents {
+		name := strings.TrimSuffix(ent.Name(), CompressedExt)
+		if ent.IsDir() || name == ent.Name() || !CompressibleCacheFile(name) {
+			continue
+		}
+
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			// a previous compression or decompression was interrupted after
+			// writing the complete file
+		} else if os.IsNotExist(err) {
+			size, err := decompressFile(p)
+			if os.IsNotExist(err) {
+				if _, serr := os.Stat(p); serr == nil {
+					// restored by a concurrent call
+					continue
+				}
+			}
+			if err != nil {
+				return out, xerrors.Errorf("decompressing %s: %w", p, err)
+			}
+
+			out.Files++
+			out.Before += ent.Size()
+			out.After += size
+		} else {
+			return out, xerrors.Errorf("stat %s: %w", p, err)
+		}
+
+		if err := os.Remove(p + CompressedExt); err != nil && !os.IsNotExist(err) {
+			return out, xerrors.Errorf("removing compressed file: %w", err)
+		}
+	}
+
+	return out, nil
+}
+
+// HasCompressedFiles returns whether a sector cache has compressed files
+func HasCompressedFiles(dir string) (bool, error) {
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, xerrors.Errorf("reading cache dir: %w", err)
+	}
+	for _, ent := range ents {
+		name := strings.TrimSuffix(ent.Name(), CompressedExt)
+		if !ent.IsDir() && name != ent.Name() && CompressibleCacheFile(name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasCompressibleFiles returns whether CompressCache would try to compress
+// any file of a sector cache, so caches without work aren't locked
+func HasCompressibleFiles(dir string, minAge time.Duration, skip *Incompressible) (bool, error) {
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, xerrors.Errorf("reading cache dir: %w", err)
+	}
+	for _, ent := range ents {
+		if sealingCacheFile(ent.Name()) {
+			return false, nil
+		}
+	}
+	for _, ent := range ents {
+		if ent.IsDir() || !CompressibleCacheFile(ent.Name()) || time.Since(ent.ModTime()) < minAge {
+			continue
+		}
+		if !skip.has(filepath.Join(dir, ent.Name()), ent) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasCompressed returns whether a compressed version of the file exists
+func HasCompressed(path string) bool {
+	_, err := os.Stat(path + CompressedExt)
+	return err == nil
+}
+
+func compressFile(p string) (int64, error) {
+	return transformFile(p, p+CompressedExt, func(w io.Writer, r io.Reader) error {
+		zw := zstd.NewWriterLevel(w, compressionLevel)
+		if _, err := io.Copy(zw, r); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+func decompressFile(p string) (int64, error) {
+	return transformFile(p+CompressedExt, p, func(w io.Writer, r io.Reader) error {
+		zr := zstd.NewReader(r)
+		if _, err := io.Copy(w, zr); err != nil {
+			return err
+		}
+		return zr.Close()
+	})
+}
+
+// transformFile writes transformed contents of src to dst through a temp
+// file, so dst only appears once complete
+func transformFile(src, dst string, transform func(w io.Writer, r io.Reader) error) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close() // nolint
+
+	ist, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // nolint
+
+	if err := tmp.Chmod(ist.Mode()); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+
+	if err := transform(tmp, in); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+
+	st, err := tmp.Stat()
+	if err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return 0, err
+	}
+
+	return st.Size(), nil
+}
@@ -0,0 +1,133 @@
+package stores
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint
+
+	compressible := bytes.Repeat([]byte("sector cache data"), 4096)
+	random := make([]byte, len(compressible))
+	_, err = rand.Read(random)
+	require.NoError(t, err)
+
+	treeR := filepath.Join(dir, "sc-02-data-tree-r-last-0.dat")
+	treeRRand := filepath.Join(dir, "sc-02-data-tree-r-last-1.dat")
+	aux := filepath.Join(dir, "p_aux")
+	require.NoError(t, ioutil.WriteFile(treeR, compressible, 0644))
+	require.NoError(t, ioutil.WriteFile(treeRRand, random, 0644))
+	require.NoError(t, ioutil.WriteFile(aux, []byte("aux"), 0644))
+
+	skip := NewIncompressible()
+
+	has, err := HasCompressibleFiles(dir, 0, skip)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = HasCompressedFiles(dir)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	st, err := CompressCache(dir, 0, 0.1, skip)
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Files)
+	require.Equal(t, 1, st.Skipped)
+	require.Less(t, st.After, st.Before)
+
+	_, err = os.Stat(treeR)
+	require.True(t, os.IsNotExist(err))
+	require.True(t, HasCompressed(treeR))
+	require.False(t, HasCompressed(treeRRand))
+	require.False(t, HasCompressed(aux))
+
+	// incompressible files aren't retried
+	has, err = HasCompressibleFiles(dir, 0, skip)
+	require.NoError(t, err)
+	require.False(t, has)
+	st, err = CompressCache(dir, 0, 0.1, skip)
+	require.NoError(t, err)
+	require.Equal(t, CompressStats{}, st)
+	has, err = HasCompressedFiles(dir)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	st, err = DecompressCache(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, st.Files)
+	require.False(t, HasCompressed(treeR))
+
+	b, err := ioutil.ReadFile(treeR)
+	require.NoError(t, err)
+	require.Equal(t, compressible, b)
+
+	b, err = ioutil.ReadFile(treeRRand)
+	require.NoError(t, err)
+	require.Equal(t, random, b)
+}
+
+func TestCompressCacheSkipsSealing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint
+
+	treeR := filepath.Join(dir, "sc-02-data-tree-r-last-0.dat")
+	require.NoError(t, ioutil.WriteFile(treeR, bytes.Repeat([]byte{1}, 4096), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sc-02-data-layer-1.dat"), []byte{1}, 0644))
+
+	has, err := HasCompressibleFiles(dir, 0, nil)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	st, err := CompressCache(dir, 0, 0.1, nil)
+	require.NoError(t, err)
+	require.Equal(t, CompressStats{}, st)
+	require.False(t, HasCompressed(treeR))
+}
+
+func TestDecompressCacheConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint
+
+	compressible := bytes.Repeat([]byte("sector cache data"), 4096)
+
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 8; i++ {
+			p := filepath.Join(dir, fmt.Sprintf("sc-02-data-tree-r-last-%d.dat", i))
+			require.NoError(t, ioutil.WriteFile(p, compressible, 0644))
+		}
+		_, err := CompressCache(dir, 0, 0.1, nil)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for r := range errs {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				_, errs[r] = DecompressCache(dir)
+			}(r)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		for i := 0; i < 8; i++ {
+			b, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("sc-02-data-tree-r-last-%d.dat", i)))
+			require.NoError(t, err)
+			require.Equal(t, compressible, b)
+		}
+	}
+}
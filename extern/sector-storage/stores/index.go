@@ -30,6 +30,9 @@ type StorageInfo struct {
 
 	CanSeal  bool
 	CanStore bool
+	// Replica paths hold read-only copies of sealed sectors for PoSt, see
+	// LocalStorageMeta
+	Replica bool
 }
 
 type HealthReport struct {
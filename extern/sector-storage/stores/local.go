@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/xerrors"
@@ -26,6 +27,7 @@ type StoragePath struct {
 
 	CanSeal  bool
 	CanStore bool
+	Replica  bool
 }
 
 // LocalStorageMeta [path]/sectorstore.json
@@ -35,6 +37,12 @@ type LocalStorageMeta struct {
 
 	CanSeal  bool
 	CanStore bool
+
+	// Replica paths hold read-only copies of sealed sectors and caches, kept in
+	// sync outside of lotus, e.g. a second NFS mount or a mirrored JBOD. PoSt
+	// reads are balanced between the replicas and the primary copy; sealing,
+	// moves and removals leave replicas alone.
+	Replica bool
 }
 
 // StorageConfig .lotusstorage/storage.json
@@ -72,7 +80,15 @@ type Local struct {
 }
 
 type path struct {
-	local string // absolute local path
+	reads int64 // atomic, PoSt reads in progress, see AcquireReplica
+
+	local   string // absolute local path
+	replica bool
+
+	// replicas only, the sectors declared in the index and the copies which
+	// failed CheckProvable, see declareReplicas and MarkReplica
+	declared map[Decl]struct{}
+	bad      map[abi.SectorID]struct{}
 
 	reserved     int64
 	reservations map[abi.SectorID]SectorFileType
@@ -156,8 +172,16 @@ func (st *Local) OpenPath(ctx context.Context, p string) error {
 
 	// TODO: Check existing / dedupe
 
+	if meta.Replica && (meta.CanSeal || meta.CanStore) {
+		return xerrors.Errorf("replica path %s can't be used for sealing or storage", p)
+	}
+
 	out := &path{
-		local: p,
+		local:   p,
+		replica: meta.Replica,
+
+		declared: map[Decl]struct{}{},
+		bad:      map[abi.SectorID]struct{}{},
 
 		reserved:     0,
 		reservations: map[abi.SectorID]SectorFileType{},
@@ -174,6 +198,7 @@ func (st *Local) OpenPath(ctx context.Context, p string) error {
 		Weight:   meta.Weight,
 		CanSeal:  meta.CanSeal,
 		CanStore: meta.CanStore,
+		Replica:  meta.Replica,
 	}, fst)
 	if err != nil {
 		return xerrors.Errorf("declaring storage in index: %w", err)
@@ -183,6 +208,9 @@ func (st *Local) OpenPath(ctx context.Context, p string) error {
 		ents, err := ioutil.ReadDir(filepath.Join(p, t.String()))
 		if err != nil {
 			if os.IsNotExist(err) {
+				if meta.Replica {
+					continue
+				}
 				if err := os.MkdirAll(filepath.Join(p, t.String()), 0755); err != nil { // nolint
 					return xerrors.Errorf("openPath mkdir '%s': %w", filepath.Join(p, t.String()), err)
 				}
@@ -205,6 +233,9 @@ func (st *Local) OpenPath(ctx context.Context, p string) error {
 			if err := st.index.StorageDeclareSector(ctx, meta.ID, sid, t, meta.CanStore); err != nil {
 				return xerrors.Errorf("declare sector %d(t:%d) -> %s: %w", sid, t, meta.ID, err)
 			}
+			if meta.Replica {
+				out.declared[Decl{sid, t}] = struct{}{}
+			}
 		}
 	}
 
@@ -234,6 +265,7 @@ func (st *Local) open(ctx context.Context) error {
 func (st *Local) reportHealth(ctx context.Context) {
 	// randomize interval by ~10%
 	interval := (HeartbeatInterval*100_000 + time.Duration(rand.Int63n(10_000))) / 100_000
+	lastRescan := time.Now()
 
 	for {
 		select {
@@ -242,6 +274,11 @@ func (st *Local) reportHealth(ctx context.Context) {
 			return
 		}
 
+		if time.Since(lastRescan) >= ReplicaRescanInterval {
+			st.rescanReplicas(ctx)
+			lastRescan = time.Now()
+		}
+
 		st.localLk.RLock()
 
 		toReport := map[ID]HealthReport{}
@@ -264,6 +301,145 @@ func (st *Local) reportHealth(ctx context.Context) {
 	}
 }
 
+// ReplicaRescanInterval is how often replica paths are listed to declare the
+// copies synced to them and drop the removed ones
+var ReplicaRescanInterval = 5 * time.Minute
+
+// rescanReplicas updates the index with the sectors found in replica paths
+func (st *Local) rescanReplicas(ctx context.Context) {
+	st.localLk.Lock()
+	defer st.localLk.Unlock()
+
+	for id, p := range st.paths {
+		if !p.replica || p.local == "" {
+			continue
+		}
+
+		found := map[Decl]struct{}{}
+		for _, t := range PathTypes {
+			ents, err := ioutil.ReadDir(filepath.Join(p.local, t.String()))
+			if err != nil {
+				if !os.IsNotExist(err) {
+					log.Warnf("listing replica %s: %+v", p.local, err)
+				}
+				continue
+			}
+
+			for _, ent := range ents {
+				sid, err := ParseSectorID(ent.Name())
+				if err != nil {
+					continue
+				}
+				found[Decl{sid, t}] = struct{}{}
+			}
+		}
+
+		for d := range found {
+			st.declareReplica(ctx, id, p, d, true)
+		}
+		for d := range p.declared {
+			if _, ok := found[d]; !ok {
+				st.declareReplica(ctx, id, p, d, false)
+			}
+		}
+	}
+}
+
+// declareReplicas updates the index with the copies of a sector in replica
+// paths, after the primary copy changed
+func (st *Local) declareReplicas(ctx context.Context, sid abi.SectorID, types SectorFileType) {
+	st.localLk.Lock()
+	defer st.localLk.Unlock()
+
+	for id, p := range st.paths {
+		if !p.replica || p.local == "" {
+			continue
+		}
+
+		for _, t := range PathTypes {
+			if t&types == 0 {
+				continue
+			}
+			_, err := os.Stat(p.sectorPath(sid, t))
+			st.declareReplica(ctx, id, p, Decl{sid, t}, err == nil)
+		}
+	}
+}
+
+// declareReplica declares or drops a replica copy when it isn't what the index
+// has, must be called with localLk held
+func (st *Local) declareReplica(ctx context.Context, id ID, p *path, d Decl, exists bool) {
+	_, declared := p.declared[d]
+	switch {
+	case exists && !declared:
+		if err := st.index.StorageDeclareSector(ctx, id, d.SectorID, d.SectorFileType, false); err != nil {
+			log.Warnf("declare replica sector %d(t:%d) -> %s: %+v", d.SectorID, d.SectorFileType, id, err)
+			return
+		}
+		p.declared[d] = struct{}{}
+	case !exists && declared:
+		if err := st.index.StorageDropSector(ctx, id, d.SectorID, d.SectorFileType); err != nil {
+			log.Warnf("drop replica sector %d(t:%d) -> %s: %+v", d.SectorID, d.SectorFileType, id, err)
+			return
+		}
+		delete(p.declared, d)
+		delete(p.bad, d.SectorID)
+	}
+}
+
+// ReplicaPaths are the files of a sector in a replica path
+type ReplicaPaths struct {
+	ID    ID
+	Paths SectorPaths
+}
+
+// Replicas lists the replica paths holding all existing files of a sector
+func (st *Local) Replicas(ctx context.Context, sid abi.SectorID, existing SectorFileType) []ReplicaPaths {
+	st.localLk.RLock()
+	defer st.localLk.RUnlock()
+
+	var out []ReplicaPaths
+	for id, p := range st.paths {
+		if !p.replica || p.local == "" {
+			continue
+		}
+
+		rp := ReplicaPaths{ID: id}
+		for _, t := range PathTypes {
+			if t&existing == 0 {
+				continue
+			}
+			if _, ok := p.declared[Decl{sid, t}]; !ok {
+				rp.ID = ""
+				break
+			}
+			SetPathByType(&rp.Paths, t, p.sectorPath(sid, t))
+		}
+		if rp.ID != "" {
+			out = append(out, rp)
+		}
+	}
+
+	return out
+}
+
+// MarkReplica records whether the copy of a sector in a replica path passed
+// the checks, AcquireReplica doesn't read failing copies
+func (st *Local) MarkReplica(id ID, sid abi.SectorID, ok bool) {
+	st.localLk.Lock()
+	defer st.localLk.Unlock()
+
+	p, found := st.paths[id]
+	if !found || !p.replica {
+		return
+	}
+	if ok {
+		delete(p.bad, sid)
+	} else {
+		p.bad[sid] = struct{}{}
+	}
+}
+
 func (st *Local) Reserve(ctx context.Context, sid abi.SectorID, spt abi.RegisteredSealProof, ft SectorFileType, storageIDs SectorPaths, overheadTab map[SectorFileType]int) (func(), error) {
 	ssize, err := spt.SectorSize()
 	if err != nil {
@@ -351,6 +527,10 @@ func (st *Local) AcquireSector(ctx context.Context, sid abi.SectorID, spt abi.Re
 				continue
 			}
 
+			if p.replica {
+				continue
+			}
+
 			spath := p.sectorPath(sid, fileType)
 			SetPathByType(&out, fileType, spath)
 			SetPathByType(&storageIDs, fileType, string(info.ID))
@@ -410,6 +590,64 @@ func (st *Local) AcquireSector(ctx context.Context, sid abi.SectorID, spt abi.Re
 	return out, storageIDs, nil
 }
 
+// AcquireReplica finds the existing files of a sector for reading, in the
+// path holding all of them with the fewest reads in progress: the primary copy
+// or a replica. Sectors with files split between paths are found with
+// AcquireSector. The returned func ends the read.
+func (st *Local) AcquireReplica(ctx context.Context, sid abi.SectorID, spt abi.RegisteredSealProof, existing SectorFileType) (SectorPaths, func(), error) {
+	st.localLk.RLock()
+
+	have := map[ID]SectorFileType{}
+	for _, fileType := range PathTypes {
+		if fileType&existing == 0 {
+			continue
+		}
+
+		si, err := st.index.StorageFindSector(ctx, sid, fileType, spt, false)
+		if err != nil {
+			st.localLk.RUnlock()
+			return SectorPaths{}, nil, xerrors.Errorf("finding existing sector %d(t:%d) failed: %w", sid, fileType, err)
+		}
+		for _, info := range si {
+			have[info.ID] |= fileType
+		}
+	}
+
+	// map order breaks ties randomly
+	var best *path
+	for id, ft := range have {
+		p, ok := st.paths[id]
+		if !ok || p.local == "" || ft != existing {
+			continue
+		}
+		if _, bad := p.bad[sid]; bad {
+			continue
+		}
+		if best == nil || atomic.LoadInt64(&p.reads) < atomic.LoadInt64(&best.reads) {
+			best = p
+		}
+	}
+
+	st.localLk.RUnlock()
+
+	if best == nil {
+		out, _, err := st.AcquireSector(ctx, sid, spt, existing, FTNone, PathStorage, AcquireMove)
+		return out, func() {}, err
+	}
+
+	var out SectorPaths
+	for _, fileType := range PathTypes {
+		if fileType&existing != 0 {
+			SetPathByType(&out, fileType, best.sectorPath(sid, fileType))
+		}
+	}
+
+	atomic.AddInt64(&best.reads, 1)
+	return out, func() {
+		atomic.AddInt64(&best.reads, -1)
+	}, nil
+}
+
 func (st *Local) Local(ctx context.Context) ([]StoragePath, error) {
 	st.localLk.RLock()
 	defer st.localLk.RUnlock()
@@ -431,6 +669,7 @@ func (st *Local) Local(ctx context.Context) ([]StoragePath, error) {
 			LocalPath: p.local,
 			CanSeal:   si.CanSeal,
 			CanStore:  si.CanStore,
+			Replica:   si.Replica,
 		})
 	}
 
@@ -506,6 +745,13 @@ func (st *Local) removeSector(ctx context.Context, sid abi.SectorID, typ SectorF
 		return nil
 	}
 
+	if p.replica {
+		// replicas are kept in sync outside of lotus, the copy is dropped
+		// from the index when it's gone, see rescanReplicas
+		log.Infof("not removing %s from replica %s", SectorName(sid), p.local)
+		return nil
+	}
+
 	if err := st.index.StorageDropSector(ctx, storage, sid, typ); err != nil {
 		return xerrors.Errorf("dropping sector from index: %w", err)
 	}
@@ -572,6 +818,8 @@ func (st *Local) MoveStorage(ctx context.Context, s abi.SectorID, spt abi.Regist
 		}
 	}
 
+	st.declareReplicas(ctx, s, types)
+
 	return nil
 }
 
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/filecoin-project/go-state-types/abi"
+
 	"github.com/filecoin-project/lotus/extern/sector-storage/fsutil"
 
 	"github.com/google/uuid"
@@ -93,3 +95,91 @@ func TestLocalStorage(t *testing.T) {
 
 	// TODO: put more things here
 }
+
+func TestLocalReplica(t *testing.T) {
+	ctx := context.TODO()
+
+	root, err := ioutil.TempDir("", "sector-storage-teststorage-")
+	require.NoError(t, err)
+	defer os.RemoveAll(root) //nolint:errcheck
+
+	tstor := &TestingLocalStorage{
+		root: root,
+	}
+
+	index := NewIndex()
+
+	st, err := NewLocal(ctx, tstor, index, nil)
+	require.NoError(t, err)
+
+	sid := abi.SectorID{Miner: 1000, Number: 1}
+	spt := abi.RegisteredSealProof_StackedDrg2KiBV1
+
+	require.NoError(t, tstor.init("primary"))
+
+	replica := filepath.Join(root, "replica")
+	mb, err := json.Marshal(&LocalStorageMeta{ID: ID(uuid.New().String()), Replica: true})
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(replica, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(replica, MetaFile), mb, 0644))
+
+	for _, p := range []string{filepath.Join(root, "primary"), replica} {
+		for _, ft := range []SectorFileType{FTSealed, FTCache} {
+			require.NoError(t, os.MkdirAll(filepath.Join(p, ft.String(), SectorName(sid)), 0755))
+		}
+		require.NoError(t, st.OpenPath(ctx, p))
+	}
+
+	paths, _, err := st.AcquireSector(ctx, sid, spt, FTSealed|FTCache, FTNone, PathStorage, AcquireMove)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "primary", FTSealed.String(), SectorName(sid)), paths.Sealed, "sealing uses the primary copy")
+
+	p1, done1, err := st.AcquireReplica(ctx, sid, spt, FTSealed|FTCache)
+	require.NoError(t, err)
+	p2, done2, err := st.AcquireReplica(ctx, sid, spt, FTSealed|FTCache)
+	require.NoError(t, err)
+	require.NotEqual(t, p1.Sealed, p2.Sealed, "reads are balanced")
+	require.Equal(t, filepath.Dir(filepath.Dir(p1.Sealed)), filepath.Dir(filepath.Dir(p1.Cache)))
+	done1()
+	done2()
+
+	reps := st.Replicas(ctx, sid, FTSealed|FTCache)
+	require.Len(t, reps, 1)
+	require.Equal(t, filepath.Join(replica, FTCache.String(), SectorName(sid)), reps[0].Paths.Cache)
+
+	// failing copies aren't read
+	st.MarkReplica(reps[0].ID, sid, false)
+	for i := 0; i < 3; i++ {
+		p, done, err := st.AcquireReplica(ctx, sid, spt, FTSealed|FTCache)
+		require.NoError(t, err)
+		require.Equal(t, paths.Sealed, p.Sealed)
+		defer done()
+	}
+	st.MarkReplica(reps[0].ID, sid, true)
+
+	// copies synced after the path was opened are declared by the rescan
+	sid2 := abi.SectorID{Miner: 1000, Number: 2}
+	for _, ft := range []SectorFileType{FTSealed, FTCache} {
+		require.NoError(t, os.MkdirAll(filepath.Join(replica, ft.String(), SectorName(sid2)), 0755))
+	}
+	require.Empty(t, st.Replicas(ctx, sid2, FTSealed|FTCache))
+	st.rescanReplicas(ctx)
+	require.Len(t, st.Replicas(ctx, sid2, FTSealed|FTCache), 1)
+	si, err := index.StorageFindSector(ctx, sid2, FTSealed, spt, false)
+	require.NoError(t, err)
+	require.Len(t, si, 1)
+	require.False(t, si[0].Primary)
+
+	require.NoError(t, st.Remove(ctx, sid, FTSealed, false))
+	_, err = os.Stat(filepath.Join(replica, FTSealed.String(), SectorName(sid)))
+	require.NoError(t, err, "replicas are left alone")
+	require.Len(t, st.Replicas(ctx, sid, FTSealed), 1)
+
+	// and dropped once the sync removed them
+	require.NoError(t, os.RemoveAll(filepath.Join(replica, FTSealed.String(), SectorName(sid))))
+	st.rescanReplicas(ctx)
+	require.Empty(t, st.Replicas(ctx, sid, FTSealed))
+	si, err = index.StorageFindSector(ctx, sid, FTSealed, spt, false)
+	require.NoError(t, err)
+	require.Empty(t, si)
+}
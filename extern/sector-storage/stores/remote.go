@@ -3,6 +3,7 @@ package stores
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/bits"
 	"mime"
@@ -15,8 +16,10 @@ import (
 	"sync"
 
 	"github.com/filecoin-project/lotus/extern/sector-storage/fsutil"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 	"github.com/filecoin-project/lotus/extern/sector-storage/tarutil"
+	"github.com/filecoin-project/lotus/lib/ops"
 
 	"github.com/filecoin-project/go-state-types/abi"
 
@@ -197,7 +200,9 @@ func (r *Remote) acquireFromRemote(ctx context.Context, s abi.SectorID, fileType
 				return "", xerrors.Errorf("removing dest: %w", err)
 			}
 
-			err = r.fetch(ctx, url, tempDest)
+			op := ops.RegistryFromContext(ctx).Start(sealtasks.TTFetch.Short(), fmt.Sprintf("%s %s from %s", SectorName(s), fileType, info.ID))
+			err = r.fetch(ops.WithOperation(ctx, op), url, tempDest)
+			op.Finish(err)
 			if err != nil {
 				merr = multierror.Append(merr, xerrors.Errorf("fetch error %s (storage %s) -> %s: %w", url, info.ID, tempDest, err))
 				continue
@@ -252,15 +257,12 @@ func (r *Remote) fetch(ctx context.Context, url, outname string) error {
 		return xerrors.Errorf("non-200 code: %d", resp.StatusCode)
 	}
 
-	/*bar := pb.New64(w.sizeForType(typ))
-	bar.ShowPercent = true
-	bar.ShowSpeed = true
-	bar.Units = pb.U_BYTES
-
-	barreader := bar.NewProxyReader(resp.Body)
-
-	bar.Start()
-	defer bar.Finish()*/
+	// the length is only known for files, not for tarred directories
+	op := ops.FromContext(ctx)
+	if resp.ContentLength > 0 {
+		op.SetTotal(uint64(resp.ContentLength), "bytes")
+	}
+	body := op.Reader(resp.Body)
 
 	mediatype, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
 	if err != nil {
@@ -273,9 +275,9 @@ func (r *Remote) fetch(ctx context.Context, url, outname string) error {
 
 	switch mediatype {
 	case "application/x-tar":
-		return tarutil.ExtractTar(resp.Body, outname)
+		return tarutil.ExtractTar(body, outname)
 	case "application/octet-stream":
-		return files.WriteTo(files.NewReaderFile(resp.Body), outname)
+		return files.WriteTo(files.NewReaderFile(body), outname)
 	default:
 		return xerrors.Errorf("unknown content type: '%s'", mediatype)
 	}
@@ -0,0 +1,35 @@
+package storiface
+
+import (
+	"errors"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// ErrRecallPending is returned by archivers reading a sector which isn't
+// staged for reading yet
+var ErrRecallPending = errors.New("sector recall pending")
+
+// ArchivedSector is a sector held by the external archive
+type ArchivedSector struct {
+	Sector abi.SectorID
+	// Local is set when the sealed and cache files are also in the storage
+	// of the miner or its workers
+	Local bool
+	// Recall is the last recall of the sector since the miner started
+	Recall *RecallStatus `json:",omitempty"`
+}
+
+// RecallStatus is the progress of bringing an archived sector back into
+// local storage
+type RecallStatus struct {
+	Sector  abi.SectorID
+	Started time.Time
+	// ReadyAt is when the archive expects the sector to be staged, it's
+	// updated as the archive revises its estimate
+	ReadyAt time.Time
+
+	Done  bool
+	Error string `json:",omitempty"`
+}
@@ -0,0 +1,29 @@
+package storiface
+
+import "golang.org/x/xerrors"
+
+// CacheTrimLevel is how much of a sector cache is kept after finalization.
+// There is no level below CacheTrimPoSt: PoSt reads p_aux and tree-r-last,
+// and t_aux, the only other file left, is a few KiB.
+type CacheTrimLevel string
+
+const (
+	// CacheTrimFull keeps the whole cache: the SDR layers, tree-c, tree-d and
+	// the PoSt files, about 450GiB for a 32GiB sector
+	CacheTrimFull CacheTrimLevel = "full"
+	// CacheTrimPoSt keeps only the files needed for PoSt: p_aux, t_aux and
+	// tree-r-last, about 73MiB for a 32GiB sector and 146MiB for a 64GiB one
+	CacheTrimPoSt CacheTrimLevel = "post"
+)
+
+// ParseCacheTrimLevel validates a trim level, empty means CacheTrimPoSt
+func ParseCacheTrimLevel(s string) (CacheTrimLevel, error) {
+	switch l := CacheTrimLevel(s); l {
+	case "":
+		return CacheTrimPoSt, nil
+	case CacheTrimFull, CacheTrimPoSt:
+		return l, nil
+	default:
+		return "", xerrors.Errorf("unknown cache trim level '%s'", s)
+	}
+}
@@ -3,6 +3,8 @@ package storiface
 import (
 	"time"
 
+	"golang.org/x/xerrors"
+
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 )
@@ -11,6 +13,24 @@ type WorkerInfo struct {
 	Hostname string
 
 	Resources WorkerResources
+
+	// Tuning are the TuningSettings set in the environment of the worker
+	Tuning map[string]string
+}
+
+// TuningSettings are environment variables of the proofs library which tune
+// sealing performance
+var TuningSettings = []string{
+	"FIL_PROOFS_USE_MULTICORE_SDR",
+	"FIL_PROOFS_MULTICORE_SDR_PRODUCERS",
+	"FIL_PROOFS_MULTICORE_SDR_PRODUCER_STRIDE",
+	"FIL_PROOFS_MAXIMIZE_CACHING",
+	"FIL_PROOFS_USE_GPU_COLUMN_BUILDER",
+	"FIL_PROOFS_USE_GPU_TREE_BUILDER",
+	"FIL_PROOFS_MAX_GPU_COLUMN_BATCH_SIZE",
+	"FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE",
+	"FIL_PROOFS_COLUMN_WRITE_BATCH_SIZE",
+	"BELLMAN_NO_GPU",
 }
 
 type WorkerResources struct {
@@ -23,8 +43,16 @@ type WorkerResources struct {
 	GPUs []string
 }
 
+// PendingWorkerIDs is the first key of the registered workers waiting for
+// approval in the worker stats of the miner, they aren't known to the
+// scheduler
+const PendingWorkerIDs uint64 = 1 << 63
+
 type WorkerStats struct {
 	Info WorkerInfo
+	// Registration is the registration ID of a worker waiting for approval,
+	// such workers aren't connected
+	Registration string
 
 	MemUsedMin uint64
 	MemUsedMax uint64
@@ -32,6 +60,102 @@ type WorkerStats struct {
 	CpuUse     uint64 // nolint
 }
 
+// TransferBench is the result of test transfers with the /remote endpoint of
+// a worker
+type TransferBench struct {
+	URL  string
+	Size uint64
+
+	// Latency is the best round trip of an empty request
+	Latency time.Duration
+	// Download is the time taken to fetch Size bytes from the worker, Upload
+	// to send them to it
+	Download time.Duration
+	Upload   time.Duration
+}
+
+// TaskRun is a sealing task which finished on a worker
+type TaskRun struct {
+	Task   sealtasks.TaskType
+	Sector abi.SectorID
+
+	Worker string
+	CPUs   uint64
+	GPUs   int
+	// Tuning are the tuning settings of the worker, see WorkerInfo.Tuning
+	Tuning map[string]string
+	// Parallel is the number of tasks of the type running on the worker
+	// when the task started, the task included
+	Parallel int
+
+	Start    time.Time
+	Duration time.Duration
+	Failed   bool
+}
+
+// TaskEnergy is the energy used by finished tasks of one type
+type TaskEnergy struct {
+	Tasks    uint64
+	Joules   float64
+	Duration time.Duration
+}
+
+// WorkerEnergy is reported by workers with energy metering enabled
+type WorkerEnergy struct {
+	Hostname string
+	// Meters are the available energy meters, e.g. rapl (CPU), nvml (GPU)
+	Meters []string
+	Tasks  map[sealtasks.TaskType]TaskEnergy
+}
+
+// Forensics is collected by a worker when a sealing task fails, to correlate
+// intermittent hardware faults across failures
+type Forensics struct {
+	Sector   abi.SectorID
+	Task     sealtasks.TaskType
+	Hostname string
+	Time     time.Time
+	Error    string
+
+	// Inputs describe the task arguments, e.g. piece sizes and the ticket
+	Inputs map[string]string
+	// Stderr is the tail of the worker stderr, where the proofs library logs,
+	// when the worker captures it
+	Stderr string
+	Dmesg  string
+	GPU    string
+}
+
+// ForensicError is a task error with the forensics the worker collected
+type ForensicError struct {
+	Err       error
+	Forensics Forensics
+}
+
+func (e *ForensicError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ForensicError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ForensicError) FormatError(xerrors.Printer) (next error) { return e.Err }
+
+// ChainHead is a chain head relayed by the miner to its workers, letting
+// worker-side tasks draw chain randomness without a full node connection
+type ChainHead struct {
+	Height abi.ChainEpoch
+	// Key is the encoded tipset key of the head
+	Key []byte
+	// Ticket is the VRF proof of the min ticket in the head
+	Ticket []byte
+
+	// Latest beacon entry as of the head
+	BeaconRound uint64
+	BeaconData  []byte
+}
+
 type WorkerJob struct {
 	ID     uint64
 	Sector abi.SectorID
@@ -40,3 +164,117 @@ type WorkerJob struct {
 	RunWait int // 0 - running, 1+ - assigned
 	Start   time.Time
 }
+
+// WorkerSummary is the state of a single worker with its jobs
+type WorkerSummary struct {
+	ID uint64
+	WorkerStats
+
+	// Running and Assigned count the jobs of the worker by task type
+	Running  map[sealtasks.TaskType]int
+	Assigned map[sealtasks.TaskType]int
+	// Jobs are running first, then assigned, oldest first
+	Jobs []WorkerJob
+	// Oldest is how long the longest running job runs for, by the clock of
+	// the miner
+	Oldest time.Duration
+}
+
+// SchedCandidate describes how the scheduler evaluated a single worker for a task
+type SchedCandidate struct {
+	WorkerID uint64
+	Hostname string
+
+	Accepted bool
+	Rank     int // position in the selector preference order, -1 if not accepted
+	Reason   string
+}
+
+// PlacementRequest asks an external placer where to run a task
+type PlacementRequest struct {
+	TaskID   uint64
+	Sector   abi.SectorID
+	Task     sealtasks.TaskType
+	Priority int
+
+	// Candidates are the workers which can run the task now, in the order
+	// the built-in scheduler prefers them
+	Candidates []PlacementCandidate
+}
+
+type PlacementCandidate struct {
+	WorkerID  uint64
+	Hostname  string
+	Resources WorkerResources
+	// Running are the tasks running on the worker
+	Running []WorkerJob
+}
+
+// Placement is the answer of an external placer
+type Placement struct {
+	// Workers are IDs of candidates in the order the task should be tried on
+	// them, candidates which aren't listed are tried after them
+	Workers []uint64
+	// Exclusive only lets the task run on the listed workers, with no
+	// workers listed it waits until its candidates change or the answer
+	// expires, see sectorstorage.PlacementTTL
+	Exclusive bool
+}
+
+// TaskAffinity pins task types to workers by hostname, see
+// Manager.SetTaskAffinity
+type TaskAffinity struct {
+	// Tasks lists the workers each task type is assigned to, task types which
+	// aren't listed are assigned to any worker supporting them
+	Tasks map[sealtasks.TaskType][]string
+	// Overrides enable or disable task types on single workers, on top of
+	// Tasks
+	Overrides map[string]map[sealtasks.TaskType]bool
+}
+
+// Allowed returns whether the task type may be assigned to the worker, and
+// why not
+func (a TaskAffinity) Allowed(hostname string, task sealtasks.TaskType) (bool, string) {
+	if enabled, ok := a.Overrides[hostname][task]; ok {
+		if !enabled {
+			return false, "task type disabled on the worker"
+		}
+		return true, ""
+	}
+
+	hosts, ok := a.Tasks[task]
+	if !ok {
+		return true, ""
+	}
+	for _, h := range hosts {
+		if h == hostname {
+			return true, ""
+		}
+	}
+	return false, "task type pinned to other workers"
+}
+
+// SchedExplanation records why a task was (or wasn't yet) assigned to a worker
+type SchedExplanation struct {
+	TaskID   uint64
+	Sector   abi.SectorID
+	Task     sealtasks.TaskType
+	Priority int
+
+	Queued      time.Time
+	Attempts    int // number of scheduling passes which considered the task
+	LastAttempt time.Time
+
+	// Candidates evaluated during the last scheduling pass
+	Candidates []SchedCandidate
+
+	Assigned       bool
+	AssignedWorker uint64
+	AssignedAt     time.Time
+
+	// Preempted is how often the task was held back before its work stage to
+	// make room for a more important task
+	Preempted int
+
+	Reason string
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/ops"
 )
 
 type testWorker struct {
@@ -77,6 +78,10 @@ func (t *testWorker) FinalizeSector(ctx context.Context, sector abi.SectorID, ke
 	panic("implement me")
 }
 
+func (t *testWorker) FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error {
+	panic("implement me")
+}
+
 func (t *testWorker) ReleaseUnsealed(ctx context.Context, sector abi.SectorID, safeToFree []storage.Range) error {
 	panic("implement me")
 }
@@ -116,6 +121,22 @@ func (t *testWorker) Info(ctx context.Context) (storiface.WorkerInfo, error) {
 	}, nil
 }
 
+func (t *testWorker) ChainHeadUpdate(ctx context.Context, head storiface.ChainHead) error {
+	return nil
+}
+
+func (t *testWorker) TaskEnergy(ctx context.Context) (storiface.WorkerEnergy, error) {
+	return storiface.WorkerEnergy{}, nil
+}
+
+func (t *testWorker) Operations(ctx context.Context) ([]ops.Status, error) {
+	return nil, nil
+}
+
+func (t *testWorker) TaskForensics(ctx context.Context, sector abi.SectorID, task sealtasks.TaskType) (*storiface.Forensics, error) {
+	return nil, nil
+}
+
 func (t *testWorker) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return ctx.Done(), nil
 }
@@ -0,0 +1,122 @@
+package sectorstorage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// unsealWindow is the granularity ranges are unsealed with by ReadRange,
+// unsealing a window takes a fraction of the time of a whole sector
+const unsealWindow = abi.PaddedPieceSize(1 << 20)
+
+// windowRun is a range of a sector read with one ReadPiece call
+type windowRun struct {
+	start storiface.UnpaddedByteIndex
+	size  abi.UnpaddedPieceSize
+}
+
+// unsealWindowRange returns the window aligned range covering length bytes
+// at offset of the unpadded data of a sector of size ssize
+func unsealWindowRange(offset, length uint64, ssize abi.SectorSize) (storiface.UnpaddedByteIndex, abi.UnpaddedPieceSize, error) {
+	window := unsealWindow
+	if abi.PaddedPieceSize(ssize) < window {
+		window = abi.PaddedPieceSize(ssize)
+	}
+	w := uint64(window.Unpadded())
+	max := uint64(abi.PaddedPieceSize(ssize).Unpadded())
+
+	if length == 0 {
+		return 0, 0, xerrors.New("empty range")
+	}
+	if offset+length < offset || offset+length > max {
+		return 0, 0, xerrors.Errorf("range %d+%d is outside of the sector (%d bytes)", offset, length, max)
+	}
+
+	start := offset - offset%w
+	end := offset + length
+	if end%w != 0 {
+		end += w - end%w
+	}
+
+	return storiface.UnpaddedByteIndex(start), abi.UnpaddedPieceSize(end - start), nil
+}
+
+// unsealWindowRuns splits the window range covering length bytes at offset
+// into runs of a power of two windows, aligned to their size, as pieces are
+// read with fr32, which only handles power of two sizes
+func unsealWindowRuns(offset, length uint64, ssize abi.SectorSize) ([]windowRun, error) {
+	start, size, err := unsealWindowRange(offset, length, ssize)
+	if err != nil {
+		return nil, err
+	}
+
+	window := unsealWindow
+	if abi.PaddedPieceSize(ssize) < window {
+		window = abi.PaddedPieceSize(ssize)
+	}
+	w := uint64(window.Unpadded())
+
+	at, windows := uint64(start)/w, uint64(size)/w
+
+	var runs []windowRun
+	for windows > 0 {
+		// the largest power of two the position is aligned to, and which fits
+		n := uint64(1)
+		for at%(n*2) == 0 && n*2 <= windows {
+			n *= 2
+		}
+
+		runs = append(runs, windowRun{
+			start: storiface.UnpaddedByteIndex(at * w),
+			size:  abi.UnpaddedPieceSize(n * w),
+		})
+		at += n
+		windows -= n
+	}
+	return runs, nil
+}
+
+// ReadRange writes length bytes of the unpadded data of a sector at offset to
+// sink. Only the windows of the sector covering the range are unsealed, so
+// small reads from large sectors don't have to wait for the whole sector.
+func (m *Manager) ReadRange(ctx context.Context, sink io.Writer, sector abi.SectorID, offset, length uint64, ticket abi.SealRandomness, unsealed cid.Cid) error {
+	ssize, err := m.scfg.SealProofType.SectorSize()
+	if err != nil {
+		return err
+	}
+
+	runs, err := unsealWindowRuns(offset, length, ssize)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, r := range runs {
+			if err := m.ReadPiece(ctx, pw, sector, r.start, r.size, ticket, unsealed); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		_ = pw.Close()
+	}()
+	defer pr.Close() // nolint
+
+	// skip to the requested offset
+	if _, err := io.CopyN(ioutil.Discard, pr, int64(offset-uint64(runs[0].start))); err != nil {
+		return xerrors.Errorf("reading window: %w", err)
+	}
+	if _, err := io.CopyN(sink, pr, int64(length)); err != nil {
+		return xerrors.Errorf("reading range: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package sectorstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
+	"github.com/filecoin-project/lotus/extern/sector-storage/fr32"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+func TestUnsealWindowRange(t *testing.T) {
+	ssize := abi.SectorSize(32 << 30)
+	w := uint64(unsealWindow.Unpadded())
+
+	start, size, err := unsealWindowRange(10, 20, ssize)
+	require.NoError(t, err)
+	require.Equal(t, storiface.UnpaddedByteIndex(0), start)
+	require.Equal(t, abi.UnpaddedPieceSize(w), size)
+
+	// crossing a window boundary
+	start, size, err = unsealWindowRange(w-5, 10, ssize)
+	require.NoError(t, err)
+	require.Equal(t, storiface.UnpaddedByteIndex(0), start)
+	require.Equal(t, abi.UnpaddedPieceSize(2*w), size)
+
+	start, size, err = unsealWindowRange(3*w, w, ssize)
+	require.NoError(t, err)
+	require.Equal(t, storiface.UnpaddedByteIndex(3*w), start)
+	require.Equal(t, abi.UnpaddedPieceSize(w), size)
+
+	// small sectors are unsealed whole
+	start, size, err = unsealWindowRange(100, 10, 2048)
+	require.NoError(t, err)
+	require.Equal(t, storiface.UnpaddedByteIndex(0), start)
+	require.Equal(t, abi.PaddedPieceSize(2048).Unpadded(), size)
+
+	_, _, err = unsealWindowRange(0, 0, ssize)
+	require.Error(t, err)
+	_, _, err = unsealWindowRange(uint64(abi.PaddedPieceSize(ssize).Unpadded())-5, 10, ssize)
+	require.Error(t, err)
+}
+
+func TestUnsealWindowRuns(t *testing.T) {
+	ssize := abi.SectorSize(32 << 30)
+	w := uint64(unsealWindow.Unpadded())
+
+	runs, err := unsealWindowRuns(w+10, 4*w, ssize)
+	require.NoError(t, err)
+	require.Equal(t, []windowRun{
+		{start: storiface.UnpaddedByteIndex(w), size: abi.UnpaddedPieceSize(w)},
+		{start: storiface.UnpaddedByteIndex(2 * w), size: abi.UnpaddedPieceSize(2 * w)},
+		{start: storiface.UnpaddedByteIndex(4 * w), size: abi.UnpaddedPieceSize(2 * w)},
+	}, runs)
+
+	runs, err = unsealWindowRuns(0, 4*w, ssize)
+	require.NoError(t, err)
+	require.Equal(t, []windowRun{{start: 0, size: abi.UnpaddedPieceSize(4 * w)}}, runs)
+}
+
+// paddedWorker reads pieces of an unsealed sector held in memory with fr32,
+// like the sealer does from the unsealed file
+type paddedWorker struct {
+	*testWorker
+	padded []byte
+}
+
+func (w *paddedWorker) ReadPiece(ctx context.Context, writer io.Writer, id abi.SectorID, index storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize) (bool, error) {
+	r, err := fr32.NewUnpadReader(bytes.NewReader(w.padded[abi.PaddedPieceSize(index.Padded()):]), size.Padded())
+	if err != nil {
+		return false, err
+	}
+	_, err = io.CopyN(writer, r, int64(size))
+	return err == nil, err
+}
+
+func (w *paddedWorker) Info(ctx context.Context) (storiface.WorkerInfo, error) {
+	return storiface.WorkerInfo{
+		Hostname:  "paddedworker",
+		Resources: storiface.WorkerResources{MemPhysical: 1 << 30, CPUs: 4},
+	}, nil
+}
+
+func TestReadRange(t *testing.T) {
+	ctx := context.Background()
+
+	m, lstor, _, si := newTestMgr(ctx, t)
+	spt := abi.RegisteredSealProof_StackedDrg8MiBV1
+	m.scfg = &ffiwrapper.Config{SealProofType: spt}
+	ssize, err := spt.SectorSize()
+	require.NoError(t, err)
+
+	data := make([]byte, abi.PaddedPieceSize(ssize).Unpadded())
+	_, _ = rand.New(rand.NewSource(42)).Read(data)
+	padded := make([]byte, ssize)
+	fr32.Pad(data, padded)
+
+	tw := newTestWorker(WorkerConfig{
+		SealProof: spt,
+		TaskTypes: []sealtasks.TaskType{sealtasks.TTReadUnsealed, sealtasks.TTFetch},
+	}, lstor)
+	require.NoError(t, m.AddWorker(ctx, &paddedWorker{testWorker: tw, padded: padded}))
+
+	sector := abi.SectorID{Miner: 1000, Number: 1}
+	_, ids, err := lstor.AcquireSector(ctx, sector, spt, stores.FTNone, stores.FTUnsealed, stores.PathSealing, stores.AcquireMove)
+	require.NoError(t, err)
+	require.NoError(t, si.StorageDeclareSector(ctx, stores.ID(ids.Unsealed), sector, stores.FTUnsealed, false))
+
+	w := uint64(unsealWindow.Unpadded())
+	for _, tc := range []struct {
+		offset, length uint64
+		windows        int
+	}{
+		{10, 20, 1},
+		{w - 5, w + 10, 3},
+		{w + 100, 4 * w, 5},
+	} {
+		runs, err := unsealWindowRuns(tc.offset, tc.length, ssize)
+		require.NoError(t, err)
+		var windows int
+		for _, r := range runs {
+			windows += int(uint64(r.size) / w)
+		}
+		require.Equal(t, tc.windows, windows)
+
+		var buf bytes.Buffer
+		require.NoError(t, m.ReadRange(ctx, &buf, sector, tc.offset, tc.length, nil, cid.Undef), "%d windows", tc.windows)
+		require.Equal(t, data[tc.offset:tc.offset+tc.length], buf.Bytes(), "%d windows", tc.windows)
+	}
+}
@@ -47,6 +47,20 @@ func (wt *workTracker) track(sid abi.SectorID, task sealtasks.TaskType) func() {
 	}
 }
 
+// count returns the number of running tasks of a type
+func (wt *workTracker) count(task sealtasks.TaskType) int {
+	wt.lk.Lock()
+	defer wt.lk.Unlock()
+
+	var n int
+	for _, job := range wt.running {
+		if job.Task == task {
+			n++
+		}
+	}
+	return n
+}
+
 func (wt *workTracker) worker(w Worker) Worker {
 	return &trackedWorker{
 		Worker:  w,
@@ -102,6 +116,12 @@ func (t *trackedWorker) FinalizeSector(ctx context.Context, sector abi.SectorID,
 	return t.Worker.FinalizeSector(ctx, sector, keepUnsealed)
 }
 
+func (t *trackedWorker) FinalizeSectorTrim(ctx context.Context, sector abi.SectorID, keepUnsealed []storage.Range, level storiface.CacheTrimLevel) error {
+	defer t.tracker.track(sector, sealtasks.TTFinalize)()
+
+	return t.Worker.FinalizeSectorTrim(ctx, sector, keepUnsealed, level)
+}
+
 func (t *trackedWorker) AddPiece(ctx context.Context, sector abi.SectorID, pieceSizes []abi.UnpaddedPieceSize, newPieceSize abi.UnpaddedPieceSize, pieceData storage.Data) (abi.PieceInfo, error) {
 	defer t.tracker.track(sector, sealtasks.TTAddPiece)()
 
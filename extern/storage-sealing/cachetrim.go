@@ -0,0 +1,25 @@
+package sealing
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// TrimCache trims the cache of a proving sector
+func (m *Sealing) TrimCache(ctx context.Context, sid abi.SectorNumber, level storiface.CacheTrimLevel) error {
+	info, err := m.GetSectorInfo(sid)
+	if err != nil {
+		return xerrors.Errorf("getting sector info: %w", err)
+	}
+
+	if info.State != Proving {
+		return xerrors.Errorf("sector %d is in state %s, only finalized sectors can be trimmed", sid, info.State)
+	}
+
+	return m.sealer.TrimCache(ctx, m.minerSector(sid), level)
+}
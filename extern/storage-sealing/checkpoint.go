@@ -0,0 +1,72 @@
+package sealing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// Checkpoint is sealing state which is only kept in memory, it's persisted
+// so a restart doesn't lose it
+type Checkpoint struct {
+	// WaitDealsSince is when sectors accepting deals were opened, the
+	// WaitDealsDelay timer of a restored sector only runs for what's left
+	WaitDealsSince map[abi.SectorNumber]time.Time
+	// ToUpgrade are sectors marked for upgrade
+	ToUpgrade []abi.SectorNumber
+}
+
+func (m *Sealing) Checkpoint() Checkpoint {
+	cp := Checkpoint{
+		WaitDealsSince: map[abi.SectorNumber]time.Time{},
+	}
+
+	m.openLk.Lock()
+	for sn, t := range m.openSince {
+		cp.WaitDealsSince[sn] = t
+	}
+	m.openLk.Unlock()
+
+	m.upgradeLk.Lock()
+	for sn := range m.toUpgrade {
+		cp.ToUpgrade = append(cp.ToUpgrade, sn)
+	}
+	m.upgradeLk.Unlock()
+	sort.Slice(cp.ToUpgrade, func(i, j int) bool {
+		return cp.ToUpgrade[i] < cp.ToUpgrade[j]
+	})
+
+	return cp
+}
+
+// RestoreCheckpoint restores state from a checkpoint taken before a restart,
+// it must be called before Run. Sectors which changed state meanwhile are
+// skipped.
+func (m *Sealing) RestoreCheckpoint(cp Checkpoint) {
+	m.restored = &cp
+}
+
+func (m *Sealing) opened(sn abi.SectorNumber, since time.Time) {
+	m.openLk.Lock()
+	defer m.openLk.Unlock()
+
+	m.openSince[sn] = since
+}
+
+func (m *Sealing) closed(sn abi.SectorNumber) {
+	m.openLk.Lock()
+	defer m.openLk.Unlock()
+
+	delete(m.openSince, sn)
+}
+
+// waitDealsDelay returns how long a sector opened at since still waits for
+// deals
+func waitDealsDelay(delay time.Duration, since time.Time) time.Duration {
+	left := delay - time.Since(since)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
@@ -0,0 +1,155 @@
+package sealing
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/dline"
+	"github.com/filecoin-project/go-statemachine"
+	"golang.org/x/xerrors"
+
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/build"
+)
+
+// CommitPlacementMargin is how long before the commit is due (or the ticket
+// expires) a sector is still held back to land in a less loaded deadline
+var CommitPlacementMargin = abi.ChainEpoch(miner0.WPoStProvingPeriod)
+
+// DeadlineLoad is the number of sectors assigned to a proving deadline
+type DeadlineLoad struct {
+	LiveSectors  uint64
+	TotalSectors uint64
+}
+
+// DeadlineLoads are the sectors assigned to each proving deadline of a miner
+type DeadlineLoads struct {
+	PartitionSectors uint64
+	Deadlines        []DeadlineLoad
+}
+
+// partitions returns the number of partitions of the deadline after a sector
+// is assigned to it, after and before compaction, these are what the miner
+// actor minimises first when picking a deadline for a new sector
+func (l DeadlineLoad) partitions(partitionSectors uint64) (compact uint64, total uint64) {
+	ceil := func(n uint64) uint64 {
+		return (n + partitionSectors - 1) / partitionSectors
+	}
+	return ceil(l.LiveSectors + 1), ceil(l.TotalSectors + 1)
+}
+
+// placementHeight returns the epoch at which the commit should be sent for the
+// sector to be assigned to the least loaded deadline, or 0 if it can be sent
+// now.
+//
+// The miner actor assigns new sectors to the least loaded mutable deadline
+// when the proof is confirmed, the current and the next deadline aren't
+// mutable. If one of those is less loaded than every mutable deadline,
+// sending the commit once it becomes mutable again spreads the sectors evenly.
+func placementHeight(di *dline.Info, loads *DeadlineLoads) abi.ChainEpoch {
+	n := uint64(len(loads.Deadlines))
+	if !di.PeriodStarted() || loads.PartitionSectors == 0 || n == 0 || di.Index >= n {
+		return 0
+	}
+
+	less := func(a, b DeadlineLoad) bool {
+		ac, at := a.partitions(loads.PartitionSectors)
+		bc, bt := b.partitions(loads.PartitionSectors)
+		if ac != bc {
+			return ac < bc
+		}
+		return at < bt
+	}
+
+	cur, next := di.Index, (di.Index+1)%n
+
+	var best *DeadlineLoad
+	for dlIdx := range loads.Deadlines {
+		if uint64(dlIdx) == cur || uint64(dlIdx) == next {
+			continue
+		}
+		if best == nil || less(loads.Deadlines[dlIdx], *best) {
+			best = &loads.Deadlines[dlIdx]
+		}
+	}
+	if best == nil {
+		return 0
+	}
+
+	// the current deadline is mutable once it closes, the next one a challenge
+	// window later
+	switch {
+	case less(loads.Deadlines[cur], *best):
+		return di.Close
+	case less(loads.Deadlines[next], *best):
+		return di.Close + di.WPoStChallengeWindow
+	}
+	return 0
+}
+
+// commitPlacementHeight returns the epoch until which the commit of the sector
+// is held back for it to land in a less loaded deadline, or 0 to send it now.
+// Commits are only held back with CommitPlacement set in the sealing config.
+func (m *Sealing) commitPlacementHeight(ctx context.Context, sector SectorInfo, tok TipSetToken, height abi.ChainEpoch) (abi.ChainEpoch, error) {
+	cfg, err := m.getConfig()
+	if err != nil {
+		return 0, xerrors.Errorf("getting sealing config: %w", err)
+	}
+	if !cfg.CommitPlacement {
+		return 0, nil
+	}
+
+	nv, err := m.api.StateNetworkVersion(ctx, tok)
+	if err != nil {
+		return 0, xerrors.Errorf("getting network version: %w", err)
+	}
+	if nv >= build.ActorUpgradeNetworkVersion {
+		// TODO: ActorUpgrade(use MaxProveCommitDuration)
+		return 0, nil
+	}
+	msd := miner0.MaxSealDuration[sector.SectorType]
+
+	pci, err := m.api.StateSectorPreCommitInfo(ctx, m.maddr, sector.SectorNumber, tok)
+	if err != nil {
+		return 0, xerrors.Errorf("getting precommit info: %w", err)
+	}
+	if pci == nil {
+		return 0, nil
+	}
+
+	di, err := m.api.StateMinerProvingDeadline(ctx, m.maddr, tok)
+	if err != nil {
+		return 0, xerrors.Errorf("getting proving deadline: %w", err)
+	}
+	loads, err := m.api.StateMinerDeadlineLoads(ctx, m.maddr, tok)
+	if err != nil {
+		return 0, xerrors.Errorf("getting deadline loads: %w", err)
+	}
+
+	at := placementHeight(di, loads)
+	if at <= height {
+		return 0, nil
+	}
+
+	due := pci.PreCommitEpoch + msd
+	if ticketDue := sector.TicketEpoch + SealRandomnessLookback + msd; ticketDue < due {
+		due = ticketDue
+	}
+	if at+CommitPlacementMargin > due {
+		return 0, nil
+	}
+
+	return at, nil
+}
+
+// waitCommitPlacement retries submitting the commit at the given height
+func (m *Sealing) waitCommitPlacement(ctx statemachine.Context, sector SectorInfo, at abi.ChainEpoch) error {
+	log.Warnw("holding back commit for the sector to be assigned to a less loaded deadline", "sector", sector.SectorNumber, "until", at)
+
+	return m.events.ChainAt(func(context.Context, TipSetToken, abi.ChainEpoch) error {
+		return ctx.Send(SectorRetrySubmitCommit{})
+	}, func(context.Context, TipSetToken) error {
+		return nil
+	}, InteractivePoRepConfidence, at)
+}
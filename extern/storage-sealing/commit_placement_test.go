@@ -0,0 +1,55 @@
+package sealing
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/require"
+
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+)
+
+func TestPlacementHeight(t *testing.T) {
+	loads := func(cur, next uint64) *DeadlineLoads {
+		l := &DeadlineLoads{
+			PartitionSectors: 10,
+			Deadlines:        make([]DeadlineLoad, miner0.WPoStPeriodDeadlines),
+		}
+		for i := range l.Deadlines {
+			l.Deadlines[i] = DeadlineLoad{LiveSectors: 20, TotalSectors: 20}
+		}
+		l.Deadlines[3] = DeadlineLoad{LiveSectors: cur, TotalSectors: cur}
+		l.Deadlines[4] = DeadlineLoad{LiveSectors: next, TotalSectors: next}
+		return l
+	}
+
+	di := miner0.NewDeadlineInfo(0, 3, 3*miner0.WPoStChallengeWindow+5)
+
+	// mutable deadlines are as good as it gets
+	require.Equal(t, abi.ChainEpoch(0), placementHeight(di, loads(20, 20)))
+	require.Equal(t, abi.ChainEpoch(0), placementHeight(di, loads(25, 30)))
+
+	// the current deadline has a free partition
+	require.Equal(t, di.Close, placementHeight(di, loads(5, 20)))
+
+	// so does the next one, the current one is mutable sooner
+	require.Equal(t, di.Close, placementHeight(di, loads(5, 5)))
+
+	// only the next one does
+	require.Equal(t, di.Close+miner0.WPoStChallengeWindow, placementHeight(di, loads(20, 5)))
+
+	// terminated sectors count once live ones are equal
+	l := loads(20, 20)
+	l.Deadlines[3].TotalSectors = 30
+	l.Deadlines[4].TotalSectors = 30
+	require.Equal(t, abi.ChainEpoch(0), placementHeight(di, l))
+	for i := range l.Deadlines {
+		if i != 3 {
+			l.Deadlines[i].TotalSectors = 40
+		}
+	}
+	require.Equal(t, di.Close, placementHeight(di, l))
+
+	// no state before the proving period starts
+	require.Equal(t, abi.ChainEpoch(0), placementHeight(miner0.NewDeadlineInfo(100, 0, 50), loads(5, 5)))
+}
@@ -0,0 +1,188 @@
+package sealing
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
+)
+
+// External sectors are sealed by an orchestrator outside of this miner. The
+// orchestrator allocates a sector, declares the pieces it put into it, seals
+// it with its own workers, declares the sealed and cache files in the sector
+// index, and hands the sector back with ExternalSealed. From there the sector
+// follows the normal path, starting at PreCommitting: the miner sends the
+// messages, computes the commit proof and proves the sector.
+//
+// Sectors which fail pre-commit checks later on (expired ticket, bad CommD)
+// are re-sealed by the miner, which needs the unsealed copy of the sector.
+
+// ExternalSealedInfo describes the result of sealing an external sector
+type ExternalSealedInfo struct {
+	TicketValue abi.SealRandomness
+	TicketEpoch abi.ChainEpoch
+	CommR       cid.Cid
+	CommD       cid.Cid
+}
+
+// AllocateExternal allocates a sector number for a sector sealed externally
+func (m *Sealing) AllocateExternal(ctx context.Context) (abi.SectorNumber, error) {
+	rt, err := ffiwrapper.SealProofTypeFromSectorSize(m.sealer.SectorSize())
+	if err != nil {
+		return 0, xerrors.Errorf("bad sector size: %w", err)
+	}
+
+	sid, err := m.sc.Next()
+	if err != nil {
+		return 0, xerrors.Errorf("getting sector number: %w", err)
+	}
+
+	m.externalLk.Lock()
+	defer m.externalLk.Unlock()
+
+	log.Infof("Creating external sector %d", sid)
+	if err := m.sectors.Send(uint64(sid), SectorStartExternal{
+		ID:         sid,
+		SectorType: rt,
+	}); err != nil {
+		return 0, err
+	}
+	m.external[sid] = []Piece{}
+
+	return sid, nil
+}
+
+// ExternalAddPiece declares a piece written into an external sector, pieces
+// must be declared in the order they are placed in the sector, padding
+// included
+func (m *Sealing) ExternalAddPiece(ctx context.Context, sid abi.SectorNumber, piece Piece) error {
+	if err := piece.Piece.Size.Validate(); err != nil {
+		return xerrors.Errorf("invalid piece size: %w", err)
+	}
+
+	m.externalLk.Lock()
+	defer m.externalLk.Unlock()
+
+	pieces, err := m.externalPieces(sid)
+	if err != nil {
+		return err
+	}
+
+	stored := piecesSize(pieces)
+	if stored+piece.Piece.Size > abi.PaddedPieceSize(m.sealer.SectorSize()) {
+		return xerrors.Errorf("piece doesn't fit in sector %d, %d of %d bytes used", sid, stored, m.sealer.SectorSize())
+	}
+	if stored%piece.Piece.Size != 0 {
+		return xerrors.Errorf("piece of %d bytes at offset %d isn't aligned, add padding first", piece.Piece.Size, stored)
+	}
+
+	if err := m.sectors.Send(uint64(sid), SectorAddPiece{NewPiece: piece}); err != nil {
+		return err
+	}
+	m.external[sid] = append(pieces, piece)
+
+	return nil
+}
+
+// ExternalSealed hands a sealed external sector back to the miner, which
+// pre-commits it. The sealed and cache files must be declared in the sector
+// index.
+func (m *Sealing) ExternalSealed(ctx context.Context, sid abi.SectorNumber, info ExternalSealedInfo) error {
+	rt, err := ffiwrapper.SealProofTypeFromSectorSize(m.sealer.SectorSize())
+	if err != nil {
+		return xerrors.Errorf("bad sector size: %w", err)
+	}
+
+	m.externalLk.Lock()
+	defer m.externalLk.Unlock()
+
+	pieces, err := m.externalPieces(sid)
+	if err != nil {
+		return err
+	}
+
+	if stored := piecesSize(pieces); stored != abi.PaddedPieceSize(m.sealer.SectorSize()) {
+		return xerrors.Errorf("pieces of sector %d only fill %d of %d bytes", sid, stored, m.sealer.SectorSize())
+	}
+
+	evt := SectorExternalSealed{
+		TicketValue: info.TicketValue,
+		TicketEpoch: info.TicketEpoch,
+		Sealed:      info.CommR,
+		Unsealed:    info.CommD,
+	}
+
+	// run the pre-commit checks now, so a bad sector is rejected instead of
+	// being re-sealed locally
+	si := SectorInfo{
+		SectorNumber: sid,
+		SectorType:   rt,
+		Pieces:       pieces,
+	}
+	evt.apply(&si)
+	tok, height, err := m.api.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+	if err := checkPrecommit(ctx, m.maddr, si, tok, height, m.api); err != nil {
+		return xerrors.Errorf("checking sector %d: %w", sid, err)
+	}
+
+	if err := m.sectors.Send(uint64(sid), evt); err != nil {
+		return err
+	}
+	delete(m.external, sid)
+
+	return nil
+}
+
+// ReleaseExternal gives up an external sector which wasn't handed back yet,
+// its files are removed from storage
+func (m *Sealing) ReleaseExternal(ctx context.Context, sid abi.SectorNumber) error {
+	m.externalLk.Lock()
+	defer m.externalLk.Unlock()
+
+	if _, err := m.externalPieces(sid); err != nil {
+		return err
+	}
+
+	if err := m.sectors.Send(uint64(sid), SectorRemove{}); err != nil {
+		return err
+	}
+	delete(m.external, sid)
+
+	return nil
+}
+
+// externalPieces returns the pieces of an external sector waiting for
+// sealing. Events are applied asynchronously, so the pieces are tracked in
+// memory, and only loaded from the sector state after a restart. Must be
+// called with m.externalLk held.
+func (m *Sealing) externalPieces(sid abi.SectorNumber) ([]Piece, error) {
+	if pieces, ok := m.external[sid]; ok {
+		return pieces, nil
+	}
+
+	si, err := m.GetSectorInfo(sid)
+	if err != nil {
+		return nil, xerrors.Errorf("getting sector %d: %w", sid, err)
+	}
+	if si.State != External {
+		return nil, xerrors.Errorf("sector %d is not an external sector waiting for sealing, state %s", sid, si.State)
+	}
+
+	m.external[sid] = si.Pieces
+	return si.Pieces, nil
+}
+
+func piecesSize(pieces []Piece) abi.PaddedPieceSize {
+	var stored abi.PaddedPieceSize
+	for _, p := range pieces {
+		stored += p.Piece.Size
+	}
+	return stored
+}
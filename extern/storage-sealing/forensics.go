@@ -0,0 +1,43 @@
+package sealing
+
+import (
+	"encoding/json"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// forensicsLog returns a sector log entry with the worker forensics attached
+// to the error of a failure event
+func forensicsLog(evt interface{}) (Log, bool) {
+	f, ok := evt.(xerrors.Formatter)
+	if !ok {
+		return Log{}, false
+	}
+
+	var fe *storiface.ForensicError
+	if !xerrors.As(f.FormatError(discardPrinter{}), &fe) {
+		return Log{}, false
+	}
+
+	msg, err := json.Marshal(fe.Forensics)
+	if err != nil {
+		log.Errorf("marshaling task forensics: %+v", err)
+		return Log{}, false
+	}
+
+	return Log{
+		Timestamp: uint64(time.Now().Unix()),
+		Message:   string(msg),
+		Kind:      "forensics;" + string(fe.Forensics.Task),
+	}, true
+}
+
+// discardPrinter lets forensicsLog unwrap failure events through FormatError
+type discardPrinter struct{}
+
+func (discardPrinter) Print(args ...interface{})                 {}
+func (discardPrinter) Printf(format string, args ...interface{}) {}
+func (discardPrinter) Detail() bool                              { return false }
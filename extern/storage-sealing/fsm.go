@@ -14,10 +14,16 @@ import (
 
 	"github.com/filecoin-project/go-state-types/abi"
 	statemachine "github.com/filecoin-project/go-statemachine"
+
+	"github.com/filecoin-project/lotus/lib/watchdog"
 )
 
+var fsmWatchdog = watchdog.Register("sealing-fsm", time.Minute)
+
 func (m *Sealing) Plan(events []statemachine.Event, user interface{}) (interface{}, uint64, error) {
+	done := fsmWatchdog.Busy()
 	next, processed, err := m.plan(events, user.(*SectorInfo))
+	done()
 	if err != nil || next == nil {
 		return nil, processed, err
 	}
@@ -39,12 +45,17 @@ var fsmPlanners = map[SectorState]func(events []statemachine.Event, state *Secto
 	UndefinedSectorState: planOne(
 		on(SectorStart{}, Empty),
 		on(SectorStartCC{}, Packing),
+		on(SectorStartExternal{}, External),
 	),
 	Empty: planOne(on(SectorAddPiece{}, WaitDeals)),
 	WaitDeals: planOne(
 		on(SectorAddPiece{}, WaitDeals),
 		on(SectorStartPacking{}, Packing),
 	),
+	External: planOne(
+		on(SectorAddPiece{}, External),
+		on(SectorExternalSealed{}, PreCommitting),
+	),
 	Packing: planOne(on(SectorPacked{}, PreCommit1)),
 	PreCommit1: planOne(
 		on(SectorPreCommit1{}, PreCommit2),
@@ -77,6 +88,7 @@ var fsmPlanners = map[SectorState]func(events []statemachine.Event, state *Secto
 	SubmitCommit: planOne(
 		on(SectorCommitSubmitted{}, CommitWait),
 		on(SectorCommitFailed{}, CommitFailed),
+		on(SectorRetrySubmitCommit{}, SubmitCommit),
 	),
 	CommitWait: planOne(
 		on(SectorProving{}, FinalizeSector),
@@ -132,6 +144,9 @@ var fsmPlanners = map[SectorState]func(events []statemachine.Event, state *Secto
 	RecoverDealIDs: planOne(
 		onReturning(SectorUpdateDealIDs{}),
 	),
+	PreCommitExpired: planOne(
+	// SectorRemove (global)
+	),
 
 	// Post-seal
 
@@ -187,6 +202,10 @@ func (m *Sealing) plan(events []statemachine.Event, state *SectorInfo) (func(sta
 		}
 
 		state.Log = append(state.Log, l)
+
+		if fl, ok := forensicsLog(event.User); ok {
+			state.Log = append(state.Log, fl)
+		}
 	}
 
 	if m.notifee != nil {
@@ -265,6 +284,8 @@ func (m *Sealing) plan(events []statemachine.Event, state *SectorInfo) (func(sta
 		fallthrough
 	case WaitDeals:
 		log.Infof("Waiting for deals %d", state.SectorNumber)
+	case External:
+		log.Infof("Waiting for external sealing of %d", state.SectorNumber)
 	case Packing:
 		return m.handlePacking, processed, nil
 	case PreCommit1:
@@ -306,6 +327,8 @@ func (m *Sealing) plan(events []statemachine.Event, state *SectorInfo) (func(sta
 		return m.handleDealsExpired, processed, nil
 	case RecoverDealIDs:
 		return m.handleRecoverDealIDs, processed, nil
+	case PreCommitExpired:
+		return m.handlePreCommitExpired, processed, nil
 
 	// Post-seal
 	case Proving:
@@ -408,9 +431,18 @@ func (m *Sealing) restartSectors(ctx context.Context) error {
 				m.unsealedInfoMap.infos[sector.SectorNumber] = ui
 			}
 
-			// start a fresh timer for the sector
+			// continue the timer of the sector if it was checkpointed, or
+			// start a fresh one
+			since := time.Now()
+			if m.restored != nil {
+				if t, ok := m.restored.WaitDealsSince[sector.SectorNumber]; ok {
+					since = t
+				}
+			}
+			m.opened(sector.SectorNumber, since)
+
 			if cfg.WaitDealsDelay > 0 {
-				timer := time.NewTimer(cfg.WaitDealsDelay)
+				timer := time.NewTimer(waitDealsDelay(cfg.WaitDealsDelay, since))
 				go func() {
 					<-timer.C
 					if err := m.StartPacking(sector.SectorNumber); err != nil {
@@ -421,6 +453,11 @@ func (m *Sealing) restartSectors(ctx context.Context) error {
 		}
 	}
 
+	if m.restored != nil {
+		m.restoreUpgrades(trackedSectors, m.restored.ToUpgrade)
+		m.restored = nil
+	}
+
 	// TODO: Grab on-chain sector set and diff with trackedSectors
 
 	return nil
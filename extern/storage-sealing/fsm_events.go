@@ -43,6 +43,15 @@ func (evt SectorFatalError) applyGlobal(state *SectorInfo) bool {
 	return true
 }
 
+// SectorPreCommitExpired is sent when the precommit of the sector expired on
+// chain before it was proven
+type SectorPreCommitExpired struct{}
+
+func (evt SectorPreCommitExpired) applyGlobal(state *SectorInfo) bool {
+	state.State = PreCommitExpired
+	return true
+}
+
 type SectorForceState struct {
 	State SectorState
 }
@@ -76,6 +85,16 @@ func (evt SectorStartCC) apply(state *SectorInfo) {
 	state.SectorType = evt.SectorType
 }
 
+type SectorStartExternal struct {
+	ID         abi.SectorNumber
+	SectorType abi.RegisteredSealProof
+}
+
+func (evt SectorStartExternal) apply(state *SectorInfo) {
+	state.SectorNumber = evt.ID
+	state.SectorType = evt.SectorType
+}
+
 type SectorAddPiece struct {
 	NewPiece Piece
 }
@@ -126,6 +145,22 @@ func (evt SectorPreCommit2) apply(state *SectorInfo) {
 	state.CommR = &commr
 }
 
+type SectorExternalSealed struct {
+	TicketValue abi.SealRandomness
+	TicketEpoch abi.ChainEpoch
+	Sealed      cid.Cid
+	Unsealed    cid.Cid
+}
+
+func (evt SectorExternalSealed) apply(state *SectorInfo) {
+	state.TicketValue = evt.TicketValue
+	state.TicketEpoch = evt.TicketEpoch
+	commd := evt.Unsealed
+	state.CommD = &commd
+	commr := evt.Sealed
+	state.CommR = &commr
+}
+
 type SectorPreCommitLanded struct {
 	TipSet TipSetToken
 }
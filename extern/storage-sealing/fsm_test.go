@@ -5,10 +5,16 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-statemachine"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 )
 
 func init() {
@@ -154,3 +160,86 @@ func TestPlanCommittingHandlesSectorCommitFailed(t *testing.T) {
 
 	require.Equal(t, CommitFailed, m.state.State)
 }
+
+func TestExternalPath(t *testing.T) {
+	ma, _ := address.NewIDAddress(55151)
+	m := test{
+		s: &Sealing{
+			maddr: ma,
+			stats: SectorStats{
+				bySector: map[abi.SectorID]statSectorState{},
+			},
+		},
+		t:     t,
+		state: &SectorInfo{},
+	}
+
+	m.planSingle(SectorStartExternal{ID: 4})
+	require.Equal(m.t, m.state.State, External)
+
+	m.planSingle(SectorAddPiece{NewPiece: Piece{Piece: abi.PieceInfo{Size: 2048}}})
+	require.Equal(m.t, m.state.State, External)
+	require.Len(m.t, m.state.Pieces, 1)
+
+	commR, commD := fakeCid(t, "r"), fakeCid(t, "d")
+	m.planSingle(SectorExternalSealed{TicketEpoch: 10, Sealed: commR, Unsealed: commD})
+	require.Equal(m.t, m.state.State, PreCommitting)
+	require.Equal(m.t, abi.ChainEpoch(10), m.state.TicketEpoch)
+	require.True(m.t, m.state.CommR.Equals(commR))
+	require.True(m.t, m.state.CommD.Equals(commD))
+}
+
+func TestPreCommitExpired(t *testing.T) {
+	ma, _ := address.NewIDAddress(55151)
+	m := test{
+		s: &Sealing{
+			maddr: ma,
+			stats: SectorStats{
+				bySector: map[abi.SectorID]statSectorState{},
+			},
+		},
+		t:     t,
+		state: &SectorInfo{State: CommitFailed},
+	}
+
+	m.planSingle(SectorPreCommitExpired{})
+	require.Equal(m.t, m.state.State, PreCommitExpired)
+
+	m.planSingle(SectorRemove{})
+	require.Equal(m.t, m.state.State, Removing)
+
+	m.planSingle(SectorRemoved{})
+	require.Equal(m.t, m.state.State, Removed)
+}
+
+func fakeCid(t *testing.T, s string) cid.Cid {
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.IDENTITY, MhLength: -1}.Sum([]byte(s))
+	require.NoError(t, err)
+	return c
+}
+
+func TestForensicsLog(t *testing.T) {
+	ma, _ := address.NewIDAddress(55151)
+	m := test{
+		s: &Sealing{
+			maddr: ma,
+			stats: SectorStats{
+				bySector: map[abi.SectorID]statSectorState{},
+			},
+		},
+		t:     t,
+		state: &SectorInfo{State: PreCommit1},
+	}
+
+	fe := &storiface.ForensicError{
+		Err:       xerrors.New("boom"),
+		Forensics: storiface.Forensics{Task: sealtasks.TTPreCommit1, Dmesg: "Xid 79"},
+	}
+	m.planSingle(SectorSealPreCommit1Failed{xerrors.Errorf("seal pre commit(1) failed: %w", fe)})
+	require.Equal(m.t, SealPreCommit1Failed, m.state.State)
+
+	require.Len(t, m.state.Log, 2)
+	require.Equal(t, "forensics;"+string(sealtasks.TTPreCommit1), m.state.Log[1].Kind)
+	require.Contains(t, m.state.Log[1].Message, "Xid 79")
+	require.Contains(t, m.state.Log[0].Trace, "boom")
+}
@@ -0,0 +1,106 @@
+package sealing
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-statemachine"
+	"golang.org/x/xerrors"
+)
+
+// preCommitExpiryInterval is how often sectors waiting for ProveCommit are
+// checked for expired precommits
+const preCommitExpiryInterval = 10 * time.Minute
+
+// states in which a sector may have a precommit on chain which wasn't proven
+// yet. Sectors in failure states retry (or are stuck) forever once the
+// precommit is gone, as the sector number stays allocated on chain.
+var awaitingProveCommit = map[SectorState]struct{}{
+	PreCommit1:           {},
+	PreCommit2:           {},
+	PreCommitting:        {},
+	PreCommitWait:        {},
+	WaitSeed:             {},
+	Committing:           {},
+	SubmitCommit:         {},
+	CommitWait:           {},
+	SealPreCommit1Failed: {},
+	SealPreCommit2Failed: {},
+	PreCommitFailed:      {},
+	ComputeProofFailed:   {},
+	CommitFailed:         {},
+}
+
+func (m *Sealing) watchPreCommitExpiry(ctx context.Context) {
+	t := time.NewTicker(preCommitExpiryInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := m.checkPreCommitExpiry(ctx); err != nil {
+				log.Warnf("checking for expired precommits: %+v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Sealing) checkPreCommitExpiry(ctx context.Context) error {
+	sectors, err := m.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	tok, _, err := m.api.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	for _, sector := range sectors {
+		if _, ok := awaitingProveCommit[sector.State]; !ok || sector.PreCommitTipSet == nil {
+			continue
+		}
+
+		expired, err := m.preCommitExpired(ctx, sector, tok)
+		if err != nil {
+			log.Warnf("checking precommit of sector %d: %+v", sector.SectorNumber, err)
+			continue
+		}
+		if !expired {
+			continue
+		}
+
+		if err := m.sectors.Send(uint64(sector.SectorNumber), SectorPreCommitExpired{}); err != nil {
+			log.Errorf("sending expired precommit event for sector %d: %+v", sector.SectorNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// preCommitExpired checks whether the precommit of a sector is gone from the
+// chain without the sector being proven, the miner actor cleans up expired
+// precommits, but keeps the sector number allocated
+func (m *Sealing) preCommitExpired(ctx context.Context, sector SectorInfo, tok TipSetToken) (bool, error) {
+	_, err := m.api.StateSectorPreCommitInfo(ctx, m.maddr, sector.SectorNumber, tok)
+	if err != ErrSectorAllocated {
+		// still precommitted, or never landed (reorg)
+		return false, err
+	}
+
+	si, err := m.api.StateSectorGetInfo(ctx, m.maddr, sector.SectorNumber, tok)
+	if err != nil {
+		return false, xerrors.Errorf("getting sector info: %w", err)
+	}
+
+	return si == nil, nil
+}
+
+func (m *Sealing) handlePreCommitExpired(ctx statemachine.Context, sector SectorInfo) error {
+	log.Errorw("precommit expired on chain before the sector was proven, removing sector", "sector", sector.SectorNumber, "lostDeposit", sector.PreCommitDeposit, "deals", sector.dealIDs())
+
+	// nothing to recover, the sector number can't be precommitted again
+	return ctx.Send(SectorRemove{})
+}
@@ -1,6 +1,10 @@
 package sealiface
 
-import "time"
+import (
+	"time"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
 
 // this has to be in a separate package to not make lotus API depend on filecoin-ffi
 
@@ -15,4 +19,11 @@ type Config struct {
 	MaxSealingSectorsForDeals uint64
 
 	WaitDealsDelay time.Duration
+
+	// cache trim levels for sectors without and with deals
+	CacheTrimCC    storiface.CacheTrimLevel
+	CacheTrimDeals storiface.CacheTrimLevel
+
+	// hold back commits for sectors to land in less loaded deadlines
+	CommitPlacement bool
 }
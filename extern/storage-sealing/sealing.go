@@ -20,6 +20,7 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/dline"
 	statemachine "github.com/filecoin-project/go-statemachine"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
@@ -51,6 +52,8 @@ type SealingAPI interface {
 	StateSectorPartition(ctx context.Context, maddr address.Address, sectorNumber abi.SectorNumber, tok TipSetToken) (*SectorLocation, error)
 	StateMinerSectorSize(context.Context, address.Address, TipSetToken) (abi.SectorSize, error)
 	StateMinerWorkerAddress(ctx context.Context, maddr address.Address, tok TipSetToken) (address.Address, error)
+	StateMinerProvingDeadline(ctx context.Context, maddr address.Address, tok TipSetToken) (*dline.Info, error)
+	StateMinerDeadlineLoads(ctx context.Context, maddr address.Address, tok TipSetToken) (*DeadlineLoads, error)
 	StateMinerPreCommitDepositForPower(context.Context, address.Address, miner.SectorPreCommitInfo, TipSetToken) (big.Int, error)
 	StateMinerInitialPledgeCollateral(context.Context, address.Address, miner.SectorPreCommitInfo, TipSetToken) (big.Int, error)
 	StateMarketStorageDeal(context.Context, abi.DealID, TipSetToken) (market.DealProposal, error)
@@ -82,6 +85,14 @@ type Sealing struct {
 	upgradeLk sync.Mutex
 	toUpgrade map[abi.SectorNumber]struct{}
 
+	openLk    sync.Mutex
+	openSince map[abi.SectorNumber]time.Time
+
+	restored *Checkpoint
+
+	externalLk sync.Mutex
+	external   map[abi.SectorNumber][]Piece
+
 	notifee SectorStateNotifee
 
 	stats SectorStats
@@ -123,6 +134,8 @@ func New(api SealingAPI, fc FeeConfig, events Events, maddr address.Address, ds
 		},
 
 		toUpgrade: map[abi.SectorNumber]struct{}{},
+		openSince: map[abi.SectorNumber]time.Time{},
+		external:  map[abi.SectorNumber][]Piece{},
 
 		notifee: notifee,
 
@@ -144,6 +157,8 @@ func (m *Sealing) Run(ctx context.Context) error {
 		return xerrors.Errorf("failed load sector states: %w", err)
 	}
 
+	go m.watchPreCommitExpiry(ctx)
+
 	return nil
 }
 
@@ -251,6 +266,7 @@ func (m *Sealing) StartPacking(sectorID abi.SectorNumber) error {
 	log.Infof("send Starting packing event success sector %d", sectorID)
 
 	delete(m.unsealedInfoMap.infos, sectorID)
+	m.closed(sectorID)
 
 	return nil
 }
@@ -275,6 +291,7 @@ func (m *Sealing) getSectorAndPadding(size abi.UnpaddedPieceSize) (abi.SectorNum
 		stored:     0,
 		pieceSizes: nil,
 	}
+	m.opened(ns, time.Now())
 
 	return ns, nil, nil
 }
@@ -5,6 +5,7 @@ type SectorState string
 var ExistSectorStateList = map[SectorState]struct{}{
 	Empty:                {},
 	WaitDeals:            {},
+	External:             {},
 	Packing:              {},
 	PreCommit1:           {},
 	PreCommit2:           {},
@@ -26,6 +27,7 @@ var ExistSectorStateList = map[SectorState]struct{}{
 	FinalizeFailed:       {},
 	DealsExpired:         {},
 	RecoverDealIDs:       {},
+	PreCommitExpired:     {},
 	Faulty:               {},
 	FaultReported:        {},
 	FaultedFinal:         {},
@@ -41,6 +43,7 @@ const (
 	Empty          SectorState = "Empty"
 	WaitDeals      SectorState = "WaitDeals"     // waiting for more pieces (deals) to be added to the sector
 	Packing        SectorState = "Packing"       // sector not in sealStore, and not on chain
+	External       SectorState = "External"      // sealed by an external orchestrator, waiting for its pieces and sealed files
 	PreCommit1     SectorState = "PreCommit1"    // do PreCommit1
 	PreCommit2     SectorState = "PreCommit2"    // do PreCommit2
 	PreCommitting  SectorState = "PreCommitting" // on chain pre-commit
@@ -62,6 +65,7 @@ const (
 	FinalizeFailed       SectorState = "FinalizeFailed"
 	DealsExpired         SectorState = "DealsExpired"
 	RecoverDealIDs       SectorState = "RecoverDealIDs"
+	PreCommitExpired     SectorState = "PreCommitExpired" // precommit expired on chain before the sector was proven, the deposit is lost
 
 	Faulty        SectorState = "Faulty"        // sector is corrupted or gone for some reason
 	FaultReported SectorState = "FaultReported" // sector has been declared as a fault on chain
@@ -74,7 +78,7 @@ const (
 
 func toStatState(st SectorState) statSectorState {
 	switch st {
-	case Empty, WaitDeals, Packing, PreCommit1, PreCommit2, PreCommitting, PreCommitWait, WaitSeed, Committing, CommitWait, FinalizeSector:
+	case Empty, WaitDeals, External, Packing, PreCommit1, PreCommit2, PreCommitting, PreCommitWait, WaitSeed, Committing, CommitWait, FinalizeSector:
 		return sstSealing
 	case Proving, Removed, Removing:
 		return sstProving
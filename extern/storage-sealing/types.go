@@ -13,6 +13,7 @@ import (
 	"github.com/filecoin-project/specs-storage/storage"
 
 	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 	"github.com/filecoin-project/lotus/extern/storage-sealing/sealiface"
 )
 
@@ -157,6 +158,30 @@ func (t *SectorInfo) sealingCtx(ctx context.Context) context.Context {
 	return ctx
 }
 
+// preCommit1Ctx is sealingCtx for PC1. PC1 of sectors without deals is
+// preemptible, so deal sectors don't wait for pledged sectors to seal.
+func (t *SectorInfo) preCommit1Ctx(ctx context.Context) context.Context {
+	if !t.hasDeals() {
+		ctx = sectorstorage.WithPreemptible(ctx)
+	}
+
+	return t.sealingCtx(ctx)
+}
+
+// finalizeCtx is sealingCtx for FinalizeSector, it carries the cache trim
+// level for the sector
+func (t *SectorInfo) finalizeCtx(ctx context.Context, cfg sealiface.Config) context.Context {
+	return sectorstorage.WithCacheTrim(t.sealingCtx(ctx), t.cacheTrimLevel(cfg))
+}
+
+// cacheTrimLevel is the configured cache trim level for the sector
+func (t *SectorInfo) cacheTrimLevel(cfg sealiface.Config) storiface.CacheTrimLevel {
+	if !t.hasDeals() {
+		return cfg.CacheTrimCC
+	}
+	return cfg.CacheTrimDeals
+}
+
 // Returns list of offset/length tuples of sector data ranges which clients
 // requested to keep unsealed
 func (t *SectorInfo) keepUnsealedRanges(invert bool) []storage.Range {
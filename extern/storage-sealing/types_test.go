@@ -9,6 +9,9 @@ import (
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/extern/storage-sealing/sealiface"
 )
 
 func TestSectorInfoSelialization(t *testing.T) {
@@ -68,3 +71,19 @@ func TestSectorInfoSelialization(t *testing.T) {
 	assert.Equal(t, si, si2)
 
 }
+
+func TestSectorInfoCacheTrimLevel(t *testing.T) {
+	cfg := sealiface.Config{
+		CacheTrimCC:    storiface.CacheTrimPoSt,
+		CacheTrimDeals: storiface.CacheTrimFull,
+	}
+
+	cc := &SectorInfo{Pieces: []Piece{{Piece: abi.PieceInfo{Size: 2048}}}}
+	assert.Equal(t, storiface.CacheTrimPoSt, cc.cacheTrimLevel(cfg))
+
+	deal := &SectorInfo{Pieces: []Piece{
+		{Piece: abi.PieceInfo{Size: 1024}, DealInfo: &DealInfo{DealID: 1}},
+		{Piece: abi.PieceInfo{Size: 1024}},
+	}}
+	assert.Equal(t, storiface.CacheTrimFull, deal.cacheTrimLevel(cfg))
+}
@@ -107,3 +107,24 @@ func (m *Sealing) maybeUpgradableSector() *abi.SectorNumber {
 
 	return nil
 }
+
+// restoreUpgrades marks checkpointed sectors for upgrade again, if they're
+// still committed-capacity sectors in Proving
+func (m *Sealing) restoreUpgrades(sectors []SectorInfo, toUpgrade []abi.SectorNumber) {
+	byNum := map[abi.SectorNumber]SectorInfo{}
+	for _, si := range sectors {
+		byNum[si.SectorNumber] = si
+	}
+
+	m.upgradeLk.Lock()
+	defer m.upgradeLk.Unlock()
+
+	for _, sn := range toUpgrade {
+		si, ok := byNum[sn]
+		if !ok || si.State != Proving || len(si.Pieces) != 1 || si.Pieces[0].DealInfo != nil {
+			log.Infow("not restoring upgrade of sector", "sector", sn)
+			continue
+		}
+		m.toUpgrade[sn] = struct{}{}
+	}
+}
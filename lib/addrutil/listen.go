@@ -0,0 +1,70 @@
+package addrutil
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/xerrors"
+)
+
+// ParseListenAddress parses an API listen address, given as a multiaddr, as
+// host:port, or as a port, which listens on localhost only
+func ParseListenAddress(s string) (ma.Multiaddr, error) {
+	if strings.HasPrefix(s, "/") {
+		return ma.NewMultiaddr(s)
+	}
+
+	if _, err := strconv.ParseUint(s, 10, 16); err == nil {
+		return ma.NewMultiaddr("/ip4/127.0.0.1/tcp/" + s)
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing listen address '%s': %w", s, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return nil, xerrors.Errorf("invalid port in listen address '%s'", s)
+	}
+
+	if host == "" {
+		return ma.NewMultiaddr("/ip4/0.0.0.0/tcp/" + port)
+	}
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return nil, xerrors.Errorf("listen address '%s' must have an IP address as host", s)
+	case ip.To4() != nil:
+		return ma.NewMultiaddr("/ip4/" + ip.String() + "/tcp/" + port)
+	default:
+		return ma.NewMultiaddr("/ip6/" + ip.String() + "/tcp/" + port)
+	}
+}
+
+// wss marks API endpoints served over TLS
+var wss = ma.StringCast("/wss")
+
+// WithTLS marks an API endpoint as served over TLS, so clients dial it with
+// wss:// and https://. Unix socket endpoints are served without TLS.
+func WithTLS(addr ma.Multiaddr) ma.Multiaddr {
+	if _, tls := SplitTLS(addr); tls {
+		return addr
+	}
+	if _, unix := UnixPath(addr); unix {
+		return addr
+	}
+	return addr.Encapsulate(wss)
+}
+
+// SplitTLS removes the /wss or /https component from an API endpoint,
+// returning whether it was present
+func SplitTLS(addr ma.Multiaddr) (ma.Multiaddr, bool) {
+	for _, p := range []int{ma.P_WSS, ma.P_HTTPS} {
+		if _, err := addr.ValueForProtocol(p); err == nil {
+			return addr.Decapsulate(ma.StringCast("/" + ma.ProtocolWithCode(p).Name)), true
+		}
+	}
+	return addr, false
+}
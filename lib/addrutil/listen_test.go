@@ -0,0 +1,86 @@
+package addrutil
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	for in, exp := range map[string]string{
+		"2345":                   "/ip4/127.0.0.1/tcp/2345",
+		"/ip4/10.0.0.1/tcp/2345": "/ip4/10.0.0.1/tcp/2345",
+		"/ip6/::/tcp/2345/http":  "/ip6/::/tcp/2345/http",
+		"10.0.0.1:2345":          "/ip4/10.0.0.1/tcp/2345",
+		"0.0.0.0:2345":           "/ip4/0.0.0.0/tcp/2345",
+		":2345":                  "/ip4/0.0.0.0/tcp/2345",
+		"[::1]:2345":             "/ip6/::1/tcp/2345",
+		"[2001:db8::1]:2345":     "/ip6/2001:db8::1/tcp/2345",
+	} {
+		a, err := ParseListenAddress(in)
+		require.NoError(t, err, in)
+		require.Equal(t, exp, a.String(), in)
+	}
+
+	for _, in := range []string{"", "localhost:2345", "10.0.0.1", "10.0.0.1:99999", "/foo"} {
+		_, err := ParseListenAddress(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestSplitTLS(t *testing.T) {
+	a, err := ParseListenAddress("10.0.0.1:2345")
+	require.NoError(t, err)
+
+	_, tls := SplitTLS(a)
+	require.False(t, tls)
+
+	w := WithTLS(a)
+	require.Equal(t, "/ip4/10.0.0.1/tcp/2345/wss", w.String())
+	require.Equal(t, w, WithTLS(w))
+
+	s, tls := SplitTLS(w)
+	require.True(t, tls)
+	require.Equal(t, a, s)
+
+	s, tls = SplitTLS(ma.StringCast("/ip4/10.0.0.1/tcp/2345/https"))
+	require.True(t, tls)
+	require.Equal(t, a, s)
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "addrutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	path := filepath.Join(dir, "api.sock")
+	a, err := ParseListenAddress("/unix" + path)
+	require.NoError(t, err)
+
+	p, unix := UnixPath(a)
+	require.True(t, unix)
+	require.Equal(t, path, p)
+
+	// sockets of nodes which didn't shut down are replaced
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	lst, err := Listen(a)
+	require.NoError(t, err)
+	defer lst.Close() //nolint:errcheck
+
+	st, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, UnixSocketMode, st.Mode().Perm())
+
+	// the socket is in use
+	_, err = Listen(a)
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package addrutil
+
+import (
+	"net"
+	"os"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"golang.org/x/xerrors"
+)
+
+// UnixSocketMode is the mode of API sockets, the token still has to be
+// presented, the socket is reachable by the group so workers can run as
+// another user
+var UnixSocketMode os.FileMode = 0660
+
+// UnixPath returns the socket path of a /unix API endpoint
+func UnixPath(addr ma.Multiaddr) (string, bool) {
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Listen listens on an API endpoint. For /unix endpoints a socket left behind
+// by a node which didn't shut down cleanly is removed first.
+func Listen(addr ma.Multiaddr) (manet.Listener, error) {
+	path, unix := UnixPath(addr)
+	if !unix {
+		return manet.Listen(addr)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	lst, err := manet.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, UnixSocketMode); err != nil {
+		_ = lst.Close()
+		return nil, xerrors.Errorf("setting socket permissions: %w", err)
+	}
+	return lst, nil
+}
+
+func removeStaleSocket(path string) error {
+	st, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case st.Mode()&os.ModeSocket == 0:
+		return xerrors.Errorf("%s exists and isn't a socket", path)
+	}
+
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = c.Close()
+		return xerrors.Errorf("%s is in use by another process", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,76 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	multisig0 "github.com/filecoin-project/specs-actors/actors/builtin/multisig"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// LoadActorFunc returns the actor at addr in the current chain head state
+type LoadActorFunc func(ctx context.Context, addr address.Address) (*types.Actor, error)
+
+// amount returns the funds moved by msg, its value and what it moves out of
+// the recipient actor: multisig proposals and miner and market withdrawals
+func (q *Queue) amount(ctx context.Context, msg *types.Message) abi.TokenAmount {
+	out := big.Zero()
+	if msg.Value.Int != nil {
+		out = msg.Value
+	}
+
+	moved, ok := q.movedFrom(ctx, msg)
+	if !ok || moved.Int == nil || moved.Sign() <= 0 {
+		return out
+	}
+	return big.Add(out, moved)
+}
+
+func (q *Queue) movedFrom(ctx context.Context, msg *types.Message) (abi.TokenAmount, bool) {
+	// the market actor is a singleton, no need to load it
+	if msg.To == builtin0.StorageMarketActorAddr {
+		if msg.Method != builtin0.MethodsMarket.WithdrawBalance {
+			return abi.TokenAmount{}, false
+		}
+		var params market0.WithdrawBalanceParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return abi.TokenAmount{}, false
+		}
+		return params.Amount, true
+	}
+
+	if msg.Method != builtin0.MethodsMultisig.Propose && msg.Method != builtin0.MethodsMiner.WithdrawBalance {
+		return abi.TokenAmount{}, false
+	}
+	if q.loadActor == nil {
+		return abi.TokenAmount{}, false
+	}
+	act, err := q.loadActor(ctx, msg.To)
+	if err != nil {
+		// not created yet, the message can't move more than its value
+		return abi.TokenAmount{}, false
+	}
+
+	switch {
+	case act.IsMultisigActor() && msg.Method == builtin0.MethodsMultisig.Propose:
+		var params multisig0.ProposeParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return abi.TokenAmount{}, false
+		}
+		return params.Value, true
+	case act.IsStorageMinerActor() && msg.Method == builtin0.MethodsMiner.WithdrawBalance:
+		var params miner0.WithdrawBalanceParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return abi.TokenAmount{}, false
+		}
+		return params.AmountRequested, true
+	}
+	return abi.TokenAmount{}, false
+}
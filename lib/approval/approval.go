@@ -0,0 +1,299 @@
+package approval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+)
+
+var log = logging.Logger("approval")
+
+// ErrPending is returned when a message was queued for approval instead of
+// being pushed
+var ErrPending = xerrors.New("message needs to be signed off by an approver")
+
+// ErrSignRefused is returned when an API caller asks the node to sign a
+// message which would otherwise be held for approval
+var ErrSignRefused = xerrors.New("messages needing approval can only be sent with MpoolPushMessage")
+
+// ErrExportRefused is returned when an API caller asks for a wallet key while
+// approvals are enabled
+var ErrExportRefused = xerrors.New("wallet keys can't be exported through the API while approvals are enabled")
+
+// ErrNotFound is returned for unknown or expired actions
+var ErrNotFound = xerrors.New("pending action not found")
+
+type requesterKey struct{}
+
+// Handler puts an identifier of the token a request was made with into the
+// request context. Only calls carrying a token are subject to approvals, the
+// identifier is recorded with held actions for operators to tell them apart.
+type Handler struct {
+	Next http.Handler
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.FormValue("token")
+	}
+	token = strings.TrimPrefix(token, "Bearer ")
+
+	if token != "" {
+		r = r.WithContext(WithRequester(r.Context(), TokenID(token)))
+	}
+
+	h.Next.ServeHTTP(w, r)
+}
+
+// TokenID returns the identifier of an API token
+func TokenID(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:8])
+}
+
+// WithRequester returns a context carrying the identifier of the token a
+// call was made with
+func WithRequester(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requesterKey{}, id)
+}
+
+// RequesterFromContext returns the token identifier carried by ctx
+func RequesterFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requesterKey{}).(string)
+	return id, ok && id != ""
+}
+
+type pending struct {
+	action api.PendingApproval
+	spec   *api.MessageSendSpec
+}
+
+// Queue holds messages pushed through the API which move at least Threshold,
+// counting funds they withdraw from multisig, miner or market actors, until one of the approvers signs their Payload, or they expire after
+// Timeout. Approvals are bound to the approver keys rather than to API
+// tokens, as anyone with an admin token can create more tokens. Pending
+// actions are kept in memory, so they are dropped when the node restarts.
+type Queue struct {
+	threshold abi.TokenAmount
+	timeout   time.Duration
+	approvers map[address.Address]struct{}
+	loadActor LoadActorFunc
+	now       func() time.Time
+
+	lk      sync.Mutex
+	next    uint64
+	pending map[uint64]*pending
+}
+
+// NewQueue creates an approval queue, a zero threshold disables it.
+// loadActor is used to tell multisig and miner actors apart, without it only
+// market withdrawals are counted in addition to message values.
+func NewQueue(threshold abi.TokenAmount, timeout time.Duration, approvers []address.Address, loadActor LoadActorFunc) *Queue {
+	q := &Queue{
+		threshold: threshold,
+		timeout:   timeout,
+		approvers: map[address.Address]struct{}{},
+		loadActor: loadActor,
+		now:       time.Now,
+		pending:   map[uint64]*pending{},
+	}
+	for _, a := range approvers {
+		q.approvers[a] = struct{}{}
+	}
+	return q
+}
+
+func (q *Queue) enabled() bool {
+	return q != nil && q.threshold.Int != nil && !q.threshold.IsZero()
+}
+
+// needsApproval returns whether msg would be held when sent with ctx
+func (q *Queue) needsApproval(ctx context.Context, msg *types.Message) bool {
+	if !q.enabled() {
+		return false
+	}
+	if _, ok := RequesterFromContext(ctx); !ok {
+		return false
+	}
+	return !q.amount(ctx, msg).LessThan(q.threshold)
+}
+
+// CheckSignMessage refuses signing messages for API callers which would be
+// held if they were pushed with MpoolPushMessage, so that the signed message
+// can't be sent with MpoolPush instead
+func (q *Queue) CheckSignMessage(ctx context.Context, msg *types.Message) error {
+	if q.needsApproval(ctx, msg) {
+		return xerrors.Errorf("signing message moving %s: %w", types.FIL(q.amount(ctx, msg)), ErrSignRefused)
+	}
+	return nil
+}
+
+// CheckSign refuses signing raw data for API callers when it looks like a
+// message CID, which is what message signatures are made over
+func (q *Queue) CheckSign(ctx context.Context, data []byte) error {
+	if !q.enabled() {
+		return nil
+	}
+	if _, ok := RequesterFromContext(ctx); !ok {
+		return nil
+	}
+
+	c, err := cid.Cast(data)
+	if err != nil || c.Prefix().Codec != cid.DagCBOR || c.Prefix().MhType != multihash.BLAKE2B_MIN+31 {
+		return nil
+	}
+	return xerrors.Errorf("signing raw CID %s: %w", c, ErrSignRefused)
+}
+
+// CheckExport refuses exporting wallet keys for API callers while approvals
+// are enabled, as an exported key signs messages without approval
+func (q *Queue) CheckExport(ctx context.Context) error {
+	if !q.enabled() {
+		return nil
+	}
+	if _, ok := RequesterFromContext(ctx); !ok {
+		return nil
+	}
+	return ErrExportRefused
+}
+
+// Hold queues msg when it needs approval, it returns the ID of the pending
+// action and true in that case. Calls not made through the API (without a
+// token in ctx) are never held.
+func (q *Queue) Hold(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (uint64, bool) {
+	if !q.needsApproval(ctx, msg) {
+		return 0, false
+	}
+	requester, _ := RequesterFromContext(ctx)
+
+	blk, err := msg.ToStorageBlock()
+	if err != nil {
+		// can't be signed either, pushing it fails
+		return 0, false
+	}
+
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	q.expire()
+
+	q.next++
+	now := q.now()
+	cp := *msg
+	p := &pending{
+		action: api.PendingApproval{
+			ID:        q.next,
+			Requester: requester,
+			Message:   &cp,
+			Created:   now,
+			Expires:   now.Add(q.timeout),
+		},
+		spec: spec,
+	}
+	p.action.Payload = payload(&p.action, blk.Cid())
+	q.pending[q.next] = p
+
+	log.Infow("message queued for approval", "id", q.next, "from", msg.From, "to", msg.To, "value", types.FIL(msg.Value), "moves", types.FIL(q.amount(ctx, msg)), "requester", requester)
+	return q.next, true
+}
+
+// payload binds an approval to the action and the exact message it sends
+func payload(a *api.PendingApproval, mcid cid.Cid) []byte {
+	return []byte(fmt.Sprintf("lotus message approval: action %d at %d, message %s",
+		a.ID, a.Created.Unix(), mcid))
+}
+
+// Take removes an action from the queue for it to be executed, sig must be a
+// signature of one of the approvers over the Payload of the action
+func (q *Queue) Take(id uint64, approver address.Address, sig *crypto.Signature) (*types.Message, *api.MessageSendSpec, error) {
+	if _, ok := q.approvers[approver]; !ok {
+		return nil, nil, xerrors.Errorf("%s is not a configured approver", approver)
+	}
+	if sig == nil {
+		return nil, nil, xerrors.New("approving actions requires a signature")
+	}
+
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	q.expire()
+
+	p, ok := q.pending[id]
+	if !ok {
+		return nil, nil, xerrors.Errorf("action %d: %w", id, ErrNotFound)
+	}
+	if err := sigs.Verify(sig, approver, p.action.Payload); err != nil {
+		return nil, nil, xerrors.Errorf("action %d: invalid approval signature: %w", id, err)
+	}
+	delete(q.pending, id)
+
+	log.Infow("message approved", "id", id, "requester", p.action.Requester, "approver", approver)
+	return p.action.Message, p.spec, nil
+}
+
+// Reject drops a pending action
+func (q *Queue) Reject(ctx context.Context, id uint64) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	q.expire()
+
+	if _, ok := q.pending[id]; !ok {
+		return xerrors.Errorf("action %d: %w", id, ErrNotFound)
+	}
+	delete(q.pending, id)
+
+	log.Infow("message rejected", "id", id)
+	return nil
+}
+
+// List returns the pending actions, oldest first
+func (q *Queue) List() []api.PendingApproval {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	q.expire()
+
+	out := make([]api.PendingApproval, 0, len(q.pending))
+	for _, p := range q.pending {
+		a := p.action
+		cp := *a.Message
+		a.Message = &cp
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// must be called with lk held
+func (q *Queue) expire() {
+	now := q.now()
+	for id, p := range q.pending {
+		if now.After(p.action.Expires) {
+			log.Warnw("pending action expired without approval", "id", id, "value", types.FIL(p.action.Message.Value))
+			delete(q.pending, id)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package approval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	multisig0 "github.com/filecoin-project/specs-actors/actors/builtin/multisig"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+)
+
+func newKey(t *testing.T) ([]byte, address.Address) {
+	pk, err := sigs.Generate(crypto.SigTypeSecp256k1)
+	require.NoError(t, err)
+	pub, err := sigs.ToPublic(crypto.SigTypeSecp256k1, pk)
+	require.NoError(t, err)
+	addr, err := address.NewSecp256k1Address(pub)
+	require.NoError(t, err)
+	return pk, addr
+}
+
+func testMessage(t *testing.T, value int64) *types.Message {
+	from, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	to, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	return &types.Message{From: from, To: to, Value: abi.NewTokenAmount(value)}
+}
+
+func TestQueue(t *testing.T) {
+	approverKey, approver := newKey(t)
+	otherKey, other := newKey(t)
+
+	now := time.Unix(1600000000, 0)
+	q := NewQueue(abi.NewTokenAmount(10), time.Hour, []address.Address{approver}, nil)
+	q.now = func() time.Time { return now }
+
+	alice := WithRequester(context.Background(), TokenID("alice"))
+
+	msg := testMessage(t, 9)
+	_, held := q.Hold(alice, msg, nil)
+	require.False(t, held, "below threshold")
+
+	msg = testMessage(t, 10)
+	_, held = q.Hold(context.Background(), msg, nil)
+	require.False(t, held, "not called through the API")
+
+	id, held := q.Hold(alice, msg, nil)
+	require.True(t, held)
+	pending := q.List()
+	require.Len(t, pending, 1)
+	require.NotEmpty(t, pending[0].Payload)
+
+	// a second API token is not an approval
+	_, _, err := q.Take(id, other, nil)
+	require.Error(t, err, "not an approver")
+
+	sig, err := sigs.Sign(crypto.SigTypeSecp256k1, otherKey, pending[0].Payload)
+	require.NoError(t, err)
+	_, _, err = q.Take(id, approver, sig)
+	require.Error(t, err, "signed by another key")
+
+	sig, err = sigs.Sign(crypto.SigTypeSecp256k1, approverKey, []byte("something else"))
+	require.NoError(t, err)
+	_, _, err = q.Take(id, approver, sig)
+	require.Error(t, err, "signature over something else")
+	require.Len(t, q.List(), 1)
+
+	sig, err = sigs.Sign(crypto.SigTypeSecp256k1, approverKey, pending[0].Payload)
+	require.NoError(t, err)
+	got, _, err := q.Take(id, approver, sig)
+	require.NoError(t, err)
+	require.Equal(t, msg.Value, got.Value)
+	require.Empty(t, q.List())
+
+	_, _, err = q.Take(id, approver, sig)
+	require.True(t, xerrors.Is(err, ErrNotFound))
+
+	id, _ = q.Hold(alice, msg, nil)
+	now = now.Add(time.Hour + time.Second)
+	_, _, err = q.Take(id, approver, sig)
+	require.True(t, xerrors.Is(err, ErrNotFound), "expired")
+}
+
+func TestCheckSign(t *testing.T) {
+	_, approver := newKey(t)
+	q := NewQueue(abi.NewTokenAmount(10), time.Hour, []address.Address{approver}, nil)
+
+	alice := WithRequester(context.Background(), TokenID("alice"))
+	msg := testMessage(t, 10)
+
+	require.True(t, xerrors.Is(q.CheckSignMessage(alice, msg), ErrSignRefused))
+	require.NoError(t, q.CheckSignMessage(context.Background(), msg), "not called through the API")
+	require.NoError(t, q.CheckSignMessage(alice, testMessage(t, 9)))
+
+	// message signatures are over the message CID
+	require.True(t, xerrors.Is(q.CheckSign(alice, msg.Cid().Bytes()), ErrSignRefused))
+	require.NoError(t, q.CheckSign(alice, []byte("deal proposal bytes")))
+	require.NoError(t, q.CheckSign(context.Background(), msg.Cid().Bytes()))
+
+	require.True(t, xerrors.Is(q.CheckExport(alice), ErrExportRefused))
+	require.NoError(t, q.CheckExport(context.Background()), "not called through the API")
+}
+
+func TestQueueWithdrawals(t *testing.T) {
+	_, approver := newKey(t)
+
+	msigAddr, err := address.NewIDAddress(2000)
+	require.NoError(t, err)
+	minerAddr, err := address.NewIDAddress(2001)
+	require.NoError(t, err)
+	accountAddr, err := address.NewIDAddress(2002)
+	require.NoError(t, err)
+
+	codes := map[address.Address]*types.Actor{
+		msigAddr:    {Code: builtin0.MultisigActorCodeID},
+		minerAddr:   {Code: builtin0.StorageMinerActorCodeID},
+		accountAddr: {Code: builtin0.AccountActorCodeID},
+	}
+	q := NewQueue(abi.NewTokenAmount(10), time.Hour, []address.Address{approver}, func(ctx context.Context, addr address.Address) (*types.Actor, error) {
+		act, ok := codes[addr]
+		if !ok {
+			return nil, xerrors.New("actor not found")
+		}
+		return act, nil
+	})
+
+	alice := WithRequester(context.Background(), TokenID("alice"))
+
+	call := func(to address.Address, method abi.MethodNum, params cbg.CBORMarshaler) *types.Message {
+		msg := testMessage(t, 0)
+		msg.To = to
+		msg.Method = method
+		enc, aerr := actors.SerializeParams(params)
+		require.NoError(t, aerr)
+		msg.Params = enc
+		return msg
+	}
+
+	propose := func(value int64) *types.Message {
+		return call(msigAddr, builtin0.MethodsMultisig.Propose, &multisig0.ProposeParams{To: accountAddr, Value: abi.NewTokenAmount(value)})
+	}
+	minerWithdraw := func(value int64) *types.Message {
+		return call(minerAddr, builtin0.MethodsMiner.WithdrawBalance, &miner0.WithdrawBalanceParams{AmountRequested: abi.NewTokenAmount(value)})
+	}
+	marketWithdraw := func(value int64) *types.Message {
+		return call(builtin0.StorageMarketActorAddr, builtin0.MethodsMarket.WithdrawBalance, &market0.WithdrawBalanceParams{ProviderOrClientAddress: minerAddr, Amount: abi.NewTokenAmount(value)})
+	}
+
+	for name, msg := range map[string]*types.Message{
+		"multisig propose": propose(10),
+		"miner withdraw":   minerWithdraw(10),
+		"market withdraw":  marketWithdraw(10),
+	} {
+		_, held := q.Hold(alice, msg, nil)
+		require.True(t, held, name)
+		require.True(t, xerrors.Is(q.CheckSignMessage(alice, msg), ErrSignRefused), name)
+	}
+
+	for name, msg := range map[string]*types.Message{
+		"multisig propose below threshold": propose(9),
+		"miner withdraw below threshold":   minerWithdraw(9),
+		"market withdraw below threshold":  marketWithdraw(9),
+		"propose method on an account":     call(accountAddr, builtin0.MethodsMultisig.Propose, &multisig0.ProposeParams{To: accountAddr, Value: abi.NewTokenAmount(10)}),
+	} {
+		_, held := q.Hold(alice, msg, nil)
+		require.False(t, held, name)
+	}
+
+	// the value of the message counts too
+	msg := propose(5)
+	msg.Value = abi.NewTokenAmount(5)
+	_, held := q.Hold(alice, msg, nil)
+	require.True(t, held)
+}
+
+func TestQueueDisabled(t *testing.T) {
+	q := NewQueue(abi.NewTokenAmount(0), time.Hour, nil, nil)
+
+	ctx := WithRequester(context.Background(), "a")
+	msg := testMessage(t, 1000)
+	_, held := q.Hold(ctx, msg, nil)
+	require.False(t, held)
+	require.NoError(t, q.CheckSignMessage(ctx, msg))
+	require.NoError(t, q.CheckSign(ctx, msg.Cid().Bytes()))
+	require.NoError(t, q.CheckExport(ctx))
+}
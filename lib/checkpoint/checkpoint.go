@@ -0,0 +1,167 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+)
+
+var log = logging.Logger("checkpoint")
+
+var dsPrefix = datastore.NewKey("/checkpoints")
+
+// Snapshot returns the in-memory state of a subsystem, it must be JSON
+// serializable and cheap to take
+type Snapshot func() (interface{}, error)
+
+type record struct {
+	Time time.Time
+	Data json.RawMessage
+}
+
+// Checkpointer persists snapshots of state subsystems only keep in memory,
+// periodically and on shutdown, so a restart doesn't have to re-derive it.
+// A failing or panicking snapshot only skips that subsystem.
+type Checkpointer struct {
+	ds       datastore.Batching
+	interval time.Duration
+
+	lk   sync.Mutex
+	subs map[string]Snapshot
+
+	saveLk sync.Mutex
+	last   map[string][]byte
+}
+
+// New creates a checkpointer, interval 0 only writes checkpoints on shutdown
+func New(ds datastore.Batching, interval time.Duration) *Checkpointer {
+	return &Checkpointer{
+		ds:       namespace.Wrap(ds, dsPrefix),
+		interval: interval,
+		subs:     map[string]Snapshot{},
+		last:     map[string][]byte{},
+	}
+}
+
+// Register adds a subsystem, replacing any snapshot registered under the name
+func (c *Checkpointer) Register(name string, snap Snapshot) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.subs[name] = snap
+}
+
+// Load decodes the last checkpoint of a subsystem into out, and returns when
+// it was taken. It returns false when there is none.
+func (c *Checkpointer) Load(name string, out interface{}) (time.Time, bool, error) {
+	b, err := c.ds.Get(datastore.NewKey(name))
+	if err == datastore.ErrNotFound {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, xerrors.Errorf("getting checkpoint %s: %w", name, err)
+	}
+
+	var rec record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return time.Time{}, false, xerrors.Errorf("decoding checkpoint %s: %w", name, err)
+	}
+	if err := json.Unmarshal(rec.Data, out); err != nil {
+		return time.Time{}, false, xerrors.Errorf("decoding checkpoint %s data: %w", name, err)
+	}
+
+	return rec.Time, true, nil
+}
+
+func (c *Checkpointer) Run(ctx context.Context) error {
+	if c.interval <= 0 {
+		return nil
+	}
+
+	t := build.Clock.Ticker(c.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			c.SaveAll()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Stop writes the shutdown checkpoints
+func (c *Checkpointer) Stop(context.Context) error {
+	c.SaveAll()
+	return nil
+}
+
+// SaveAll checkpoints every registered subsystem
+func (c *Checkpointer) SaveAll() {
+	c.lk.Lock()
+	names := make([]string, 0, len(c.subs))
+	subs := make(map[string]Snapshot, len(c.subs))
+	for name, snap := range c.subs {
+		names = append(names, name)
+		subs[name] = snap
+	}
+	c.lk.Unlock()
+	sort.Strings(names)
+
+	c.saveLk.Lock()
+	defer c.saveLk.Unlock()
+
+	for _, name := range names {
+		if err := c.save(name, subs[name]); err != nil {
+			log.Errorw("checkpointing subsystem", "subsystem", name, "error", err)
+		}
+	}
+}
+
+// must be called with c.saveLk held
+func (c *Checkpointer) save(name string, snap Snapshot) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = xerrors.Errorf("snapshot panicked: %v", r)
+		}
+	}()
+
+	v, err := snap()
+	if err != nil {
+		return xerrors.Errorf("taking snapshot: %w", err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return xerrors.Errorf("encoding snapshot: %w", err)
+	}
+	if bytes.Equal(data, c.last[name]) {
+		return nil
+	}
+
+	b, err := json.Marshal(record{
+		Time: build.Clock.Now(),
+		Data: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.ds.Put(datastore.NewKey(name), b); err != nil {
+		return xerrors.Errorf("writing checkpoint: %w", err)
+	}
+	c.last[name] = data
+
+	return nil
+}
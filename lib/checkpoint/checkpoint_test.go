@@ -0,0 +1,54 @@
+package checkpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type testState struct {
+	Counter int
+	Names   []string
+}
+
+func TestCheckpoints(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+
+	cp := New(ds, 0)
+
+	state := testState{Counter: 1, Names: []string{"a"}}
+	cp.Register("good", func() (interface{}, error) {
+		return state, nil
+	})
+	cp.Register("panics", func() (interface{}, error) {
+		panic("broken")
+	})
+	cp.Register("fails", func() (interface{}, error) {
+		return nil, xerrors.New("broken")
+	})
+
+	cp.SaveAll()
+
+	state.Counter = 2
+	require.NoError(t, cp.Stop(context.Background()))
+
+	// a restarted node loads the last checkpoint
+	cp = New(ds, 0)
+	var out testState
+	at, ok, err := cp.Load("good", &out)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, at.IsZero())
+	require.Equal(t, 2, out.Counter)
+	require.Equal(t, []string{"a"}, out.Names)
+
+	for _, name := range []string{"panics", "fails", "missing"} {
+		_, ok, err = cp.Load(name, &out)
+		require.NoError(t, err)
+		require.False(t, ok, name)
+	}
+}
@@ -0,0 +1,323 @@
+package commp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/pieceio"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
+)
+
+var log = logging.Logger("commp")
+
+var dsPrefix = datastore.NewKey("/commp")
+
+const (
+	// maxQueued computations wait for a worker, more are rejected
+	maxQueued = 1024
+	// maxFinished jobs are listed by Jobs, older ones are only in the cache
+	maxFinished = 256
+)
+
+const (
+	StateQueued    = "queued"
+	StateComputing = "computing"
+	StateDone      = "done"
+	StateFailed    = "failed"
+)
+
+// Compute calculates the piece commitment of a file
+func Compute(path string) (cid.Cid, abi.UnpaddedPieceSize, error) {
+	// Hard-code the sector size to 32GiB, because:
+	// - pieceio.GeneratePieceCommitment requires a RegisteredSealProof
+	// - commP itself is sector-size independent, with rather low probability of that changing
+	//   ( note how the final rust call is identical for every RegSP type )
+	//   https://github.com/filecoin-project/rust-filecoin-proofs-api/blob/v5.0.0/src/seal.rs#L1040-L1050
+	//
+	// IF/WHEN this changes in the future we will have to be able to calculate
+	// "old style" commP, and thus will need to introduce a version switch or similar
+	arbitrarySectorSize := abi.SectorSize(32 << 30)
+
+	rt, err := ffiwrapper.SealProofTypeFromSectorSize(arbitrarySectorSize)
+	if err != nil {
+		return cid.Undef, 0, xerrors.Errorf("bad sector size: %w", err)
+	}
+
+	rdr, err := os.Open(path)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	defer rdr.Close() //nolint:errcheck
+
+	stat, err := rdr.Stat()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+
+	commP, pieceSize, err := pieceio.GeneratePieceCommitment(rt, rdr, uint64(stat.Size()))
+	if err != nil {
+		return cid.Undef, 0, xerrors.Errorf("computing commP failed: %w", err)
+	}
+
+	return commP, pieceSize, nil
+}
+
+// cached is the result stored for a file, valid while the file has the same
+// size and modification time
+type cached struct {
+	Size    int64
+	ModTime time.Time
+
+	Root      cid.Cid
+	PieceSize abi.UnpaddedPieceSize
+}
+
+type job struct {
+	st      api.CommPJob
+	size    int64
+	modTime time.Time
+
+	done chan struct{}
+}
+
+// Calc computes piece commitments of files in the background, with a fixed
+// number of workers. Results are cached in the datastore, so a file prepared
+// ahead of a deal proposal isn't read again when the deal is made.
+type Calc struct {
+	ds      datastore.Batching
+	workers int
+	compute func(path string) (cid.Cid, abi.UnpaddedPieceSize, error)
+
+	queue chan *job
+
+	lk   sync.Mutex
+	jobs map[string]*job
+}
+
+func New(ds datastore.Batching, workers int) *Calc {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &Calc{
+		ds:      namespace.Wrap(ds, dsPrefix),
+		workers: workers,
+		compute: Compute,
+
+		queue: make(chan *job, maxQueued),
+		jobs:  map[string]*job{},
+	}
+}
+
+// Run starts the workers, they stop when ctx is cancelled
+func (c *Calc) Run(ctx context.Context) {
+	for i := 0; i < c.workers; i++ {
+		go c.worker(ctx)
+	}
+}
+
+// Queue schedules the computation for a file, unless the result is cached or
+// the file is already queued. It returns the state of the job.
+func (c *Calc) Queue(path string) (api.CommPJob, error) {
+	j, err := c.queueJob(path)
+	if err != nil {
+		return api.CommPJob{}, err
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return j.st, nil
+}
+
+// Wait queues the computation for a file and waits for the result
+func (c *Calc) Wait(ctx context.Context, path string) (*api.CommPRet, error) {
+	j, err := c.queueJob(path)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if j.st.Error != "" {
+		return nil, xerrors.New(j.st.Error)
+	}
+	return j.st.Result, nil
+}
+
+// Jobs lists the queued, running and recently finished computations
+func (c *Calc) Jobs() []api.CommPJob {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	out := make([]api.CommPJob, 0, len(c.jobs))
+	for _, j := range c.jobs {
+		out = append(out, j.st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Queued.Before(out[j].Queued)
+	})
+	return out
+}
+
+func (c *Calc) queueJob(path string) (*job, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, xerrors.Errorf("%s is a directory", path)
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if j, ok := c.jobs[path]; ok && j.st.State != StateFailed && j.size == st.Size() && j.modTime.Equal(st.ModTime()) {
+		return j, nil
+	}
+
+	now := time.Now()
+	j := &job{
+		st: api.CommPJob{
+			Path:   path,
+			State:  StateQueued,
+			Queued: now,
+		},
+		size:    st.Size(),
+		modTime: st.ModTime(),
+		done:    make(chan struct{}),
+	}
+
+	res, err := c.cached(path)
+	if err != nil {
+		log.Warnw("reading cached commP", "path", path, "error", err)
+	}
+	if res != nil && res.Size == j.size && res.ModTime.Equal(j.modTime) {
+		j.st.State = StateDone
+		j.st.Cached = true
+		j.st.Finished = now
+		j.st.Result = &api.CommPRet{Root: res.Root, Size: res.PieceSize}
+		close(j.done)
+	} else {
+		select {
+		case c.queue <- j:
+		default:
+			return nil, xerrors.Errorf("commP queue full (%d files)", maxQueued)
+		}
+	}
+
+	c.jobs[path] = j
+	c.pruneJobs()
+	return j, nil
+}
+
+func (c *Calc) worker(ctx context.Context) {
+	for {
+		var j *job
+		select {
+		case j = <-c.queue:
+		case <-ctx.Done():
+			return
+		}
+
+		c.lk.Lock()
+		j.st.State = StateComputing
+		j.st.Started = time.Now()
+		c.lk.Unlock()
+
+		root, size, err := c.compute(j.st.Path)
+
+		c.lk.Lock()
+		j.st.Finished = time.Now()
+		if err != nil {
+			j.st.State = StateFailed
+			j.st.Error = err.Error()
+		} else {
+			j.st.State = StateDone
+			j.st.Result = &api.CommPRet{Root: root, Size: size}
+
+			if err := c.store(j.st.Path, cached{Size: j.size, ModTime: j.modTime, Root: root, PieceSize: size}); err != nil {
+				log.Warnw("caching commP", "path", j.st.Path, "error", err)
+			}
+		}
+		c.lk.Unlock()
+
+		close(j.done)
+
+		log.Infow("computed commP", "path", j.st.Path, "took", j.st.Finished.Sub(j.st.Started), "error", err)
+	}
+}
+
+// pruneJobs drops the oldest finished jobs, must be called with c.lk held
+func (c *Calc) pruneJobs() {
+	var finished []*job
+	for _, j := range c.jobs {
+		if j.st.State == StateDone || j.st.State == StateFailed {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].st.Finished.Before(finished[j].st.Finished)
+	})
+	for _, j := range finished[:len(finished)-maxFinished] {
+		delete(c.jobs, j.st.Path)
+	}
+}
+
+func (c *Calc) cached(path string) (*cached, error) {
+	b, err := c.ds.Get(pathKey(path))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res cached
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, xerrors.Errorf("decoding cached commP: %w", err)
+	}
+	return &res, nil
+}
+
+func (c *Calc) store(path string, res cached) error {
+	b, err := json.Marshal(&res)
+	if err != nil {
+		return err
+	}
+	return c.ds.Put(pathKey(path), b)
+}
+
+func pathKey(path string) datastore.Key {
+	return datastore.NewKey(base64.RawURLEncoding.EncodeToString([]byte(path)))
+}
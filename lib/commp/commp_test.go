@@ -0,0 +1,77 @@
+package commp
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+func TestCalcCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	path := filepath.Join(dir, "data")
+	require.NoError(t, ioutil.WriteFile(path, []byte("deal data"), 0644))
+
+	someCid, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+
+	var computed int64
+	fake := func(path string) (cid.Cid, abi.UnpaddedPieceSize, error) {
+		atomic.AddInt64(&computed, 1)
+		return someCid, 127, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	c := New(ds, 2)
+	c.compute = fake
+	c.Run(ctx)
+
+	ret, err := c.Wait(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, someCid, ret.Root)
+	require.Equal(t, abi.UnpaddedPieceSize(127), ret.Size)
+
+	j, err := c.Queue(path)
+	require.NoError(t, err)
+	require.Equal(t, StateDone, j.State)
+	require.Equal(t, int64(1), atomic.LoadInt64(&computed))
+
+	// results survive restarts
+	c = New(ds, 2)
+	c.compute = fake
+	c.Run(ctx)
+
+	j, err = c.Queue(path)
+	require.NoError(t, err)
+	require.Equal(t, StateDone, j.State)
+	require.True(t, j.Cached)
+	require.Equal(t, int64(1), atomic.LoadInt64(&computed))
+
+	// changed files are calculated again
+	require.NoError(t, ioutil.WriteFile(path, []byte("more deal data"), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+
+	_, err = c.Wait(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), atomic.LoadInt64(&computed))
+	require.Len(t, c.Jobs(), 1)
+
+	_, err = c.Queue(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
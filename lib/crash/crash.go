@@ -0,0 +1,228 @@
+package crash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/build"
+)
+
+var log = logging.Logger("crash")
+
+// Config controls recovery of background subsystems, see Run
+type Config struct {
+	// Dir receives crash bundles, no bundles are written when empty
+	Dir string
+	// Restart subsystems which panicked; errors are always retried
+	Restart bool
+	// MaxBackoff limits the delay between restarts
+	MaxBackoff time.Duration
+	// Keep is the number of crash bundles kept in Dir
+	Keep int
+}
+
+var (
+	cfgLk sync.Mutex
+	cfg   = Config{
+		Restart:    true,
+		MaxBackoff: 5 * time.Minute,
+	}
+)
+
+// Configure sets the process-wide recovery config
+func Configure(c Config) error {
+	if c.Dir != "" {
+		if err := os.MkdirAll(c.Dir, 0755); err != nil {
+			return xerrors.Errorf("creating crash bundle directory: %w", err)
+		}
+	}
+
+	cfgLk.Lock()
+	defer cfgLk.Unlock()
+
+	cfg = c
+	return nil
+}
+
+func getConfig() Config {
+	cfgLk.Lock()
+	defer cfgLk.Unlock()
+
+	return cfg
+}
+
+// Info is stored as info.json in every crash bundle
+type Info struct {
+	Subsystem string
+	Time      time.Time
+	Version   string
+	GoVersion string
+	Panic     string
+	Restarts  int
+}
+
+// panicErr is returned by guarded when fn panicked
+type panicErr struct {
+	val   interface{}
+	stack []byte
+}
+
+func (p *panicErr) Error() string {
+	return fmt.Sprintf("panic: %v", p.val)
+}
+
+var minBackoff = time.Second
+
+// Run runs fn until it returns nil or ctx is cancelled. When fn returns an
+// error, or panics, it's restarted with exponential backoff. Panics are
+// recorded in a crash bundle; with restarts disabled a panic stops the
+// subsystem after the bundle is written.
+//
+// The health of the subsystem is listed by Tasks, fn can report progress
+// with Success and Failure.
+func Run(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	st := startTask(name)
+	defer st.exit()
+	ctx = context.WithValue(ctx, taskKey{}, st)
+
+	backoff := minBackoff
+
+	for restarts := 0; ; restarts++ {
+		start := time.Now()
+		err := guarded(ctx, fn)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		st.failed(err, true)
+		c := getConfig()
+
+		if pe, ok := err.(*panicErr); ok {
+			log.Errorw("subsystem panicked", "subsystem", name, "panic", pe.val, "restarts", restarts)
+			if path, err := writeBundle(c, name, pe, restarts); err != nil {
+				log.Errorf("writing crash bundle: %+v", err)
+			} else if path != "" {
+				log.Errorw("wrote crash bundle", "subsystem", name, "path", path)
+			}
+
+			if !c.Restart {
+				log.Errorw("not restarting subsystem", "subsystem", name)
+				return
+			}
+		} else {
+			log.Errorw("subsystem failed", "subsystem", name, "error", err, "restarts", restarts)
+		}
+
+		// a long healthy run resets the backoff
+		if time.Since(start) > c.MaxBackoff {
+			backoff = minBackoff
+		}
+
+		log.Warnw("restarting subsystem", "subsystem", name, "in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if c.MaxBackoff > 0 && backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+func guarded(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicErr{val: r, stack: debug.Stack()}
+		}
+	}()
+
+	return fn(ctx)
+}
+
+func writeBundle(c Config, name string, pe *panicErr, restarts int) (string, error) {
+	if c.Dir == "" {
+		return "", nil
+	}
+
+	now := time.Now()
+	dir := filepath.Join(c.Dir, strconv.FormatInt(now.UnixNano(), 10)+"-"+name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	info, err := json.MarshalIndent(&Info{
+		Subsystem: name,
+		Time:      now,
+		Version:   build.UserVersion(),
+		GoVersion: runtime.Version(),
+		Panic:     fmt.Sprint(pe.val),
+		Restarts:  restarts,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "info.json"), info, 0644); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "stack.txt"), pe.stack, 0644); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "goroutines.txt"))
+	if err != nil {
+		return "", err
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	prune(c)
+
+	return dir, nil
+}
+
+func prune(c Config) {
+	if c.Keep <= 0 {
+		return
+	}
+
+	ents, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		log.Errorf("listing crash bundles: %+v", err)
+		return
+	}
+
+	// names start with a timestamp, so name order is age order
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+
+	for len(ents) > c.Keep {
+		if err := os.RemoveAll(filepath.Join(c.Dir, ents[0].Name())); err != nil {
+			log.Errorf("removing crash bundle: %+v", err)
+		}
+		ents = ents[1:]
+	}
+}
@@ -0,0 +1,89 @@
+package crash
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	minBackoff = time.Millisecond
+	require.NoError(t, Configure(Config{Dir: dir, Restart: true, MaxBackoff: 10 * time.Millisecond, Keep: 2}))
+
+	bundles := func() int {
+		ents, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		return len(ents)
+	}
+
+	ctx := context.Background()
+
+	var runs int
+	Run(ctx, "test", func(context.Context) error {
+		runs++
+		switch runs {
+		case 1:
+			return xerrors.New("failed")
+		case 2, 3, 4:
+			panic("boom")
+		}
+		return nil
+	})
+	require.Equal(t, 5, runs)
+	require.Equal(t, 2, bundles(), "old bundles are pruned")
+
+	require.NoError(t, Configure(Config{Dir: dir, Restart: false}))
+	runs = 0
+	Run(ctx, "test", func(context.Context) error {
+		runs++
+		panic("boom")
+	})
+	require.Equal(t, 1, runs)
+	require.Equal(t, 3, bundles())
+}
+
+func TestTaskStatus(t *testing.T) {
+	minBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, "test-status", func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				return xerrors.New("rpc failed")
+			}
+			Success(ctx)
+			Failure(ctx, xerrors.New("handled"))
+			cancel()
+			return nil
+		})
+	}()
+	<-done
+
+	var st TaskStatus
+	for _, ts := range Tasks() {
+		if ts.Name == "test-status" {
+			st = ts
+		}
+	}
+
+	require.Equal(t, "test-status", st.Name)
+	require.False(t, st.Running)
+	require.Equal(t, 1, st.Restarts)
+	require.Equal(t, "handled", st.LastError)
+	require.False(t, st.LastSuccess.IsZero())
+}
@@ -0,0 +1,114 @@
+package crash
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskStatus is the health of a subsystem started with Run
+type TaskStatus struct {
+	Name     string
+	Running  bool
+	Started  time.Time
+	Restarts int
+
+	LastSuccess   time.Time
+	LastError     string
+	LastErrorTime time.Time
+}
+
+type taskKey struct{}
+
+type task struct {
+	lk sync.Mutex
+	st TaskStatus
+}
+
+var (
+	tasksLk sync.Mutex
+	tasks   = map[string]*task{}
+)
+
+func startTask(name string) *task {
+	tasksLk.Lock()
+	defer tasksLk.Unlock()
+
+	t, ok := tasks[name]
+	if !ok {
+		t = &task{}
+		tasks[name] = t
+	}
+
+	t.lk.Lock()
+	t.st = TaskStatus{
+		Name:    name,
+		Running: true,
+		Started: time.Now(),
+	}
+	t.lk.Unlock()
+
+	return t
+}
+
+func (t *task) exit() {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.st.Running = false
+}
+
+func (t *task) failed(err error, restart bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.st.LastError = err.Error()
+	t.st.LastErrorTime = time.Now()
+	if restart {
+		t.st.Restarts++
+	}
+}
+
+// Success records a successful iteration of the subsystem running in ctx
+func Success(ctx context.Context) {
+	t, ok := ctx.Value(taskKey{}).(*task)
+	if !ok {
+		return
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	t.st.LastSuccess = time.Now()
+}
+
+// Failure records an error handled by the subsystem running in ctx, without
+// restarting it
+func Failure(ctx context.Context, err error) {
+	t, ok := ctx.Value(taskKey{}).(*task)
+	if !ok {
+		return
+	}
+
+	t.failed(err, false)
+}
+
+// Tasks lists the status of all subsystems started with Run
+func Tasks() []TaskStatus {
+	tasksLk.Lock()
+	defer tasksLk.Unlock()
+
+	out := make([]TaskStatus, 0, len(tasks))
+	for _, t := range tasks {
+		t.lk.Lock()
+		out = append(out, t.st)
+		t.lk.Unlock()
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
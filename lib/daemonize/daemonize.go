@@ -0,0 +1,38 @@
+// Package daemonize runs a command in the background and guards it with a
+// PID file, for operators not running lotus under a service manager
+package daemonize
+
+import (
+	"os"
+	"time"
+)
+
+// envDetached is set in the environment of the detached process, so it
+// doesn't detach again
+const envDetached = "LOTUS_DETACHED"
+
+// startupWait is how long Detach waits for the detached process to fail
+// early, e.g. on a locked PID file
+var startupWait = 3 * time.Second
+
+// Detached is true in a process started by Detach
+func Detached() bool {
+	return os.Getenv(envDetached) != ""
+}
+
+// PidFile is a locked file holding the PID of the running process. The lock
+// is released when the process exits, a PID file left by a crashed process
+// doesn't prevent a start.
+type PidFile struct {
+	f    *os.File
+	path string
+}
+
+// Close removes the PID file and releases the lock
+func (p *PidFile) Close() error {
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		_ = p.f.Close()
+		return err
+	}
+	return p.f.Close()
+}
@@ -0,0 +1,13 @@
+// +build !darwin,!linux,!netbsd,!openbsd
+
+package daemonize
+
+import "golang.org/x/xerrors"
+
+func LockPidFile(path string) (*PidFile, error) {
+	return nil, xerrors.New("PID files are not supported on this platform")
+}
+
+func Detach(logFile string) (int, error) {
+	return 0, xerrors.New("detaching is not supported on this platform")
+}
@@ -0,0 +1,76 @@
+// +build darwin linux netbsd openbsd
+
+package daemonize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// the detached test binary, see TestDetach
+	if Detached() {
+		if os.Getenv("DETACH_TEST_FAIL") != "" {
+			os.Exit(1)
+		}
+		time.Sleep(5 * time.Second)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	path := filepath.Join(dir, "run", "lotus.pid")
+
+	p, err := LockPidFile(path)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(b))
+
+	_, err = LockPidFile(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already running with PID "+strconv.Itoa(os.Getpid()))
+
+	require.NoError(t, p.Close())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	// a stale file with a longer PID is overwritten
+	require.NoError(t, ioutil.WriteFile(path, []byte("1234567890\n"), 0644))
+	p, err = LockPidFile(path)
+	require.NoError(t, err)
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(b))
+	require.NoError(t, p.Close())
+}
+
+func TestDetach(t *testing.T) {
+	dir, err := ioutil.TempDir("", "detach")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	logFile := filepath.Join(dir, "logs", "out.log")
+	startupWait = 2 * time.Second
+
+	require.NoError(t, os.Setenv("DETACH_TEST_FAIL", "1"))
+	_, err = Detach(logFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exited right away")
+	require.NoError(t, os.Unsetenv("DETACH_TEST_FAIL"))
+
+	pid, err := Detach(logFile)
+	require.NoError(t, err)
+	require.NotZero(t, pid)
+	require.FileExists(t, logFile)
+}
@@ -0,0 +1,102 @@
+// +build darwin linux netbsd openbsd
+
+package daemonize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// LockPidFile writes the PID of the process to path and locks it, it fails
+// when another process holds the lock
+func LockPidFile(path string) (*PidFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, xerrors.Errorf("creating PID file directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, xerrors.Errorf("opening PID file: %w", err)
+	}
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		_ = f.Close()
+		if err == unix.EWOULDBLOCK {
+			pid, _ := ioutil.ReadFile(path)
+			return nil, xerrors.Errorf("already running with PID %s (%s)", bytes.TrimSpace(pid), path)
+		}
+		return nil, xerrors.Errorf("locking PID file: %w", err)
+	}
+
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, xerrors.Errorf("writing PID file: %w", err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		_ = f.Close()
+		return nil, xerrors.Errorf("writing PID file: %w", err)
+	}
+
+	return &PidFile{f: f, path: path}, nil
+}
+
+// Detach starts the command again in a new session, with stdout and stderr
+// appended to logFile. It returns the PID of the detached process once it's
+// running, the caller should exit then.
+func Detach(logFile string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, xerrors.Errorf("finding executable: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return 0, xerrors.Errorf("creating log directory: %w", err)
+	}
+	lf, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, xerrors.Errorf("opening log file: %w", err)
+	}
+	defer lf.Close() //nolint:errcheck
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return 0, err
+	}
+	defer null.Close() //nolint:errcheck
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), envDetached+"=1")
+	cmd.Stdin = null
+	cmd.Stdout = lf
+	cmd.Stderr = lf
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return 0, xerrors.Errorf("starting detached process: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = xerrors.New("exit status 0")
+		}
+		return 0, xerrors.Errorf("detached process exited right away (%s), see %s", err, logFile)
+	case <-time.After(startupWait):
+	}
+
+	return cmd.Process.Pid, nil
+}
@@ -0,0 +1,295 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// finishedTTL is how long finished operations are listed
+var finishedTTL = time.Hour
+
+// maxFinished limits the number of finished operations kept
+const maxFinished = 256
+
+// Status is a snapshot of an operation
+type Status struct {
+	ID string
+	// Source is the machine running the operation, e.g. a worker hostname
+	Source      string
+	Kind        string
+	Description string
+
+	Started time.Time
+	Updated time.Time
+
+	// Done and Total are in Unit, e.g. bytes or layers. Total is 0 when the
+	// size of the operation isn't known.
+	Done  uint64
+	Total uint64
+	Unit  string
+
+	// Progress is the completed fraction between 0 and 1, or -1 when unknown
+	Progress float64
+	// ETA is the estimated time left, 0 when unknown
+	ETA time.Duration
+
+	Finished bool
+	Error    string
+}
+
+// Registry tracks long-running operations, like sealing tasks, fetches and
+// data transfers, so their progress can be reported
+type Registry struct {
+	prefix string
+
+	lk       sync.Mutex
+	ctr      uint64
+	active   map[uint64]*Operation
+	finished []Status
+}
+
+// NewRegistry creates a registry, IDs of its operations start with prefix
+func NewRegistry(prefix string) *Registry {
+	return &Registry{
+		prefix: prefix,
+		active: map[uint64]*Operation{},
+	}
+}
+
+// Operation reports the progress of a single operation. All methods can be
+// called on a nil Operation, so code reporting progress doesn't need to know
+// whether anything tracks it.
+type Operation struct {
+	r  *Registry
+	id uint64
+
+	lk   sync.Mutex
+	st   Status
+	done chan struct{}
+}
+
+// Start registers a new operation
+func (r *Registry) Start(kind, desc string) *Operation {
+	if r == nil {
+		return nil
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	r.ctr++
+	now := time.Now()
+	op := &Operation{
+		r:  r,
+		id: r.ctr,
+		st: Status{
+			ID:          fmt.Sprintf("%s%d", r.prefix, r.ctr),
+			Kind:        kind,
+			Description: desc,
+			Started:     now,
+			Updated:     now,
+		},
+		done: make(chan struct{}),
+	}
+	r.active[op.id] = op
+	return op
+}
+
+// SetTotal sets the size of the operation
+func (o *Operation) SetTotal(total uint64, unit string) {
+	if o == nil {
+		return
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	o.st.Total = total
+	o.st.Unit = unit
+	o.st.Updated = time.Now()
+}
+
+// SetDone sets the completed part of the operation
+func (o *Operation) SetDone(done uint64) {
+	if o == nil {
+		return
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	o.st.Done = done
+	o.st.Updated = time.Now()
+}
+
+// Add adds to the completed part of the operation
+func (o *Operation) Add(n uint64) {
+	if o == nil {
+		return
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	o.st.Done += n
+	o.st.Updated = time.Now()
+}
+
+// Finish marks the operation finished, err is the result of the operation
+func (o *Operation) Finish(err error) {
+	if o == nil {
+		return
+	}
+
+	o.lk.Lock()
+	if o.st.Finished {
+		o.lk.Unlock()
+		return
+	}
+	o.st.Finished = true
+	o.st.Updated = time.Now()
+	if err != nil {
+		o.st.Error = err.Error()
+	} else if o.st.Total > 0 {
+		o.st.Done = o.st.Total
+	}
+	close(o.done)
+	o.lk.Unlock()
+
+	st := o.Status()
+
+	o.r.lk.Lock()
+	defer o.r.lk.Unlock()
+
+	delete(o.r.active, o.id)
+	o.r.finished = append(o.r.finished, st)
+	if len(o.r.finished) > maxFinished {
+		o.r.finished = o.r.finished[len(o.r.finished)-maxFinished:]
+	}
+}
+
+// Finished returns a channel which is closed when the operation finishes
+func (o *Operation) Finished() <-chan struct{} {
+	if o == nil {
+		return nil
+	}
+	return o.done
+}
+
+// Status returns a snapshot of the operation
+func (o *Operation) Status() Status {
+	if o == nil {
+		return Status{}
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	st := o.st
+	st.Progress = -1
+	if st.Total > 0 {
+		st.Progress = float64(st.Done) / float64(st.Total)
+		if st.Progress > 1 {
+			st.Progress = 1
+		}
+
+		if !st.Finished && st.Done > 0 && st.Done < st.Total {
+			elapsed := time.Since(st.Started)
+			st.ETA = time.Duration(float64(elapsed) * float64(st.Total-st.Done) / float64(st.Done))
+		}
+	} else if st.Finished && st.Error == "" {
+		st.Progress = 1
+	}
+	return st
+}
+
+// Reader counts bytes read from r as done
+func (o *Operation) Reader(r io.Reader) io.Reader {
+	if o == nil {
+		return r
+	}
+	return &opReader{r: r, op: o}
+}
+
+type opReader struct {
+	r  io.Reader
+	op *Operation
+}
+
+func (or *opReader) Read(p []byte) (int, error) {
+	n, err := or.r.Read(p)
+	or.op.Add(uint64(n))
+	return n, err
+}
+
+// List returns running operations, and operations which finished recently,
+// oldest first
+func (r *Registry) List() []Status {
+	r.lk.Lock()
+	active := make([]*Operation, 0, len(r.active))
+	for _, op := range r.active {
+		active = append(active, op)
+	}
+
+	var out []Status
+	cutoff := time.Now().Add(-finishedTTL)
+	for _, st := range r.finished {
+		if st.Updated.After(cutoff) {
+			out = append(out, st)
+		}
+	}
+	r.lk.Unlock()
+
+	for _, op := range active {
+		out = append(out, op.Status())
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Started.Before(out[j].Started)
+	})
+	return out
+}
+
+// Get returns an operation by its ID
+func (r *Registry) Get(id string) (Status, bool) {
+	for _, st := range r.List() {
+		if st.ID == id {
+			return st, true
+		}
+	}
+	return Status{}, false
+}
+
+type (
+	opKey       struct{}
+	registryKey struct{}
+)
+
+// WithOperation returns a context carrying op, so code deeper in the call
+// stack can report progress through FromContext
+func WithOperation(ctx context.Context, op *Operation) context.Context {
+	return context.WithValue(ctx, opKey{}, op)
+}
+
+// FromContext returns the operation carried by ctx, or nil
+func FromContext(ctx context.Context) *Operation {
+	op, _ := ctx.Value(opKey{}).(*Operation)
+	return op
+}
+
+// WithRegistry returns a context carrying r, so code deeper in the call stack
+// can register operations of its own, e.g. fetches done as part of a task
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, r)
+}
+
+// RegistryFromContext returns the registry carried by ctx, or nil. Operations
+// can be started on a nil registry, they just aren't tracked.
+func RegistryFromContext(ctx context.Context) *Registry {
+	r, _ := ctx.Value(registryKey{}).(*Registry)
+	return r
+}
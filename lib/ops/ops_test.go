@@ -0,0 +1,65 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry("w/")
+
+	op := r.Start("fetch", "fetching sector 1")
+	op.SetTotal(100, "bytes")
+
+	_, err := ioutil.ReadAll(op.Reader(bytes.NewReader(make([]byte, 25))))
+	require.NoError(t, err)
+
+	st, ok := r.Get("w/1")
+	require.True(t, ok)
+	require.Equal(t, uint64(25), st.Done)
+	require.Equal(t, 0.25, st.Progress)
+	require.False(t, st.Finished)
+	require.True(t, st.ETA > 0)
+
+	unknown := r.Start("unseal", "")
+	require.Equal(t, -1.0, unknown.Status().Progress)
+
+	op.Finish(nil)
+	unknown.Finish(errors.New("boom"))
+
+	list := r.List()
+	require.Len(t, list, 2)
+	require.True(t, list[0].Finished)
+	require.Equal(t, 1.0, list[0].Progress)
+	require.Equal(t, time.Duration(0), list[0].ETA)
+	require.Equal(t, "boom", list[1].Error)
+
+	old := finishedTTL
+	finishedTTL = 0
+	defer func() {
+		finishedTTL = old
+	}()
+	require.Empty(t, r.List())
+}
+
+func TestNilOperation(t *testing.T) {
+	var r *Registry
+	op := r.Start("fetch", "")
+	op.SetTotal(10, "bytes")
+	op.Add(5)
+	op.Finish(nil)
+
+	require.Nil(t, FromContext(context.Background()))
+	require.Nil(t, RegistryFromContext(context.Background()).Start("fetch", ""))
+
+	r = NewRegistry("")
+	op = r.Start("fetch", "")
+	require.Equal(t, op, FromContext(WithOperation(context.Background(), op)))
+	require.Equal(t, r, RegistryFromContext(WithRegistry(context.Background(), r)))
+}
@@ -0,0 +1,236 @@
+package paramcache
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/minio/blake2b-simd"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("paramcache")
+
+// same defaults as go-paramfetch
+const (
+	defaultDir = "/var/tmp/filecoin-proof-parameters"
+	dirEnv     = "FIL_PROOFS_PARAMETER_CACHE"
+)
+
+// Dir returns the proof parameter directory
+func Dir() string {
+	if d := os.Getenv(dirEnv); d != "" {
+		return d
+	}
+	return defaultDir
+}
+
+// File is a parameter file available from a Handler
+type File struct {
+	Name       string
+	Cid        string
+	Digest     string
+	SectorSize uint64
+	Size       int64
+}
+
+type paramInfo struct {
+	Cid        string `json:"cid"`
+	Digest     string `json:"digest"`
+	SectorSize uint64 `json:"sector_size"`
+}
+
+func parseParams(params []byte) (map[string]paramInfo, error) {
+	var out map[string]paramInfo
+	if err := json.Unmarshal(params, &out); err != nil {
+		return nil, xerrors.Errorf("parsing parameters.json: %w", err)
+	}
+	return out, nil
+}
+
+// Handler serves the local parameter files listed in a parameters.json:
+// GET <prefix> lists the files with their digests, GET <prefix>/<name> serves
+// a file, with support for range requests.
+type Handler struct {
+	Prefix string
+	Params []byte
+	Dir    string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params, err := parseParams(h.Params)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(500)
+		return
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, h.Prefix), "/")
+	if name == "" {
+		h.list(w, params)
+		return
+	}
+
+	info, ok := params[name]
+	if !ok {
+		w.WriteHeader(404)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(h.Dir, name))
+	if os.IsNotExist(err) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		log.Errorf("opening parameter file: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	defer f.Close() //nolint:errcheck
+
+	st, err := f.Stat()
+	if err != nil {
+		log.Errorf("stat parameter file: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Param-Digest", info.Digest)
+	http.ServeContent(w, r, name, st.ModTime(), f)
+}
+
+func (h *Handler) list(w http.ResponseWriter, params map[string]paramInfo) {
+	out := []File{}
+	for name, info := range params {
+		st, err := os.Stat(filepath.Join(h.Dir, name))
+		if err != nil {
+			continue
+		}
+		out = append(out, File{
+			Name:       name,
+			Cid:        info.Cid,
+			Digest:     info.Digest,
+			SectorSize: info.SectorSize,
+			Size:       st.Size(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		log.Warnf("writing parameter list: %s", err)
+	}
+}
+
+// Fetch downloads the parameter files needed for sectorSize which are missing
+// in dir from a Handler at url. Downloads are checked against the digests in
+// params, files the server doesn't have are skipped.
+func Fetch(ctx context.Context, url string, header http.Header, params []byte, dir string, sectorSize uint64) error {
+	want, err := parseParams(params)
+	if err != nil {
+		return err
+	}
+
+	var available []File
+	if err := get(ctx, url, header, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&available)
+	}); err != nil {
+		return xerrors.Errorf("listing parameters: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, f := range available {
+		info, ok := want[f.Name]
+		if !ok || info.Digest != f.Digest {
+			continue
+		}
+		if strings.HasSuffix(f.Name, ".params") && info.SectorSize != sectorSize {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name)
+		if st, err := os.Stat(path); err == nil && st.Size() == f.Size {
+			continue
+		}
+
+		log.Infow("fetching parameter file", "name", f.Name, "size", f.Size)
+		if err := fetchFile(ctx, strings.TrimSuffix(url, "/")+"/"+f.Name, header, path, info.Digest); err != nil {
+			return xerrors.Errorf("fetching %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func fetchFile(ctx context.Context, url string, header http.Header, path, digest string) error {
+	tmp := path + ".fetch"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) //nolint:errcheck
+
+	h := blake2b.New512()
+	err = get(ctx, url, header, func(r io.Reader) error {
+		_, err := io.Copy(io.MultiWriter(out, h), r)
+		return err
+	})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if sum := digestOf(h); sum != digest {
+		return xerrors.Errorf("checksum mismatch, %s != %s", sum, digest)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// digestOf returns the digest in the parameters.json format
+func digestOf(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func get(ctx context.Context, url string, header http.Header, read func(io.Reader) error) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return xerrors.Errorf("request: %w", err)
+	}
+	if header != nil {
+		req.Header = header.Clone()
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != 200 {
+		return xerrors.Errorf("non-200 code: %d", resp.StatusCode)
+	}
+
+	return read(resp.Body)
+}
@@ -0,0 +1,66 @@
+package paramcache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/blake2b-simd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetch(t *testing.T) {
+	src, err := ioutil.TempDir("", "paramcache-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(src) //nolint:errcheck
+	dst, err := ioutil.TempDir("", "paramcache-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst) //nolint:errcheck
+
+	files := map[string][]byte{
+		"a-2048.params": []byte("params for 2KiB sectors"),
+		"a-2048.vk":     []byte("verifying key"),
+		"b-8M.params":   []byte("params for 8MiB sectors"),
+	}
+	params := "{"
+	for name, data := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(src, name), data, 0644))
+
+		h := blake2b.New512()
+		_, _ = h.Write(data)
+		ss := 2048
+		if name == "b-8M.params" {
+			ss = 8 << 20
+		}
+		params += fmt.Sprintf(`"%s": {"cid": "cid-%s", "digest": "%s", "sector_size": %d},`, name, name, digestOf(h), ss)
+	}
+	params = params[:len(params)-1] + "}"
+
+	srv := httptest.NewServer(&Handler{Prefix: "/remote/params", Params: []byte(params), Dir: src})
+	defer srv.Close()
+
+	err = Fetch(context.Background(), srv.URL+"/remote/params", nil, []byte(params), dst, 2048)
+	require.NoError(t, err)
+
+	for name, data := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if name == "b-8M.params" {
+			require.True(t, os.IsNotExist(err), "other sector size")
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+
+	// a corrupted file on the server is rejected
+	require.NoError(t, os.Remove(filepath.Join(dst, "a-2048.vk")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "a-2048.vk"), []byte("verifying kez"), 0644))
+	err = Fetch(context.Background(), srv.URL+"/remote/params", nil, []byte(params), dst, 2048)
+	require.Error(t, err)
+	_, err = os.Stat(filepath.Join(dst, "a-2048.vk"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,349 @@
+package peermgr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	host "github.com/libp2p/go-libp2p-core/host"
+	net "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+// PexProtocolID is the protocol used to exchange addresses of known miners
+const PexProtocolID = "/lotus/pex/1.0.0"
+
+const (
+	// MaxKnownMiners is the number of miner addresses kept by the exchange
+	MaxKnownMiners = 64
+	// pexShare is the number of addresses sent in an exchange response
+	pexShare = 32
+
+	pexInterval = 10 * time.Minute
+	pexTimeout  = 30 * time.Second
+	pexMaxResp  = 64 << 10
+	pexQueries  = 3
+	pexRedial   = 8
+)
+
+var (
+	bootstrapKey   = datastore.NewKey("/pex/bootstrap")
+	knownMinersKey = datastore.NewKey("/pex/miners")
+)
+
+type knownPeer struct {
+	Info peer.AddrInfo
+	// Seen is when the node was last connected to the miner, zero for
+	// addresses learned from other nodes until they're confirmed
+	Seen time.Time
+}
+
+// PeerExchange keeps libp2p connectivity when the builtin bootstrappers are
+// unreachable. It maintains a user managed bootstrap list, and a list of
+// storage miners the node was connected to, which is shared with other
+// nodes. Both lists are persisted in the metadata datastore, and are redialed
+// when the node has few peers.
+type PeerExchange struct {
+	h  host.Host
+	ds dtypes.MetadataDS
+
+	lk        sync.Mutex
+	bootstrap []peer.AddrInfo
+	known     map[peer.ID]knownPeer
+}
+
+func NewPeerExchange(h host.Host, ds dtypes.MetadataDS) (*PeerExchange, error) {
+	pex := &PeerExchange{
+		h:     h,
+		ds:    ds,
+		known: map[peer.ID]knownPeer{},
+	}
+
+	if err := pex.load(bootstrapKey, &pex.bootstrap); err != nil {
+		return nil, xerrors.Errorf("loading bootstrap list: %w", err)
+	}
+
+	var known []knownPeer
+	if err := pex.load(knownMinersKey, &known); err != nil {
+		return nil, xerrors.Errorf("loading known miners: %w", err)
+	}
+	for _, kp := range known {
+		pex.known[kp.Info.ID] = kp
+	}
+
+	h.SetStreamHandler(PexProtocolID, pex.handleStream)
+
+	return pex, nil
+}
+
+func (pex *PeerExchange) load(k datastore.Key, out interface{}) error {
+	b, err := pex.ds.Get(k)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func (pex *PeerExchange) store(k datastore.Key, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return pex.ds.Put(k, b)
+}
+
+// Bootstrappers returns the persisted bootstrap list
+func (pex *PeerExchange) Bootstrappers() []peer.AddrInfo {
+	pex.lk.Lock()
+	defer pex.lk.Unlock()
+
+	return append([]peer.AddrInfo{}, pex.bootstrap...)
+}
+
+// AddBootstrapper adds a peer to the bootstrap list, or replaces its addresses
+func (pex *PeerExchange) AddBootstrapper(ai peer.AddrInfo) error {
+	if len(ai.Addrs) == 0 {
+		return xerrors.Errorf("bootstrap peer %s has no addresses", ai.ID)
+	}
+
+	pex.lk.Lock()
+	defer pex.lk.Unlock()
+
+	list := []peer.AddrInfo{ai}
+	for _, bs := range pex.bootstrap {
+		if bs.ID != ai.ID {
+			list = append(list, bs)
+		}
+	}
+
+	if err := pex.store(bootstrapKey, list); err != nil {
+		return xerrors.Errorf("persisting bootstrap list: %w", err)
+	}
+	pex.bootstrap = list
+	return nil
+}
+
+// RemoveBootstrapper removes a peer from the bootstrap list
+func (pex *PeerExchange) RemoveBootstrapper(p peer.ID) error {
+	pex.lk.Lock()
+	defer pex.lk.Unlock()
+
+	var list []peer.AddrInfo
+	for _, bs := range pex.bootstrap {
+		if bs.ID != p {
+			list = append(list, bs)
+		}
+	}
+	if len(list) == len(pex.bootstrap) {
+		return xerrors.Errorf("peer %s is not in the bootstrap list", p)
+	}
+
+	if err := pex.store(bootstrapKey, list); err != nil {
+		return xerrors.Errorf("persisting bootstrap list: %w", err)
+	}
+	pex.bootstrap = list
+	return nil
+}
+
+// KnownMiners returns the known miner addresses, most recently seen first
+func (pex *PeerExchange) KnownMiners() []peer.AddrInfo {
+	pex.lk.Lock()
+	defer pex.lk.Unlock()
+
+	known := pex.sortedKnown()
+	out := make([]peer.AddrInfo, len(known))
+	for i, kp := range known {
+		out[i] = kp.Info
+	}
+	return out
+}
+
+func (pex *PeerExchange) sortedKnown() []knownPeer {
+	out := make([]knownPeer, 0, len(pex.known))
+	for _, kp := range pex.known {
+		out = append(out, kp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Seen.After(out[j].Seen)
+	})
+	return out
+}
+
+// addKnown records miner addresses. Addresses learned from other nodes don't
+// replace ones we've seen ourselves, and aren't seen until we connect to
+// them, so they're evicted first, then the oldest entries.
+func (pex *PeerExchange) addKnown(now time.Time, confirmed bool, infos ...peer.AddrInfo) {
+	pex.lk.Lock()
+	defer pex.lk.Unlock()
+
+	for _, ai := range infos {
+		if ai.ID == pex.h.ID() || len(ai.Addrs) == 0 {
+			continue
+		}
+		if _, ok := pex.known[ai.ID]; ok && !confirmed {
+			continue
+		}
+
+		kp := knownPeer{Info: ai}
+		if confirmed {
+			kp.Seen = now
+		}
+		pex.known[ai.ID] = kp
+	}
+
+	if len(pex.known) > MaxKnownMiners {
+		for _, kp := range pex.sortedKnown()[MaxKnownMiners:] {
+			delete(pex.known, kp.Info.ID)
+		}
+	}
+}
+
+func (pex *PeerExchange) handleStream(s net.Stream) {
+	defer s.Close() //nolint:errcheck
+
+	known := pex.KnownMiners()
+	if len(known) > pexShare {
+		known = known[:pexShare]
+	}
+
+	_ = s.SetWriteDeadline(time.Now().Add(pexTimeout))
+	if err := json.NewEncoder(s).Encode(known); err != nil {
+		log.Debugw("sending known miners", "peer", s.Conn().RemotePeer(), "error", err)
+	}
+}
+
+func (pex *PeerExchange) query(ctx context.Context, p peer.ID) ([]peer.AddrInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, pexTimeout)
+	defer cancel()
+
+	s, err := pex.h.NewStream(ctx, p, PexProtocolID)
+	if err != nil {
+		return nil, xerrors.Errorf("opening stream: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	_ = s.SetReadDeadline(time.Now().Add(pexTimeout))
+
+	var out []peer.AddrInfo
+	if err := json.NewDecoder(io.LimitReader(s, pexMaxResp)).Decode(&out); err != nil {
+		return nil, xerrors.Errorf("reading response: %w", err)
+	}
+	if len(out) > pexShare {
+		out = out[:pexShare]
+	}
+	return out, nil
+}
+
+// Run periodically records connected miners, exchanges known miners with
+// peers, and redials bootstrappers and known miners when few peers are
+// connected
+func (pex *PeerExchange) Run(ctx context.Context) error {
+	tick := build.Clock.Ticker(pexInterval)
+	defer tick.Stop()
+
+	for {
+		pex.round(ctx)
+		crash.Success(ctx)
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (pex *PeerExchange) round(ctx context.Context) {
+	now := build.Clock.Now()
+	ps := pex.h.Peerstore()
+	peers := pex.h.Network().Peers()
+
+	var miners, exchangers []peer.ID
+	for _, p := range peers {
+		if protos, err := ps.SupportsProtocols(p, storagemarket.DealProtocolID); err == nil && len(protos) > 0 {
+			miners = append(miners, p)
+		}
+		if protos, err := ps.SupportsProtocols(p, PexProtocolID); err == nil && len(protos) > 0 {
+			exchangers = append(exchangers, p)
+		}
+	}
+
+	for _, p := range miners {
+		pex.addKnown(now, true, ps.PeerInfo(p))
+	}
+
+	rand.Shuffle(len(exchangers), func(i, j int) {
+		exchangers[i], exchangers[j] = exchangers[j], exchangers[i]
+	})
+	if len(exchangers) > pexQueries {
+		exchangers = exchangers[:pexQueries]
+	}
+	for _, p := range exchangers {
+		infos, err := pex.query(ctx, p)
+		if err != nil {
+			log.Debugw("peer exchange failed", "peer", p, "error", err)
+			continue
+		}
+		pex.addKnown(now, false, infos...)
+	}
+
+	if len(peers) < MinFilPeers {
+		pex.redial(ctx)
+	}
+
+	pex.lk.Lock()
+	err := pex.store(knownMinersKey, pex.sortedKnown())
+	pex.lk.Unlock()
+	if err != nil {
+		log.Errorf("persisting known miners: %+v", err)
+	}
+}
+
+func (pex *PeerExchange) redial(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, pexTimeout)
+	defer cancel()
+
+	targets := pex.Bootstrappers()
+	known := pex.KnownMiners()
+	if len(known) > pexRedial {
+		known = known[:pexRedial]
+	}
+	targets = append(targets, known...)
+
+	if len(targets) == 0 {
+		return
+	}
+
+	log.Infow("few peers connected, dialing bootstrappers and known miners", "peers", len(pex.h.Network().Peers()), "targets", len(targets))
+
+	var wg sync.WaitGroup
+	for _, ai := range targets {
+		if pex.h.Network().Connectedness(ai.ID) == net.Connected {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ai peer.AddrInfo) {
+			defer wg.Done()
+			if err := pex.h.Connect(ctx, ai); err != nil {
+				log.Debugw("dialing peer failed", "peer", ai.ID, "error", err)
+			}
+		}(ai)
+	}
+	wg.Wait()
+}
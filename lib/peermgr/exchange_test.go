@@ -0,0 +1,68 @@
+package peermgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	ha, err := mn.GenPeer()
+	require.NoError(t, err)
+	hb, err := mn.GenPeer()
+	require.NoError(t, err)
+	hm, err := mn.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, mn.LinkAll())
+
+	dsa := dssync.MutexWrap(datastore.NewMapDatastore())
+	pa, err := NewPeerExchange(ha, dsa)
+	require.NoError(t, err)
+	pb, err := NewPeerExchange(hb, dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+
+	miner := peer.AddrInfo{
+		ID:    hm.ID(),
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")},
+	}
+	pa.addKnown(time.Now(), true, miner)
+
+	infos, err := pb.query(ctx, ha.ID())
+	require.NoError(t, err)
+	require.Equal(t, []peer.AddrInfo{miner}, infos)
+
+	// learned addresses don't replace confirmed ones
+	pb.addKnown(time.Now(), true, miner)
+	moved := peer.AddrInfo{ID: miner.ID, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/5.6.7.8/tcp/1")}}
+	pb.addKnown(time.Now(), false, moved)
+	require.Equal(t, []peer.AddrInfo{miner}, pb.KnownMiners())
+
+	// learned addresses aren't seen until confirmed, and are evicted first
+	learned := peer.AddrInfo{ID: ha.ID(), Addrs: []ma.Multiaddr{ma.StringCast("/ip4/5.6.7.8/tcp/2")}}
+	pb.addKnown(time.Now(), false, learned)
+	require.True(t, pb.known[learned.ID].Seen.IsZero())
+	require.Equal(t, []peer.AddrInfo{miner, learned}, pb.KnownMiners())
+	pb.addKnown(time.Now(), true, learned)
+	require.False(t, pb.known[learned.ID].Seen.IsZero())
+
+	// bootstrap list is persisted
+	require.NoError(t, pa.AddBootstrapper(miner))
+	pa2, err := NewPeerExchange(ha, dsa)
+	require.NoError(t, err)
+	require.Equal(t, []peer.AddrInfo{miner}, pa2.Bootstrappers())
+
+	require.NoError(t, pa2.RemoveBootstrapper(miner.ID))
+	require.Error(t, pa2.RemoveBootstrapper(miner.ID))
+	require.Empty(t, pa2.Bootstrappers())
+}
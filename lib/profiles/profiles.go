@@ -0,0 +1,204 @@
+package profiles
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+var log = logging.Logger("profiles")
+
+const ext = ".pprof"
+
+// Kinds of profiles captured on every run
+var Kinds = []string{"cpu", "heap", "goroutine"}
+
+// Capturer periodically captures CPU, heap and goroutine profiles into a
+// directory, and removes captures older than the retention period, so that
+// profiles from before an incident are available afterwards
+type Capturer struct {
+	dir         string
+	interval    time.Duration
+	cpuDuration time.Duration
+	retention   time.Duration
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewCapturer(dir string, interval, cpuDuration, retention time.Duration) (*Capturer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating profile directory: %w", err)
+	}
+
+	return &Capturer{
+		dir:         dir,
+		interval:    interval,
+		cpuDuration: cpuDuration,
+		retention:   retention,
+
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+func (c *Capturer) Run() {
+	defer close(c.stopped)
+
+	if c.interval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-c.stop:
+			return
+		}
+
+		c.capture(time.Now())
+		c.prune(time.Now())
+	}
+}
+
+func (c *Capturer) Stop(ctx context.Context) error {
+	close(c.stop)
+
+	select {
+	case <-c.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Capturer) capture(now time.Time) {
+	for _, kind := range Kinds {
+		var buf bytes.Buffer
+		var err error
+		switch kind {
+		case "cpu":
+			err = c.captureCPU(&buf)
+		default:
+			err = pprof.Lookup(kind).WriteTo(&buf, 0)
+		}
+		if err != nil {
+			log.Warnf("capturing %s profile: %s", kind, err)
+			continue
+		}
+
+		name := profileName(now, kind)
+		if err := ioutil.WriteFile(filepath.Join(c.dir, name), buf.Bytes(), 0644); err != nil {
+			log.Errorf("writing profile %s: %+v", name, err)
+		}
+	}
+}
+
+func (c *Capturer) captureCPU(buf *bytes.Buffer) error {
+	// fails if CPU profiling was already started, e.g. with `lotus daemon --pprof`
+	if err := pprof.StartCPUProfile(buf); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(c.cpuDuration):
+	case <-c.stop:
+	}
+
+	pprof.StopCPUProfile()
+	return nil
+}
+
+func (c *Capturer) prune(now time.Time) {
+	if c.retention <= 0 {
+		return
+	}
+
+	list, err := c.List()
+	if err != nil {
+		log.Errorf("listing profiles: %+v", err)
+		return
+	}
+
+	for _, p := range list {
+		if now.Sub(p.Time) <= c.retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, p.Name)); err != nil {
+			log.Errorf("removing old profile %s: %+v", p.Name, err)
+		}
+	}
+}
+
+func profileName(t time.Time, kind string) string {
+	return strconv.FormatInt(t.Unix(), 10) + "-" + kind + ext
+}
+
+func parseName(name string) (time.Time, string, bool) {
+	if !strings.HasSuffix(name, ext) {
+		return time.Time{}, "", false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(name, ext), "-", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(ts, 0), parts[1], true
+}
+
+// List returns the stored profiles, oldest first
+func (c *Capturer) List() ([]api.ProfileInfo, error) {
+	ents, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, xerrors.Errorf("reading profile directory: %w", err)
+	}
+
+	var out []api.ProfileInfo
+	for _, e := range ents {
+		t, kind, ok := parseName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		out = append(out, api.ProfileInfo{
+			Name: e.Name(),
+			Kind: kind,
+			Time: t,
+			Size: e.Size(),
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Time.Equal(out[j].Time) {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Time.Before(out[j].Time)
+	})
+
+	return out, nil
+}
+
+func (c *Capturer) Get(name string) ([]byte, error) {
+	if _, _, ok := parseName(name); !ok || filepath.Base(name) != name {
+		return nil, xerrors.Errorf("invalid profile name %q", name)
+	}
+
+	return ioutil.ReadFile(filepath.Join(c.dir, name))
+}
@@ -0,0 +1,42 @@
+package profiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureAndPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	c, err := NewCapturer(dir, time.Hour, 10*time.Millisecond, 24*time.Hour)
+	require.NoError(t, err)
+
+	old := time.Now().Add(-48 * time.Hour)
+	c.capture(old)
+	c.capture(time.Now())
+
+	list, err := c.List()
+	require.NoError(t, err)
+	require.Len(t, list, 2*len(Kinds))
+	require.Equal(t, old.Unix(), list[0].Time.Unix())
+
+	c.prune(time.Now())
+
+	list, err = c.List()
+	require.NoError(t, err)
+	require.Len(t, list, len(Kinds))
+
+	b, err := c.Get(list[0].Name)
+	require.NoError(t, err)
+	require.NotEmpty(t, b)
+
+	_, err = c.Get(filepath.Join("..", list[0].Name))
+	require.Error(t, err)
+}
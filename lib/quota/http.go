@@ -0,0 +1,71 @@
+package quota
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Handler puts the quota of the token a request was made with into the
+// request context. It is meant to run behind auth.Handler, which already
+// rejected invalid tokens.
+type Handler struct {
+	// Parse returns the token info, false for tokens without a quota
+	Parse func(ctx context.Context, token string) (Token, bool, error)
+	Next  http.Handler
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.FormValue("token")
+	}
+	token = strings.TrimPrefix(token, "Bearer ")
+
+	if token != "" {
+		tok, ok, err := h.Parse(r.Context(), token)
+		if err != nil {
+			log.Warnf("parsing token quota (originating from %s): %s", r.RemoteAddr, err)
+			w.WriteHeader(401)
+			return
+		}
+		if ok {
+			r = r.WithContext(WithToken(r.Context(), tok))
+		}
+	}
+
+	h.Next.ServeHTTP(w, r)
+}
+
+// MeterRemote counts bytes served by next against the RemoteBytesPerDay
+// quota of the request token. Requests are refused once the quota is used
+// up; a response which crosses the quota is still served in full.
+func (t *Tracker) MeterRemote(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok, ok := TokenFromContext(r.Context())
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		if err := t.AllowRemote(tok); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		next(&meteredWriter{ResponseWriter: w, t: t, tok: tok}, r)
+	}
+}
+
+type meteredWriter struct {
+	http.ResponseWriter
+
+	t   *Tracker
+	tok Token
+}
+
+func (mw *meteredWriter) Write(p []byte) (int, error) {
+	n, err := mw.ResponseWriter.Write(p)
+	mw.t.AddRemote(mw.tok, uint64(n))
+	return n, err
+}
@@ -0,0 +1,206 @@
+package quota
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("quota")
+
+// ErrExceeded is returned when a token used up its quota
+var ErrExceeded = xerrors.New("API token quota exceeded")
+
+// Quota limits the usage of an API token, zero values mean no limit
+type Quota struct {
+	// RemoteBytesPerDay limits bytes served through /remote per UTC day
+	RemoteBytesPerDay uint64
+	// CallsPerMinute limits RPC calls per minute
+	CallsPerMinute uint64
+}
+
+// Token identifies a token with a quota
+type Token struct {
+	ID    string
+	Quota Quota
+}
+
+// Usage reports the usage of a token in the current windows
+type Usage struct {
+	TokenID string
+	Quota   Quota
+
+	RemoteBytesToday uint64
+	CallsThisMinute  uint64
+
+	TotalRemoteBytes uint64
+	TotalCalls       uint64
+
+	LastUsed time.Time
+}
+
+type counters struct {
+	day, minute time.Time
+
+	remoteBytes uint64
+	calls       uint64
+
+	totalRemoteBytes uint64
+	totalCalls       uint64
+
+	lastUsed time.Time
+}
+
+func (c *counters) roll(now time.Time) {
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(c.day) {
+		c.day = day
+		c.remoteBytes = 0
+	}
+	if minute := now.Truncate(time.Minute); !minute.Equal(c.minute) {
+		c.minute = minute
+		c.calls = 0
+	}
+}
+
+// Tracker keeps usage counters of tokens. Counters are kept in memory, so
+// they reset when the node restarts.
+type Tracker struct {
+	now func() time.Time
+
+	lk    sync.Mutex
+	usage map[string]*counters
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		now:   time.Now,
+		usage: map[string]*counters{},
+	}
+}
+
+func (t *Tracker) counters(id string) *counters {
+	c, ok := t.usage[id]
+	if !ok {
+		c = &counters{}
+		t.usage[id] = c
+	}
+	now := t.now()
+	c.roll(now)
+	c.lastUsed = now
+	return c
+}
+
+// Call counts an RPC call made with the token, it returns ErrExceeded when
+// the token already made CallsPerMinute calls this minute
+func (t *Tracker) Call(tok Token) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	c := t.counters(tok.ID)
+	if tok.Quota.CallsPerMinute > 0 && c.calls >= tok.Quota.CallsPerMinute {
+		return xerrors.Errorf("%d calls per minute: %w", tok.Quota.CallsPerMinute, ErrExceeded)
+	}
+	c.calls++
+	c.totalCalls++
+	return nil
+}
+
+// AllowRemote returns ErrExceeded when the token was already served
+// RemoteBytesPerDay bytes today
+func (t *Tracker) AllowRemote(tok Token) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	c := t.counters(tok.ID)
+	if tok.Quota.RemoteBytesPerDay > 0 && c.remoteBytes >= tok.Quota.RemoteBytesPerDay {
+		return xerrors.Errorf("%d remote bytes per day: %w", tok.Quota.RemoteBytesPerDay, ErrExceeded)
+	}
+	return nil
+}
+
+// AddRemote counts bytes served to the token
+func (t *Tracker) AddRemote(tok Token, n uint64) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	c := t.counters(tok.ID)
+	c.remoteBytes += n
+	c.totalRemoteBytes += n
+}
+
+// Usage returns the usage of a token
+func (t *Tracker) Usage(tok Token) Usage {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	out := Usage{
+		TokenID: tok.ID,
+		Quota:   tok.Quota,
+	}
+
+	c, ok := t.usage[tok.ID]
+	if !ok {
+		return out
+	}
+	c.roll(t.now())
+
+	out.RemoteBytesToday = c.remoteBytes
+	out.CallsThisMinute = c.calls
+	out.TotalRemoteBytes = c.totalRemoteBytes
+	out.TotalCalls = c.totalCalls
+	out.LastUsed = c.lastUsed
+	return out
+}
+
+type tokenKey struct{}
+
+// WithToken returns a context carrying the token a request was made with
+func WithToken(ctx context.Context, tok Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, tok)
+}
+
+// TokenFromContext returns the token carried by ctx
+func TokenFromContext(ctx context.Context) (Token, bool) {
+	tok, ok := ctx.Value(tokenKey{}).(Token)
+	return tok, ok
+}
+
+// Proxy fills the function fields of out with methods of in, counting calls
+// made with tokens carrying a quota. It works like auth.PermissionedProxy.
+func Proxy(t *Tracker, in interface{}, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := ra.MethodByName(field.Name)
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			ctx := args[0].Interface().(context.Context)
+			tok, ok := TokenFromContext(ctx)
+			if !ok {
+				return fn.Call(args)
+			}
+
+			err := t.Call(tok)
+			if err == nil {
+				return fn.Call(args)
+			}
+
+			err = xerrors.Errorf("calling '%s': %w", field.Name, err)
+			rerr := reflect.ValueOf(&err).Elem()
+
+			if field.Type.NumOut() == 2 {
+				return []reflect.Value{
+					reflect.Zero(field.Type.Out(0)),
+					rerr,
+				}
+			}
+			return []reflect.Value{rerr}
+		}))
+	}
+}
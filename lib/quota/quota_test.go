@@ -0,0 +1,93 @@
+package quota
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestCallQuota(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	tr := NewTracker()
+	tr.now = func() time.Time { return now }
+
+	tok := Token{ID: "a", Quota: Quota{CallsPerMinute: 2}}
+	require.NoError(t, tr.Call(tok))
+	require.NoError(t, tr.Call(tok))
+	require.True(t, xerrors.Is(tr.Call(tok), ErrExceeded))
+
+	// other tokens have their own counters
+	require.NoError(t, tr.Call(Token{ID: "b", Quota: Quota{CallsPerMinute: 2}}))
+
+	now = now.Add(time.Minute)
+	require.NoError(t, tr.Call(tok))
+
+	u := tr.Usage(tok)
+	require.Equal(t, uint64(1), u.CallsThisMinute)
+	require.Equal(t, uint64(3), u.TotalCalls)
+}
+
+type callAPI struct {
+	Internal struct {
+		Call func(context.Context) (int, error)
+	}
+}
+
+type impl struct{}
+
+func (impl) Call(context.Context) (int, error) {
+	return 1, nil
+}
+
+func TestProxy(t *testing.T) {
+	tr := NewTracker()
+
+	var out callAPI
+	Proxy(tr, impl{}, &out.Internal)
+
+	ctx := WithToken(context.Background(), Token{ID: "a", Quota: Quota{CallsPerMinute: 1}})
+	n, err := out.Internal.Call(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	_, err = out.Internal.Call(ctx)
+	require.True(t, xerrors.Is(err, ErrExceeded))
+
+	// tokens without a quota aren't counted
+	_, err = out.Internal.Call(context.Background())
+	require.NoError(t, err)
+}
+
+func TestMeterRemote(t *testing.T) {
+	tr := NewTracker()
+	tok := Token{ID: "a", Quota: Quota{RemoteBytesPerDay: 10}}
+
+	h := &Handler{
+		Parse: func(ctx context.Context, token string) (Token, bool, error) {
+			return tok, token == "quota", nil
+		},
+		Next: tr.MeterRemote(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(make([]byte, 6))
+		}),
+	}
+
+	serve := func(token string) int {
+		req := httptest.NewRequest("GET", "/remote/sealed/s-t01000-1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve("quota"))
+	require.Equal(t, http.StatusOK, serve("quota")) // crosses the quota
+	require.Equal(t, http.StatusTooManyRequests, serve("quota"))
+	require.Equal(t, http.StatusOK, serve("other"))
+
+	require.Equal(t, uint64(12), tr.Usage(tok).RemoteBytesToday)
+}
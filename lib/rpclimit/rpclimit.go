@@ -0,0 +1,261 @@
+package rpclimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("rpclimit")
+
+// ErrLimited is returned for calls over the configured limits
+var ErrLimited = xerrors.New("API rate limit exceeded")
+
+// IdleTimeout drops the state of clients without calls or connections for
+// this long
+var IdleTimeout = 10 * time.Minute
+
+// Config limits the API usage, zero values mean no limit. Token limits apply
+// to each API token separately, requests without a token are limited by the
+// remote address.
+type Config struct {
+	CallsPerSecond float64
+	Burst          int
+	MaxInFlight    int
+	MaxConnections int
+
+	TokenCallsPerSecond float64
+	TokenBurst          int
+	TokenMaxInFlight    int
+	TokenMaxConnections int
+
+	// Exempt methods are never limited, and don't count against the limits
+	Exempt []string
+}
+
+type client struct {
+	lim      *rate.Limiter
+	inFlight int
+	conns    int
+	seen     time.Time
+}
+
+// Limiter enforces a Config on the RPC calls and connections of an API
+// server
+type Limiter struct {
+	cfg    Config
+	exempt map[string]struct{}
+	lim    *rate.Limiter
+
+	lk       sync.Mutex
+	inFlight int
+	conns    int
+	clients  map[string]*client
+	pruned   time.Time
+}
+
+func New(cfg Config) *Limiter {
+	l := &Limiter{
+		cfg:     cfg,
+		exempt:  map[string]struct{}{},
+		clients: map[string]*client{},
+	}
+	if cfg.CallsPerSecond > 0 {
+		l.lim = rate.NewLimiter(rate.Limit(cfg.CallsPerSecond), burst(cfg.Burst, cfg.CallsPerSecond))
+	}
+	for _, m := range cfg.Exempt {
+		l.exempt[m] = struct{}{}
+	}
+	return l
+}
+
+func burst(b int, rps float64) int {
+	if b > 0 {
+		return b
+	}
+	if rps < 1 {
+		return 1
+	}
+	return int(rps)
+}
+
+type clientKey struct{}
+
+// Handler identifies the client of requests, and caps the number of
+// connections open at once. Websocket connections count for as long as they
+// stay open.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := clientID(r)
+
+		if err := l.connect(id); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer l.disconnect(id)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, id)))
+	})
+}
+
+func clientID(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.FormValue("token")
+	}
+	token = strings.TrimPrefix(token, "Bearer ")
+	if token != "" {
+		h := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(h[:8])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// client returns the state of a client, must be called with l.lk held
+func (l *Limiter) client(id string, now time.Time) *client {
+	if now.Sub(l.pruned) > IdleTimeout {
+		for cid, c := range l.clients {
+			if c.inFlight == 0 && c.conns == 0 && now.Sub(c.seen) > IdleTimeout {
+				delete(l.clients, cid)
+			}
+		}
+		l.pruned = now
+	}
+
+	c, ok := l.clients[id]
+	if !ok {
+		c = &client{}
+		if l.cfg.TokenCallsPerSecond > 0 {
+			c.lim = rate.NewLimiter(rate.Limit(l.cfg.TokenCallsPerSecond), burst(l.cfg.TokenBurst, l.cfg.TokenCallsPerSecond))
+		}
+		l.clients[id] = c
+	}
+	c.seen = now
+	return c
+}
+
+func (l *Limiter) connect(id string) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	c := l.client(id, time.Now())
+	if l.cfg.MaxConnections > 0 && l.conns >= l.cfg.MaxConnections {
+		log.Debugw("too many API connections", "client", id, "limit", l.cfg.MaxConnections)
+		return xerrors.Errorf("%d connections: %w", l.cfg.MaxConnections, ErrLimited)
+	}
+	if l.cfg.TokenMaxConnections > 0 && c.conns >= l.cfg.TokenMaxConnections {
+		log.Debugw("too many API connections for client", "client", id, "limit", l.cfg.TokenMaxConnections)
+		return xerrors.Errorf("%d connections per token: %w", l.cfg.TokenMaxConnections, ErrLimited)
+	}
+	l.conns++
+	c.conns++
+	return nil
+}
+
+func (l *Limiter) disconnect(id string) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	l.conns--
+	l.client(id, time.Now()).conns--
+}
+
+// acquire admits a call, the returned function must be called when the call
+// returns. Calls over the limits are rejected right away rather than queued,
+// so clients see the error instead of timing out.
+func (l *Limiter) acquire(ctx context.Context, method string) (func(), error) {
+	if _, ok := l.exempt[method]; ok {
+		return func() {}, nil
+	}
+
+	id, _ := ctx.Value(clientKey{}).(string)
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	now := time.Now()
+	if l.cfg.MaxInFlight > 0 && l.inFlight >= l.cfg.MaxInFlight {
+		log.Debugw("too many API calls in flight", "method", method, "client", id)
+		return nil, xerrors.Errorf("%d calls in flight: %w", l.cfg.MaxInFlight, ErrLimited)
+	}
+
+	var c *client
+	if id != "" {
+		c = l.client(id, now)
+		if l.cfg.TokenMaxInFlight > 0 && c.inFlight >= l.cfg.TokenMaxInFlight {
+			log.Debugw("too many API calls in flight for client", "method", method, "client", id)
+			return nil, xerrors.Errorf("%d calls in flight per token: %w", l.cfg.TokenMaxInFlight, ErrLimited)
+		}
+		if c.lim != nil && !c.lim.AllowN(now, 1) {
+			log.Debugw("API call rate of client over limit", "method", method, "client", id)
+			return nil, xerrors.Errorf("%g calls per second per token: %w", l.cfg.TokenCallsPerSecond, ErrLimited)
+		}
+	}
+	if l.lim != nil && !l.lim.AllowN(now, 1) {
+		log.Debugw("API call rate over limit", "method", method, "client", id)
+		return nil, xerrors.Errorf("%g calls per second: %w", l.cfg.CallsPerSecond, ErrLimited)
+	}
+
+	l.inFlight++
+	if c != nil {
+		c.inFlight++
+	}
+
+	return func() {
+		l.lk.Lock()
+		defer l.lk.Unlock()
+
+		l.inFlight--
+		if c != nil {
+			c.inFlight--
+		}
+	}, nil
+}
+
+// Proxy fills the function fields of out with methods of in, rejecting calls
+// over the limits. It works like auth.PermissionedProxy.
+func Proxy(l *Limiter, in interface{}, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := ra.MethodByName(field.Name)
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			ctx := args[0].Interface().(context.Context)
+
+			release, err := l.acquire(ctx, field.Name)
+			if err == nil {
+				defer release()
+				return fn.Call(args)
+			}
+
+			err = xerrors.Errorf("calling '%s': %w", field.Name, err)
+			rerr := reflect.ValueOf(&err).Elem()
+
+			if field.Type.NumOut() == 2 {
+				return []reflect.Value{
+					reflect.Zero(field.Type.Out(0)),
+					rerr,
+				}
+			}
+			return []reflect.Value{rerr}
+		}))
+	}
+}
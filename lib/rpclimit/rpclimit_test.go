@@ -0,0 +1,143 @@
+package rpclimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func withClient(id string) context.Context {
+	return context.WithValue(context.Background(), clientKey{}, id)
+}
+
+func TestCallRate(t *testing.T) {
+	l := New(Config{TokenCallsPerSecond: 0.001, TokenBurst: 2, Exempt: []string{"WorkerConnect"}})
+
+	ctx := withClient("a")
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(ctx, "ChainHead")
+		require.NoError(t, err)
+		release()
+	}
+	_, err := l.acquire(ctx, "ChainHead")
+	require.True(t, xerrors.Is(err, ErrLimited))
+
+	// exempt methods and other clients still go through
+	_, err = l.acquire(ctx, "WorkerConnect")
+	require.NoError(t, err)
+	_, err = l.acquire(withClient("b"), "ChainHead")
+	require.NoError(t, err)
+}
+
+func TestInFlight(t *testing.T) {
+	l := New(Config{MaxInFlight: 3, TokenMaxInFlight: 2})
+
+	a := withClient("a")
+	r1, err := l.acquire(a, "ChainHead")
+	require.NoError(t, err)
+	_, err = l.acquire(a, "ChainHead")
+	require.NoError(t, err)
+	_, err = l.acquire(a, "ChainHead")
+	require.True(t, xerrors.Is(err, ErrLimited), "token limit")
+
+	_, err = l.acquire(withClient("b"), "ChainHead")
+	require.NoError(t, err)
+	_, err = l.acquire(withClient("c"), "ChainHead")
+	require.True(t, xerrors.Is(err, ErrLimited), "global limit")
+
+	r1()
+	_, err = l.acquire(withClient("c"), "ChainHead")
+	require.NoError(t, err)
+}
+
+type callAPI struct {
+	Internal struct {
+		Call func(context.Context) (int, error)
+	}
+}
+
+type impl struct {
+	block chan struct{}
+}
+
+func (i impl) Call(context.Context) (int, error) {
+	<-i.block
+	return 1, nil
+}
+
+func TestProxy(t *testing.T) {
+	l := New(Config{MaxInFlight: 1})
+
+	var out callAPI
+	in := impl{block: make(chan struct{})}
+	Proxy(l, in, &out.Internal)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := out.Internal.Call(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}()
+	require.Eventually(t, func() bool {
+		l.lk.Lock()
+		defer l.lk.Unlock()
+		return l.inFlight == 1
+	}, time.Second, time.Millisecond)
+
+	_, err := out.Internal.Call(context.Background())
+	require.True(t, xerrors.Is(err, ErrLimited))
+
+	close(in.block)
+	<-done
+	n, err := out.Internal.Call(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestConnections(t *testing.T) {
+	l := New(Config{MaxConnections: 2, TokenMaxConnections: 1})
+
+	block := make(chan struct{})
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("block") != "" {
+			<-block
+		}
+	}))
+
+	serve := func(token string, block bool) int {
+		url := "/rpc/v0"
+		if block {
+			url += "?block=1"
+		}
+		r := httptest.NewRequest("POST", url, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	go serve("a", true)
+	require.Eventually(t, func() bool {
+		l.lk.Lock()
+		defer l.lk.Unlock()
+		return l.conns == 1
+	}, time.Second, time.Millisecond)
+
+	require.Equal(t, http.StatusServiceUnavailable, serve("a", false), "token limit")
+	go serve("b", true)
+	require.Eventually(t, func() bool {
+		l.lk.Lock()
+		defer l.lk.Unlock()
+		return l.conns == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, http.StatusServiceUnavailable, serve("c", false), "global limit")
+
+	close(block)
+	require.Eventually(t, func() bool { return serve("c", false) == http.StatusOK }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,234 @@
+package rpctrace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("rpctrace")
+
+// Redacted replaces secrets in recorded calls
+const Redacted = "<redacted>"
+
+// secretParams and secretResults are the methods taking or returning secrets
+// as a whole, other secrets are found by their field names
+var (
+	secretParams = map[string]bool{
+		"AuthVerify":   true,
+		"WalletImport": true,
+	}
+	secretResults = map[string]bool{
+		"AuthNew":           true,
+		"AuthNewWithQuota":  true,
+		"WalletExport":      true,
+		"WorkerTokenCreate": true,
+	}
+)
+
+// Call is a recorded RPC call, one JSON object per line in the trace file
+type Call struct {
+	Time     time.Time
+	Method   string
+	Params   []json.RawMessage
+	Result   json.RawMessage `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+	Duration time.Duration
+
+	// Redacted calls had secrets removed from their params, they're not sent
+	// again on replay
+	Redacted bool `json:",omitempty"`
+	// Stream calls take readers or return channels, for which only the
+	// placeholder is recorded, they're not sent again on replay
+	Stream bool `json:",omitempty"`
+}
+
+// Replayable returns whether the call can be sent again as it was recorded
+func (c *Call) Replayable() bool {
+	return !c.Redacted && !c.Stream
+}
+
+// Recorder appends the calls made through Proxy to a trace file
+type Recorder struct {
+	lk  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// Open starts recording to the trace file at path, appending to it if it
+// exists already
+func Open(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("opening API trace file: %w", err)
+	}
+	log.Warnw("recording API calls, don't share the trace file without checking it", "path", path)
+	return &Recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *Recorder) Close() error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.f.Close()
+}
+
+func (r *Recorder) record(c *Call) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if err := r.enc.Encode(c); err != nil {
+		log.Errorw("recording API call", "method", c.Method, "error", err)
+	}
+}
+
+// Proxy fills the function fields of out with methods of in, recording each
+// call. It works like auth.PermissionedProxy.
+func Proxy(r *Recorder, in interface{}, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := ra.MethodByName(field.Name)
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			c := &Call{
+				Time:   time.Now(),
+				Method: field.Name,
+			}
+			// skip the context
+			for _, arg := range args[1:] {
+				b, redacted, stream := encode(arg, secretParams[field.Name])
+				c.Params = append(c.Params, b)
+				c.Redacted = c.Redacted || redacted
+				c.Stream = c.Stream || stream
+			}
+
+			results = fn.Call(args)
+			c.Duration = time.Since(c.Time)
+
+			if err, _ := results[len(results)-1].Interface().(error); err != nil {
+				c.Error = err.Error()
+			}
+			if len(results) == 2 {
+				if results[0].Kind() == reflect.Chan {
+					c.Stream = true
+					c.Result = json.RawMessage(`"<channel>"`)
+				} else if c.Error == "" {
+					// redacted results don't keep the call from being replayed
+					c.Result, _, _ = encode(results[0], secretResults[field.Name])
+				}
+			}
+
+			r.record(c)
+			return results
+		}))
+	}
+}
+
+// EncodeParams encodes the params of a call to method, without the context,
+// with secrets redacted as they're recorded
+func EncodeParams(method string, args []reflect.Value) []json.RawMessage {
+	out := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		out[i], _, _ = encode(arg, secretParams[method])
+	}
+	return out
+}
+
+// encode encodes a param or result of a call, redacting secrets. It also
+// returns whether anything was redacted, and whether the value is a stream
+// which can't be recorded.
+func encode(v reflect.Value, secret bool) (json.RawMessage, bool, bool) {
+	if secret {
+		return json.RawMessage(`"` + Redacted + `"`), true, false
+	}
+	if _, ok := v.Interface().(io.Reader); ok {
+		return json.RawMessage(`"<reader>"`), false, true
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return json.RawMessage(`"<unencodable>"`), false, true
+	}
+
+	var d interface{}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return b, false, false
+	}
+	d, redacted := redact(d)
+	if !redacted {
+		return b, false, false
+	}
+	// keep the placeholders readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(d); err != nil {
+		return json.RawMessage(`"` + Redacted + `"`), true, false
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), true, false
+}
+
+// redact replaces the values of fields whose names look like secrets
+func redact(d interface{}) (interface{}, bool) {
+	var redacted bool
+	switch d := d.(type) {
+	case map[string]interface{}:
+		for k, v := range d {
+			if secretKey(k) {
+				d[k] = Redacted
+				redacted = true
+				continue
+			}
+			var r bool
+			d[k], r = redact(v)
+			redacted = redacted || r
+		}
+	case []interface{}:
+		for i, v := range d {
+			var r bool
+			d[i], r = redact(v)
+			redacted = redacted || r
+		}
+	}
+	return d, redacted
+}
+
+func secretKey(k string) bool {
+	k = strings.ToLower(k)
+	return k == "privatekey" || strings.HasSuffix(k, "token") || strings.Contains(k, "password") || strings.Contains(k, "secret")
+}
+
+// ReadCalls reads the calls recorded in a trace file
+func ReadCalls(ctx context.Context, r io.Reader, cb func(*Call) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var c Call
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return xerrors.Errorf("decoding call on line %d: %w", line, err)
+		}
+		if err := cb(&c); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,99 @@
+package rpctrace
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type keyInfo struct {
+	Type       string
+	PrivateKey []byte
+}
+
+type impl struct{}
+
+func (impl) Version(context.Context) (string, error) { return "1.0", nil }
+func (impl) Fail(context.Context, int) error         { return xerrors.New("failed") }
+func (impl) WalletExport(context.Context, string) (*keyInfo, error) {
+	return &keyInfo{"bls", []byte{1}}, nil
+}
+func (impl) Import(context.Context, keyInfo) (string, error) { return "f3abc", nil }
+func (impl) AddPiece(context.Context, io.Reader) error       { return nil }
+
+type traced struct {
+	Internal struct {
+		Version      func(context.Context) (string, error)
+		Fail         func(context.Context, int) error
+		WalletExport func(context.Context, string) (*keyInfo, error)
+		Import       func(context.Context, keyInfo) (string, error)
+		AddPiece     func(context.Context, io.Reader) error
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpctrace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	path := filepath.Join(dir, "trace.jsonl")
+	r, err := Open(path)
+	require.NoError(t, err)
+
+	var out traced
+	Proxy(r, impl{}, &out.Internal)
+
+	ctx := context.Background()
+	v, err := out.Internal.Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "1.0", v)
+	require.Error(t, out.Internal.Fail(ctx, 3))
+	ki, err := out.Internal.WalletExport(ctx, "f3abc")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, ki.PrivateKey, "the caller gets the real result")
+	_, err = out.Internal.Import(ctx, keyInfo{"bls", []byte{2}})
+	require.NoError(t, err)
+	require.NoError(t, out.Internal.AddPiece(ctx, strings.NewReader("data")))
+	require.NoError(t, r.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), `"AQ=="`)
+	require.NotContains(t, string(b), `"Ag=="`)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close() //nolint:errcheck
+
+	var calls []*Call
+	require.NoError(t, ReadCalls(ctx, f, func(c *Call) error {
+		calls = append(calls, c)
+		return nil
+	}))
+	require.Len(t, calls, 5)
+
+	require.Equal(t, "Version", calls[0].Method)
+	require.JSONEq(t, `"1.0"`, string(calls[0].Result))
+	require.True(t, calls[0].Replayable())
+
+	require.Equal(t, "failed", calls[1].Error)
+	require.JSONEq(t, `3`, string(calls[1].Params[0]))
+	require.True(t, calls[1].Replayable())
+
+	// a secret result doesn't keep the call from being replayed
+	require.JSONEq(t, `"<redacted>"`, string(calls[2].Result))
+	require.True(t, calls[2].Replayable())
+
+	require.JSONEq(t, `{"Type":"bls","PrivateKey":"<redacted>"}`, string(calls[3].Params[0]))
+	require.False(t, calls[3].Replayable())
+
+	require.True(t, calls[4].Stream)
+	require.False(t, calls[4].Replayable())
+}
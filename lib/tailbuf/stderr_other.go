@@ -0,0 +1,9 @@
+// +build !darwin,!linux,!netbsd,!openbsd
+
+package tailbuf
+
+import "golang.org/x/xerrors"
+
+func CaptureStderr(b *Buffer) error {
+	return xerrors.New("capturing stderr is not supported on this platform")
+}
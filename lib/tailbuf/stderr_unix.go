@@ -0,0 +1,52 @@
+// +build darwin linux netbsd openbsd
+
+package tailbuf
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// CaptureStderr copies everything the process writes to stderr, including
+// output of C libraries, to b. Output still goes to the original stderr.
+func CaptureStderr(b *Buffer) error {
+	orig, err := unix.Dup(int(os.Stderr.Fd()))
+	if err != nil {
+		return xerrors.Errorf("duplicating stderr: %w", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		_ = unix.Close(orig)
+		return xerrors.Errorf("creating pipe: %w", err)
+	}
+
+	if err := unix.Dup2(int(w.Fd()), int(os.Stderr.Fd())); err != nil {
+		_ = unix.Close(orig)
+		_ = r.Close()
+		_ = w.Close()
+		return xerrors.Errorf("redirecting stderr: %w", err)
+	}
+	_ = w.Close()
+
+	out := os.NewFile(uintptr(orig), "stderr")
+	go func() {
+		// keep reading when the original stderr fails, a full pipe would
+		// block every write to stderr
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				_, _ = b.Write(buf[:n])
+				_, _ = out.Write(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package tailbuf keeps the last bytes written to a stream, e.g. the stderr
+// output of a worker preceding a task failure
+package tailbuf
+
+import (
+	"sync"
+)
+
+// Buffer is an io.Writer keeping the last max bytes written to it
+type Buffer struct {
+	lk  sync.Mutex
+	buf []byte
+	max int
+}
+
+func New(max int) *Buffer {
+	return &Buffer{max: max}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	if len(p) >= b.max {
+		b.buf = append(b.buf[:0], p[len(p)-b.max:]...)
+		return len(p), nil
+	}
+
+	if over := len(b.buf) + len(p) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// String returns the buffered tail
+func (b *Buffer) String() string {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	return string(b.buf)
+}
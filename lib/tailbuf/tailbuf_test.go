@@ -0,0 +1,21 @@
+package tailbuf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuffer(t *testing.T) {
+	b := New(8)
+
+	_, _ = b.Write([]byte("abc"))
+	require.Equal(t, "abc", b.String())
+
+	_, _ = b.Write([]byte("defghi"))
+	require.Equal(t, "bcdefghi", b.String())
+
+	_, _ = b.Write([]byte(strings.Repeat("x", 10) + "end"))
+	require.Equal(t, "xxxxxend", b.String())
+}
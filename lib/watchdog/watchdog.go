@@ -0,0 +1,234 @@
+package watchdog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("watchdog")
+
+// Monitor tracks the progress of a critical loop. The loop marks each unit of
+// work with Busy; a unit which doesn't finish within the timeout means that the
+// loop is stuck. Idle loops are never considered stuck.
+type Monitor struct {
+	name    string
+	timeout time.Duration
+
+	lk       sync.Mutex
+	next     uint64
+	active   map[uint64]time.Time
+	dumped   bool
+	restarts map[uint64]func()
+}
+
+var (
+	registryLk sync.Mutex
+	registry   = map[string]*Monitor{}
+)
+
+// Register returns the monitor for the named loop, creating it on first use
+func Register(name string, timeout time.Duration) *Monitor {
+	registryLk.Lock()
+	defer registryLk.Unlock()
+
+	if m, ok := registry[name]; ok {
+		return m
+	}
+
+	m := &Monitor{
+		name:     name,
+		timeout:  timeout,
+		active:   map[uint64]time.Time{},
+		restarts: map[uint64]func(){},
+	}
+	registry[name] = m
+	return m
+}
+
+// Busy marks the start of a unit of work, the returned func marks its end
+func (m *Monitor) Busy() func() {
+	m.lk.Lock()
+	id := m.next
+	m.next++
+	m.active[id] = time.Now()
+	m.lk.Unlock()
+
+	return func() {
+		m.lk.Lock()
+		delete(m.active, id)
+		if len(m.active) == 0 {
+			m.dumped = false
+		}
+		m.lk.Unlock()
+	}
+}
+
+// OnRestart adds a function called to restart the loop when it's stuck and
+// restarts are enabled; the returned func removes it again. Restarts are best
+// effort, e.g. cancelling a context doesn't help a loop stuck on a mutex.
+func (m *Monitor) OnRestart(restart func()) func() {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	id := m.next
+	m.next++
+	m.restarts[id] = restart
+
+	return func() {
+		m.lk.Lock()
+		defer m.lk.Unlock()
+
+		delete(m.restarts, id)
+	}
+}
+
+// busy returns how long the oldest unfinished unit of work runs, must be
+// called with m.lk held
+func (m *Monitor) busy(now time.Time) time.Duration {
+	var oldest time.Duration
+	for _, start := range m.active {
+		if d := now.Sub(start); d > oldest {
+			oldest = d
+		}
+	}
+	return oldest
+}
+
+// stuck returns for how long the oldest unit of work has been running, if
+// longer than the timeout, whether stacks were already dumped for it, and the
+// functions restarting the loop
+func (m *Monitor) stuck(now time.Time) (time.Duration, bool, []func()) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	oldest := m.busy(now)
+	if oldest <= m.timeout {
+		return 0, false, nil
+	}
+
+	dumped := m.dumped
+	m.dumped = true
+
+	restarts := make([]func(), 0, len(m.restarts))
+	for _, r := range m.restarts {
+		restarts = append(restarts, r)
+	}
+
+	return oldest, dumped, restarts
+}
+
+// Stuck returns the names of the loops which are stuck at now, sorted
+func Stuck(now time.Time) []string {
+	registryLk.Lock()
+	defer registryLk.Unlock()
+
+	var out []string
+	for name, m := range registry {
+		m.lk.Lock()
+		if m.busy(now) > m.timeout {
+			out = append(out, name)
+		}
+		m.lk.Unlock()
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Watchdog periodically checks all registered monitors, dumping goroutine
+// stacks into a directory when a loop gets stuck
+type Watchdog struct {
+	dir      string
+	interval time.Duration
+	restart  bool
+}
+
+func New(dir string, interval time.Duration, restart bool) (*Watchdog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating watchdog directory: %w", err)
+	}
+
+	return &Watchdog{
+		dir:      dir,
+		interval: interval,
+		restart:  restart,
+	}, nil
+}
+
+func (w *Watchdog) Run(ctx context.Context) {
+	if w.interval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		w.check(time.Now())
+	}
+}
+
+func (w *Watchdog) check(now time.Time) {
+	registryLk.Lock()
+	monitors := make([]*Monitor, 0, len(registry))
+	for _, m := range registry {
+		monitors = append(monitors, m)
+	}
+	registryLk.Unlock()
+
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].name < monitors[j].name
+	})
+
+	for _, m := range monitors {
+		d, dumped, restarts := m.stuck(now)
+		if d == 0 || dumped {
+			continue
+		}
+
+		log.Errorw("loop not making progress", "loop", m.name, "busy", d.Round(time.Second), "timeout", m.timeout)
+
+		if path, err := w.dump(now, m.name); err != nil {
+			log.Errorf("dumping goroutines: %+v", err)
+		} else {
+			log.Errorw("dumped goroutine stacks", "loop", m.name, "path", path)
+		}
+
+		if w.restart && len(restarts) > 0 {
+			log.Warnw("restarting stuck loop", "loop", m.name)
+			for _, r := range restarts {
+				r()
+			}
+		}
+	}
+}
+
+func (w *Watchdog) dump(now time.Time, name string) (string, error) {
+	path := filepath.Join(w.dir, strconv.FormatInt(now.Unix(), 10)+"-"+name+".txt")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+
+	return path, f.Close()
+}
@@ -0,0 +1,57 @@
+package watchdog
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	wd, err := New(dir, time.Second, true)
+	require.NoError(t, err)
+
+	m := Register("test-loop", time.Minute)
+	var restarts int
+	remove := m.OnRestart(func() { restarts++ })
+
+	dumps := func() int {
+		ents, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		return len(ents)
+	}
+
+	// idle loops aren't stuck
+	wd.check(time.Now().Add(time.Hour))
+	require.Equal(t, 0, dumps())
+
+	done := m.Busy()
+	wd.check(time.Now())
+	require.Equal(t, 0, dumps())
+
+	wd.check(time.Now().Add(2 * time.Minute))
+	require.Equal(t, 1, dumps())
+	require.Equal(t, 1, restarts)
+	require.Contains(t, Stuck(time.Now().Add(2*time.Minute)), "test-loop")
+
+	// only dumped once per stall
+	wd.check(time.Now().Add(3 * time.Minute))
+	require.Equal(t, 1, dumps())
+	require.Equal(t, 1, restarts)
+
+	done()
+	remove()
+	require.NotContains(t, Stuck(time.Now().Add(time.Hour)), "test-loop")
+
+	done = m.Busy()
+	wd.check(time.Now().Add(10 * time.Minute))
+	done()
+	require.Equal(t, 2, dumps())
+	require.Equal(t, 1, restarts)
+}
@@ -0,0 +1,116 @@
+package dealguard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+)
+
+var log = logging.Logger("dealguard")
+
+const (
+	// MaxLabelLength is the longest deal label accepted, in bytes
+	MaxLabelLength = 256
+	// ReplayWindow is how long a proposal is remembered, proposals seen
+	// again within it are rejected
+	ReplayWindow = time.Hour
+
+	replayCacheSize = 8192
+)
+
+// Guard checks storage deal proposals before any resources are spent on
+// them: the client signature must be valid, the label must be printable
+// text, and the same proposal can't be made twice within the replay window.
+type Guard struct {
+	spn storagemarket.StorageProviderNode
+
+	lk   sync.Mutex
+	seen *lru.Cache // proposal cid -> time.Time
+}
+
+func New(spn storagemarket.StorageProviderNode) (*Guard, error) {
+	seen, err := lru.New(replayCacheSize)
+	if err != nil {
+		return nil, xerrors.Errorf("creating replay cache: %w", err)
+	}
+
+	return &Guard{
+		spn:  spn,
+		seen: seen,
+	}, nil
+}
+
+// Check returns whether the deal is acceptable, with a reason for the client
+// when it isn't
+func (g *Guard) Check(ctx context.Context, deal storagemarket.MinerDeal) (bool, string, error) {
+	if reason := checkLabel(deal.Proposal.Label); reason != "" {
+		log.Warnw("rejecting storage deal proposal with bad label", "proposal", deal.ProposalCid, "client", deal.Client, "reason", reason)
+		return false, reason, nil
+	}
+
+	buf, err := cborutil.Dump(&deal.Proposal)
+	if err != nil {
+		return false, "miner error", xerrors.Errorf("serializing proposal: %w", err)
+	}
+
+	tok, _, err := g.spn.GetChainHead(ctx)
+	if err != nil {
+		return false, "miner error", xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	ok, err := g.spn.VerifySignature(ctx, deal.ClientSignature, deal.Proposal.Client, buf, tok)
+	if err != nil {
+		return false, "miner error", xerrors.Errorf("verifying proposal signature: %w", err)
+	}
+	if !ok {
+		log.Warnw("rejecting storage deal proposal with invalid signature", "proposal", deal.ProposalCid, "client", deal.Client)
+		return false, "invalid proposal signature", nil
+	}
+
+	if g.replayed(deal.ProposalCid, time.Now()) {
+		log.Warnw("rejecting replayed storage deal proposal", "proposal", deal.ProposalCid, "client", deal.Client)
+		return false, fmt.Sprintf("proposal %s was already received", deal.ProposalCid), nil
+	}
+
+	return true, "", nil
+}
+
+// replayed records the proposal and returns whether it was already seen
+// within the replay window
+func (g *Guard) replayed(proposal cid.Cid, now time.Time) bool {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	if v, ok := g.seen.Get(proposal); ok && now.Sub(v.(time.Time)) < ReplayWindow {
+		return true
+	}
+
+	g.seen.Add(proposal, now)
+	return false
+}
+
+func checkLabel(label string) string {
+	if len(label) > MaxLabelLength {
+		return fmt.Sprintf("deal label longer than %d bytes", MaxLabelLength)
+	}
+	if !utf8.ValidString(label) {
+		return "deal label isn't valid UTF-8"
+	}
+	for _, r := range label {
+		if !unicode.IsPrint(r) {
+			return "deal label contains non-printable characters"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package dealguard
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+)
+
+type fakeNode struct {
+	storagemarket.StorageProviderNode
+	valid []byte
+}
+
+func (n *fakeNode) GetChainHead(ctx context.Context) (shared.TipSetToken, abi.ChainEpoch, error) {
+	return nil, 10, nil
+}
+
+func (n *fakeNode) VerifySignature(ctx context.Context, sig crypto.Signature, signer address.Address, plaintext []byte, tok shared.TipSetToken) (bool, error) {
+	return bytes.Equal(sig.Data, n.valid), nil
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+
+	g, err := New(&fakeNode{valid: []byte("good")})
+	require.NoError(t, err)
+
+	deal := func(label string, sig string) storagemarket.MinerDeal {
+		return storagemarket.MinerDeal{
+			ClientDealProposal: market0.ClientDealProposal{
+				Proposal: market0.DealProposal{
+					PieceCID: tutils.MakeCID("piece", &market0.PieceCIDPrefix),
+					Client:   tutils.NewIDAddr(t, 100),
+					Provider: tutils.NewIDAddr(t, 101),
+					Label:    label,
+				},
+				ClientSignature: crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: []byte(sig)},
+			},
+			ProposalCid: tutils.MakeCID(label+sig, nil),
+		}
+	}
+
+	ok, reason, err := g.Check(ctx, deal("my data", "bad"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "invalid proposal signature", reason)
+
+	ok, _, err = g.Check(ctx, deal("my data", "good"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, reason, err = g.Check(ctx, deal("my data", "good"))
+	require.NoError(t, err)
+	require.False(t, ok, "replayed proposal")
+	require.Contains(t, reason, "already received")
+
+	ok, _, err = g.Check(ctx, deal("bell\a", "good"))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, _, err = g.Check(ctx, deal(strings.Repeat("a", MaxLabelLength+1), "good"))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// proposals are accepted again after the replay window
+	d := deal("later", "good")
+	require.False(t, g.replayed(d.ProposalCid, time.Now().Add(-2*ReplayWindow)))
+	require.False(t, g.replayed(d.ProposalCid, time.Now()))
+	require.True(t, g.replayed(d.ProposalCid, time.Now()))
+}
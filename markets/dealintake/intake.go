@@ -0,0 +1,654 @@
+package dealintake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("dealintake")
+
+var (
+	CallbackTimeout = 10 * time.Second
+	// failed callbacks are retried with backoff doubling from CallbackBackoff
+	// up to CallbackMaxBackoff, and dropped once older than CallbackMaxAge
+	CallbackBackoff    = 5 * time.Second
+	CallbackMaxBackoff = 10 * time.Minute
+	CallbackMaxAge     = 24 * time.Hour
+)
+
+var dsPrefix = datastore.NewKey("/deals/intake")
+
+// undelivered callbacks are kept next to the intake entries
+var callbacksKey = datastore.NewKey("/callbacks")
+
+// Events of the intake itself, next to the storagemarket.ProviderEvents
+const (
+	EventQueued           = "IntakeQueued"
+	EventProposalReceived = "IntakeProposalReceived"
+	EventDataImported     = "IntakeDataImported"
+	EventDataImportFailed = "IntakeDataImportFailed"
+)
+
+// Callback is the body POSTed to the callback URL of an intake entry on every
+// state change of the deal
+type Callback struct {
+	ProposalCid cid.Cid
+
+	Event     string
+	State     storagemarket.StorageDealStatus
+	StateName string
+	Message   string
+	DealID    abi.DealID
+}
+
+// Intake is a queue of offline storage deals submitted by external order
+// systems. An order system makes the deal proposal with the client, queues
+// it here with the deal data, and gets the proposal CID identifying the deal
+// right away. Data is imported in the background once the client proposed
+// the deal, and state changes of the deal are reported to per-deal callback
+// URLs.
+type Intake struct {
+	ds       datastore.Batching
+	provider storagemarket.StorageProvider
+	maddr    address.Address
+
+	lk      sync.Mutex
+	entries map[cid.Cid]*api.DealIntake
+	pending []cid.Cid
+
+	notify chan struct{}
+
+	// callbacks are persisted until delivered, and delivered in order with a
+	// queue per URL, so that a slow endpoint doesn't hold up the others.
+	// Callbacks which can't be delivered within CallbackMaxAge are dropped.
+	cbLk       sync.Mutex
+	cbNext     uint64
+	callbacks  map[string][]*callbackReq
+	delivering map[string]bool
+	cbWg       sync.WaitGroup
+
+	unsub func()
+
+	started bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type callbackReq struct {
+	Seq     uint64
+	URL     string
+	Body    Callback
+	Created time.Time
+}
+
+func New(ds dtypes.MetadataDS, provider storagemarket.StorageProvider, maddr dtypes.MinerAddress) *Intake {
+	return &Intake{
+		ds:       namespace.Wrap(ds, dsPrefix),
+		provider: provider,
+		maddr:    address.Address(maddr),
+
+		entries: map[cid.Cid]*api.DealIntake{},
+
+		notify: make(chan struct{}, 1),
+
+		callbacks:  map[string][]*callbackReq{},
+		delivering: map[string]bool{},
+
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (in *Intake) Start(ctx context.Context) error {
+	res, err := in.ds.Query(query.Query{})
+	if err != nil {
+		return xerrors.Errorf("querying intake entries: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	in.lk.Lock()
+	rekey := map[string]*api.DealIntake{}
+	var cbs []*callbackReq
+	for r := range res.Next() {
+		if r.Error != nil {
+			in.lk.Unlock()
+			return xerrors.Errorf("reading intake entries: %w", r.Error)
+		}
+
+		if callbacksKey.IsAncestorOf(datastore.NewKey(r.Key)) {
+			var cb callbackReq
+			if err := json.Unmarshal(r.Value, &cb); err != nil {
+				log.Errorw("decoding callback", "key", r.Key, "error", err)
+				continue
+			}
+			cbs = append(cbs, &cb)
+			continue
+		}
+
+		var e api.DealIntake
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			log.Errorw("decoding intake entry", "key", r.Key, "error", err)
+			continue
+		}
+		in.entries[e.ProposalCid] = &e
+
+		if r.Key != datastore.NewKey(e.ProposalCid.String()).String() {
+			// entries used to be keyed by an intake ID
+			rekey[r.Key] = &e
+		}
+	}
+	for k, e := range rekey {
+		if err := in.persist(e); err != nil {
+			in.lk.Unlock()
+			return err
+		}
+		if err := in.ds.Delete(datastore.NewKey(k)); err != nil {
+			in.lk.Unlock()
+			return xerrors.Errorf("removing old intake entry: %w", err)
+		}
+	}
+	in.started = true
+	in.lk.Unlock()
+
+	in.unsub = in.provider.SubscribeToEvents(in.onEvent)
+
+	// deals proposed while the intake wasn't running
+	deals, err := in.provider.ListLocalDeals()
+	if err != nil {
+		return xerrors.Errorf("listing deals: %w", err)
+	}
+	for _, deal := range deals {
+		in.update(deal, "")
+	}
+
+	in.lk.Lock()
+	for _, e := range in.entries {
+		if in.waitingForData(e) && !in.isPending(e.ProposalCid) {
+			in.pending = append(in.pending, e.ProposalCid)
+		}
+	}
+	sort.Slice(in.pending, func(i, j int) bool {
+		return in.entries[in.pending[i]].Created.Before(in.entries[in.pending[j]].Created)
+	})
+	in.lk.Unlock()
+
+	// background loops are restarted if they panic
+	rctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-in.stop
+		cancel()
+	}()
+
+	go func() {
+		defer close(in.stopped)
+		crash.Run(rctx, "deal-intake", func(context.Context) error {
+			in.wake()
+			in.run()
+			return nil
+		})
+	}()
+
+	// callbacks which weren't delivered before the restart
+	sort.Slice(cbs, func(i, j int) bool {
+		return cbs[i].Seq < cbs[j].Seq
+	})
+	in.cbLk.Lock()
+	for _, cb := range cbs {
+		if cb.Seq > in.cbNext {
+			in.cbNext = cb.Seq
+		}
+		in.addCallback(cb)
+	}
+	in.cbLk.Unlock()
+
+	return nil
+}
+
+func (in *Intake) Stop(ctx context.Context) error {
+	if in.unsub != nil {
+		in.unsub()
+	}
+	in.cbLk.Lock()
+	close(in.stop)
+	in.cbLk.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		<-in.stopped
+		in.cbWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ProposalCid returns the CID identifying a deal proposal in the markets
+// API, the same the provider computes when the client proposes the deal
+func ProposalCid(proposal *market.ClientDealProposal) (cid.Cid, error) {
+	nd, err := cborutil.AsIpld(proposal)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("encoding proposal: %w", err)
+	}
+	return nd.Cid(), nil
+}
+
+// Enqueue adds a deal proposal made with the client to the intake queue and
+// returns its proposal CID immediately. The data at path is imported once the
+// client proposed the deal to the miner, or right away if it did already.
+func (in *Intake) Enqueue(ctx context.Context, proposal market.ClientDealProposal, path string, callbackURL string) (cid.Cid, error) {
+	if proposal.Proposal.Provider != in.maddr {
+		return cid.Undef, xerrors.Errorf("proposal is for provider %s, not %s", proposal.Proposal.Provider, in.maddr)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return cid.Undef, xerrors.Errorf("checking deal data: %w", err)
+	}
+
+	propCid, err := ProposalCid(&proposal)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	in.lk.Lock()
+	if !in.started {
+		in.lk.Unlock()
+		return cid.Undef, xerrors.New("deal intake not running")
+	}
+	if _, ok := in.entries[propCid]; ok {
+		in.lk.Unlock()
+		return cid.Undef, xerrors.Errorf("deal %s already queued", propCid)
+	}
+
+	now := time.Now()
+	e := &api.DealIntake{
+		ProposalCid: propCid,
+		Proposal:    proposal,
+		Path:        path,
+		CallbackURL: callbackURL,
+
+		State:   storagemarket.StorageDealUnknown,
+		Message: "waiting for the client to propose the deal",
+
+		Created: now,
+		Updated: now,
+	}
+	if err := in.persist(e); err != nil {
+		in.lk.Unlock()
+		return cid.Undef, err
+	}
+	in.entries[propCid] = e
+	cb := in.callback(e, EventQueued)
+	in.lk.Unlock()
+
+	in.queueCallback(cb)
+
+	// the client may have proposed the deal before it was queued
+	deals, err := in.provider.ListLocalDeals()
+	if err != nil {
+		log.Warnw("listing deals", "error", err)
+	}
+	for _, deal := range deals {
+		if deal.ProposalCid == propCid {
+			in.update(deal, EventProposalReceived)
+		}
+	}
+
+	return propCid, nil
+}
+
+func (in *Intake) List() []api.DealIntake {
+	in.lk.Lock()
+	defer in.lk.Unlock()
+
+	out := make([]api.DealIntake, 0, len(in.entries))
+	for _, e := range in.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Created.Before(out[j].Created)
+	})
+
+	return out
+}
+
+func (in *Intake) Get(propCid cid.Cid) (api.DealIntake, error) {
+	in.lk.Lock()
+	defer in.lk.Unlock()
+
+	e, ok := in.entries[propCid]
+	if !ok {
+		return api.DealIntake{}, xerrors.Errorf("deal %s not queued", propCid)
+	}
+
+	return *e, nil
+}
+
+func (in *Intake) wake() {
+	select {
+	case in.notify <- struct{}{}:
+	default:
+	}
+}
+
+// waitingForData must be called with in.lk held
+func (in *Intake) waitingForData(e *api.DealIntake) bool {
+	return e.Proposed && !e.Imported && e.Err == "" && e.State == storagemarket.StorageDealWaitingForData
+}
+
+// isPending must be called with in.lk held
+func (in *Intake) isPending(propCid cid.Cid) bool {
+	for _, p := range in.pending {
+		if p == propCid {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *Intake) run() {
+	for {
+		select {
+		case <-in.notify:
+		case <-in.stop:
+			return
+		}
+
+		for {
+			in.lk.Lock()
+			if len(in.pending) == 0 {
+				in.lk.Unlock()
+				break
+			}
+			propCid := in.pending[0]
+			in.pending = in.pending[1:]
+			e := *in.entries[propCid]
+			in.lk.Unlock()
+
+			err := in.importData(e)
+
+			event := EventDataImported
+
+			in.lk.Lock()
+			ent := in.entries[propCid]
+			ent.Updated = time.Now()
+			if err != nil {
+				log.Errorw("importing deal data", "proposal", propCid, "error", err)
+				ent.Err = err.Error()
+				ent.Message = "data import failed"
+				event = EventDataImportFailed
+			} else {
+				ent.Imported = true
+			}
+			if err := in.persist(ent); err != nil {
+				log.Errorf("persisting intake entry %s: %+v", propCid, err)
+			}
+			cb := in.callback(ent, event)
+			in.lk.Unlock()
+
+			in.queueCallback(cb)
+
+			select {
+			case <-in.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+func (in *Intake) importData(e api.DealIntake) error {
+	fi, err := os.Open(e.Path)
+	if err != nil {
+		return xerrors.Errorf("opening deal data: %w", err)
+	}
+	defer fi.Close() //nolint:errcheck
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() {
+		select {
+		case <-in.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return in.provider.ImportDataForDeal(ctx, e.ProposalCid, fi)
+}
+
+func (in *Intake) onEvent(evt storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
+	in.update(deal, storagemarket.ProviderEvents[evt])
+}
+
+// update applies the state of a deal to its intake entry, if it has one, and
+// queues the data import once the deal waits for it. Callbacks are sent for
+// non-empty events.
+func (in *Intake) update(deal storagemarket.MinerDeal, event string) {
+	in.lk.Lock()
+	e, ok := in.entries[deal.ProposalCid]
+	if !ok {
+		in.lk.Unlock()
+		return
+	}
+
+	e.Proposed = true
+	e.State = deal.State
+	e.Message = deal.Message
+	e.DealID = deal.DealID
+	e.Updated = time.Now()
+
+	if err := in.persist(e); err != nil {
+		log.Errorf("persisting intake entry %s: %+v", e.ProposalCid, err)
+	}
+
+	wake := in.waitingForData(e) && !in.isPending(e.ProposalCid)
+	if wake {
+		in.pending = append(in.pending, e.ProposalCid)
+	}
+
+	var cb *callbackReq
+	if event != "" {
+		cb = in.callback(e, event)
+	}
+	in.lk.Unlock()
+
+	in.queueCallback(cb)
+	if wake {
+		in.wake()
+	}
+}
+
+// callback must be called with in.lk held
+func (in *Intake) callback(e *api.DealIntake, event string) *callbackReq {
+	if e.CallbackURL == "" {
+		return nil
+	}
+
+	msg := e.Message
+	if e.Err != "" {
+		msg = e.Err
+	}
+
+	return &callbackReq{
+		URL: e.CallbackURL,
+		Body: Callback{
+			ProposalCid: e.ProposalCid,
+
+			Event:     event,
+			State:     e.State,
+			StateName: storagemarket.DealStates[e.State],
+			Message:   msg,
+			DealID:    e.DealID,
+		},
+	}
+}
+
+func (in *Intake) queueCallback(cb *callbackReq) {
+	if cb == nil {
+		return
+	}
+
+	in.cbLk.Lock()
+	defer in.cbLk.Unlock()
+
+	in.cbNext++
+	cb.Seq = in.cbNext
+	cb.Created = time.Now()
+
+	b, err := json.Marshal(cb)
+	if err == nil {
+		err = in.ds.Put(callbackKey(cb.Seq), b)
+	}
+	if err != nil {
+		// still delivered, unless the node restarts first
+		log.Errorw("persisting callback", "proposal", cb.Body.ProposalCid, "event", cb.Body.Event, "error", err)
+	}
+
+	in.addCallback(cb)
+}
+
+func callbackKey(seq uint64) datastore.Key {
+	return callbacksKey.ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// addCallback queues cb for delivery, it must be called with in.cbLk held
+func (in *Intake) addCallback(cb *callbackReq) {
+	in.callbacks[cb.URL] = append(in.callbacks[cb.URL], cb)
+
+	select {
+	case <-in.stop:
+		// persisted, delivered after a restart
+		return
+	default:
+	}
+	if !in.delivering[cb.URL] {
+		in.delivering[cb.URL] = true
+		in.cbWg.Add(1)
+		go in.deliver(cb.URL)
+	}
+}
+
+// deliver sends the callbacks queued for url in order, until the queue is
+// empty
+func (in *Intake) deliver(url string) {
+	defer in.cbWg.Done()
+
+	client := &http.Client{Timeout: CallbackTimeout}
+
+	for {
+		in.cbLk.Lock()
+		queue := in.callbacks[url]
+		if len(queue) == 0 {
+			delete(in.callbacks, url)
+			delete(in.delivering, url)
+			in.cbLk.Unlock()
+			return
+		}
+		cb := queue[0]
+		in.cbLk.Unlock()
+
+		if !in.send(client, cb) {
+			return
+		}
+
+		in.cbLk.Lock()
+		queue = in.callbacks[url]
+		queue[0] = nil
+		in.callbacks[url] = queue[1:]
+		if err := in.ds.Delete(callbackKey(cb.Seq)); err != nil {
+			log.Errorw("removing delivered callback", "proposal", cb.Body.ProposalCid, "event", cb.Body.Event, "error", err)
+		}
+		in.cbLk.Unlock()
+	}
+}
+
+// send posts cb until it's delivered or older than CallbackMaxAge, it returns
+// false when the intake was stopped first
+func (in *Intake) send(client *http.Client, cb *callbackReq) bool {
+	b, err := json.Marshal(&cb.Body)
+	if err != nil {
+		log.Errorf("encoding callback: %+v", err)
+		return true
+	}
+
+	backoff := CallbackBackoff
+	for attempt := 1; ; attempt++ {
+		err := post(client, cb.URL, b)
+		if err == nil {
+			return true
+		}
+
+		if time.Since(cb.Created) >= CallbackMaxAge {
+			log.Errorw("dropping undelivered callback", "proposal", cb.Body.ProposalCid, "event", cb.Body.Event, "url", cb.URL, "created", cb.Created, "attempts", attempt, "error", err)
+			return true
+		}
+		log.Warnw("callback delivery failed", "proposal", cb.Body.ProposalCid, "event", cb.Body.Event, "attempt", attempt, "retryIn", backoff, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-in.stop:
+			return false
+		}
+
+		backoff *= 2
+		if backoff > CallbackMaxBackoff {
+			backoff = CallbackMaxBackoff
+		}
+	}
+}
+
+func post(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return xerrors.Errorf("callback returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// persist must be called with in.lk held
+func (in *Intake) persist(e *api.DealIntake) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return xerrors.Errorf("encoding intake entry: %w", err)
+	}
+
+	if err := in.ds.Put(datastore.NewKey(e.ProposalCid.String()), b); err != nil {
+		return xerrors.Errorf("storing intake entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,370 @@
+package dealintake
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/shared"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+type testProvider struct {
+	storagemarket.StorageProvider
+
+	lk       sync.Mutex
+	deals    []storagemarket.MinerDeal
+	sub      storagemarket.ProviderSubscriber
+	imported map[cid.Cid]string
+}
+
+func (p *testProvider) SubscribeToEvents(sub storagemarket.ProviderSubscriber) shared.Unsubscribe {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.sub = sub
+	return func() {}
+}
+
+func (p *testProvider) ListLocalDeals() ([]storagemarket.MinerDeal, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return append([]storagemarket.MinerDeal(nil), p.deals...), nil
+}
+
+func (p *testProvider) ImportDataForDeal(ctx context.Context, propCid cid.Cid, data io.Reader) error {
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.imported[propCid] = string(b)
+	return nil
+}
+
+func (p *testProvider) emit(evt storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
+	p.lk.Lock()
+	sub := p.sub
+	p.lk.Unlock()
+	sub(evt, deal)
+}
+
+func (p *testProvider) importedData(propCid cid.Cid) (string, bool) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	d, ok := p.imported[propCid]
+	return d, ok
+}
+
+func testProposal(t *testing.T, provider address.Address, client uint64) market.ClientDealProposal {
+	client0, err := address.NewIDAddress(client)
+	require.NoError(t, err)
+	piece, err := cid.Parse("baga6ea4seaqj527iqfb2kqhy3tmpydzroiigyaie6g3txai2kc3ooyl7kgpeipi")
+	require.NoError(t, err)
+
+	return market.ClientDealProposal{
+		Proposal: market0.DealProposal{
+			PieceCID:             piece,
+			PieceSize:            abi.PaddedPieceSize(2048),
+			Client:               client0,
+			Provider:             provider,
+			StartEpoch:           100,
+			EndEpoch:             200,
+			StoragePricePerEpoch: big.Zero(),
+			ProviderCollateral:   big.Zero(),
+			ClientCollateral:     big.Zero(),
+		},
+		ClientSignature: crypto.Signature{Type: crypto.SigTypeBLS, Data: []byte{1}},
+	}
+}
+
+// callbacks collects the events POSTed to its server
+type callbacks struct {
+	lk     sync.Mutex
+	events []Callback
+	block  chan struct{}
+	failed int
+	fail   bool
+}
+
+func (c *callbacks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.block != nil {
+		<-c.block
+	}
+
+	c.lk.Lock()
+	if c.fail {
+		c.failed++
+		c.lk.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	c.lk.Unlock()
+
+	var cb Callback
+	if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.events = append(c.events, cb)
+}
+
+func (c *callbacks) received() []Callback {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return append([]Callback(nil), c.events...)
+}
+
+func (c *callbacks) setFail(fail bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.fail = fail
+}
+
+func (c *callbacks) failures() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.failed
+}
+
+func storedCallbacks(t *testing.T, ds datastore.Batching) int {
+	res, err := ds.Query(query.Query{Prefix: dsPrefix.Child(callbacksKey).String(), KeysOnly: true})
+	require.NoError(t, err)
+	all, err := res.Rest()
+	require.NoError(t, err)
+	return len(all)
+}
+
+func TestIntake(t *testing.T) {
+	ctx := context.Background()
+
+	maddr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "deal-intake")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	data := filepath.Join(dir, "data")
+	require.NoError(t, ioutil.WriteFile(data, []byte("deal data"), 0644))
+
+	cbs := &callbacks{}
+	srv := httptest.NewServer(cbs)
+	defer srv.Close()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	prov := &testProvider{imported: map[cid.Cid]string{}}
+	in := New(ds, prov, dtypes.MinerAddress(maddr))
+
+	proposal := testProposal(t, maddr, 100)
+	_, err = in.Enqueue(ctx, proposal, data, "")
+	require.Error(t, err, "not started")
+
+	require.NoError(t, in.Start(ctx))
+
+	other, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	_, err = in.Enqueue(ctx, testProposal(t, other, 100), data, "")
+	require.Error(t, err, "proposal for another miner")
+
+	propCid, err := in.Enqueue(ctx, proposal, data, srv.URL)
+	require.NoError(t, err)
+	expect, err := ProposalCid(&proposal)
+	require.NoError(t, err)
+	require.Equal(t, expect, propCid)
+
+	_, err = in.Enqueue(ctx, proposal, data, srv.URL)
+	require.Error(t, err, "already queued")
+
+	e, err := in.Get(propCid)
+	require.NoError(t, err)
+	require.False(t, e.Proposed)
+
+	// the client proposes the deal
+	deal := storagemarket.MinerDeal{ProposalCid: propCid, State: storagemarket.StorageDealWaitingForData}
+	prov.emit(storagemarket.ProviderEventDataTransferInitiated, deal)
+
+	require.Eventually(t, func() bool {
+		d, ok := prov.importedData(propCid)
+		return ok && d == "deal data"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	deal.State = storagemarket.StorageDealSealing
+	deal.DealID = 5
+	prov.emit(storagemarket.ProviderEventDealPublished, deal)
+
+	require.Eventually(t, func() bool {
+		return len(cbs.received()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	got := cbs.received()
+	var events []string
+	for _, cb := range got {
+		require.Equal(t, propCid, cb.ProposalCid)
+		events = append(events, cb.Event)
+	}
+	require.Equal(t, []string{
+		EventQueued,
+		storagemarket.ProviderEvents[storagemarket.ProviderEventDataTransferInitiated],
+		EventDataImported,
+		storagemarket.ProviderEvents[storagemarket.ProviderEventDealPublished],
+	}, events)
+	require.Equal(t, abi.DealID(5), got[3].DealID)
+
+	require.NoError(t, in.Stop(ctx))
+
+	// entries survive restarts, deals proposed meanwhile are picked up
+	proposal2 := testProposal(t, maddr, 101)
+	in = New(ds, prov, dtypes.MinerAddress(maddr))
+	require.NoError(t, in.Start(ctx))
+	propCid2, err := in.Enqueue(ctx, proposal2, data, "")
+	require.NoError(t, err)
+	require.NoError(t, in.Stop(ctx))
+
+	prov.lk.Lock()
+	prov.deals = append(prov.deals, storagemarket.MinerDeal{ProposalCid: propCid2, State: storagemarket.StorageDealWaitingForData})
+	prov.lk.Unlock()
+
+	in = New(ds, prov, dtypes.MinerAddress(maddr))
+	require.NoError(t, in.Start(ctx))
+	defer in.Stop(ctx) //nolint:errcheck
+
+	e, err = in.Get(propCid)
+	require.NoError(t, err)
+	require.True(t, e.Imported)
+	require.Equal(t, abi.DealID(5), e.DealID)
+
+	require.Eventually(t, func() bool {
+		_, ok := prov.importedData(propCid2)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, in.List(), 2)
+}
+
+func TestIntakeCallbacksSlowEndpoint(t *testing.T) {
+	ctx := context.Background()
+
+	maddr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "deal-intake")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	data := filepath.Join(dir, "data")
+	require.NoError(t, ioutil.WriteFile(data, []byte("deal data"), 0644))
+
+	cbs := &callbacks{block: make(chan struct{})}
+	srv := httptest.NewServer(cbs)
+	defer srv.Close()
+
+	prov := &testProvider{imported: map[cid.Cid]string{}}
+	in := New(dss.MutexWrap(datastore.NewMapDatastore()), prov, dtypes.MinerAddress(maddr))
+	require.NoError(t, in.Start(ctx))
+	defer in.Stop(ctx) //nolint:errcheck
+
+	propCid, err := in.Enqueue(ctx, testProposal(t, maddr, 100), data, srv.URL)
+	require.NoError(t, err)
+
+	// many more state changes than were buffered before, while the endpoint
+	// doesn't answer
+	const n = 500
+	for i := 0; i < n; i++ {
+		prov.emit(storagemarket.ProviderEventDealPublished, storagemarket.MinerDeal{ProposalCid: propCid, State: storagemarket.StorageDealSealing})
+	}
+	close(cbs.block)
+
+	require.Eventually(t, func() bool {
+		return len(cbs.received()) == n+1
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestIntakeCallbackRetries(t *testing.T) {
+	ctx := context.Background()
+
+	defer func(backoff, maxBackoff, maxAge time.Duration) {
+		CallbackBackoff, CallbackMaxBackoff, CallbackMaxAge = backoff, maxBackoff, maxAge
+	}(CallbackBackoff, CallbackMaxBackoff, CallbackMaxAge)
+	CallbackBackoff = 10 * time.Millisecond
+	CallbackMaxBackoff = 20 * time.Millisecond
+
+	maddr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "deal-intake")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+	data := filepath.Join(dir, "data")
+	require.NoError(t, ioutil.WriteFile(data, []byte("deal data"), 0644))
+
+	down := &callbacks{fail: true}
+	downSrv := httptest.NewServer(down)
+	defer downSrv.Close()
+	up := &callbacks{}
+	upSrv := httptest.NewServer(up)
+	defer upSrv.Close()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	prov := &testProvider{imported: map[cid.Cid]string{}}
+	in := New(ds, prov, dtypes.MinerAddress(maddr))
+	require.NoError(t, in.Start(ctx))
+
+	_, err = in.Enqueue(ctx, testProposal(t, maddr, 100), data, downSrv.URL)
+	require.NoError(t, err)
+	_, err = in.Enqueue(ctx, testProposal(t, maddr, 101), data, upSrv.URL)
+	require.NoError(t, err)
+
+	// an endpoint which is down doesn't hold up the others
+	require.Eventually(t, func() bool {
+		return len(up.received()) == 1 && down.failures() >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, in.Stop(ctx))
+	require.Equal(t, 1, storedCallbacks(t, ds), "undelivered callback is kept")
+
+	// delivered after a restart
+	down.setFail(false)
+	in = New(ds, prov, dtypes.MinerAddress(maddr))
+	require.NoError(t, in.Start(ctx))
+	require.Eventually(t, func() bool {
+		return len(down.received()) == 1 && storedCallbacks(t, ds) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, EventQueued, down.received()[0].Event)
+	require.NoError(t, in.Stop(ctx))
+
+	// dropped once too old
+	CallbackMaxAge = 50 * time.Millisecond
+	down.setFail(true)
+	in = New(ds, prov, dtypes.MinerAddress(maddr))
+	require.NoError(t, in.Start(ctx))
+	_, err = in.Enqueue(ctx, testProposal(t, maddr, 102), data, downSrv.URL)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return storedCallbacks(t, ds) == 0 && down.failures() > 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, in.Stop(ctx))
+	require.Len(t, down.received(), 1)
+}
@@ -0,0 +1,216 @@
+package dealpay
+
+import (
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// LateAfter is how long an active deal may go without being settled before
+// it's reported late, the market actor settles deals once per
+// DealUpdatesInterval
+const LateAfter = 2 * market0.DealUpdatesInterval
+
+// Reconcile compares the payments expected for the published deals of the
+// provider at head with the market actor state of the deals. Local deals
+// are the ones tracked by the storage provider, chain deals the ones in the
+// market actor, keyed by deal ID. Deals removed from the market actor are
+// judged by their last state seen in it, or their local record when they
+// were never seen there.
+func Reconcile(provider address.Address, head abi.ChainEpoch, local []storagemarket.MinerDeal, chain, last map[abi.DealID]api.MarketDeal) *api.DealPaymentReport {
+	out := &api.DealPaymentReport{
+		Epoch:     head,
+		Deals:     []api.DealPayment{},
+		Expected:  big.Zero(),
+		Paid:      big.Zero(),
+		Unsettled: big.Zero(),
+		Lost:      big.Zero(),
+		Upcoming:  big.Zero(),
+	}
+
+	seen := map[abi.DealID]bool{}
+	add := func(dp api.DealPayment) {
+		seen[dp.DealID] = true
+		out.Deals = append(out.Deals, dp)
+
+		out.Expected = big.Add(out.Expected, dp.Expected)
+		out.Paid = big.Add(out.Paid, dp.Paid)
+		out.Lost = big.Add(out.Lost, dp.Lost)
+		out.Upcoming = big.Add(out.Upcoming, dp.Upcoming)
+		if dp.Status == api.DealPaymentActive || dp.Status == api.DealPaymentLate {
+			out.Unsettled = big.Add(out.Unsettled, big.Sub(dp.Expected, dp.Paid))
+		}
+		if dp.Status.Shortfall() {
+			out.Shortfalls++
+		}
+	}
+
+	for _, d := range local {
+		if d.DealID == 0 {
+			// not published yet
+			continue
+		}
+		if d.Proposal.Provider != provider || seen[d.DealID] {
+			continue
+		}
+
+		p := d.Proposal
+		dp := newPayment(d.DealID, p.Client, p.StartEpoch, p.EndEpoch, p.StoragePricePerEpoch)
+		dp.ProposalCid = d.ProposalCid
+		if cd, ok := chain[d.DealID]; ok {
+			onChain(&dp, head, cd)
+		} else if ld, ok := last[d.DealID]; ok {
+			removedSeen(&dp, head, ld)
+		} else {
+			removed(&dp, head, d)
+		}
+		add(dp)
+	}
+
+	for id, cd := range chain {
+		if seen[id] || cd.Proposal.Provider != provider {
+			continue
+		}
+		p := cd.Proposal
+		dp := newPayment(id, p.Client, p.StartEpoch, p.EndEpoch, p.StoragePricePerEpoch)
+		onChain(&dp, head, cd)
+		add(dp)
+	}
+
+	for id, ld := range last {
+		if seen[id] || ld.Proposal.Provider != provider {
+			continue
+		}
+		p := ld.Proposal
+		dp := newPayment(id, p.Client, p.StartEpoch, p.EndEpoch, p.StoragePricePerEpoch)
+		removedSeen(&dp, head, ld)
+		add(dp)
+	}
+
+	sort.Slice(out.Deals, func(i, j int) bool {
+		return out.Deals[i].DealID < out.Deals[j].DealID
+	})
+	return out
+}
+
+func newPayment(id abi.DealID, client address.Address, start, end abi.ChainEpoch, pricePerEpoch abi.TokenAmount) api.DealPayment {
+	return api.DealPayment{
+		DealID:        id,
+		Client:        client,
+		StartEpoch:    start,
+		EndEpoch:      end,
+		PricePerEpoch: pricePerEpoch,
+		SettledEpoch:  -1,
+		Expected:      big.Zero(),
+		Paid:          big.Zero(),
+		Lost:          big.Zero(),
+		Upcoming:      big.Zero(),
+	}
+}
+
+// onChain fills in the payments of a deal in the market actor
+func onChain(dp *api.DealPayment, head abi.ChainEpoch, cd api.MarketDeal) {
+	st := cd.State
+	dp.SettledEpoch = st.LastUpdatedEpoch
+
+	switch {
+	case st.SlashEpoch != -1:
+		dp.Status = api.DealPaymentSlashed
+		// slashing settles the deal until the slash epoch
+		dp.Expected = price(dp, dp.StartEpoch, head)
+		dp.Paid = price(dp, dp.StartEpoch, st.SlashEpoch)
+		dp.Lost = big.Add(price(dp, st.SlashEpoch, dp.EndEpoch), cd.Proposal.ProviderCollateral)
+	case st.SectorStartEpoch == -1 && head < dp.StartEpoch:
+		dp.Status = api.DealPaymentPending
+		dp.Upcoming = price(dp, dp.StartEpoch, dp.EndEpoch)
+	case st.SectorStartEpoch == -1:
+		dp.Status = api.DealPaymentNotActivated
+		dp.Lost = big.Add(price(dp, dp.StartEpoch, dp.EndEpoch), cd.Proposal.ProviderCollateral)
+	default:
+		dp.Expected = price(dp, dp.StartEpoch, head)
+		dp.Paid = price(dp, dp.StartEpoch, st.LastUpdatedEpoch)
+		dp.Upcoming = price(dp, head, dp.EndEpoch)
+
+		settled := st.LastUpdatedEpoch
+		if settled < dp.StartEpoch {
+			settled = dp.StartEpoch
+		}
+		dp.Status = api.DealPaymentActive
+		if head-settled > LateAfter && settled < dp.EndEpoch {
+			dp.Status = api.DealPaymentLate
+		}
+	}
+}
+
+// removedSeen fills in the payments of a deal no longer in the market actor
+// from the last state it was seen in there. The market actor removes deals
+// once they're settled after their end epoch, slashed, or not activated in
+// time.
+func removedSeen(dp *api.DealPayment, head abi.ChainEpoch, last api.MarketDeal) {
+	st := last.State
+	switch {
+	case st.SlashEpoch != -1:
+		onChain(dp, head, last)
+	case st.SectorStartEpoch == -1 && head >= dp.StartEpoch:
+		dp.Status = api.DealPaymentNotActivated
+		dp.Lost = big.Add(price(dp, dp.StartEpoch, dp.EndEpoch), last.Proposal.ProviderCollateral)
+	case st.SectorStartEpoch != -1 && head >= dp.EndEpoch:
+		completed(dp)
+	default:
+		dp.Status = api.DealPaymentMissing
+		dp.SettledEpoch = st.LastUpdatedEpoch
+		dp.Expected = price(dp, dp.StartEpoch, head)
+	}
+}
+
+// removed fills in the payments of a deal never seen in the market actor
+// from its local record. Only deals the provider saw activated can have been
+// paid, the others were published but not activated in time.
+func removed(dp *api.DealPayment, head abi.ChainEpoch, d storagemarket.MinerDeal) {
+	activated := d.State == storagemarket.StorageDealActive || d.State == storagemarket.StorageDealExpired
+
+	switch {
+	case d.State == storagemarket.StorageDealSlashed && d.SlashEpoch > 0:
+		dp.Status = api.DealPaymentSlashed
+		dp.SettledEpoch = d.SlashEpoch
+		dp.Expected = price(dp, dp.StartEpoch, head)
+		dp.Paid = price(dp, dp.StartEpoch, d.SlashEpoch)
+		dp.Lost = big.Add(price(dp, d.SlashEpoch, dp.EndEpoch), d.Proposal.ProviderCollateral)
+	case activated && head >= dp.EndEpoch:
+		completed(dp)
+	case !activated && d.State != storagemarket.StorageDealSlashed && head >= dp.StartEpoch:
+		dp.Status = api.DealPaymentNotActivated
+		dp.Lost = big.Add(price(dp, dp.StartEpoch, dp.EndEpoch), d.Proposal.ProviderCollateral)
+	default:
+		dp.Status = api.DealPaymentMissing
+		dp.Expected = price(dp, dp.StartEpoch, head)
+	}
+}
+
+func completed(dp *api.DealPayment) {
+	dp.Status = api.DealPaymentCompleted
+	dp.SettledEpoch = dp.EndEpoch
+	dp.Expected = price(dp, dp.StartEpoch, dp.EndEpoch)
+	dp.Paid = dp.Expected
+}
+
+// price returns the price of the deal epochs from from to to, clamped to
+// the deal duration
+func price(dp *api.DealPayment, from, to abi.ChainEpoch) abi.TokenAmount {
+	if from < dp.StartEpoch {
+		from = dp.StartEpoch
+	}
+	if to > dp.EndEpoch {
+		to = dp.EndEpoch
+	}
+	if to <= from {
+		return big.Zero()
+	}
+	return big.Mul(dp.PricePerEpoch, big.NewInt(int64(to-from)))
+}
@@ -0,0 +1,170 @@
+package dealpay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+)
+
+func TestReconcile(t *testing.T) {
+	provider, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	other, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	client, err := address.NewIDAddress(2000)
+	require.NoError(t, err)
+
+	const head = abi.ChainEpoch(20000)
+
+	proposal := func(p address.Address, start, end abi.ChainEpoch) market.DealProposal {
+		return market.DealProposal{
+			Client:               client,
+			Provider:             p,
+			StartEpoch:           start,
+			EndEpoch:             end,
+			StoragePricePerEpoch: big.NewInt(10),
+			ProviderCollateral:   big.NewInt(1000),
+		}
+	}
+	localDeal := func(id abi.DealID, st storagemarket.StorageDealStatus, start, end abi.ChainEpoch) storagemarket.MinerDeal {
+		return storagemarket.MinerDeal{
+			ClientDealProposal: market0.ClientDealProposal{Proposal: market0.DealProposal{
+				Client:               client,
+				Provider:             provider,
+				StartEpoch:           start,
+				EndEpoch:             end,
+				StoragePricePerEpoch: big.NewInt(10),
+				ProviderCollateral:   big.NewInt(1000),
+			}},
+			State:  st,
+			DealID: id,
+		}
+	}
+
+	local := []storagemarket.MinerDeal{
+		localDeal(0, storagemarket.StorageDealTransferring, 30000, 40000),
+		localDeal(1, storagemarket.StorageDealActive, 10000, 50000),
+		localDeal(2, storagemarket.StorageDealActive, 10000, 50000),
+		localDeal(3, storagemarket.StorageDealSlashed, 10000, 50000),
+		localDeal(4, storagemarket.StorageDealExpired, 1000, 5000),
+		localDeal(5, storagemarket.StorageDealActive, 10000, 50000),
+		localDeal(6, storagemarket.StorageDealPublish, 30000, 40000),
+	}
+	chain := map[abi.DealID]api.MarketDeal{
+		1: {Proposal: proposal(provider, 10000, 50000), State: market.DealState{SectorStartEpoch: 9000, LastUpdatedEpoch: 19000, SlashEpoch: -1}},
+		2: {Proposal: proposal(provider, 10000, 50000), State: market.DealState{SectorStartEpoch: 9000, LastUpdatedEpoch: 11000, SlashEpoch: -1}},
+		3: {Proposal: proposal(provider, 10000, 50000), State: market.DealState{SectorStartEpoch: 9000, LastUpdatedEpoch: 15000, SlashEpoch: 15000}},
+		6: {Proposal: proposal(provider, 30000, 40000), State: market.DealState{SectorStartEpoch: -1, LastUpdatedEpoch: -1, SlashEpoch: -1}},
+		7: {Proposal: proposal(provider, 10000, 15000), State: market.DealState{SectorStartEpoch: -1, LastUpdatedEpoch: -1, SlashEpoch: -1}},
+		8: {Proposal: proposal(other, 10000, 15000), State: market.DealState{SectorStartEpoch: 9000, LastUpdatedEpoch: -1, SlashEpoch: -1}},
+	}
+
+	rep := Reconcile(provider, head, local, chain, nil)
+	require.Equal(t, head, rep.Epoch)
+
+	byID := map[abi.DealID]api.DealPayment{}
+	for _, d := range rep.Deals {
+		byID[d.DealID] = d
+	}
+	require.Len(t, byID, 7, "unpublished deals and deals of other providers aren't listed")
+
+	expect := map[abi.DealID]struct {
+		status                         api.DealPaymentStatus
+		expected, paid, lost, upcoming int64
+	}{
+		1: {api.DealPaymentActive, 100000, 90000, 0, 300000},
+		2: {api.DealPaymentLate, 100000, 10000, 0, 300000},
+		3: {api.DealPaymentSlashed, 100000, 50000, 351000, 0},
+		4: {api.DealPaymentCompleted, 40000, 40000, 0, 0},
+		5: {api.DealPaymentMissing, 100000, 0, 0, 0},
+		6: {api.DealPaymentPending, 0, 0, 0, 100000},
+		7: {api.DealPaymentNotActivated, 0, 0, 51000, 0},
+	}
+	for id, e := range expect {
+		d := byID[id]
+		require.Equal(t, e.status, d.Status, "deal %d", id)
+		require.Equal(t, big.NewInt(e.expected), d.Expected, "deal %d expected", id)
+		require.Equal(t, big.NewInt(e.paid), d.Paid, "deal %d paid", id)
+		require.Equal(t, big.NewInt(e.lost), d.Lost, "deal %d lost", id)
+		require.Equal(t, big.NewInt(e.upcoming), d.Upcoming, "deal %d upcoming", id)
+	}
+
+	require.Equal(t, 4, rep.Shortfalls)
+	require.Equal(t, big.NewInt(440000), rep.Expected)
+	require.Equal(t, big.NewInt(190000), rep.Paid)
+	require.Equal(t, big.NewInt(100000), rep.Unsettled)
+	require.Equal(t, big.NewInt(402000), rep.Lost)
+	require.Equal(t, big.NewInt(700000), rep.Upcoming)
+}
+
+func TestReconcileRemoved(t *testing.T) {
+	provider, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	client, err := address.NewIDAddress(2000)
+	require.NoError(t, err)
+
+	const head = abi.ChainEpoch(20000)
+
+	proposal := market.DealProposal{
+		Client:               client,
+		Provider:             provider,
+		StartEpoch:           1000,
+		EndEpoch:             5000,
+		StoragePricePerEpoch: big.NewInt(10),
+		ProviderCollateral:   big.NewInt(1000),
+	}
+	localDeal := func(id abi.DealID, st storagemarket.StorageDealStatus) storagemarket.MinerDeal {
+		return storagemarket.MinerDeal{
+			ClientDealProposal: market0.ClientDealProposal{Proposal: market0.DealProposal{
+				Client:               client,
+				Provider:             provider,
+				StartEpoch:           proposal.StartEpoch,
+				EndEpoch:             proposal.EndEpoch,
+				StoragePricePerEpoch: proposal.StoragePricePerEpoch,
+				ProviderCollateral:   proposal.ProviderCollateral,
+			}},
+			State:  st,
+			DealID: id,
+		}
+	}
+
+	local := []storagemarket.MinerDeal{
+		// published but failed locally, never seen on chain
+		localDeal(1, storagemarket.StorageDealError),
+		localDeal(2, storagemarket.StorageDealSealing),
+		// the local record says active, the market actor never activated it
+		localDeal(3, storagemarket.StorageDealActive),
+	}
+	last := map[abi.DealID]api.MarketDeal{
+		3: {Proposal: proposal, State: market.DealState{SectorStartEpoch: -1, LastUpdatedEpoch: -1, SlashEpoch: -1}},
+		4: {Proposal: proposal, State: market.DealState{SectorStartEpoch: 900, LastUpdatedEpoch: 4000, SlashEpoch: -1}},
+		5: {Proposal: proposal, State: market.DealState{SectorStartEpoch: 900, LastUpdatedEpoch: 2000, SlashEpoch: 2000}},
+	}
+
+	rep := Reconcile(provider, head, local, map[abi.DealID]api.MarketDeal{}, last)
+
+	byID := map[abi.DealID]api.DealPayment{}
+	for _, d := range rep.Deals {
+		byID[d.DealID] = d
+	}
+	require.Len(t, byID, 5)
+
+	require.Equal(t, api.DealPaymentNotActivated, byID[1].Status)
+	require.Equal(t, big.NewInt(41000), byID[1].Lost)
+	require.Equal(t, api.DealPaymentNotActivated, byID[2].Status)
+	require.Equal(t, api.DealPaymentNotActivated, byID[3].Status)
+	require.Equal(t, api.DealPaymentCompleted, byID[4].Status)
+	require.Equal(t, big.NewInt(40000), byID[4].Paid)
+	require.Equal(t, api.DealPaymentSlashed, byID[5].Status)
+	require.Equal(t, big.NewInt(10000), byID[5].Paid)
+	require.Equal(t, 4, rep.Shortfalls)
+}
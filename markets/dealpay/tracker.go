@@ -0,0 +1,265 @@
+package dealpay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("dealpay")
+
+var (
+	dealsPrefix   = datastore.NewKey("/deal-payments/deals")
+	historyPrefix = datastore.NewKey("/deal-payments/history")
+)
+
+// TrackInterval is how often the tracker records the market actor state of
+// the deals, often enough to see deals before the market actor removes them
+var TrackInterval = time.Hour
+
+// MaxHistory is the number of reports kept in the history, 90 days of
+// hourly reports
+const MaxHistory = 90 * 24
+
+type trackerAPI interface {
+	ChainHead(context.Context) (*types.TipSet, error)
+	StateMarketDeals(context.Context, types.TipSetKey) (map[string]api.MarketDeal, error)
+}
+
+type localDeals interface {
+	ListLocalDeals() ([]storagemarket.MinerDeal, error)
+}
+
+// Tracker reconciles the deal payments periodically. It records the market
+// actor state of the deals of the provider as they're seen, so deals removed
+// from the market actor are judged by their last state rather than only the
+// local record, and keeps the totals of past reports.
+type Tracker struct {
+	api   trackerAPI
+	local localDeals
+	maddr address.Address
+
+	deals   datastore.Batching
+	history datastore.Batching
+
+	lk sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewTracker(ds datastore.Batching, api trackerAPI, local localDeals, maddr address.Address) *Tracker {
+	return &Tracker{
+		api:     api,
+		local:   local,
+		maddr:   maddr,
+		deals:   namespace.Wrap(ds, dealsPrefix),
+		history: namespace.Wrap(ds, historyPrefix),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (t *Tracker) Start(context.Context) error {
+	go t.run()
+	return nil
+}
+
+func (t *Tracker) Stop(ctx context.Context) error {
+	close(t.stop)
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracker) run() {
+	defer close(t.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-t.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	tick := time.NewTicker(TrackInterval)
+	defer tick.Stop()
+
+	for {
+		if _, err := t.Report(ctx); err != nil && ctx.Err() == nil {
+			log.Warnw("recording deal payments", "error", err)
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Report reconciles the deal payments at the chain head, and records the
+// state of the deals and the report totals
+func (t *Tracker) Report(ctx context.Context) (*api.DealPaymentReport, error) {
+	local, err := t.local.ListLocalDeals()
+	if err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+
+	head, err := t.api.ChainHead(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting chain head: %w", err)
+	}
+	all, err := t.api.StateMarketDeals(ctx, head.Key())
+	if err != nil {
+		return nil, xerrors.Errorf("getting market deals: %w", err)
+	}
+
+	chain := map[abi.DealID]api.MarketDeal{}
+	for k, d := range all {
+		if d.Proposal.Provider != t.maddr {
+			continue
+		}
+		id, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing deal ID %q: %w", k, err)
+		}
+		chain[abi.DealID(id)] = d
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	last, err := t.seen()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := Reconcile(t.maddr, head.Height(), local, chain, last)
+
+	for id, d := range chain {
+		if ld, ok := last[id]; ok && ld.State == d.State {
+			continue
+		}
+		b, err := json.Marshal(d)
+		if err != nil {
+			return nil, xerrors.Errorf("encoding deal %d: %w", id, err)
+		}
+		if err := t.deals.Put(datastore.NewKey(fmt.Sprint(id)), b); err != nil {
+			return nil, xerrors.Errorf("recording deal %d: %w", id, err)
+		}
+	}
+
+	if err := t.record(rep); err != nil {
+		return nil, err
+	}
+
+	return rep, nil
+}
+
+// seen returns the last recorded market actor state of the deals, must be
+// called with lk held
+func (t *Tracker) seen() (map[abi.DealID]api.MarketDeal, error) {
+	res, err := t.deals.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying recorded deals: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	out := map[abi.DealID]api.MarketDeal{}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading recorded deals: %w", r.Error)
+		}
+
+		id, err := strconv.ParseUint(datastore.NewKey(r.Key).BaseNamespace(), 10, 64)
+		if err != nil {
+			log.Errorw("parsing recorded deal ID", "key", r.Key, "error", err)
+			continue
+		}
+		var d api.MarketDeal
+		if err := json.Unmarshal(r.Value, &d); err != nil {
+			log.Errorw("decoding recorded deal", "key", r.Key, "error", err)
+			continue
+		}
+		out[abi.DealID(id)] = d
+	}
+	return out, nil
+}
+
+// record adds the totals of rep to the history, must be called with lk held
+func (t *Tracker) record(rep *api.DealPaymentReport) error {
+	sum := *rep
+	sum.Deals = nil
+
+	b, err := json.Marshal(&sum)
+	if err != nil {
+		return xerrors.Errorf("encoding report: %w", err)
+	}
+	if err := t.history.Put(datastore.NewKey(fmt.Sprint(rep.Epoch)), b); err != nil {
+		return xerrors.Errorf("recording report: %w", err)
+	}
+
+	hist, err := t.History()
+	if err != nil {
+		return err
+	}
+	for len(hist) > MaxHistory {
+		if err := t.history.Delete(datastore.NewKey(fmt.Sprint(hist[0].Epoch))); err != nil {
+			log.Warnf("removing old deal payment report: %s", err)
+		}
+		hist = hist[1:]
+	}
+	return nil
+}
+
+// History returns the totals of the recorded reports, oldest first
+func (t *Tracker) History() ([]api.DealPaymentReport, error) {
+	res, err := t.history.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying deal payment history: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.DealPaymentReport
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading deal payment history: %w", r.Error)
+		}
+
+		var rep api.DealPaymentReport
+		if err := json.Unmarshal(r.Value, &rep); err != nil {
+			log.Errorw("decoding deal payment report", "key", r.Key, "error", err)
+			continue
+		}
+		out = append(out, rep)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Epoch < out[j].Epoch
+	})
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package dealpay
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+type fakeChain struct {
+	height abi.ChainEpoch
+	deals  map[abi.DealID]api.MarketDeal
+}
+
+func (f *fakeChain) ChainHead(context.Context) (*types.TipSet, error) {
+	blk := mock.MkBlock(nil, 0, 0)
+	blk.Height = f.height
+	return mock.TipSet(blk), nil
+}
+
+func (f *fakeChain) StateMarketDeals(context.Context, types.TipSetKey) (map[string]api.MarketDeal, error) {
+	out := map[string]api.MarketDeal{}
+	for id, d := range f.deals {
+		out[fmt.Sprint(id)] = d
+	}
+	return out, nil
+}
+
+type noLocalDeals struct{}
+
+func (noLocalDeals) ListLocalDeals() ([]storagemarket.MinerDeal, error) {
+	return nil, nil
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	client, err := address.NewIDAddress(2000)
+	require.NoError(t, err)
+
+	proposal := market.DealProposal{
+		Client:               client,
+		Provider:             provider,
+		StartEpoch:           1000,
+		EndEpoch:             5000,
+		StoragePricePerEpoch: big.NewInt(10),
+		ProviderCollateral:   big.NewInt(1000),
+		ClientCollateral:     big.Zero(),
+	}
+	chain := &fakeChain{
+		height: 4000,
+		deals: map[abi.DealID]api.MarketDeal{
+			1: {Proposal: proposal, State: market.DealState{SectorStartEpoch: 900, LastUpdatedEpoch: 3500, SlashEpoch: -1}},
+			2: {Proposal: proposal, State: market.DealState{SectorStartEpoch: -1, LastUpdatedEpoch: -1, SlashEpoch: -1}},
+		},
+	}
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	tr := NewTracker(ds, chain, noLocalDeals{}, provider)
+
+	rep, err := tr.Report(ctx)
+	require.NoError(t, err)
+	require.Len(t, rep.Deals, 2)
+
+	// the market actor removes both deals, a new tracker judges them by their
+	// recorded state
+	chain.height = 6000
+	chain.deals = map[abi.DealID]api.MarketDeal{}
+	tr = NewTracker(ds, chain, noLocalDeals{}, provider)
+
+	rep, err = tr.Report(ctx)
+	require.NoError(t, err)
+	require.Len(t, rep.Deals, 2)
+	require.Equal(t, api.DealPaymentCompleted, rep.Deals[0].Status)
+	require.Equal(t, api.DealPaymentNotActivated, rep.Deals[1].Status)
+
+	hist, err := tr.History()
+	require.NoError(t, err)
+	require.Len(t, hist, 2)
+	require.Equal(t, abi.ChainEpoch(4000), hist[0].Epoch)
+	require.Equal(t, abi.ChainEpoch(6000), hist[1].Epoch)
+	require.Empty(t, hist[1].Deals)
+	require.Equal(t, 1, hist[1].Shortfalls)
+}
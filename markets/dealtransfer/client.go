@@ -0,0 +1,97 @@
+package dealtransfer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// Query asks a miner for its transfer protocols. With the proposal of a deal
+// made by this node, the response includes the HTTP push URL and token if the
+// miner accepts HTTP pushes.
+func Query(ctx context.Context, h host.Host, miner peer.ID, proposal *cid.Cid) (api.DealTransfers, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	s, err := h.NewStream(ctx, miner, QueryProtocolID)
+	if err != nil {
+		return api.DealTransfers{}, xerrors.Errorf("opening stream: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	_ = s.SetDeadline(time.Now().Add(queryTimeout))
+
+	if err := json.NewEncoder(s).Encode(&QueryRequest{Proposal: proposal}); err != nil {
+		return api.DealTransfers{}, xerrors.Errorf("sending query: %w", err)
+	}
+
+	var out api.DealTransfers
+	if err := json.NewDecoder(io.LimitReader(s, queryMaxResp)).Decode(&out); err != nil {
+		return api.DealTransfers{}, xerrors.Errorf("reading response: %w", err)
+	}
+	return out, nil
+}
+
+// Push sends the data of an offline deal to the miner with a push protocol,
+// the miner must have been queried for the deal first
+func Push(ctx context.Context, h host.Host, miner peer.ID, protocol string, t api.DealTransfers, proposal cid.Cid, data io.Reader) error {
+	var (
+		client http.Client
+		url    string
+		token  string
+	)
+
+	switch protocol {
+	case ProtocolLibp2pHTTP:
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				s, err := h.NewStream(ctx, miner, PushProtocolID)
+				if err != nil {
+					return nil, err
+				}
+				return &streamConn{s}, nil
+			},
+			DisableKeepAlives: true,
+		}
+		url = "http://" + miner.String() + PushPath + proposal.String()
+	case ProtocolHTTP:
+		if t.PushURL == "" {
+			return xerrors.Errorf("miner didn't return a push URL for the deal, the deal may not be known to the miner yet")
+		}
+		url = t.PushURL
+		token = t.PushToken
+	default:
+		return xerrors.Errorf("can't push deal data with %q", protocol)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, data)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("pushing deal data: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return xerrors.Errorf("miner rejected deal data (%s): %s", resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package dealtransfer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+const (
+	queryTimeout = 30 * time.Second
+	queryMaxSize = 4 << 10
+	queryMaxResp = 16 << 10
+)
+
+var errListenerClosed = xerrors.New("listener closed")
+
+// Config enables the push protocols of a Provider
+type Config struct {
+	HTTP bool
+	// HTTPListen is the address the HTTP push endpoint listens on
+	HTTPListen string
+	// HTTPURL is the URL of the endpoint given to clients, e.g. behind a
+	// reverse proxy. Defaults to http://<HTTPListen>.
+	HTTPURL string
+
+	Libp2pHTTP bool
+}
+
+// Deals is the part of the storage provider the pushed data goes to
+type Deals interface {
+	ListLocalDeals() ([]storagemarket.MinerDeal, error)
+	ImportDataForDeal(ctx context.Context, propCid cid.Cid, data io.Reader) error
+}
+
+// Provider accepts the data of offline deals pushed by clients, and tells
+// clients which transfer protocols the miner supports. Graphsync transfers
+// are handled by the storage market itself, and enabled with the
+// ConsiderOnlineStorageDeals setting.
+type Provider struct {
+	h        host.Host
+	deals    Deals
+	cfg      Config
+	onlineOk func() (bool, error)
+
+	// secret signs the tokens authenticating HTTP pushes. It isn't
+	// persisted, clients query for a new token after a restart.
+	secret []byte
+
+	lk      sync.Mutex
+	pushing map[cid.Cid]struct{}
+
+	listenAddr string
+	servers    []*http.Server
+}
+
+func NewProvider(h host.Host, deals Deals, cfg Config, onlineOk func() (bool, error)) (*Provider, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, xerrors.Errorf("generating push token secret: %w", err)
+	}
+
+	return &Provider{
+		h:        h,
+		deals:    deals,
+		cfg:      cfg,
+		onlineOk: onlineOk,
+		secret:   secret,
+		pushing:  map[cid.Cid]struct{}{},
+	}, nil
+}
+
+// Start registers the protocol handlers and starts the enabled endpoints
+func (p *Provider) Start(ctx context.Context) error {
+	p.h.SetStreamHandler(QueryProtocolID, p.handleQuery)
+
+	if p.cfg.HTTP {
+		nl, err := net.Listen("tcp", p.cfg.HTTPListen)
+		if err != nil {
+			return xerrors.Errorf("listening for deal pushes: %w", err)
+		}
+		log.Infow("accepting deal data over HTTP", "listen", nl.Addr())
+		p.listenAddr = nl.Addr().String()
+		p.serve(nl)
+	}
+
+	if p.cfg.Libp2pHTTP {
+		sl := &streamListener{
+			self:   p.h.ID(),
+			conns:  make(chan net.Conn),
+			closed: make(chan struct{}),
+		}
+		p.h.SetStreamHandler(PushProtocolID, sl.handle)
+		p.serve(sl)
+	}
+
+	return nil
+}
+
+func (p *Provider) Stop(ctx context.Context) error {
+	p.h.RemoveStreamHandler(QueryProtocolID)
+	p.h.RemoveStreamHandler(PushProtocolID)
+
+	for _, srv := range p.servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Provider) serve(nl net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle(PushPath, p)
+
+	srv := &http.Server{
+		Handler: mux,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if sc, ok := c.(*streamConn); ok {
+				return context.WithValue(ctx, remotePeerKey{}, sc.Conn().RemotePeer())
+			}
+			return ctx
+		},
+	}
+	p.servers = append(p.servers, srv)
+
+	go func() {
+		if err := srv.Serve(nl); err != nil && err != http.ErrServerClosed && err != errListenerClosed {
+			log.Errorf("serving deal pushes: %+v", err)
+		}
+	}()
+}
+
+// Protocols lists the enabled transfer protocols
+func (p *Provider) Protocols() ([]string, error) {
+	var out []string
+
+	online, err := p.onlineOk()
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		out = append(out, ProtocolGraphsync)
+	}
+	if p.cfg.Libp2pHTTP {
+		out = append(out, ProtocolLibp2pHTTP)
+	}
+	if p.cfg.HTTP {
+		out = append(out, ProtocolHTTP)
+	}
+	return out, nil
+}
+
+func (p *Provider) pushURL() string {
+	if p.cfg.HTTPURL != "" {
+		return strings.TrimSuffix(p.cfg.HTTPURL, "/")
+	}
+	return "http://" + p.listenAddr
+}
+
+func (p *Provider) token(propCid cid.Cid) string {
+	mac := hmac.New(sha256.New, p.secret)
+	_, _ = mac.Write(propCid.Bytes())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *Provider) deal(propCid cid.Cid) (*storagemarket.MinerDeal, error) {
+	deals, err := p.deals.ListLocalDeals()
+	if err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+	for i := range deals {
+		if deals[i].ProposalCid == propCid {
+			return &deals[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *Provider) handleQuery(s network.Stream) {
+	defer s.Close() //nolint:errcheck
+
+	_ = s.SetDeadline(time.Now().Add(queryTimeout))
+
+	var req QueryRequest
+	if err := json.NewDecoder(io.LimitReader(s, queryMaxSize)).Decode(&req); err != nil {
+		log.Debugw("reading transfer query", "peer", s.Conn().RemotePeer(), "error", err)
+		return
+	}
+
+	var resp api.DealTransfers
+	protos, err := p.Protocols()
+	if err != nil {
+		log.Errorf("reading transfer protocols: %+v", err)
+	}
+	resp.Protocols = protos
+
+	if req.Proposal != nil && p.cfg.HTTP {
+		deal, err := p.deal(*req.Proposal)
+		if err != nil {
+			log.Errorw("looking up queried deal", "proposal", *req.Proposal, "error", err)
+		} else if deal != nil && deal.Client == s.Conn().RemotePeer() {
+			resp.PushURL = p.pushURL() + PushPath + req.Proposal.String()
+			resp.PushToken = p.token(*req.Proposal)
+		}
+	}
+
+	if err := json.NewEncoder(s).Encode(&resp); err != nil {
+		log.Debugw("sending transfer protocols", "peer", s.Conn().RemotePeer(), "error", err)
+	}
+}
+
+// ServeHTTP accepts the data of a deal, PUT to PushPath followed by the
+// proposal CID. Over libp2p the pushing peer must be the client of the deal,
+// over plain HTTP the request carries the token from a query by the client.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "only PUT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	propCid, err := cid.Parse(strings.TrimPrefix(r.URL.Path, PushPath))
+	if err != nil {
+		http.Error(w, "invalid proposal cid", http.StatusBadRequest)
+		return
+	}
+
+	deal, err := p.deal(propCid)
+	if err != nil {
+		log.Errorw("looking up pushed deal", "proposal", propCid, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	from, viaLibp2p := remotePeer(r.Context())
+	if viaLibp2p {
+		if deal == nil || deal.Client != from {
+			http.Error(w, "unknown deal", http.StatusNotFound)
+			return
+		}
+	} else {
+		tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hmac.Equal([]byte(tok), []byte(p.token(propCid))) {
+			http.Error(w, "invalid push token", http.StatusUnauthorized)
+			return
+		}
+		if deal == nil {
+			http.Error(w, "unknown deal", http.StatusNotFound)
+			return
+		}
+	}
+
+	if deal.Ref == nil || deal.Ref.TransferType != storagemarket.TTManual {
+		http.Error(w, "not an offline deal", http.StatusBadRequest)
+		return
+	}
+	if deal.State != storagemarket.StorageDealWaitingForData {
+		http.Error(w, "deal isn't waiting for data, state: "+storagemarket.DealStates[deal.State], http.StatusConflict)
+		return
+	}
+
+	p.lk.Lock()
+	if _, ok := p.pushing[propCid]; ok {
+		p.lk.Unlock()
+		http.Error(w, "data is already being pushed", http.StatusConflict)
+		return
+	}
+	p.pushing[propCid] = struct{}{}
+	p.lk.Unlock()
+
+	defer func() {
+		p.lk.Lock()
+		delete(p.pushing, propCid)
+		p.lk.Unlock()
+	}()
+
+	log.Infow("receiving pushed deal data", "proposal", propCid, "libp2p", viaLibp2p)
+
+	body := http.MaxBytesReader(w, r.Body, int64(deal.Proposal.PieceSize.Unpadded()))
+	if err := p.deals.ImportDataForDeal(r.Context(), propCid, body); err != nil {
+		log.Warnw("importing pushed deal data", "proposal", propCid, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,119 @@
+package dealtransfer
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("dealtransfer")
+
+// Transfer protocols for deal data. With graphsync the miner pulls the data,
+// the storage market's online deals; with the push protocols the client
+// sends the data of an offline deal to the miner after proposing it.
+const (
+	ProtocolGraphsync  = "graphsync"
+	ProtocolHTTP       = "http"
+	ProtocolLibp2pHTTP = "libp2p-http"
+)
+
+const (
+	// QueryProtocolID is used by clients to ask a miner for its protocols
+	QueryProtocolID = "/lotus/deal-transfers/1.0.0"
+	// PushProtocolID carries push requests over libp2p streams, as HTTP
+	PushProtocolID = "/lotus/deal-push/http/1.0.0"
+
+	// PushPath is where deal data is PUT, followed by the proposal CID
+	PushPath = "/deals/push/"
+)
+
+// DefaultPreference is the order in which clients pick a push protocol.
+// libp2p-http goes first: it needs no public HTTP endpoint on the miner and
+// the client is authenticated by its peer ID.
+var DefaultPreference = []string{ProtocolLibp2pHTTP, ProtocolHTTP}
+
+// QueryRequest asks a miner for its transfer protocols. With a Proposal of a
+// deal the querying peer is the client of, the response includes what the
+// client needs to push the data of the deal with HTTP.
+type QueryRequest struct {
+	Proposal *cid.Cid
+}
+
+// Negotiate picks the first of the client's preferred protocols the miner
+// offers, or returns an empty string
+func Negotiate(offered []string, preference []string) string {
+	for _, p := range preference {
+		for _, o := range offered {
+			if o == p {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// streamConn is a libp2p stream used as the connection of an HTTP request
+type streamConn struct {
+	network.Stream
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return peerAddr(c.Conn().LocalPeer())
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return peerAddr(c.Conn().RemotePeer())
+}
+
+type peerAddr peer.ID
+
+func (a peerAddr) Network() string { return "libp2p" }
+func (a peerAddr) String() string  { return peer.ID(a).String() }
+
+// streamListener accepts PushProtocolID streams as connections of an HTTP
+// server
+type streamListener struct {
+	self   peer.ID
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *streamListener) handle(s network.Stream) {
+	select {
+	case l.conns <- &streamConn{s}:
+	case <-l.closed:
+		_ = s.Reset()
+	}
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *streamListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return peerAddr(l.self)
+}
+
+type remotePeerKey struct{}
+
+// remotePeer returns the peer a push request arrived from over libp2p
+func remotePeer(ctx context.Context) (peer.ID, bool) {
+	p, ok := ctx.Value(remotePeerKey{}).(peer.ID)
+	return p, ok
+}
@@ -0,0 +1,114 @@
+package dealtransfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+)
+
+type testDeals struct {
+	lk       sync.Mutex
+	deals    []storagemarket.MinerDeal
+	imported map[cid.Cid][]byte
+}
+
+func (d *testDeals) ListLocalDeals() ([]storagemarket.MinerDeal, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	return append([]storagemarket.MinerDeal{}, d.deals...), nil
+}
+
+func (d *testDeals) ImportDataForDeal(ctx context.Context, propCid cid.Cid, data io.Reader) error {
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.imported[propCid] = b
+	for i := range d.deals {
+		if d.deals[i].ProposalCid == propCid {
+			d.deals[i].State = storagemarket.StorageDealVerifyData
+		}
+	}
+	return nil
+}
+
+func TestQueryAndPush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	hm, err := mn.GenPeer()
+	require.NoError(t, err)
+	hc, err := mn.GenPeer()
+	require.NoError(t, err)
+	ho, err := mn.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, mn.LinkAll())
+
+	propCid, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+
+	deals := &testDeals{
+		deals: []storagemarket.MinerDeal{{
+			ClientDealProposal: market.ClientDealProposal{
+				Proposal: market.DealProposal{PieceSize: abi.PaddedPieceSize(128)},
+			},
+			ProposalCid: propCid,
+			Client:      hc.ID(),
+			State:       storagemarket.StorageDealWaitingForData,
+			Ref:         &storagemarket.DataRef{TransferType: storagemarket.TTManual},
+		}},
+		imported: map[cid.Cid][]byte{},
+	}
+
+	cfg := Config{HTTP: true, HTTPListen: "127.0.0.1:0", Libp2pHTTP: true}
+	p, err := NewProvider(hm, deals, cfg, func() (bool, error) { return false, nil })
+	require.NoError(t, err)
+	require.NoError(t, p.Start(ctx))
+	defer p.Stop(ctx) //nolint:errcheck
+
+	// only the client of a deal gets the push URL
+	tr, err := Query(ctx, ho, hm.ID(), &propCid)
+	require.NoError(t, err)
+	require.Equal(t, []string{ProtocolLibp2pHTTP, ProtocolHTTP}, tr.Protocols)
+	require.Empty(t, tr.PushURL)
+
+	tr, err = Query(ctx, hc, hm.ID(), &propCid)
+	require.NoError(t, err)
+	require.NotEmpty(t, tr.PushURL)
+	require.NotEmpty(t, tr.PushToken)
+
+	require.Equal(t, ProtocolHTTP, Negotiate(tr.Protocols, []string{ProtocolGraphsync, ProtocolHTTP}))
+	require.Equal(t, "", Negotiate(tr.Protocols, []string{ProtocolGraphsync}))
+
+	data := []byte("deal data")
+
+	// other peers can't push the data
+	require.Error(t, Push(ctx, ho, hm.ID(), ProtocolLibp2pHTTP, tr, propCid, bytes.NewReader(data)))
+	bad := tr
+	bad.PushToken = "bad"
+	require.Error(t, Push(ctx, hc, hm.ID(), ProtocolHTTP, bad, propCid, bytes.NewReader(data)))
+
+	// pushes are capped at the piece size
+	require.Error(t, Push(ctx, hc, hm.ID(), ProtocolLibp2pHTTP, tr, propCid, bytes.NewReader(make([]byte, 128))))
+
+	require.NoError(t, Push(ctx, hc, hm.ID(), ProtocolLibp2pHTTP, tr, propCid, bytes.NewReader(data)))
+	require.Equal(t, data, deals.imported[propCid])
+
+	// the deal isn't waiting for data anymore
+	require.Error(t, Push(ctx, hc, hm.ID(), ProtocolHTTP, tr, propCid, bytes.NewReader(data)))
+}
@@ -6,29 +6,27 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
-	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
-	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/markets/retrievalsched"
+	"github.com/filecoin-project/lotus/storage/sectorblocks"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/shared"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/specs-actors/actors/builtin/paych"
-
-	"github.com/ipfs/go-cid"
 )
 
 type retrievalProviderNode struct {
-	miner  *storage.Miner
-	sealer sectorstorage.SectorManager
-	full   api.FullNode
+	secb  sectorblocks.SectorBuilder
+	full  api.FullNode
+	sched *retrievalsched.Scheduler
 }
 
 // NewRetrievalProviderNode returns a new node adapter for a retrieval provider that talks to the
-// Lotus Node
-func NewRetrievalProviderNode(miner *storage.Miner, sealer sectorstorage.SectorManager, full api.FullNode) retrievalmarket.RetrievalProviderNode {
-	return &retrievalProviderNode{miner, sealer, full}
+// Lotus Node. Pieces are read from sectors when the scheduler has a free slot.
+func NewRetrievalProviderNode(secb sectorblocks.SectorBuilder, full api.FullNode, sched *retrievalsched.Scheduler) retrievalmarket.RetrievalProviderNode {
+	return &retrievalProviderNode{secb, full, sched}
 }
 
 func (rpn *retrievalProviderNode) GetMinerWorkerAddress(ctx context.Context, miner address.Address, tok shared.TipSetToken) (address.Address, error) {
@@ -42,28 +40,16 @@ func (rpn *retrievalProviderNode) GetMinerWorkerAddress(ctx context.Context, min
 }
 
 func (rpn *retrievalProviderNode) UnsealSector(ctx context.Context, sectorID abi.SectorNumber, offset abi.UnpaddedPieceSize, length abi.UnpaddedPieceSize) (io.ReadCloser, error) {
-	si, err := rpn.miner.GetSectorInfo(sectorID)
-	if err != nil {
-		return nil, err
-	}
-
-	mid, err := address.IDFromAddress(rpn.miner.Address())
-	if err != nil {
-		return nil, err
-	}
-
-	sid := abi.SectorID{
-		Miner:  abi.ActorID(mid),
-		Number: sectorID,
-	}
-
 	r, w := io.Pipe()
 	go func() {
-		var commD cid.Cid
-		if si.CommD != nil {
-			commD = *si.CommD
+		release, err := rpn.sched.Acquire(ctx, sectorID, offset)
+		if err != nil {
+			_ = w.CloseWithError(err)
+			return
 		}
-		err := rpn.sealer.ReadPiece(ctx, w, sid, storiface.UnpaddedByteIndex(offset), length, si.TicketValue, commD)
+		defer release()
+
+		err = rpn.secb.ReadPiece(ctx, w, sectorID, storiface.UnpaddedByteIndex(offset), length)
 		_ = w.CloseWithError(err)
 	}()
 
@@ -0,0 +1,291 @@
+package retrievalsched
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/filecoin-project/go-fil-markets/piecestore"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+var log = logging.Logger("retrievalsched")
+
+// IdleTimeout drops retrievals without state changes for this long from the
+// active ones, e.g. deals the client abandoned
+var IdleTimeout = time.Hour
+
+// Config limits retrieval serving, 0 means no limit
+type Config struct {
+	// MaxRetrievals is the number of retrievals served at once
+	MaxRetrievals int
+	// MaxRetrievalsPerClient is the number of retrievals served at once for
+	// a single client
+	MaxRetrievalsPerClient int
+	// MaxUnseals is the number of pieces read from sectors at once
+	MaxUnseals int
+}
+
+type active struct {
+	client  peer.ID
+	pieces  []piecestore.DealInfo
+	started time.Time
+	seen    time.Time
+}
+
+type waiter struct {
+	client peer.ID
+	queued time.Time
+	ready  chan struct{}
+}
+
+// Scheduler admits retrieval deals within the configured limits, and
+// schedules the reads of pieces from sectors. Reads beyond MaxUnseals wait in
+// a queue served fairly: the next read goes to the client with the fewest
+// running reads, so a burst of retrievals from one client doesn't hold up
+// the others, or take all the disk IO the miner needs for proving.
+type Scheduler struct {
+	cfg Config
+
+	lk      sync.Mutex
+	deals   map[retrievalmarket.ProviderDealIdentifier]*active
+	queue   []*waiter
+	running map[peer.ID]int
+	unseals int
+
+	rejectedBusy   uint64
+	rejectedClient uint64
+}
+
+func New(cfg Config) *Scheduler {
+	return &Scheduler{
+		cfg:     cfg,
+		deals:   map[retrievalmarket.ProviderDealIdentifier]*active{},
+		running: map[peer.ID]int{},
+	}
+}
+
+// Admit decides whether a retrieval deal is accepted with the current load,
+// it's meant to be called from the deal decider
+func (s *Scheduler) Admit(deal retrievalmarket.ProviderDealState) (bool, string) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	now := time.Now()
+	s.pruneIdle(now)
+
+	id := deal.Identifier()
+	if _, ok := s.deals[id]; ok {
+		return true, ""
+	}
+
+	if s.cfg.MaxRetrievals > 0 && len(s.deals) >= s.cfg.MaxRetrievals {
+		s.rejectedBusy++
+		return false, "miner is serving too many retrievals, try again later"
+	}
+	if s.cfg.MaxRetrievalsPerClient > 0 && s.clientDeals(deal.Receiver) >= s.cfg.MaxRetrievalsPerClient {
+		s.rejectedClient++
+		return false, "too many concurrent retrievals for this client, try again later"
+	}
+
+	a := &active{
+		client:  deal.Receiver,
+		started: now,
+		seen:    now,
+	}
+	if deal.PieceInfo != nil {
+		a.pieces = deal.PieceInfo.Deals
+	}
+	s.deals[id] = a
+	return true, ""
+}
+
+// OnEvent tracks the state of admitted deals, it's subscribed to the events
+// of the retrieval provider
+func (s *Scheduler) OnEvent(event retrievalmarket.ProviderEvent, deal retrievalmarket.ProviderDealState) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	id := deal.Identifier()
+	a, ok := s.deals[id]
+	if !ok {
+		return
+	}
+
+	switch deal.Status {
+	case retrievalmarket.DealStatusCompleted,
+		retrievalmarket.DealStatusRejected,
+		retrievalmarket.DealStatusDealNotFound,
+		retrievalmarket.DealStatusErrored,
+		retrievalmarket.DealStatusCancelled:
+		delete(s.deals, id)
+	default:
+		a.seen = time.Now()
+	}
+}
+
+// Acquire waits for a slot to read a piece from a sector. The returned
+// function must be called when the read is done.
+func (s *Scheduler) Acquire(ctx context.Context, sector abi.SectorNumber, offset abi.UnpaddedPieceSize) (func(), error) {
+	s.lk.Lock()
+	w := &waiter{
+		client: s.clientFor(sector, offset),
+		queued: time.Now(),
+		ready:  make(chan struct{}),
+	}
+	s.queue = append(s.queue, w)
+	s.dispatch()
+	s.lk.Unlock()
+
+	select {
+	case <-w.ready:
+		return func() {
+			s.lk.Lock()
+			defer s.lk.Unlock()
+			s.done(w.client)
+		}, nil
+	case <-ctx.Done():
+		s.lk.Lock()
+		defer s.lk.Unlock()
+
+		for i, qw := range s.queue {
+			if qw == w {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+
+		// dispatched in the meantime
+		s.done(w.client)
+		return nil, ctx.Err()
+	}
+}
+
+// done frees the slot of a finished read, must be called with s.lk held
+func (s *Scheduler) done(client peer.ID) {
+	s.unseals--
+	s.running[client]--
+	if s.running[client] == 0 {
+		delete(s.running, client)
+	}
+	s.dispatch()
+}
+
+// dispatch starts queued reads while there are free slots, must be called
+// with s.lk held
+func (s *Scheduler) dispatch() {
+	for len(s.queue) > 0 && (s.cfg.MaxUnseals <= 0 || s.unseals < s.cfg.MaxUnseals) {
+		next := 0
+		for i, w := range s.queue {
+			if s.running[w.client] < s.running[s.queue[next].client] {
+				next = i
+			}
+		}
+
+		w := s.queue[next]
+		s.queue = append(s.queue[:next], s.queue[next+1:]...)
+
+		s.unseals++
+		s.running[w.client]++
+		close(w.ready)
+
+		if waited := time.Since(w.queued); waited > time.Minute {
+			log.Infow("piece read waited for a slot", "client", w.client, "waited", waited)
+		}
+	}
+}
+
+// clientFor finds the client of the oldest admitted deal for a piece. Reads
+// which can't be attributed, e.g. of deals admitted before a restart, are
+// scheduled as one client.
+func (s *Scheduler) clientFor(sector abi.SectorNumber, offset abi.UnpaddedPieceSize) peer.ID {
+	var found *active
+	for _, a := range s.deals {
+		for _, p := range a.pieces {
+			if p.SectorID == sector && p.Offset.Unpadded() == offset {
+				if found == nil || a.started.Before(found.started) {
+					found = a
+				}
+			}
+		}
+	}
+	if found == nil {
+		return ""
+	}
+	return found.client
+}
+
+func (s *Scheduler) clientDeals(client peer.ID) int {
+	var n int
+	for _, a := range s.deals {
+		if a.client == client {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Scheduler) pruneIdle(now time.Time) {
+	for id, a := range s.deals {
+		if now.Sub(a.seen) > IdleTimeout {
+			log.Warnw("dropping idle retrieval", "client", id.Receiver, "deal", id.DealID, "idle", now.Sub(a.seen))
+			delete(s.deals, id)
+		}
+	}
+}
+
+// Stats returns the limits and current load
+func (s *Scheduler) Stats() api.RetrievalStats {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.pruneIdle(time.Now())
+
+	st := api.RetrievalStats{
+		Active:         len(s.deals),
+		MaxActive:      s.cfg.MaxRetrievals,
+		MaxPerClient:   s.cfg.MaxRetrievalsPerClient,
+		RunningUnseals: s.unseals,
+		QueuedUnseals:  len(s.queue),
+		MaxUnseals:     s.cfg.MaxUnseals,
+		RejectedBusy:   s.rejectedBusy,
+		RejectedClient: s.rejectedClient,
+	}
+
+	clients := map[peer.ID]*api.RetrievalClientStats{}
+	client := func(p peer.ID) *api.RetrievalClientStats {
+		cs, ok := clients[p]
+		if !ok {
+			cs = &api.RetrievalClientStats{Client: p}
+			clients[p] = cs
+		}
+		return cs
+	}
+	for _, a := range s.deals {
+		client(a.client).Active++
+	}
+	for p, n := range s.running {
+		client(p).RunningUnseals = n
+	}
+	for _, w := range s.queue {
+		client(w.client).QueuedUnseals++
+	}
+
+	for _, cs := range clients {
+		st.Clients = append(st.Clients, *cs)
+	}
+	sort.Slice(st.Clients, func(i, j int) bool {
+		if st.Clients[i].Active != st.Clients[j].Active {
+			return st.Clients[i].Active > st.Clients[j].Active
+		}
+		return st.Clients[i].Client < st.Clients[j].Client
+	})
+	return st
+}
@@ -0,0 +1,105 @@
+package retrievalsched
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/piecestore"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+func deal(client peer.ID, id retrievalmarket.DealID, sector abi.SectorNumber) retrievalmarket.ProviderDealState {
+	return retrievalmarket.ProviderDealState{
+		DealProposal: retrievalmarket.DealProposal{ID: id},
+		Receiver:     client,
+		PieceInfo: &piecestore.PieceInfo{
+			Deals: []piecestore.DealInfo{{SectorID: sector}},
+		},
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	s := New(Config{MaxRetrievals: 3, MaxRetrievalsPerClient: 2})
+
+	ok, _ := s.Admit(deal("a", 1, 1))
+	require.True(t, ok)
+	ok, _ = s.Admit(deal("a", 2, 1))
+	require.True(t, ok)
+	ok, _ = s.Admit(deal("a", 3, 1))
+	require.False(t, ok, "per client limit")
+
+	ok, _ = s.Admit(deal("b", 1, 2))
+	require.True(t, ok)
+	ok, _ = s.Admit(deal("c", 1, 3))
+	require.False(t, ok, "total limit")
+
+	d := deal("a", 1, 1)
+	d.Status = retrievalmarket.DealStatusCompleted
+	s.OnEvent(retrievalmarket.ProviderEventComplete, d)
+
+	ok, _ = s.Admit(deal("c", 1, 3))
+	require.True(t, ok)
+
+	st := s.Stats()
+	require.Equal(t, 3, st.Active)
+	require.Equal(t, uint64(1), st.RejectedBusy)
+	require.Equal(t, uint64(1), st.RejectedClient)
+	require.Len(t, st.Clients, 3)
+}
+
+func TestFairUnseals(t *testing.T) {
+	ctx := context.Background()
+	s := New(Config{MaxUnseals: 2})
+
+	for i := 0; i < 3; i++ {
+		ok, _ := s.Admit(deal("a", retrievalmarket.DealID(i), abi.SectorNumber(i)))
+		require.True(t, ok)
+	}
+	ok, _ := s.Admit(deal("b", 0, 10))
+	require.True(t, ok)
+
+	release0, err := s.Acquire(ctx, 0, 0)
+	require.NoError(t, err)
+	release1, err := s.Acquire(ctx, 1, 0)
+	require.NoError(t, err)
+
+	order := make(chan abi.SectorNumber, 2)
+	acquire := func(sector abi.SectorNumber) {
+		r, err := s.Acquire(ctx, sector, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		order <- sector
+		r()
+	}
+
+	// a queues a read before b
+	go acquire(2)
+	require.Eventually(t, func() bool { return s.Stats().QueuedUnseals == 1 }, time.Second, time.Millisecond)
+	go acquire(10)
+	require.Eventually(t, func() bool { return s.Stats().QueuedUnseals == 2 }, time.Second, time.Millisecond)
+
+	// a still has a running read, b goes first
+	release0()
+	require.Equal(t, abi.SectorNumber(10), <-order)
+	require.Equal(t, abi.SectorNumber(2), <-order)
+
+	// cancelled waits leave the queue
+	release0, err = s.Acquire(ctx, 0, 0)
+	require.NoError(t, err)
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.Acquire(cctx, 2, 0)
+	require.Error(t, err)
+	require.Equal(t, 0, s.Stats().QueuedUnseals)
+
+	release0()
+	release1()
+	require.Equal(t, 0, s.Stats().RunningUnseals)
+}
@@ -0,0 +1,96 @@
+package markets
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/requestvalidation"
+
+	"github.com/filecoin-project/lotus/lib/ops"
+)
+
+// TransferOperations reports data transfers as operations. Storage deal
+// transfers are sized by the unpadded piece size of the deal, so progress is
+// approximate for pieces which are mostly padding. The size of other
+// transfers is only known when the transfer reports it.
+type TransferOperations struct {
+	self peer.ID
+	reg  *ops.Registry
+
+	lk    sync.Mutex
+	sizes map[cid.Cid]uint64
+	ops   map[datatransfer.ChannelID]*ops.Operation
+}
+
+func NewTransferOperations(self peer.ID, reg *ops.Registry) *TransferOperations {
+	return &TransferOperations{
+		self:  self,
+		reg:   reg,
+		sizes: map[cid.Cid]uint64{},
+		ops:   map[datatransfer.ChannelID]*ops.Operation{},
+	}
+}
+
+// OnStorageEvent records the size of deals which are about to receive data
+func (t *TransferOperations) OnStorageEvent(_ storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	switch deal.State {
+	case storagemarket.StorageDealValidating, storagemarket.StorageDealAcceptWait,
+		storagemarket.StorageDealWaitingForData, storagemarket.StorageDealTransferring:
+		t.sizes[deal.ProposalCid] = uint64(deal.Proposal.PieceSize.Unpadded())
+	default:
+		delete(t.sizes, deal.ProposalCid)
+	}
+}
+
+// OnTransferEvent updates the operation of a data transfer channel
+func (t *TransferOperations) OnTransferEvent(evt datatransfer.Event, ch datatransfer.ChannelState) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	id := ch.ChannelID()
+	op, ok := t.ops[id]
+	if !ok {
+		switch evt.Code {
+		case datatransfer.Complete, datatransfer.Error, datatransfer.Cancel, datatransfer.CleanupComplete:
+			return
+		}
+
+		desc := fmt.Sprintf("sending %s to %s", ch.BaseCID(), ch.Recipient())
+		if ch.Recipient() == t.self {
+			desc = fmt.Sprintf("receiving %s from %s", ch.BaseCID(), ch.Sender())
+		}
+
+		total := ch.TotalSize()
+		if v, ok := ch.Voucher().(*requestvalidation.StorageDataTransferVoucher); ok && total == 0 {
+			total = t.sizes[v.Proposal]
+		}
+
+		op = t.reg.Start("transfer", desc)
+		op.SetTotal(total, "bytes")
+		t.ops[id] = op
+	}
+
+	done := ch.Received()
+	if ch.Sent() > done {
+		done = ch.Sent()
+	}
+	op.SetDone(done)
+
+	switch evt.Code {
+	case datatransfer.Complete:
+		op.Finish(nil)
+		delete(t.ops, id)
+	case datatransfer.Error, datatransfer.Cancel:
+		op.Finish(xerrors.Errorf("transfer %s: %s", datatransfer.Events[evt.Code], ch.Message()))
+		delete(t.ops, id)
+	}
+}
@@ -24,6 +24,11 @@ var (
 	MessageTo, _    = tag.NewKey("message_to")
 	MessageNonce, _ = tag.NewKey("message_nonce")
 	ReceivedFrom, _ = tag.NewKey("received_from")
+	MinerID, _      = tag.NewKey("miner_id")
+	Endpoint, _     = tag.NewKey("endpoint")
+	TaskType, _     = tag.NewKey("task_type")
+	TaskState, _    = tag.NewKey("task_state")
+	PoStResult, _   = tag.NewKey("post_result")
 )
 
 // Measures
@@ -49,6 +54,28 @@ var (
 	PubsubRecvRPC                       = stats.Int64("pubsub/recv_rpc", "Counter for total received RPCs", stats.UnitDimensionless)
 	PubsubSendRPC                       = stats.Int64("pubsub/send_rpc", "Counter for total sent RPCs", stats.UnitDimensionless)
 	PubsubDropRPC                       = stats.Int64("pubsub/drop_rpc", "Counter for total dropped RPCs", stats.UnitDimensionless)
+
+	MinerWorkerBalance     = stats.Float64("miner/worker_balance", "Balance of the miner worker wallet in FIL", stats.UnitDimensionless)
+	MinerFaultySectors     = stats.Int64("miner/faulty_sectors", "Number of faulty sectors of the miner", stats.UnitDimensionless)
+	MinerDeadlineUnproven  = stats.Int64("miner/deadline_unproven_partitions", "Partitions of the current deadline without a proof", stats.UnitDimensionless)
+	MinerDeadlineRemaining = stats.Float64("miner/deadline_remaining_seconds", "Time until the current deadline closes", stats.UnitSeconds)
+	MinerWorkers           = stats.Int64("miner/workers", "Number of connected workers", stats.UnitDimensionless)
+	MinerCronFailedJobs    = stats.Int64("miner/cron_failed_jobs", "Number of cron jobs whose last run failed", stats.UnitDimensionless)
+	MinerExpiredPreCommits = stats.Int64("miner/expired_precommits", "Counter for precommits which expired before the sector was proven", stats.UnitDimensionless)
+
+	MinerSealingTasks     = stats.Int64("miner/sealing_tasks", "Number of sealing tasks running or assigned to workers", stats.UnitDimensionless)
+	MinerWorkerCPUsUsed   = stats.Int64("miner/worker_cpus_used", "CPU threads used by sealing tasks on all workers", stats.UnitDimensionless)
+	MinerWorkerCPUs       = stats.Int64("miner/worker_cpus", "CPU threads of all workers", stats.UnitDimensionless)
+	MinerWorkerGPUsUsed   = stats.Int64("miner/worker_gpus_used", "Number of workers running a task on their GPUs", stats.UnitDimensionless)
+	MinerWorkerGPUs       = stats.Int64("miner/worker_gpus", "GPUs of all workers", stats.UnitDimensionless)
+	MinerWorkerMemoryUsed = stats.Int64("miner/worker_memory_used_bytes", "Memory reserved by sealing tasks on all workers", stats.UnitBytes)
+	MinerWorkerMemory     = stats.Int64("miner/worker_memory_bytes", "Physical memory of all workers", stats.UnitBytes)
+	MinerPoStSubmissions  = stats.Int64("miner/post_submissions", "Counter for window PoSt messages, by result", stats.UnitDimensionless)
+	MinerPledges          = stats.Int64("miner/pledged_sectors", "Counter for sectors pledged by the pledge loop", stats.UnitDimensionless)
+	MinerPledgeSkips      = stats.Int64("miner/pledge_skips", "Counter for idle workers the pledge loop didn't pledge a sector for", stats.UnitDimensionless)
+
+	APIRequestDuration = stats.Float64("api/request_duration_ms", "Duration of API requests", stats.UnitMilliseconds)
+	APIRequestErrors   = stats.Int64("api/request_errors", "Counter for API requests which returned an error", stats.UnitDimensionless)
 )
 
 var (
@@ -137,8 +164,133 @@ var (
 		Measure:     PubsubDropRPC,
 		Aggregation: view.Count(),
 	}
+	MinerWorkerBalanceView = &view.View{
+		Measure:     MinerWorkerBalance,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerFaultySectorsView = &view.View{
+		Measure:     MinerFaultySectors,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerDeadlineUnprovenView = &view.View{
+		Measure:     MinerDeadlineUnproven,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerDeadlineRemainingView = &view.View{
+		Measure:     MinerDeadlineRemaining,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerWorkersView = &view.View{
+		Measure:     MinerWorkers,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerCronFailedJobsView = &view.View{
+		Measure:     MinerCronFailedJobs,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerExpiredPreCommitsView = &view.View{
+		Measure:     MinerExpiredPreCommits,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerSealingTasksView = &view.View{
+		Measure:     MinerSealingTasks,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID, TaskType, TaskState},
+	}
+	MinerWorkerCPUsUsedView = &view.View{
+		Measure:     MinerWorkerCPUsUsed,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerWorkerCPUsView = &view.View{
+		Measure:     MinerWorkerCPUs,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerWorkerGPUsUsedView = &view.View{
+		Measure:     MinerWorkerGPUsUsed,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerWorkerGPUsView = &view.View{
+		Measure:     MinerWorkerGPUs,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerWorkerMemoryUsedView = &view.View{
+		Measure:     MinerWorkerMemoryUsed,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerWorkerMemoryView = &view.View{
+		Measure:     MinerWorkerMemory,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerID},
+	}
+	MinerPoStSubmissionsView = &view.View{
+		Measure:     MinerPoStSubmissions,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{MinerID, PoStResult},
+	}
+	MinerPledgesView = &view.View{
+		Measure:     MinerPledges,
+		Aggregation: view.Count(),
+	}
+	MinerPledgeSkipsView = &view.View{
+		Measure:     MinerPledgeSkips,
+		Aggregation: view.Count(),
+	}
+	APIRequestDurationView = &view.View{
+		Measure:     APIRequestDuration,
+		Aggregation: defaultMillisecondsDistribution,
+		TagKeys:     []tag.Key{Endpoint},
+	}
+	APIRequestsView = &view.View{
+		Name:        "api/requests",
+		Description: "Counter for API requests",
+		Measure:     APIRequestDuration,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Endpoint},
+	}
+	APIRequestErrorsView = &view.View{
+		Measure:     APIRequestErrors,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{Endpoint},
+	}
 )
 
+// MinerViews are the views reported by storage miners, used by the miner
+// alert rules
+var MinerViews = []*view.View{
+	MinerWorkerBalanceView,
+	MinerFaultySectorsView,
+	MinerDeadlineUnprovenView,
+	MinerDeadlineRemainingView,
+	MinerWorkersView,
+	MinerCronFailedJobsView,
+	MinerExpiredPreCommitsView,
+	MinerSealingTasksView,
+	MinerWorkerCPUsUsedView,
+	MinerWorkerCPUsView,
+	MinerWorkerGPUsUsedView,
+	MinerWorkerGPUsView,
+	MinerWorkerMemoryUsedView,
+	MinerWorkerMemoryView,
+	MinerPoStSubmissionsView,
+	MinerPledgesView,
+	MinerPledgeSkipsView,
+	APIRequestDurationView,
+	APIRequestsView,
+	APIRequestErrorsView,
+}
+
 // DefaultViews is an array of OpenCensus views for metric gathering purposes
 var DefaultViews = append([]*view.View{
 	InfoView,
@@ -161,6 +313,9 @@ var DefaultViews = append([]*view.View{
 	PubsubRecvRPCView,
 	PubsubSendRPCView,
 	PubsubDropRPCView,
+	APIRequestDurationView,
+	APIRequestsView,
+	APIRequestErrorsView,
 },
 	rpcmetrics.DefaultViews...)
 
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/lib/rpctrace"
+)
+
+var log = logging.Logger("metrics")
+
+// maxLoggedParams limits the size of the parameters logged for a slow call
+const maxLoggedParams = 1 << 10
+
+// MetricedFullAPI records the latency of API calls in APIRequestDuration,
+// and calls returning an error in APIRequestErrors.
+// Calls taking longer than slow are logged with their parameters, secrets
+// redacted like in API traces, 0 disables the log.
+func MetricedFullAPI(a api.FullNode, slow time.Duration) api.FullNode {
+	var out apistruct.FullNodeStruct
+	proxy(a, slow, &out.Internal)
+	proxy(a, slow, &out.CommonStruct.Internal)
+	return &out
+}
+
+// MetricedStorMinerAPI is MetricedFullAPI for the storage miner API
+func MetricedStorMinerAPI(a api.StorageMiner, slow time.Duration) api.StorageMiner {
+	var out apistruct.StorageMinerStruct
+	proxy(a, slow, &out.Internal)
+	proxy(a, slow, &out.CommonStruct.Internal)
+	return &out
+}
+
+// MetricedWorkerAPI is MetricedFullAPI for the worker API
+func MetricedWorkerAPI(a api.WorkerAPI, slow time.Duration) api.WorkerAPI {
+	var out apistruct.WorkerStruct
+	proxy(a, slow, &out.Internal)
+	return &out
+}
+
+func proxy(in interface{}, slow time.Duration, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := ra.MethodByName(field.Name)
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			ctx := args[0].Interface().(context.Context)
+			ctx, _ = tag.New(ctx, tag.Upsert(Endpoint, field.Name))
+			args[0] = reflect.ValueOf(ctx)
+
+			start := time.Now()
+			defer func() {
+				stats.Record(ctx, APIRequestDuration.M(SinceInMilliseconds(start)))
+
+				if took := time.Since(start); slow > 0 && took > slow {
+					log.Warnw("slow API call", "method", field.Name, "took", took, "caller", CallerFromContext(ctx), "params", logParams(field.Name, args[1:]))
+				}
+			}()
+
+			results = fn.Call(args)
+			if len(results) > 0 {
+				if err, _ := results[len(results)-1].Interface().(error); err != nil {
+					stats.Record(ctx, APIRequestErrors.M(1))
+				}
+			}
+			return results
+		}))
+	}
+}
+
+func logParams(method string, args []reflect.Value) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // keep the redaction placeholders readable
+	if err := enc.Encode(rpctrace.EncodeParams(method, args)); err != nil {
+		return "<" + err.Error() + ">"
+	}
+
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if len(b) > maxLoggedParams {
+		return string(b[:maxLoggedParams]) + "..."
+	}
+	return string(b)
+}
+
+type callerKey struct{}
+
+// CallerHandler puts the remote address of API requests into the request
+// context, so slow calls can be traced back to the API consumer
+type CallerHandler struct {
+	Next http.Handler
+}
+
+func (h *CallerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, r.RemoteAddr)))
+}
+
+// CallerFromContext returns the remote address put into ctx by
+// CallerHandler, or an empty string
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+type callAPI struct {
+	Internal struct {
+		Call func(context.Context, int) (int, error)
+	}
+}
+
+type impl struct{}
+
+func (impl) Call(ctx context.Context, n int) (int, error) {
+	time.Sleep(time.Millisecond)
+	return n + 1, nil
+}
+
+func TestProxy(t *testing.T) {
+	require.NoError(t, view.Register(APIRequestDurationView))
+	defer view.Unregister(APIRequestDurationView)
+
+	var out callAPI
+	proxy(impl{}, time.Nanosecond, &out.Internal)
+
+	n, err := out.Internal.Call(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	rows, err := view.RetrieveData(APIRequestDurationView.Name)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, "Call", rows[0].Tags[0].Value)
+	require.Equal(t, int64(1), rows[0].Data.(*view.DistributionData).Count)
+}
+
+func TestLogParams(t *testing.T) {
+	require.Equal(t, `[1,"a"]`, logParams("Call", []reflect.Value{reflect.ValueOf(1), reflect.ValueOf("a")}))
+
+	long := logParams("Call", []reflect.Value{reflect.ValueOf(strings.Repeat("a", 2*maxLoggedParams))})
+	require.Len(t, long, maxLoggedParams+len("..."))
+
+	// secrets aren't logged
+	require.Equal(t, `["<redacted>"]`, logParams("AuthVerify", []reflect.Value{reflect.ValueOf("token")}))
+	key := struct {
+		Type       string
+		PrivateKey []byte
+	}{"bls", []byte{1}}
+	require.Equal(t, `[{"PrivateKey":"<redacted>","Type":"bls"}]`, logParams("Call", []reflect.Value{reflect.ValueOf(key)}))
+}
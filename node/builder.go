@@ -16,7 +16,6 @@ import (
 	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	record "github.com/libp2p/go-libp2p-record"
-	"github.com/multiformats/go-multiaddr"
 	"go.uber.org/fx"
 	"golang.org/x/xerrors"
 
@@ -47,11 +46,21 @@ import (
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
 	"github.com/filecoin-project/lotus/journal"
+	"github.com/filecoin-project/lotus/lib/addrutil"
+	"github.com/filecoin-project/lotus/lib/approval"
 	"github.com/filecoin-project/lotus/lib/blockstore"
+	"github.com/filecoin-project/lotus/lib/checkpoint"
+	"github.com/filecoin-project/lotus/lib/commp"
+	"github.com/filecoin-project/lotus/lib/ops"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/profiles"
+	"github.com/filecoin-project/lotus/lib/quota"
 	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
 	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
 	"github.com/filecoin-project/lotus/markets/dealfilter"
+	"github.com/filecoin-project/lotus/markets/dealintake"
+	"github.com/filecoin-project/lotus/markets/dealpay"
+	"github.com/filecoin-project/lotus/markets/retrievalsched"
 	"github.com/filecoin-project/lotus/markets/storageadapter"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/config"
@@ -63,11 +72,25 @@ import (
 	"github.com/filecoin-project/lotus/node/modules/helpers"
 	"github.com/filecoin-project/lotus/node/modules/lp2p"
 	"github.com/filecoin-project/lotus/node/modules/testing"
+	"github.com/filecoin-project/lotus/node/reload"
 	"github.com/filecoin-project/lotus/node/repo"
 	"github.com/filecoin-project/lotus/paychmgr"
 	"github.com/filecoin-project/lotus/paychmgr/settler"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/alerts"
+	"github.com/filecoin-project/lotus/storage/autotune"
+	"github.com/filecoin-project/lotus/storage/carindex"
+	"github.com/filecoin-project/lotus/storage/cron"
+	"github.com/filecoin-project/lotus/storage/gasreport"
+	"github.com/filecoin-project/lotus/storage/keychange"
+	"github.com/filecoin-project/lotus/storage/labels"
 	"github.com/filecoin-project/lotus/storage/sectorblocks"
+	"github.com/filecoin-project/lotus/storage/sectorhooks"
+	"github.com/filecoin-project/lotus/storage/sectorindex"
+	"github.com/filecoin-project/lotus/storage/sweep"
+	"github.com/filecoin-project/lotus/storage/workerreg"
+	"github.com/filecoin-project/lotus/storage/workertasks"
+	"github.com/filecoin-project/lotus/storage/workertokens"
 )
 
 // EnvJournalDisabledEvents is the environment variable through which disabled
@@ -105,11 +128,15 @@ const (
 	// the system starts, so that it's available for all other components.
 	InitJournalKey = invoke(iota)
 
+	SetupCrashReportsKey
+	RunWatchdogKey
+
 	// libp2p
 
 	PstoreAddSelfKeysKey
 	StartListeningKey
 	BootstrapKey
+	RunPeerExchangeKey
 
 	// filecoin
 	SetGenesisKey
@@ -127,8 +154,15 @@ const (
 	// miner
 	GetParamsKey
 	HandleDealsKey
+	HandleDealTransfersKey
 	HandleRetrievalKey
+	TrackTransferOperationsKey
 	RunSectorServiceKey
+	RelayChainHeadKey
+	CompressCachesKey
+	ExternalPlacerKey
+	SectorArchiveKey
+	RecordSealingMetricsKey
 
 	// daemon
 	ExtractApiKey
@@ -173,6 +207,9 @@ func defaults() []Option {
 			return journal.DefaultDisabledEvents
 		}),
 		Override(new(journal.Journal), modules.OpenFilesystemJournal),
+		Override(new(*profiles.Capturer), modules.ProfileCapturer(config.DefaultFullNode().Profiling)),
+		Override(SetupCrashReportsKey, modules.SetupCrashReports(config.DefaultFullNode().Recovery)),
+		Override(RunWatchdogKey, modules.RunWatchdog(config.DefaultFullNode().Watchdog)),
 		Override(InitJournalKey, func(j journal.Journal) {
 			journal.J = j // eagerly sets the global journal through fx.Invoke.
 		}),
@@ -195,6 +232,7 @@ func libp2p() Option {
 
 		Override(new(lp2p.RawHost), lp2p.Host),
 		Override(new(host.Host), lp2p.RoutedHost),
+		Override(new(*lp2p.StreamLimiter), lp2p.StreamLimits(nil)),
 		Override(new(lp2p.BaseIpfsRouting), lp2p.DHTRouting(dht.ModeAuto)),
 
 		Override(DiscoveryHandlerKey, lp2p.DiscoveryHandler),
@@ -206,6 +244,7 @@ func libp2p() Option {
 		Override(BaseRoutingKey, lp2p.BaseRouting),
 		Override(new(routing.Routing), lp2p.Routing),
 
+		Override(new(*lp2p.NatMappings), lp2p.NewNatMappings),
 		Override(NatPortMapKey, lp2p.NatPortMap),
 		Override(BandwidthReporterKey, lp2p.BandwidthCounter),
 
@@ -220,6 +259,9 @@ func libp2p() Option {
 			}
 		}),
 
+		Override(new(*peermgr.PeerExchange), peermgr.NewPeerExchange),
+		Override(RunPeerExchangeKey, modules.RunPeerExchange),
+
 		Override(PstoreAddSelfKeysKey, lp2p.PstoreAddSelfKeys),
 		Override(StartListeningKey, lp2p.StartListening(config.DefaultFullNode().Libp2p.ListenAddresses)),
 	)
@@ -280,6 +322,7 @@ func Online() Option {
 			Override(SetGenesisKey, modules.DoSetGenesis),
 
 			Override(new(dtypes.NetworkName), modules.NetworkName),
+			Override(new(dtypes.GenesisCid), modules.GenesisCid),
 			Override(new(*hello.Service), hello.NewHelloService),
 			Override(new(exchange.Server), exchange.NewServer),
 			Override(new(*peermgr.PeerMgr), peermgr.NewPeerMgr),
@@ -306,6 +349,7 @@ func Online() Option {
 			Override(new(*paychmgr.Store), paychmgr.NewStore),
 			Override(new(*paychmgr.Manager), paychmgr.NewManager),
 			Override(new(*market.FundMgr), market.StartFundManager),
+			Override(new(*market.EscrowManager), modules.MarketEscrowManager(config.DefaultFullNode().MarketFunds)),
 			Override(HandlePaymentChannelManagerKey, paychmgr.HandleManager),
 			Override(SettlePaymentChannelsKey, settler.SettlePaymentChannels),
 		),
@@ -322,20 +366,35 @@ func Online() Option {
 			Override(new(*ffiwrapper.Config), modules.ProofsConfig),
 			Override(new(stores.LocalStorage), From(new(repo.LockedRepo))),
 			Override(new(sealing.SectorIDCounter), modules.SectorIDCounter),
+			Override(new(*checkpoint.Checkpointer), modules.Checkpoints(config.DefaultStorageMiner().Checkpoints)),
+			Override(new(*autotune.Tuner), modules.Autotune),
+			Override(new(*workerreg.Registry), modules.WorkerRegistry(config.DefaultStorageMiner().Workers)),
+			Override(new(*workertasks.Affinity), modules.WorkerTaskAffinity(config.DefaultStorageMiner().Workers)),
+			Override(new(*workertokens.Tokens), workertokens.New),
 			Override(new(*sectorstorage.Manager), modules.SectorStorage),
+			Override(RelayChainHeadKey, modules.RelayChainHead),
+			Override(CompressCachesKey, modules.CompressCaches(config.DefaultStorageMiner().CacheCompression)),
+			Override(ExternalPlacerKey, modules.ExternalPlacer(config.DefaultStorageMiner().Scheduler)),
+			Override(SectorArchiveKey, modules.SectorArchive(config.DefaultStorageMiner().Archive)),
+			Override(RecordSealingMetricsKey, modules.RecordSealingMetrics),
 			Override(new(ffiwrapper.Verifier), ffiwrapper.ProofVerifier),
 
 			Override(new(sectorstorage.SectorManager), From(new(*sectorstorage.Manager))),
 			Override(new(storage2.Prover), From(new(sectorstorage.SectorManager))),
 
+			Override(new(*carindex.Store), carindex.NewStore),
+			Override(new(sectorblocks.SectorBuilder), From(new(*storage.Miner))),
 			Override(new(*sectorblocks.SectorBlocks), sectorblocks.NewSectorBlocks),
-			Override(new(*storage.Miner), modules.StorageMiner(config.DefaultStorageMiner().Fees)),
+			Override(new(*labels.Store), labels.NewStore),
+			Override(new(*storage.Miner), modules.StorageMiner(config.DefaultStorageMiner().Fees, config.DefaultStorageMiner().Proving)),
 			Override(new(dtypes.NetworkName), modules.StorageNetworkName),
+			Override(new(dtypes.GenesisCid), modules.StorageGenesisCid),
 
 			Override(new(dtypes.StagingMultiDstore), modules.StagingMultiDatastore),
 			Override(new(dtypes.StagingBlockstore), modules.StagingBlockstore),
 			Override(new(dtypes.StagingDAG), modules.StagingDAG),
 			Override(new(dtypes.StagingGraphsync), modules.StagingGraphsync),
+			Override(new(*retrievalsched.Scheduler), modules.RetrievalScheduler(config.DefaultStorageMiner().Retrieval)),
 			Override(new(retrievalmarket.RetrievalProvider), modules.RetrievalProvider),
 			Override(new(dtypes.ProviderDataTransfer), modules.NewProviderDAGServiceDataTransfer),
 			Override(new(dtypes.ProviderPieceStore), modules.NewProviderPieceStore),
@@ -347,6 +406,19 @@ func Online() Option {
 			Override(HandleRetrievalKey, modules.HandleRetrieval),
 			Override(GetParamsKey, modules.GetParams),
 			Override(HandleDealsKey, modules.HandleDeals),
+			Override(HandleDealTransfersKey, modules.HandleDealTransfers(config.DefaultStorageMiner().Dealmaking.Transfers)),
+			Override(new(*ops.Registry), modules.MarketOperations),
+			Override(TrackTransferOperationsKey, modules.TrackTransferOperations),
+			Override(new(*quota.Tracker), quota.NewTracker),
+			Override(new(*dealintake.Intake), modules.DealIntake),
+			Override(new(*dealpay.Tracker), modules.DealPaymentTracker),
+			Override(new(*keychange.Manager), modules.KeyChangeManager(config.DefaultStorageMiner().KeyChange)),
+			Override(new(*sweep.Sweeper), modules.RewardSweeper(config.DefaultStorageMiner().Sweep)),
+			Override(new(*alerts.Reporter), modules.AlertReporter(config.DefaultStorageMiner().Alerts)),
+			Override(new(*cron.Cron), modules.Cron(config.DefaultStorageMiner().Cron, config.DefaultStorageMiner().Sweep, config.DefaultStorageMiner().CacheCompression)),
+			Override(new(*gasreport.Reporter), modules.GasReport(config.DefaultStorageMiner().GasReport)),
+			Override(new(*sectorhooks.Hooks), modules.SectorWebhooks(config.DefaultStorageMiner().SectorWebhooks)),
+			Override(new(*sectorindex.Index), modules.SectorIndex),
 			Override(new(gen.WinningPoStProver), storage.NewWinningPoStProver),
 			Override(new(*miner.Miner), modules.SetupBlockProducer),
 
@@ -364,6 +436,8 @@ func Online() Option {
 			Override(new(dtypes.GetSealingConfigFunc), modules.NewGetSealConfigFunc),
 			Override(new(dtypes.SetExpectedSealDurationFunc), modules.NewSetExpectedSealDurationFunc),
 			Override(new(dtypes.GetExpectedSealDurationFunc), modules.NewGetExpectedSealDurationFunc),
+			Override(new(*dtypes.PledgeControl), new(dtypes.PledgeControl)),
+			Override(new(*reload.Reloader), modules.ConfigReloader),
 		),
 	)
 }
@@ -396,8 +470,11 @@ func ConfigCommon(cfg *config.Common) Option {
 	return Options(
 		func(s *Settings) error { s.Config = true; return nil },
 		Override(new(dtypes.APIEndpoint), func() (dtypes.APIEndpoint, error) {
-			return multiaddr.NewMultiaddr(cfg.API.ListenAddress)
+			return addrutil.ParseListenAddress(cfg.API.ListenAddress)
 		}),
+		Override(new(*profiles.Capturer), modules.ProfileCapturer(cfg.Profiling)),
+		Override(SetupCrashReportsKey, modules.SetupCrashReports(cfg.Recovery)),
+		Override(RunWatchdogKey, modules.RunWatchdog(cfg.Watchdog)),
 		Override(SetApiEndpointKey, func(lr repo.LockedRepo, e dtypes.APIEndpoint) error {
 			return lr.SetAPIEndpoint(e)
 		}),
@@ -415,6 +492,8 @@ func ConfigCommon(cfg *config.Common) Option {
 				cfg.Libp2p.ConnMgrHigh,
 				time.Duration(cfg.Libp2p.ConnMgrGrace),
 				cfg.Libp2p.ProtectedPeers)),
+			Override(new(*lp2p.StreamLimiter), lp2p.StreamLimits(cfg.Libp2p.StreamLimits)),
+			If(cfg.Libp2p.DisableNatPortMap, Unset(NatPortMapKey)),
 			Override(new(*pubsub.PubSub), lp2p.GossipSub),
 			Override(new(*config.Pubsub), &cfg.Pubsub),
 
@@ -446,6 +525,9 @@ func ConfigFullNode(c interface{}) Option {
 		If(cfg.Metrics.HeadNotifs,
 			Override(HeadMetricsKey, metrics.SendHeadNotifs(cfg.Metrics.Nickname)),
 		),
+		Override(new(*market.EscrowManager), modules.MarketEscrowManager(cfg.MarketFunds)),
+		Override(new(*approval.Queue), modules.ApprovalQueue(cfg.Approvals)),
+		Override(new(*commp.Calc), modules.CommPCalc(cfg.Client)),
 	)
 }
 
@@ -463,7 +545,85 @@ func ConfigStorageMiner(c interface{}) Option {
 		),
 
 		Override(new(sectorstorage.SealerConfig), cfg.Storage),
-		Override(new(*storage.Miner), modules.StorageMiner(cfg.Fees)),
+		Override(new(*storage.Miner), modules.StorageMiner(cfg.Fees, cfg.Proving)),
+		Override(HandleDealTransfersKey, modules.HandleDealTransfers(cfg.Dealmaking.Transfers)),
+		Override(new(*retrievalsched.Scheduler), modules.RetrievalScheduler(cfg.Retrieval)),
+		Override(new(*keychange.Manager), modules.KeyChangeManager(cfg.KeyChange)),
+		Override(new(*sweep.Sweeper), modules.RewardSweeper(cfg.Sweep)),
+		Override(new(*alerts.Reporter), modules.AlertReporter(cfg.Alerts)),
+		Override(new(*cron.Cron), modules.Cron(cfg.Cron, cfg.Sweep, cfg.CacheCompression)),
+		Override(new(*checkpoint.Checkpointer), modules.Checkpoints(cfg.Checkpoints)),
+		Override(new(*gasreport.Reporter), modules.GasReport(cfg.GasReport)),
+		Override(new(*sectorhooks.Hooks), modules.SectorWebhooks(cfg.SectorWebhooks)),
+		Override(CompressCachesKey, modules.CompressCaches(cfg.CacheCompression)),
+		Override(ExternalPlacerKey, modules.ExternalPlacer(cfg.Scheduler)),
+		Override(SectorArchiveKey, modules.SectorArchive(cfg.Archive)),
+		Override(new(*workerreg.Registry), modules.WorkerRegistry(cfg.Workers)),
+		Override(new(*workertasks.Affinity), modules.WorkerTaskAffinity(cfg.Workers)),
+
+		If(cfg.Proving.ArchivalMode, ArchivalMiner(cfg)),
+		If(!cfg.Subsystems.EnableMarkets, DisableMarkets()),
+		If(cfg.Subsystems.SealerAPIInfo != "", MarketsNode()),
+	)
+}
+
+// ArchivalMiner strips the miner down to proving existing sectors: the local
+// worker doesn't accept sealing tasks, and markets aren't started
+func ArchivalMiner(cfg *config.StorageMiner) Option {
+	return Options(
+		Override(new(sectorstorage.SealerConfig), sectorstorage.SealerConfig{
+			ParallelFetchLimit: cfg.Storage.ParallelFetchLimit,
+		}),
+		Override(new(*storage.Miner), modules.ArchivalStorageMiner(cfg.Fees, cfg.Proving)),
+
+		DisableMarkets(),
+	)
+}
+
+// DisableMarkets doesn't start the storage and retrieval markets, on sealing
+// miners with a markets node handling the deals
+func DisableMarkets() Option {
+	return Options(
+		Unset(HandleDealsKey),
+		Unset(HandleDealTransfersKey),
+		Unset(HandleRetrievalKey),
+		Unset(TrackTransferOperationsKey),
+	)
+}
+
+// MarketsNode strips the miner down to the markets subsystem. Deal pieces go
+// to the sealing miner through the sectorblocks.SectorBuilder, which must be
+// set to a sectorblocks.RemoteBuilder.
+func MarketsNode() Option {
+	return Options(
+		Unset(new(sectorblocks.SectorBuilder)),
+
+		Unset(new(*storage.Miner)),
+		Unset(new(*miner.Miner)),
+		Unset(new(gen.WinningPoStProver)),
+		Unset(new(*autotune.Tuner)),
+		Unset(new(*workerreg.Registry)),
+		Unset(new(*workertasks.Affinity)),
+		Unset(new(*workertokens.Tokens)),
+		Unset(new(*sectorstorage.Manager)),
+		Unset(new(sectorstorage.SectorManager)),
+		Unset(new(storage2.Prover)),
+		Unset(new(*stores.Index)),
+		Unset(new(stores.SectorIndex)),
+		Unset(new(*keychange.Manager)),
+		Unset(new(*sweep.Sweeper)),
+		Unset(new(*alerts.Reporter)),
+		Unset(new(*cron.Cron)),
+		Unset(new(*gasreport.Reporter)),
+		Unset(new(*sectorhooks.Hooks)),
+		Unset(new(*sectorindex.Index)),
+
+		Unset(GetParamsKey),
+		Unset(RelayChainHeadKey),
+		Unset(CompressCachesKey),
+		Unset(ExternalPlacerKey),
+		Unset(SectorArchiveKey),
+		Unset(RecordSealingMetricsKey),
 	)
 }
 
@@ -12,16 +12,21 @@ import (
 
 // Common is common config between full node and miner
 type Common struct {
-	API    API
-	Libp2p Libp2p
-	Pubsub Pubsub
+	API       API
+	Libp2p    Libp2p
+	Pubsub    Pubsub
+	Profiling Profiling
+	Watchdog  Watchdog
+	Recovery  Recovery
 }
 
 // FullNode is a full node config
 type FullNode struct {
 	Common
-	Client  Client
-	Metrics Metrics
+	Client      Client
+	Metrics     Metrics
+	MarketFunds MarketFunds
+	Approvals   ApprovalsConfig
 }
 
 // // Common
@@ -34,6 +39,24 @@ type StorageMiner struct {
 	Sealing    SealingConfig
 	Storage    sectorstorage.SealerConfig
 	Fees       MinerFeeConfig
+	Proving    ProvingConfig
+	KeyChange  KeyChangeConfig
+	Alerts     AlertsConfig
+	Sweep      SweepConfig
+
+	CacheCompression CacheCompressionConfig
+	Cron             CronConfig
+	Checkpoints      CheckpointConfig
+	GasReport        GasReportConfig
+	SectorWebhooks   SectorWebhooksConfig
+	Scheduler        SchedulerConfig
+	Archive          ArchiveConfig
+	Workers          WorkersConfig
+	Logging          LoggingConfig
+	Signing          SigningConfig
+	Retrieval        RetrievalConfig
+	Startup          StartupConfig
+	Subsystems       SubsystemsConfig
 }
 
 type DealmakingConfig struct {
@@ -45,6 +68,53 @@ type DealmakingConfig struct {
 	ExpectedSealDuration          Duration
 
 	Filter string
+
+	// Transfers enables pushing the data of offline deals to the miner.
+	// Graphsync transfers of online deals are controlled by
+	// ConsiderOnlineStorageDeals.
+	Transfers DealTransfersConfig
+
+	// Ask is set as the storage ask on start and when the config is
+	// reloaded, see AskConfig
+	Ask AskConfig
+}
+
+// AskConfig is the storage ask of the miner. When it's all empty the ask is
+// left as set with 'lotus-miner storage-deals set-ask'; empty fields keep
+// the value of the current ask.
+type AskConfig struct {
+	// Price and VerifiedPrice are in attoFIL / GiB / epoch
+	Price         string
+	VerifiedPrice string
+	// Duration is how long the ask is valid for
+	Duration Duration
+	// MinPieceSize and MaxPieceSize are padded piece sizes, e.g. "256B"
+	MinPieceSize string
+	MaxPieceSize string
+}
+
+// RetrievalConfig limits how many retrievals are served at once, so bursts
+// of retrievals don't take the disk IO needed for proving; 0 means no limit.
+// Pieces are read from sectors at most MaxUnseals at a time, queued reads go
+// to the clients with the fewest running ones first.
+type RetrievalConfig struct {
+	MaxRetrievals          int
+	MaxRetrievalsPerClient int
+	MaxUnseals             int
+}
+
+type DealTransfersConfig struct {
+	// HTTP accepts pushes on HTTPListenAddress, authenticated with a token
+	// the client gets from the miner over libp2p.
+	HTTP              bool
+	HTTPListenAddress string
+	// HTTPURL is the URL of the endpoint given to clients, when it isn't
+	// reachable on HTTPListenAddress, e.g. behind a reverse proxy
+	HTTPURL string
+
+	// Libp2pHTTP accepts pushes over libp2p streams, from the client of the
+	// deal only
+	Libp2pHTTP bool
 }
 
 type SealingConfig struct {
@@ -58,6 +128,315 @@ type SealingConfig struct {
 	MaxSealingSectorsForDeals uint64
 
 	WaitDealsDelay Duration
+
+	// CacheTrimCC and CacheTrimDeals set how much of the cache of committed
+	// capacity and deal sectors is kept after finalization. "full" keeps the
+	// SDR layers, tree-c and tree-d too, about 450GiB per 32GiB sector.
+	// "post" keeps only what PoSt needs, p_aux, t_aux and tree-r-last, about
+	// 73MiB per 32GiB sector and 146MiB per 64GiB sector.
+	CacheTrimCC    string
+	CacheTrimDeals string
+
+	// CommitPlacement holds back ProveCommit messages, for up to two
+	// challenge windows, while the current or next proving deadline is less
+	// loaded than every deadline new sectors could be assigned to, so that
+	// sectors spread evenly across deadlines. Off by default, as it delays
+	// sectors becoming active.
+	CommitPlacement bool
+}
+
+type ProvingConfig struct {
+	// ArchivalMode runs a stripped-down miner which only proves the sectors
+	// it already has: no sealing, no storage or retrieval markets. Useful
+	// for serving finalized sectors from cheap hardware.
+	ArchivalMode bool
+	// VerifyWindowPoSt checks generated WindowPoSt proofs before they are
+	// submitted, and recomputes invalid ones, e.g. caused by GPU memory
+	// errors. ProveCommit proofs are always checked before submission.
+	VerifyWindowPoSt bool
+}
+
+// KeyChangeConfig guards changes of the worker and control addresses
+type KeyChangeConfig struct {
+	// Timelock is the minimum delay between proposing a change and sending
+	// it to the chain, also when no Approvers are set. Without approvers and
+	// with a zero timelock, changes are sent right away.
+	Timelock Duration
+	// Approvers are key addresses one of which must sign a proposed change
+	// before it is executed. Their keys shouldn't be stored on this machine.
+	Approvers []string
+}
+
+// CacheCompressionConfig controls zstd compression of finalized sector cache
+// files in local storage. Compressed files are decompressed before they are
+// read for PoSt. Only tree-r-last files are compressed, they are Poseidon
+// hashes which barely compress: savings are negligible, a few percent at
+// best, and files which don't shrink by MinSaving are left alone. Sectors
+// in the current and next proving deadline aren't touched.
+type CacheCompressionConfig struct {
+	// Enable compresses caches, when disabled compressed files are restored,
+	// and the background job stops once none are left
+	Enable bool
+	// MinAge is how long a file must be unmodified before it's compressed
+	MinAge Duration
+	// MinSaving is the smallest fraction of a file's size compression must
+	// save for the file to be kept compressed
+	MinSaving float64
+	// Interval between compression passes, 0 disables the background job
+	Interval Duration
+}
+
+// CheckpointConfig controls checkpoints of in-memory scheduler and sealing
+// state, which are always written on shutdown: the scheduler queue and
+// decisions, and the deal and upgrade state of sealing. Sector state machine
+// events aren't checkpointed, sector states are persisted as events are
+// handled and restarted sectors issue their work again.
+type CheckpointConfig struct {
+	// Interval between periodic checkpoints, 0 only writes them on shutdown
+	Interval Duration
+}
+
+// GasReportConfig controls the gas spend report, see 'lotus-miner analytics gas'
+type GasReportConfig struct {
+	// Interval between reading new tipsets from the chain, 0 disables the
+	// report
+	Interval Duration
+	// Backfill is how far back the chain is read when the report starts
+	Backfill Duration
+}
+
+// SectorWebhooksConfig sends sector state changes to HTTP endpoints, see
+// 'lotus-miner events'
+type SectorWebhooksConfig struct {
+	// URLs receive a POST with a JSON api.SectorEvent for every sector state
+	// change. Events are resent until the endpoint returns a 2xx status, so
+	// an endpoint can receive an event more than once.
+	URLs []string
+	// MaxBackoff limits the delay between retries to a failing endpoint
+	MaxBackoff Duration
+	// Retention is how long delivered events are kept for 'events replay'
+	Retention Duration
+}
+
+// SchedulerConfig lets an external service decide which workers sealing
+// tasks run on, see sectorstorage.Placer
+type SchedulerConfig struct {
+	// ExternalPlacer is the URL receiving a POST with a JSON
+	// storiface.PlacementRequest for every task the built-in scheduler found
+	// workers for. It answers with a JSON storiface.Placement. Empty uses
+	// the built-in placement only.
+	ExternalPlacer string
+	// ExternalPlacerToken is sent as a bearer token to the placer, if set
+	ExternalPlacerToken string
+	// ExternalPlacerTimeout is how long tasks wait for the placer before
+	// they are placed by the built-in scheduler. The placer is asked in the
+	// background, scheduling of other tasks doesn't wait for it.
+	ExternalPlacerTimeout Duration
+}
+
+// ArchiveConfig sets an external archive for sectors which are rarely read,
+// e.g. terminated sectors kept for their deal data, see
+// sectorstorage.Archiver
+type ArchiveConfig struct {
+	// Path is a directory sectors are archived to, e.g. an LTFS mount
+	Path string
+	// Command is a program archiving sectors, e.g. with the tooling of a
+	// tape library, used instead of Path. See archive.Command for the
+	// arguments it's run with.
+	Command string
+	// RecallBudget is how long reads of archived sectors, e.g. retrievals,
+	// wait for them to be recalled. Reads of sectors the archive can't
+	// stage in time fail while the recall continues. 0 waits as long as the
+	// read allows.
+	RecallBudget Duration
+}
+
+// WorkersConfig controls which seal workers may connect, workers announce
+// themselves with their resources and storage paths before connecting
+type WorkersConfig struct {
+	// RequireApproval only lets workers connect once they're accepted with
+	// 'lotus-miner sealing registrations accept'. Workers which don't
+	// register, e.g. older versions, can't connect.
+	RequireApproval bool
+
+	// Groups are named sets of worker hostnames, for use in Tasks
+	Groups map[string][]string
+	// Tasks pins task types, by short name like AP, PC1, PC2, C2 or GET, to
+	// the listed worker hostnames or groups. Task types which aren't listed
+	// are assigned to any worker supporting them. 'lotus-miner sealing
+	// workers tasks' enables or disables task types on single workers on
+	// top of this.
+	Tasks map[string][]string
+}
+
+// SigningConfig holds the messages of the miner until they're signed
+// offline, see 'lotus-miner outbox'. The sender keys don't need to be on the
+// full node.
+type SigningConfig struct {
+	// Offline queues messages in the outbox instead of having the full node
+	// sign them
+	Offline bool
+	// Bypass are the names of methods whose messages are signed by the full
+	// node right away, e.g. PoSt messages which must land within their
+	// deadline. Their sender keys must be in the wallet of the full node.
+	Bypass []string
+}
+
+// LoggingConfig sets log levels on start and when the config is reloaded,
+// 'lotus-miner log set-level' changes them until then
+type LoggingConfig struct {
+	// Levels maps log subsystems to levels, e.g. "sectors" = "debug"; "*"
+	// sets the level of all subsystems
+	Levels map[string]string
+}
+
+// SubsystemsConfig splits the miner into a sealing miner and a markets node,
+// so deal traffic and libp2p load are kept away from the process proving the
+// sectors. Both run 'lotus-miner run', each with its own repo.
+type SubsystemsConfig struct {
+	// EnableMarkets runs the storage and retrieval markets in this process,
+	// disable it on the sealing miner when a markets node handles the deals
+	EnableMarkets bool
+
+	// SealerAPIInfo makes this process a markets node. It is the
+	// token:multiaddr of the storage miner API of the sealing miner, the
+	// token needs admin permission. Deal data is added to sectors of the
+	// sealing miner, and read back from it for retrievals.
+	SealerAPIInfo string
+}
+
+// StartupConfig holds the options of 'lotus-miner run', the equivalent
+// command line flags override them
+type StartupConfig struct {
+	// FullNodeAPI is the token:multiaddr of the full node API, used unless
+	// FULLNODE_API_INFO is set. When empty the API info of the local full
+	// node repo is used. A comma separated list connects to several nodes.
+	FullNodeAPI string
+	// FullNodeFailover sends all calls to the first of the FullNodeAPI nodes
+	// which is reachable and in sync, failing over to the next ones in order.
+	// When false calls are spread over the nodes by latency.
+	FullNodeFailover bool
+
+	// AllowDegraded starts the miner when the full node is unreachable. Until
+	// the node connects only the local auth, version and log API is served, and
+	// no chain work is done.
+	AllowDegraded bool
+	// FullNodeRetry is the interval between connection attempts in degraded
+	// mode
+	FullNodeRetry Duration
+	// MaxSyncLag is how many epochs the chain head of the full node may be
+	// behind. The miner starts with a node further behind, but doesn't send
+	// messages until it catches up, PoSt and sealing messages wait for it for
+	// a while. -1 sends messages regardless of the lag.
+	MaxSyncLag int64
+
+	EnableGPUProving bool
+	ManageFDLimit    bool
+	// PledgeSector keeps idle workers busy by pledging committed capacity
+	// sectors, checking for idle workers every PledgeInterval
+	PledgeSector   bool
+	PledgeInterval Duration
+	// PledgeMaxSectors stops pledging once the miner has this many sectors,
+	// including ones still sealing; 0 is no limit
+	PledgeMaxSectors uint64
+	// PledgeMinFree stops pledging when the storage paths which can store
+	// sectors have less free space than this, e.g. "1TiB"; empty is no limit
+	PledgeMinFree string
+	// PledgeReserveWorkers is the number of idle workers kept free for deals.
+	// Pledging also waits while deal data is staged or being added to sectors.
+	PledgeReserveWorkers int
+	// WebUI serves the sector timeline web UI on /ui
+	WebUI bool
+
+	// TLSCert and TLSKey are the paths of a PEM certificate and key to serve
+	// the API and /remote over HTTPS with. Clients dial the endpoint with a
+	// /wss suffix, e.g. /ip4/10.0.0.1/tcp/2345/wss; certificates which aren't
+	// signed by a system CA can be trusted with SSL_CERT_FILE.
+	TLSCert string
+	TLSKey  string
+
+	// ShutdownGrace is the time in-flight API requests get to finish on
+	// shutdown
+	ShutdownGrace Duration
+	// ShutdownTimeout makes the miner exit forcefully when shutdown takes
+	// longer
+	ShutdownTimeout Duration
+	// DrainOnShutdown stops assigning sealing tasks on SIGTERM and waits for
+	// assigned tasks to finish before shutting down, for at most DrainTimeout
+	DrainOnShutdown bool
+	DrainTimeout    Duration
+
+	// APISlowCall logs API calls taking longer than this with their
+	// parameters, 0 disables the log. Latencies of all calls are exported as
+	// the api/request_duration_ms metric.
+	APISlowCall Duration
+}
+
+// CronConfig schedules recurring jobs, see 'lotus-miner cron'
+type CronConfig struct {
+	Jobs []CronJob
+}
+
+// CronJob runs either a built-in task or a shell command on a schedule
+type CronJob struct {
+	// Name identifies the job in 'lotus-miner cron' commands
+	Name string
+	// Schedule is a cron expression: minute hour day-of-month month
+	// day-of-week, or one of @hourly, @daily, @weekly, @monthly; in local time
+	Schedule string
+	// Task is a built-in task: sweep, scrub, compress-caches
+	Task string
+	// Command is run with 'sh -c' when Task is empty
+	Command string
+	// Timeout cancels runs which take longer, 0 for no timeout
+	Timeout Duration
+}
+
+// SweepConfig moves rewards above a float from the miner actor, owner and
+// worker to a cold address, see 'lotus-miner actor sweep'
+type SweepConfig struct {
+	// ColdAddress receives swept funds, scheduled sweeps are disabled when
+	// it's empty
+	ColdAddress string
+	// Interval between scheduled sweeps, 0 disables them
+	Interval Duration
+
+	// MinerFloat is left as available balance in the miner actor
+	MinerFloat types.FIL
+	// OwnerFloat and WorkerFloat are left in the wallets, and pay for gas
+	OwnerFloat  types.FIL
+	WorkerFloat types.FIL
+	// MinAmount skips smaller transfers, which aren't worth the gas
+	MinAmount types.FIL
+	// MaxFee caps the fee of every sweep message, and is kept in the wallets
+	// on top of the floats. 0 uses the default fee cap of the node, which is
+	// then paid from the floats.
+	MaxFee types.FIL
+
+	// DryRun only records scheduled sweeps in the history
+	DryRun bool
+	// ApprovalHook is a shell command run before every sweep with the planned
+	// sweep as JSON on stdin. Transfers are only sent if it exits with 0.
+	ApprovalHook string
+}
+
+// AlertsConfig sets the thresholds of the miner alert rules. The miner
+// reports the matching metrics, the rules can be exported for Prometheus
+// with 'lotus-miner alerts export'.
+type AlertsConfig struct {
+	// MinWorkerBalance alerts when the worker wallet drops below it
+	MinWorkerBalance types.FIL
+	// MaxFaultySectors alerts when more sectors are faulty
+	MaxFaultySectors uint64
+	// DeadlineMargin alerts when partitions of the current deadline are
+	// still unproven this close to the deadline end
+	DeadlineMargin Duration
+	// MinWorkers alerts when fewer workers are connected
+	MinWorkers int
+	// For is how long a condition must hold before the alert fires
+	For Duration
+	// ReportInterval is how often the metrics are updated
+	ReportInterval Duration
 }
 
 type MinerFeeConfig struct {
@@ -71,6 +450,92 @@ type API struct {
 	ListenAddress       string
 	RemoteListenAddress string
 	Timeout             Duration
+
+	CORS CORS
+
+	Limits APILimits
+
+	// Pprof is where the pprof handlers are served: "api" on the API
+	// endpoint, "off", or a localhost address like "127.0.0.1:6060" for a
+	// separate listener only admin tokens can use
+	Pprof string
+
+	// Trace is a file where all RPC calls to the API are recorded, with
+	// secrets redacted, to reproduce issues with 'debug replay'. Empty
+	// disables recording, relative paths are in the repo.
+	Trace string
+}
+
+// APILimits caps RPC calls to the API, so a misbehaving client can't starve
+// the calls the node depends on. Zero values mean no limit. The Token limits
+// apply to each API token separately; requests without a token are limited
+// by the remote address. Tokens are told apart by their contents, so give
+// each client its own token (lotus auth create-token) for them to be limited
+// separately.
+type APILimits struct {
+	CallsPerSecond float64
+	Burst          int
+	MaxInFlight    int
+	MaxConnections int
+
+	TokenCallsPerSecond float64
+	TokenBurst          int
+	TokenMaxInFlight    int
+	TokenMaxConnections int
+
+	// Exempt methods are never limited. The defaults cover the calls needed
+	// for window PoSt, block production and sealing, keep them when adding
+	// methods.
+	Exempt []string
+}
+
+// CORS lets browsers call the API from other origins, e.g. dashboards. No
+// CORS headers are sent while AllowedOrigins is empty.
+type CORS struct {
+	// AllowedOrigins are origins like "https://dash.example.com", "*" allows
+	// any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+// Profiling configures periodic capture of CPU, heap and goroutine profiles
+// into the repo, see `lotus debug profiles`
+type Profiling struct {
+	// Interval between captures, 0 disables capturing
+	Interval    Duration
+	CPUDuration Duration
+	// Captures older than Retention are removed
+	Retention Duration
+}
+
+// Watchdog detects critical loops (sealing scheduler, sector state machine,
+// chain event processing) which stopped making progress, and dumps goroutine
+// stacks into the repo when that happens
+type Watchdog struct {
+	// CheckInterval of 0 disables the watchdog
+	CheckInterval Duration
+	// RestartStuck restarts stuck loops where possible, currently chain
+	// event listeners
+	RestartStuck bool
+}
+
+// Recovery configures handling of panics in background subsystems. Panics
+// are recorded in crash bundles in the repo.
+type Recovery struct {
+	// RestartOnPanic restarts a panicked subsystem with backoff, instead of
+	// leaving it stopped until the node restarts
+	RestartOnPanic bool
+	MaxBackoff     Duration
+	// KeepBundles is the number of crash bundles kept, 0 keeps all
+	KeepBundles int
+}
+
+// StreamLimit caps the number of concurrently handled inbound streams for
+// protocols with the given prefix
+type StreamLimit struct {
+	Protocol   string
+	MaxInbound int
 }
 
 // Libp2p contains configs for libp2p
@@ -81,9 +546,18 @@ type Libp2p struct {
 	BootstrapPeers      []string
 	ProtectedPeers      []string
 
+	// DisableNatPortMap turns off mapping the listen ports on the router with
+	// UPnP / NAT-PMP. Set AnnounceAddresses instead when ports are forwarded
+	// manually.
+	DisableNatPortMap bool
+
 	ConnMgrLow   uint
 	ConnMgrHigh  uint
 	ConnMgrGrace Duration
+
+	// StreamLimits caps concurrent inbound streams by protocol prefix, the
+	// longest matching prefix applies
+	StreamLimits []StreamLimit
 }
 
 type Pubsub struct {
@@ -99,10 +573,52 @@ type Metrics struct {
 	HeadNotifs bool
 }
 
+// MarketFunds configures automatic management of market escrow balances
+type MarketFunds struct {
+	CheckInterval Duration
+	Escrow        []EscrowPolicy
+}
+
+// ApprovalsConfig configures four-eyes control of messages pushed through the
+// API
+type ApprovalsConfig struct {
+	// Threshold holds MpoolPushMessage calls moving at least this much,
+	// including amounts withdrawn through multisig proposals and miner or
+	// market withdrawals, until they are approved by one of the Approvers. 0
+	// disables approvals. While set, WalletExport is refused.
+	Threshold types.FIL
+	// Timeout is how long held messages wait for approval
+	Timeout Duration
+	// Approvers are key addresses one of which must sign a held message
+	// before it is pushed. Their keys must not be stored in this node's
+	// wallet.
+	Approvers []string
+}
+
+// EscrowPolicy keeps the available market balance of a client or miner
+// address between MinAvailable and MaxAvailable
+type EscrowPolicy struct {
+	Address string
+	// Wallet funds top-ups; for miners it must be the owner or worker for
+	// withdrawals to work
+	Wallet string
+
+	// Top up to TopUpTo when available funds drop below MinAvailable
+	MinAvailable types.FIL
+	TopUpTo      types.FIL
+	// Withdraw down to TopUpTo when available funds exceed MaxAvailable,
+	// 0 disables withdrawals
+	MaxAvailable types.FIL
+}
+
 type Client struct {
 	UseIpfs             bool
 	IpfsMAddr           string
 	IpfsUseForRetrieval bool
+
+	// CommPWorkers is the number of files whose CommP is calculated in
+	// parallel, see 'lotus client commP'
+	CommPWorkers int
 }
 
 func defCommon() Common {
@@ -110,6 +626,15 @@ func defCommon() Common {
 		API: API{
 			ListenAddress: "/ip4/127.0.0.1/tcp/1234/http",
 			Timeout:       Duration(30 * time.Second),
+			CORS: CORS{
+				AllowedOrigins: []string{},
+				AllowedMethods: []string{"GET", "POST"},
+				AllowedHeaders: []string{"Authorization", "Content-Type"},
+			},
+			Limits: APILimits{
+				Exempt: []string{},
+			},
+			Pprof: "api",
 		},
 		Libp2p: Libp2p{
 			ListenAddresses: []string{
@@ -122,21 +647,76 @@ func defCommon() Common {
 			ConnMgrLow:   150,
 			ConnMgrHigh:  180,
 			ConnMgrGrace: Duration(20 * time.Second),
+
+			StreamLimits: []StreamLimit{
+				{Protocol: "/fil/storage/", MaxInbound: 128},
+				{Protocol: "/fil/retrieval/", MaxInbound: 128},
+				{Protocol: "/fil/chain/xchg/", MaxInbound: 64},
+			},
 		},
 		Pubsub: Pubsub{
 			Bootstrapper: false,
 			DirectPeers:  nil,
 			RemoteTracer: "/dns4/pubsub-tracer.filecoin.io/tcp/4001/p2p/QmTd6UvR47vUidRNZ1ZKXHrAFhqTJAD27rKL9XYghEKgKX",
 		},
+		Profiling: Profiling{
+			Interval:    Duration(time.Hour),
+			CPUDuration: Duration(30 * time.Second),
+			Retention:   Duration(7 * 24 * time.Hour),
+		},
+		Watchdog: Watchdog{
+			CheckInterval: Duration(30 * time.Second),
+		},
+		Recovery: Recovery{
+			RestartOnPanic: true,
+			MaxBackoff:     Duration(5 * time.Minute),
+			KeepBundles:    20,
+		},
 	}
 
 }
 
 // DefaultFullNode returns the default config
 func DefaultFullNode() *FullNode {
-	return &FullNode{
+	cfg := &FullNode{
 		Common: defCommon(),
+		Client: Client{
+			CommPWorkers: 2,
+		},
+		MarketFunds: MarketFunds{
+			CheckInterval: Duration(5 * time.Minute),
+		},
+		Approvals: ApprovalsConfig{
+			Threshold: types.FIL(types.NewInt(0)),
+			Timeout:   Duration(time.Hour),
+		},
+	}
+	// miners need these for window PoSt and block production, which can't
+	// wait for other clients to back off
+	cfg.Common.API.Limits.Exempt = []string{
+		"ChainNotify",
+		"ChainHead",
+		"ChainTipSetWeight",
+		"ChainGetRandomnessFromBeacon",
+		"ChainGetRandomnessFromTickets",
+		"BeaconGetEntry",
+		"StateMinerProvingDeadline",
+		"StateMinerDeadlines",
+		"StateMinerPartitions",
+		"StateMinerSectors",
+		"StateMinerInfo",
+		"StateAccountKey",
+		"StateWaitMsg",
+		"GasEstimateMessageGas",
+		"MpoolPushMessage",
+		"MpoolSelect",
+		"MinerGetBaseInfo",
+		"MinerCreateBlock",
+		"SyncSubmitBlock",
+		"WalletHas",
+		"WalletSign",
 	}
+	return cfg
 }
 
 func DefaultStorageMiner() *StorageMiner {
@@ -148,6 +728,8 @@ func DefaultStorageMiner() *StorageMiner {
 			MaxSealingSectors:         0,
 			MaxSealingSectorsForDeals: 0,
 			WaitDealsDelay:            Duration(time.Hour),
+			CacheTrimCC:               "post",
+			CacheTrimDeals:            "post",
 		},
 
 		Storage: sectorstorage.SealerConfig{
@@ -170,6 +752,16 @@ func DefaultStorageMiner() *StorageMiner {
 			PieceCidBlocklist:             []cid.Cid{},
 			// TODO: It'd be nice to set this based on sector size
 			ExpectedSealDuration: Duration(time.Hour * 12),
+
+			Transfers: DealTransfersConfig{
+				HTTPListenAddress: "0.0.0.0:2348",
+			},
+		},
+
+		Retrieval: RetrievalConfig{
+			MaxRetrievals:          32,
+			MaxRetrievalsPerClient: 4,
+			MaxUnseals:             2,
 		},
 
 		Fees: MinerFeeConfig{
@@ -177,9 +769,99 @@ func DefaultStorageMiner() *StorageMiner {
 			MaxCommitGasFee:     types.FIL(types.BigDiv(types.FromFil(1), types.NewInt(20))),
 			MaxWindowPoStGasFee: types.FIL(types.FromFil(50)),
 		},
+
+		KeyChange: KeyChangeConfig{
+			Timelock: Duration(48 * time.Hour),
+		},
+
+		Sweep: SweepConfig{
+			Interval:    Duration(24 * time.Hour),
+			MinerFloat:  types.FIL(types.FromFil(0)),
+			OwnerFloat:  types.FIL(types.FromFil(1)),
+			WorkerFloat: types.FIL(types.FromFil(50)),
+			MinAmount:   types.FIL(types.FromFil(1)),
+			MaxFee:      types.FIL(types.BigDiv(types.FromFil(1), types.NewInt(20))), // 0.05
+		},
+
+		Checkpoints: CheckpointConfig{
+			Interval: Duration(5 * time.Second),
+		},
+
+		GasReport: GasReportConfig{
+			Interval: Duration(5 * time.Minute),
+			Backfill: Duration(7 * 24 * time.Hour),
+		},
+
+		SectorWebhooks: SectorWebhooksConfig{
+			MaxBackoff: Duration(10 * time.Minute),
+			Retention:  Duration(7 * 24 * time.Hour),
+		},
+
+		Signing: SigningConfig{
+			Bypass: []string{"SubmitWindowedPoSt", "DeclareFaults", "DeclareFaultsRecovered"},
+		},
+
+		Scheduler: SchedulerConfig{
+			ExternalPlacerTimeout: Duration(time.Second),
+		},
+
+		Archive: ArchiveConfig{
+			RecallBudget: Duration(10 * time.Minute),
+		},
+
+		Startup: StartupConfig{
+			FullNodeFailover: true,
+			AllowDegraded:    false,
+			FullNodeRetry:    Duration(10 * time.Second),
+			MaxSyncLag:       5,
+
+			EnableGPUProving: true,
+			ManageFDLimit:    true,
+			PledgeInterval:   Duration(30 * time.Second),
+
+			ShutdownGrace:   Duration(30 * time.Second),
+			ShutdownTimeout: Duration(2 * time.Minute),
+			DrainTimeout:    Duration(6 * time.Hour),
+
+			APISlowCall: Duration(10 * time.Second),
+		},
+
+		Subsystems: SubsystemsConfig{
+			EnableMarkets: true,
+		},
+
+		CacheCompression: CacheCompressionConfig{
+			Enable:    false,
+			MinAge:    Duration(6 * time.Hour),
+			MinSaving: 0.1,
+			Interval:  Duration(time.Hour),
+		},
+
+		Alerts: AlertsConfig{
+			MinWorkerBalance: types.FIL(types.FromFil(10)),
+			MaxFaultySectors: 0,
+			DeadlineMargin:   Duration(10 * time.Minute),
+			MinWorkers:       1,
+			For:              Duration(5 * time.Minute),
+			ReportInterval:   Duration(time.Minute),
+		},
 	}
 	cfg.Common.API.ListenAddress = "/ip4/127.0.0.1/tcp/2345/http"
 	cfg.Common.API.RemoteListenAddress = "127.0.0.1:2345"
+	// workers need these to seal, and have to keep working under load
+	cfg.Common.API.Limits.Exempt = []string{
+		"WorkerConnect",
+		"WorkerRegister",
+		"StorageAttach",
+		"StorageInfo",
+		"StorageReportHealth",
+		"StorageDeclareSector",
+		"StorageDropSector",
+		"StorageFindSector",
+		"StorageBestAlloc",
+		"StorageLock",
+		"StorageTryLock",
+	}
 	return cfg
 }
 
@@ -9,6 +9,8 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/api"
 )
 
 func TestDefaultFullNodeRoundtrip(t *testing.T) {
@@ -52,3 +54,18 @@ func TestDefaultMinerRoundtrip(t *testing.T) {
 
 	require.True(t, reflect.DeepEqual(c, c2))
 }
+
+func TestDefaultExemptMethods(t *testing.T) {
+	for _, c := range []struct {
+		cfg API
+		api reflect.Type
+	}{
+		{DefaultFullNode().API, reflect.TypeOf((*api.FullNode)(nil)).Elem()},
+		{DefaultStorageMiner().API, reflect.TypeOf((*api.StorageMiner)(nil)).Elem()},
+	} {
+		for _, m := range c.cfg.Limits.Exempt {
+			_, ok := c.api.MethodByName(m)
+			require.True(t, ok, "%s has no method %s", c.api, m)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package node
+
+import (
+	"net/http"
+
+	"github.com/rs/cors"
+
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+// CORSHandler answers CORS preflight requests to the API and sets the CORS
+// headers for the allowed origins. It has to wrap the auth handler, browsers
+// don't send the token with preflight requests.
+func CORSHandler(cfg config.CORS, next http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return next
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: cfg.AllowedMethods,
+		AllowedHeaders: cfg.AllowedHeaders,
+	}).Handler(next)
+}
@@ -0,0 +1,46 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+func TestCORSHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	cfg := config.DefaultFullNode().API.CORS
+
+	// disabled by default
+	r := httptest.NewRequest(http.MethodPost, "/rpc/v0", nil)
+	r.Header.Set("Origin", "https://dash.example.com")
+	w := httptest.NewRecorder()
+	CORSHandler(cfg, next).ServeHTTP(w, r)
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	cfg.AllowedOrigins = []string{"https://dash.example.com"}
+	h := CORSHandler(cfg, next)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, "https://dash.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	r = httptest.NewRequest(http.MethodOptions, "/rpc/v0", nil)
+	r.Header.Set("Origin", "https://dash.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	r.Header.Set("Access-Control-Request-Headers", "Authorization")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, "https://dash.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "POST", w.Header().Get("Access-Control-Allow-Methods"))
+
+	r.Header.Set("Origin", "https://other.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-state-types/dline"
 
@@ -33,7 +36,6 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/filecoin-project/go-address"
-	"github.com/filecoin-project/go-fil-markets/pieceio"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	rm "github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/shared"
@@ -50,6 +52,8 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/commp"
+	"github.com/filecoin-project/lotus/markets/dealtransfer"
 	"github.com/filecoin-project/lotus/markets/utils"
 	"github.com/filecoin-project/lotus/node/impl/full"
 	"github.com/filecoin-project/lotus/node/impl/paych"
@@ -80,6 +84,8 @@ type API struct {
 	RetrievalStoreMgr dtypes.ClientRetrievalStoreManager
 	DataTransfer      dtypes.ClientDataTransfer
 	Host              host.Host
+
+	CommP *commp.Calc `optional:"true"`
 }
 
 func calcDealExpiration(minDuration uint64, md *dline.Info, startEpoch abi.ChainEpoch) abi.ChainEpoch {
@@ -628,38 +634,117 @@ func (a *API) ClientQueryAsk(ctx context.Context, p peer.ID, miner address.Addre
 	return signedAsk, nil
 }
 
-func (a *API) ClientCalcCommP(ctx context.Context, inpath string) (*api.CommPRet, error) {
+const (
+	findMinersParallel   = 32
+	findMinersAskTimeout = 15 * time.Second
+)
+
+func (a *API) ClientFindMiners(ctx context.Context, params api.FindMinersParams) ([]api.MinerAsk, error) {
+	miners, err := a.StateListMiners(ctx, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("listing miners: %w", err)
+	}
+
+	var (
+		lk   sync.Mutex
+		out  []api.MinerAsk
+		wg   sync.WaitGroup
+		sema = make(chan struct{}, findMinersParallel)
+	)
 
-	// Hard-code the sector size to 32GiB, because:
-	// - pieceio.GeneratePieceCommitment requires a RegisteredSealProof
-	// - commP itself is sector-size independent, with rather low probability of that changing
-	//   ( note how the final rust call is identical for every RegSP type )
-	//   https://github.com/filecoin-project/rust-filecoin-proofs-api/blob/v5.0.0/src/seal.rs#L1040-L1050
-	//
-	// IF/WHEN this changes in the future we will have to be able to calculate
-	// "old style" commP, and thus will need to introduce a version switch or similar
-	arbitrarySectorSize := abi.SectorSize(32 << 30)
+	for _, maddr := range miners {
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(maddr address.Address) {
+			defer wg.Done()
+			defer func() { <-sema }()
+
+			ask, err := a.findMinerAsk(ctx, maddr)
+			if err != nil {
+				return // unreachable miners are skipped
+			}
+
+			if ask.Ask.MaxPieceSize < params.MinFreeSpace {
+				return
+			}
+			if params.MaxPrice != nil {
+				price := ask.Ask.Price
+				if params.Verified {
+					price = ask.Ask.VerifiedPrice
+				}
+				if price.GreaterThan(*params.MaxPrice) {
+					return
+				}
+			}
+
+			lk.Lock()
+			out = append(out, ask)
+			lk.Unlock()
+		}(maddr)
+	}
+	wg.Wait()
 
-	rt, err := ffiwrapper.SealProofTypeFromSectorSize(arbitrarySectorSize)
+	sort.Slice(out, func(i, j int) bool {
+		pi, pj := out[i].Ask.Price, out[j].Ask.Price
+		if params.Verified {
+			pi, pj = out[i].Ask.VerifiedPrice, out[j].Ask.VerifiedPrice
+		}
+		return pi.LessThan(pj)
+	})
+
+	return out, nil
+}
+
+func (a *API) findMinerAsk(ctx context.Context, maddr address.Address) (api.MinerAsk, error) {
+	ctx, cancel := context.WithTimeout(ctx, findMinersAskTimeout)
+	defer cancel()
+
+	// miners without power can't prove deals, their asks aren't queried
+	pow, err := a.StateMinerPower(ctx, maddr, types.EmptyTSK)
 	if err != nil {
-		return nil, xerrors.Errorf("bad sector size: %w", err)
+		return api.MinerAsk{}, xerrors.Errorf("getting miner power: %w", err)
+	}
+	if pow.MinerPower.QualityAdjPower.LessThanEqual(big.Zero()) {
+		return api.MinerAsk{}, xerrors.Errorf("miner has no power")
 	}
 
-	rdr, err := os.Open(inpath)
+	mi, err := a.StateMinerInfo(ctx, maddr, types.EmptyTSK)
 	if err != nil {
-		return nil, err
+		return api.MinerAsk{}, xerrors.Errorf("getting miner info: %w", err)
+	}
+	if mi.PeerId == nil || *mi.PeerId == peer.ID("SETME") {
+		return api.MinerAsk{}, xerrors.Errorf("miner has no peer ID set")
 	}
-	defer rdr.Close() //nolint:errcheck
 
-	stat, err := rdr.Stat()
+	info := utils.NewStorageProviderInfo(maddr, mi.Worker, mi.SectorSize, *mi.PeerId, mi.Multiaddrs)
+	signedAsk, err := a.SMDealClient.GetAsk(ctx, info)
 	if err != nil {
-		return nil, err
+		return api.MinerAsk{}, err
 	}
+	if signedAsk == nil || signedAsk.Ask == nil {
+		return api.MinerAsk{}, xerrors.Errorf("miner returned no ask")
+	}
+
+	return api.MinerAsk{
+		Miner:  maddr,
+		PeerID: *mi.PeerId,
+		Ask:    signedAsk.Ask,
+	}, nil
+}
 
-	commP, pieceSize, err := pieceio.GeneratePieceCommitment(rt, rdr, uint64(stat.Size()))
+func (a *API) ClientCalcCommP(ctx context.Context, inpath string) (*api.CommPRet, error) {
+	if a.CommP != nil {
+		return a.CommP.Wait(ctx, inpath)
+	}
 
+	commP, pieceSize, err := commp.Compute(inpath)
 	if err != nil {
-		return nil, xerrors.Errorf("computing commP failed: %w", err)
+		return nil, err
 	}
 
 	return &api.CommPRet{
@@ -668,6 +753,77 @@ func (a *API) ClientCalcCommP(ctx context.Context, inpath string) (*api.CommPRet
 	}, nil
 }
 
+func (a *API) ClientCommPQueue(ctx context.Context, inpath string) (api.CommPJob, error) {
+	if a.CommP == nil {
+		return api.CommPJob{}, xerrors.New("commP calculation service not running")
+	}
+	return a.CommP.Queue(inpath)
+}
+
+func (a *API) ClientCommPJobs(ctx context.Context) ([]api.CommPJob, error) {
+	if a.CommP == nil {
+		return nil, nil
+	}
+	return a.CommP.Jobs(), nil
+}
+
+// minerPeer connects to a miner at the addresses from its on-chain info
+func (a *API) minerPeer(ctx context.Context, miner address.Address) (peer.ID, error) {
+	mi, err := a.StateMinerInfo(ctx, miner, types.EmptyTSK)
+	if err != nil {
+		return "", xerrors.Errorf("failed getting miner info: %w", err)
+	}
+	if mi.PeerId == nil {
+		return "", xerrors.Errorf("miner %s has no peer ID set", miner)
+	}
+
+	info := utils.NewStorageProviderInfo(miner, mi.Worker, mi.SectorSize, *mi.PeerId, mi.Multiaddrs)
+	if err := a.Host.Connect(ctx, peer.AddrInfo{ID: info.PeerID, Addrs: info.Addrs}); err != nil {
+		return "", xerrors.Errorf("connecting to miner: %w", err)
+	}
+	return info.PeerID, nil
+}
+
+func (a *API) ClientDealTransfers(ctx context.Context, miner address.Address, proposal *cid.Cid) (api.DealTransfers, error) {
+	p, err := a.minerPeer(ctx, miner)
+	if err != nil {
+		return api.DealTransfers{}, err
+	}
+	return dealtransfer.Query(ctx, a.Host, p, proposal)
+}
+
+func (a *API) ClientPushDealData(ctx context.Context, miner address.Address, proposal cid.Cid, inpath string, protocol string) (string, error) {
+	f, err := os.Open(inpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+
+	p, err := a.minerPeer(ctx, miner)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := dealtransfer.Query(ctx, a.Host, p, &proposal)
+	if err != nil {
+		return "", xerrors.Errorf("querying miner transfer protocols: %w", err)
+	}
+
+	preference := dealtransfer.DefaultPreference
+	if protocol != "" {
+		preference = []string{protocol}
+	}
+	protocol = dealtransfer.Negotiate(t.Protocols, preference)
+	if protocol == "" {
+		return "", xerrors.Errorf("miner doesn't accept pushes with %v, it supports %v", preference, t.Protocols)
+	}
+
+	if err := dealtransfer.Push(ctx, a.Host, p, protocol, t, proposal, f); err != nil {
+		return "", err
+	}
+	return protocol, nil
+}
+
 type lenWriter int64
 
 func (w *lenWriter) Write(p []byte) (n int, err error) {
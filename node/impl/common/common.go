@@ -2,12 +2,16 @@ package common
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"sort"
 	"strings"
 
 	logging "github.com/ipfs/go-log/v2"
 
 	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/ipfs/go-cid"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/host"
 	metrics "github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -23,6 +27,10 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/profiles"
+	"github.com/filecoin-project/lotus/lib/quota"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/lp2p"
 )
@@ -35,12 +43,25 @@ type CommonAPI struct {
 	Host         host.Host
 	Router       lp2p.BaseIpfsRouting
 	Reporter     metrics.Reporter
+	StreamLimits *lp2p.StreamLimiter
+	NatMappings  *lp2p.NatMappings
+	PeerExchange *peermgr.PeerExchange
 	Sk           *dtypes.ScoreKeeper
 	ShutdownChan dtypes.ShutdownChan
+	Profiles     *profiles.Capturer
+	NetName      dtypes.NetworkName
+	Genesis      dtypes.GenesisCid
 }
 
 type jwtPayload struct {
 	Allow []auth.Permission
+
+	// ID makes tokens with equal permissions distinct, so they are limited
+	// separately. Tokens created before it was set don't have one.
+	ID    string       `json:",omitempty"`
+	Quota *quota.Quota `json:",omitempty"`
+	// Worker is the ID of worker tokens, see AuthNewWorker
+	Worker string `json:",omitempty"`
 }
 
 func (a *CommonAPI) AuthVerify(ctx context.Context, token string) ([]auth.Permission, error) {
@@ -52,14 +73,80 @@ func (a *CommonAPI) AuthVerify(ctx context.Context, token string) ([]auth.Permis
 	return payload.Allow, nil
 }
 
+func tokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", xerrors.Errorf("generating token ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
 func (a *CommonAPI) AuthNew(ctx context.Context, perms []auth.Permission) ([]byte, error) {
+	id, err := tokenID()
+	if err != nil {
+		return nil, err
+	}
+
 	p := jwtPayload{
 		Allow: perms, // TODO: consider checking validity
+		ID:    id,
 	}
 
 	return jwt.Sign(&p, (*jwt.HMACSHA)(a.APISecret))
 }
 
+func (a *CommonAPI) AuthNewWithQuota(ctx context.Context, perms []auth.Permission, q quota.Quota) ([]byte, error) {
+	id, err := tokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	p := jwtPayload{
+		Allow: perms,
+		ID:    id,
+		Quota: &q,
+	}
+
+	return jwt.Sign(&p, (*jwt.HMACSHA)(a.APISecret))
+}
+
+// AuthNewWorker signs a token with the ID of a worker token, which the miner
+// checks for revocation on every request
+func (a *CommonAPI) AuthNewWorker(ctx context.Context, perms []auth.Permission, id string) ([]byte, error) {
+	p := jwtPayload{
+		Allow:  perms,
+		Worker: id,
+	}
+
+	return jwt.Sign(&p, (*jwt.HMACSHA)(a.APISecret))
+}
+
+// TokenWorker returns the worker token ID of a token, false for tokens which
+// weren't created with AuthNewWorker
+func (a *CommonAPI) TokenWorker(ctx context.Context, token string) (string, bool, error) {
+	var payload jwtPayload
+	if _, err := jwt.Verify([]byte(token), (*jwt.HMACSHA)(a.APISecret), &payload); err != nil {
+		return "", false, xerrors.Errorf("JWT Verification failed: %w", err)
+	}
+
+	return payload.Worker, payload.Worker != "", nil
+}
+
+// TokenQuota returns the quota of a token, false when the token was created
+// without one
+func (a *CommonAPI) TokenQuota(ctx context.Context, token string) (quota.Token, bool, error) {
+	var payload jwtPayload
+	if _, err := jwt.Verify([]byte(token), (*jwt.HMACSHA)(a.APISecret), &payload); err != nil {
+		return quota.Token{}, false, xerrors.Errorf("JWT Verification failed: %w", err)
+	}
+
+	if payload.Quota == nil {
+		return quota.Token{}, false, nil
+	}
+
+	return quota.Token{ID: payload.ID, Quota: *payload.Quota}, true, nil
+}
+
 func (a *CommonAPI) NetConnectedness(ctx context.Context, pid peer.ID) (network.Connectedness, error) {
 	return a.Host.Network().Connectedness(pid), nil
 }
@@ -130,10 +217,19 @@ func (a *CommonAPI) NetAutoNatStatus(ctx context.Context) (i api.NatInfo, err er
 		maddr = pa.String()
 	}
 
-	return api.NatInfo{
+	out := api.NatInfo{
 		Reachability: autonat.Status(),
 		PublicAddr:   maddr,
-	}, nil
+		PortMappings: a.NatMappings.Mappings(),
+	}
+	for _, addr := range a.Host.Network().ListenAddresses() {
+		out.ListenAddrs = append(out.ListenAddrs, addr.String())
+	}
+	for _, addr := range a.Host.Addrs() {
+		out.AnnouncedAddrs = append(out.AnnouncedAddrs, addr.String())
+	}
+
+	return out, nil
 }
 
 func (a *CommonAPI) NetAgentVersion(ctx context.Context, p peer.ID) (string, error) {
@@ -153,6 +249,46 @@ func (a *CommonAPI) NetBandwidthStats(ctx context.Context) (metrics.Stats, error
 	return a.Reporter.GetBandwidthTotals(), nil
 }
 
+func (a *CommonAPI) NetBootstrapList(ctx context.Context) ([]peer.AddrInfo, error) {
+	return a.PeerExchange.Bootstrappers(), nil
+}
+
+func (a *CommonAPI) NetBootstrapAdd(ctx context.Context, ai peer.AddrInfo) error {
+	return a.PeerExchange.AddBootstrapper(ai)
+}
+
+func (a *CommonAPI) NetBootstrapRemove(ctx context.Context, p peer.ID) error {
+	return a.PeerExchange.RemoveBootstrapper(p)
+}
+
+func (a *CommonAPI) NetKnownMiners(ctx context.Context) ([]peer.AddrInfo, error) {
+	return a.PeerExchange.KnownMiners(), nil
+}
+
+func (a *CommonAPI) NetStats(ctx context.Context) (api.NetStats, error) {
+	conns := a.Host.Network().Conns()
+	out := api.NetStats{
+		Peers:     len(a.Host.Network().Peers()),
+		Conns:     len(conns),
+		Bandwidth: a.Reporter.GetBandwidthTotals(),
+	}
+	for _, c := range conns {
+		out.Streams += len(c.GetStreams())
+	}
+
+	if cm, ok := a.Host.ConnManager().(interface{ GetInfo() connmgr.CMInfo }); ok {
+		info := cm.GetInfo()
+		out.ConnMgrLow = info.LowWater
+		out.ConnMgrHigh = info.HighWater
+	}
+
+	for _, st := range a.StreamLimits.Stats() {
+		out.StreamLimits = append(out.StreamLimits, api.StreamLimitStat(st))
+	}
+
+	return out, nil
+}
+
 func (a *CommonAPI) NetBandwidthStatsByPeer(ctx context.Context) (map[string]metrics.Stats, error) {
 	out := make(map[string]metrics.Stats)
 	for p, s := range a.Reporter.GetBandwidthByPeer() {
@@ -176,8 +312,36 @@ func (a *CommonAPI) Version(context.Context) (api.Version, error) {
 	}
 
 	return api.Version{
-		Version:    build.UserVersion(),
-		APIVersion: v,
+		Version:     build.UserVersion(),
+		APIVersion:  v,
+		APIFeatures: build.FeaturesForType(build.RunningNodeType),
+
+		BlockDelay: build.BlockDelaySecs,
+	}, nil
+}
+
+func (a *CommonAPI) BuildInfo(context.Context) (api.BuildInfo, error) {
+	v, err := build.VersionForType(build.RunningNodeType)
+	if err != nil {
+		return api.BuildInfo{}, err
+	}
+
+	params, err := build.ProofParamVersions()
+	if err != nil {
+		return api.BuildInfo{}, err
+	}
+
+	return api.BuildInfo{
+		Version:     build.UserVersion(),
+		APIVersion:  v,
+		Commit:      strings.TrimPrefix(build.CurrentCommit, "+git."),
+		BuildTime:   build.BuildTime,
+		BuildType:   build.BuildTypeName(),
+		Features:    build.Features(),
+		ProofParams: params,
+
+		Network: string(a.NetName),
+		Genesis: cid.Cid(a.Genesis),
 
 		BlockDelay: build.BlockDelaySecs,
 	}, nil
@@ -200,4 +364,21 @@ func (a *CommonAPI) Closing(ctx context.Context) (<-chan struct{}, error) {
 	return make(chan struct{}), nil // relies on jsonrpc closing
 }
 
+func (a *CommonAPI) DebugProfilesList(context.Context) ([]api.ProfileInfo, error) {
+	return a.Profiles.List()
+}
+
+func (a *CommonAPI) DebugProfileGet(ctx context.Context, name string) ([]byte, error) {
+	return a.Profiles.Get(name)
+}
+
+func (a *CommonAPI) DebugBackgroundTasks(context.Context) ([]api.BackgroundTask, error) {
+	tasks := crash.Tasks()
+	out := make([]api.BackgroundTask, len(tasks))
+	for i, t := range tasks {
+		out[i] = api.BackgroundTask(t)
+	}
+	return out, nil
+}
+
 var _ api.Common = &CommonAPI{}
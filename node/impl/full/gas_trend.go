@@ -0,0 +1,194 @@
+package full
+
+import (
+	"context"
+	"fmt"
+	"math"
+	stdbig "math/big"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+const (
+	defaultTrendLookback = 120
+	maxTrendLookback     = 2880
+	maxTrendHorizon      = 240
+
+	// waitSaving is the forecast base fee reduction worth waiting for
+	waitSaving = 0.05
+	// meanReversion is how far the base fee can be above the recent mean
+	// before waiting for it to come down, unless it is rising
+	meanReversion = 1.25
+)
+
+// sendMargins are the epochs before the deadline from which messages are sent
+// regardless of the base fee, leaving room for inclusion and retries
+var sendMargins = map[string]abi.ChainEpoch{
+	"post":        20,
+	"provecommit": 60,
+	"precommit":   60,
+	"other":       5,
+}
+
+func (a *GasAPI) GasTrend(ctx context.Context, lookback, horizon abi.ChainEpoch, tsk types.TipSetKey) (*api.GasTrend, error) {
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+
+	if lookback <= 0 {
+		lookback = defaultTrendLookback
+	}
+	if lookback > maxTrendLookback {
+		lookback = maxTrendLookback
+	}
+	if horizon > maxTrendHorizon {
+		horizon = maxTrendHorizon
+	}
+
+	var history []api.BaseFeePoint
+	for from := ts.Height() - lookback; ts.Height() > from; {
+		history = append(history, api.BaseFeePoint{Height: ts.Height(), BaseFee: ts.Blocks()[0].ParentBaseFee})
+		if ts.Height() == 0 {
+			break
+		}
+
+		ts, err = a.Chain.LoadTipSet(ts.Parents())
+		if err != nil {
+			return nil, xerrors.Errorf("loading parent tipset: %w", err)
+		}
+	}
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return baseFeeTrend(history, horizon), nil
+}
+
+// baseFeeTrend summarizes the base fee history, and extrapolates its average
+// change over horizon epochs
+func baseFeeTrend(history []api.BaseFeePoint, horizon abi.ChainEpoch) *api.GasTrend {
+	out := &api.GasTrend{
+		History: history,
+		Mean:    big.Zero(),
+		Min:     big.Zero(),
+		Max:     big.Zero(),
+	}
+	if len(history) == 0 {
+		return out
+	}
+
+	sum := big.Zero()
+	out.Min, out.Max = history[0].BaseFee, history[0].BaseFee
+	for _, p := range history {
+		sum = big.Add(sum, p.BaseFee)
+		if p.BaseFee.LessThan(out.Min) {
+			out.Min = p.BaseFee
+		}
+		if p.BaseFee.GreaterThan(out.Max) {
+			out.Max = p.BaseFee
+		}
+	}
+	out.Mean = big.Div(sum, big.NewInt(int64(len(history))))
+
+	first, last := history[0], history[len(history)-1]
+	if epochs := last.Height - first.Height; epochs > 0 && first.BaseFee.GreaterThan(big.Zero()) {
+		ratio := math.Pow(toFloat(last.BaseFee)/toFloat(first.BaseFee), 1/float64(epochs))
+
+		// the base fee can't change faster than this per epoch
+		maxChange := 1. / build.BaseFeeMaxChangeDenom
+		ratio = math.Max(1-maxChange, math.Min(1+maxChange, ratio))
+		out.ChangePerEpoch = ratio - 1
+	}
+
+	fee := toFloat(last.BaseFee)
+	for h := abi.ChainEpoch(1); h <= horizon; h++ {
+		fee = math.Max(fee*(1+out.ChangePerEpoch), build.MinimumBaseFee)
+		out.Forecast = append(out.Forecast, api.BaseFeePoint{
+			Height:  last.Height + h,
+			BaseFee: fromFloat(fee),
+		})
+	}
+
+	return out
+}
+
+func (a *GasAPI) GasShouldSendNow(ctx context.Context, kind string, deadline abi.ChainEpoch, tsk types.TipSetKey) (*api.SendAdvice, error) {
+	margin, ok := sendMargins[kind]
+	if !ok {
+		return nil, xerrors.Errorf("unknown message kind '%s'", kind)
+	}
+
+	ts, err := a.Chain.GetTipSetFromKey(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset %s: %w", tsk, err)
+	}
+
+	horizon := abi.ChainEpoch(maxTrendHorizon)
+	if deadline > 0 {
+		horizon = deadline - margin - ts.Height()
+	}
+	if horizon < 0 {
+		horizon = 0
+	}
+
+	trend, err := a.GasTrend(ctx, defaultTrendLookback, horizon, ts.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	return sendAdvice(trend, ts.Height(), deadline, margin), nil
+}
+
+// sendAdvice decides whether to send now, based on the base fee trend
+func sendAdvice(trend *api.GasTrend, height, deadline, margin abi.ChainEpoch) *api.SendAdvice {
+	cur := trend.History[len(trend.History)-1].BaseFee
+	out := &api.SendAdvice{
+		SendNow:         true,
+		BaseFee:         cur,
+		ExpectedBaseFee: cur,
+		ExpectedAt:      height,
+	}
+
+	for _, p := range trend.Forecast {
+		if p.BaseFee.LessThan(out.ExpectedBaseFee) {
+			out.ExpectedBaseFee, out.ExpectedAt = p.BaseFee, p.Height
+		}
+	}
+
+	switch {
+	case deadline > 0 && deadline-height <= margin:
+		out.Reason = fmt.Sprintf("deadline in %d epochs", deadline-height)
+	case len(trend.Forecast) > 0 && toFloat(out.ExpectedBaseFee) < toFloat(cur)*(1-waitSaving):
+		out.SendNow = false
+		out.Reason = fmt.Sprintf("base fee is falling %.2f%% per epoch", -trend.ChangePerEpoch*100)
+	case len(trend.Forecast) > 0 && trend.ChangePerEpoch <= 0 && toFloat(cur) > toFloat(trend.Mean)*meanReversion:
+		out.SendNow = false
+		out.ExpectedBaseFee, out.ExpectedAt = trend.Mean, 0
+		out.Reason = "base fee is well above its recent mean"
+	case trend.ChangePerEpoch > 0:
+		out.Reason = fmt.Sprintf("base fee is rising %.2f%% per epoch", trend.ChangePerEpoch*100)
+	default:
+		out.Reason = "base fee is stable"
+	}
+
+	return out
+}
+
+func toFloat(v abi.TokenAmount) float64 {
+	f, _ := new(stdbig.Float).SetInt(v.Int).Float64()
+	return f
+}
+
+func fromFloat(f float64) abi.TokenAmount {
+	i, _ := stdbig.NewFloat(f).Int(nil)
+	return big.NewFromGo(i)
+}
@@ -0,0 +1,56 @@
+package full
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+func feeHistory(start abi.ChainEpoch, fees ...int64) []api.BaseFeePoint {
+	out := make([]api.BaseFeePoint, len(fees))
+	for i, f := range fees {
+		out[i] = api.BaseFeePoint{Height: start + abi.ChainEpoch(i), BaseFee: big.NewInt(f)}
+	}
+	return out
+}
+
+func TestBaseFeeTrend(t *testing.T) {
+	tr := baseFeeTrend(feeHistory(100, 1000, 900, 810), 2)
+	require.Equal(t, big.NewInt(810), tr.Min)
+	require.Equal(t, big.NewInt(1000), tr.Max)
+	require.Equal(t, big.NewInt(903), tr.Mean)
+	require.InDelta(t, -0.1, tr.ChangePerEpoch, 1e-9)
+
+	require.Len(t, tr.Forecast, 2)
+	require.Equal(t, abi.ChainEpoch(103), tr.Forecast[0].Height)
+	require.Equal(t, big.NewInt(729), tr.Forecast[0].BaseFee)
+
+	// changes are capped at the protocol maximum
+	tr = baseFeeTrend(feeHistory(100, 1000, 5000), 0)
+	require.InDelta(t, 0.125, tr.ChangePerEpoch, 1e-9)
+	require.Empty(t, tr.Forecast)
+}
+
+func TestSendAdvice(t *testing.T) {
+	falling := baseFeeTrend(feeHistory(100, 1000, 900, 810), 10)
+
+	adv := sendAdvice(falling, 102, 0, 20)
+	require.False(t, adv.SendNow, adv.Reason)
+	require.Equal(t, abi.ChainEpoch(112), adv.ExpectedAt)
+
+	adv = sendAdvice(falling, 102, 120, 20)
+	require.True(t, adv.SendNow, "deadline within the margin")
+
+	rising := baseFeeTrend(feeHistory(100, 810, 900, 1000), 10)
+	adv = sendAdvice(rising, 102, 0, 20)
+	require.True(t, adv.SendNow, adv.Reason)
+
+	spike := baseFeeTrend(feeHistory(100, 1000, 1000, 1000, 1000, 1000, 3000, 1000), 10)
+	adv = sendAdvice(spike, 106, 0, 20)
+	require.True(t, adv.SendNow, "a past spike doesn't hold messages back")
+}
@@ -9,9 +9,12 @@ import (
 	"go.uber.org/fx"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-state-types/crypto"
+
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/messagesigner"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/approval"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
@@ -111,6 +114,14 @@ func (a *MpoolAPI) MpoolPush(ctx context.Context, smsg *types.SignedMessage) (ci
 }
 
 func (a *MpoolAPI) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	if id, held := a.Approvals.Hold(ctx, msg, spec); held {
+		return nil, xerrors.Errorf("held as pending action %d: %w", id, approval.ErrPending)
+	}
+
+	return a.pushMessage(ctx, msg, spec)
+}
+
+func (a *MpoolAPI) pushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
 	cp := *msg
 	msg = &cp
 	inMsg := *msg
@@ -169,6 +180,43 @@ func (a *MpoolAPI) MpoolPushMessage(ctx context.Context, msg *types.Message, spe
 	return smsg, err
 }
 
+func (a *MpoolAPI) MpoolPendingApprovals(ctx context.Context) ([]api.PendingApproval, error) {
+	if a.Approvals == nil {
+		return []api.PendingApproval{}, nil
+	}
+	return a.Approvals.List(), nil
+}
+
+func (a *MpoolAPI) MpoolApprove(ctx context.Context, id uint64, approver address.Address, sig *crypto.Signature) (*types.SignedMessage, error) {
+	if a.Approvals == nil {
+		return nil, xerrors.New("approvals are not enabled")
+	}
+
+	// the approver key is the second pair of eyes, this node must not be able
+	// to sign for it
+	has, err := a.Wallet.HasKey(approver)
+	if err != nil {
+		return nil, xerrors.Errorf("checking wallet for approver key: %w", err)
+	}
+	if has {
+		return nil, xerrors.Errorf("approver %s has its key in this node's wallet", approver)
+	}
+
+	msg, spec, err := a.Approvals.Take(id, approver, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.pushMessage(ctx, msg, spec)
+}
+
+func (a *MpoolAPI) MpoolReject(ctx context.Context, id uint64) error {
+	if a.Approvals == nil {
+		return xerrors.New("approvals are not enabled")
+	}
+	return a.Approvals.Reject(ctx, id)
+}
+
 func (a *MpoolAPI) MpoolGetNonce(ctx context.Context, addr address.Address) (uint64, error) {
 	return a.Mpool.GetNonce(addr)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/filecoin-project/lotus/chain/stmgr"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/approval"
 	"github.com/filecoin-project/lotus/lib/sigs"
 )
 
@@ -21,6 +22,8 @@ type WalletAPI struct {
 
 	StateManager *stmgr.StateManager
 	Wallet       *wallet.Wallet
+
+	Approvals *approval.Queue `optional:"true"`
 }
 
 func (a *WalletAPI) WalletNew(ctx context.Context, typ crypto.SigType) (address.Address, error) {
@@ -46,6 +49,13 @@ func (a *WalletAPI) WalletBalance(ctx context.Context, addr address.Address) (ty
 }
 
 func (a *WalletAPI) WalletSign(ctx context.Context, k address.Address, msg []byte) (*crypto.Signature, error) {
+	if err := a.Approvals.CheckSign(ctx, msg); err != nil {
+		return nil, err
+	}
+	return a.sign(ctx, k, msg)
+}
+
+func (a *WalletAPI) sign(ctx context.Context, k address.Address, msg []byte) (*crypto.Signature, error) {
 	keyAddr, err := a.StateManager.ResolveToKeyAddress(ctx, k, nil)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to resolve ID address: %w", keyAddr)
@@ -54,9 +64,13 @@ func (a *WalletAPI) WalletSign(ctx context.Context, k address.Address, msg []byt
 }
 
 func (a *WalletAPI) WalletSignMessage(ctx context.Context, k address.Address, msg *types.Message) (*types.SignedMessage, error) {
+	if err := a.Approvals.CheckSignMessage(ctx, msg); err != nil {
+		return nil, err
+	}
+
 	mcid := msg.Cid()
 
-	sig, err := a.WalletSign(ctx, k, mcid.Bytes())
+	sig, err := a.sign(ctx, k, mcid.Bytes())
 	if err != nil {
 		return nil, xerrors.Errorf("failed to sign message: %w", err)
 	}
@@ -80,6 +94,9 @@ func (a *WalletAPI) WalletSetDefault(ctx context.Context, addr address.Address)
 }
 
 func (a *WalletAPI) WalletExport(ctx context.Context, addr address.Address) (*types.KeyInfo, error) {
+	if err := a.Approvals.CheckExport(ctx); err != nil {
+		return nil, err
+	}
 	return a.Wallet.Export(addr)
 }
 
@@ -6,6 +6,7 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/market"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/ipfs/go-cid"
@@ -14,9 +15,14 @@ import (
 type MarketAPI struct {
 	fx.In
 
-	FMgr *market.FundMgr
+	FMgr   *market.FundMgr
+	Escrow *market.EscrowManager
 }
 
 func (a *MarketAPI) MarketEnsureAvailable(ctx context.Context, addr, wallet address.Address, amt types.BigInt) (cid.Cid, error) {
 	return a.FMgr.EnsureAvailable(ctx, addr, wallet, amt)
 }
+
+func (a *MarketAPI) MarketFundsStatus(ctx context.Context) ([]api.MarketEscrowStatus, error) {
+	return a.Escrow.Status(), nil
+}
@@ -3,6 +3,7 @@ package impl
 import (
 	"context"
 	"net/http"
+	"sync"
 
 	"golang.org/x/xerrors"
 
@@ -12,12 +13,17 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/build"
 	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
 )
 
 type remoteWorker struct {
 	api.WorkerAPI
 	closer jsonrpc.ClientCloser
+
+	// the scheduler closes workers it drops, which were already closed
+	// when their token was revoked
+	closeOnce sync.Once
 }
 
 func (r *remoteWorker) NewSector(ctx context.Context, sector abi.SectorID) error {
@@ -38,11 +44,21 @@ func connectRemoteWorker(ctx context.Context, fa api.Common, url string) (*remot
 		return nil, xerrors.Errorf("creating jsonrpc client: %w", err)
 	}
 
-	return &remoteWorker{wapi, closer}, nil
+	ver, err := wapi.Version(ctx)
+	if err != nil {
+		closer()
+		return nil, xerrors.Errorf("getting worker version: %w", err)
+	}
+	if err := ver.Compatible(build.WorkerAPIVersion); err != nil {
+		closer()
+		return nil, xerrors.Errorf("worker API: %w", err)
+	}
+
+	return &remoteWorker{WorkerAPI: wapi, closer: closer}, nil
 }
 
 func (r *remoteWorker) Close() error {
-	r.closer()
+	r.closeOnce.Do(r.closer)
 	return nil
 }
 
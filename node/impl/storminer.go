@@ -1,10 +1,15 @@
 package impl
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path"
+	"sort"
 	"strconv"
 	"time"
 
@@ -20,22 +25,49 @@ import (
 	storagemarket "github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
 
 	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
 	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
 	"github.com/filecoin-project/lotus/extern/sector-storage/fsutil"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
 	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/api/client"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/ops"
+	"github.com/filecoin-project/lotus/lib/paramcache"
+	"github.com/filecoin-project/lotus/lib/quota"
+	"github.com/filecoin-project/lotus/markets/dealintake"
+	"github.com/filecoin-project/lotus/markets/dealpay"
+	"github.com/filecoin-project/lotus/markets/retrievalsched"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/impl/common"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/reload"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/alerts"
+	"github.com/filecoin-project/lotus/storage/autotune"
+	"github.com/filecoin-project/lotus/storage/carindex"
+	"github.com/filecoin-project/lotus/storage/cron"
+	"github.com/filecoin-project/lotus/storage/gasreport"
+	"github.com/filecoin-project/lotus/storage/keychange"
+	"github.com/filecoin-project/lotus/storage/labels"
+	"github.com/filecoin-project/lotus/storage/outbox"
 	"github.com/filecoin-project/lotus/storage/sectorblocks"
+	"github.com/filecoin-project/lotus/storage/sectorhooks"
+	"github.com/filecoin-project/lotus/storage/sectorindex"
+	"github.com/filecoin-project/lotus/storage/sweep"
+	"github.com/filecoin-project/lotus/storage/syncgate"
+	"github.com/filecoin-project/lotus/storage/workerreg"
+	"github.com/filecoin-project/lotus/storage/workertasks"
+	"github.com/filecoin-project/lotus/storage/workertokens"
 )
 
 type StorageMinerAPI struct {
@@ -47,14 +79,42 @@ type StorageMinerAPI struct {
 	PieceStore        dtypes.ProviderPieceStore
 	StorageProvider   storagemarket.StorageProvider
 	RetrievalProvider retrievalmarket.RetrievalProvider
-	Miner             *storage.Miner
-	BlockMiner        *miner.Miner
 	Full              api.FullNode
-	StorageMgr        *sectorstorage.Manager `optional:"true"`
-	IStorageMgr       sectorstorage.SectorManager
-	*stores.Index
-	DataTransfer dtypes.ProviderDataTransfer
-	Host         host.Host
+	DataTransfer      dtypes.ProviderDataTransfer
+	Host              host.Host
+	DealIntake        *dealintake.Intake
+	DealPayments      *dealpay.Tracker
+	Labels            *labels.Store
+	CarIndexes        *carindex.Store
+	Operations        *ops.Registry
+	Quotas            *quota.Tracker
+	Pledge            *dtypes.PledgeControl
+	Reloader          *reload.Reloader
+
+	// The sealing subsystem isn't set up on markets nodes, which only serve
+	// the market methods, see apistruct.MarketsStorMinerAPI
+	Miner         *storage.Miner              `optional:"true"`
+	BlockMiner    *miner.Miner                `optional:"true"`
+	StorageMgr    *sectorstorage.Manager      `optional:"true"`
+	IStorageMgr   sectorstorage.SectorManager `optional:"true"`
+	*stores.Index `optional:"true"`
+	KeyChange     *keychange.Manager  `optional:"true"`
+	Sweeper       *sweep.Sweeper      `optional:"true"`
+	Alerts        *alerts.Reporter    `optional:"true"`
+	Cron          *cron.Cron          `optional:"true"`
+	GasReport     *gasreport.Reporter `optional:"true"`
+	SectorHooks   *sectorhooks.Hooks  `optional:"true"`
+	SectorIndex   *sectorindex.Index  `optional:"true"`
+	Tuner         *autotune.Tuner     `optional:"true"`
+	Workers       *workerreg.Registry `optional:"true"`
+
+	RetrievalSched *retrievalsched.Scheduler `optional:"true"`
+	WorkerTasks    *workertasks.Affinity     `optional:"true"`
+	WorkerTokens   *workertokens.Tokens      `optional:"true"`
+	// Outbox is only set up with offline signing, see config.SigningConfig
+	Outbox *outbox.Outbox `optional:"true"`
+	// SyncGate is set by lotus-miner run
+	SyncGate *syncgate.Gate `optional:"true"`
 
 	ConsiderOnlineStorageDealsConfigFunc       dtypes.ConsiderOnlineStorageDealsConfigFunc
 	SetConsiderOnlineStorageDealsConfigFunc    dtypes.SetConsiderOnlineStorageDealsConfigFunc
@@ -82,16 +142,190 @@ func (sm *StorageMinerAPI) ServeRemote(w http.ResponseWriter, r *http.Request) {
 	sm.StorageMgr.ServeHTTP(w, r)
 }
 
+// ServeParams serves the proof parameter files of the miner to workers, see
+// paramcache.Fetch
+func (sm *StorageMinerAPI) ServeParams(w http.ResponseWriter, r *http.Request) {
+	if !auth.HasPerm(r.Context(), nil, apistruct.PermAdmin) {
+		w.WriteHeader(401)
+		_ = json.NewEncoder(w).Encode(struct{ Error string }{"unauthorized: missing admin permission"})
+		return
+	}
+
+	(&paramcache.Handler{
+		Prefix: "/remote/params",
+		Params: build.ParametersJSON(),
+		Dir:    paramcache.Dir(),
+	}).ServeHTTP(w, r)
+}
+
+// ServePiece serves unsealed piece data to markets nodes for retrievals, with
+// the sector number as the last path element and the unpadded offset and
+// size as query parameters
+func (sm *StorageMinerAPI) ServePiece(w http.ResponseWriter, r *http.Request) {
+	if !auth.HasPerm(r.Context(), nil, apistruct.PermAdmin) {
+		w.WriteHeader(401)
+		_ = json.NewEncoder(w).Encode(struct{ Error string }{"unauthorized: missing admin permission"})
+		return
+	}
+
+	sector, err := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parsing sector number: %s", err), 400)
+		return
+	}
+	offset, err := strconv.ParseUint(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parsing offset: %s", err), 400)
+		return
+	}
+	size, err := strconv.ParseUint(r.URL.Query().Get("size"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parsing size: %s", err), 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	cw := &countWriter{w: w}
+	if err := sm.Miner.ReadPiece(r.Context(), cw, abi.SectorNumber(sector), storiface.UnpaddedByteIndex(offset), abi.UnpaddedPieceSize(size)); err != nil {
+		log.Warnf("serving piece of sector %d: %s", sector, err)
+		if cw.n == 0 {
+			http.Error(w, err.Error(), 500)
+		}
+	}
+}
+
+// countWriter counts the bytes written to w, so ServePiece knows whether it
+// can still send an error status
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (sm *StorageMinerAPI) TokenUsage(ctx context.Context, token string) (quota.Usage, error) {
+	tok, ok, err := sm.TokenQuota(ctx, token)
+	if err != nil {
+		return quota.Usage{}, err
+	}
+	if !ok {
+		return quota.Usage{}, xerrors.Errorf("token was created without a quota")
+	}
+
+	return sm.Quotas.Usage(tok), nil
+}
+
 func (sm *StorageMinerAPI) WorkerStats(context.Context) (map[uint64]storiface.WorkerStats, error) {
-	return sm.StorageMgr.WorkerStats(), nil
+	out := sm.StorageMgr.WorkerStats()
+	if sm.Workers == nil {
+		return out, nil
+	}
+
+	regs, err := sm.Workers.List()
+	if err != nil {
+		return nil, err
+	}
+	id := storiface.PendingWorkerIDs
+	for _, reg := range regs {
+		if reg.State != api.WorkerRegPending {
+			continue
+		}
+		out[id] = storiface.WorkerStats{
+			Info: storiface.WorkerInfo{
+				Hostname:  reg.Hostname,
+				Resources: reg.Resources,
+			},
+			Registration: reg.ID,
+		}
+		id++
+	}
+	return out, nil
 }
 
 func (sm *StorageMinerAPI) WorkerJobs(ctx context.Context) (map[uint64][]storiface.WorkerJob, error) {
 	return sm.StorageMgr.WorkerJobs(), nil
 }
 
+func (sm *StorageMinerAPI) WorkerSummaries(ctx context.Context) ([]storiface.WorkerSummary, error) {
+	return sm.StorageMgr.WorkerSummaries(), nil
+}
+
+// AuthVerify also rejects revoked worker tokens, see WorkerTokenRevoke
+func (sm *StorageMinerAPI) AuthVerify(ctx context.Context, token string) ([]auth.Permission, error) {
+	perms, err := sm.CommonAPI.AuthVerify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok, err := sm.TokenWorker(ctx, token)
+	if err != nil || !ok {
+		return perms, err
+	}
+	if sm.WorkerTokens == nil {
+		return nil, xerrors.New("worker tokens are only valid on the sealing miner")
+	}
+	if err := sm.WorkerTokens.Check(id); err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+func (sm *StorageMinerAPI) WorkerTokenCreate(ctx context.Context, name string, perms []auth.Permission) ([]byte, error) {
+	wt, err := sm.WorkerTokens.Create(name, perms)
+	if err != nil {
+		return nil, err
+	}
+	return sm.AuthNewWorker(ctx, perms, wt.ID)
+}
+
+func (sm *StorageMinerAPI) WorkerTokenList(ctx context.Context) ([]api.WorkerToken, error) {
+	return sm.WorkerTokens.List(), nil
+}
+
+func (sm *StorageMinerAPI) WorkerTokenRevoke(ctx context.Context, nameOrID string) error {
+	_, err := sm.WorkerTokens.Revoke(nameOrID)
+	return err
+}
+
+func (sm *StorageMinerAPI) WorkerEnergy(ctx context.Context) (map[uint64]storiface.WorkerEnergy, error) {
+	return sm.StorageMgr.WorkerEnergy(ctx), nil
+}
+
+func (sm *StorageMinerAPI) WorkerBenchTransfer(ctx context.Context, worker uint64, sizes []uint64, pings int) ([]storiface.TransferBench, error) {
+	return sm.StorageMgr.BenchTransfer(ctx, worker, sizes, pings)
+}
+
+func (sm *StorageMinerAPI) OperationsList(ctx context.Context) ([]ops.Status, error) {
+	out := sm.Operations.List()
+	if sm.StorageMgr != nil {
+		out = append(out, sm.StorageMgr.Operations(ctx)...)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Started.Before(out[j].Started)
+	})
+	return out, nil
+}
+
+func (sm *StorageMinerAPI) OperationStatus(ctx context.Context, id string) (ops.Status, error) {
+	list, err := sm.OperationsList(ctx)
+	if err != nil {
+		return ops.Status{}, err
+	}
+	for _, st := range list {
+		if st.ID == id {
+			return st, nil
+		}
+	}
+	return ops.Status{}, xerrors.Errorf("operation %s not found", id)
+}
+
 func (sm *StorageMinerAPI) ActorAddress(context.Context) (address.Address, error) {
-	return sm.Miner.Address(), nil
+	return sm.SectorBlocks.Address(), nil
 }
 
 func (sm *StorageMinerAPI) MiningBase(ctx context.Context) (*types.TipSet, error) {
@@ -102,6 +336,92 @@ func (sm *StorageMinerAPI) MiningBase(ctx context.Context) (*types.TipSet, error
 	return mb.TipSet, nil
 }
 
+func (sm *StorageMinerAPI) ActorKeyChangePropose(ctx context.Context, newWorker address.Address, newControlAddrs []address.Address) (api.KeyChangeProposal, error) {
+	return sm.KeyChange.Propose(ctx, newWorker, newControlAddrs)
+}
+
+func (sm *StorageMinerAPI) ActorKeyChangeList(context.Context) ([]api.KeyChangeProposal, error) {
+	return sm.KeyChange.List(), nil
+}
+
+func (sm *StorageMinerAPI) ActorKeyChangeApprove(ctx context.Context, id uint64, approver address.Address, sig *crypto.Signature) (api.KeyChangeProposal, error) {
+	return sm.KeyChange.Approve(id, approver, sig)
+}
+
+func (sm *StorageMinerAPI) ActorKeyChangeCancel(ctx context.Context, id uint64) error {
+	return sm.KeyChange.Cancel(id)
+}
+
+func (sm *StorageMinerAPI) AlertRules(context.Context) ([]api.AlertRule, error) {
+	return sm.Alerts.Rules(), nil
+}
+
+func (sm *StorageMinerAPI) ActorSweep(ctx context.Context, dryRun bool) (api.SweepRecord, error) {
+	return sm.Sweeper.Sweep(ctx, dryRun)
+}
+
+func (sm *StorageMinerAPI) ActorSweepHistory(context.Context) ([]api.SweepRecord, error) {
+	return sm.Sweeper.History()
+}
+
+var errNoOutbox = xerrors.New("offline signing isn't enabled (Signing.Offline)")
+
+func (sm *StorageMinerAPI) OutboxList(context.Context) ([]api.OutboxMessage, error) {
+	if sm.Outbox == nil {
+		return nil, errNoOutbox
+	}
+	return sm.Outbox.List()
+}
+
+func (sm *StorageMinerAPI) OutboxSign(ctx context.Context, id uint64, sig crypto.Signature) (cid.Cid, error) {
+	if sm.Outbox == nil {
+		return cid.Undef, errNoOutbox
+	}
+	return sm.Outbox.Sign(ctx, id, sig)
+}
+
+func (sm *StorageMinerAPI) OutboxDrop(ctx context.Context, id uint64) error {
+	if sm.Outbox == nil {
+		return errNoOutbox
+	}
+	return sm.Outbox.Drop(ctx, id)
+}
+
+func (sm *StorageMinerAPI) CronJobs(context.Context) ([]api.CronJob, error) {
+	return sm.Cron.Jobs(), nil
+}
+
+func (sm *StorageMinerAPI) CronRun(ctx context.Context, job string) (api.CronRun, error) {
+	return sm.Cron.RunNow(ctx, job)
+}
+
+func (sm *StorageMinerAPI) CronHistory(ctx context.Context, job string) ([]api.CronRun, error) {
+	return sm.Cron.History(job)
+}
+
+func (sm *StorageMinerAPI) NodeConnectionStatus(ctx context.Context) ([]api.NodeEndpointStatus, error) {
+	if r, ok := sm.Full.(client.NodeStatusReporter); ok {
+		return r.NodeConnectionStatus(ctx)
+	}
+
+	// a single node, probe it now
+	st := api.NodeEndpointStatus{Name: "default"}
+	start := time.Now()
+	head, err := sm.Full.ChainHead(ctx)
+	st.Latency = time.Since(start)
+	if err != nil {
+		st.LastError = err.Error()
+	} else {
+		st.Healthy = true
+		st.Height = head.Height()
+	}
+	return []api.NodeEndpointStatus{st}, nil
+}
+
+func (sm *StorageMinerAPI) ActorKeyChangeExecute(ctx context.Context, id uint64) (cid.Cid, error) {
+	return sm.KeyChange.Execute(ctx, id)
+}
+
 func (sm *StorageMinerAPI) ActorSectorSize(ctx context.Context, addr address.Address) (abi.SectorSize, error) {
 	mi, err := sm.Full.StateMinerInfo(ctx, addr, types.EmptyTSK)
 	if err != nil {
@@ -114,6 +434,24 @@ func (sm *StorageMinerAPI) PledgeSector(ctx context.Context) error {
 	return sm.Miner.PledgeSector()
 }
 
+func (sm *StorageMinerAPI) PledgePause(ctx context.Context) error {
+	sm.Pledge.SetPaused(true)
+	return nil
+}
+
+func (sm *StorageMinerAPI) PledgeResume(ctx context.Context) error {
+	sm.Pledge.SetPaused(false)
+	return nil
+}
+
+func (sm *StorageMinerAPI) PledgeStatus(ctx context.Context) (dtypes.PledgeState, error) {
+	return sm.Pledge.State(), nil
+}
+
+func (sm *StorageMinerAPI) ProvingForceSubmit(ctx context.Context, dl uint64, maxFee abi.TokenAmount) ([]cid.Cid, error) {
+	return sm.Miner.ForceWindowPoSt(ctx, dl, maxFee)
+}
+
 func (sm *StorageMinerAPI) SectorsStatus(ctx context.Context, sid abi.SectorNumber, showOnChainInfo bool) (api.SectorInfo, error) {
 	info, err := sm.Miner.GetSectorInfo(sid)
 	if err != nil {
@@ -138,6 +476,11 @@ func (sm *StorageMinerAPI) SectorsStatus(ctx context.Context, sid abi.SectorNumb
 		}
 	}
 
+	sectorLabels, err := sm.Labels.Sector(sid)
+	if err != nil {
+		return api.SectorInfo{}, err
+	}
+
 	sInfo := api.SectorInfo{
 		SectorID: sid,
 		State:    api.SectorState(info.State),
@@ -157,6 +500,7 @@ func (sm *StorageMinerAPI) SectorsStatus(ctx context.Context, sid abi.SectorNumb
 		CommitMsg:    info.CommitMessage,
 		Retries:      info.InvalidProofs,
 		ToUpgrade:    sm.Miner.IsMarkedForUpgrade(sid),
+		Labels:       sectorLabels,
 
 		LastErr: info.LastErr,
 		Log:     log,
@@ -213,6 +557,41 @@ func (sm *StorageMinerAPI) SectorsList(context.Context) ([]abi.SectorNumber, err
 	return out, nil
 }
 
+func (sm *StorageMinerAPI) SectorsUpdates(ctx context.Context) (<-chan api.SectorUpdate, error) {
+	return sm.Miner.SectorUpdates(ctx), nil
+}
+
+func (sm *StorageMinerAPI) SectorsWebhooks(ctx context.Context) ([]api.SectorWebhookStatus, error) {
+	return sm.SectorHooks.Status(), nil
+}
+
+func (sm *StorageMinerAPI) SectorsWebhooksReplay(ctx context.Context, since time.Time, url string) (uint64, error) {
+	return sm.SectorHooks.Replay(since, url)
+}
+
+func (sm *StorageMinerAPI) AnalyticsGas(ctx context.Context, from, to time.Time) ([]api.GasReportDay, error) {
+	return sm.GasReport.Days(from, to)
+}
+
+func (sm *StorageMinerAPI) AnalyticsExpiredPreCommits(ctx context.Context) ([]api.ExpiredPreCommit, error) {
+	return sm.Miner.ExpiredPreCommits()
+}
+
+func (sm *StorageMinerAPI) SectorsSetLabels(ctx context.Context, sid abi.SectorNumber, l map[string]string) error {
+	if _, err := sm.Miner.GetSectorInfo(sid); err != nil {
+		return xerrors.Errorf("getting sector %d: %w", sid, err)
+	}
+	return sm.Labels.SetSector(sid, l)
+}
+
+func (sm *StorageMinerAPI) SectorsListLabels(ctx context.Context, selector map[string]string) ([]api.SectorLabels, error) {
+	return sm.Labels.Sectors(selector)
+}
+
+func (sm *StorageMinerAPI) SectorsQuery(ctx context.Context, q api.SectorQuery) (api.SectorQueryResult, error) {
+	return sm.SectorIndex.Query(ctx, q)
+}
+
 func (sm *StorageMinerAPI) StorageLocal(ctx context.Context) (map[stores.ID]string, error) {
 	return sm.StorageMgr.StorageLocal(ctx)
 }
@@ -280,21 +659,313 @@ func (sm *StorageMinerAPI) SectorMarkForUpgrade(ctx context.Context, id abi.Sect
 	return sm.Miner.MarkForUpgrade(id)
 }
 
+// maxUnsealRange limits the data returned by a single SectorUnsealRange call
+const maxUnsealRange = 32 << 20
+
+func (sm *StorageMinerAPI) SectorUnsealRange(ctx context.Context, id abi.SectorNumber, offset, length uint64) ([]byte, error) {
+	if length > maxUnsealRange {
+		return nil, xerrors.Errorf("range of %d bytes exceeds the limit of %d", length, maxUnsealRange)
+	}
+
+	si, err := sm.Miner.GetSectorInfo(id)
+	if err != nil {
+		return nil, xerrors.Errorf("getting sector info: %w", err)
+	}
+	if si.CommD == nil {
+		return nil, xerrors.Errorf("sector %d has no unsealed CID yet", id)
+	}
+
+	mid, err := address.IDFromAddress(sm.Miner.Address())
+	if err != nil {
+		return nil, err
+	}
+	sid := abi.SectorID{Miner: abi.ActorID(mid), Number: id}
+
+	var buf bytes.Buffer
+	if err := sm.StorageMgr.ReadRange(ctx, &buf, sid, offset, length, si.TicketValue, *si.CommD); err != nil {
+		return nil, xerrors.Errorf("reading sector %d range %d+%d: %w", id, offset, length, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (sm *StorageMinerAPI) SectorTrimCache(ctx context.Context, id abi.SectorNumber, level storiface.CacheTrimLevel) error {
+	return sm.Miner.TrimCache(ctx, id, level)
+}
+
+func (sm *StorageMinerAPI) SectorArchive(ctx context.Context, id abi.SectorNumber, removeLocal bool) error {
+	sid, err := sm.sectorID(id)
+	if err != nil {
+		return err
+	}
+
+	if removeLocal {
+		gone, err := sm.sectorGone(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !gone {
+			return xerrors.Errorf("sector %d isn't terminated or removed, removing its local copies would fault it", id)
+		}
+	}
+
+	return sm.StorageMgr.ArchiveSector(ctx, sid, removeLocal)
+}
+
+func (sm *StorageMinerAPI) SectorRecall(ctx context.Context, id abi.SectorNumber) (storiface.RecallStatus, error) {
+	sid, err := sm.sectorID(id)
+	if err != nil {
+		return storiface.RecallStatus{}, err
+	}
+	return sm.StorageMgr.RecallSector(ctx, sid)
+}
+
+func (sm *StorageMinerAPI) SectorArchiveList(ctx context.Context) ([]storiface.ArchivedSector, error) {
+	return sm.StorageMgr.ArchivedSectors(ctx)
+}
+
+func (sm *StorageMinerAPI) sectorID(id abi.SectorNumber) (abi.SectorID, error) {
+	mid, err := address.IDFromAddress(sm.Miner.Address())
+	if err != nil {
+		return abi.SectorID{}, err
+	}
+	return abi.SectorID{Miner: abi.ActorID(mid), Number: id}, nil
+}
+
+// sectorGone returns whether the miner doesn't have to prove the sector
+// anymore: it was removed, or it was proven and is terminated or expired on
+// chain
+func (sm *StorageMinerAPI) sectorGone(ctx context.Context, id abi.SectorNumber) (bool, error) {
+	info, err := sm.Miner.GetSectorInfo(id)
+	if err != nil {
+		return false, xerrors.Errorf("getting sector info: %w", err)
+	}
+
+	switch info.State {
+	case sealing.Removed:
+		return true, nil
+	case sealing.Proving, sealing.Faulty, sealing.FaultReported, sealing.FaultedFinal:
+	default:
+		return false, nil
+	}
+
+	head, err := sm.Full.ChainHead(ctx)
+	if err != nil {
+		return false, xerrors.Errorf("getting chain head: %w", err)
+	}
+	onChain, err := sm.Full.StateSectorGetInfo(ctx, sm.Miner.Address(), id, head.Key())
+	if err != nil {
+		return false, xerrors.Errorf("getting on-chain sector info: %w", err)
+	}
+	return onChain == nil || onChain.Expiration < head.Height(), nil
+}
+
+func (sm *StorageMinerAPI) SectorExternalAllocate(ctx context.Context) (abi.SectorID, error) {
+	mid, err := address.IDFromAddress(sm.Miner.Address())
+	if err != nil {
+		return abi.SectorID{}, err
+	}
+
+	num, err := sm.Miner.AllocateExternalSector(ctx)
+	if err != nil {
+		return abi.SectorID{}, err
+	}
+
+	return abi.SectorID{Miner: abi.ActorID(mid), Number: num}, nil
+}
+
+func (sm *StorageMinerAPI) SectorExternalAddPiece(ctx context.Context, id abi.SectorNumber, piece api.ExternalPiece) error {
+	p := sealing.Piece{Piece: piece.Piece}
+
+	if piece.DealID != 0 {
+		deal, err := sm.Full.StateMarketStorageDeal(ctx, piece.DealID, types.EmptyTSK)
+		if err != nil {
+			return xerrors.Errorf("getting deal %d: %w", piece.DealID, err)
+		}
+		if deal.Proposal.Provider != sm.Miner.Address() {
+			return xerrors.Errorf("deal %d is with provider %s", piece.DealID, deal.Proposal.Provider)
+		}
+		if !deal.Proposal.PieceCID.Equals(piece.Piece.PieceCID) || deal.Proposal.PieceSize != piece.Piece.Size {
+			return xerrors.Errorf("piece doesn't match the piece of deal %d", piece.DealID)
+		}
+
+		p.DealInfo = &sealing.DealInfo{
+			PublishCid: piece.PublishCid,
+			DealID:     piece.DealID,
+			DealSchedule: sealing.DealSchedule{
+				StartEpoch: deal.Proposal.StartEpoch,
+				EndEpoch:   deal.Proposal.EndEpoch,
+			},
+			KeepUnsealed: piece.KeepUnsealed,
+		}
+	}
+
+	return sm.Miner.ExternalAddPiece(ctx, id, p)
+}
+
+func (sm *StorageMinerAPI) SectorExternalSealed(ctx context.Context, id abi.SectorNumber, info api.ExternalSealedInfo) error {
+	mid, err := address.IDFromAddress(sm.Miner.Address())
+	if err != nil {
+		return err
+	}
+	sid := abi.SectorID{Miner: abi.ActorID(mid), Number: id}
+
+	// the miner computes the commit proof from the declared files
+	for _, ft := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		found, err := sm.StorageFindSector(ctx, sid, ft, 0, false)
+		if err != nil {
+			return xerrors.Errorf("finding %s files of sector %d: %w", ft, id, err)
+		}
+		if len(found) == 0 {
+			return xerrors.Errorf("no %s files of sector %d declared", ft, id)
+		}
+	}
+
+	return sm.Miner.ExternalSealed(ctx, id, sealing.ExternalSealedInfo{
+		TicketValue: info.TicketValue,
+		TicketEpoch: info.TicketEpoch,
+		CommR:       info.CommR,
+		CommD:       info.CommD,
+	})
+}
+
+func (sm *StorageMinerAPI) SectorExternalRelease(ctx context.Context, id abi.SectorNumber) error {
+	return sm.Miner.ReleaseExternalSector(ctx, id)
+}
+
+func (sm *StorageMinerAPI) SectorAddPieceToAny(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, deal api.PieceDealInfo) (api.SectorOffset, error) {
+	sn, offset, err := sm.Miner.AddPieceToAnySector(ctx, size, r, sealing.DealInfo{
+		PublishCid: deal.PublishCid,
+		DealID:     deal.DealID,
+		DealSchedule: sealing.DealSchedule{
+			StartEpoch: deal.StartEpoch,
+			EndEpoch:   deal.EndEpoch,
+		},
+		KeepUnsealed: deal.KeepUnsealed,
+	})
+	if err != nil {
+		return api.SectorOffset{}, err
+	}
+	return api.SectorOffset{Sector: sn, Offset: offset}, nil
+}
+
 func (sm *StorageMinerAPI) WorkerConnect(ctx context.Context, url string) error {
+	if sm.Workers != nil && sm.Workers.RequireApproval() {
+		return xerrors.New("workers need approval to connect, they have to register first (Workers.RequireApproval)")
+	}
+
+	_, err := sm.connectWorker(ctx, url)
+	return err
+}
+
+func (sm *StorageMinerAPI) WorkerConnectRegistered(ctx context.Context, id string) error {
+	if sm.Workers == nil {
+		return xerrors.New("worker registrations are only kept on the sealing miner")
+	}
+
+	reg, err := sm.Workers.Accepted(id)
+	if err != nil {
+		return err
+	}
+
+	w, err := sm.connectWorker(ctx, reg.URL)
+	if err != nil {
+		return err
+	}
+	sm.Workers.Track(id, w)
+	return nil
+}
+
+func (sm *StorageMinerAPI) connectWorker(ctx context.Context, url string) (*remoteWorker, error) {
 	w, err := connectRemoteWorker(ctx, sm, url)
 	if err != nil {
-		return xerrors.Errorf("connecting remote storage failed: %w", err)
+		return nil, xerrors.Errorf("connecting remote storage failed: %w", err)
 	}
 
 	log.Infof("Connected to a remote worker at %s", url)
 
-	return sm.StorageMgr.AddWorker(ctx, w)
+	if err := sm.StorageMgr.AddWorker(ctx, w); err != nil {
+		return nil, err
+	}
+	if id, ok := workertokens.IDFromContext(ctx); ok && sm.WorkerTokens != nil {
+		sm.WorkerTokens.Track(id, w)
+	}
+	return w, nil
+}
+
+func (sm *StorageMinerAPI) WorkerRegister(ctx context.Context, reg api.WorkerRegistration) (api.WorkerRegState, error) {
+	return sm.Workers.Register(reg)
+}
+
+func (sm *StorageMinerAPI) WorkerRegistrations(ctx context.Context) ([]api.WorkerRegistration, error) {
+	return sm.Workers.List()
+}
+
+func (sm *StorageMinerAPI) WorkerRegistrationAccept(ctx context.Context, id string) error {
+	return sm.Workers.Accept(id)
+}
+
+func (sm *StorageMinerAPI) WorkerRegistrationDeny(ctx context.Context, id string) error {
+	return sm.Workers.Deny(id)
+}
+
+func (sm *StorageMinerAPI) WorkerTaskAffinity(ctx context.Context) (api.WorkerTaskAffinity, error) {
+	return sm.WorkerTasks.Affinity(), nil
+}
+
+func (sm *StorageMinerAPI) WorkerTaskSet(ctx context.Context, hostname string, tasks []sealtasks.TaskType, enabled bool) error {
+	return sm.WorkerTasks.Set(hostname, tasks, enabled)
+}
+
+func (sm *StorageMinerAPI) WorkerTaskReset(ctx context.Context, hostname string, tasks []sealtasks.TaskType) error {
+	return sm.WorkerTasks.Reset(hostname, tasks)
 }
 
 func (sm *StorageMinerAPI) SealingSchedDiag(ctx context.Context) (interface{}, error) {
 	return sm.StorageMgr.SchedDiag(ctx)
 }
 
+func (sm *StorageMinerAPI) SealingSchedExplain(ctx context.Context, taskID uint64) (storiface.SchedExplanation, error) {
+	return sm.StorageMgr.SchedExplain(ctx, taskID)
+}
+
+func (sm *StorageMinerAPI) SealingDrain(ctx context.Context) error {
+	sm.StorageMgr.Drain()
+	return nil
+}
+
+func (sm *StorageMinerAPI) SealingTuneReport(ctx context.Context) (api.TuneReport, error) {
+	return sm.Tuner.Report()
+}
+
+func (sm *StorageMinerAPI) SealingTuneApply(ctx context.Context, changes []api.TuneSuggestion) error {
+	return sm.Tuner.Apply(changes)
+}
+
+func (sm *StorageMinerAPI) SealingTuning(ctx context.Context, hostname string) (map[string]string, error) {
+	return sm.Tuner.Tuning(hostname)
+}
+
+func (sm *StorageMinerAPI) ConfigReload(ctx context.Context) (api.ConfigReload, error) {
+	return sm.Reloader.Reload()
+}
+
+func (sm *StorageMinerAPI) SyncLag(ctx context.Context) (api.SyncLag, error) {
+	if sm.SyncGate == nil {
+		return api.SyncLag{}, xerrors.New("sync lag isn't tracked by this miner")
+	}
+	return sm.SyncGate.Check(ctx)
+}
+
+func (sm *StorageMinerAPI) SealingSchedSectorHistory(ctx context.Context, sector abi.SectorNumber) ([]storiface.SchedExplanation, error) {
+	mid, err := address.IDFromAddress(sm.Miner.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	return sm.StorageMgr.SchedSectorHistory(ctx, abi.SectorID{Miner: abi.ActorID(mid), Number: sector})
+}
+
 func (sm *StorageMinerAPI) MarketImportDealData(ctx context.Context, propCid cid.Cid, path string) error {
 	fi, err := os.Open(path)
 	if err != nil {
@@ -319,7 +990,7 @@ func (sm *StorageMinerAPI) listDeals(ctx context.Context) ([]api.MarketDeal, err
 	var out []api.MarketDeal
 
 	for _, deal := range allDeals {
-		if deal.Proposal.Provider == sm.Miner.Address() {
+		if deal.Proposal.Provider == sm.SectorBlocks.Address() {
 			out = append(out, deal)
 		}
 	}
@@ -342,6 +1013,13 @@ func (sm *StorageMinerAPI) MarketListRetrievalDeals(ctx context.Context) ([]retr
 	return out, nil
 }
 
+func (sm *StorageMinerAPI) MarketRetrievalStats(ctx context.Context) (api.RetrievalStats, error) {
+	if sm.RetrievalSched == nil {
+		return api.RetrievalStats{}, xerrors.New("retrieval market not running")
+	}
+	return sm.RetrievalSched.Stats(), nil
+}
+
 func (sm *StorageMinerAPI) MarketGetDealUpdates(ctx context.Context) (<-chan storagemarket.MinerDeal, error) {
 	results := make(chan storagemarket.MinerDeal)
 	unsub := sm.StorageProvider.SubscribeToEvents(func(evt storagemarket.ProviderEvent, deal storagemarket.MinerDeal) {
@@ -417,6 +1095,160 @@ func (sm *StorageMinerAPI) MarketDataTransferUpdates(ctx context.Context) (<-cha
 	return channels, nil
 }
 
+func (sm *StorageMinerAPI) MarketSetDealLabels(ctx context.Context, propCid cid.Cid, l map[string]string) error {
+	deals, err := sm.StorageProvider.ListLocalDeals()
+	if err != nil {
+		return xerrors.Errorf("listing deals: %w", err)
+	}
+
+	for _, deal := range deals {
+		if deal.ProposalCid.Equals(propCid) {
+			return sm.Labels.SetDeal(propCid, l)
+		}
+	}
+	return xerrors.Errorf("no deal with proposal %s", propCid)
+}
+
+func (sm *StorageMinerAPI) MarketListDealLabels(ctx context.Context, selector map[string]string) ([]api.DealLabels, error) {
+	return sm.Labels.Deals(selector)
+}
+
+func (sm *StorageMinerAPI) MarketInspectDeal(ctx context.Context, dealID abi.DealID, blocks bool) (*api.DealInspection, error) {
+	if dealID == 0 {
+		// deals get their ID when published
+		return nil, xerrors.New("invalid deal ID 0")
+	}
+
+	deals, err := sm.StorageProvider.ListLocalDeals()
+	if err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+
+	var deal *storagemarket.MinerDeal
+	for i := range deals {
+		if deals[i].DealID == dealID {
+			deal = &deals[i]
+			break
+		}
+	}
+	if deal == nil {
+		return nil, xerrors.Errorf("no local deal with ID %d", dealID)
+	}
+
+	out := &api.DealInspection{
+		DealID:      deal.DealID,
+		ProposalCid: deal.ProposalCid,
+		State:       storagemarket.DealStates[deal.State],
+		Message:     deal.Message,
+		Client:      deal.Proposal.Client,
+		StartEpoch:  deal.Proposal.StartEpoch,
+		EndEpoch:    deal.Proposal.EndEpoch,
+		PieceCID:    deal.Proposal.PieceCID,
+		PieceSize:   deal.Proposal.PieceSize,
+	}
+	if deal.Ref != nil {
+		out.PayloadRoot = deal.Ref.Root
+	}
+
+	if out.PayloadRoot.Defined() {
+		ci, err := sm.PieceStore.GetCIDInfo(out.PayloadRoot)
+		if err == nil {
+			for _, loc := range ci.PieceBlockLocations {
+				if loc.PieceCID.Equals(out.PieceCID) {
+					out.Indexed = true
+				}
+			}
+		}
+	}
+
+	if out.Indexed && blocks {
+		keys, err := sm.PieceStore.ListCidInfoKeys()
+		if err != nil {
+			return nil, xerrors.Errorf("listing block index: %w", err)
+		}
+		for _, k := range keys {
+			ci, err := sm.PieceStore.GetCIDInfo(k)
+			if err != nil {
+				return nil, xerrors.Errorf("getting block index entry %s: %w", k, err)
+			}
+			for _, loc := range ci.PieceBlockLocations {
+				if loc.PieceCID.Equals(out.PieceCID) {
+					out.Blocks = append(out.Blocks, api.DealBlock{Cid: k, Offset: loc.RelOffset, Size: loc.BlockSize})
+				}
+			}
+		}
+		sort.Slice(out.Blocks, func(i, j int) bool {
+			return out.Blocks[i].Offset < out.Blocks[j].Offset
+		})
+	}
+
+	mid, err := address.IDFromAddress(sm.SectorBlocks.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	proving := false
+	if pi, err := sm.PieceStore.GetPieceInfo(out.PieceCID); err == nil {
+		for _, d := range pi.Deals {
+			if d.DealID != dealID {
+				continue
+			}
+
+			p := api.DealPlacement{
+				Sector: d.SectorID,
+				Offset: d.Offset,
+				Length: d.Length,
+			}
+			if si, err := sm.SectorBlocks.GetSectorInfo(d.SectorID); err == nil {
+				p.State = api.SectorState(si.State)
+			}
+			// markets nodes don't index the sector storage of the sealer
+			if sm.Index != nil {
+				found, err := sm.StorageFindSector(ctx, abi.SectorID{Miner: abi.ActorID(mid), Number: d.SectorID}, stores.FTUnsealed, 0, false)
+				if err != nil {
+					return nil, xerrors.Errorf("finding unsealed copy of sector %d: %w", d.SectorID, err)
+				}
+				p.Unsealed = len(found) > 0
+			}
+
+			if p.State == api.SectorState(sealing.Proving) {
+				proving = true
+			}
+			out.Sectors = append(out.Sectors, p)
+		}
+	}
+
+	if deal.State != storagemarket.StorageDealActive {
+		out.RetrievalIssues = append(out.RetrievalIssues, fmt.Sprintf("deal is %s, not active", out.State))
+	}
+	if !deal.AvailableForRetrieval {
+		out.RetrievalIssues = append(out.RetrievalIssues, "deal piece not recorded for retrieval")
+	}
+	if len(out.Sectors) == 0 {
+		out.RetrievalIssues = append(out.RetrievalIssues, "piece not placed in a sector")
+	} else if !proving {
+		out.RetrievalIssues = append(out.RetrievalIssues, "no sector holding the piece is proving")
+	}
+	online, err := sm.ConsiderOnlineRetrievalDealsConfigFunc()
+	if err != nil {
+		return nil, xerrors.Errorf("getting retrieval deal config: %w", err)
+	}
+	if !online {
+		out.RetrievalIssues = append(out.RetrievalIssues, "online retrieval deals are disabled")
+	}
+	out.RetrievalReady = len(out.RetrievalIssues) == 0
+
+	return out, nil
+}
+
+func (sm *StorageMinerAPI) MarketDealPayments(ctx context.Context) (*api.DealPaymentReport, error) {
+	return sm.DealPayments.Report(ctx)
+}
+
+func (sm *StorageMinerAPI) MarketDealPaymentHistory(ctx context.Context) ([]api.DealPaymentReport, error) {
+	return sm.DealPayments.History()
+}
+
 func (sm *StorageMinerAPI) DealsList(ctx context.Context) ([]api.MarketDeal, error) {
 	return sm.listDeals(ctx)
 }
@@ -475,6 +1307,18 @@ func (sm *StorageMinerAPI) DealsImportData(ctx context.Context, deal cid.Cid, fn
 	return sm.StorageProvider.ImportDataForDeal(ctx, deal, fi)
 }
 
+func (sm *StorageMinerAPI) DealsIntakeEnqueue(ctx context.Context, proposal market.ClientDealProposal, fname string, callbackURL string) (cid.Cid, error) {
+	return sm.DealIntake.Enqueue(ctx, proposal, fname, callbackURL)
+}
+
+func (sm *StorageMinerAPI) DealsIntakeList(ctx context.Context) ([]api.DealIntake, error) {
+	return sm.DealIntake.List(), nil
+}
+
+func (sm *StorageMinerAPI) DealsIntakeGet(ctx context.Context, proposalCid cid.Cid) (api.DealIntake, error) {
+	return sm.DealIntake.Get(proposalCid)
+}
+
 func (sm *StorageMinerAPI) DealsPieceCidBlocklist(ctx context.Context) ([]cid.Cid, error) {
 	return sm.StorageDealPieceCidBlocklistConfigFunc()
 }
@@ -516,4 +1360,56 @@ func (sm *StorageMinerAPI) PiecesGetCIDInfo(ctx context.Context, payloadCid cid.
 	return &ci, nil
 }
 
+func (sm *StorageMinerAPI) PiecesBuildIndex(ctx context.Context, sector abi.SectorNumber) ([]api.PieceIndex, error) {
+	si, err := sm.Miner.GetSectorInfo(sector)
+	if err != nil {
+		return nil, xerrors.Errorf("getting sector info: %w", err)
+	}
+	if si.CommD == nil {
+		return nil, xerrors.Errorf("sector %d has no unsealed CID yet", sector)
+	}
+
+	mid, err := address.IDFromAddress(sm.Miner.Address())
+	if err != nil {
+		return nil, err
+	}
+	sid := abi.SectorID{Miner: abi.ActorID(mid), Number: sector}
+
+	out := []api.PieceIndex{}
+	var offset abi.PaddedPieceSize
+	for _, p := range si.Pieces {
+		pieceOffset, pieceSize := offset, p.Piece.Size
+		offset += p.Piece.Size
+		if p.DealInfo == nil {
+			continue
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			_ = pw.CloseWithError(sm.StorageMgr.ReadPiece(ctx, pw, sid, storiface.UnpaddedByteIndex(pieceOffset.Unpadded()), pieceSize.Unpadded(), si.TicketValue, *si.CommD))
+		}()
+		idx, err := carindex.Build(pr)
+		_ = pr.Close() // the padding isn't read
+		if err != nil {
+			return nil, xerrors.Errorf("indexing piece of deal %d: %w", p.DealInfo.DealID, err)
+		}
+
+		if err := sm.CarIndexes.Put(sector, pieceOffset.Unpadded(), p.DealInfo.DealID, idx); err != nil {
+			return nil, xerrors.Errorf("storing index of deal %d: %w", p.DealInfo.DealID, err)
+		}
+
+		out = append(out, api.PieceIndex{
+			Deal:        p.DealInfo.DealID,
+			PieceOffset: pieceOffset.Unpadded(),
+			Blocks:      len(idx.Entries),
+		})
+	}
+
+	return out, nil
+}
+
+func (sm *StorageMinerAPI) PiecesLocateBlock(ctx context.Context, sector abi.SectorNumber, block cid.Cid) (api.SectorBlockLocation, error) {
+	return sm.CarIndexes.Locate(sector, block)
+}
+
 var _ api.StorageMiner = &StorageMinerAPI{}
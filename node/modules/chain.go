@@ -168,6 +168,14 @@ func NetworkName(mctx helpers.MetricsCtx, lc fx.Lifecycle, cs *store.ChainStore,
 	return netName, err
 }
 
+func GenesisCid(cs *store.ChainStore, _ dtypes.AfterGenesisSet) (dtypes.GenesisCid, error) {
+	gen, err := cs.GetGenesis()
+	if err != nil {
+		return dtypes.GenesisCid{}, xerrors.Errorf("getting genesis block: %w", err)
+	}
+	return dtypes.GenesisCid(gen.Cid()), nil
+}
+
 type SyncerParams struct {
 	fx.In
 
@@ -26,14 +26,26 @@ import (
 	"github.com/ipfs/go-datastore/namespace"
 	"github.com/libp2p/go-libp2p-core/host"
 
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/chain/market"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
 	"github.com/filecoin-project/lotus/journal"
+	"github.com/filecoin-project/lotus/lib/approval"
 	"github.com/filecoin-project/lotus/lib/blockstore"
+	"github.com/filecoin-project/lotus/lib/commp"
 	"github.com/filecoin-project/lotus/markets"
 	marketevents "github.com/filecoin-project/lotus/markets/loggers"
 	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/impl/full"
 	payapi "github.com/filecoin-project/lotus/node/impl/paych"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/modules/helpers"
 	"github.com/filecoin-project/lotus/node/repo"
 	"github.com/filecoin-project/lotus/node/repo/importmgr"
 	"github.com/filecoin-project/lotus/node/repo/retrievalstoremgr"
@@ -165,3 +177,110 @@ func ClientRetrievalStoreManager(imgr dtypes.ClientImportMgr) dtypes.ClientRetri
 func ClientBlockstoreRetrievalStoreManager(bs dtypes.ClientBlockstore) dtypes.ClientRetrievalStoreManager {
 	return retrievalstoremgr.NewBlockstoreRetrievalStoreManager(bs)
 }
+
+// MarketEscrowManager applies the market escrow policies from the config
+func MarketEscrowManager(cfg config.MarketFunds) func(lc fx.Lifecycle, mctx helpers.MetricsCtx, api market.API, fm *market.FundMgr) (*market.EscrowManager, error) {
+	return func(lc fx.Lifecycle, mctx helpers.MetricsCtx, api market.API, fm *market.FundMgr) (*market.EscrowManager, error) {
+		var policies []market.EscrowPolicy
+		for _, p := range cfg.Escrow {
+			addr, err := address.NewFromString(p.Address)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing escrow policy address: %w", err)
+			}
+			wallet, err := address.NewFromString(p.Wallet)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing escrow policy wallet for %s: %w", p.Address, err)
+			}
+
+			policies = append(policies, market.EscrowPolicy{
+				Address:      addr,
+				Wallet:       wallet,
+				MinAvailable: filOrZero(p.MinAvailable),
+				TopUpTo:      filOrZero(p.TopUpTo),
+				MaxAvailable: filOrZero(p.MaxAvailable),
+			})
+		}
+
+		interval := time.Duration(cfg.CheckInterval)
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+
+		em, err := market.NewEscrowManager(&api, fm, policies, interval)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go em.Run(ctx)
+				return nil
+			},
+			OnStop: em.Stop,
+		})
+
+		return em, nil
+	}
+}
+
+// ApprovalQueue holds large messages pushed through the API for approval
+func ApprovalQueue(cfg config.ApprovalsConfig) func(w *wallet.Wallet, sm *stmgr.StateManager) (*approval.Queue, error) {
+	return func(w *wallet.Wallet, sm *stmgr.StateManager) (*approval.Queue, error) {
+		threshold := filOrZero(cfg.Threshold)
+
+		var approvers []address.Address
+		for _, a := range cfg.Approvers {
+			addr, err := address.NewFromString(a)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing approver: %w", err)
+			}
+			if addr.Protocol() != address.SECP256K1 && addr.Protocol() != address.BLS {
+				return nil, xerrors.Errorf("approver %s must be a key address", addr)
+			}
+			has, err := w.HasKey(addr)
+			if err != nil {
+				return nil, xerrors.Errorf("checking wallet for approver key: %w", err)
+			}
+			if has {
+				return nil, xerrors.Errorf("approver %s has its key in this node's wallet", addr)
+			}
+			approvers = append(approvers, addr)
+		}
+		if !threshold.IsZero() && len(approvers) == 0 {
+			return nil, xerrors.New("Approvals.Threshold is set but no Approvals.Approvers are configured")
+		}
+
+		timeout := time.Duration(cfg.Timeout)
+		if timeout <= 0 {
+			timeout = time.Hour
+		}
+		return approval.NewQueue(threshold, timeout, approvers, func(ctx context.Context, addr address.Address) (*types.Actor, error) {
+			return sm.LoadActor(ctx, addr, nil)
+		}), nil
+	}
+}
+
+// CommPCalc calculates piece commitments of client files in the background
+func CommPCalc(cfg config.Client) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS) *commp.Calc {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS) *commp.Calc {
+		c := commp.New(ds, cfg.CommPWorkers)
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				c.Run(ctx)
+				return nil
+			},
+		})
+
+		return c
+	}
+}
+
+func filOrZero(f types.FIL) abi.TokenAmount {
+	if f.Int == nil {
+		return big.Zero()
+	}
+	return abi.TokenAmount(f)
+}
@@ -1,4 +1,9 @@
 package dtypes
 
+import "github.com/ipfs/go-cid"
+
 type NetworkName string
 type AfterGenesisSet struct{}
+
+// GenesisCid is the cid of the genesis block of the chain the node is on
+type GenesisCid cid.Cid
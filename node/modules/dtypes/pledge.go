@@ -0,0 +1,86 @@
+package dtypes
+
+import (
+	"sync"
+	"time"
+)
+
+// PledgeControl is shared between the auto-pledge loop of
+// 'lotus-miner run --pledge-sector' and the API, which can pause it
+type PledgeControl struct {
+	lk  sync.Mutex
+	st  PledgeState
+	cfg PledgeSettings
+}
+
+// PledgeSettings are the interval and limits of the pledge loop, they can
+// change while it runs when the config is reloaded
+type PledgeSettings struct {
+	Interval time.Duration
+	// MaxSectors and MinFree cap the capacity the loop commits, zero values
+	// are no limit
+	MaxSectors uint64
+	MinFree    int64
+	// ReserveWorkers is the number of idle workers left for deals
+	ReserveWorkers int
+}
+
+type PledgeState struct {
+	// Running is set while the pledge loop runs
+	Running bool
+	Paused  bool
+
+	LastPledge time.Time
+	// LastSkip is why the loop last decided not to pledge when a worker was
+	// idle, e.g. a capacity limit
+	LastSkip string
+}
+
+func (pc *PledgeControl) SetRunning(running bool) {
+	pc.lk.Lock()
+	pc.st.Running = running
+	pc.lk.Unlock()
+}
+
+func (pc *PledgeControl) SetPaused(paused bool) {
+	pc.lk.Lock()
+	pc.st.Paused = paused
+	pc.lk.Unlock()
+}
+
+func (pc *PledgeControl) Paused() bool {
+	pc.lk.Lock()
+	defer pc.lk.Unlock()
+	return pc.st.Paused
+}
+
+func (pc *PledgeControl) Pledged() {
+	pc.lk.Lock()
+	pc.st.LastPledge = time.Now()
+	pc.st.LastSkip = ""
+	pc.lk.Unlock()
+}
+
+func (pc *PledgeControl) Skipped(reason string) {
+	pc.lk.Lock()
+	pc.st.LastSkip = reason
+	pc.lk.Unlock()
+}
+
+func (pc *PledgeControl) State() PledgeState {
+	pc.lk.Lock()
+	defer pc.lk.Unlock()
+	return pc.st
+}
+
+func (pc *PledgeControl) SetSettings(cfg PledgeSettings) {
+	pc.lk.Lock()
+	pc.cfg = cfg
+	pc.lk.Unlock()
+}
+
+func (pc *PledgeControl) Settings() PledgeSettings {
+	pc.lk.Lock()
+	defer pc.lk.Unlock()
+	return pc.cfg
+}
@@ -108,6 +108,9 @@ func NilRouting(mctx helpers.MetricsCtx) (BaseIpfsRouting, error) {
 	return nilrouting.ConstructNilRouting(mctx, nil, nil, nil)
 }
 
-func RoutedHost(rh RawHost, r BaseIpfsRouting) host.Host {
-	return routedhost.Wrap(rh, r)
+func RoutedHost(rh RawHost, r BaseIpfsRouting, sl *StreamLimiter) host.Host {
+	return &limitedHost{
+		Host: routedhost.Wrap(rh, r),
+		sl:   sl,
+	}
 }
@@ -1,7 +1,12 @@
 package lp2p
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
 )
 
 /*import (
@@ -37,4 +42,50 @@ func AutoNATService(quic bool) func(repo repo.Repo, mctx helpers.MetricsCtx, lc
 
 var AutoNATService = simpleOpt(libp2p.EnableNATService())
 
-var NatPortMap = simpleOpt(libp2p.NATPortMap())
+// NatMappings keeps the NAT manager of the host, so port mappings created
+// with UPnP / NAT-PMP can be listed
+type NatMappings struct {
+	lk  sync.Mutex
+	mgr basichost.NATManager
+}
+
+func NewNatMappings() *NatMappings {
+	return &NatMappings{}
+}
+
+// Mappings lists active port mappings as 'proto internal-port -> external-addr'.
+// Nil means port mapping is disabled, or no NAT device was found yet.
+func (nm *NatMappings) Mappings() []string {
+	nm.lk.Lock()
+	mgr := nm.mgr
+	nm.lk.Unlock()
+
+	if mgr == nil || mgr.NAT() == nil {
+		return nil
+	}
+
+	var out []string
+	for _, m := range mgr.NAT().Mappings() {
+		ext, err := m.ExternalAddr()
+		if err != nil {
+			// the mapping isn't established yet
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s %d -> %s", m.Protocol(), m.InternalPort(), ext))
+	}
+	return out
+}
+
+// NatPortMap maps listen ports on the router with UPnP / NAT-PMP
+func NatPortMap(nm *NatMappings) (opts Libp2pOpts, err error) {
+	opts.Opts = append(opts.Opts, libp2p.NATManager(func(n network.Network) basichost.NATManager {
+		mgr := basichost.NewNATManager(n)
+
+		nm.lk.Lock()
+		nm.mgr = mgr
+		nm.lk.Unlock()
+
+		return mgr
+	}))
+	return
+}
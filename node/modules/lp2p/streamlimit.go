@@ -0,0 +1,143 @@
+package lp2p
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+// StreamStat is the usage of a single stream limit
+type StreamStat struct {
+	Protocol   string
+	MaxInbound int
+	Active     int
+	Rejected   uint64
+}
+
+type streamCounter struct {
+	limit    config.StreamLimit
+	active   int
+	rejected uint64
+}
+
+// StreamLimiter tracks inbound streams per protocol. Streams over the limit
+// are reset before the handler runs, so a flood of market or sync requests
+// can't exhaust file descriptors.
+type StreamLimiter struct {
+	lk       sync.Mutex
+	counters []*streamCounter
+}
+
+func NewStreamLimiter(limits []config.StreamLimit) *StreamLimiter {
+	sl := &StreamLimiter{}
+	for _, l := range limits {
+		sl.counters = append(sl.counters, &streamCounter{limit: l})
+	}
+
+	// longest prefix first, so the most specific limit applies
+	sort.SliceStable(sl.counters, func(i, j int) bool {
+		return len(sl.counters[i].limit.Protocol) > len(sl.counters[j].limit.Protocol)
+	})
+
+	return sl
+}
+
+func StreamLimits(limits []config.StreamLimit) func() *StreamLimiter {
+	return func() *StreamLimiter {
+		return NewStreamLimiter(limits)
+	}
+}
+
+func (sl *StreamLimiter) counter(p protocol.ID) *streamCounter {
+	for _, c := range sl.counters {
+		if strings.HasPrefix(string(p), c.limit.Protocol) {
+			return c
+		}
+	}
+	return nil
+}
+
+// acquire reserves a stream slot for the protocol, returning false when the
+// limit is reached
+func (sl *StreamLimiter) acquire(p protocol.ID) bool {
+	sl.lk.Lock()
+	defer sl.lk.Unlock()
+
+	c := sl.counter(p)
+	if c == nil {
+		return true
+	}
+	if c.limit.MaxInbound > 0 && c.active >= c.limit.MaxInbound {
+		c.rejected++
+		return false
+	}
+	c.active++
+	return true
+}
+
+func (sl *StreamLimiter) release(p protocol.ID) {
+	sl.lk.Lock()
+	defer sl.lk.Unlock()
+
+	if c := sl.counter(p); c != nil {
+		c.active--
+	}
+}
+
+func (sl *StreamLimiter) wrap(pid protocol.ID, handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		p := s.Protocol()
+		if p == "" {
+			p = pid
+		}
+
+		if !sl.acquire(p) {
+			log.Debugw("inbound stream limit reached", "protocol", p, "peer", s.Conn().RemotePeer())
+			_ = s.Reset()
+			return
+		}
+		defer sl.release(p)
+
+		handler(s)
+	}
+}
+
+// Stats returns the usage of every configured limit
+func (sl *StreamLimiter) Stats() []StreamStat {
+	sl.lk.Lock()
+	defer sl.lk.Unlock()
+
+	out := make([]StreamStat, len(sl.counters))
+	for i, c := range sl.counters {
+		out[i] = StreamStat{
+			Protocol:   c.limit.Protocol,
+			MaxInbound: c.limit.MaxInbound,
+			Active:     c.active,
+			Rejected:   c.rejected,
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Protocol < out[j].Protocol
+	})
+	return out
+}
+
+// limitedHost applies the stream limiter to every registered handler
+type limitedHost struct {
+	host.Host
+	sl *StreamLimiter
+}
+
+func (h *limitedHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.Host.SetStreamHandler(pid, h.sl.wrap(pid, handler))
+}
+
+func (h *limitedHost) SetStreamHandlerMatch(pid protocol.ID, m func(string) bool, handler network.StreamHandler) {
+	h.Host.SetStreamHandlerMatch(pid, m, h.sl.wrap(pid, handler))
+}
@@ -2,6 +2,8 @@ package modules
 
 import (
 	"context"
+	"path/filepath"
+	"time"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
@@ -25,7 +27,11 @@ import (
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/sub"
 	"github.com/filecoin-project/lotus/journal"
+	"github.com/filecoin-project/lotus/lib/crash"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/profiles"
+	"github.com/filecoin-project/lotus/lib/watchdog"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/hello"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
@@ -73,6 +79,16 @@ func RunPeerMgr(mctx helpers.MetricsCtx, lc fx.Lifecycle, pmgr *peermgr.PeerMgr)
 	go pmgr.Run(helpers.LifecycleCtx(mctx, lc))
 }
 
+func RunPeerExchange(mctx helpers.MetricsCtx, lc fx.Lifecycle, pex *peermgr.PeerExchange) {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go crash.Run(ctx, "peer-exchange", pex.Run)
+			return nil
+		},
+	})
+}
+
 func RunChainExchange(h host.Host, svc exchange.Server) {
 	h.SetStreamHandler(exchange.BlockSyncProtocolID, svc.HandleStream)     // old
 	h.SetStreamHandler(exchange.ChainExchangeProtocolID, svc.HandleStream) // new
@@ -167,3 +183,56 @@ func OpenFilesystemJournal(lr repo.LockedRepo, lc fx.Lifecycle, disabled journal
 
 	return jrnl, err
 }
+
+func ProfileCapturer(cfg config.Profiling) func(lr repo.LockedRepo, lc fx.Lifecycle) (*profiles.Capturer, error) {
+	return func(lr repo.LockedRepo, lc fx.Lifecycle) (*profiles.Capturer, error) {
+		c, err := profiles.NewCapturer(filepath.Join(lr.Path(), "profiles"),
+			time.Duration(cfg.Interval), time.Duration(cfg.CPUDuration), time.Duration(cfg.Retention))
+		if err != nil {
+			return nil, err
+		}
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go c.Run()
+				return nil
+			},
+			OnStop: c.Stop,
+		})
+
+		return c, nil
+	}
+}
+
+func RunWatchdog(cfg config.Watchdog) func(mctx helpers.MetricsCtx, lr repo.LockedRepo, lc fx.Lifecycle) error {
+	return func(mctx helpers.MetricsCtx, lr repo.LockedRepo, lc fx.Lifecycle) error {
+		wd, err := watchdog.New(filepath.Join(lr.Path(), "watchdog"), time.Duration(cfg.CheckInterval), cfg.RestartStuck)
+		if err != nil {
+			return err
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "watchdog", func(ctx context.Context) error {
+					wd.Run(ctx)
+					return nil
+				})
+				return nil
+			},
+		})
+
+		return nil
+	}
+}
+
+func SetupCrashReports(cfg config.Recovery) func(lr repo.LockedRepo) error {
+	return func(lr repo.LockedRepo) error {
+		return crash.Configure(crash.Config{
+			Dir:        filepath.Join(lr.Path(), "crash"),
+			Restart:    cfg.RestartOnPanic,
+			MaxBackoff: time.Duration(cfg.MaxBackoff),
+			Keep:       cfg.KeepBundles,
+		})
+	}
+}
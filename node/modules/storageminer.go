@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"go.uber.org/fx"
@@ -23,6 +26,7 @@ import (
 	"github.com/ipfs/go-merkledag"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/mitchellh/go-homedir"
 
 	"github.com/filecoin-project/go-address"
 	dtimpl "github.com/filecoin-project/go-data-transfer/impl"
@@ -45,27 +49,53 @@ import (
 	"github.com/filecoin-project/go-storedcounter"
 
 	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/extern/sector-storage/archive"
 	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
 	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
 	"github.com/filecoin-project/lotus/extern/storage-sealing/sealiface"
 	"github.com/filecoin-project/lotus/journal"
 	"github.com/filecoin-project/lotus/markets"
+	"github.com/filecoin-project/lotus/markets/dealguard"
+	"github.com/filecoin-project/lotus/markets/dealintake"
+	"github.com/filecoin-project/lotus/markets/dealpay"
+	"github.com/filecoin-project/lotus/markets/dealtransfer"
 
 	lapi "github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/gen"
 	"github.com/filecoin-project/lotus/chain/gen/slashfilter"
+	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/lib/blockstore"
+	"github.com/filecoin-project/lotus/lib/checkpoint"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/lib/ops"
 	marketevents "github.com/filecoin-project/lotus/markets/loggers"
 	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/markets/retrievalsched"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
+	"github.com/filecoin-project/lotus/node/reload"
 	"github.com/filecoin-project/lotus/node/repo"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/alerts"
+	"github.com/filecoin-project/lotus/storage/autotune"
+	"github.com/filecoin-project/lotus/storage/cron"
+	"github.com/filecoin-project/lotus/storage/gasreport"
+	"github.com/filecoin-project/lotus/storage/keychange"
+	"github.com/filecoin-project/lotus/storage/labels"
+	"github.com/filecoin-project/lotus/storage/outbox"
+	"github.com/filecoin-project/lotus/storage/sealmetrics"
+	"github.com/filecoin-project/lotus/storage/sectorblocks"
+	"github.com/filecoin-project/lotus/storage/sectorhooks"
+	"github.com/filecoin-project/lotus/storage/sectorindex"
+	"github.com/filecoin-project/lotus/storage/sweep"
+	"github.com/filecoin-project/lotus/storage/workerreg"
+	"github.com/filecoin-project/lotus/storage/workertasks"
 )
 
 var StorageCounterDSPrefix = "/storage/nextid"
@@ -115,6 +145,14 @@ func StorageNetworkName(ctx helpers.MetricsCtx, a lapi.FullNode) (dtypes.Network
 	return a.StateNetworkName(ctx)
 }
 
+func StorageGenesisCid(ctx helpers.MetricsCtx, a lapi.FullNode) (dtypes.GenesisCid, error) {
+	gen, err := a.ChainGetGenesis(ctx)
+	if err != nil {
+		return dtypes.GenesisCid{}, xerrors.Errorf("getting genesis from full node: %w", err)
+	}
+	return dtypes.GenesisCid(gen.Cids()[0]), nil
+}
+
 func ProofsConfig(maddr dtypes.MinerAddress, fnapi lapi.FullNode) (*ffiwrapper.Config, error) {
 	mi, err := fnapi.StateMinerInfo(context.TODO(), address.Address(maddr), types.EmptyTSK)
 	if err != nil {
@@ -159,9 +197,20 @@ type StorageMinerParams struct {
 	SectorIDCounter    sealing.SectorIDCounter
 	Verifier           ffiwrapper.Verifier
 	GetSealingConfigFn dtypes.GetSealingConfigFunc
+	Checkpoints        *checkpoint.Checkpointer
+}
+
+func StorageMiner(fc config.MinerFeeConfig, pc config.ProvingConfig) func(params StorageMinerParams) (*storage.Miner, error) {
+	return storageMiner(fc, pc, false)
 }
 
-func StorageMiner(fc config.MinerFeeConfig) func(params StorageMinerParams) (*storage.Miner, error) {
+// ArchivalStorageMiner constructs a miner which only runs WindowPoSt for
+// existing sectors, see config.ProvingConfig.ArchivalMode
+func ArchivalStorageMiner(fc config.MinerFeeConfig, pc config.ProvingConfig) func(params StorageMinerParams) (*storage.Miner, error) {
+	return storageMiner(fc, pc, true)
+}
+
+func storageMiner(fc config.MinerFeeConfig, pc config.ProvingConfig, archival bool) func(params StorageMinerParams) (*storage.Miner, error) {
 	return func(params StorageMinerParams) (*storage.Miner, error) {
 		var (
 			ds     = params.MetadataDS
@@ -173,6 +222,7 @@ func StorageMiner(fc config.MinerFeeConfig) func(params StorageMinerParams) (*st
 			sc     = params.SectorIDCounter
 			verif  = params.Verifier
 			gsd    = params.GetSealingConfigFn
+			cp     = params.Checkpoints
 		)
 
 		maddr, err := minerAddrFromDS(ds)
@@ -192,12 +242,12 @@ func StorageMiner(fc config.MinerFeeConfig) func(params StorageMinerParams) (*st
 			return nil, err
 		}
 
-		fps, err := storage.NewWindowedPoStScheduler(api, fc, sealer, sealer, maddr, worker)
+		fps, err := storage.NewWindowedPoStScheduler(api, fc, pc, sealer, verif, sealer, maddr, worker)
 		if err != nil {
 			return nil, err
 		}
 
-		sm, err := storage.NewMiner(api, maddr, worker, h, ds, sealer, sc, verif, gsd, fc)
+		sm, err := storage.NewMiner(api, maddr, worker, h, ds, sealer, sc, verif, gsd, fc, cp, fps)
 		if err != nil {
 			return nil, err
 		}
@@ -205,6 +255,9 @@ func StorageMiner(fc config.MinerFeeConfig) func(params StorageMinerParams) (*st
 		lc.Append(fx.Hook{
 			OnStart: func(context.Context) error {
 				go fps.Run(ctx)
+				if archival {
+					return sm.RunArchival(ctx)
+				}
 				return sm.Run(ctx)
 			},
 			OnStop: sm.Stop,
@@ -248,6 +301,133 @@ func HandleDeals(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, h sto
 	})
 }
 
+// HandleDealTransfers answers transfer protocol queries of clients, and
+// accepts pushed deal data with the enabled push protocols
+func HandleDealTransfers(cfg config.DealTransfersConfig) func(lc fx.Lifecycle, h host.Host, sp storagemarket.StorageProvider, onlineOk dtypes.ConsiderOnlineStorageDealsConfigFunc) error {
+	return func(lc fx.Lifecycle, h host.Host, sp storagemarket.StorageProvider, onlineOk dtypes.ConsiderOnlineStorageDealsConfigFunc) error {
+		p, err := dealtransfer.NewProvider(h, sp, dealtransfer.Config{
+			HTTP:       cfg.HTTP,
+			HTTPListen: cfg.HTTPListenAddress,
+			HTTPURL:    cfg.HTTPURL,
+			Libp2pHTTP: cfg.Libp2pHTTP,
+		}, onlineOk)
+		if err != nil {
+			return err
+		}
+
+		lc.Append(fx.Hook{
+			OnStart: p.Start,
+			OnStop:  p.Stop,
+		})
+		return nil
+	}
+}
+
+// MarketOperations is the registry of data transfer operations, sealing
+// operations are tracked by the workers running them
+func MarketOperations() *ops.Registry {
+	return ops.NewRegistry("market/")
+}
+
+// TrackTransferOperations reports market data transfers in the operations
+// registry
+func TrackTransferOperations(lc fx.Lifecycle, h host.Host, dt dtypes.ProviderDataTransfer, sp storagemarket.StorageProvider, reg *ops.Registry) {
+	to := markets.NewTransferOperations(h.ID(), reg)
+
+	var unsubs []func()
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			unsubs = append(unsubs, sp.SubscribeToEvents(to.OnStorageEvent), dt.SubscribeToEvents(to.OnTransferEvent))
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			for _, unsub := range unsubs {
+				unsub()
+			}
+			return nil
+		},
+	})
+}
+
+func DealIntake(lc fx.Lifecycle, ds dtypes.MetadataDS, h storagemarket.StorageProvider, maddr dtypes.MinerAddress) *dealintake.Intake {
+	in := dealintake.New(ds, h, maddr)
+
+	lc.Append(fx.Hook{
+		OnStart: in.Start,
+		OnStop:  in.Stop,
+	})
+
+	return in
+}
+
+func DealPaymentTracker(lc fx.Lifecycle, ds dtypes.MetadataDS, full lapi.FullNode, h storagemarket.StorageProvider, maddr dtypes.MinerAddress) *dealpay.Tracker {
+	t := dealpay.NewTracker(ds, full, h, address.Address(maddr))
+
+	lc.Append(fx.Hook{
+		OnStart: t.Start,
+		OnStop:  t.Stop,
+	})
+
+	return t
+}
+
+func KeyChangeManager(cfg config.KeyChangeConfig) func(lc fx.Lifecycle, ds dtypes.MetadataDS, maddr dtypes.MinerAddress, api lapi.FullNode) (*keychange.Manager, error) {
+	return func(lc fx.Lifecycle, ds dtypes.MetadataDS, maddr dtypes.MinerAddress, api lapi.FullNode) (*keychange.Manager, error) {
+		var approvers []address.Address
+		for _, a := range cfg.Approvers {
+			addr, err := address.NewFromString(a)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing key change approver: %w", err)
+			}
+			if addr.Protocol() != address.SECP256K1 && addr.Protocol() != address.BLS {
+				return nil, xerrors.Errorf("key change approver %s must be a key address", addr)
+			}
+			approvers = append(approvers, addr)
+		}
+
+		m := keychange.NewManager(api, ds, address.Address(maddr), time.Duration(cfg.Timelock), approvers)
+		lc.Append(fx.Hook{
+			OnStart: m.Start,
+		})
+
+		return m, nil
+	}
+}
+
+func RewardSweeper(cfg config.SweepConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, maddr dtypes.MinerAddress, api lapi.FullNode) (*sweep.Sweeper, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, maddr dtypes.MinerAddress, api lapi.FullNode) (*sweep.Sweeper, error) {
+		scfg := sweep.Config{
+			Interval:    time.Duration(cfg.Interval),
+			MinerFloat:  abi.TokenAmount(cfg.MinerFloat),
+			OwnerFloat:  abi.TokenAmount(cfg.OwnerFloat),
+			WorkerFloat: abi.TokenAmount(cfg.WorkerFloat),
+			MinAmount:   abi.TokenAmount(cfg.MinAmount),
+			MaxFee:      abi.TokenAmount(cfg.MaxFee),
+			DryRun:      cfg.DryRun,
+			Hook:        cfg.ApprovalHook,
+		}
+		if cfg.ColdAddress != "" {
+			cold, err := address.NewFromString(cfg.ColdAddress)
+			if err != nil {
+				return nil, xerrors.Errorf("parsing sweep cold address: %w", err)
+			}
+			scfg.Cold = cold
+		}
+
+		s := sweep.NewSweeper(api, ds, address.Address(maddr), scfg)
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "reward-sweep", s.Run)
+				return nil
+			},
+		})
+
+		return s, nil
+	}
+}
+
 // NewProviderDAGServiceDataTransfer returns a data transfer manager that just
 // uses the provider's Staging DAG service for transfers
 func NewProviderDAGServiceDataTransfer(lc fx.Lifecycle, h host.Host, gs dtypes.StagingGraphsync, ds dtypes.MetadataDS) (dtypes.ProviderDataTransfer, error) {
@@ -393,14 +573,23 @@ func BasicDealFilter(user dtypes.DealFilter) func(onlineOk dtypes.ConsiderOnline
 	offlineOk dtypes.ConsiderOfflineStorageDealsConfigFunc,
 	blocklistFunc dtypes.StorageDealPieceCidBlocklistConfigFunc,
 	expectedSealTimeFunc dtypes.GetExpectedSealDurationFunc,
-	spn storagemarket.StorageProviderNode) dtypes.DealFilter {
+	spn storagemarket.StorageProviderNode) (dtypes.DealFilter, error) {
 	return func(onlineOk dtypes.ConsiderOnlineStorageDealsConfigFunc,
 		offlineOk dtypes.ConsiderOfflineStorageDealsConfigFunc,
 		blocklistFunc dtypes.StorageDealPieceCidBlocklistConfigFunc,
 		expectedSealTimeFunc dtypes.GetExpectedSealDurationFunc,
-		spn storagemarket.StorageProviderNode) dtypes.DealFilter {
+		spn storagemarket.StorageProviderNode) (dtypes.DealFilter, error) {
+
+		guard, err := dealguard.New(spn)
+		if err != nil {
+			return nil, err
+		}
 
 		return func(ctx context.Context, deal storagemarket.MinerDeal) (bool, string, error) {
+			if ok, reason, err := guard.Check(ctx, deal); !ok || err != nil {
+				return ok, reason, err
+			}
+
 			b, err := onlineOk()
 			if err != nil {
 				return false, "miner error", err
@@ -454,7 +643,7 @@ func BasicDealFilter(user dtypes.DealFilter) func(onlineOk dtypes.ConsiderOnline
 			}
 
 			return true, "", nil
-		}
+		}, nil
 	}
 }
 
@@ -481,9 +670,21 @@ func StorageProvider(minerAddress dtypes.MinerAddress,
 	return storageimpl.NewProvider(net, namespace.Wrap(ds, datastore.NewKey("/deals/provider")), store, mds, pieceStore, dataTransfer, spn, address.Address(minerAddress), ffiConfig.SealProofType, storedAsk, funds, opt)
 }
 
+// RetrievalScheduler limits the retrievals served at once, see
+// config.RetrievalConfig
+func RetrievalScheduler(cfg config.RetrievalConfig) func() *retrievalsched.Scheduler {
+	return func() *retrievalsched.Scheduler {
+		return retrievalsched.New(retrievalsched.Config{
+			MaxRetrievals:          cfg.MaxRetrievals,
+			MaxRetrievalsPerClient: cfg.MaxRetrievalsPerClient,
+			MaxUnseals:             cfg.MaxUnseals,
+		})
+	}
+}
+
 // RetrievalProvider creates a new retrieval provider attached to the provider blockstore
-func RetrievalProvider(h host.Host, miner *storage.Miner, sealer sectorstorage.SectorManager, full lapi.FullNode, ds dtypes.MetadataDS, pieceStore dtypes.ProviderPieceStore, mds dtypes.StagingMultiDstore, dt dtypes.ProviderDataTransfer, onlineOk dtypes.ConsiderOnlineRetrievalDealsConfigFunc, offlineOk dtypes.ConsiderOfflineRetrievalDealsConfigFunc) (retrievalmarket.RetrievalProvider, error) {
-	adapter := retrievaladapter.NewRetrievalProviderNode(miner, sealer, full)
+func RetrievalProvider(h host.Host, secb sectorblocks.SectorBuilder, full lapi.FullNode, ds dtypes.MetadataDS, pieceStore dtypes.ProviderPieceStore, mds dtypes.StagingMultiDstore, dt dtypes.ProviderDataTransfer, onlineOk dtypes.ConsiderOnlineRetrievalDealsConfigFunc, offlineOk dtypes.ConsiderOfflineRetrievalDealsConfigFunc, sched *retrievalsched.Scheduler) (retrievalmarket.RetrievalProvider, error) {
+	adapter := retrievaladapter.NewRetrievalProviderNode(secb, full, sched)
 
 	maddr, err := minerAddrFromDS(ds)
 	if err != nil {
@@ -512,19 +713,51 @@ func RetrievalProvider(h host.Host, miner *storage.Miner, sealer sectorstorage.S
 			log.Info("offline retrieval has not been implemented yet")
 		}
 
+		if ok, reason := sched.Admit(state); !ok {
+			log.Infow("rejecting retrieval deal", "client", state.Receiver, "reason", reason)
+			return false, reason, nil
+		}
+
 		return true, "", nil
 	})
 
-	return retrievalimpl.NewProvider(maddr, adapter, netwk, pieceStore, mds, dt, namespace.Wrap(ds, datastore.NewKey("/retrievals/provider")), opt)
+	p, err := retrievalimpl.NewProvider(maddr, adapter, netwk, pieceStore, mds, dt, namespace.Wrap(ds, datastore.NewKey("/retrievals/provider")), opt)
+	if err != nil {
+		return nil, err
+	}
+	p.SubscribeToEvents(sched.OnEvent)
+
+	return p, nil
 }
 
-func SectorStorage(mctx helpers.MetricsCtx, lc fx.Lifecycle, ls stores.LocalStorage, si stores.SectorIndex, cfg *ffiwrapper.Config, sc sectorstorage.SealerConfig, urls sectorstorage.URLs, sa sectorstorage.StorageAuth) (*sectorstorage.Manager, error) {
+func SectorStorage(mctx helpers.MetricsCtx, lc fx.Lifecycle, ls stores.LocalStorage, si stores.SectorIndex, cfg *ffiwrapper.Config, sc sectorstorage.SealerConfig, urls sectorstorage.URLs, sa sectorstorage.StorageAuth, cp *checkpoint.Checkpointer, tuner *autotune.Tuner) (*sectorstorage.Manager, error) {
 	ctx := helpers.LifecycleCtx(mctx, lc)
 
 	sst, err := sectorstorage.New(ctx, ls, si, cfg, sc, urls, sa)
 	if err != nil {
 		return nil, err
 	}
+	sst.OnTaskDone(tuner.Record)
+
+	var trace []storiface.SchedExplanation
+	if _, ok, err := cp.Load("sched", &trace); err != nil {
+		log.Warnf("loading scheduler checkpoint: %s", err)
+	} else if ok {
+		sst.RestoreSchedCheckpoint(trace)
+	}
+	cp.Register("sched", func() (interface{}, error) {
+		return sst.SchedCheckpoint(), nil
+	})
+
+	var queue []sectorstorage.QueuedTask
+	if _, ok, err := cp.Load("sched-queue", &queue); err != nil {
+		log.Warnf("loading scheduler queue checkpoint: %s", err)
+	} else if ok {
+		sst.RestoreSchedQueue(queue)
+	}
+	cp.Register("sched-queue", func() (interface{}, error) {
+		return sst.SchedQueueCheckpoint(), nil
+	})
 
 	lc.Append(fx.Hook{
 		OnStop: sst.Close,
@@ -533,6 +766,21 @@ func SectorStorage(mctx helpers.MetricsCtx, lc fx.Lifecycle, ls stores.LocalStor
 	return sst, nil
 }
 
+// Autotune records the sealing tasks finished on workers, and applies the
+// tuning settings applied for the host of the miner to its local worker
+func Autotune(ds dtypes.MetadataDS, getCfg dtypes.GetSealingConfigFunc, setCfg dtypes.SetSealingConfigFunc) (*autotune.Tuner, error) {
+	t := autotune.New(ds, getCfg, setCfg)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.SetEnv(hostname); err != nil {
+		return nil, xerrors.Errorf("applying tuning settings: %w", err)
+	}
+	return t, nil
+}
+
 func StorageAuth(ctx helpers.MetricsCtx, ca lapi.Common) (sectorstorage.StorageAuth, error) {
 	token, err := ca.AuthNew(ctx, []auth.Permission{"admin"})
 	if err != nil {
@@ -638,9 +886,13 @@ func NewSetSealConfigFunc(r repo.LockedRepo) (dtypes.SetSealingConfigFunc, error
 	return func(cfg sealiface.Config) (err error) {
 		err = mutateCfg(r, func(c *config.StorageMiner) {
 			c.Sealing = config.SealingConfig{
-				MaxWaitDealsSectors: cfg.MaxWaitDealsSectors,
-				MaxSealingSectors:   cfg.MaxSealingSectors,
-				WaitDealsDelay:      config.Duration(cfg.WaitDealsDelay),
+				MaxWaitDealsSectors:       cfg.MaxWaitDealsSectors,
+				MaxSealingSectors:         cfg.MaxSealingSectors,
+				MaxSealingSectorsForDeals: cfg.MaxSealingSectorsForDeals,
+				WaitDealsDelay:            config.Duration(cfg.WaitDealsDelay),
+				CacheTrimCC:               string(cfg.CacheTrimCC),
+				CacheTrimDeals:            string(cfg.CacheTrimDeals),
+				CommitPlacement:           cfg.CommitPlacement,
 			}
 		})
 		return
@@ -649,14 +901,27 @@ func NewSetSealConfigFunc(r repo.LockedRepo) (dtypes.SetSealingConfigFunc, error
 
 func NewGetSealConfigFunc(r repo.LockedRepo) (dtypes.GetSealingConfigFunc, error) {
 	return func() (out sealiface.Config, err error) {
+		var trimCC, trimDeals string
 		err = readCfg(r, func(cfg *config.StorageMiner) {
 			out = sealiface.Config{
 				MaxWaitDealsSectors:       cfg.Sealing.MaxWaitDealsSectors,
 				MaxSealingSectors:         cfg.Sealing.MaxSealingSectors,
 				MaxSealingSectorsForDeals: cfg.Sealing.MaxSealingSectorsForDeals,
 				WaitDealsDelay:            time.Duration(cfg.Sealing.WaitDealsDelay),
+				CommitPlacement:           cfg.Sealing.CommitPlacement,
 			}
+			trimCC, trimDeals = cfg.Sealing.CacheTrimCC, cfg.Sealing.CacheTrimDeals
 		})
+		if err != nil {
+			return
+		}
+
+		if out.CacheTrimCC, err = storiface.ParseCacheTrimLevel(trimCC); err != nil {
+			return out, xerrors.Errorf("CacheTrimCC: %w", err)
+		}
+		if out.CacheTrimDeals, err = storiface.ParseCacheTrimLevel(trimDeals); err != nil {
+			return out, xerrors.Errorf("CacheTrimDeals: %w", err)
+		}
 		return
 	}, nil
 }
@@ -710,3 +975,501 @@ func mutateCfg(r repo.LockedRepo, mutator func(*config.StorageMiner)) error {
 
 	return multierr.Combine(typeErr, setConfigErr)
 }
+
+// RelayChainHead relays chain heads from the full node to connected workers
+// over their control connection
+func RelayChainHead(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, m *sectorstorage.Manager) {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go crash.Run(ctx, "worker-head-relay", func(ctx context.Context) error {
+				return relayChainHeads(ctx, api, m)
+			})
+			return nil
+		},
+	})
+}
+
+// RecordSealingMetrics records the sealing tasks and worker utilization
+// served on the miner /metrics endpoint
+func RecordSealingMetrics(mctx helpers.MetricsCtx, lc fx.Lifecycle, maddr dtypes.MinerAddress, m *sectorstorage.Manager) {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	r := sealmetrics.NewReporter(m, address.Address(maddr))
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go crash.Run(ctx, "sealing-metrics", r.Run)
+			return nil
+		},
+	})
+}
+
+func relayChainHeads(ctx context.Context, api lapi.FullNode, m *sectorstorage.Manager) error {
+	notifs, err := api.ChainNotify(ctx)
+	if err != nil {
+		return xerrors.Errorf("subscribing to chain head: %w", err)
+	}
+
+	for {
+		select {
+		case changes, ok := <-notifs:
+			if !ok {
+				return xerrors.New("chain notify channel closed")
+			}
+
+			for _, change := range changes {
+				if change.Type == store.HCRevert {
+					continue
+				}
+				m.RelayChainHead(ctx, workerChainHead(change.Val))
+			}
+			crash.Success(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func workerChainHead(ts *types.TipSet) storiface.ChainHead {
+	head := storiface.ChainHead{
+		Height: ts.Height(),
+		Key:    ts.Key().Bytes(),
+		Ticket: ts.MinTicket().VRFProof,
+	}
+
+	if bes := ts.Blocks()[0].BeaconEntries; len(bes) > 0 {
+		head.BeaconRound = bes[len(bes)-1].Round
+		head.BeaconData = bes[len(bes)-1].Data
+	}
+
+	return head
+}
+
+// Outbox queues messages of the miner for offline signing, full sends its
+// messages when they're signed
+func Outbox(full lapi.FullNode, cfg config.SigningConfig) func(ds dtypes.MetadataDS) *outbox.Outbox {
+	return func(ds dtypes.MetadataDS) *outbox.Outbox {
+		return outbox.New(full, ds, cfg.Bypass)
+	}
+}
+
+// OutboxFullNode is the full node API the miner uses with offline signing
+func OutboxFullNode(full lapi.FullNode) func(ob *outbox.Outbox) lapi.FullNode {
+	return func(ob *outbox.Outbox) lapi.FullNode {
+		return &outbox.FullNode{FullNode: full, Outbox: ob}
+	}
+}
+
+type ConfigReloaderParams struct {
+	fx.In
+
+	Lifecycle  fx.Lifecycle
+	MetricsCtx helpers.MetricsCtx
+	Repo       repo.LockedRepo
+	Pledge     *dtypes.PledgeControl
+	Provider   storagemarket.StorageProvider `optional:"true"`
+}
+
+// ConfigReloader applies the runtime settings of the config file on start,
+// and reloads them on SIGHUP
+func ConfigReloader(params ConfigReloaderParams) (*reload.Reloader, error) {
+	r, err := reload.New(params.Repo, params.Pledge, params.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := helpers.LifecycleCtx(params.MetricsCtx, params.Lifecycle)
+	sigCh := make(chan os.Signal, 1)
+
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if err := r.SetAsk(); err != nil {
+				log.Errorf("setting the storage ask of the config: %s", err)
+			}
+
+			signal.Notify(sigCh, syscall.SIGHUP)
+			go func() {
+				for {
+					select {
+					case <-sigCh:
+						log.Info("SIGHUP received, reloading config")
+						if _, err := r.Reload(); err != nil {
+							log.Errorf("reloading config: %s", err)
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			signal.Stop(sigCh)
+			return nil
+		},
+	})
+
+	return r, nil
+}
+
+// WorkerRegistry keeps the workers which registered with the miner
+func WorkerRegistry(cfg config.WorkersConfig) func(ds dtypes.MetadataDS) *workerreg.Registry {
+	return func(ds dtypes.MetadataDS) *workerreg.Registry {
+		return workerreg.New(ds, cfg.RequireApproval)
+	}
+}
+
+// WorkerTaskAffinity pins task types to workers as configured in
+// Workers.Tasks
+func WorkerTaskAffinity(cfg config.WorkersConfig) func(ds dtypes.MetadataDS, m *sectorstorage.Manager) (*workertasks.Affinity, error) {
+	return func(ds dtypes.MetadataDS, m *sectorstorage.Manager) (*workertasks.Affinity, error) {
+		return workertasks.New(ds, m, cfg.Groups, cfg.Tasks)
+	}
+}
+
+// ExternalPlacer sets the external placer of the scheduler, if configured
+func ExternalPlacer(cfg config.SchedulerConfig) func(m *sectorstorage.Manager) {
+	return func(m *sectorstorage.Manager) {
+		if cfg.ExternalPlacer == "" {
+			return
+		}
+
+		header := http.Header{}
+		if cfg.ExternalPlacerToken != "" {
+			header.Set("Authorization", "Bearer "+cfg.ExternalPlacerToken)
+		}
+		m.SetPlacer(sectorstorage.NewHTTPPlacer(cfg.ExternalPlacer, header), time.Duration(cfg.ExternalPlacerTimeout))
+		log.Infow("using external task placer", "url", cfg.ExternalPlacer, "timeout", time.Duration(cfg.ExternalPlacerTimeout))
+	}
+}
+
+// SectorArchive sets the external sector archive, if configured
+func SectorArchive(cfg config.ArchiveConfig) func(m *sectorstorage.Manager) error {
+	return func(m *sectorstorage.Manager) error {
+		var a sectorstorage.Archiver
+		switch {
+		case cfg.Path != "" && cfg.Command != "":
+			return xerrors.New("only one of Archive.Path and Archive.Command can be set")
+		case cfg.Command != "":
+			a = archive.NewCommand(cfg.Command)
+		case cfg.Path != "":
+			path, err := homedir.Expand(cfg.Path)
+			if err != nil {
+				return xerrors.Errorf("expanding archive path: %w", err)
+			}
+			if a, err = archive.NewDir(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		m.SetArchiver(a, time.Duration(cfg.RecallBudget))
+		log.Infow("using external sector archive", "path", cfg.Path, "command", cfg.Command, "recallBudget", time.Duration(cfg.RecallBudget))
+		return nil
+	}
+}
+
+// CompressCaches periodically compresses finalized sector caches in local
+// storage, or restores them when compression is disabled. With compression
+// disabled the job only runs until no compressed files are left.
+func CompressCaches(cfg config.CacheCompressionConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, full lapi.FullNode, maddr dtypes.MinerAddress, m *sectorstorage.Manager) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, full lapi.FullNode, maddr dtypes.MinerAddress, m *sectorstorage.Manager) {
+		if cfg.Interval == 0 {
+			return
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "cache-compression", func(ctx context.Context) error {
+					return compressCaches(ctx, cfg, full, address.Address(maddr), m)
+				})
+				return nil
+			},
+		})
+	}
+}
+
+func compressCaches(ctx context.Context, cfg config.CacheCompressionConfig, full lapi.FullNode, maddr address.Address, m *sectorstorage.Manager) error {
+	if !cfg.Enable {
+		has, err := m.HasCompressedCaches(ctx)
+		if err != nil {
+			return xerrors.Errorf("looking for compressed caches: %w", err)
+		}
+		if !has {
+			return nil
+		}
+		log.Infow("cache compression is disabled, restoring compressed caches")
+	}
+
+	tick := time.NewTicker(time.Duration(cfg.Interval))
+	defer tick.Stop()
+
+	for {
+		var st stores.CompressStats
+		skip, err := provingSoon(ctx, full, maddr)
+		if err == nil {
+			if cfg.Enable {
+				st, err = m.CompressCaches(ctx, time.Duration(cfg.MinAge), cfg.MinSaving, skip)
+			} else {
+				st, err = m.DecompressCaches(ctx, skip)
+			}
+		}
+		if err != nil {
+			log.Errorf("cache compression pass: %+v", err)
+			crash.Failure(ctx, err)
+		} else {
+			if st.Files > 0 {
+				log.Infow("cache compression pass", "compress", cfg.Enable, "files", st.Files, "before", types.SizeStr(types.NewInt(uint64(st.Before))), "after", types.SizeStr(types.NewInt(uint64(st.After))), "skipped", st.Skipped, "busy", st.Busy)
+			}
+			crash.Success(ctx)
+
+			if !cfg.Enable && st.Busy == 0 {
+				log.Infow("restored all compressed caches")
+				return nil
+			}
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// provingSoon returns whether sectors are assigned to the current or the next
+// proving deadline, their caches are left alone until they're proven
+func provingSoon(ctx context.Context, full lapi.FullNode, maddr address.Address) (func(abi.SectorID) bool, error) {
+	di, err := full.StateMinerProvingDeadline(ctx, maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting proving deadline: %w", err)
+	}
+
+	soon := map[abi.SectorNumber]struct{}{}
+	for _, dlIdx := range []uint64{di.Index, (di.Index + 1) % di.WPoStPeriodDeadlines} {
+		parts, err := full.StateMinerPartitions(ctx, maddr, dlIdx, types.EmptyTSK)
+		if err != nil {
+			return nil, xerrors.Errorf("getting partitions of deadline %d: %w", dlIdx, err)
+		}
+		for _, part := range parts {
+			if err := part.AllSectors.ForEach(func(s uint64) error {
+				soon[abi.SectorNumber(s)] = struct{}{}
+				return nil
+			}); err != nil {
+				return nil, xerrors.Errorf("reading partition sectors: %w", err)
+			}
+		}
+	}
+
+	return func(sid abi.SectorID) bool {
+		_, ok := soon[sid.Number]
+		return ok
+	}, nil
+}
+
+// AlertReporter records the metrics used by the alert rules
+func AlertReporter(cfg config.AlertsConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, maddr dtypes.MinerAddress, m *sectorstorage.Manager) *alerts.Reporter {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, maddr dtypes.MinerAddress, m *sectorstorage.Manager) *alerts.Reporter {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		r := alerts.NewReporter(api, address.Address(maddr), func(ctx context.Context) (int, error) {
+			return len(m.WorkerStats()), nil
+		}, cfg)
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "alert-metrics", r.Run)
+				return nil
+			},
+		})
+
+		return r
+	}
+}
+
+// GasReport follows the chain to attribute the gas spent by the miner
+func GasReport(cfg config.GasReportConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, maddr dtypes.MinerAddress, api lapi.FullNode) *gasreport.Reporter {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, maddr dtypes.MinerAddress, api lapi.FullNode) *gasreport.Reporter {
+		r := gasreport.NewReporter(api, ds, address.Address(maddr), gasreport.Config{
+			Interval: time.Duration(cfg.Interval),
+			Backfill: time.Duration(cfg.Backfill),
+		})
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "gas-report", r.Run)
+				return nil
+			},
+		})
+
+		return r
+	}
+}
+
+// SectorWebhooks delivers the sector state changes of the miner to the
+// configured webhook endpoints
+func SectorWebhooks(cfg config.SectorWebhooksConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, m *storage.Miner) (*sectorhooks.Hooks, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, m *storage.Miner) (*sectorhooks.Hooks, error) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+
+		h, err := sectorhooks.New(ds, sectorhooks.Config{
+			URLs:       cfg.URLs,
+			MaxBackoff: time.Duration(cfg.MaxBackoff),
+			Retention:  time.Duration(cfg.Retention),
+		}, func() (map[abi.SectorNumber]lapi.SectorState, error) {
+			if !m.SealingReady() {
+				return nil, nil
+			}
+			sectors, err := m.ListSectors()
+			if err != nil {
+				return nil, err
+			}
+			states := make(map[abi.SectorNumber]lapi.SectorState, len(sectors))
+			for _, s := range sectors {
+				states[s.SectorNumber] = lapi.SectorState(s.State)
+			}
+			return states, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// set before the miner starts, so no update is missed
+		m.OnSectorUpdate(h.Record)
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "sector-webhooks", h.Run)
+				return nil
+			},
+		})
+
+		return h, nil
+	}
+}
+
+// SectorIndex serves the sector metadata queries of SectorsQuery
+func SectorIndex(api lapi.FullNode, maddr dtypes.MinerAddress, m *storage.Miner, l *labels.Store, si *stores.Index) *sectorindex.Index {
+	return sectorindex.New(api, address.Address(maddr), m, l, si)
+}
+
+// Checkpoints persists in-memory state of the miner subsystems
+func Checkpoints(cfg config.CheckpointConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS) *checkpoint.Checkpointer {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS) *checkpoint.Checkpointer {
+		cp := checkpoint.New(ds, time.Duration(cfg.Interval))
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "checkpoints", cp.Run)
+				return nil
+			},
+			// constructed before the subsystems, so this runs after they stopped
+			OnStop: cp.Stop,
+		})
+
+		return cp
+	}
+}
+
+// Cron runs the scheduled jobs of the miner
+func Cron(cronCfg config.CronConfig, sweepCfg config.SweepConfig, ccCfg config.CacheCompressionConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, full lapi.FullNode, maddr dtypes.MinerAddress, mid dtypes.MinerID, miner *storage.Miner, m *sectorstorage.Manager, s *sweep.Sweeper) (*cron.Cron, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, full lapi.FullNode, maddr dtypes.MinerAddress, mid dtypes.MinerID, miner *storage.Miner, m *sectorstorage.Manager, s *sweep.Sweeper) (*cron.Cron, error) {
+		tasks := map[string]cron.Task{
+			"sweep": func(ctx context.Context) (string, error) {
+				rec, err := s.Sweep(ctx, sweepCfg.DryRun)
+				if err != nil {
+					return "", err
+				}
+				out := fmt.Sprintf("sweep %d: %d transfers, approved: %t", rec.ID, len(rec.Transfers), rec.Approved)
+				if rec.Error != "" {
+					return out, xerrors.New(rec.Error)
+				}
+				return out, nil
+			},
+			"scrub": func(ctx context.Context) (string, error) {
+				return scrubSectors(ctx, abi.ActorID(mid), miner, m)
+			},
+			"compress-caches": func(ctx context.Context) (string, error) {
+				if !ccCfg.Enable {
+					return "", xerrors.New("cache compression is disabled")
+				}
+				skip, err := provingSoon(ctx, full, address.Address(maddr))
+				if err != nil {
+					return "", err
+				}
+				st, err := m.CompressCaches(ctx, time.Duration(ccCfg.MinAge), ccCfg.MinSaving, skip)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d files, %s -> %s, %d skipped, %d busy", st.Files, types.SizeStr(types.NewInt(uint64(st.Before))), types.SizeStr(types.NewInt(uint64(st.After))), st.Skipped, st.Busy), nil
+			},
+		}
+
+		jobs := make([]cron.JobConfig, len(cronCfg.Jobs))
+		for i, j := range cronCfg.Jobs {
+			jobs[i] = cron.JobConfig{
+				Name:     j.Name,
+				Schedule: j.Schedule,
+				Task:     j.Task,
+				Command:  j.Command,
+				Timeout:  time.Duration(j.Timeout),
+			}
+		}
+
+		c, err := cron.New(ds, address.Address(maddr), tasks, jobs)
+		if err != nil {
+			return nil, xerrors.Errorf("setting up cron: %w", err)
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go crash.Run(ctx, "cron", c.Run)
+				return nil
+			},
+		})
+
+		return c, nil
+	}
+}
+
+// scrubSectors checks that all proving sectors can be proven
+func scrubSectors(ctx context.Context, mid abi.ActorID, miner *storage.Miner, m *sectorstorage.Manager) (string, error) {
+	sectors, err := miner.ListSectors()
+	if err != nil {
+		return "", xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	bySpt := map[abi.RegisteredSealProof][]abi.SectorID{}
+	var n int
+	for _, si := range sectors {
+		if si.State != sealing.Proving {
+			continue
+		}
+		bySpt[si.SectorType] = append(bySpt[si.SectorType], abi.SectorID{Miner: mid, Number: si.SectorNumber})
+		n++
+	}
+
+	var bad []abi.SectorID
+	for spt, ids := range bySpt {
+		b, err := m.CheckProvable(ctx, spt, ids)
+		if err != nil {
+			return "", xerrors.Errorf("checking sectors: %w", err)
+		}
+		bad = append(bad, b...)
+	}
+
+	out := fmt.Sprintf("checked %d sectors, %d bad", n, len(bad))
+	if len(bad) > 0 {
+		for _, s := range bad {
+			out += fmt.Sprintf("\nbad sector: %d", s.Number)
+		}
+		return out, xerrors.Errorf("%d of %d sectors are not provable", len(bad), n)
+	}
+	return out, nil
+}
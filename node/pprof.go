@@ -0,0 +1,57 @@
+package node
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api/apistruct"
+)
+
+const (
+	// PprofAPI serves the pprof handlers on the API endpoint
+	PprofAPI = "api"
+	// PprofOff doesn't serve the pprof handlers
+	PprofOff = "off"
+)
+
+// ServePprof serves the debug handlers of http.DefaultServeMux, pprof among
+// them, on a separate listener. The address must be on localhost, and
+// requests need an admin token.
+func ServePprof(addr string, verify func(ctx context.Context, token string) ([]auth.Permission, error)) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing pprof address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, xerrors.Errorf("pprof address %q isn't on localhost", addr)
+	}
+
+	lst, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, xerrors.Errorf("listening for pprof: %w", err)
+	}
+
+	srv := &http.Server{Handler: &auth.Handler{
+		Verify: verify,
+		Next: func(w http.ResponseWriter, r *http.Request) {
+			if !auth.HasPerm(r.Context(), nil, apistruct.PermAdmin) {
+				http.Error(w, "unauthorized: missing admin permission", http.StatusUnauthorized)
+				return
+			}
+			http.DefaultServeMux.ServeHTTP(w, r)
+		},
+	}}
+
+	go func() {
+		if err := srv.Serve(lst); err != nil && err != http.ErrServerClosed {
+			log.Errorf("serving pprof: %s", err)
+		}
+	}()
+
+	log.Infof("serving pprof on http://%s/debug/pprof", lst.Addr())
+	return srv, nil
+}
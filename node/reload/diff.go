@@ -0,0 +1,53 @@
+package reload
+
+import (
+	"encoding"
+	"reflect"
+)
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Changed returns the settings which differ between two configs, as
+// Section.Field like in the config file
+func Changed(a, b interface{}) []string {
+	var out []string
+	diff(reflect.ValueOf(a), reflect.ValueOf(b), "", &out)
+	return out
+}
+
+func diff(a, b reflect.Value, path string, out *[]string) {
+	for a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*out = append(*out, path)
+			}
+			return
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+
+	if a.Kind() != reflect.Struct || a.Type().Implements(textMarshaler) {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, path)
+		}
+		return
+	}
+
+	for i := 0; i < a.NumField(); i++ {
+		f := a.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		p := path
+		if !f.Anonymous {
+			// embedded sections, like Common in the miner config, aren't
+			// named in the config file
+			if p != "" {
+				p += "."
+			}
+			p += f.Name
+		}
+		diff(a.Field(i), b.Field(i), p, out)
+	}
+}
@@ -0,0 +1,305 @@
+package reload
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/docker/go-units"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+var log = logging.Logger("reload")
+
+// pledgeSettings are the settings of the pledge loop Reload applies
+var pledgeSettings = []string{
+	"Startup.PledgeInterval",
+	"Startup.PledgeMaxSectors",
+	"Startup.PledgeMinFree",
+	"Startup.PledgeReserveWorkers",
+}
+
+// readOnUse are the settings read from the config file whenever they're
+// used, so they apply without a reload
+var readOnUse = []string{
+	"Sealing.",
+	"Dealmaking.ConsiderOnlineStorageDeals",
+	"Dealmaking.ConsiderOfflineStorageDeals",
+	"Dealmaking.ConsiderOnlineRetrievalDeals",
+	"Dealmaking.ConsiderOfflineRetrievalDeals",
+	"Dealmaking.PieceCidBlocklist",
+	"Dealmaking.ExpectedSealDuration",
+}
+
+// Reloader re-reads the config file of the miner and applies the settings
+// which can change while it runs: log levels, the pledge interval and limits,
+// and the storage ask. Other changed settings are reported as needing a
+// restart, the running sealing jobs aren't touched.
+type Reloader struct {
+	lr     repo.LockedRepo
+	pledge *dtypes.PledgeControl
+	// provider is nil on miners which don't run the storage market
+	provider storagemarket.StorageProvider
+
+	lk  sync.Mutex
+	cur *config.StorageMiner
+}
+
+// New applies the log levels and pledge settings of the config file
+func New(lr repo.LockedRepo, pledge *dtypes.PledgeControl, provider storagemarket.StorageProvider) (*Reloader, error) {
+	cfg, err := load(lr)
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err := PledgeSettings(cfg.Startup)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLogLevels(cfg.Logging); err != nil {
+		return nil, err
+	}
+	setLogLevels(cfg.Logging)
+	pledge.SetSettings(ps)
+
+	return &Reloader{
+		lr:       lr,
+		pledge:   pledge,
+		provider: provider,
+		cur:      cfg,
+	}, nil
+}
+
+// PledgeSettings returns the pledge loop settings of the config
+func PledgeSettings(cfg config.StartupConfig) (dtypes.PledgeSettings, error) {
+	out := dtypes.PledgeSettings{
+		Interval:       time.Duration(cfg.PledgeInterval),
+		MaxSectors:     cfg.PledgeMaxSectors,
+		ReserveWorkers: cfg.PledgeReserveWorkers,
+	}
+	if cfg.PledgeMinFree != "" {
+		v, err := units.RAMInBytes(cfg.PledgeMinFree)
+		if err != nil {
+			return dtypes.PledgeSettings{}, xerrors.Errorf("parsing Startup.PledgeMinFree: %w", err)
+		}
+		out.MinFree = v
+	}
+	if cfg.PledgeSector && out.MaxSectors == 0 && out.MinFree == 0 {
+		log.Warn("pledging without a limit keeps pledging until storage is full, set Startup.PledgeMaxSectors or Startup.PledgeMinFree")
+	}
+	return out, nil
+}
+
+// SetAsk sets the storage ask of the config, if any
+func (r *Reloader) SetAsk() error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if r.provider == nil || r.cur.Dealmaking.Ask == (config.AskConfig{}) {
+		return nil
+	}
+	return r.setAsk(r.cur.Dealmaking.Ask)
+}
+
+// Reload re-reads the config file and applies the changed settings. Nothing
+// is applied when a changed setting is invalid.
+func (r *Reloader) Reload() (api.ConfigReload, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	cfg, err := load(r.lr)
+	if err != nil {
+		return api.ConfigReload{}, err
+	}
+
+	out := api.ConfigReload{Applied: []string{}, Restart: []string{}}
+	var logs, pledge, ask bool
+	for _, c := range Changed(r.cur, cfg) {
+		switch {
+		case strings.HasPrefix(c, "Logging."):
+			logs = true
+		case hasPrefix(c, pledgeSettings):
+			pledge = true
+		case strings.HasPrefix(c, "Dealmaking.Ask."):
+			if r.provider == nil {
+				log.Warnw("not setting the ask, the storage market doesn't run in this process", "setting", c)
+				continue
+			}
+			ask = true
+		case hasPrefix(c, readOnUse):
+		default:
+			out.Restart = append(out.Restart, c)
+			continue
+		}
+		out.Applied = append(out.Applied, c)
+	}
+
+	// check everything before applying anything
+	ps, err := PledgeSettings(cfg.Startup)
+	if err != nil {
+		return api.ConfigReload{}, err
+	}
+	if err := checkLogLevels(cfg.Logging); err != nil {
+		return api.ConfigReload{}, err
+	}
+	if ask {
+		if _, err := askParams(cfg.Dealmaking.Ask, r.provider.GetAsk()); err != nil {
+			return api.ConfigReload{}, err
+		}
+	}
+
+	if logs {
+		setLogLevels(cfg.Logging)
+	}
+	if pledge {
+		r.pledge.SetSettings(ps)
+	}
+	if ask {
+		if err := r.setAsk(cfg.Dealmaking.Ask); err != nil {
+			return api.ConfigReload{}, err
+		}
+	}
+
+	r.cur = cfg
+	log.Infow("reloaded config", "applied", out.Applied, "restart", out.Restart)
+	return out, nil
+}
+
+func (r *Reloader) setAsk(cfg config.AskConfig) error {
+	p, err := askParams(cfg, r.provider.GetAsk())
+	if err != nil {
+		return err
+	}
+	if err := r.provider.SetAsk(p.price, p.verifiedPrice, p.duration, storagemarket.MinPieceSize(p.min), storagemarket.MaxPieceSize(p.max)); err != nil {
+		return xerrors.Errorf("setting ask: %w", err)
+	}
+	log.Infow("set storage ask", "price", p.price, "verified-price", p.verifiedPrice, "duration", p.duration, "min", p.min, "max", p.max)
+	return nil
+}
+
+type ask struct {
+	price, verifiedPrice abi.TokenAmount
+	duration             abi.ChainEpoch
+	min, max             abi.PaddedPieceSize
+}
+
+// askParams fills the empty settings of cfg from the current ask
+func askParams(cfg config.AskConfig, cur *storagemarket.SignedStorageAsk) (ask, error) {
+	var out ask
+	if cur != nil && cur.Ask != nil {
+		out = ask{
+			price:         cur.Ask.Price,
+			verifiedPrice: cur.Ask.VerifiedPrice,
+			duration:      cur.Ask.Expiry - cur.Ask.Timestamp,
+			min:           cur.Ask.MinPieceSize,
+			max:           cur.Ask.MaxPieceSize,
+		}
+	}
+
+	var err error
+	if cfg.Price != "" {
+		if out.price, err = types.BigFromString(cfg.Price); err != nil {
+			return ask{}, xerrors.Errorf("parsing Dealmaking.Ask.Price: %w", err)
+		}
+	}
+	if cfg.VerifiedPrice != "" {
+		if out.verifiedPrice, err = types.BigFromString(cfg.VerifiedPrice); err != nil {
+			return ask{}, xerrors.Errorf("parsing Dealmaking.Ask.VerifiedPrice: %w", err)
+		}
+	}
+	if cfg.Duration != 0 {
+		out.duration = abi.ChainEpoch(time.Duration(cfg.Duration) / (time.Duration(build.BlockDelaySecs) * time.Second))
+	}
+	if cfg.MinPieceSize != "" {
+		v, err := units.RAMInBytes(cfg.MinPieceSize)
+		if err != nil {
+			return ask{}, xerrors.Errorf("parsing Dealmaking.Ask.MinPieceSize: %w", err)
+		}
+		if v < 256 {
+			return ask{}, xerrors.New("Dealmaking.Ask.MinPieceSize must be at least 256B")
+		}
+		out.min = abi.PaddedPieceSize(v)
+	}
+	if cfg.MaxPieceSize != "" {
+		v, err := units.RAMInBytes(cfg.MaxPieceSize)
+		if err != nil {
+			return ask{}, xerrors.Errorf("parsing Dealmaking.Ask.MaxPieceSize: %w", err)
+		}
+		out.max = abi.PaddedPieceSize(v)
+	}
+	if out.duration <= 0 {
+		return ask{}, xerrors.New("Dealmaking.Ask.Duration must be set")
+	}
+	return out, nil
+}
+
+func checkLogLevels(cfg config.LoggingConfig) error {
+	for sys, lvl := range cfg.Levels {
+		if _, err := logging.LevelFromString(lvl); err != nil {
+			return xerrors.Errorf("log level of %s: %w", sys, err)
+		}
+	}
+	return nil
+}
+
+// setLogLevels sets the level of all subsystems first, so the levels of
+// single subsystems apply on top of it
+func setLogLevels(cfg config.LoggingConfig) {
+	if lvl, ok := cfg.Levels["*"]; ok {
+		if err := logging.SetLogLevel("*", lvl); err != nil {
+			log.Warnw("setting log level", "level", lvl, "error", err)
+		}
+	}
+	for sys, lvl := range cfg.Levels {
+		if sys == "*" {
+			continue
+		}
+		if err := logging.SetLogLevel(sys, lvl); err != nil {
+			log.Warnw("setting log level", "subsystem", sys, "level", lvl, "error", err)
+		}
+	}
+}
+
+// load returns a copy of the config, repos may hand out the config they
+// change in place
+func load(lr repo.LockedRepo) (*config.StorageMiner, error) {
+	raw, err := lr.Config()
+	if err != nil {
+		return nil, xerrors.Errorf("loading config: %w", err)
+	}
+	if _, ok := raw.(*config.StorageMiner); !ok {
+		return nil, xerrors.Errorf("expected a miner config, got %T", raw)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(raw); err != nil {
+		return nil, xerrors.Errorf("encoding config: %w", err)
+	}
+	cfg, err := config.FromReader(&buf, config.DefaultStorageMiner())
+	if err != nil {
+		return nil, xerrors.Errorf("decoding config: %w", err)
+	}
+	return cfg.(*config.StorageMiner), nil
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
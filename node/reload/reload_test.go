@@ -0,0 +1,69 @@
+package reload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/filecoin-project/lotus/node/repo"
+)
+
+func TestChanged(t *testing.T) {
+	a := config.DefaultStorageMiner()
+	b := config.DefaultStorageMiner()
+	require.Empty(t, Changed(a, b))
+
+	b.API.ListenAddress = "/ip4/127.0.0.1/tcp/1234/http"
+	b.Sealing.MaxSealingSectors = 10
+	b.Logging.Levels = map[string]string{"sectors": "debug"}
+	b.Alerts.MinWorkerBalance = a.Alerts.MinWorkerBalance
+	require.Equal(t, []string{"API.ListenAddress", "Sealing.MaxSealingSectors", "Logging.Levels"}, Changed(a, b))
+}
+
+func TestReload(t *testing.T) {
+	lr, err := repo.NewMemory(nil).Lock(repo.StorageMiner)
+	require.NoError(t, err)
+	defer lr.Close() //nolint:errcheck
+
+	pc := new(dtypes.PledgeControl)
+	r, err := New(lr, pc, nil)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, pc.Settings().Interval)
+
+	res, err := r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, res.Applied)
+	require.Empty(t, res.Restart)
+
+	require.NoError(t, lr.SetConfig(func(raw interface{}) {
+		cfg := raw.(*config.StorageMiner)
+		cfg.Startup.PledgeInterval = config.Duration(time.Minute)
+		cfg.Startup.PledgeMinFree = "1GiB"
+		cfg.Startup.PledgeSector = true
+		cfg.Logging.Levels = map[string]string{"reload": "error"}
+		cfg.Sealing.MaxSealingSectors = 5
+	}))
+
+	res, err = r.Reload()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"Startup.PledgeInterval", "Startup.PledgeMinFree", "Logging.Levels", "Sealing.MaxSealingSectors"}, res.Applied)
+	require.Equal(t, []string{"Startup.PledgeSector"}, res.Restart)
+
+	require.Equal(t, time.Minute, pc.Settings().Interval)
+	require.Equal(t, int64(1<<30), pc.Settings().MinFree)
+	require.False(t, log.Desugar().Core().Enabled(zapcore.WarnLevel))
+
+	// invalid settings aren't applied
+	require.NoError(t, lr.SetConfig(func(raw interface{}) {
+		cfg := raw.(*config.StorageMiner)
+		cfg.Startup.PledgeInterval = config.Duration(time.Hour)
+		cfg.Startup.PledgeMinFree = "lots"
+	}))
+	_, err = r.Reload()
+	require.Error(t, err)
+	require.Equal(t, time.Minute, pc.Settings().Interval)
+}
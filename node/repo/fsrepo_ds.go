@@ -73,6 +73,13 @@ func (fsr *fsLockedRepo) openDatastores() (map[string]datastore.Batching, error)
 		out[datastore.NewKey(p).String()] = ds
 	}
 
+	if err := wrapSchema(out); err != nil {
+		for _, ds := range out {
+			_ = ds.Close()
+		}
+		return nil, err
+	}
+
 	return out, nil
 }
 
@@ -0,0 +1,346 @@
+package repo
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+)
+
+// SchemaChange moves the datastore keys under Old to New.
+//
+// Until the change is finalized (see FinalizeSchema), keys under New are also
+// written under Old, and reads under New are served from Old. This keeps the
+// repo usable by the previous binary, so a node can be upgraded and rolled
+// back without migrating its datastores; only one binary can hold the repo
+// lock at a time.
+type SchemaChange struct {
+	// Version is the schema version introducing the change, starting at 1
+	Version int
+	// Datastore is the namespace of the datastore, e.g. "/metadata"
+	Datastore string
+
+	Old, New datastore.Key
+}
+
+// SchemaChanges lists the datastore key changes, ordered by version
+var SchemaChanges = []SchemaChange{
+	// the client CommP queue was nested in the namespace of the client
+	// import manager
+	{Version: 1, Datastore: "/metadata", Old: datastore.NewKey("/client/commp"), New: datastore.NewKey("/commp")},
+}
+
+// SchemaVersion returns the datastore schema version of this binary
+func SchemaVersion() int {
+	if len(SchemaChanges) == 0 {
+		return 0
+	}
+	return SchemaChanges[len(SchemaChanges)-1].Version
+}
+
+// schemaFinalizedKey records, in the metadata datastore, the schema version
+// for which old keys were removed. Binaries with an older schema can't open
+// the repo anymore.
+var schemaFinalizedKey = datastore.NewKey("/repo/schema/finalized")
+
+func finalizedSchema(mds datastore.Datastore) (int, error) {
+	b, err := mds.Get(schemaFinalizedKey)
+	if err == datastore.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, xerrors.Errorf("reading finalized schema version: %w", err)
+	}
+
+	v, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, xerrors.Errorf("parsing finalized schema version: %w", err)
+	}
+	return v, nil
+}
+
+// wrapSchema wraps the datastores with the changes which aren't finalized yet
+func wrapSchema(dss map[string]datastore.Batching) error {
+	mds, ok := dss["/metadata"]
+	if !ok {
+		return xerrors.Errorf("no metadata datastore")
+	}
+
+	finalized, err := finalizedSchema(mds)
+	if err != nil {
+		return err
+	}
+	if finalized > SchemaVersion() {
+		return xerrors.Errorf("repo datastores were finalized for schema version %d, this binary only supports version %d, upgrade lotus", finalized, SchemaVersion())
+	}
+
+	for ns, ds := range dss {
+		var changes []SchemaChange
+		for _, c := range SchemaChanges {
+			if c.Version > finalized && c.Datastore == ns {
+				changes = append(changes, c)
+			}
+		}
+		if len(changes) > 0 {
+			dd := &dualDatastore{Batching: ds, changes: changes}
+			if err := dd.sync(); err != nil {
+				return xerrors.Errorf("syncing schema changes of %s: %w", ns, err)
+			}
+			dss[ns] = dd
+		}
+	}
+
+	return nil
+}
+
+// FinalizeSchema ends the upgrade window of the schema changes up to the
+// version of this binary: values left under old keys are moved to the new
+// ones, and old keys are removed. Previous binaries can't open the repo
+// afterwards.
+func FinalizeSchema(lr LockedRepo) (int, error) {
+	mds, err := lr.Datastore("/metadata")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ns := range datastoreNamespaces() {
+		ds, err := lr.Datastore(ns)
+		if err != nil {
+			return 0, err
+		}
+		dd, ok := ds.(*dualDatastore)
+		if !ok {
+			continue
+		}
+		if err := dd.finalize(); err != nil {
+			return 0, xerrors.Errorf("finalizing %s: %w", ns, err)
+		}
+	}
+
+	v := SchemaVersion()
+	if err := mds.Put(schemaFinalizedKey, []byte(strconv.Itoa(v))); err != nil {
+		return 0, xerrors.Errorf("recording finalized schema version: %w", err)
+	}
+	return v, nil
+}
+
+func datastoreNamespaces() []string {
+	out := make([]string, 0, len(fsDatastores))
+	for p := range fsDatastores {
+		out = append(out, datastore.NewKey(p).String())
+	}
+	return out
+}
+
+// dualDatastore writes keys affected by schema changes under both the new and
+// the old key. The old key stays authoritative until the change is
+// finalized: reads go to the old key, and the new keys are synced to the old
+// ones when the datastore is opened, so they pick up what a rolled back
+// binary wrote or deleted in the meantime.
+type dualDatastore struct {
+	datastore.Batching
+
+	changes []SchemaChange
+	done    int32
+}
+
+var _ datastore.Batching = &dualDatastore{}
+
+// oldKey returns the key k was stored under before the schema change
+func (d *dualDatastore) oldKey(k datastore.Key) (datastore.Key, bool) {
+	if atomic.LoadInt32(&d.done) == 1 {
+		return datastore.Key{}, false
+	}
+	for i := len(d.changes) - 1; i >= 0; i-- {
+		c := d.changes[i]
+		if k.Equal(c.New) || k.IsDescendantOf(c.New) {
+			return datastore.NewKey(c.Old.String() + strings.TrimPrefix(k.String(), c.New.String())), true
+		}
+	}
+	return datastore.Key{}, false
+}
+
+// sync makes the keys under the new prefixes mirror the ones under the old
+// prefixes
+func (d *dualDatastore) sync() error {
+	for _, c := range d.changes {
+		old, err := d.query(c.Old)
+		if err != nil {
+			return err
+		}
+		cur, err := d.query(c.New)
+		if err != nil {
+			return err
+		}
+
+		b, err := d.Batching.Batch()
+		if err != nil {
+			return err
+		}
+		want := map[string]struct{}{}
+		for k, v := range old {
+			nk := c.New.String() + strings.TrimPrefix(k, c.Old.String())
+			want[nk] = struct{}{}
+			if cv, ok := cur[nk]; ok && bytes.Equal(cv, v) {
+				continue
+			}
+			if err := b.Put(datastore.NewKey(nk), v); err != nil {
+				return err
+			}
+		}
+		for k := range cur {
+			if _, ok := want[k]; ok {
+				continue
+			}
+			if err := b.Delete(datastore.NewKey(k)); err != nil {
+				return err
+			}
+		}
+		if err := b.Commit(); err != nil {
+			return xerrors.Errorf("syncing %s to %s: %w", c.New, c.Old, err)
+		}
+	}
+	return nil
+}
+
+func (d *dualDatastore) query(prefix datastore.Key) (map[string][]byte, error) {
+	res, err := d.Batching.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	all, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string][]byte{}
+	for _, e := range all {
+		out[e.Key] = e.Value
+	}
+	return out, nil
+}
+
+func (d *dualDatastore) Get(k datastore.Key) ([]byte, error) {
+	if ok, dual := d.oldKey(k); dual {
+		return d.Batching.Get(ok)
+	}
+	return d.Batching.Get(k)
+}
+
+func (d *dualDatastore) Has(k datastore.Key) (bool, error) {
+	if ok, dual := d.oldKey(k); dual {
+		return d.Batching.Has(ok)
+	}
+	return d.Batching.Has(k)
+}
+
+func (d *dualDatastore) GetSize(k datastore.Key) (int, error) {
+	if ok, dual := d.oldKey(k); dual {
+		return d.Batching.GetSize(ok)
+	}
+	return d.Batching.GetSize(k)
+}
+
+func (d *dualDatastore) Put(k datastore.Key, v []byte) error {
+	ok, dual := d.oldKey(k)
+	if !dual {
+		return d.Batching.Put(k, v)
+	}
+
+	b, err := d.Batching.Batch()
+	if err != nil {
+		return err
+	}
+	if err := b.Put(k, v); err != nil {
+		return err
+	}
+	if err := b.Put(ok, v); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+func (d *dualDatastore) Delete(k datastore.Key) error {
+	ok, dual := d.oldKey(k)
+	if !dual {
+		return d.Batching.Delete(k)
+	}
+
+	b, err := d.Batching.Batch()
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(k); err != nil {
+		return err
+	}
+	if err := b.Delete(ok); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+// Query answers queries within a new prefix from the old keys. Queries of a
+// parent prefix return both keys as they are stored.
+func (d *dualDatastore) Query(q query.Query) (query.Results, error) {
+	prefix := datastore.NewKey(q.Prefix)
+	oldPrefix, dual := d.oldKey(prefix)
+	if !dual {
+		return d.Batching.Query(q)
+	}
+
+	res, err := d.Batching.Query(query.Query{Prefix: oldPrefix.String(), KeysOnly: q.KeysOnly, ReturnsSizes: q.ReturnsSizes})
+	if err != nil {
+		return nil, err
+	}
+	all, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		all[i].Key = prefix.String() + strings.TrimPrefix(all[i].Key, oldPrefix.String())
+	}
+	return query.NaiveQueryApply(q, query.ResultsWithEntries(q, all)), nil
+}
+
+func (d *dualDatastore) Batch() (datastore.Batch, error) {
+	return datastore.NewBasicBatch(d), nil
+}
+
+// finalize moves values under old keys to the new keys, and stops writing
+// old keys
+func (d *dualDatastore) finalize() error {
+	for _, c := range d.changes {
+		res, err := d.Batching.Query(query.Query{Prefix: c.Old.String()})
+		if err != nil {
+			return err
+		}
+		all, err := res.Rest()
+		if err != nil {
+			return err
+		}
+
+		b, err := d.Batching.Batch()
+		if err != nil {
+			return err
+		}
+		for _, e := range all {
+			nk := datastore.NewKey(c.New.String() + strings.TrimPrefix(e.Key, c.Old.String()))
+			if err := b.Put(nk, e.Value); err != nil {
+				return err
+			}
+			if err := b.Delete(datastore.NewKey(e.Key)); err != nil {
+				return err
+			}
+		}
+		if err := b.Commit(); err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreInt32(&d.done, 1)
+	return nil
+}
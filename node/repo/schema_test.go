@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaUpgradeWindow(t *testing.T) {
+	repo, closer := genFsRepo(t)
+	defer closer()
+
+	oldKey := datastore.NewKey("/deals/old/1")
+	newKey := datastore.NewKey("/deals/v2/1")
+
+	// the previous binary writes under the old prefix
+	lr, err := repo.Lock(FullNode)
+	require.NoError(t, err)
+	mds, err := lr.Datastore("/metadata")
+	require.NoError(t, err)
+	require.NoError(t, mds.Put(oldKey, []byte("a")))
+	require.NoError(t, lr.Close())
+
+	defer func(c []SchemaChange) { SchemaChanges = c }(SchemaChanges)
+	SchemaChanges = []SchemaChange{{
+		Version:   1,
+		Datastore: "/metadata",
+		Old:       datastore.NewKey("/deals/old"),
+		New:       datastore.NewKey("/deals/v2"),
+	}}
+
+	// the new binary sees old values, and keeps writing old keys
+	lr, err = repo.Lock(FullNode)
+	require.NoError(t, err)
+	mds, err = lr.Datastore("/metadata")
+	require.NoError(t, err)
+
+	v, err := mds.Get(newKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), v)
+
+	require.NoError(t, mds.Put(datastore.NewKey("/deals/v2/2"), []byte("b")))
+	v, err = mds.(*dualDatastore).Batching.Get(datastore.NewKey("/deals/old/2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("b"), v)
+
+	res, err := mds.Query(query.Query{Prefix: "/deals/v2"})
+	require.NoError(t, err)
+	all, err := res.Rest()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	require.NoError(t, lr.Close())
+
+	// a rolled back binary only updates old keys
+	SchemaChanges = nil
+	lr, err = repo.Lock(FullNode)
+	require.NoError(t, err)
+	mds, err = lr.Datastore("/metadata")
+	require.NoError(t, err)
+	require.NoError(t, mds.Put(oldKey, []byte("c")))
+	require.NoError(t, mds.Delete(datastore.NewKey("/deals/old/2")))
+	require.NoError(t, lr.Close())
+
+	// the old keys are authoritative when the new binary comes back
+	SchemaChanges = []SchemaChange{{
+		Version:   1,
+		Datastore: "/metadata",
+		Old:       datastore.NewKey("/deals/old"),
+		New:       datastore.NewKey("/deals/v2"),
+	}}
+	lr, err = repo.Lock(FullNode)
+	require.NoError(t, err)
+	mds, err = lr.Datastore("/metadata")
+	require.NoError(t, err)
+
+	v, err = mds.Get(newKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), v)
+	has, err := mds.Has(datastore.NewKey("/deals/v2/2"))
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = mds.(*dualDatastore).Batching.Has(datastore.NewKey("/deals/v2/2"))
+	require.NoError(t, err)
+	require.False(t, has, "new keys are synced when the datastore is opened")
+
+	ver, err := FinalizeSchema(lr)
+	require.NoError(t, err)
+	require.Equal(t, 1, ver)
+
+	has, err = mds.(*dualDatastore).Batching.Has(oldKey)
+	require.NoError(t, err)
+	require.False(t, has)
+	v, err = mds.Get(newKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), v)
+	require.NoError(t, lr.Close())
+
+	// binaries with an older schema refuse the finalized repo
+	SchemaChanges = nil
+	lr, err = repo.Lock(FullNode)
+	require.NoError(t, err)
+	_, err = lr.Datastore("/metadata")
+	require.Error(t, err)
+	require.NoError(t, lr.Close())
+}
@@ -0,0 +1,23 @@
+package node
+
+import (
+	"github.com/filecoin-project/lotus/lib/rpclimit"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+// RPCLimiter returns the limiter for the RPC calls of an API server
+func RPCLimiter(cfg config.APILimits) *rpclimit.Limiter {
+	return rpclimit.New(rpclimit.Config{
+		CallsPerSecond: cfg.CallsPerSecond,
+		Burst:          cfg.Burst,
+		MaxInFlight:    cfg.MaxInFlight,
+		MaxConnections: cfg.MaxConnections,
+
+		TokenCallsPerSecond: cfg.TokenCallsPerSecond,
+		TokenBurst:          cfg.TokenBurst,
+		TokenMaxInFlight:    cfg.TokenMaxInFlight,
+		TokenMaxConnections: cfg.TokenMaxConnections,
+
+		Exempt: cfg.Exempt,
+	})
+}
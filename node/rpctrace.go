@@ -0,0 +1,31 @@
+package node
+
+import (
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/filecoin-project/lotus/lib/rpctrace"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+// APITrace opens the trace file the RPC calls of an API server are recorded
+// to, it returns nil when API.Trace isn't set
+func APITrace(cfg config.API, repoPath string) (*rpctrace.Recorder, error) {
+	if cfg.Trace == "" {
+		return nil, nil
+	}
+
+	path, err := homedir.Expand(cfg.Trace)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		repoPath, err = homedir.Expand(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(repoPath, path)
+	}
+	return rpctrace.Open(path)
+}
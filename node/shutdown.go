@@ -0,0 +1,190 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DefaultShutdownGrace is how long in-flight RPCs can run after shutdown
+	// was requested
+	DefaultShutdownGrace = 30 * time.Second
+	// DefaultShutdownTimeout is how long the whole shutdown can take before
+	// the process exits forcefully
+	DefaultShutdownTimeout = 2 * time.Minute
+)
+
+// DrainHandler tracks requests in flight. Once draining, new requests are
+// rejected with 503 Service Unavailable.
+type DrainHandler struct {
+	Next http.Handler
+
+	lk       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+func (h *DrainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lk.Lock()
+	if h.draining {
+		h.lk.Unlock()
+		w.Header().Set("Connection", "close")
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	h.inflight.Add(1)
+	h.lk.Unlock()
+
+	defer h.inflight.Done()
+	h.Next.ServeHTTP(w, r)
+}
+
+// Draining returns true once Drain was called
+func (h *DrainHandler) Draining() bool {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return h.draining
+}
+
+// Drain rejects new requests and waits for requests in flight to finish, or
+// for ctx to be done. Long-lived websocket connections count as in flight.
+func (h *DrainHandler) Drain(ctx context.Context) error {
+	h.lk.Lock()
+	h.draining = true
+	h.lk.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownConfig controls MonitorShutdown
+type ShutdownConfig struct {
+	// Grace is how long in-flight RPCs can run before the server is closed
+	Grace time.Duration
+	// Timeout limits the whole shutdown, after which the process exits
+	Timeout time.Duration
+
+	// Drain, when set, is called before the shutdown starts, and can wait for
+	// work in progress to finish. The Timeout applies after it returns.
+	Drain func(context.Context) error
+	// DrainTimeout limits the time Drain can take, zero means no limit. A
+	// second signal also stops waiting.
+	DrainTimeout time.Duration
+}
+
+// MonitorShutdown waits for a signal or triggerCh, then shuts the process down
+// in order: new RPCs are rejected with 503 and in-flight RPCs get the grace
+// period, the RPC server is closed, then the node is stopped, which stops
+// subsystems like the sealing FSM before the datastore is closed.
+//
+// The returned channel is closed once shutdown completed. If it doesn't
+// complete within the timeout the process exits with a non-zero code.
+func MonitorShutdown(triggerCh <-chan struct{}, cfg ShutdownConfig, drain *DrainHandler, srv *http.Server, stop StopFunc) <-chan struct{} {
+	sigCh := make(chan os.Signal, 2)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			log.Warnw("received shutdown", "signal", sig)
+		case <-triggerCh:
+			log.Warn("received shutdown")
+		}
+
+		if cfg.Drain != nil {
+			drainWork(cfg, sigCh)
+		}
+
+		log.Warn("Shutting down...")
+
+		if cfg.Timeout > 0 {
+			force := time.AfterFunc(cfg.Timeout, func() {
+				log.Errorw("shutdown timed out, exiting", "timeout", cfg.Timeout)
+				_ = log.Sync() //nolint:errcheck
+				os.Exit(1)
+			})
+			defer force.Stop()
+		}
+
+		if err := shutdownRPC(cfg.Grace, drain, srv); err != nil {
+			log.Errorf("shutting down RPC server failed: %s", err)
+		}
+
+		if err := stop(context.TODO()); err != nil {
+			log.Errorf("graceful shutting down failed: %s", err)
+		}
+
+		log.Warn("Graceful shutdown successful")
+		_ = log.Sync() //nolint:errcheck
+		close(done)
+	}()
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+
+	return done
+}
+
+func drainWork(cfg ShutdownConfig, sigCh <-chan os.Signal) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if cfg.DrainTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			log.Warnw("received second signal, not waiting for drain", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Warn("Draining before shutdown, send the signal again to shut down now")
+	if err := cfg.Drain(ctx); err != nil {
+		log.Warnf("drain incomplete: %s", err)
+	}
+}
+
+func shutdownRPC(grace time.Duration, drain *DrainHandler, srv *http.Server) error {
+	ctx := context.Background()
+	if grace > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grace)
+		defer cancel()
+	}
+
+	if drain != nil {
+		if err := drain.Drain(ctx); err != nil {
+			log.Warnw("RPCs still in flight after grace period", "grace", grace)
+		}
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		if xerrors.Is(err, context.DeadlineExceeded) {
+			return srv.Close()
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package webui
+
+import (
+	"html/template"
+	"time"
+)
+
+var funcs = template.FuncMap{
+	"fmtTime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	},
+}
+
+const header = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Lotus Miner</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+td, th { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: left; }
+.err { color: #b00; }
+.timeline { border-left: 3px solid #ccc; margin-left: 1em; padding-left: 1.5em; }
+.ev { position: relative; margin-bottom: 1em; }
+.ev::before { content: ""; position: absolute; left: -1.95em; top: 0.3em; width: 0.7em; height: 0.7em; border-radius: 50%; background: #888; }
+.ev.event::before { background: #27a; }
+.ev.error::before { background: #b00; }
+.ev.queued::before { background: #ca0; }
+.ev.assigned::before { background: #2a5; }
+.when { color: #777; font-size: 0.85em; }
+.detail { font-size: 0.9em; }
+pre { font-size: 0.8em; background: #f6f6f6; padding: 0.5em; overflow-x: auto; }
+</style>
+</head>
+<body>
+`
+
+const footer = `</body>
+</html>
+`
+
+var sectorsTmpl = template.Must(template.New("sectors").Funcs(funcs).Parse(header + `
+<h1>Sectors</h1>
+<table>
+<tr><th>Sector</th><th>State</th><th>Deals</th><th>Last update</th><th></th></tr>
+{{range .Data}}
+<tr>
+<td><a href="{{call $.Link (printf "%s/sector/%d" $.Base .ID)}}">{{.ID}}</a></td>
+<td>{{.State}}</td>
+<td>{{.Deals}}</td>
+<td>{{fmtTime .Updated}}</td>
+<td class="err">{{.LastErr}}</td>
+</tr>
+{{end}}
+</table>
+` + footer))
+
+var sectorTmpl = template.Must(template.New("sector").Funcs(funcs).Parse(header + `
+{{with .Data}}
+<p><a href="{{call $.Link (printf "%s/" $.Base)}}">&larr; all sectors</a></p>
+<h1>Sector {{.Info.SectorID}}</h1>
+<p>State: <b>{{.Info.State}}</b>{{if .Info.LastErr}} <span class="err">{{.Info.LastErr}}</span>{{end}}</p>
+
+<h2>Chain</h2>
+<table>
+<tr><th>Ticket epoch</th><td>{{.Info.Ticket.Epoch}}</td></tr>
+<tr><th>PreCommit message</th><td>{{with .Info.PreCommitMsg}}{{.}}{{else}}-{{end}}</td></tr>
+<tr><th>Seed epoch</th><td>{{.Info.Seed.Epoch}}</td></tr>
+<tr><th>Commit message</th><td>{{with .Info.CommitMsg}}{{.}}{{else}}-{{end}}</td></tr>
+<tr><th>Activation</th><td>{{.Info.Activation}}</td></tr>
+<tr><th>Expiration</th><td>{{.Info.Expiration}}</td></tr>
+<tr><th>Deals</th><td>{{range .Info.Deals}}{{.}} {{else}}-{{end}}</td></tr>
+</table>
+
+{{if .Messages}}
+<h3>Messages</h3>
+<table>
+<tr><th>Sent</th><th>Event</th><th>Message</th></tr>
+{{range .Messages}}
+<tr><td>{{fmtTime .Time}}</td><td>{{.Event}}</td><td>{{.Cid}}</td></tr>
+{{end}}
+</table>
+{{end}}
+
+<h2>Workers</h2>
+{{if not .Workers}}
+<p>Open the UI with a token with admin permission to see the workers and task scheduling.</p>
+{{else if .Jobs}}
+<table>
+<tr><th>Task</th><th>Worker</th><th>State</th><th>Since</th></tr>
+{{range .Jobs}}
+<tr><td>{{.Task.Short}}</td><td>{{.Worker}}</td><td>{{if eq .RunWait 0}}running{{else}}assigned{{end}}</td><td>{{fmtTime .Start}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No tasks running.</p>
+{{end}}
+
+<h2>Timeline</h2>
+<div class="timeline">
+{{range .Timeline}}
+<div class="ev {{.Kind}}">
+<div class="when">{{fmtTime .Time}}{{if .Since}} (+{{.Since}}){{end}}</div>
+<div><b>{{.Title}}</b></div>
+{{if .Detail}}<div class="detail">{{.Detail}}</div>{{end}}
+{{if .Trace}}<pre>{{.Trace}}</pre>{{end}}
+</div>
+{{end}}
+</div>
+{{end}}
+` + footer))
@@ -0,0 +1,127 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+// Event is an entry in the timeline of a sector
+type Event struct {
+	Time time.Time
+	// Kind is one of "event", "error", "queued", "assigned" or "log"
+	Kind   string
+	Title  string
+	Detail string
+	Trace  string
+
+	// Since is the time passed since the previous event
+	Since time.Duration
+}
+
+// ChainMessage is a message sent for a sector
+type ChainMessage struct {
+	Time  time.Time
+	Event string
+	Cid   cid.Cid
+}
+
+// ChainMessages returns the messages sent for a sector, oldest first. Unlike
+// the sector info, which only has the last PreCommit and Commit messages,
+// these include messages replaced by retries.
+func ChainMessages(info api.SectorInfo) []ChainMessage {
+	var out []ChainMessage
+	for _, l := range info.Log {
+		if !strings.HasPrefix(l.Kind, "event;") {
+			continue
+		}
+
+		// the log has the events as JSON, events sending messages have the
+		// message CID in the Message field
+		var evt struct {
+			Message *cid.Cid
+		}
+		if err := json.Unmarshal([]byte(l.Message), &evt); err != nil || evt.Message == nil {
+			continue
+		}
+
+		out = append(out, ChainMessage{
+			Time:  time.Unix(int64(l.Timestamp), 0),
+			Event: eventName(l.Kind),
+			Cid:   *evt.Message,
+		})
+	}
+	return out
+}
+
+func eventName(kind string) string {
+	return kind[strings.LastIndex(kind, ".")+1:]
+}
+
+// Timeline merges the state machine log of a sector with its task scheduling
+// history, ordered by time
+func Timeline(info api.SectorInfo, sched []storiface.SchedExplanation, workers map[uint64]string) []Event {
+	var out []Event
+
+	for _, l := range info.Log {
+		e := Event{
+			Time:   time.Unix(int64(l.Timestamp), 0),
+			Kind:   "log",
+			Title:  l.Kind,
+			Detail: l.Message,
+			Trace:  l.Trace,
+		}
+		if strings.HasPrefix(l.Kind, "event;") {
+			e.Kind = "event"
+			e.Title = eventName(l.Kind)
+			e.Detail = ""
+			if l.Trace != "" {
+				e.Kind = "error"
+				e.Detail = l.Message
+			}
+		}
+		out = append(out, e)
+	}
+
+	for _, s := range sched {
+		out = append(out, Event{
+			Time:   s.Queued,
+			Kind:   "queued",
+			Title:  fmt.Sprintf("%s queued", s.Task.Short()),
+			Detail: fmt.Sprintf("task %d, priority %d", s.TaskID, s.Priority),
+		})
+		if s.Assigned {
+			detail := s.Reason
+			if s.Preempted > 0 {
+				detail += fmt.Sprintf(", preempted %d times", s.Preempted)
+			}
+			out = append(out, Event{
+				Time:   s.AssignedAt,
+				Kind:   "assigned",
+				Title:  fmt.Sprintf("%s assigned to %s", s.Task.Short(), workerName(workers, s.AssignedWorker)),
+				Detail: detail,
+			})
+		}
+	}
+
+	// the sector log only has second precision, keep its order within a
+	// second and place scheduling events after log entries of the same time
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time.Truncate(time.Second).Before(out[j].Time.Truncate(time.Second))
+	})
+
+	for i := 1; i < len(out); i++ {
+		if d := out[i].Time.Sub(out[i-1].Time); d > 0 {
+			out[i].Since = d.Truncate(time.Second)
+		}
+	}
+
+	return out
+}
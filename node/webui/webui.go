@@ -0,0 +1,210 @@
+package webui
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+var log = logging.Logger("webui")
+
+// Handler serves a read-only web UI for a storage miner. It must be mounted
+// behind the API auth handler. Pages need a token with read permission, which
+// browsers can pass with ?token=<token>; worker details and scheduling
+// decisions are only shown with admin permission.
+type Handler struct {
+	miner  api.StorageMiner
+	prefix string
+	r      *mux.Router
+}
+
+// New creates a web UI serving pages under prefix
+func New(prefix string, miner api.StorageMiner) *Handler {
+	h := &Handler{miner: miner, prefix: strings.TrimSuffix(prefix, "/")}
+
+	h.r = mux.NewRouter()
+	h.r.HandleFunc(h.prefix, func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		u.Path += "/"
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	})
+	h.r.HandleFunc(h.prefix+"/", h.sectors).Methods("GET")
+	h.r.HandleFunc(h.prefix+"/sector/{id}", h.sector).Methods("GET")
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !auth.HasPerm(r.Context(), nil, apistruct.PermRead) {
+		w.WriteHeader(401)
+		_, _ = w.Write([]byte("unauthorized: open the UI with ?token=<API token with read permission>\n"))
+		return
+	}
+
+	h.r.ServeHTTP(w, r)
+}
+
+type sectorRow struct {
+	ID      abi.SectorNumber
+	State   api.SectorState
+	Updated time.Time
+	Deals   int
+	LastErr string
+}
+
+func (h *Handler) sectors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// one query instead of a status call per sector
+	res, err := h.miner.SectorsQuery(ctx, api.SectorQuery{SortBy: "number", Desc: true})
+	if err != nil {
+		h.fail(w, xerrors.Errorf("querying sectors: %w", err))
+		return
+	}
+
+	rows := make([]sectorRow, 0, len(res.Sectors))
+	for _, s := range res.Sectors {
+		rows = append(rows, sectorRow{
+			ID:      s.Sector,
+			State:   s.State,
+			Updated: s.Updated,
+			Deals:   len(s.Deals),
+			LastErr: s.LastErr,
+		})
+	}
+
+	h.render(w, r, sectorsTmpl, rows)
+}
+
+type sectorPage struct {
+	Info     api.SectorInfo
+	Messages []ChainMessage
+	Timeline []Event
+
+	// Workers is false when the token can't list workers and scheduling
+	// decisions
+	Workers bool
+	Jobs    []assignedJob
+}
+
+type assignedJob struct {
+	storiface.WorkerJob
+	Worker string
+}
+
+func (h *Handler) sector(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	sid := abi.SectorNumber(id)
+
+	info, err := h.miner.SectorsStatus(ctx, sid, true)
+	if err != nil {
+		h.fail(w, xerrors.Errorf("getting sector status: %w", err))
+		return
+	}
+
+	page := sectorPage{
+		Info:     info,
+		Messages: ChainMessages(info),
+		// the worker and scheduler methods need admin permission
+		Workers: auth.HasPerm(ctx, nil, apistruct.PermAdmin),
+	}
+
+	workers := map[uint64]string{}
+	jobs := map[uint64][]storiface.WorkerJob{}
+	var sched []storiface.SchedExplanation
+	if page.Workers {
+		stats, err := h.miner.WorkerStats(ctx)
+		if err != nil {
+			h.fail(w, xerrors.Errorf("getting worker stats: %w", err))
+			return
+		}
+		for wid, st := range stats {
+			workers[wid] = st.Info.Hostname
+		}
+
+		jobs, err = h.miner.WorkerJobs(ctx)
+		if err != nil {
+			h.fail(w, xerrors.Errorf("getting worker jobs: %w", err))
+			return
+		}
+
+		sched, err = h.miner.SealingSchedSectorHistory(ctx, sid)
+		if err != nil {
+			h.fail(w, xerrors.Errorf("getting scheduling history: %w", err))
+			return
+		}
+	}
+
+	page.Timeline = Timeline(info, sched, workers)
+	for wid, wjobs := range jobs {
+		for _, job := range wjobs {
+			if job.Sector.Number != sid {
+				continue
+			}
+			page.Jobs = append(page.Jobs, assignedJob{WorkerJob: job, Worker: workerName(workers, wid)})
+		}
+	}
+	sort.Slice(page.Jobs, func(i, j int) bool { return page.Jobs[i].ID < page.Jobs[j].ID })
+
+	h.render(w, r, sectorTmpl, page)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	log.Warnf("webui: %s", err)
+	w.WriteHeader(500)
+	_, _ = w.Write([]byte(err.Error()))
+}
+
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, t *template.Template, data interface{}) {
+	// links carry the token the page was opened with, browsers can't send
+	// the Authorization header when following them
+	token := r.FormValue("token")
+	link := func(path string) string {
+		if token == "" {
+			return path
+		}
+		return path + "?token=" + url.QueryEscape(token)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := t.Execute(w, struct {
+		Base string
+		Data interface{}
+		Link func(string) string
+	}{
+		Base: h.prefix,
+		Data: data,
+		Link: link,
+	})
+	if err != nil {
+		log.Warnf("webui: rendering %s: %s", r.URL.Path, err)
+	}
+}
+
+func workerName(workers map[uint64]string, wid uint64) string {
+	if name, ok := workers[wid]; ok && name != "" {
+		return name
+	}
+	return "worker " + strconv.FormatUint(wid, 10)
+}
@@ -0,0 +1,112 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/api/apistruct"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+func TestTimeline(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+
+	info := api.SectorInfo{
+		Log: []api.SectorLog{
+			{Kind: "event;sealing.SectorStart", Timestamp: uint64(start.Unix())},
+			{Kind: "event;sealing.SectorPacked", Timestamp: uint64(start.Unix()) + 60},
+			{Kind: "event;sealing.SectorSealPreCommit1Failed", Timestamp: uint64(start.Unix()) + 600, Message: "boom", Trace: "trace"},
+		},
+	}
+	sched := []storiface.SchedExplanation{{
+		TaskID:         1,
+		Task:           sealtasks.TTPreCommit1,
+		Queued:         start.Add(60*time.Second + 100*time.Millisecond),
+		Assigned:       true,
+		AssignedWorker: 3,
+		AssignedAt:     start.Add(120 * time.Second),
+		Reason:         "assigned to the most preferred worker",
+	}}
+
+	tl := Timeline(info, sched, map[uint64]string{3: "sealer-1"})
+	require.Len(t, tl, 5)
+
+	require.Equal(t, "SectorStart", tl[0].Title)
+	require.Equal(t, "SectorPacked", tl[1].Title)
+	require.Equal(t, time.Minute, tl[1].Since)
+	require.Equal(t, "queued", tl[2].Kind)
+	require.Equal(t, "assigned", tl[3].Kind)
+	require.Equal(t, "PC1 assigned to sealer-1", tl[3].Title)
+	require.Equal(t, "error", tl[4].Kind)
+	require.Equal(t, "boom", tl[4].Detail)
+	require.Equal(t, 8*time.Minute, tl[4].Since)
+}
+
+type testMiner struct {
+	api.StorageMiner
+}
+
+func (testMiner) SectorsQuery(ctx context.Context, q api.SectorQuery) (api.SectorQueryResult, error) {
+	return api.SectorQueryResult{Total: 2, Sectors: []api.SectorMeta{
+		{Sector: 2, State: "Proving"},
+		{Sector: 1, State: "Proving"},
+	}}, nil
+}
+
+func (testMiner) SectorsStatus(ctx context.Context, id abi.SectorNumber, _ bool) (api.SectorInfo, error) {
+	return api.SectorInfo{SectorID: id, State: "Proving", Log: []api.SectorLog{
+		{Kind: "event;sealing.SectorPreCommitted", Message: `{"Message":{"/":"bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4"}}`},
+	}}, nil
+}
+
+func TestHandlerAuth(t *testing.T) {
+	h := New("/ui", testMiner{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/ui/", nil))
+	require.Equal(t, 401, rec.Code)
+
+	req := httptest.NewRequest("GET", "/ui/?token=tok", nil)
+	req = req.WithContext(auth.WithPerm(req.Context(), []auth.Permission{apistruct.PermRead}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, strings.Contains(rec.Body.String(), `href="/ui/sector/2?token=tok"`), rec.Body.String())
+
+	// the worker and scheduler methods need admin permission, testMiner
+	// panics on them
+	req = httptest.NewRequest("GET", "/ui/sector/2?token=tok", nil)
+	req = req.WithContext(auth.WithPerm(req.Context(), []auth.Permission{apistruct.PermRead}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "token with admin permission")
+	require.Contains(t, rec.Body.String(), "bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4")
+}
+
+func TestChainMessages(t *testing.T) {
+	msgs := ChainMessages(api.SectorInfo{Log: []api.SectorLog{
+		{Kind: "event;sealing.SectorPreCommitted", Timestamp: 1, Message: `{"Message":{"/":"bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4"},"PreCommitDeposit":"0"}`},
+		{Kind: "event;sealing.SectorChainPreCommitFailed", Timestamp: 2, Message: `{}`},
+		{Kind: "event;sealing.SectorPreCommitted", Timestamp: 3, Message: `{"Message":{"/":"bafy2bzacedmbkbb2q7pn6al7lcxw3oqkcmufhm7lz6irq4gwqrbqx5n2bxkke"}}`},
+		{Kind: "event;sealing.SectorCommitFailed", Timestamp: 4, Message: `{"Message":"not a cid"}`},
+		{Kind: "log", Timestamp: 5, Message: `{"Message":{"/":"bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4"}}`},
+	}})
+
+	require.Len(t, msgs, 2, "retried messages are listed too")
+	require.Equal(t, "SectorPreCommitted", msgs[0].Event)
+	require.Equal(t, "bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4", msgs[0].Cid.String())
+	require.Equal(t, "bafy2bzacedmbkbb2q7pn6al7lcxw3oqkcmufhm7lz6irq4gwqrbqx5n2bxkke", msgs[1].Cid.String())
+	require.Equal(t, time.Unix(3, 0), msgs[1].Time)
+}
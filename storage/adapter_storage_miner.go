@@ -14,6 +14,7 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/dline"
 
 	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
 	market0 "github.com/filecoin-project/specs-actors/actors/builtin/market"
@@ -27,6 +28,7 @@ import (
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+	"github.com/filecoin-project/lotus/storage/syncgate"
 )
 
 var _ sealing.SealingAPI = new(SealingAPIAdapter)
@@ -94,6 +96,58 @@ func (s SealingAPIAdapter) StateMinerDeadlines(ctx context.Context, maddr addres
 	return s.delegate.StateMinerDeadlines(ctx, maddr, tsk)
 }
 
+func (s SealingAPIAdapter) StateMinerProvingDeadline(ctx context.Context, maddr address.Address, tok sealing.TipSetToken) (*dline.Info, error) {
+	tsk, err := types.TipSetKeyFromBytes(tok)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal TipSetToken to TipSetKey: %w", err)
+	}
+
+	return s.delegate.StateMinerProvingDeadline(ctx, maddr, tsk)
+}
+
+func (s SealingAPIAdapter) StateMinerDeadlineLoads(ctx context.Context, maddr address.Address, tok sealing.TipSetToken) (*sealing.DeadlineLoads, error) {
+	tsk, err := types.TipSetKeyFromBytes(tok)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal TipSetToken to TipSetKey: %w", err)
+	}
+
+	mi, err := s.delegate.StateMinerInfo(ctx, maddr, tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner info: %w", err)
+	}
+	deadlines, err := s.delegate.StateMinerDeadlines(ctx, maddr, tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("getting deadlines: %w", err)
+	}
+
+	out := &sealing.DeadlineLoads{
+		PartitionSectors: mi.WindowPoStPartitionSectors,
+		Deadlines:        make([]sealing.DeadlineLoad, len(deadlines)),
+	}
+	for dlIdx := range deadlines {
+		partitions, err := s.delegate.StateMinerPartitions(ctx, maddr, uint64(dlIdx), tsk)
+		if err != nil {
+			return nil, xerrors.Errorf("getting partitions of deadline %d: %w", dlIdx, err)
+		}
+
+		for _, partition := range partitions {
+			all, err := partition.AllSectors.Count()
+			if err != nil {
+				return nil, xerrors.Errorf("counting sectors of deadline %d: %w", dlIdx, err)
+			}
+			live, err := partition.LiveSectors.Count()
+			if err != nil {
+				return nil, xerrors.Errorf("counting live sectors of deadline %d: %w", dlIdx, err)
+			}
+
+			out.Deadlines[dlIdx].TotalSectors += all
+			out.Deadlines[dlIdx].LiveSectors += live
+		}
+	}
+
+	return out, nil
+}
+
 func (s SealingAPIAdapter) StateWaitMsg(ctx context.Context, mcid cid.Cid) (sealing.MsgLookup, error) {
 	wmsg, err := s.delegate.StateWaitMsg(ctx, mcid, build.MessageConfidence)
 	if err != nil {
@@ -267,7 +321,7 @@ func (s SealingAPIAdapter) SendMsg(ctx context.Context, from, to address.Address
 		Params: params,
 	}
 
-	smsg, err := s.delegate.MpoolPushMessage(ctx, &msg, &api.MessageSendSpec{MaxFee: maxFee})
+	smsg, err := s.delegate.MpoolPushMessage(syncgate.Wait(ctx), &msg, &api.MessageSendSpec{MaxFee: maxFee})
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -0,0 +1,175 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+// Names of the metrics reported by the miner, as exported to Prometheus
+// under the lotus namespace
+const (
+	MetricWorkerBalance     = "lotus_miner_worker_balance"
+	MetricFaultySectors     = "lotus_miner_faulty_sectors"
+	MetricDeadlineUnproven  = "lotus_miner_deadline_unproven_partitions"
+	MetricDeadlineRemaining = "lotus_miner_deadline_remaining_seconds"
+	MetricWorkers           = "lotus_miner_workers"
+	MetricCronFailedJobs    = "lotus_miner_cron_failed_jobs"
+	MetricExpiredPreCommits = "lotus_miner_expired_precommits"
+)
+
+// Rules returns the alert rules for the configured thresholds
+func Rules(cfg config.AlertsConfig) []api.AlertRule {
+	forDur := time.Duration(cfg.For)
+
+	return []api.AlertRule{
+		{
+			Name:     "MinerWorkerBalanceLow",
+			Expr:     fmt.Sprintf("%s < %s", MetricWorkerBalance, filNumber(cfg.MinWorkerBalance)),
+			For:      forDur,
+			Severity: "warning",
+			Summary:  fmt.Sprintf("worker wallet balance below %s", cfg.MinWorkerBalance),
+		},
+		{
+			Name:     "MinerFaultySectors",
+			Expr:     fmt.Sprintf("%s > %d", MetricFaultySectors, cfg.MaxFaultySectors),
+			For:      forDur,
+			Severity: "critical",
+			Summary:  fmt.Sprintf("more than %d faulty sectors", cfg.MaxFaultySectors),
+		},
+		{
+			// deadlines are shorter than For, so this fires right away
+			Name:     "MinerDeadlineUnproven",
+			Expr:     fmt.Sprintf("%s > 0 and %s < %d", MetricDeadlineUnproven, MetricDeadlineRemaining, int64(time.Duration(cfg.DeadlineMargin).Seconds())),
+			Severity: "critical",
+			Summary:  fmt.Sprintf("current deadline has unproven partitions %s before it closes", time.Duration(cfg.DeadlineMargin)),
+		},
+		{
+			Name:     "MinerWorkersMissing",
+			Expr:     fmt.Sprintf("%s < %d", MetricWorkers, cfg.MinWorkers),
+			For:      forDur,
+			Severity: "warning",
+			Summary:  fmt.Sprintf("fewer than %d workers connected", cfg.MinWorkers),
+		},
+		{
+			// stays firing until the next successful run of the job
+			Name:     "MinerCronJobFailed",
+			Expr:     fmt.Sprintf("%s > 0", MetricCronFailedJobs),
+			For:      forDur,
+			Severity: "warning",
+			Summary:  "last run of a cron job failed, see 'lotus-miner cron list'",
+		},
+		{
+			// the counter only grows, so this stays firing for a day
+			Name:     "MinerPreCommitExpired",
+			Expr:     fmt.Sprintf("increase(%s[1d]) > 0", MetricExpiredPreCommits),
+			For:      forDur,
+			Severity: "warning",
+			Summary:  "precommit expired before the sector was proven, see 'lotus-miner analytics expired-precommits'",
+		},
+	}
+}
+
+func filNumber(f types.FIL) string {
+	return strings.TrimSuffix(f.String(), " FIL")
+}
+
+// PrometheusRules renders the rules as a Prometheus alerting rules file
+func PrometheusRules(rules []api.AlertRule) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("groups:\n")
+	b.WriteString("  - name: lotus-miner\n")
+	b.WriteString("    rules:\n")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "      - alert: %s\n", r.Name)
+		fmt.Fprintf(&b, "        expr: %q\n", r.Expr)
+		if r.For > 0 {
+			fmt.Fprintf(&b, "        for: %s\n", promDuration(r.For))
+		}
+		b.WriteString("        labels:\n")
+		fmt.Fprintf(&b, "          severity: %s\n", r.Severity)
+		b.WriteString("        annotations:\n")
+		fmt.Fprintf(&b, "          summary: %q\n", "{{ $labels.miner_id }}: "+r.Summary)
+	}
+
+	return b.Bytes()
+}
+
+// promDuration formats durations the way Prometheus parses them, which
+// doesn't accept fractions or the 'h0m0s' style of time.Duration
+func promDuration(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaPanel struct {
+	ID          int             `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Type        string          `json:"type"`
+	Datasource  string          `json:"datasource"`
+	GridPos     grafanaGridPos  `json:"gridPos"`
+	Targets     []grafanaTarget `json:"targets"`
+}
+
+type grafanaDashboard struct {
+	Title         string         `json:"title"`
+	UID           string         `json:"uid"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Tags          []string       `json:"tags"`
+	Panels        []grafanaPanel `json:"panels"`
+}
+
+// GrafanaDashboard renders a Grafana dashboard with a panel per rule, showing
+// the metrics the rule is evaluated on
+func GrafanaDashboard(rules []api.AlertRule, datasource string) ([]byte, error) {
+	d := grafanaDashboard{
+		Title:         "Lotus Miner Alerts",
+		UID:           "lotus-miner-alerts",
+		SchemaVersion: 22,
+		Tags:          []string{"lotus", "miner"},
+	}
+
+	for i, r := range rules {
+		d.Panels = append(d.Panels, grafanaPanel{
+			ID:          i + 1,
+			Title:       r.Name,
+			Description: r.Summary,
+			Type:        "graph",
+			Datasource:  datasource,
+			GridPos:     grafanaGridPos{H: 8, W: 12, X: (i % 2) * 12, Y: (i / 2) * 8},
+			Targets: []grafanaTarget{{
+				Expr:         r.Expr,
+				LegendFormat: "{{miner_id}}",
+				RefID:        "A",
+			}},
+		})
+	}
+
+	return json.MarshalIndent(d, "", "  ")
+}
@@ -0,0 +1,38 @@
+package alerts
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+func TestRules(t *testing.T) {
+	cfg := config.DefaultStorageMiner().Alerts
+	bal, err := types.ParseFIL("2.5")
+	require.NoError(t, err)
+	cfg.MinWorkerBalance = bal
+	cfg.For = config.Duration(90 * time.Second)
+
+	rules := Rules(cfg)
+	require.Equal(t, MetricWorkerBalance+" < 2.5", rules[0].Expr)
+	require.Equal(t, MetricDeadlineUnproven+" > 0 and "+MetricDeadlineRemaining+" < 600", rules[2].Expr)
+
+	prom := string(PrometheusRules(rules))
+	require.Contains(t, prom, "      - alert: MinerWorkerBalanceLow\n")
+	require.Contains(t, prom, "        for: 90s\n")
+	require.Equal(t, len(rules)-1, strings.Count(prom, "        for: "), "deadline rule fires without delay")
+
+	b, err := GrafanaDashboard(rules, "Prometheus")
+	require.NoError(t, err)
+
+	var d grafanaDashboard
+	require.NoError(t, json.Unmarshal(b, &d))
+	require.Len(t, d.Panels, len(rules))
+	require.Equal(t, rules[1].Expr, d.Panels[1].Targets[0].Expr)
+}
@@ -0,0 +1,151 @@
+package alerts
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/metrics"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+var log = logging.Logger("alerts")
+
+// Reporter periodically records the metrics the alert rules are evaluated on
+type Reporter struct {
+	api     api.FullNode
+	maddr   address.Address
+	workers func(context.Context) (int, error)
+	cfg     config.AlertsConfig
+}
+
+func NewReporter(api api.FullNode, maddr address.Address, workers func(context.Context) (int, error), cfg config.AlertsConfig) *Reporter {
+	return &Reporter{
+		api:     api,
+		maddr:   maddr,
+		workers: workers,
+		cfg:     cfg,
+	}
+}
+
+// Rules returns the alert rules for the configured thresholds
+func (r *Reporter) Rules() []api.AlertRule {
+	return Rules(r.cfg)
+}
+
+func (r *Reporter) Run(ctx context.Context) error {
+	interval := time.Duration(r.cfg.ReportInterval)
+	if interval <= 0 {
+		return nil
+	}
+
+	ctx, err := tag.New(ctx, tag.Insert(metrics.MinerID, r.maddr.String()))
+	if err != nil {
+		return xerrors.Errorf("tagging metrics: %w", err)
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := r.report(ctx); err != nil {
+			log.Warnf("reporting alert metrics: %+v", err)
+			crash.Failure(ctx, err)
+		} else {
+			crash.Success(ctx)
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Reporter) report(ctx context.Context) error {
+	head, err := r.api.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	mi, err := r.api.StateMinerInfo(ctx, r.maddr, head.Key())
+	if err != nil {
+		return xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	bal, err := r.api.WalletBalance(ctx, mi.Worker)
+	if err != nil {
+		return xerrors.Errorf("getting worker balance: %w", err)
+	}
+	fil, _ := new(big.Rat).SetFrac(bal.Int, big.NewInt(int64(build.FilecoinPrecision))).Float64()
+
+	faults, err := r.api.StateMinerFaults(ctx, r.maddr, head.Key())
+	if err != nil {
+		return xerrors.Errorf("getting faults: %w", err)
+	}
+	faultCount, err := faults.Count()
+	if err != nil {
+		return xerrors.Errorf("counting faults: %w", err)
+	}
+
+	di, err := r.api.StateMinerProvingDeadline(ctx, r.maddr, head.Key())
+	if err != nil {
+		return xerrors.Errorf("getting proving deadline: %w", err)
+	}
+	unproven, err := r.unprovenPartitions(ctx, di.Index, head.Key())
+	if err != nil {
+		return err
+	}
+
+	workers, err := r.workers(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting workers: %w", err)
+	}
+
+	stats.Record(ctx,
+		metrics.MinerWorkerBalance.M(fil),
+		metrics.MinerFaultySectors.M(int64(faultCount)),
+		metrics.MinerDeadlineUnproven.M(int64(unproven)),
+		metrics.MinerDeadlineRemaining.M(float64(di.Close-di.CurrentEpoch)*float64(build.BlockDelaySecs)),
+		metrics.MinerWorkers.M(int64(workers)),
+	)
+
+	return nil
+}
+
+func (r *Reporter) unprovenPartitions(ctx context.Context, dlIdx uint64, tsk types.TipSetKey) (uint64, error) {
+	parts, err := r.api.StateMinerPartitions(ctx, r.maddr, dlIdx, tsk)
+	if err != nil {
+		return 0, xerrors.Errorf("getting partitions: %w", err)
+	}
+
+	deadlines, err := r.api.StateMinerDeadlines(ctx, r.maddr, tsk)
+	if err != nil {
+		return 0, xerrors.Errorf("getting deadlines: %w", err)
+	}
+	if dlIdx >= uint64(len(deadlines)) {
+		return 0, xerrors.Errorf("deadline %d out of range", dlIdx)
+	}
+
+	proven, err := deadlines[dlIdx].PostSubmissions.Count()
+	if err != nil {
+		return 0, xerrors.Errorf("counting proven partitions: %w", err)
+	}
+
+	if proven > uint64(len(parts)) {
+		return 0, nil
+	}
+	return uint64(len(parts)) - proven, nil
+}
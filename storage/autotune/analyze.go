@@ -0,0 +1,343 @@
+package autotune
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+var (
+	// MinRuns is the number of successful runs needed to compare the
+	// performance of a setting value, or of a parallelism
+	MinRuns = 3
+	// MinGain is the relative improvement of the median task duration
+	// another setting value needs to be suggested
+	MinGain = 0.05
+	// MaxSealingSlack is the relative difference from the suggested
+	// MaxSealingSectors tolerated before a change is suggested
+	MaxSealingSlack = 0.2
+)
+
+// settingTasks are the tasks whose duration each worker setting affects
+var settingTasks = map[string][]sealtasks.TaskType{
+	"FIL_PROOFS_USE_MULTICORE_SDR":             {sealtasks.TTPreCommit1},
+	"FIL_PROOFS_MULTICORE_SDR_PRODUCERS":       {sealtasks.TTPreCommit1},
+	"FIL_PROOFS_MULTICORE_SDR_PRODUCER_STRIDE": {sealtasks.TTPreCommit1},
+	"FIL_PROOFS_MAXIMIZE_CACHING":              {sealtasks.TTPreCommit1},
+	"FIL_PROOFS_USE_GPU_COLUMN_BUILDER":        {sealtasks.TTPreCommit2},
+	"FIL_PROOFS_USE_GPU_TREE_BUILDER":          {sealtasks.TTPreCommit2},
+	"FIL_PROOFS_MAX_GPU_COLUMN_BATCH_SIZE":     {sealtasks.TTPreCommit2},
+	"FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE":       {sealtasks.TTPreCommit2},
+	"FIL_PROOFS_COLUMN_WRITE_BATCH_SIZE":       {sealtasks.TTPreCommit2},
+	"BELLMAN_NO_GPU":                           {sealtasks.TTPreCommit2, sealtasks.TTCommit2},
+}
+
+// multicoreSDRCores is the number of cores from which multicore SDR is
+// suggested for PC1 workers which never tried it
+const multicoreSDRCores = 16
+
+type stageKey struct {
+	worker string
+	task   sealtasks.TaskType
+}
+
+// Analyze summarizes task runs by worker and task type, and suggests tuning
+// changes:
+//  - worker settings, values tried on a worker are compared by the median
+//    duration of the tasks they affect; settings for multicore SDR and GPU
+//    tree building are suggested for workers which never tried them
+//  - Sealing.MaxSealingSectors, from the number of PC1s workers run at once
+//    with the best throughput, and how long sectors take to seal compared
+//    to PC1
+//
+// Applied worker settings which workers didn't pick up yet aren't suggested
+// again.
+func Analyze(runs []storiface.TaskRun, maxSealing uint64, applied map[string]map[string]string) api.TuneReport {
+	out := api.TuneReport{
+		Runs:        len(runs),
+		Stages:      []api.TuneStage{},
+		Suggestions: []api.TuneSuggestion{},
+	}
+	if len(runs) == 0 {
+		return out
+	}
+	out.Since = runs[0].Start
+
+	stages := map[stageKey][]storiface.TaskRun{}
+	var keys []stageKey
+	for _, r := range runs {
+		if r.Task == sealtasks.TTFetch || r.Task == sealtasks.TTReadUnsealed {
+			continue
+		}
+		k := stageKey{r.Worker, r.Task}
+		if _, ok := stages[k]; !ok {
+			keys = append(keys, k)
+		}
+		stages[k] = append(stages[k], r)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].worker != keys[j].worker {
+			return keys[i].worker < keys[j].worker
+		}
+		return keys[i].task.Less(keys[j].task)
+	})
+
+	for _, k := range keys {
+		out.Stages = append(out.Stages, stage(k, stages[k]))
+	}
+
+	suggest := func(s api.TuneSuggestion) {
+		if s.Worker != "" && applied[s.Worker][s.Setting] == s.Suggested {
+			return
+		}
+		out.Suggestions = append(out.Suggestions, s)
+	}
+
+	for _, k := range keys {
+		for setting, tasks := range settingTasks {
+			if tasks[0] != k.task {
+				continue
+			}
+
+			rs := stages[k]
+			if s, ok := compareSetting(k, setting, rs); ok {
+				suggest(s)
+			} else if s, ok := folklore(k, setting, rs); ok {
+				suggest(s)
+			}
+		}
+	}
+
+	if s, ok := suggestMaxSealing(runs, out.Stages, maxSealing); ok {
+		suggest(s)
+	}
+
+	sort.SliceStable(out.Suggestions, func(i, j int) bool {
+		if out.Suggestions[i].Worker != out.Suggestions[j].Worker {
+			return out.Suggestions[i].Worker < out.Suggestions[j].Worker
+		}
+		return out.Suggestions[i].Setting < out.Suggestions[j].Setting
+	})
+	return out
+}
+
+func stage(k stageKey, runs []storiface.TaskRun) api.TuneStage {
+	st := api.TuneStage{
+		Worker: k.worker,
+		Task:   k.task,
+		Runs:   len(runs),
+	}
+
+	var all []time.Duration
+	byParallel := map[int][]time.Duration{}
+	for _, r := range runs {
+		if r.Failed {
+			st.Failed++
+			continue
+		}
+		all = append(all, r.Duration)
+		byParallel[r.Parallel] = append(byParallel[r.Parallel], r.Duration)
+	}
+	st.Median = median(all)
+
+	for p, ds := range byParallel {
+		if len(ds) < MinRuns || p <= 0 {
+			continue
+		}
+		tp := float64(p) * float64(time.Hour) / float64(median(ds))
+		if tp > st.Throughput || (tp == st.Throughput && p < st.BestParallel) {
+			st.Throughput = tp
+			st.BestParallel = p
+		}
+	}
+	return st
+}
+
+// compareSetting suggests the value of a setting with which tasks finished
+// the fastest on the worker, out of the values tried with enough runs
+func compareSetting(k stageKey, setting string, runs []storiface.TaskRun) (api.TuneSuggestion, bool) {
+	byValue := map[string][]time.Duration{}
+	for _, r := range runs {
+		if r.Failed {
+			continue
+		}
+		byValue[r.Tuning[setting]] = append(byValue[r.Tuning[setting]], r.Duration)
+	}
+	if len(byValue) < 2 {
+		return api.TuneSuggestion{}, false
+	}
+
+	current := runs[len(runs)-1].Tuning[setting]
+	if len(byValue[current]) < MinRuns {
+		return api.TuneSuggestion{}, false
+	}
+	curMedian := median(byValue[current])
+
+	best, bestMedian := current, curMedian
+	for v, ds := range byValue {
+		if len(ds) < MinRuns {
+			continue
+		}
+		if m := median(ds); m < bestMedian || (m == bestMedian && v < best) {
+			best, bestMedian = v, m
+		}
+	}
+
+	if best == current || float64(bestMedian) > float64(curMedian)*(1-MinGain) {
+		return api.TuneSuggestion{}, false
+	}
+
+	return api.TuneSuggestion{
+		Worker:    k.worker,
+		Setting:   setting,
+		Current:   current,
+		Suggested: best,
+		Reason: fmt.Sprintf("%s took a median of %s with %s, %s with %s, over %d and %d runs",
+			k.task.Short(), bestMedian.Round(time.Second), showValue(setting, best), curMedian.Round(time.Second), showValue(setting, current), len(byValue[best]), len(byValue[current])),
+	}, true
+}
+
+// folklore suggests settings known to speed up sealing on most hardware,
+// for workers which never ran the tasks with another value of the setting
+func folklore(k stageKey, setting string, runs []storiface.TaskRun) (api.TuneSuggestion, bool) {
+	last := runs[len(runs)-1]
+	current := last.Tuning[setting]
+	for _, r := range runs {
+		if r.Tuning[setting] != current {
+			return api.TuneSuggestion{}, false
+		}
+	}
+
+	s := api.TuneSuggestion{
+		Worker:  k.worker,
+		Setting: setting,
+		Current: current,
+	}
+
+	switch setting {
+	case "FIL_PROOFS_USE_MULTICORE_SDR":
+		if current == "1" || last.CPUs < multicoreSDRCores {
+			return api.TuneSuggestion{}, false
+		}
+		s.Suggested = "1"
+		s.Reason = fmt.Sprintf("PC1 with multicore SDR is usually much faster on hosts with %d or more cores, the worker has %d", multicoreSDRCores, last.CPUs)
+	case "FIL_PROOFS_USE_GPU_COLUMN_BUILDER", "FIL_PROOFS_USE_GPU_TREE_BUILDER":
+		if current == "1" || last.GPUs == 0 || last.Tuning["BELLMAN_NO_GPU"] != "" {
+			return api.TuneSuggestion{}, false
+		}
+		s.Suggested = "1"
+		s.Reason = "building PC2 trees on the GPU is usually several times faster, the worker has a GPU"
+	default:
+		return api.TuneSuggestion{}, false
+	}
+	return s, true
+}
+
+// suggestMaxSealingSectors suggests a MaxSealingSectors which keeps the PC1
+// workers running the number of tasks they have the best throughput with.
+// Sectors spend more time sealing than in PC1, by the ratio of the median
+// time from the first to the last task of a sector to the median PC1.
+func suggestMaxSealing(runs []storiface.TaskRun, stages []api.TuneStage, current uint64) (api.TuneSuggestion, bool) {
+	var slots int
+	for _, st := range stages {
+		if st.Task != sealtasks.TTPreCommit1 {
+			continue
+		}
+		if st.BestParallel == 0 {
+			// not enough runs to tell
+			return api.TuneSuggestion{}, false
+		}
+		slots += st.BestParallel
+	}
+	if slots == 0 {
+		return api.TuneSuggestion{}, false
+	}
+
+	type span struct {
+		start, end        time.Time
+		hasPC1, hasCommit bool
+	}
+	sectors := map[abi.SectorID]*span{}
+	var pc1 []time.Duration
+	for _, r := range runs {
+		if r.Failed || r.Task == sealtasks.TTFetch || r.Task == sealtasks.TTReadUnsealed {
+			continue
+		}
+		sp, ok := sectors[r.Sector]
+		if !ok {
+			sp = &span{start: r.Start, end: r.Start.Add(r.Duration)}
+			sectors[r.Sector] = sp
+		}
+		if r.Start.Before(sp.start) {
+			sp.start = r.Start
+		}
+		if end := r.Start.Add(r.Duration); end.After(sp.end) {
+			sp.end = end
+		}
+		switch r.Task {
+		case sealtasks.TTPreCommit1:
+			sp.hasPC1 = true
+			pc1 = append(pc1, r.Duration)
+		case sealtasks.TTCommit2:
+			sp.hasCommit = true
+		}
+	}
+
+	var sealing []time.Duration
+	for _, sp := range sectors {
+		if sp.hasPC1 && sp.hasCommit {
+			sealing = append(sealing, sp.end.Sub(sp.start))
+		}
+	}
+	if len(sealing) < MinRuns || len(pc1) < MinRuns {
+		return api.TuneSuggestion{}, false
+	}
+
+	ratio := float64(median(sealing)) / float64(median(pc1))
+	if ratio < 1 {
+		ratio = 1
+	}
+	suggested := uint64(math.Ceil(float64(slots) * ratio))
+
+	if current != 0 && math.Abs(float64(suggested)-float64(current)) <= float64(current)*MaxSealingSlack {
+		return api.TuneSuggestion{}, false
+	}
+
+	cur := strconv.FormatUint(current, 10)
+	if current == 0 {
+		cur = "0 (no limit)"
+	}
+	return api.TuneSuggestion{
+		Setting:   SettingMaxSealingSectors,
+		Current:   cur,
+		Suggested: strconv.FormatUint(suggested, 10),
+		Reason:    fmt.Sprintf("PC1 workers have the best throughput running %d at once, and sectors take %.1fx as long to seal as PC1", slots, ratio),
+	}, true
+}
+
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	s := append([]time.Duration{}, ds...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	if len(s)%2 == 0 {
+		return (s[len(s)/2-1] + s[len(s)/2]) / 2
+	}
+	return s[len(s)/2]
+}
+
+func showValue(setting, v string) string {
+	if v == "" {
+		return setting + " unset"
+	}
+	return setting + "=" + v
+}
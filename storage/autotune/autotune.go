@@ -0,0 +1,284 @@
+package autotune
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-storedcounter"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/extern/storage-sealing/sealiface"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("autotune")
+
+var (
+	runsPrefix = datastore.NewKey("/autotune/runs")
+	tuningKey  = datastore.NewKey("/autotune/tuning")
+)
+
+// MaxRuns is the number of task runs kept in the history
+var MaxRuns uint64 = 5000
+
+// SettingMaxSealingSectors is the setting of the miner limiting the number
+// of sectors sealed at once
+const SettingMaxSealingSectors = "Sealing.MaxSealingSectors"
+
+// Tuner records the sealing tasks finished on workers across restarts, and
+// suggests tuning settings from their performance. Worker settings are
+// environment variables of the proofs library, applied ones are kept here
+// and picked up by workers when they start.
+type Tuner struct {
+	ds      datastore.Batching
+	meta    datastore.Batching
+	counter *storedcounter.StoredCounter
+
+	getCfg func() (sealiface.Config, error)
+	setCfg func(sealiface.Config) error
+
+	lk sync.Mutex
+}
+
+func New(ds dtypes.MetadataDS, getCfg func() (sealiface.Config, error), setCfg func(sealiface.Config) error) *Tuner {
+	return &Tuner{
+		ds:      namespace.Wrap(ds, runsPrefix),
+		meta:    ds,
+		counter: storedcounter.New(ds, datastore.NewKey("/autotune/counter")),
+		getCfg:  getCfg,
+		setCfg:  setCfg,
+	}
+}
+
+// Record adds a finished task to the history, it's meant to be passed to
+// Manager.OnTaskDone
+func (t *Tuner) Record(run storiface.TaskRun) {
+	if err := t.record(run); err != nil {
+		log.Errorw("recording task run", "task", run.Task, "sector", run.Sector, "error", err)
+	}
+}
+
+func (t *Tuner) record(run storiface.TaskRun) error {
+	id, err := t.counter.Next()
+	if err != nil {
+		return xerrors.Errorf("getting run id: %w", err)
+	}
+
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if err := t.ds.Put(datastore.NewKey(fmt.Sprint(id)), b); err != nil {
+		return xerrors.Errorf("saving task run: %w", err)
+	}
+
+	if id >= MaxRuns {
+		if err := t.ds.Delete(datastore.NewKey(fmt.Sprint(id - MaxRuns))); err != nil && err != datastore.ErrNotFound {
+			log.Warnf("removing old task run: %s", err)
+		}
+	}
+	return nil
+}
+
+// Runs returns the recorded task runs, oldest first
+func (t *Tuner) Runs() ([]storiface.TaskRun, error) {
+	res, err := t.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying task runs: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []storiface.TaskRun
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading task runs: %w", r.Error)
+		}
+
+		var run storiface.TaskRun
+		if err := json.Unmarshal(r.Value, &run); err != nil {
+			log.Errorw("decoding task run", "key", r.Key, "error", err)
+			continue
+		}
+		out = append(out, run)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+	return out, nil
+}
+
+// Report analyzes the recorded runs, see Analyze
+func (t *Tuner) Report() (api.TuneReport, error) {
+	runs, err := t.Runs()
+	if err != nil {
+		return api.TuneReport{}, err
+	}
+	cfg, err := t.getCfg()
+	if err != nil {
+		return api.TuneReport{}, xerrors.Errorf("getting sealing config: %w", err)
+	}
+
+	t.lk.Lock()
+	applied, err := t.loadTuning()
+	t.lk.Unlock()
+	if err != nil {
+		return api.TuneReport{}, err
+	}
+
+	return Analyze(runs, cfg.MaxSealingSectors, applied), nil
+}
+
+// Tuning returns the settings applied for a worker
+func (t *Tuner) Tuning(hostname string) (map[string]string, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	all, err := t.loadTuning()
+	if err != nil {
+		return nil, err
+	}
+	if all[hostname] == nil {
+		return map[string]string{}, nil
+	}
+	return all[hostname], nil
+}
+
+// SetEnv sets the settings applied for a host in the environment of this
+// process, see SetEnv
+func (t *Tuner) SetEnv(hostname string) error {
+	tuning, err := t.Tuning(hostname)
+	if err != nil {
+		return err
+	}
+	return SetEnv(tuning)
+}
+
+// SetEnv sets applied worker settings in the environment of this process.
+// Variables the environment already has are kept, so operators can still
+// override settings. The proofs library reads its settings once, this must
+// be called before it's used.
+func SetEnv(tuning map[string]string) error {
+	for k, v := range tuning {
+		if !workerSetting(k) {
+			log.Warnw("ignoring unknown tuning setting", "setting", k)
+			continue
+		}
+		if cur, ok := os.LookupEnv(k); ok {
+			if cur != v {
+				log.Warnw("tuning setting is overridden by the environment", "setting", k, "applied", v, "env", cur)
+			}
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return xerrors.Errorf("setting %s: %w", k, err)
+		}
+		log.Infow("tuning setting", "setting", k, "value", v)
+	}
+	return nil
+}
+
+// Apply applies setting changes. Changes of worker settings take effect when
+// the worker restarts.
+func (t *Tuner) Apply(changes []api.TuneSuggestion) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	all, err := t.loadTuning()
+	if err != nil {
+		return err
+	}
+
+	var tuned bool
+	for _, c := range changes {
+		if c.Setting == SettingMaxSealingSectors {
+			if c.Worker != "" {
+				return xerrors.Errorf("%s is a setting of the miner, not of worker %s", c.Setting, c.Worker)
+			}
+			n, err := strconv.ParseUint(c.Suggested, 10, 64)
+			if err != nil {
+				return xerrors.Errorf("parsing %s: %w", c.Setting, err)
+			}
+
+			cfg, err := t.getCfg()
+			if err != nil {
+				return xerrors.Errorf("getting sealing config: %w", err)
+			}
+			cfg.MaxSealingSectors = n
+			if err := t.setCfg(cfg); err != nil {
+				return xerrors.Errorf("setting sealing config: %w", err)
+			}
+			log.Infow("applied tuning", "setting", c.Setting, "value", n)
+			continue
+		}
+
+		if !workerSetting(c.Setting) {
+			return xerrors.Errorf("unknown tuning setting %q", c.Setting)
+		}
+		if c.Worker == "" {
+			return xerrors.Errorf("%s is a worker setting, the worker isn't set", c.Setting)
+		}
+
+		if c.Suggested == "" {
+			delete(all[c.Worker], c.Setting)
+		} else {
+			if all[c.Worker] == nil {
+				all[c.Worker] = map[string]string{}
+			}
+			all[c.Worker][c.Setting] = c.Suggested
+		}
+		tuned = true
+		log.Infow("applied tuning", "worker", c.Worker, "setting", c.Setting, "value", c.Suggested)
+	}
+
+	if !tuned {
+		return nil
+	}
+
+	b, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	if err := t.meta.Put(tuningKey, b); err != nil {
+		return xerrors.Errorf("saving tuning: %w", err)
+	}
+	return nil
+}
+
+// loadTuning returns the applied worker settings by hostname, must be
+// called with t.lk held
+func (t *Tuner) loadTuning() (map[string]map[string]string, error) {
+	out := map[string]map[string]string{}
+
+	b, err := t.meta.Get(tuningKey)
+	if err == datastore.ErrNotFound {
+		return out, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("loading tuning: %w", err)
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, xerrors.Errorf("decoding tuning: %w", err)
+	}
+	return out, nil
+}
+
+func workerSetting(setting string) bool {
+	for _, s := range storiface.TuningSettings {
+		if s == setting {
+			return true
+		}
+	}
+	return false
+}
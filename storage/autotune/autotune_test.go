@@ -0,0 +1,150 @@
+package autotune
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/extern/storage-sealing/sealiface"
+)
+
+var t0 = time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+
+func run(worker string, task sealtasks.TaskType, sector abi.SectorNumber, start, took time.Duration, parallel int, tuning map[string]string) storiface.TaskRun {
+	return storiface.TaskRun{
+		Task:     task,
+		Sector:   abi.SectorID{Miner: 1000, Number: sector},
+		Worker:   worker,
+		CPUs:     8,
+		Tuning:   tuning,
+		Parallel: parallel,
+		Start:    t0.Add(start),
+		Duration: took,
+	}
+}
+
+func TestCompareSetting(t *testing.T) {
+	small := map[string]string{"FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE": "100000"}
+	large := map[string]string{"FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE": "700000"}
+
+	var runs []storiface.TaskRun
+	for i := 0; i < 3; i++ {
+		runs = append(runs, run("w1", sealtasks.TTPreCommit2, abi.SectorNumber(i), time.Duration(i)*time.Hour, 20*time.Minute, 1, large))
+	}
+	for i := 3; i < 6; i++ {
+		runs = append(runs, run("w1", sealtasks.TTPreCommit2, abi.SectorNumber(i), time.Duration(i)*time.Hour, 30*time.Minute, 1, small))
+	}
+
+	rep := Analyze(runs, 0, nil)
+	require.Equal(t, 6, rep.Runs)
+	require.Len(t, rep.Stages, 1)
+	require.Equal(t, 25*time.Minute, rep.Stages[0].Median)
+	require.Equal(t, []api.TuneSuggestion{{
+		Worker:    "w1",
+		Setting:   "FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE",
+		Current:   "100000",
+		Suggested: "700000",
+		Reason:    "PC2 took a median of 20m0s with FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE=700000, 30m0s with FIL_PROOFS_MAX_GPU_TREE_BATCH_SIZE=100000, over 3 and 3 runs",
+	}}, rep.Suggestions)
+
+	// not suggested again while the worker didn't pick it up
+	rep = Analyze(runs, 0, map[string]map[string]string{"w1": large})
+	require.Empty(t, rep.Suggestions)
+}
+
+func TestMaxSealing(t *testing.T) {
+	var runs []storiface.TaskRun
+	sector := abi.SectorNumber(0)
+	for _, parallel := range []int{1, 2, 4} {
+		// 4 at once is slower than 2
+		took := map[int]time.Duration{1: 3 * time.Hour, 2: 4 * time.Hour, 4: 10 * time.Hour}[parallel]
+		for i := 0; i < 3; i++ {
+			start := time.Duration(sector) * 24 * time.Hour
+			runs = append(runs,
+				run("w1", sealtasks.TTPreCommit1, sector, start, took, parallel, nil),
+				run("w2", sealtasks.TTCommit2, sector, start+2*took, time.Hour, 1, nil),
+			)
+			sector++
+		}
+	}
+
+	rep := Analyze(runs, 2, nil)
+	require.Len(t, rep.Stages, 2)
+	require.Equal(t, 2, rep.Stages[0].BestParallel)
+	require.InDelta(t, 0.5, rep.Stages[0].Throughput, 0.001)
+
+	// sectors spend 2x PC1 + 1h sealing, 9h / 4h
+	require.Len(t, rep.Suggestions, 1)
+	require.Equal(t, SettingMaxSealingSectors, rep.Suggestions[0].Setting)
+	require.Equal(t, "5", rep.Suggestions[0].Suggested)
+
+	rep = Analyze(runs, 5, nil)
+	require.Empty(t, rep.Suggestions)
+}
+
+func TestFolklore(t *testing.T) {
+	r := run("w1", sealtasks.TTPreCommit1, 1, 0, time.Hour, 1, nil)
+	r.CPUs = 64
+	rep := Analyze([]storiface.TaskRun{r}, 0, nil)
+	require.Len(t, rep.Suggestions, 1)
+	require.Equal(t, "FIL_PROOFS_USE_MULTICORE_SDR", rep.Suggestions[0].Setting)
+	require.Equal(t, "1", rep.Suggestions[0].Suggested)
+
+	// tried and was slower
+	var runs []storiface.TaskRun
+	for i := 0; i < 3; i++ {
+		r := run("w1", sealtasks.TTPreCommit1, abi.SectorNumber(i), time.Duration(i)*time.Hour, 2*time.Hour, 1, map[string]string{"FIL_PROOFS_USE_MULTICORE_SDR": "1"})
+		r.CPUs = 64
+		runs = append(runs, r)
+	}
+	for i := 3; i < 6; i++ {
+		r := run("w1", sealtasks.TTPreCommit1, abi.SectorNumber(i), time.Duration(i)*time.Hour, time.Hour, 1, nil)
+		r.CPUs = 64
+		runs = append(runs, r)
+	}
+	rep = Analyze(runs, 0, nil)
+	require.Empty(t, rep.Suggestions)
+}
+
+func TestApply(t *testing.T) {
+	cfg := sealiface.Config{MaxSealingSectors: 2, MaxSealingSectorsForDeals: 3}
+	tu := New(dss.MutexWrap(datastore.NewMapDatastore()),
+		func() (sealiface.Config, error) { return cfg, nil },
+		func(c sealiface.Config) error { cfg = c; return nil })
+
+	MaxRuns = 2
+	defer func() { MaxRuns = 5000 }()
+	for i := 0; i < 3; i++ {
+		tu.Record(run("w1", sealtasks.TTPreCommit1, abi.SectorNumber(i), time.Duration(i)*time.Hour, time.Hour, 1, nil))
+	}
+	runs, err := tu.Runs()
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, abi.SectorNumber(1), runs[0].Sector.Number)
+
+	require.NoError(t, tu.Apply([]api.TuneSuggestion{
+		{Setting: SettingMaxSealingSectors, Suggested: "6"},
+		{Worker: "w1", Setting: "FIL_PROOFS_USE_MULTICORE_SDR", Suggested: "1"},
+	}))
+	require.Equal(t, uint64(6), cfg.MaxSealingSectors)
+	require.Equal(t, uint64(3), cfg.MaxSealingSectorsForDeals)
+
+	tuning, err := tu.Tuning("w1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"FIL_PROOFS_USE_MULTICORE_SDR": "1"}, tuning)
+
+	require.Error(t, tu.Apply([]api.TuneSuggestion{{Worker: "w1", Setting: "PATH", Suggested: "/"}}))
+
+	require.NoError(t, tu.Apply([]api.TuneSuggestion{{Worker: "w1", Setting: "FIL_PROOFS_USE_MULTICORE_SDR"}}))
+	tuning, err = tu.Tuning("w1")
+	require.NoError(t, err)
+	require.Empty(t, tuning)
+}
@@ -0,0 +1,181 @@
+package carindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// maxSection limits the size of a single CAR section (cid and block)
+const maxSection = 32 << 20
+
+// Entry is the location of a block in the payload of a piece
+type Entry struct {
+	Cid cid.Cid
+	// Offset of the block data from the start of the piece, unpadded
+	Offset uint64
+	Size   uint64
+}
+
+// Index is a CARv2 style index of the blocks in a piece, sorted by multihash
+// so blocks can be found without the exact CID version or codec
+type Index struct {
+	Entries []Entry
+}
+
+// Build indexes the blocks of a CARv1 stream, indexing stops at the zero
+// padding pieces are filled up with
+func Build(r io.Reader) (*Index, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+
+	hlen, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return nil, xerrors.Errorf("reading header length: %w", err)
+	}
+	if hlen == 0 || hlen > maxSection {
+		return nil, xerrors.Errorf("invalid CAR header length %d", hlen)
+	}
+	if _, err := io.CopyN(ioutil.Discard, cr, int64(hlen)); err != nil {
+		return nil, xerrors.Errorf("reading header: %w", err)
+	}
+
+	idx := &Index{}
+	buf := make([]byte, 0, 1<<20)
+	for {
+		l, err := binary.ReadUvarint(cr)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("reading section length at %d: %w", cr.n, err)
+		}
+		if l == 0 {
+			// padding
+			break
+		}
+		if l > maxSection {
+			return nil, xerrors.Errorf("section at %d too large: %d", cr.n, l)
+		}
+
+		start := cr.n
+		if uint64(cap(buf)) < l {
+			buf = make([]byte, l)
+		}
+		buf = buf[:l]
+		if _, err := io.ReadFull(cr, buf); err != nil {
+			return nil, xerrors.Errorf("reading section at %d: %w", start, err)
+		}
+
+		n, c, err := cid.CidFromBytes(buf)
+		if err != nil {
+			return nil, xerrors.Errorf("reading cid at %d: %w", start, err)
+		}
+
+		idx.Entries = append(idx.Entries, Entry{
+			Cid:    c,
+			Offset: start + uint64(n),
+			Size:   l - uint64(n),
+		})
+	}
+
+	sort.Slice(idx.Entries, func(i, j int) bool {
+		return bytes.Compare(idx.Entries[i].Cid.Hash(), idx.Entries[j].Cid.Hash()) < 0
+	})
+	return idx, nil
+}
+
+// Find returns the location of the block with the multihash of c
+func (idx *Index) Find(c cid.Cid) (Entry, bool) {
+	h := c.Hash()
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return bytes.Compare(idx.Entries[i].Cid.Hash(), h) >= 0
+	})
+	if i < len(idx.Entries) && bytes.Equal(idx.Entries[i].Cid.Hash(), h) {
+		return idx.Entries[i], true
+	}
+	return Entry{}, false
+}
+
+func (idx *Index) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	tmp := make([]byte, binary.MaxVarintLen64)
+
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(tmp, v)
+		buf.Write(tmp[:n])
+	}
+
+	putUvarint(uint64(len(idx.Entries)))
+	for _, e := range idx.Entries {
+		cb := e.Cid.Bytes()
+		putUvarint(uint64(len(cb)))
+		buf.Write(cb)
+		putUvarint(e.Offset)
+		putUvarint(e.Size)
+	}
+	return buf.Bytes(), nil
+}
+
+func (idx *Index) UnmarshalBinary(b []byte) error {
+	r := bytes.NewReader(b)
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return xerrors.Errorf("reading entry count: %w", err)
+	}
+	if n > uint64(len(b)) {
+		return xerrors.Errorf("invalid entry count %d", n)
+	}
+
+	entries := make([]Entry, n)
+	for i := range entries {
+		cl, err := binary.ReadUvarint(r)
+		if err != nil {
+			return xerrors.Errorf("entry %d: %w", i, err)
+		}
+		if cl > uint64(r.Len()) {
+			return xerrors.Errorf("entry %d: invalid cid length %d", i, cl)
+		}
+		cb := make([]byte, cl)
+		if _, err := io.ReadFull(r, cb); err != nil {
+			return xerrors.Errorf("entry %d: %w", i, err)
+		}
+		if entries[i].Cid, err = cid.Cast(cb); err != nil {
+			return xerrors.Errorf("entry %d: %w", i, err)
+		}
+		if entries[i].Offset, err = binary.ReadUvarint(r); err != nil {
+			return xerrors.Errorf("entry %d: %w", i, err)
+		}
+		if entries[i].Size, err = binary.ReadUvarint(r); err != nil {
+			return xerrors.Errorf("entry %d: %w", i, err)
+		}
+	}
+
+	idx.Entries = entries
+	return nil
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,83 @@
+package carindex
+
+import (
+	"bytes"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-car/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func testCar(t *testing.T, blks ...blocks.Block) []byte {
+	var buf bytes.Buffer
+	// the header isn't decoded
+	require.NoError(t, util.LdWrite(&buf, []byte("header")))
+	for _, b := range blks {
+		require.NoError(t, util.LdWrite(&buf, b.Cid().Bytes(), b.RawData()))
+	}
+	// padding
+	buf.Write(make([]byte, 64))
+	return buf.Bytes()
+}
+
+func TestBuild(t *testing.T) {
+	a := blocks.NewBlock([]byte("block a"))
+	b := blocks.NewBlock([]byte("a somewhat longer block b"))
+	data := testCar(t, a, b)
+
+	idx, err := Build(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, idx.Entries, 2)
+
+	for _, blk := range []blocks.Block{a, b} {
+		e, ok := idx.Find(blk.Cid())
+		require.True(t, ok)
+		require.Equal(t, blk.RawData(), data[e.Offset:e.Offset+e.Size])
+
+		// found by multihash
+		e1, ok := idx.Find(cid.NewCidV1(cid.Raw, blk.Cid().Hash()))
+		require.True(t, ok)
+		require.Equal(t, e, e1)
+	}
+
+	_, ok := idx.Find(blocks.NewBlock([]byte("c")).Cid())
+	require.False(t, ok)
+
+	bb, err := idx.MarshalBinary()
+	require.NoError(t, err)
+	var idx2 Index
+	require.NoError(t, idx2.UnmarshalBinary(bb))
+	require.Equal(t, idx.Entries, idx2.Entries)
+
+	_, err = Build(bytes.NewReader(make([]byte, 128)))
+	require.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	a := blocks.NewBlock([]byte("block a"))
+	b := blocks.NewBlock([]byte("block b"))
+
+	s := NewStore(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	idxA, err := Build(bytes.NewReader(testCar(t, a)))
+	require.NoError(t, err)
+	idxB, err := Build(bytes.NewReader(testCar(t, b)))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put(1, 0, 10, idxA))
+	require.NoError(t, s.Put(1, 2032, 11, idxB))
+
+	loc, err := s.Locate(1, b.Cid())
+	require.NoError(t, err)
+	require.EqualValues(t, 11, loc.Deal)
+	require.EqualValues(t, 2032, loc.PieceOffset)
+	require.Equal(t, 2032+idxB.Entries[0].Offset, loc.Offset)
+
+	_, err = s.Locate(2, b.Cid())
+	require.True(t, xerrors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,98 @@
+package carindex
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var dsPrefix = datastore.NewKey("/carindex")
+
+// ErrNotFound is returned when no indexed piece of a sector has a block
+var ErrNotFound = xerrors.New("block not found in sector indexes")
+
+// Store keeps the indexes of deal pieces, by sector and offset of the piece
+// in the sector
+type Store struct {
+	ds datastore.Batching
+}
+
+func NewStore(ds dtypes.MetadataDS) *Store {
+	return &Store{ds: namespace.Wrap(ds, dsPrefix)}
+}
+
+func sectorKey(sector abi.SectorNumber) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%020d", sector))
+}
+
+func pieceKey(sector abi.SectorNumber, offset abi.UnpaddedPieceSize) datastore.Key {
+	return sectorKey(sector).ChildString(fmt.Sprintf("%020d", offset))
+}
+
+// Put stores the index of the piece of a deal at offset (unpadded) in a
+// sector, replacing an existing one
+func (s *Store) Put(sector abi.SectorNumber, offset abi.UnpaddedPieceSize, deal abi.DealID, idx *Index) error {
+	b, err := idx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	hdr := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(hdr, uint64(deal))
+
+	return s.ds.Put(pieceKey(sector, offset), append(hdr[:n], b...))
+}
+
+// Locate finds a block in the indexed pieces of a sector
+func (s *Store) Locate(sector abi.SectorNumber, c cid.Cid) (api.SectorBlockLocation, error) {
+	res, err := s.ds.Query(query.Query{Prefix: sectorKey(sector).String()})
+	if err != nil {
+		return api.SectorBlockLocation{}, xerrors.Errorf("querying indexes: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return api.SectorBlockLocation{}, xerrors.Errorf("reading indexes: %w", r.Error)
+		}
+
+		var offset uint64
+		if _, err := fmt.Sscanf(datastore.RawKey(r.Key).Name(), "%d", &offset); err != nil {
+			return api.SectorBlockLocation{}, xerrors.Errorf("parsing index key %s: %w", r.Key, err)
+		}
+
+		deal, n := binary.Uvarint(r.Value)
+		if n <= 0 {
+			return api.SectorBlockLocation{}, xerrors.Errorf("invalid index %s", r.Key)
+		}
+		var idx Index
+		if err := idx.UnmarshalBinary(r.Value[n:]); err != nil {
+			return api.SectorBlockLocation{}, xerrors.Errorf("decoding index %s: %w", r.Key, err)
+		}
+
+		e, ok := idx.Find(c)
+		if !ok {
+			continue
+		}
+
+		return api.SectorBlockLocation{
+			Sector:      sector,
+			Deal:        abi.DealID(deal),
+			PieceOffset: abi.UnpaddedPieceSize(offset),
+			Offset:      offset + e.Offset,
+			Size:        e.Size,
+		}, nil
+	}
+
+	return api.SectorBlockLocation{}, xerrors.Errorf("%s in sector %d: %w", c, sector, ErrNotFound)
+}
@@ -0,0 +1,378 @@
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/metrics"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("cron")
+
+var dsPrefix = datastore.NewKey("/cron/history")
+
+// MaxHistory is the number of runs kept in the history of every job
+const MaxHistory = 100
+
+// maxOutput is how much of the end of a task's output is recorded
+const maxOutput = 4 << 10
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Task is a built-in operation jobs can run, the output is recorded in the
+// run history
+type Task func(ctx context.Context) (string, error)
+
+// JobConfig is a scheduled job, see config.CronJob
+type JobConfig struct {
+	Name     string
+	Schedule string
+	Task     string
+	Command  string
+	Timeout  time.Duration
+}
+
+type job struct {
+	name     string
+	schedule string
+	desc     string
+	sched    *Schedule
+	run      Task
+	timeout  time.Duration
+
+	next    time.Time
+	running bool
+	last    *api.CronRun
+}
+
+// Cron runs jobs on their schedules, and records every run. Runs of a job
+// don't overlap, a run which is due while the previous one still runs is
+// skipped.
+type Cron struct {
+	ds    datastore.Batching
+	maddr address.Address
+
+	lk   sync.Mutex
+	jobs []*job
+}
+
+func New(ds dtypes.MetadataDS, maddr address.Address, tasks map[string]Task, cfgs []JobConfig) (*Cron, error) {
+	c := &Cron{
+		ds:    namespace.Wrap(ds, dsPrefix),
+		maddr: maddr,
+	}
+
+	names := map[string]struct{}{}
+	for _, cfg := range cfgs {
+		if !validName.MatchString(cfg.Name) {
+			return nil, xerrors.Errorf("invalid job name '%s'", cfg.Name)
+		}
+		if _, ok := names[cfg.Name]; ok {
+			return nil, xerrors.Errorf("duplicate job '%s'", cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+
+		sched, err := ParseSchedule(cfg.Schedule)
+		if err != nil {
+			return nil, xerrors.Errorf("job '%s': %w", cfg.Name, err)
+		}
+
+		j := &job{
+			name:     cfg.Name,
+			schedule: cfg.Schedule,
+			sched:    sched,
+			timeout:  cfg.Timeout,
+		}
+
+		switch {
+		case cfg.Task != "" && cfg.Command != "":
+			return nil, xerrors.Errorf("job '%s' has both a task and a command", cfg.Name)
+		case cfg.Task != "":
+			t, ok := tasks[cfg.Task]
+			if !ok {
+				return nil, xerrors.Errorf("job '%s': unknown task '%s'", cfg.Name, cfg.Task)
+			}
+			j.desc, j.run = cfg.Task, t
+		case cfg.Command != "":
+			j.desc, j.run = cfg.Command, commandTask(cfg.Command)
+		default:
+			return nil, xerrors.Errorf("job '%s' has no task or command", cfg.Name)
+		}
+
+		hist, err := c.History(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(hist) > 0 {
+			j.last = &hist[len(hist)-1]
+		}
+
+		c.jobs = append(c.jobs, j)
+	}
+
+	return c, nil
+}
+
+func commandTask(cmd string) Task {
+	return func(ctx context.Context) (string, error) {
+		out, err := exec.CommandContext(ctx, "sh", "-c", cmd).CombinedOutput()
+		return string(out), err
+	}
+}
+
+// Run runs jobs until ctx is cancelled
+func (c *Cron) Run(ctx context.Context) error {
+	if len(c.jobs) == 0 {
+		return nil
+	}
+
+	c.lk.Lock()
+	now := build.Clock.Now()
+	for _, j := range c.jobs {
+		j.next = j.sched.Next(now)
+	}
+	c.lk.Unlock()
+
+	c.recordFailed(ctx)
+
+	for {
+		c.lk.Lock()
+		var next time.Time
+		for _, j := range c.jobs {
+			if !j.next.IsZero() && (next.IsZero() || j.next.Before(next)) {
+				next = j.next
+			}
+		}
+		c.lk.Unlock()
+
+		if next.IsZero() {
+			return nil
+		}
+
+		t := build.Clock.Timer(next.Sub(build.Clock.Now()))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		}
+
+		c.lk.Lock()
+		now := build.Clock.Now()
+		for _, j := range c.jobs {
+			if j.next.IsZero() || j.next.After(now) {
+				continue
+			}
+			j.next = j.sched.Next(now)
+
+			if j.running {
+				log.Warnw("skipping job, previous run still running", "job", j.name)
+				continue
+			}
+			j.running = true
+			go c.runJob(ctx, j, false) // nolint:errcheck
+		}
+		c.lk.Unlock()
+
+		crash.Success(ctx)
+	}
+}
+
+// RunNow runs a job and waits for it to finish
+func (c *Cron) RunNow(ctx context.Context, name string) (api.CronRun, error) {
+	c.lk.Lock()
+	j := c.job(name)
+	if j == nil {
+		c.lk.Unlock()
+		return api.CronRun{}, xerrors.Errorf("no job '%s'", name)
+	}
+	if j.running {
+		c.lk.Unlock()
+		return api.CronRun{}, xerrors.Errorf("job '%s' is already running", name)
+	}
+	j.running = true
+	c.lk.Unlock()
+
+	return c.runJob(ctx, j, true), nil
+}
+
+// must be called with c.lk held
+func (c *Cron) job(name string) *job {
+	for _, j := range c.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+func (c *Cron) runJob(ctx context.Context, j *job, manual bool) api.CronRun {
+	run := api.CronRun{
+		Job:     j.name,
+		Started: build.Clock.Now(),
+		Manual:  manual,
+	}
+
+	tctx := ctx
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		tctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+
+	out, err := j.run(tctx)
+	run.Finished = build.Clock.Now()
+	if len(out) > maxOutput {
+		out = "..." + out[len(out)-maxOutput:]
+	}
+	run.Output = strings.TrimSpace(out)
+	if err != nil {
+		run.Error = err.Error()
+		log.Errorw("job failed", "job", j.name, "error", err)
+	} else {
+		log.Infow("job finished", "job", j.name, "took", run.Finished.Sub(run.Started))
+	}
+
+	if err := c.save(run); err != nil {
+		log.Errorf("recording run of job %s: %+v", j.name, err)
+	}
+
+	c.lk.Lock()
+	j.running = false
+	j.last = &run
+	c.lk.Unlock()
+
+	c.recordFailed(ctx)
+
+	return run
+}
+
+// recordFailed records the number of jobs whose last run failed, for the
+// MinerCronJobFailed alert
+func (c *Cron) recordFailed(ctx context.Context) {
+	c.lk.Lock()
+	var failed int64
+	for _, j := range c.jobs {
+		if j.last != nil && j.last.Error != "" {
+			failed++
+		}
+	}
+	c.lk.Unlock()
+
+	ctx, err := tag.New(ctx, tag.Upsert(metrics.MinerID, c.maddr.String()))
+	if err != nil {
+		log.Warnf("tagging metrics: %s", err)
+		return
+	}
+	stats.Record(ctx, metrics.MinerCronFailedJobs.M(failed))
+}
+
+// Jobs returns the configured jobs
+func (c *Cron) Jobs() []api.CronJob {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	out := make([]api.CronJob, len(c.jobs))
+	for i, j := range c.jobs {
+		out[i] = api.CronJob{
+			Name:     j.name,
+			Schedule: j.schedule,
+			Task:     j.desc,
+			Next:     j.next,
+			Running:  j.running,
+			LastRun:  j.last,
+		}
+	}
+	return out
+}
+
+func historyKey(run api.CronRun) datastore.Key {
+	return datastore.NewKey(run.Job).ChildString(fmt.Sprintf("%020d", run.Started.UnixNano()))
+}
+
+func (c *Cron) save(run api.CronRun) error {
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ds.Put(historyKey(run), b); err != nil {
+		return xerrors.Errorf("saving run: %w", err)
+	}
+
+	res, err := c.ds.Query(query.Query{Prefix: "/" + run.Job, KeysOnly: true})
+	if err != nil {
+		return xerrors.Errorf("querying history: %w", err)
+	}
+	ents, err := res.Rest()
+	if err != nil {
+		return xerrors.Errorf("reading history: %w", err)
+	}
+	if len(ents) <= MaxHistory {
+		return nil
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Key < ents[j].Key
+	})
+	for _, e := range ents[:len(ents)-MaxHistory] {
+		if err := c.ds.Delete(datastore.NewKey(e.Key)); err != nil {
+			log.Warnf("removing old run %s: %s", e.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// History returns recorded runs of a job, oldest first
+func (c *Cron) History(name string) ([]api.CronRun, error) {
+	res, err := c.ds.Query(query.Query{Prefix: "/" + name})
+	if err != nil {
+		return nil, xerrors.Errorf("querying history: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.CronRun
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading history: %w", r.Error)
+		}
+
+		var run api.CronRun
+		if err := json.Unmarshal(r.Value, &run); err != nil {
+			log.Errorw("decoding run", "key", r.Key, "error", err)
+			continue
+		}
+		if run.Job != name {
+			// prefix of another job's name
+			continue
+		}
+		out = append(out, run)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Started.Before(out[j].Started)
+	})
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package cron
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+)
+
+func TestRunHistory(t *testing.T) {
+	ctx := context.Background()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	maddr := tutils.NewIDAddr(t, 1000)
+
+	fail := false
+	tasks := map[string]Task{
+		"test": func(ctx context.Context) (string, error) {
+			if fail {
+				return "partial", xerrors.New("broken")
+			}
+			return "done\n", nil
+		},
+	}
+	jobs := []JobConfig{
+		{Name: "job", Schedule: "@daily", Task: "test"},
+		{Name: "job2", Schedule: "@hourly", Command: "echo hello"},
+	}
+
+	c, err := New(ds, maddr, tasks, jobs)
+	require.NoError(t, err)
+
+	run, err := c.RunNow(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, "done", run.Output)
+	require.True(t, run.Manual)
+
+	fail = true
+	run, err = c.RunNow(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, "broken", run.Error)
+
+	run, err = c.RunNow(ctx, "job2")
+	require.NoError(t, err)
+	require.Equal(t, "hello", run.Output)
+	require.Empty(t, run.Error)
+
+	_, err = c.RunNow(ctx, "nope")
+	require.Error(t, err)
+
+	hist, err := c.History("job")
+	require.NoError(t, err)
+	require.Len(t, hist, 2)
+	require.Empty(t, hist[0].Error)
+	require.Equal(t, "broken", hist[1].Error)
+
+	// the last run is loaded on restart
+	c, err = New(ds, maddr, tasks, jobs)
+	require.NoError(t, err)
+	js := c.Jobs()
+	require.Len(t, js, 2)
+	require.Equal(t, "broken", js[0].LastRun.Error)
+	require.Equal(t, "echo hello", js[1].Task)
+
+	for i := 0; i < MaxHistory+5; i++ {
+		_, err := c.RunNow(ctx, "job")
+		require.NoError(t, err)
+	}
+	hist, err = c.History("job")
+	require.NoError(t, err)
+	require.Len(t, hist, MaxHistory)
+}
+
+func TestInvalidJobs(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	maddr := tutils.NewIDAddr(t, 1000)
+	tasks := map[string]Task{"test": nil}
+
+	for _, j := range [][]JobConfig{
+		{{Name: "a/b", Schedule: "@daily", Task: "test"}},
+		{{Name: "a", Schedule: "@daily", Task: "test"}, {Name: "a", Schedule: "@daily", Task: "test"}},
+		{{Name: "a", Schedule: "bad", Task: "test"}},
+		{{Name: "a", Schedule: "@daily", Task: "unknown"}},
+		{{Name: "a", Schedule: "@daily", Task: "test", Command: "true"}},
+		{{Name: "a", Schedule: "@daily"}},
+	} {
+		_, err := New(ds, maddr, tasks, j)
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,183 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+
+	// standard cron semantics: when both day fields are restricted, a day
+	// matching either of them matches
+	domStar, dowStar bool
+}
+
+var macros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+type fieldRange struct {
+	min, max int
+}
+
+var fields = []fieldRange{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week, sunday is 0
+}
+
+// ParseSchedule parses a cron expression with five fields, minute, hour, day
+// of month, month and day of week; or one of @hourly, @daily, @weekly and
+// @monthly. Fields are lists of values, ranges (a-b) and '*', each with an
+// optional step (/n).
+func ParseSchedule(expr string) (*Schedule, error) {
+	if m, ok := macros[strings.TrimSpace(expr)]; ok {
+		expr = m
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, xerrors.Errorf("expected %d fields in '%s', got %d", len(fields), expr, len(parts))
+	}
+
+	var sets [5]uint64
+	for i, p := range parts {
+		set, err := parseField(p, fields[i])
+		if err != nil {
+			return nil, xerrors.Errorf("field %d of '%s': %w", i+1, expr, err)
+		}
+		sets[i] = set
+	}
+
+	s := &Schedule{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}
+	// 7 is sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+func parseField(f string, r fieldRange) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, xerrors.Errorf("bad step in '%s'", item)
+			}
+			item = item[:i]
+		}
+
+		lo, hi := r.min, r.max
+		if r.max == 6 {
+			hi = 7 // allow 7 for sunday
+		}
+		switch {
+		case item == "*":
+			hi = r.max
+		case strings.Contains(item, "-"):
+			ab := strings.SplitN(item, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(ab[0]); err != nil {
+				return 0, xerrors.Errorf("bad range '%s'", item)
+			}
+			if hi, err = atoiMax(ab[1], hi); err != nil {
+				return 0, xerrors.Errorf("bad range '%s'", item)
+			}
+		default:
+			v, err := atoiMax(item, hi)
+			if err != nil {
+				return 0, xerrors.Errorf("bad value '%s'", item)
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo < r.min || lo > hi {
+			return 0, xerrors.Errorf("'%s' out of range %d-%d", item, r.min, r.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func atoiMax(s string, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if v > max {
+		return 0, xerrors.Errorf("%d is larger than %d", v, max)
+	}
+	return v, nil
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t matching the schedule, in the location
+// of t
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// every schedule matches within a few years, e.g. february 29th
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,55 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// a wednesday
+	from := time.Date(2020, 9, 16, 10, 30, 15, 0, time.UTC)
+
+	for expr, next := range map[string]time.Time{
+		"* * * * *":       time.Date(2020, 9, 16, 10, 31, 0, 0, time.UTC),
+		"@hourly":         time.Date(2020, 9, 16, 11, 0, 0, 0, time.UTC),
+		"@daily":          time.Date(2020, 9, 17, 0, 0, 0, 0, time.UTC),
+		"@weekly":         time.Date(2020, 9, 20, 0, 0, 0, 0, time.UTC),
+		"@monthly":        time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		"*/20 * * * *":    time.Date(2020, 9, 16, 10, 40, 0, 0, time.UTC),
+		"15 3 * * *":      time.Date(2020, 9, 17, 3, 15, 0, 0, time.UTC),
+		"0 9-17/4 * * *":  time.Date(2020, 9, 16, 13, 0, 0, 0, time.UTC),
+		"0 0 * * 1-5":     time.Date(2020, 9, 17, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":       time.Date(2020, 9, 20, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":      time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 1,15 * *":    time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		"0 12 13 * 5":     time.Date(2020, 9, 18, 12, 0, 0, 0, time.UTC), // friday or the 13th
+		"30 10 16 9 *":    time.Date(2021, 9, 16, 10, 30, 0, 0, time.UTC),
+		"0 0 31 4,6,9 *":  time.Time{},
+		"0,30 10 * * 3,4": time.Date(2020, 9, 17, 10, 0, 0, 0, time.UTC),
+	} {
+		s, err := ParseSchedule(expr)
+		require.NoError(t, err, expr)
+		require.Equal(t, next, s.Next(from), expr)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@yearly",
+	} {
+		_, err := ParseSchedule(expr)
+		require.Error(t, err, expr)
+	}
+}
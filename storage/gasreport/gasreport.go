@@ -0,0 +1,341 @@
+package gasreport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("gasreport")
+
+var (
+	dsPrefix  = datastore.NewKey("/gasreport")
+	cursorKey = datastore.NewKey("/cursor")
+	daysKey   = datastore.NewKey("/days")
+)
+
+// Subsystems messages are attributed to
+const (
+	SubsystemPoSt      = "post"
+	SubsystemPreCommit = "precommit"
+	SubsystemCommit    = "commit"
+	SubsystemMarkets   = "markets"
+	SubsystemAdmin     = "admin"
+)
+
+// confidence is how many epochs messages are processed behind the head, so
+// short reorgs don't need to be handled
+const confidence = 5
+
+type reportAPI interface {
+	ChainHead(context.Context) (*types.TipSet, error)
+	ChainGetTipSetByHeight(context.Context, abi.ChainEpoch, types.TipSetKey) (*types.TipSet, error)
+	ChainGetTipSet(context.Context, types.TipSetKey) (*types.TipSet, error)
+	ChainGetParentMessages(ctx context.Context, blockCid cid.Cid) ([]api.Message, error)
+	ChainGetParentReceipts(ctx context.Context, blockCid cid.Cid) ([]*types.MessageReceipt, error)
+	StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error)
+	StateAccountKey(context.Context, address.Address, types.TipSetKey) (address.Address, error)
+}
+
+// Config controls the report, see config.GasReportConfig
+type Config struct {
+	Interval time.Duration
+	Backfill time.Duration
+}
+
+// Reporter follows the chain, and adds up the gas spent by messages from the
+// owner, worker and control addresses of the miner, per day and subsystem.
+// Messages are attributed by their method: window PoSt and fault
+// declarations to post, sector pre-commits and commits to precommit and
+// commit, market actor messages to markets, and everything else to admin.
+type Reporter struct {
+	api   reportAPI
+	ds    datastore.Batching
+	maddr address.Address
+	cfg   Config
+}
+
+func NewReporter(rapi reportAPI, ds dtypes.MetadataDS, maddr address.Address, cfg Config) *Reporter {
+	return &Reporter{
+		api:   rapi,
+		ds:    namespace.Wrap(ds, dsPrefix),
+		maddr: maddr,
+		cfg:   cfg,
+	}
+}
+
+// Run processes new tipsets until ctx is cancelled
+func (r *Reporter) Run(ctx context.Context) error {
+	if r.cfg.Interval <= 0 {
+		return nil
+	}
+
+	t := build.Clock.Ticker(r.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		if err := r.update(ctx); err != nil {
+			log.Errorf("updating gas report: %+v", err)
+		} else {
+			crash.Success(ctx)
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Reporter) update(ctx context.Context) error {
+	head, err := r.api.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+	to := head.Height() - confidence
+
+	from, err := r.cursor()
+	if err != nil {
+		return err
+	}
+	if from == 0 {
+		from = to - abi.ChainEpoch(r.cfg.Backfill/(time.Duration(build.BlockDelaySecs)*time.Second))
+		if from < 1 {
+			from = 1
+		}
+	}
+
+	addrs, err := r.addresses(ctx, head.Key())
+	if err != nil {
+		return err
+	}
+
+	for h := from; h <= to; h++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := r.processEpoch(ctx, h, head.Key(), addrs); err != nil {
+			return xerrors.Errorf("processing epoch %d: %w", h, err)
+		}
+		if err := r.setCursor(h + 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addresses returns the addresses of the miner, both the ID and the key
+// forms, as messages can use either
+func (r *Reporter) addresses(ctx context.Context, tsk types.TipSetKey) (map[address.Address]struct{}, error) {
+	mi, err := r.api.StateMinerInfo(ctx, r.maddr, tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	out := map[address.Address]struct{}{}
+	for _, a := range append([]address.Address{mi.Owner, mi.Worker}, mi.ControlAddresses...) {
+		out[a] = struct{}{}
+
+		k, err := r.api.StateAccountKey(ctx, a, tsk)
+		if err != nil {
+			// e.g. multisig owners don't have a key
+			continue
+		}
+		out[k] = struct{}{}
+	}
+	return out, nil
+}
+
+// processEpoch adds up the messages included in the tipset at height h,
+// their receipts are in the first tipset after it
+func (r *Reporter) processEpoch(ctx context.Context, h abi.ChainEpoch, head types.TipSetKey, addrs map[address.Address]struct{}) error {
+	child, err := r.api.ChainGetTipSetByHeight(ctx, h, head)
+	if err != nil {
+		return xerrors.Errorf("getting tipset: %w", err)
+	}
+	if child.Height() != h {
+		// null round
+		return nil
+	}
+
+	ts, err := r.api.ChainGetTipSet(ctx, child.Parents())
+	if err != nil {
+		return xerrors.Errorf("getting parent tipset: %w", err)
+	}
+
+	msgs, err := r.api.ChainGetParentMessages(ctx, child.Cids()[0])
+	if err != nil {
+		return xerrors.Errorf("getting messages: %w", err)
+	}
+	rcpts, err := r.api.ChainGetParentReceipts(ctx, child.Cids()[0])
+	if err != nil {
+		return xerrors.Errorf("getting receipts: %w", err)
+	}
+	if len(msgs) != len(rcpts) {
+		return xerrors.Errorf("got %d messages and %d receipts", len(msgs), len(rcpts))
+	}
+
+	// messages of a tipset are executed with the base fee in its headers
+	baseFee := ts.Blocks()[0].ParentBaseFee
+	day := dayOf(time.Unix(int64(ts.MinTimestamp()), 0))
+
+	spends := map[string]api.GasSpend{}
+	for i, m := range msgs {
+		if _, ok := addrs[m.Message.From]; !ok {
+			continue
+		}
+
+		out := vm.ComputeGasOutputs(rcpts[i].GasUsed, m.Message.GasLimit, baseFee, m.Message.GasFeeCap, m.Message.GasPremium)
+
+		sub := Attribute(r.maddr, m.Message)
+		s := spends[sub]
+		s.Add(api.GasSpend{
+			Messages:           1,
+			GasUsed:            rcpts[i].GasUsed,
+			BaseFeeBurn:        out.BaseFeeBurn,
+			OverEstimationBurn: out.OverEstimationBurn,
+			MinerTip:           out.MinerTip,
+		})
+		spends[sub] = s
+	}
+
+	for sub, s := range spends {
+		if err := r.add(day, sub, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attribute returns the subsystem a message of the miner is attributed to
+func Attribute(maddr address.Address, msg *types.Message) string {
+	switch msg.To {
+	case maddr:
+		switch msg.Method {
+		case builtin0.MethodsMiner.SubmitWindowedPoSt,
+			builtin0.MethodsMiner.DeclareFaults,
+			builtin0.MethodsMiner.DeclareFaultsRecovered:
+			return SubsystemPoSt
+		case builtin0.MethodsMiner.PreCommitSector:
+			return SubsystemPreCommit
+		case builtin0.MethodsMiner.ProveCommitSector:
+			return SubsystemCommit
+		}
+	case builtin0.StorageMarketActorAddr:
+		return SubsystemMarkets
+	}
+	return SubsystemAdmin
+}
+
+func dayOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func dayKey(day time.Time) datastore.Key {
+	return daysKey.ChildString(day.Format("2006-01-02"))
+}
+
+func (r *Reporter) add(day time.Time, sub string, s api.GasSpend) error {
+	k := dayKey(day)
+
+	d := api.GasReportDay{Day: day, Subsystems: map[string]api.GasSpend{}}
+	b, err := r.ds.Get(k)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(b, &d); err != nil {
+			return xerrors.Errorf("decoding day %s: %w", k, err)
+		}
+	case datastore.ErrNotFound:
+	default:
+		return xerrors.Errorf("getting day %s: %w", k, err)
+	}
+
+	cur := d.Subsystems[sub]
+	cur.Add(s)
+	d.Subsystems[sub] = cur
+
+	b, err = json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(k, b)
+}
+
+// Days returns the report of the days from from to to, inclusive, which saw
+// messages from the miner, oldest first
+func (r *Reporter) Days(from, to time.Time) ([]api.GasReportDay, error) {
+	from, to = dayOf(from), dayOf(to)
+
+	res, err := r.ds.Query(query.Query{Prefix: daysKey.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying report: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.GasReportDay
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, xerrors.Errorf("reading report: %w", e.Error)
+		}
+
+		var d api.GasReportDay
+		if err := json.Unmarshal(e.Value, &d); err != nil {
+			return nil, xerrors.Errorf("decoding day %s: %w", e.Key, err)
+		}
+		if d.Day.Before(from) || d.Day.After(to) {
+			continue
+		}
+		out = append(out, d)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Day.Before(out[j].Day)
+	})
+	return out, nil
+}
+
+func (r *Reporter) cursor() (abi.ChainEpoch, error) {
+	b, err := r.ds.Get(cursorKey)
+	if err == datastore.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, xerrors.Errorf("getting cursor: %w", err)
+	}
+	h, n := binary.Varint(b)
+	if n <= 0 {
+		return 0, xerrors.Errorf("invalid cursor")
+	}
+	return abi.ChainEpoch(h), nil
+}
+
+func (r *Reporter) setCursor(h abi.ChainEpoch) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(buf, int64(h))
+	return r.ds.Put(cursorKey, buf[:n])
+}
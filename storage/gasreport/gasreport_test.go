@@ -0,0 +1,177 @@
+package gasreport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var (
+	maddr, _  = address.NewIDAddress(1000)
+	worker, _ = address.NewIDAddress(1001)
+	owner, _  = address.NewIDAddress(1002)
+	other, _  = address.NewIDAddress(2000)
+	dummy, _  = cid.Parse("bafkqaaa")
+)
+
+type fakeChain struct {
+	tipsets map[abi.ChainEpoch]*types.TipSet
+	head    abi.ChainEpoch
+
+	// messages included at an epoch
+	msgs map[abi.ChainEpoch][]api.Message
+}
+
+func (f *fakeChain) addTipSet(t *testing.T, h abi.ChainEpoch, parent *types.TipSet) *types.TipSet {
+	var parents []cid.Cid
+	if parent != nil {
+		parents = parent.Cids()
+	}
+
+	ts, err := types.NewTipSet([]*types.BlockHeader{{
+		Miner:                 maddr,
+		Ticket:                &types.Ticket{VRFProof: []byte{byte(h)}},
+		Parents:               parents,
+		ParentWeight:          types.NewInt(0),
+		Height:                h,
+		ParentStateRoot:       dummy,
+		ParentMessageReceipts: dummy,
+		Messages:              dummy,
+		Timestamp:             uint64(time.Date(2020, 10, 5, 0, 0, 0, 0, time.UTC).Unix()) + uint64(h)*3600,
+		ParentBaseFee:         types.NewInt(100),
+	}})
+	require.NoError(t, err)
+
+	f.tipsets[h] = ts
+	if h > f.head {
+		f.head = h
+	}
+	return ts
+}
+
+func (f *fakeChain) ChainHead(context.Context) (*types.TipSet, error) {
+	return f.tipsets[f.head], nil
+}
+
+func (f *fakeChain) ChainGetTipSetByHeight(_ context.Context, h abi.ChainEpoch, _ types.TipSetKey) (*types.TipSet, error) {
+	for ; h >= 0; h-- {
+		if ts, ok := f.tipsets[h]; ok {
+			return ts, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeChain) ChainGetTipSet(_ context.Context, tsk types.TipSetKey) (*types.TipSet, error) {
+	for _, ts := range f.tipsets {
+		if ts.Key() == tsk {
+			return ts, nil
+		}
+	}
+	return nil, datastore.ErrNotFound
+}
+
+func (f *fakeChain) parentHeight(blk cid.Cid) abi.ChainEpoch {
+	for _, ts := range f.tipsets {
+		if ts.Cids()[0] == blk {
+			p, _ := f.ChainGetTipSet(context.TODO(), ts.Parents())
+			return p.Height()
+		}
+	}
+	return -1
+}
+
+func (f *fakeChain) ChainGetParentMessages(_ context.Context, blk cid.Cid) ([]api.Message, error) {
+	return f.msgs[f.parentHeight(blk)], nil
+}
+
+func (f *fakeChain) ChainGetParentReceipts(_ context.Context, blk cid.Cid) ([]*types.MessageReceipt, error) {
+	var out []*types.MessageReceipt
+	for range f.msgs[f.parentHeight(blk)] {
+		out = append(out, &types.MessageReceipt{GasUsed: 1000})
+	}
+	return out, nil
+}
+
+func (f *fakeChain) StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error) {
+	return miner.MinerInfo{Owner: owner, Worker: worker}, nil
+}
+
+func (f *fakeChain) StateAccountKey(_ context.Context, a address.Address, _ types.TipSetKey) (address.Address, error) {
+	return a, nil
+}
+
+func msg(from, to address.Address, method abi.MethodNum) api.Message {
+	return api.Message{
+		Cid: dummy,
+		Message: &types.Message{
+			From:       from,
+			To:         to,
+			Method:     method,
+			GasLimit:   1000,
+			GasFeeCap:  types.NewInt(200),
+			GasPremium: types.NewInt(10),
+		},
+	}
+}
+
+func TestReport(t *testing.T) {
+	f := &fakeChain{
+		tipsets: map[abi.ChainEpoch]*types.TipSet{},
+		msgs: map[abi.ChainEpoch][]api.Message{
+			1: {
+				msg(worker, maddr, builtin0.MethodsMiner.SubmitWindowedPoSt),
+				msg(other, maddr, builtin0.MethodsMiner.SubmitWindowedPoSt), // not ours
+				msg(worker, maddr, builtin0.MethodsMiner.PreCommitSector),
+			},
+			// after the null round at 3
+			2: {
+				msg(worker, maddr, builtin0.MethodsMiner.ProveCommitSector),
+				msg(worker, builtin0.StorageMarketActorAddr, builtin0.MethodsMarket.PublishStorageDeals),
+				msg(owner, other, builtin0.MethodSend),
+			},
+		},
+	}
+
+	ts := f.addTipSet(t, 0, nil)
+	ts = f.addTipSet(t, 1, ts)
+	ts = f.addTipSet(t, 2, ts)
+	ts = f.addTipSet(t, 4, ts)
+	for h := abi.ChainEpoch(5); h < 5+confidence; h++ {
+		ts = f.addTipSet(t, h, ts)
+	}
+
+	r := NewReporter(f, dssync.MutexWrap(datastore.NewMapDatastore()), maddr, Config{Backfill: 100 * time.Hour})
+	require.NoError(t, r.update(context.Background()))
+
+	days, err := r.Days(time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, days, 1)
+
+	subs := days[0].Subsystems
+	for _, sub := range []string{SubsystemPoSt, SubsystemPreCommit, SubsystemCommit, SubsystemMarkets, SubsystemAdmin} {
+		require.Equal(t, int64(1), subs[sub].Messages, sub)
+		// base fee 100, tip 10, no over-estimation
+		require.Equal(t, big.NewInt(110*1000), subs[sub].Total(), sub)
+	}
+
+	// processed messages aren't counted twice
+	require.NoError(t, r.update(context.Background()))
+	days, err = r.Days(time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), days[0].Subsystems[SubsystemPoSt].Messages)
+}
@@ -0,0 +1,343 @@
+package keychange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-storedcounter"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+
+	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+)
+
+var log = logging.Logger("keychange")
+
+var dsPrefix = datastore.NewKey("/actor/keychange")
+
+type keyChangeAPI interface {
+	StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error)
+	StateAccountKey(context.Context, address.Address, types.TipSetKey) (address.Address, error)
+	MpoolPushMessage(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error)
+}
+
+// Manager keeps worker and control address changes of a miner behind a local
+// timelock and a signature from a separate approver key, so that access to
+// the miner API alone isn't enough to hand the miner over to another key.
+type Manager struct {
+	api     keyChangeAPI
+	ds      datastore.Batching
+	counter *storedcounter.StoredCounter
+	maddr   address.Address
+
+	timelock  time.Duration
+	approvers map[address.Address]struct{}
+
+	lk        sync.Mutex
+	proposals map[uint64]*api.KeyChangeProposal
+}
+
+func NewManager(kapi keyChangeAPI, ds dtypes.MetadataDS, maddr address.Address, timelock time.Duration, approvers []address.Address) *Manager {
+	m := &Manager{
+		api:     kapi,
+		ds:      namespace.Wrap(ds, dsPrefix),
+		counter: storedcounter.New(ds, datastore.NewKey("/actor/keychange-counter")),
+		maddr:   maddr,
+
+		timelock:  timelock,
+		approvers: map[address.Address]struct{}{},
+
+		proposals: map[uint64]*api.KeyChangeProposal{},
+	}
+
+	for _, a := range approvers {
+		m.approvers[a] = struct{}{}
+	}
+
+	return m
+}
+
+func (m *Manager) Start(ctx context.Context) error {
+	res, err := m.ds.Query(query.Query{})
+	if err != nil {
+		return xerrors.Errorf("querying key change proposals: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return xerrors.Errorf("reading key change proposals: %w", r.Error)
+		}
+
+		var p api.KeyChangeProposal
+		if err := json.Unmarshal(r.Value, &p); err != nil {
+			log.Errorw("decoding key change proposal", "key", r.Key, "error", err)
+			continue
+		}
+
+		m.proposals[p.ID] = &p
+		if isOpen(&p) {
+			log.Warnw("pending key change proposal", "id", p.ID, "worker", p.NewWorker, "control", p.NewControlAddrs, "executeAfter", p.ExecuteAfter)
+		}
+	}
+
+	return nil
+}
+
+func isOpen(p *api.KeyChangeProposal) bool {
+	return !p.Cancelled && p.Message == nil
+}
+
+// Propose records a change of the worker and control addresses. Only one
+// proposal can be open at a time. Without approvers the change is sent right
+// away, as without the timelock.
+func (m *Manager) Propose(ctx context.Context, newWorker address.Address, newControlAddrs []address.Address) (api.KeyChangeProposal, error) {
+	// the approval is the second factor, even when owner and worker are the
+	// same key
+	mi, err := m.api.StateMinerInfo(ctx, m.maddr, types.EmptyTSK)
+	if err != nil {
+		return api.KeyChangeProposal{}, xerrors.Errorf("getting miner info: %w", err)
+	}
+	for _, a := range []address.Address{mi.Owner, mi.Worker} {
+		ka, err := m.api.StateAccountKey(ctx, a, types.EmptyTSK)
+		if err != nil {
+			return api.KeyChangeProposal{}, xerrors.Errorf("resolving %s: %w", a, err)
+		}
+		if _, ok := m.approvers[ka]; ok {
+			return api.KeyChangeProposal{}, xerrors.Errorf("approver %s is also the owner or worker key", ka)
+		}
+	}
+
+	worker, err := m.api.StateAccountKey(ctx, newWorker, types.EmptyTSK)
+	if err != nil {
+		return api.KeyChangeProposal{}, xerrors.Errorf("resolving worker key: %w", err)
+	}
+	control := make([]address.Address, len(newControlAddrs))
+	for i, a := range newControlAddrs {
+		control[i], err = m.api.StateAccountKey(ctx, a, types.EmptyTSK)
+		if err != nil {
+			return api.KeyChangeProposal{}, xerrors.Errorf("resolving control address %s: %w", a, err)
+		}
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for _, p := range m.proposals {
+		if isOpen(p) {
+			return api.KeyChangeProposal{}, xerrors.Errorf("key change %d is still pending, cancel it first", p.ID)
+		}
+	}
+
+	id, err := m.counter.Next()
+	if err != nil {
+		return api.KeyChangeProposal{}, xerrors.Errorf("getting next proposal ID: %w", err)
+	}
+
+	now := time.Now()
+	p := &api.KeyChangeProposal{
+		ID:              id,
+		NewWorker:       worker,
+		NewControlAddrs: control,
+
+		Proposed:     now,
+		ExecuteAfter: now.Add(m.timelock),
+	}
+	p.Payload = payload(m.maddr, p)
+
+	if err := m.persist(p); err != nil {
+		return api.KeyChangeProposal{}, err
+	}
+	m.proposals[id] = p
+
+	if len(m.approvers) == 0 && m.timelock == 0 {
+		log.Warnw("no key change approvers or timelock configured, sending the key change", "id", id, "worker", worker, "control", control)
+		if _, err := m.send(ctx, p); err != nil {
+			return *p, err
+		}
+		return *p, nil
+	}
+
+	log.Warnw("key change proposed", "id", id, "worker", worker, "control", control, "executeAfter", p.ExecuteAfter)
+
+	return *p, nil
+}
+
+// payload binds an approval to the miner, the proposal and its addresses
+func payload(maddr address.Address, p *api.KeyChangeProposal) []byte {
+	return []byte(fmt.Sprintf("lotus key change for %s: proposal %d at %d, worker %s, control %v",
+		maddr, p.ID, p.Proposed.Unix(), p.NewWorker, p.NewControlAddrs))
+}
+
+func (m *Manager) List() []api.KeyChangeProposal {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := make([]api.KeyChangeProposal, 0, len(m.proposals))
+	for _, p := range m.proposals {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+func (m *Manager) Approve(id uint64, approver address.Address, sig *crypto.Signature) (api.KeyChangeProposal, error) {
+	if _, ok := m.approvers[approver]; !ok {
+		return api.KeyChangeProposal{}, xerrors.Errorf("%s is not a configured approver", approver)
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	p, err := m.getOpen(id)
+	if err != nil {
+		return api.KeyChangeProposal{}, err
+	}
+
+	if err := sigs.Verify(sig, approver, p.Payload); err != nil {
+		return api.KeyChangeProposal{}, xerrors.Errorf("invalid approval signature: %w", err)
+	}
+
+	p.Approver = &approver
+	if err := m.persist(p); err != nil {
+		return api.KeyChangeProposal{}, err
+	}
+
+	log.Warnw("key change approved", "id", id, "approver", approver, "executeAfter", p.ExecuteAfter)
+
+	return *p, nil
+}
+
+func (m *Manager) Cancel(id uint64) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	p, err := m.getOpen(id)
+	if err != nil {
+		return err
+	}
+
+	p.Cancelled = true
+	if err := m.persist(p); err != nil {
+		return err
+	}
+
+	log.Warnw("key change cancelled", "id", id)
+	return nil
+}
+
+// Execute sends the ChangeWorkerAddress message for an approved proposal
+// whose timelock has passed
+func (m *Manager) Execute(ctx context.Context, id uint64) (cid.Cid, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	p, err := m.getOpen(id)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if p.Approver == nil && len(m.approvers) > 0 {
+		return cid.Undef, xerrors.Errorf("key change %d wasn't approved", id)
+	}
+	if now := time.Now(); now.Before(p.ExecuteAfter) {
+		return cid.Undef, xerrors.Errorf("key change %d is timelocked for another %s", id, p.ExecuteAfter.Sub(now).Round(time.Second))
+	}
+
+	return m.send(ctx, p)
+}
+
+// send must be called with m.lk held
+func (m *Manager) send(ctx context.Context, p *api.KeyChangeProposal) (cid.Cid, error) {
+	mi, err := m.api.StateMinerInfo(ctx, m.maddr, types.EmptyTSK)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	params, aerr := actors.SerializeParams(&miner0.ChangeWorkerAddressParams{
+		NewWorker:       p.NewWorker,
+		NewControlAddrs: p.NewControlAddrs,
+	})
+	if aerr != nil {
+		return cid.Undef, xerrors.Errorf("serializing params: %w", aerr)
+	}
+
+	smsg, err := m.api.MpoolPushMessage(ctx, &types.Message{
+		From:   mi.Owner,
+		To:     m.maddr,
+		Method: builtin.MethodsMiner.ChangeWorkerAddress,
+
+		Value:  big.Zero(),
+		Params: params,
+	}, nil)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("mpool push: %w", err)
+	}
+
+	mcid := smsg.Cid()
+	p.Message = &mcid
+	if err := m.persist(p); err != nil {
+		log.Errorf("persisting key change %d: %+v", p.ID, err)
+	}
+
+	log.Warnw("key change executed", "id", p.ID, "message", mcid)
+
+	return mcid, nil
+}
+
+// getOpen must be called with m.lk held
+func (m *Manager) getOpen(id uint64) (*api.KeyChangeProposal, error) {
+	p, ok := m.proposals[id]
+	if !ok {
+		return nil, xerrors.Errorf("key change %d not found", id)
+	}
+	if p.Cancelled {
+		return nil, xerrors.Errorf("key change %d was cancelled", id)
+	}
+	if p.Message != nil {
+		return nil, xerrors.Errorf("key change %d was already executed in %s", id, *p.Message)
+	}
+
+	return p, nil
+}
+
+func (m *Manager) persist(p *api.KeyChangeProposal) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return xerrors.Errorf("encoding key change proposal: %w", err)
+	}
+
+	if err := m.ds.Put(datastore.NewKey(fmt.Sprint(p.ID)), b); err != nil {
+		return xerrors.Errorf("storing key change proposal: %w", err)
+	}
+
+	return nil
+}
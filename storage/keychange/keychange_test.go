@@ -0,0 +1,158 @@
+package keychange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+)
+
+type fakeAPI struct {
+	info miner.MinerInfo
+	sent []*types.Message
+}
+
+func (f *fakeAPI) StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error) {
+	return f.info, nil
+}
+
+func (f *fakeAPI) StateAccountKey(_ context.Context, a address.Address, _ types.TipSetKey) (address.Address, error) {
+	return a, nil
+}
+
+func (f *fakeAPI) MpoolPushMessage(_ context.Context, msg *types.Message, _ *api.MessageSendSpec) (*types.SignedMessage, error) {
+	f.sent = append(f.sent, msg)
+	return &types.SignedMessage{Message: *msg}, nil
+}
+
+func newKey(t *testing.T) ([]byte, address.Address) {
+	pk, err := sigs.Generate(crypto.SigTypeSecp256k1)
+	require.NoError(t, err)
+	pub, err := sigs.ToPublic(crypto.SigTypeSecp256k1, pk)
+	require.NoError(t, err)
+	addr, err := address.NewSecp256k1Address(pub)
+	require.NoError(t, err)
+	return pk, addr
+}
+
+func TestKeyChange(t *testing.T) {
+	ctx := context.Background()
+	maddr := tutils.NewIDAddr(t, 1000)
+	owner := tutils.NewIDAddr(t, 101)
+	newWorker := tutils.NewIDAddr(t, 102)
+
+	approverKey, approver := newKey(t)
+	otherKey, other := newKey(t)
+
+	newManager := func(timelock time.Duration, approvers ...address.Address) (*fakeAPI, *Manager) {
+		fapi := &fakeAPI{info: miner.MinerInfo{Owner: owner, Worker: owner}}
+		m := NewManager(fapi, dss.MutexWrap(datastore.NewMapDatastore()), maddr, timelock, approvers)
+		require.NoError(t, m.Start(ctx))
+		return fapi, m
+	}
+
+	sign := func(pk []byte, p api.KeyChangeProposal) *crypto.Signature {
+		sig, err := sigs.Sign(crypto.SigTypeSecp256k1, pk, p.Payload)
+		require.NoError(t, err)
+		return sig
+	}
+
+	t.Run("no approvers", func(t *testing.T) {
+		fapi, m := newManager(50 * time.Millisecond)
+		p, err := m.Propose(ctx, newWorker, nil)
+		require.NoError(t, err)
+		require.Nil(t, p.Message, "held until the timelock passed")
+
+		_, err = m.Execute(ctx, p.ID)
+		require.Error(t, err)
+		require.Empty(t, fapi.sent)
+
+		time.Sleep(50 * time.Millisecond)
+		_, err = m.Execute(ctx, p.ID)
+		require.NoError(t, err)
+		require.Len(t, fapi.sent, 1)
+		require.Equal(t, builtin.MethodsMiner.ChangeWorkerAddress, fapi.sent[0].Method)
+
+		_, err = m.Execute(ctx, p.ID)
+		require.Error(t, err)
+	})
+
+	t.Run("no approvers or timelock", func(t *testing.T) {
+		fapi, m := newManager(0)
+		p, err := m.Propose(ctx, newWorker, nil)
+		require.NoError(t, err)
+		require.NotNil(t, p.Message, "sent right away")
+		require.Len(t, fapi.sent, 1)
+		require.Equal(t, builtin.MethodsMiner.ChangeWorkerAddress, fapi.sent[0].Method)
+
+		_, err = m.Execute(ctx, p.ID)
+		require.Error(t, err)
+	})
+
+	t.Run("approver is owner", func(t *testing.T) {
+		_, m := newManager(0, owner)
+		_, err := m.Propose(ctx, newWorker, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("needs approval", func(t *testing.T) {
+		fapi, m := newManager(0, approver)
+		p, err := m.Propose(ctx, newWorker, nil)
+		require.NoError(t, err)
+
+		_, err = m.Execute(ctx, p.ID)
+		require.Error(t, err)
+
+		// signature from a key which isn't an approver
+		_, err = m.Approve(p.ID, other, sign(otherKey, p))
+		require.Error(t, err)
+		// approver address with someone else's signature
+		_, err = m.Approve(p.ID, approver, sign(otherKey, p))
+		require.Error(t, err)
+
+		_, err = m.Approve(p.ID, approver, sign(approverKey, p))
+		require.NoError(t, err)
+
+		_, err = m.Execute(ctx, p.ID)
+		require.NoError(t, err)
+		require.Len(t, fapi.sent, 1)
+		require.Equal(t, owner, fapi.sent[0].From)
+		require.Equal(t, builtin.MethodsMiner.ChangeWorkerAddress, fapi.sent[0].Method)
+
+		_, err = m.Execute(ctx, p.ID)
+		require.Error(t, err)
+	})
+
+	t.Run("timelock", func(t *testing.T) {
+		fapi, m := newManager(time.Hour, approver)
+		p, err := m.Propose(ctx, newWorker, nil)
+		require.NoError(t, err)
+
+		_, err = m.Propose(ctx, newWorker, nil)
+		require.Error(t, err, "only one open proposal")
+
+		_, err = m.Approve(p.ID, approver, sign(approverKey, p))
+		require.NoError(t, err)
+
+		_, err = m.Execute(ctx, p.ID)
+		require.Error(t, err)
+		require.Empty(t, fapi.sent)
+
+		require.NoError(t, m.Cancel(p.ID))
+		_, err = m.Propose(ctx, newWorker, nil)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,265 @@
+package labels
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var dsPrefix = datastore.NewKey("/labels")
+
+var (
+	sectorsKey = datastore.NewKey("sectors")
+	dealsKey   = datastore.NewKey("deals")
+)
+
+const (
+	maxKeyLen   = 63
+	maxValueLen = 256
+	maxLabels   = 64
+)
+
+var validKey = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.\-/]*[a-zA-Z0-9])?$`)
+
+// Store keeps operator defined key/value labels of sectors and deals
+type Store struct {
+	ds datastore.Batching
+
+	lk sync.Mutex
+}
+
+func NewStore(ds dtypes.MetadataDS) *Store {
+	return &Store{
+		ds: namespace.Wrap(ds, dsPrefix),
+	}
+}
+
+func sectorKey(s abi.SectorNumber) datastore.Key {
+	return sectorsKey.ChildString(strconv.FormatUint(uint64(s), 10))
+}
+
+func dealKey(propCid cid.Cid) datastore.Key {
+	return dealsKey.ChildString(propCid.String())
+}
+
+// SetSector merges labels into the labels of a sector, labels with an empty
+// value are removed
+func (s *Store) SetSector(sector abi.SectorNumber, labels map[string]string) error {
+	return s.set(sectorKey(sector), labels)
+}
+
+// SetDeal merges labels into the labels of a deal, labels with an empty value
+// are removed
+func (s *Store) SetDeal(propCid cid.Cid, labels map[string]string) error {
+	return s.set(dealKey(propCid), labels)
+}
+
+// Sector returns the labels of a sector
+func (s *Store) Sector(sector abi.SectorNumber) (map[string]string, error) {
+	return s.get(sectorKey(sector))
+}
+
+// Deal returns the labels of a deal
+func (s *Store) Deal(propCid cid.Cid) (map[string]string, error) {
+	return s.get(dealKey(propCid))
+}
+
+// RemoveSector removes all labels of a sector
+func (s *Store) RemoveSector(sector abi.SectorNumber) error {
+	return s.ds.Delete(sectorKey(sector))
+}
+
+// Sectors returns the labels of labelled sectors matching the selector
+func (s *Store) Sectors(selector map[string]string) ([]api.SectorLabels, error) {
+	var out []api.SectorLabels
+	err := s.list(sectorsKey, selector, func(name string, labels map[string]string) error {
+		n, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			return err
+		}
+		out = append(out, api.SectorLabels{Sector: abi.SectorNumber(n), Labels: labels})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Sector < out[j].Sector
+	})
+	return out, nil
+}
+
+// Deals returns the labels of labelled deals matching the selector
+func (s *Store) Deals(selector map[string]string) ([]api.DealLabels, error) {
+	var out []api.DealLabels
+	err := s.list(dealsKey, selector, func(name string, labels map[string]string) error {
+		c, err := cid.Parse(name)
+		if err != nil {
+			return err
+		}
+		out = append(out, api.DealLabels{ProposalCid: c, Labels: labels})
+		return nil
+	})
+	return out, err
+}
+
+func (s *Store) set(k datastore.Key, labels map[string]string) error {
+	if err := Validate(labels); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	cur, err := s.get(k)
+	if err != nil {
+		return err
+	}
+
+	for lk, lv := range labels {
+		if lv == "" {
+			delete(cur, lk)
+			continue
+		}
+		cur[lk] = lv
+	}
+
+	if len(cur) == 0 {
+		return s.ds.Delete(k)
+	}
+	if len(cur) > maxLabels {
+		return xerrors.Errorf("too many labels, %d, the limit is %d", len(cur), maxLabels)
+	}
+
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return err
+	}
+	if err := s.ds.Put(k, b); err != nil {
+		return xerrors.Errorf("writing labels: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) get(k datastore.Key) (map[string]string, error) {
+	b, err := s.ds.Get(k)
+	if err == datastore.ErrNotFound {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting labels: %w", err)
+	}
+
+	out := map[string]string{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, xerrors.Errorf("decoding labels %s: %w", k, err)
+	}
+	return out, nil
+}
+
+func (s *Store) list(prefix datastore.Key, selector map[string]string, cb func(name string, labels map[string]string) error) error {
+	res, err := s.ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return xerrors.Errorf("querying labels: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return xerrors.Errorf("reading labels: %w", r.Error)
+		}
+
+		labels := map[string]string{}
+		if err := json.Unmarshal(r.Value, &labels); err != nil {
+			return xerrors.Errorf("decoding labels %s: %w", r.Key, err)
+		}
+		if !Matches(labels, selector) {
+			continue
+		}
+
+		if err := cb(datastore.NewKey(r.Key).BaseNamespace(), labels); err != nil {
+			return xerrors.Errorf("labels %s: %w", r.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks label keys and values, empty values are allowed, they
+// remove a label
+func Validate(labels map[string]string) error {
+	for k, v := range labels {
+		if len(k) > maxKeyLen || !validKey.MatchString(k) {
+			return xerrors.Errorf("invalid label key '%s'", k)
+		}
+		if len(v) > maxValueLen {
+			return xerrors.Errorf("value of label '%s' is longer than %d bytes", k, maxValueLen)
+		}
+	}
+	return nil
+}
+
+// Matches returns whether labels has every label of the selector, a selector
+// label with an empty value matches any value
+func Matches(labels map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		lv, ok := labels[k]
+		if !ok || (v != "" && lv != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse parses key=value pairs, a pair without a value ('key' or 'key=')
+// has an empty value
+func Parse(pairs []string) (map[string]string, error) {
+	out := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		k := strings.TrimSpace(kv[0])
+		if k == "" {
+			return nil, xerrors.Errorf("missing key in label '%s'", p)
+		}
+		var v string
+		if len(kv) == 2 {
+			v = strings.TrimSpace(kv[1])
+		}
+		out[k] = v
+	}
+
+	if err := Validate(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// String formats labels as sorted key=value pairs
+func String(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + labels[k]
+	}
+	return strings.Join(pairs, ",")
+}
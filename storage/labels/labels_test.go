@@ -0,0 +1,78 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+func TestSectorLabels(t *testing.T) {
+	s := NewStore(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	require.NoError(t, s.SetSector(1, map[string]string{"customer": "acme", "rack": "a1"}))
+	require.NoError(t, s.SetSector(2, map[string]string{"customer": "acme", "rack": "b2"}))
+	require.NoError(t, s.SetSector(10, map[string]string{"customer": "other"}))
+
+	// merge, and remove with an empty value
+	require.NoError(t, s.SetSector(1, map[string]string{"batch": "7", "rack": ""}))
+	l, err := s.Sector(1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"customer": "acme", "batch": "7"}, l)
+
+	acme, err := s.Sectors(map[string]string{"customer": "acme"})
+	require.NoError(t, err)
+	require.Len(t, acme, 2)
+	require.Equal(t, abi.SectorNumber(1), acme[0].Sector)
+	require.Equal(t, abi.SectorNumber(2), acme[1].Sector)
+
+	// empty selector value matches any value
+	racked, err := s.Sectors(map[string]string{"rack": ""})
+	require.NoError(t, err)
+	require.Len(t, racked, 1)
+	require.Equal(t, abi.SectorNumber(2), racked[0].Sector)
+
+	all, err := s.Sectors(nil)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+
+	// removing the last label removes the entry
+	require.NoError(t, s.SetSector(10, map[string]string{"customer": ""}))
+	all, err = s.Sectors(nil)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	require.Error(t, s.SetSector(1, map[string]string{"bad key": "x"}))
+}
+
+func TestDealLabels(t *testing.T) {
+	s := NewStore(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	c, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetDeal(c, map[string]string{"customer": "acme"}))
+	deals, err := s.Deals(map[string]string{"customer": "acme"})
+	require.NoError(t, err)
+	require.Len(t, deals, 1)
+	require.True(t, deals[0].ProposalCid.Equals(c))
+
+	// deal and sector labels don't mix
+	sectors, err := s.Sectors(nil)
+	require.NoError(t, err)
+	require.Empty(t, sectors)
+}
+
+func TestParse(t *testing.T) {
+	l, err := Parse([]string{"customer=acme", "rack", "batch="})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"customer": "acme", "rack": "", "batch": ""}, l)
+	require.Equal(t, "batch=,customer=acme,rack=", String(l))
+
+	_, err = Parse([]string{"=x"})
+	require.Error(t, err)
+}
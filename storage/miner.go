@@ -35,6 +35,7 @@ import (
 	"github.com/filecoin-project/lotus/chain/types"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
 	"github.com/filecoin-project/lotus/journal"
+	"github.com/filecoin-project/lotus/lib/checkpoint"
 	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
@@ -55,6 +56,12 @@ type Miner struct {
 
 	getSealConfig dtypes.GetSealingConfigFunc
 	sealing       *sealing.Sealing
+	archival      bool
+	// sealingReady is closed once sector state machines are restarted
+	sealingReady chan struct{}
+	checkpoints  *checkpoint.Checkpointer
+	sectorSubs   sectorSubs
+	wdpost       *WindowPoStScheduler
 
 	sealingEvtType journal.EventType
 }
@@ -110,7 +117,7 @@ type storageMinerApi interface {
 	WalletHas(context.Context, address.Address) (bool, error)
 }
 
-func NewMiner(api storageMinerApi, maddr, worker address.Address, h host.Host, ds datastore.Batching, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier, gsd dtypes.GetSealingConfigFunc, feeCfg config.MinerFeeConfig) (*Miner, error) {
+func NewMiner(api storageMinerApi, maddr, worker address.Address, h host.Host, ds datastore.Batching, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier, gsd dtypes.GetSealingConfigFunc, feeCfg config.MinerFeeConfig, cp *checkpoint.Checkpointer, wdpost *WindowPoStScheduler) (*Miner, error) {
 	m := &Miner{
 		api:    api,
 		feeCfg: feeCfg,
@@ -123,6 +130,9 @@ func NewMiner(api storageMinerApi, maddr, worker address.Address, h host.Host, d
 		maddr:          maddr,
 		worker:         worker,
 		getSealConfig:  gsd,
+		checkpoints:    cp,
+		wdpost:         wdpost,
+		sealingReady:   make(chan struct{}),
 		sealingEvtType: journal.J.RegisterEventType("storage", "sealing_states"),
 	}
 
@@ -134,6 +144,61 @@ func (m *Miner) Run(ctx context.Context) error {
 		return xerrors.Errorf("miner preflight checks failed: %w", err)
 	}
 
+	if err := m.setupSealing(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := m.sealing.Run(ctx); err != nil {
+			return // logged inside the function
+		}
+		close(m.sealingReady)
+	}()
+
+	return nil
+}
+
+// SealingReady returns true once the sealing subsystem restarted the sector
+// state machines, in archival mode once sector metadata is loaded
+func (m *Miner) SealingReady() bool {
+	select {
+	case <-m.sealingReady:
+		return true
+	default:
+		return false
+	}
+}
+
+// RunArchival starts the miner in archival mode. Sector metadata stays
+// readable, but sector state machines aren't restarted and no new sectors
+// are accepted, so the only work left for this process is proving.
+func (m *Miner) RunArchival(ctx context.Context) error {
+	if err := m.runPreflightChecks(ctx); err != nil {
+		return xerrors.Errorf("miner preflight checks failed: %w", err)
+	}
+
+	m.archival = true
+	if err := m.setupSealing(ctx); err != nil {
+		return err
+	}
+
+	sectors, err := m.sealing.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	for _, s := range sectors {
+		if s.State != sealing.Proving {
+			log.Warnw("sector is not finalized, it won't make progress in archival mode", "sector", s.SectorNumber, "state", s.State)
+		}
+	}
+
+	log.Infof("miner %s running in archival mode, %d sectors", m.maddr, len(sectors))
+	close(m.sealingReady)
+	return nil
+}
+
+func (m *Miner) setupSealing(ctx context.Context) error {
 	md, err := m.api.StateMinerProvingDeadline(ctx, m.maddr, types.EmptyTSK)
 	if err != nil {
 		return xerrors.Errorf("getting miner info: %w", err)
@@ -150,7 +215,17 @@ func (m *Miner) Run(ctx context.Context) error {
 	pcp := sealing.NewBasicPreCommitPolicy(adaptedAPI, miner0.MaxSectorExpirationExtension-(miner0.WPoStProvingPeriod*2), md.PeriodStart%miner0.WPoStProvingPeriod)
 	m.sealing = sealing.New(adaptedAPI, fc, NewEventsAdapter(evts), m.maddr, m.ds, m.sealer, m.sc, m.verif, &pcp, sealing.GetSealingConfigFunc(m.getSealConfig), m.handleSealingNotifications)
 
-	go m.sealing.Run(ctx) //nolint:errcheck // logged intside the function
+	if !m.archival {
+		var cp sealing.Checkpoint
+		if _, ok, err := m.checkpoints.Load("sealing", &cp); err != nil {
+			log.Warnf("loading sealing checkpoint: %s", err)
+		} else if ok {
+			m.sealing.RestoreCheckpoint(cp)
+		}
+		m.checkpoints.Register("sealing", func() (interface{}, error) {
+			return m.sealing.Checkpoint(), nil
+		})
+	}
 
 	return nil
 }
@@ -165,6 +240,9 @@ func (m *Miner) handleSealingNotifications(before, after sealing.SectorInfo) {
 			Error:        after.LastErr,
 		}
 	})
+
+	m.publishSectorUpdate(before, after)
+	m.recordPreCommitExpiry(before, after)
 }
 
 func (m *Miner) Stop(ctx context.Context) error {
@@ -0,0 +1,410 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-storedcounter"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("outbox")
+
+var dsPrefix = datastore.NewKey("/outbox/msgs")
+
+// MaxHistory is the number of messages kept in the outbox, including sent
+// and failed ones. Messages waiting for a signature are kept until they're
+// signed or dropped.
+const MaxHistory = 500
+
+// DefaultBypass are the methods whose messages must land within a proving
+// deadline, they're sent by the full node without waiting for a signature
+var DefaultBypass = []string{"SubmitWindowedPoSt", "DeclareFaults", "DeclareFaultsRecovered"}
+
+type outboxAPI interface {
+	StateAccountKey(context.Context, address.Address, types.TipSetKey) (address.Address, error)
+	StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error)
+	MpoolGetNonce(context.Context, address.Address) (uint64, error)
+	GasEstimateMessageGas(context.Context, *types.Message, *api.MessageSendSpec, types.TipSetKey) (*types.Message, error)
+	MpoolPush(context.Context, *types.SignedMessage) (cid.Cid, error)
+	MpoolPushMessage(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error)
+}
+
+// Outbox holds messages of the miner until they're signed offline, e.g. on
+// an air-gapped machine with 'lotus wallet sign'. Messages get their nonce
+// and gas when they're queued, the signer signs the CID of the unsigned
+// message. Messages of the methods in the bypass list are sent by the full
+// node right away, often from the sender of queued messages, which are
+// renumbered afterwards.
+type Outbox struct {
+	api     outboxAPI
+	ds      datastore.Batching
+	counter *storedcounter.StoredCounter
+	bypass  map[string]bool
+
+	lk sync.Mutex
+	// changed is closed and replaced whenever a message is updated
+	changed chan struct{}
+}
+
+func New(oapi outboxAPI, ds dtypes.MetadataDS, bypass []string) *Outbox {
+	o := &Outbox{
+		api:     oapi,
+		ds:      namespace.Wrap(ds, dsPrefix),
+		counter: storedcounter.New(ds, datastore.NewKey("/outbox/counter")),
+		bypass:  map[string]bool{},
+		changed: make(chan struct{}),
+	}
+	for _, m := range bypass {
+		o.bypass[m] = true
+	}
+	return o
+}
+
+// Push queues msg for an offline signature and waits until it's signed and
+// pushed to the mpool, like MpoolPushMessage. A pending message with the same
+// content is waited for instead of queueing another one, so callers retrying
+// after a restart don't send a message twice.
+func (o *Outbox) Push(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	method, err := o.methodName(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if o.bypass[method] {
+		return o.pushBypass(ctx, msg, spec)
+	}
+
+	id, err := o.enqueue(ctx, msg, spec, method)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		o.lk.Lock()
+		m, err := o.get(id)
+		changed := o.changed
+		o.lk.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case m.Error != "":
+			return nil, xerrors.Errorf("outbox message %d: %s", id, m.Error)
+		case m.Signature != nil:
+			return &types.SignedMessage{Message: *m.Message, Signature: *m.Signature}, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pushBypass sends msg through the full node, which takes the next mpool
+// nonce of the sender. Queued messages of the sender don't hold their nonces
+// in the mpool, so they're renumbered after it.
+func (o *Outbox) pushBypass(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	from, err := o.api.StateAccountKey(ctx, msg.From, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("resolving sender key address: %w", err)
+	}
+
+	smsg, err := o.api.MpoolPushMessage(ctx, msg, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	if _, err := o.renumber(ctx, from); err != nil {
+		log.Errorw("renumbering outbox messages after a bypassed message", "from", from, "error", err)
+	}
+	return smsg, nil
+}
+
+func (o *Outbox) enqueue(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec, method string) (uint64, error) {
+	from, err := o.api.StateAccountKey(ctx, msg.From, types.EmptyTSK)
+	if err != nil {
+		return 0, xerrors.Errorf("resolving sender key address: %w", err)
+	}
+
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	all, err := o.list()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range all {
+		if !m.Pending() || m.Message.From != from {
+			continue
+		}
+		if m.Message.To == msg.To && m.Message.Method == msg.Method && m.Message.Value.Equals(msg.Value) && bytes.Equal(m.Message.Params, msg.Params) {
+			log.Infow("message is already waiting for a signature", "id", m.ID, "method", m.Method)
+			return m.ID, nil
+		}
+	}
+
+	nonce, err := o.renumber(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+
+	unsigned := *msg
+	unsigned.From = from
+	unsigned.Nonce = nonce
+	est, err := o.api.GasEstimateMessageGas(ctx, &unsigned, spec, types.EmptyTSK)
+	if err != nil {
+		return 0, xerrors.Errorf("estimating gas: %w", err)
+	}
+
+	id, err := o.counter.Next()
+	if err != nil {
+		return 0, xerrors.Errorf("getting message id: %w", err)
+	}
+	m := api.OutboxMessage{
+		ID:      id,
+		Method:  method,
+		Message: est,
+		Created: time.Now(),
+	}
+	if err := o.put(m); err != nil {
+		return 0, err
+	}
+	for _, old := range all {
+		if old.Pending() || old.ID+MaxHistory > id {
+			continue
+		}
+		if err := o.ds.Delete(key(old.ID)); err != nil && err != datastore.ErrNotFound {
+			log.Warnf("removing old outbox message: %s", err)
+		}
+	}
+
+	log.Warnw("message waiting for an offline signature", "id", id, "method", method, "from", from, "nonce", nonce)
+	return id, nil
+}
+
+// Sign pushes a pending message with its signature, which must be by the
+// sender of the unsigned message over its CID
+func (o *Outbox) Sign(ctx context.Context, id uint64, sig crypto.Signature) (cid.Cid, error) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	m, err := o.get(id)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if !m.Pending() {
+		return cid.Undef, xerrors.Errorf("outbox message %d isn't waiting for a signature", id)
+	}
+
+	if err := sigs.Verify(&sig, m.Message.From, m.Message.Cid().Bytes()); err != nil {
+		return cid.Undef, xerrors.Errorf("checking signature, the message may have been renumbered since: %w", err)
+	}
+
+	smsg := &types.SignedMessage{Message: *m.Message, Signature: sig}
+	c, err := o.api.MpoolPush(ctx, smsg)
+	if err != nil {
+		// the nonce may be taken by now, the caller queues the message again
+		m.Error = fmt.Sprintf("pushing signed message: %s", err)
+		if perr := o.put(m); perr != nil {
+			log.Errorf("saving outbox message %d: %s", id, perr)
+		}
+		if _, rerr := o.renumber(ctx, m.Message.From); rerr != nil {
+			log.Errorf("renumbering outbox messages: %s", rerr)
+		}
+		return cid.Undef, xerrors.Errorf("pushing signed message: %w", err)
+	}
+
+	m.Signature = &sig
+	m.Signed = &c
+	if err := o.put(m); err != nil {
+		return cid.Undef, err
+	}
+
+	log.Infow("pushed offline signed message", "id", id, "cid", c)
+	return c, nil
+}
+
+// Drop fails a pending message, the caller waiting for it gets an error.
+// Later messages of the sender are renumbered to fill its nonce.
+func (o *Outbox) Drop(ctx context.Context, id uint64) error {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	m, err := o.get(id)
+	if err != nil {
+		return err
+	}
+	if !m.Pending() {
+		return xerrors.Errorf("outbox message %d isn't waiting for a signature", id)
+	}
+
+	m.Error = "dropped from the outbox"
+	if err := o.put(m); err != nil {
+		return err
+	}
+
+	_, err = o.renumber(ctx, m.Message.From)
+	return err
+}
+
+// renumber gives the pending messages of from consecutive nonces following
+// the mpool nonce of the sender, and returns the nonce after them. Messages
+// sent around the outbox, and dropped or failed ones, would otherwise leave
+// pending messages with taken nonces or gaps. Signatures over the old CIDs
+// are rejected by Sign, the signer has to sign renumbered messages again.
+// Must be called with o.lk held.
+func (o *Outbox) renumber(ctx context.Context, from address.Address) (uint64, error) {
+	all, err := o.list()
+	if err != nil {
+		return 0, err
+	}
+
+	nonce, err := o.api.MpoolGetNonce(ctx, from)
+	if err != nil {
+		return 0, xerrors.Errorf("getting nonce: %w", err)
+	}
+
+	for _, m := range all {
+		if !m.Pending() || m.Message.From != from {
+			continue
+		}
+
+		if m.Message.Nonce != nonce {
+			log.Warnw("renumbering message waiting for an offline signature", "id", m.ID, "method", m.Method, "nonce", m.Message.Nonce, "newNonce", nonce)
+			m.Message.Nonce = nonce
+			if err := o.put(m); err != nil {
+				return 0, err
+			}
+		}
+		nonce++
+	}
+
+	return nonce, nil
+}
+
+// List returns the messages in the outbox, oldest first
+func (o *Outbox) List() ([]api.OutboxMessage, error) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+
+	return o.list()
+}
+
+func (o *Outbox) methodName(ctx context.Context, msg *types.Message) (string, error) {
+	if msg.Method == 0 {
+		return "Send", nil
+	}
+
+	act, err := o.api.StateGetActor(ctx, msg.To, types.EmptyTSK)
+	if err != nil {
+		return "", xerrors.Errorf("getting recipient actor: %w", err)
+	}
+	meta, ok := stmgr.MethodsMap[act.Code][msg.Method]
+	if !ok {
+		return fmt.Sprintf("method %d", msg.Method), nil
+	}
+	return meta.Name, nil
+}
+
+// list must be called with o.lk held
+func (o *Outbox) list() ([]api.OutboxMessage, error) {
+	res, err := o.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying outbox: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.OutboxMessage
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading outbox: %w", r.Error)
+		}
+
+		var m api.OutboxMessage
+		if err := json.Unmarshal(r.Value, &m); err != nil {
+			log.Errorw("decoding outbox message", "key", r.Key, "error", err)
+			continue
+		}
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// get must be called with o.lk held
+func (o *Outbox) get(id uint64) (api.OutboxMessage, error) {
+	b, err := o.ds.Get(key(id))
+	if err == datastore.ErrNotFound {
+		return api.OutboxMessage{}, xerrors.Errorf("outbox message %d not found", id)
+	}
+	if err != nil {
+		return api.OutboxMessage{}, xerrors.Errorf("loading outbox message %d: %w", id, err)
+	}
+
+	var m api.OutboxMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return api.OutboxMessage{}, xerrors.Errorf("decoding outbox message %d: %w", id, err)
+	}
+	return m, nil
+}
+
+// put must be called with o.lk held, it wakes up callers waiting for
+// messages
+func (o *Outbox) put(m api.OutboxMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := o.ds.Put(key(m.ID), b); err != nil {
+		return xerrors.Errorf("saving outbox message %d: %w", m.ID, err)
+	}
+
+	close(o.changed)
+	o.changed = make(chan struct{})
+	return nil
+}
+
+func key(id uint64) datastore.Key {
+	return datastore.NewKey(fmt.Sprint(id))
+}
+
+// FullNode sends the messages of MpoolPushMessage through an outbox
+type FullNode struct {
+	api.FullNode
+	Outbox *Outbox
+}
+
+func (n *FullNode) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	return n.Outbox.Push(ctx, msg, spec)
+}
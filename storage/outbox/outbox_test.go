@@ -0,0 +1,291 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+)
+
+// fakeAPI is an mpool taking messages only with the next nonce of the sender
+type fakeAPI struct {
+	key address.Address
+
+	lk     sync.Mutex
+	nonce  uint64
+	pushed []*types.SignedMessage
+	direct []*types.Message
+}
+
+func (f *fakeAPI) StateAccountKey(context.Context, address.Address, types.TipSetKey) (address.Address, error) {
+	return f.key, nil
+}
+
+func (f *fakeAPI) StateGetActor(context.Context, address.Address, types.TipSetKey) (*types.Actor, error) {
+	return &types.Actor{Code: builtin0.StorageMinerActorCodeID}, nil
+}
+
+func (f *fakeAPI) MpoolGetNonce(context.Context, address.Address) (uint64, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.nonce, nil
+}
+
+func (f *fakeAPI) GasEstimateMessageGas(_ context.Context, msg *types.Message, _ *api.MessageSendSpec, _ types.TipSetKey) (*types.Message, error) {
+	out := *msg
+	out.GasLimit = 1000
+	out.GasFeeCap = abi.NewTokenAmount(100)
+	out.GasPremium = abi.NewTokenAmount(10)
+	return &out, nil
+}
+
+func (f *fakeAPI) MpoolPush(_ context.Context, smsg *types.SignedMessage) (cid.Cid, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if smsg.Message.Nonce != f.nonce {
+		return cid.Undef, xerrors.Errorf("nonce %d, expected %d", smsg.Message.Nonce, f.nonce)
+	}
+	f.nonce++
+	f.pushed = append(f.pushed, smsg)
+	return smsg.Cid(), nil
+}
+
+func (f *fakeAPI) MpoolPushMessage(_ context.Context, msg *types.Message, _ *api.MessageSendSpec) (*types.SignedMessage, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	out := *msg
+	out.From = f.key
+	out.Nonce = f.nonce
+	f.nonce++
+	f.direct = append(f.direct, &out)
+	return &types.SignedMessage{Message: out}, nil
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+
+	pk, err := sigs.Generate(crypto.SigTypeSecp256k1)
+	require.NoError(t, err)
+	pub, err := sigs.ToPublic(crypto.SigTypeSecp256k1, pk)
+	require.NoError(t, err)
+	key, err := address.NewSecp256k1Address(pub)
+	require.NoError(t, err)
+
+	fa := &fakeAPI{key: key, nonce: 5}
+	ob := New(fa, dss.MutexWrap(datastore.NewMapDatastore()), DefaultBypass)
+
+	worker := tutils.NewIDAddr(t, 100)
+	maddr := tutils.NewIDAddr(t, 1000)
+	msg := func(method abi.MethodNum, params string) *types.Message {
+		return &types.Message{From: worker, To: maddr, Method: method, Value: abi.NewTokenAmount(0), Params: []byte(params)}
+	}
+
+	// PoSt messages are sent by the full node
+	_, err = ob.Push(ctx, msg(builtin0.MethodsMiner.SubmitWindowedPoSt, "post"), nil)
+	require.NoError(t, err)
+	require.Len(t, fa.direct, 1)
+
+	type res struct {
+		smsg *types.SignedMessage
+		err  error
+	}
+	push := func(m *types.Message) chan res {
+		done := make(chan res, 1)
+		go func() {
+			smsg, err := ob.Push(ctx, m, nil)
+			done <- res{smsg, err}
+		}()
+		return done
+	}
+	waitPending := func(n int) []api.OutboxMessage {
+		var msgs []api.OutboxMessage
+		require.Eventually(t, func() bool {
+			var lerr error
+			msgs, lerr = ob.List()
+			return lerr == nil && len(msgs) == n
+		}, 5*time.Second, 10*time.Millisecond)
+		return msgs
+	}
+
+	first := push(msg(builtin0.MethodsMiner.PreCommitSector, "a"))
+	msgs := waitPending(1)
+	// the same message after a restart waits for the queued one
+	id, err := ob.enqueue(ctx, msg(builtin0.MethodsMiner.PreCommitSector, "a"), nil, "PreCommitSector")
+	require.NoError(t, err)
+	require.Equal(t, msgs[0].ID, id)
+	second := push(msg(builtin0.MethodsMiner.PreCommitSector, "b"))
+	msgs = waitPending(2)
+
+	require.Equal(t, "PreCommitSector", msgs[0].Method)
+	require.Equal(t, key, msgs[0].Message.From)
+	// the PoSt message took nonce 5
+	require.EqualValues(t, 6, msgs[0].Message.Nonce)
+	require.EqualValues(t, 7, msgs[1].Message.Nonce)
+	require.EqualValues(t, 1000, msgs[0].Message.GasLimit)
+	require.True(t, msgs[0].Pending())
+
+	// signatures by other keys, or over other messages, are rejected
+	bad, err := sigs.Sign(crypto.SigTypeSecp256k1, pk, msgs[1].Message.Cid().Bytes())
+	require.NoError(t, err)
+	_, err = ob.Sign(ctx, msgs[0].ID, *bad)
+	require.Error(t, err)
+
+	sig, err := sigs.Sign(crypto.SigTypeSecp256k1, pk, msgs[0].Message.Cid().Bytes())
+	require.NoError(t, err)
+	c, err := ob.Sign(ctx, msgs[0].ID, *sig)
+	require.NoError(t, err)
+	require.Len(t, fa.pushed, 1)
+	require.Equal(t, fa.pushed[0].Cid(), c)
+
+	r := <-first
+	require.NoError(t, r.err)
+	require.Equal(t, c, r.smsg.Cid())
+
+	_, err = ob.Sign(ctx, msgs[0].ID, *sig)
+	require.Error(t, err)
+
+	require.NoError(t, ob.Drop(ctx, msgs[1].ID))
+	r = <-second
+	require.Error(t, r.err)
+
+	msgs, err = ob.List()
+	require.NoError(t, err)
+	require.NotNil(t, msgs[0].Signed)
+	require.Equal(t, "dropped from the outbox", msgs[1].Error)
+}
+
+func TestOutboxBypassNonces(t *testing.T) {
+	ctx := context.Background()
+
+	pk, err := sigs.Generate(crypto.SigTypeSecp256k1)
+	require.NoError(t, err)
+	pub, err := sigs.ToPublic(crypto.SigTypeSecp256k1, pk)
+	require.NoError(t, err)
+	key, err := address.NewSecp256k1Address(pub)
+	require.NoError(t, err)
+
+	fa := &fakeAPI{key: key, nonce: 5}
+	ob := New(fa, dss.MutexWrap(datastore.NewMapDatastore()), DefaultBypass)
+
+	worker := tutils.NewIDAddr(t, 100)
+	maddr := tutils.NewIDAddr(t, 1000)
+	msg := func(method abi.MethodNum, params string) *types.Message {
+		return &types.Message{From: worker, To: maddr, Method: method, Value: abi.NewTokenAmount(0), Params: []byte(params)}
+	}
+
+	var ids []uint64
+	for _, p := range []string{"a", "b", "c"} {
+		id, err := ob.enqueue(ctx, msg(builtin0.MethodsMiner.PreCommitSector, p), nil, "PreCommitSector")
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	nonces := func() []uint64 {
+		msgs, err := ob.List()
+		require.NoError(t, err)
+		var out []uint64
+		for _, m := range msgs {
+			if m.Pending() {
+				out = append(out, m.Message.Nonce)
+			}
+		}
+		return out
+	}
+	require.Equal(t, []uint64{5, 6, 7}, nonces())
+
+	sign := func(id uint64) error {
+		msgs, err := ob.List()
+		require.NoError(t, err)
+		for _, m := range msgs {
+			if m.ID != id {
+				continue
+			}
+			sig, err := sigs.Sign(crypto.SigTypeSecp256k1, pk, m.Message.Cid().Bytes())
+			require.NoError(t, err)
+			_, err = ob.Sign(ctx, id, *sig)
+			return err
+		}
+		return xerrors.Errorf("message %d not found", id)
+	}
+
+	// a PoSt message from the same sender takes nonce 5 in the mpool
+	smsg, err := ob.Push(ctx, msg(builtin0.MethodsMiner.SubmitWindowedPoSt, "post"), nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, smsg.Message.Nonce)
+	require.Equal(t, []uint64{6, 7, 8}, nonces())
+
+	require.NoError(t, sign(ids[0]))
+
+	// dropping a message fills its nonce
+	require.NoError(t, ob.Drop(ctx, ids[1]))
+	require.Equal(t, []uint64{7}, nonces())
+
+	_, err = ob.Push(ctx, msg(builtin0.MethodsMiner.DeclareFaults, "faults"), nil)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{8}, nonces())
+	require.NoError(t, sign(ids[2]))
+
+	fa.lk.Lock()
+	defer fa.lk.Unlock()
+	require.Len(t, fa.pushed, 2)
+	require.Len(t, fa.direct, 2)
+	require.EqualValues(t, 9, fa.nonce)
+}
+
+func TestOutboxHistory(t *testing.T) {
+	ctx := context.Background()
+
+	fa := &fakeAPI{key: tutils.NewIDAddr(t, 100)}
+	ob := New(fa, dss.MutexWrap(datastore.NewMapDatastore()), DefaultBypass)
+
+	maddr := tutils.NewIDAddr(t, 1000)
+	enqueue := func(i int) uint64 {
+		m := &types.Message{From: fa.key, To: maddr, Method: builtin0.MethodsMiner.PreCommitSector, Value: abi.NewTokenAmount(0), Params: []byte(fmt.Sprint(i))}
+		id, err := ob.enqueue(ctx, m, nil, "PreCommitSector")
+		require.NoError(t, err)
+		return id
+	}
+	ids := func() map[uint64]bool {
+		msgs, err := ob.List()
+		require.NoError(t, err)
+		out := map[uint64]bool{}
+		for _, m := range msgs {
+			out[m.ID] = m.Pending()
+		}
+		return out
+	}
+
+	pending := enqueue(0)
+	for i := 1; i <= MaxHistory+1; i++ {
+		require.NoError(t, ob.Drop(ctx, enqueue(i)))
+	}
+
+	all := ids()
+	require.Len(t, all, MaxHistory+1)
+	require.True(t, all[pending], "pending messages are kept on top of the history")
+	_, ok := all[pending+1]
+	require.False(t, ok)
+
+	// once dropped, the message is trimmed with the next one
+	require.NoError(t, ob.Drop(ctx, pending))
+	enqueue(MaxHistory + 2)
+	_, ok = ids()[pending]
+	require.False(t, ok)
+}
@@ -0,0 +1,362 @@
+package pledger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"go.opencensus.io/stats"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+var log = logging.Logger("pledger")
+
+// DefaultInterval is used when the policy has no interval
+const DefaultInterval = 30 * time.Second
+
+// Policy decides when sectors are pledged. Zero values are no limit.
+type Policy struct {
+	Interval time.Duration
+
+	// ReserveWorkers is the number of idle workers left for deals, a sector
+	// is pledged while more workers are idle
+	ReserveWorkers int
+	// MaxSectors and MinFree cap the capacity which is committed
+	MaxSectors uint64
+	MinFree    int64
+	// MaxSealing caps the number of sectors sealing at once, deal sectors
+	// included
+	MaxSealing int
+	// MaxPerHour caps the sectors pledged in the last hour
+	MaxPerHour int
+	// Hours is the time of day sectors are pledged at, e.g. when power is
+	// cheap. The zero value is all day.
+	Hours Window
+	// IgnoreDeals pledges sectors even while deal data waits for workers
+	IgnoreDeals bool
+}
+
+// State gets the decisions of the pledger, and can pause it. In the miner
+// process it's the *dtypes.PledgeControl the API uses.
+type State interface {
+	Paused() bool
+	Pledged()
+	Skipped(reason string)
+}
+
+// Pledger pledges a sector whenever a worker is idle and the policy allows
+// it, using the miner API only
+type Pledger struct {
+	api    api.StorageMiner
+	state  State
+	policy func() Policy
+
+	now func() time.Time
+}
+
+// New returns a pledger reading the policy on every check, so changed
+// settings apply right away
+func New(minerapi api.StorageMiner, state State, policy func() Policy) *Pledger {
+	return &Pledger{
+		api:    minerapi,
+		state:  state,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Run checks every policy interval until ctx is done, unless paused. Errors
+// are returned to be handled by the caller, e.g. crash.Run which restarts
+// the loop with backoff.
+func (p *Pledger) Run(ctx context.Context) error {
+	for {
+		policy := p.policy()
+		if !p.state.Paused() {
+			if err := p.Step(ctx); err != nil {
+				return err
+			}
+		}
+
+		crash.Success(ctx)
+
+		interval := policy.Interval
+		if interval <= 0 {
+			interval = DefaultInterval
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Step pledges a sector if the policy allows it
+func (p *Pledger) Step(ctx context.Context) error {
+	reason, err := p.Check(ctx)
+	if err != nil {
+		return err
+	}
+	switch reason {
+	case "":
+	case noIdleWorkers:
+		return nil
+	default:
+		log.Infof("not pledging: %s", reason)
+		p.state.Skipped(reason)
+		stats.Record(ctx, metrics.MinerPledgeSkips.M(1))
+		return nil
+	}
+
+	if err := p.api.PledgeSector(ctx); err != nil {
+		return xerrors.Errorf("pledging sector: %w", err)
+	}
+
+	p.state.Pledged()
+	stats.Record(ctx, metrics.MinerPledges.M(1))
+	log.Info("pledged sector for idle worker")
+	return nil
+}
+
+// noIdleWorkers isn't recorded as a skip, it's the usual state of a busy
+// miner
+const noIdleWorkers = "no idle workers"
+
+// Check returns why no sector should be pledged now, or an empty string when
+// one should
+func (p *Pledger) Check(ctx context.Context) (string, error) {
+	policy := p.policy()
+
+	wstats, err := p.api.WorkerStats(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("getting worker stats: %w", err)
+	}
+	idle := 0
+	for _, st := range wstats {
+		if st.Registration != "" {
+			// waiting for approval, not connected
+			continue
+		}
+		if st.CpuUse == 0 && st.MemUsedMin == 0 && !st.GpuUsed {
+			idle++
+		}
+	}
+	if idle <= policy.ReserveWorkers {
+		return noIdleWorkers, nil
+	}
+
+	if !policy.Hours.Contains(p.now()) {
+		return fmt.Sprintf("outside of the pledge hours %s", policy.Hours), nil
+	}
+
+	if !policy.IgnoreDeals {
+		deals, err := p.dealsWaiting(ctx)
+		if err != nil || deals != "" {
+			return deals, err
+		}
+	}
+
+	if policy.MaxPerHour > 0 {
+		n, err := p.recentPledges(ctx)
+		if err != nil {
+			return "", err
+		}
+		if n >= policy.MaxPerHour {
+			return fmt.Sprintf("%d sectors pledged in the last hour, the maximum is %d", n, policy.MaxPerHour), nil
+		}
+	}
+
+	if policy.MaxSealing > 0 {
+		res, err := p.api.SectorsQuery(ctx, api.SectorQuery{States: sealingStates, Limit: 1})
+		if err != nil {
+			return "", xerrors.Errorf("counting sealing sectors: %w", err)
+		}
+		if res.Total >= policy.MaxSealing {
+			return fmt.Sprintf("%d sectors sealing, the maximum is %d", res.Total, policy.MaxSealing), nil
+		}
+	}
+
+	return p.limitReached(ctx, policy)
+}
+
+// recentPledges returns the number of sectors without deals created in the
+// last hour, by whoever pledged them. Sector numbers grow over time, so only
+// the newest sectors are looked at.
+func (p *Pledger) recentPledges(ctx context.Context) (int, error) {
+	sectors, err := p.api.SectorsList(ctx)
+	if err != nil {
+		return 0, xerrors.Errorf("listing sectors: %w", err)
+	}
+	sort.Slice(sectors, func(i, j int) bool {
+		return sectors[i] > sectors[j]
+	})
+
+	since := p.now().Add(-time.Hour)
+	var n int
+	for _, sn := range sectors {
+		info, err := p.api.SectorsStatus(ctx, sn, false)
+		if err != nil {
+			return 0, xerrors.Errorf("getting status of sector %d: %w", sn, err)
+		}
+		if len(info.Log) == 0 {
+			continue
+		}
+		if time.Unix(int64(info.Log[0].Timestamp), 0).Before(since) {
+			break
+		}
+		if len(info.Deals) == 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// sealingStates are the states of sectors which are being sealed, the happy
+// path up to Proving
+var sealingStates = []api.SectorState{
+	api.SectorState(sealing.Empty),
+	api.SectorState(sealing.WaitDeals),
+	api.SectorState(sealing.Packing),
+	api.SectorState(sealing.External),
+	api.SectorState(sealing.PreCommit1),
+	api.SectorState(sealing.PreCommit2),
+	api.SectorState(sealing.PreCommitting),
+	api.SectorState(sealing.PreCommitWait),
+	api.SectorState(sealing.WaitSeed),
+	api.SectorState(sealing.Committing),
+	api.SectorState(sealing.SubmitCommit),
+	api.SectorState(sealing.CommitWait),
+	api.SectorState(sealing.FinalizeSector),
+}
+
+// limitReached returns why no more sectors should be pledged, or an empty
+// string while the limits allow it. Free space is counted on the paths which
+// can store sectors, net of the space reserved by running tasks.
+func (p *Pledger) limitReached(ctx context.Context, policy Policy) (string, error) {
+	if policy.MaxSectors > 0 {
+		sectors, err := p.api.SectorsList(ctx)
+		if err != nil {
+			return "", xerrors.Errorf("listing sectors: %w", err)
+		}
+		if uint64(len(sectors)) >= policy.MaxSectors {
+			return fmt.Sprintf("miner has %d sectors, the maximum is %d", len(sectors), policy.MaxSectors), nil
+		}
+	}
+
+	if policy.MinFree > 0 {
+		paths, err := p.api.StorageList(ctx)
+		if err != nil {
+			return "", xerrors.Errorf("listing storage paths: %w", err)
+		}
+
+		var free int64
+		for id := range paths {
+			info, err := p.api.StorageInfo(ctx, id)
+			if err != nil {
+				return "", xerrors.Errorf("getting storage info for %s: %w", id, err)
+			}
+			if !info.CanStore {
+				continue
+			}
+
+			st, err := p.api.StorageStat(ctx, id)
+			if err != nil {
+				log.Warnf("getting stat for storage path %s: %s", id, err)
+				continue
+			}
+			free += st.Available
+		}
+
+		if free < policy.MinFree {
+			return fmt.Sprintf("%s free in sector storage, the minimum is %s",
+				types.SizeStr(types.NewInt(uint64(free))), types.SizeStr(types.NewInt(uint64(policy.MinFree)))), nil
+		}
+	}
+
+	return "", nil
+}
+
+// stagedDealStates are the states of deals with their data on the miner, which
+// still need to be added to a sector
+var stagedDealStates = map[storagemarket.StorageDealStatus]struct{}{
+	storagemarket.StorageDealVerifyData:          {},
+	storagemarket.StorageDealEnsureProviderFunds: {},
+	storagemarket.StorageDealProviderFunding:     {},
+	storagemarket.StorageDealPublish:             {},
+	storagemarket.StorageDealPublishing:          {},
+	storagemarket.StorageDealStaged:              {},
+}
+
+// dealsWaiting returns why deal data is waiting for workers, or an empty
+// string when there is none: AddPiece tasks queued or running, or staged deals.
+func (p *Pledger) dealsWaiting(ctx context.Context) (string, error) {
+	raw, err := p.api.SealingSchedDiag(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("getting scheduler state: %w", err)
+	}
+
+	// the in-process API returns the scheduler type, marshal to also handle
+	// the RPC map form
+	var diag sectorstorage.SchedDiagInfo
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return "", xerrors.Errorf("marshaling scheduler state: %w", err)
+	}
+	if err := json.Unmarshal(b, &diag); err != nil {
+		return "", xerrors.Errorf("unmarshaling scheduler state: %w", err)
+	}
+
+	var addPiece int
+	for _, req := range diag.Requests {
+		if req.TaskType == sealtasks.TTAddPiece {
+			addPiece++
+		}
+	}
+
+	jobs, err := p.api.WorkerJobs(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("getting worker jobs: %w", err)
+	}
+	for _, wjs := range jobs {
+		for _, j := range wjs {
+			if j.Task == sealtasks.TTAddPiece {
+				addPiece++
+			}
+		}
+	}
+
+	if addPiece > 0 {
+		return fmt.Sprintf("%d AddPiece tasks queued or running", addPiece), nil
+	}
+
+	deals, err := p.api.MarketListIncompleteDeals(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("listing deals: %w", err)
+	}
+
+	var staged int
+	for _, d := range deals {
+		if _, ok := stagedDealStates[d.State]; ok {
+			staged++
+		}
+	}
+	if staged > 0 {
+		return fmt.Sprintf("%d deals staged for sealing", staged), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,156 @@
+package pledger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+type fakeMiner struct {
+	api.StorageMiner
+
+	workers map[uint64]storiface.WorkerStats
+	sealing int
+	pledged int
+
+	now     func() time.Time
+	created []time.Time
+}
+
+func (f *fakeMiner) WorkerStats(context.Context) (map[uint64]storiface.WorkerStats, error) {
+	return f.workers, nil
+}
+
+func (f *fakeMiner) WorkerJobs(context.Context) (map[uint64][]storiface.WorkerJob, error) {
+	return nil, nil
+}
+
+func (f *fakeMiner) SealingSchedDiag(context.Context) (interface{}, error) {
+	return sectorstorage.SchedDiagInfo{}, nil
+}
+
+func (f *fakeMiner) MarketListIncompleteDeals(context.Context) ([]storagemarket.MinerDeal, error) {
+	return nil, nil
+}
+
+func (f *fakeMiner) SectorsQuery(context.Context, api.SectorQuery) (api.SectorQueryResult, error) {
+	return api.SectorQueryResult{Total: f.sealing}, nil
+}
+
+func (f *fakeMiner) SectorsList(context.Context) ([]abi.SectorNumber, error) {
+	out := make([]abi.SectorNumber, len(f.created))
+	for i := range out {
+		out[i] = abi.SectorNumber(i)
+	}
+	return out, nil
+}
+
+func (f *fakeMiner) SectorsStatus(ctx context.Context, sn abi.SectorNumber, _ bool) (api.SectorInfo, error) {
+	return api.SectorInfo{
+		SectorID: sn,
+		Log:      []api.SectorLog{{Kind: "event;sealing.SectorStartCC", Timestamp: uint64(f.created[sn].Unix())}},
+	}, nil
+}
+
+func (f *fakeMiner) PledgeSector(context.Context) error {
+	f.pledged++
+	f.sealing++
+	f.created = append(f.created, f.now())
+	return nil
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	fm := &fakeMiner{workers: map[uint64]storiface.WorkerStats{
+		0: {},
+		1: {CpuUse: 1},
+	}}
+	policy := Policy{ReserveWorkers: 1}
+	ctl := new(dtypes.PledgeControl)
+	p := New(fm, ctl, func() Policy { return policy })
+
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.Local)
+	p.now = func() time.Time { return now }
+	fm.now = p.now
+
+	// the only idle worker is reserved for deals
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 0, fm.pledged)
+	require.Empty(t, ctl.State().LastSkip)
+
+	policy.ReserveWorkers = 0
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 1, fm.pledged)
+
+	policy.MaxPerHour = 2
+	policy.MaxSealing = 3
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 2, fm.pledged)
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 2, fm.pledged)
+	require.Contains(t, ctl.State().LastSkip, "last hour")
+
+	// the count comes from the sectors, it survives restarts
+	restarted := New(fm, ctl, func() Policy { return policy })
+	restarted.now = p.now
+	reason, err := restarted.Check(ctx)
+	require.NoError(t, err)
+	require.Contains(t, reason, "2 sectors pledged in the last hour")
+
+	now = now.Add(time.Hour + time.Minute)
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 3, fm.pledged)
+	now = now.Add(time.Hour + time.Minute)
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 3, fm.pledged)
+	require.Contains(t, ctl.State().LastSkip, "3 sectors sealing")
+
+	fm.sealing = 0
+	policy.MaxSectors = 3
+	require.NoError(t, p.Step(ctx))
+	require.Equal(t, 3, fm.pledged)
+	require.Contains(t, ctl.State().LastSkip, "maximum is 3")
+
+	policy.MaxSectors = 0
+	policy.Hours, _ = ParseWindow("22:00-06:00")
+	reason, err = p.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "outside of the pledge hours 22:00-06:00", reason)
+}
+
+func TestWindow(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2020, 10, 1, h, m, 0, 0, time.Local)
+	}
+
+	w, err := ParseWindow("")
+	require.NoError(t, err)
+	require.True(t, w.Contains(at(3, 0)))
+
+	w, err = ParseWindow("22:00-06:30")
+	require.NoError(t, err)
+	require.True(t, w.Contains(at(23, 0)))
+	require.True(t, w.Contains(at(6, 29)))
+	require.False(t, w.Contains(at(6, 30)))
+	require.False(t, w.Contains(at(12, 0)))
+
+	w, err = ParseWindow("09:00-17:00")
+	require.NoError(t, err)
+	require.True(t, w.Contains(at(9, 0)))
+	require.False(t, w.Contains(at(17, 0)))
+	require.Equal(t, "09:00-17:00", w.String())
+
+	_, err = ParseWindow("9-17")
+	require.Error(t, err)
+}
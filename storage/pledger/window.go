@@ -0,0 +1,62 @@
+package pledger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Window is a daily time window in local time, from From to To since
+// midnight. Windows ending before they start span midnight.
+type Window struct {
+	From, To time.Duration
+}
+
+// ParseWindow parses a window like 22:00-06:00, an empty string is all day
+func ParseWindow(s string) (Window, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Window{}, nil
+	}
+
+	sp := strings.Split(s, "-")
+	if len(sp) != 2 {
+		return Window{}, xerrors.Errorf("expected a window like 22:00-06:00, got %q", s)
+	}
+
+	var w Window
+	for i, dst := range []*time.Duration{&w.From, &w.To} {
+		t, err := time.Parse("15:04", strings.TrimSpace(sp[i]))
+		if err != nil {
+			return Window{}, xerrors.Errorf("parsing window %q: %w", s, err)
+		}
+		*dst = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return w, nil
+}
+
+// Contains returns whether t is in the window
+func (w Window) Contains(t time.Time) bool {
+	if w.From == w.To {
+		return true
+	}
+
+	y, m, d := t.Date()
+	tod := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.From < w.To {
+		return tod >= w.From && tod < w.To
+	}
+	return tod >= w.From || tod < w.To
+}
+
+func (w Window) String() string {
+	if w.From == w.To {
+		return "all day"
+	}
+	hm := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return hm(w.From) + "-" + hm(w.To)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+var expiredPreCommitsPrefix = datastore.NewKey("/expired-precommits")
+
+// recordPreCommitExpiry records sectors entering the PreCommitExpired state,
+// the sector itself is removed right after
+func (m *Miner) recordPreCommitExpiry(before, after sealing.SectorInfo) {
+	if after.State != sealing.PreCommitExpired || before.State == after.State {
+		return
+	}
+
+	rec := api.ExpiredPreCommit{
+		Sector:  after.SectorNumber,
+		Deposit: after.PreCommitDeposit,
+		Time:    build.Clock.Now(),
+	}
+	if rec.Deposit.Int == nil {
+		rec.Deposit = abi.NewTokenAmount(0)
+	}
+	for _, p := range after.Pieces {
+		if p.DealInfo != nil {
+			rec.Deals = append(rec.Deals, p.DealInfo.DealID)
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		log.Errorf("encoding expired precommit of sector %d: %+v", rec.Sector, err)
+		return
+	}
+	k := expiredPreCommitsPrefix.ChildString(fmt.Sprintf("%020d", rec.Sector))
+	if err := m.ds.Put(k, b); err != nil {
+		log.Errorf("recording expired precommit of sector %d: %+v", rec.Sector, err)
+	}
+
+	ctx, err := tag.New(context.TODO(), tag.Upsert(metrics.MinerID, m.maddr.String()))
+	if err != nil {
+		log.Warnf("tagging metrics: %s", err)
+		return
+	}
+	stats.Record(ctx, metrics.MinerExpiredPreCommits.M(1))
+}
+
+// ExpiredPreCommits returns the recorded sectors whose precommit expired,
+// oldest first
+func (m *Miner) ExpiredPreCommits() ([]api.ExpiredPreCommit, error) {
+	res, err := m.ds.Query(query.Query{Prefix: expiredPreCommitsPrefix.String()})
+	if err != nil {
+		return nil, xerrors.Errorf("querying expired precommits: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.ExpiredPreCommit
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading expired precommits: %w", r.Error)
+		}
+
+		var rec api.ExpiredPreCommit
+		if err := json.Unmarshal(r.Value, &rec); err != nil {
+			return nil, xerrors.Errorf("decoding expired precommit %s: %w", r.Key, err)
+		}
+		out = append(out, rec)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+	return out, nil
+}
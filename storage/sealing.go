@@ -4,12 +4,20 @@ import (
 	"context"
 	"io"
 
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
 )
 
+// ErrArchivalMode is returned by operations which would seal or modify
+// sectors while the miner runs in archival mode
+var ErrArchivalMode = xerrors.New("miner is running in archival mode")
+
 // TODO: refactor this to be direct somehow
 
 func (m *Miner) Address() address.Address {
@@ -17,10 +25,36 @@ func (m *Miner) Address() address.Address {
 }
 
 func (m *Miner) AddPieceToAnySector(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, d sealing.DealInfo) (abi.SectorNumber, abi.PaddedPieceSize, error) {
+	if m.archival {
+		return 0, 0, ErrArchivalMode
+	}
 	return m.sealing.AddPieceToAnySector(ctx, size, r, d)
 }
 
+// ReadPiece writes size bytes of the unsealed piece data at offset in the
+// sector to w, unsealing the sector when no unsealed copy is stored
+func (m *Miner) ReadPiece(ctx context.Context, w io.Writer, sid abi.SectorNumber, offset storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize) error {
+	si, err := m.sealing.GetSectorInfo(sid)
+	if err != nil {
+		return xerrors.Errorf("getting sector info: %w", err)
+	}
+
+	mid, err := address.IDFromAddress(m.maddr)
+	if err != nil {
+		return err
+	}
+
+	var commD cid.Cid
+	if si.CommD != nil {
+		commD = *si.CommD
+	}
+	return m.sealer.ReadPiece(ctx, w, abi.SectorID{Miner: abi.ActorID(mid), Number: sid}, offset, size, si.TicketValue, commD)
+}
+
 func (m *Miner) StartPackingSector(sectorNum abi.SectorNumber) error {
+	if m.archival {
+		return ErrArchivalMode
+	}
 	return m.sealing.StartPacking(sectorNum)
 }
 
@@ -33,18 +67,59 @@ func (m *Miner) GetSectorInfo(sid abi.SectorNumber) (sealing.SectorInfo, error)
 }
 
 func (m *Miner) PledgeSector() error {
+	if m.archival {
+		return ErrArchivalMode
+	}
 	return m.sealing.PledgeSector()
 }
 
 func (m *Miner) ForceSectorState(ctx context.Context, id abi.SectorNumber, state sealing.SectorState) error {
+	if m.archival {
+		return ErrArchivalMode
+	}
 	return m.sealing.ForceSectorState(ctx, id, state)
 }
 
 func (m *Miner) RemoveSector(ctx context.Context, id abi.SectorNumber) error {
+	if m.archival {
+		return ErrArchivalMode
+	}
 	return m.sealing.Remove(ctx, id)
 }
 
+func (m *Miner) TrimCache(ctx context.Context, id abi.SectorNumber, level storiface.CacheTrimLevel) error {
+	return m.sealing.TrimCache(ctx, id, level)
+}
+
+func (m *Miner) AllocateExternalSector(ctx context.Context) (abi.SectorNumber, error) {
+	if m.archival {
+		return 0, ErrArchivalMode
+	}
+	return m.sealing.AllocateExternal(ctx)
+}
+
+func (m *Miner) ExternalAddPiece(ctx context.Context, id abi.SectorNumber, piece sealing.Piece) error {
+	if m.archival {
+		return ErrArchivalMode
+	}
+	return m.sealing.ExternalAddPiece(ctx, id, piece)
+}
+
+func (m *Miner) ExternalSealed(ctx context.Context, id abi.SectorNumber, info sealing.ExternalSealedInfo) error {
+	if m.archival {
+		return ErrArchivalMode
+	}
+	return m.sealing.ExternalSealed(ctx, id, info)
+}
+
+func (m *Miner) ReleaseExternalSector(ctx context.Context, id abi.SectorNumber) error {
+	return m.sealing.ReleaseExternal(ctx, id)
+}
+
 func (m *Miner) MarkForUpgrade(id abi.SectorNumber) error {
+	if m.archival {
+		return ErrArchivalMode
+	}
 	return m.sealing.MarkForUpgrade(id)
 }
 
@@ -0,0 +1,145 @@
+package sealmetrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/metrics"
+)
+
+// Interval is how often the sealing metrics are recorded
+const Interval = 15 * time.Second
+
+// tasks are always reported, so the gauge of a task type drops to 0 when its
+// last task finishes
+var tasks = []sealtasks.TaskType{
+	sealtasks.TTAddPiece,
+	sealtasks.TTPreCommit1,
+	sealtasks.TTPreCommit2,
+	sealtasks.TTCommit1,
+	sealtasks.TTCommit2,
+	sealtasks.TTFinalize,
+	sealtasks.TTFetch,
+	sealtasks.TTUnseal,
+	sealtasks.TTReadUnsealed,
+}
+
+const (
+	stateRunning  = "running"
+	stateAssigned = "assigned"
+)
+
+// Scheduler is implemented by *sectorstorage.Manager
+type Scheduler interface {
+	WorkerStats() map[uint64]storiface.WorkerStats
+	WorkerJobs() map[uint64][]storiface.WorkerJob
+}
+
+// Reporter periodically records the sealing tasks of the workers and their
+// utilization
+type Reporter struct {
+	sched Scheduler
+	maddr address.Address
+}
+
+func NewReporter(sched Scheduler, maddr address.Address) *Reporter {
+	return &Reporter{
+		sched: sched,
+		maddr: maddr,
+	}
+}
+
+func (r *Reporter) Run(ctx context.Context) error {
+	ctx, err := tag.New(ctx, tag.Insert(metrics.MinerID, r.maddr.String()))
+	if err != nil {
+		return xerrors.Errorf("tagging metrics: %w", err)
+	}
+
+	t := time.NewTicker(Interval)
+	defer t.Stop()
+
+	for {
+		r.report(ctx)
+		crash.Success(ctx)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Reporter) report(ctx context.Context) {
+	s := summarize(r.sched.WorkerStats(), r.sched.WorkerJobs())
+
+	for tt, n := range s.tasks {
+		for state, count := range map[string]int{stateRunning: n[0], stateAssigned: n[1]} {
+			_ = stats.RecordWithTags(ctx, []tag.Mutator{
+				tag.Upsert(metrics.TaskType, string(tt)),
+				tag.Upsert(metrics.TaskState, state),
+			}, metrics.MinerSealingTasks.M(int64(count)))
+		}
+	}
+
+	stats.Record(ctx,
+		metrics.MinerWorkerCPUsUsed.M(int64(s.cpusUsed)),
+		metrics.MinerWorkerCPUs.M(int64(s.cpus)),
+		metrics.MinerWorkerGPUsUsed.M(int64(s.gpusUsed)),
+		metrics.MinerWorkerGPUs.M(int64(s.gpus)),
+		metrics.MinerWorkerMemoryUsed.M(int64(s.memUsed)),
+		metrics.MinerWorkerMemory.M(int64(s.mem)),
+	)
+}
+
+type summary struct {
+	// tasks counts the running and assigned tasks of each type
+	tasks map[sealtasks.TaskType][2]int
+
+	cpusUsed, cpus uint64
+	gpusUsed, gpus int
+	memUsed, mem   uint64
+}
+
+func summarize(workers map[uint64]storiface.WorkerStats, jobs map[uint64][]storiface.WorkerJob) summary {
+	s := summary{
+		tasks: map[sealtasks.TaskType][2]int{},
+	}
+	for _, tt := range tasks {
+		s.tasks[tt] = [2]int{}
+	}
+
+	for _, wjobs := range jobs {
+		for _, job := range wjobs {
+			n := s.tasks[job.Task]
+			if job.RunWait == 0 {
+				n[0]++
+			} else {
+				n[1]++
+			}
+			s.tasks[job.Task] = n
+		}
+	}
+
+	for _, st := range workers {
+		s.cpusUsed += st.CpuUse
+		s.cpus += st.Info.Resources.CPUs
+		if st.GpuUsed {
+			s.gpusUsed++
+		}
+		s.gpus += len(st.Info.Resources.GPUs)
+		s.memUsed += st.MemUsedMin
+		s.mem += st.Info.Resources.MemPhysical
+	}
+
+	return s
+}
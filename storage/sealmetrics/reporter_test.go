@@ -0,0 +1,47 @@
+package sealmetrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+func TestSummarize(t *testing.T) {
+	workers := map[uint64]storiface.WorkerStats{
+		0: {
+			Info:       storiface.WorkerInfo{Resources: storiface.WorkerResources{CPUs: 32, GPUs: []string{"a", "b"}, MemPhysical: 256 << 30}},
+			MemUsedMin: 64 << 30,
+			GpuUsed:    true,
+			CpuUse:     16,
+		},
+		1: {
+			Info: storiface.WorkerInfo{Resources: storiface.WorkerResources{CPUs: 16, MemPhysical: 128 << 30}},
+		},
+	}
+	jobs := map[uint64][]storiface.WorkerJob{
+		0: {
+			{Task: sealtasks.TTPreCommit1, RunWait: 0},
+			{Task: sealtasks.TTPreCommit1, RunWait: 0},
+			{Task: sealtasks.TTCommit2, RunWait: 1},
+		},
+		1: {
+			{Task: sealtasks.TTPreCommit1, RunWait: 2},
+		},
+	}
+
+	s := summarize(workers, jobs)
+	require.Equal(t, [2]int{2, 1}, s.tasks[sealtasks.TTPreCommit1])
+	require.Equal(t, [2]int{0, 1}, s.tasks[sealtasks.TTCommit2])
+	require.Equal(t, [2]int{}, s.tasks[sealtasks.TTAddPiece], "idle task types are reported")
+	require.Len(t, s.tasks, len(tasks))
+
+	require.Equal(t, uint64(16), s.cpusUsed)
+	require.Equal(t, uint64(48), s.cpus)
+	require.Equal(t, 1, s.gpusUsed)
+	require.Equal(t, 2, s.gpus)
+	require.Equal(t, uint64(64<<30), s.memUsed)
+	require.Equal(t, uint64(384<<30), s.mem)
+}
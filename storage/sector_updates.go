@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+)
+
+const sectorUpdatesBuffer = 256
+
+type sectorSubs struct {
+	lk    sync.Mutex
+	next  uint64
+	subs  map[uint64]*sectorSub
+	hooks []func(api.SectorUpdate) error
+}
+
+type sectorSub struct {
+	ch chan api.SectorUpdate
+	// updates dropped since the last one delivered
+	dropped uint64
+}
+
+// OnSectorUpdate calls cb with every sector state change, before the sealing
+// FSM persists the new state. It blocks the FSM, so cb must be quick, and
+// should be set before the miner starts so no change is missed.
+func (m *Miner) OnSectorUpdate(cb func(api.SectorUpdate) error) {
+	m.sectorSubs.lk.Lock()
+	defer m.sectorSubs.lk.Unlock()
+
+	m.sectorSubs.hooks = append(m.sectorSubs.hooks, cb)
+}
+
+// SectorUpdates returns sector state changes until ctx is cancelled. Updates
+// are dropped while the buffer is full, the next update delivered counts
+// them in Dropped.
+func (m *Miner) SectorUpdates(ctx context.Context) <-chan api.SectorUpdate {
+	ch := make(chan api.SectorUpdate, sectorUpdatesBuffer)
+
+	m.sectorSubs.lk.Lock()
+	id := m.sectorSubs.next
+	m.sectorSubs.next++
+	if m.sectorSubs.subs == nil {
+		m.sectorSubs.subs = map[uint64]*sectorSub{}
+	}
+	m.sectorSubs.subs[id] = &sectorSub{ch: ch}
+	m.sectorSubs.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.sectorSubs.lk.Lock()
+		delete(m.sectorSubs.subs, id)
+		m.sectorSubs.lk.Unlock()
+
+		close(ch)
+	}()
+
+	return ch
+}
+
+func (m *Miner) publishSectorUpdate(before, after sealing.SectorInfo) {
+	if before.State == after.State {
+		return
+	}
+
+	upd := api.SectorUpdate{
+		Sector: after.SectorNumber,
+		From:   api.SectorState(before.State),
+		To:     api.SectorState(after.State),
+		Time:   build.Clock.Now(),
+		Error:  after.LastErr,
+	}
+
+	m.sectorSubs.lk.Lock()
+	defer m.sectorSubs.lk.Unlock()
+
+	for _, cb := range m.sectorSubs.hooks {
+		if err := cb(upd); err != nil {
+			log.Errorw("sector update hook failed", "sector", upd.Sector, "error", err)
+		}
+	}
+
+	for _, sub := range m.sectorSubs.subs {
+		supd := upd
+		supd.Dropped = sub.dropped
+
+		select {
+		case sub.ch <- supd:
+			sub.dropped = 0
+		default:
+			if sub.dropped == 0 {
+				log.Warnw("dropping sector updates for slow subscriber", "sector", upd.Sector)
+			}
+			sub.dropped++
+		}
+	}
+}
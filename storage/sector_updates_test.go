@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+)
+
+func TestSectorUpdatesDropped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &Miner{}
+
+	var hooked int
+	m.OnSectorUpdate(func(api.SectorUpdate) error {
+		hooked++
+		return nil
+	})
+
+	updates := m.SectorUpdates(ctx)
+
+	publish := func(n abi.SectorNumber) {
+		m.publishSectorUpdate(sealing.SectorInfo{SectorNumber: n, State: sealing.PreCommit1}, sealing.SectorInfo{SectorNumber: n, State: sealing.PreCommit2})
+	}
+
+	// the subscriber doesn't read while the buffer fills up
+	for i := 0; i < sectorUpdatesBuffer+10; i++ {
+		publish(abi.SectorNumber(i))
+	}
+	require.Equal(t, sectorUpdatesBuffer+10, hooked, "hooks see every update")
+
+	for i := 0; i < sectorUpdatesBuffer; i++ {
+		upd := <-updates
+		require.Equal(t, abi.SectorNumber(i), upd.Sector)
+		require.Zero(t, upd.Dropped)
+	}
+
+	// the next update tells how many were missed
+	publish(1000)
+	upd := <-updates
+	require.Equal(t, abi.SectorNumber(1000), upd.Sector)
+	require.Equal(t, uint64(10), upd.Dropped)
+
+	publish(1001)
+	upd = <-updates
+	require.Zero(t, upd.Dropped)
+
+	// unchanged states aren't published
+	m.publishSectorUpdate(sealing.SectorInfo{State: sealing.Proving}, sealing.SectorInfo{State: sealing.Proving})
+	select {
+	case upd := <-updates:
+		t.Fatalf("unexpected update %+v", upd)
+	default:
+	}
+}
@@ -6,23 +6,30 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
 	"sync"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
 	"github.com/ipfs/go-datastore/query"
 	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	logging "github.com/ipfs/go-log/v2"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/go-address"
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
 	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/carindex"
 )
 
+var log = logging.Logger("sectorblocks")
+
 type SealSerialization uint8
 
 const (
@@ -48,17 +55,31 @@ func DsKeyToDealID(key datastore.Key) (uint64, error) {
 	return dealID, nil
 }
 
+// SectorBuilder adds deal pieces to sectors and reads them back. It is the
+// storage.Miner, or a RemoteBuilder on a markets node.
+type SectorBuilder interface {
+	Address() address.Address
+	AddPieceToAnySector(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, d sealing.DealInfo) (abi.SectorNumber, abi.PaddedPieceSize, error)
+	GetSectorInfo(sid abi.SectorNumber) (sealing.SectorInfo, error)
+	ReadPiece(ctx context.Context, w io.Writer, sid abi.SectorNumber, offset storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize) error
+}
+
+var _ SectorBuilder = &storage.Miner{}
+
 type SectorBlocks struct {
-	*storage.Miner
+	SectorBuilder
 
 	keys  datastore.Batching
 	keyLk sync.Mutex
+
+	indexes *carindex.Store
 }
 
-func NewSectorBlocks(miner *storage.Miner, ds dtypes.MetadataDS) *SectorBlocks {
+func NewSectorBlocks(sb SectorBuilder, ds dtypes.MetadataDS, indexes *carindex.Store) *SectorBlocks {
 	sbc := &SectorBlocks{
-		Miner: miner,
-		keys:  namespace.Wrap(ds, dsPrefix),
+		SectorBuilder: sb,
+		keys:          namespace.Wrap(ds, dsPrefix),
+		indexes:       indexes,
 	}
 
 	return sbc
@@ -97,10 +118,25 @@ func (st *SectorBlocks) writeRef(dealID abi.DealID, sectorID abi.SectorNumber, o
 }
 
 func (st *SectorBlocks) AddPiece(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, d sealing.DealInfo) (abi.SectorNumber, abi.PaddedPieceSize, error) {
-	sn, offset, err := st.Miner.AddPieceToAnySector(ctx, size, r, d)
+	// index the payload blocks while the piece is written to the sector
+	pr, pw := io.Pipe()
+	indexed := make(chan *carindex.Index, 1)
+	go func() {
+		idx, err := carindex.Build(pr)
+		if err != nil {
+			log.Infof("not indexing piece of deal %d: %s", d.DealID, err)
+			idx = nil
+		}
+		_, _ = io.Copy(ioutil.Discard, pr)
+		indexed <- idx
+	}()
+
+	sn, offset, err := st.SectorBuilder.AddPieceToAnySector(ctx, size, io.TeeReader(r, pw), d)
 	if err != nil {
+		_ = pw.CloseWithError(err)
 		return 0, 0, err
 	}
+	_ = pw.Close()
 
 	// TODO: DealID has very low finality here
 	err = st.writeRef(d.DealID, sn, offset, size)
@@ -108,6 +144,12 @@ func (st *SectorBlocks) AddPiece(ctx context.Context, size abi.UnpaddedPieceSize
 		return 0, 0, xerrors.Errorf("writeRef: %w", err)
 	}
 
+	if idx := <-indexed; idx != nil {
+		if err := st.indexes.Put(sn, offset.Unpadded(), d.DealID, idx); err != nil {
+			log.Errorf("storing index of deal %d: %+v", d.DealID, err)
+		}
+	}
+
 	return sn, offset, nil
 }
 
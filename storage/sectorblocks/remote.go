@@ -0,0 +1,102 @@
+package sectorblocks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// RemoteBuilder is the SectorBuilder of a markets node. Deal pieces are added
+// to sectors of the sealing miner over its API, and read back from its
+// /remote/pieces endpoint for retrievals.
+type RemoteBuilder struct {
+	sealer    api.StorageMiner
+	maddr     address.Address
+	piecesURL string
+	header    http.Header
+}
+
+var _ SectorBuilder = &RemoteBuilder{}
+
+// NewRemoteBuilder adds pieces to sectors of the sealing miner maddr, which
+// serves pieces at piecesURL. header authenticates the piece requests.
+func NewRemoteBuilder(sealer api.StorageMiner, maddr address.Address, piecesURL string, header http.Header) *RemoteBuilder {
+	return &RemoteBuilder{
+		sealer:    sealer,
+		maddr:     maddr,
+		piecesURL: piecesURL,
+		header:    header,
+	}
+}
+
+func (rb *RemoteBuilder) Address() address.Address {
+	return rb.maddr
+}
+
+func (rb *RemoteBuilder) AddPieceToAnySector(ctx context.Context, size abi.UnpaddedPieceSize, r io.Reader, d sealing.DealInfo) (abi.SectorNumber, abi.PaddedPieceSize, error) {
+	so, err := rb.sealer.SectorAddPieceToAny(ctx, size, r, api.PieceDealInfo{
+		PublishCid:   d.PublishCid,
+		DealID:       d.DealID,
+		StartEpoch:   d.DealSchedule.StartEpoch,
+		EndEpoch:     d.DealSchedule.EndEpoch,
+		KeepUnsealed: d.KeepUnsealed,
+	})
+	if err != nil {
+		return 0, 0, xerrors.Errorf("adding piece on the sealing miner: %w", err)
+	}
+	return so.Sector, so.Offset, nil
+}
+
+// GetSectorInfo returns the state, commitments and ticket of a sector of the
+// sealing miner, the other fields aren't set
+func (rb *RemoteBuilder) GetSectorInfo(sid abi.SectorNumber) (sealing.SectorInfo, error) {
+	si, err := rb.sealer.SectorsStatus(context.TODO(), sid, false)
+	if err != nil {
+		return sealing.SectorInfo{}, xerrors.Errorf("getting sector status from the sealing miner: %w", err)
+	}
+
+	return sealing.SectorInfo{
+		State:        sealing.SectorState(si.State),
+		SectorNumber: si.SectorID,
+		TicketValue:  si.Ticket.Value,
+		TicketEpoch:  si.Ticket.Epoch,
+		CommD:        si.CommD,
+		CommR:        si.CommR,
+	}, nil
+}
+
+func (rb *RemoteBuilder) ReadPiece(ctx context.Context, w io.Writer, sid abi.SectorNumber, offset storiface.UnpaddedByteIndex, size abi.UnpaddedPieceSize) error {
+	u := fmt.Sprintf("%s/%d?offset=%d&size=%d", rb.piecesURL, sid, offset, size)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = rb.header.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("requesting piece from the sealing miner: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return xerrors.Errorf("reading piece of sector %d from the sealing miner: %s: %s", sid, resp.Status, string(b))
+	}
+
+	if _, err := io.CopyN(w, resp.Body, int64(size)); err != nil {
+		return xerrors.Errorf("reading piece of sector %d from the sealing miner: %w", sid, err)
+	}
+	return nil
+}
@@ -0,0 +1,561 @@
+package sectorhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("sectorhooks")
+
+var (
+	RequestTimeout    = 10 * time.Second
+	MinBackoff        = 5 * time.Second
+	PruneInterval     = time.Hour
+	ReconcileInterval = time.Minute
+)
+
+var (
+	dsPrefix      = datastore.NewKey("/sectorhooks")
+	nextKey       = datastore.NewKey("/next")
+	eventsPrefix  = datastore.NewKey("/events")
+	cursorsPrefix = datastore.NewKey("/cursors")
+	statesPrefix  = datastore.NewKey("/states")
+	seededKey     = datastore.NewKey("/states-seeded")
+)
+
+// Sectors returns the states of all sectors, as persisted by the sealing FSM,
+// or nil until the states can be listed
+type Sectors func() (map[abi.SectorNumber]api.SectorState, error)
+
+// mismatch is a sector whose state differs from the last recorded one
+type mismatch struct {
+	recorded, current api.SectorState
+}
+
+// Config is the webhook config, see config.SectorWebhooksConfig
+type Config struct {
+	URLs       []string
+	MaxBackoff time.Duration
+	Retention  time.Duration
+}
+
+type endpoint struct {
+	url string
+	key datastore.Key
+
+	// guarded by Hooks.lk
+	next        uint64
+	lastAttempt time.Time
+	lastErr     string
+
+	wake chan struct{}
+}
+
+// Hooks delivers sector state changes to webhook endpoints. Every change is
+// persisted as an event by Record, in the notification path of the sealing
+// FSM before the FSM persists the new state, and each endpoint has a
+// persisted cursor which only moves past an event once the endpoint accepted
+// it, so events survive restarts of the miner and outages of the endpoints.
+// Changes which couldn't be recorded, or were lost to a crash, are found by
+// comparing the last recorded state of sectors with the FSM.
+// Delivered events are kept for the retention period so they can be replayed.
+type Hooks struct {
+	ds      datastore.Batching
+	cfg     Config
+	sectors Sectors
+	client  *http.Client
+
+	lk        sync.Mutex
+	next      uint64
+	endpoints []*endpoint
+
+	// mismatches seen by the last reconcile pass, only reconcile goroutine
+	mismatches map[abi.SectorNumber]mismatch
+}
+
+func New(ds dtypes.MetadataDS, cfg Config, sectors Sectors) (*Hooks, error) {
+	h := &Hooks{
+		ds:      namespace.Wrap(ds, dsPrefix),
+		cfg:     cfg,
+		sectors: sectors,
+		client:  &http.Client{Timeout: RequestTimeout},
+	}
+
+	next, err := h.getUint(nextKey)
+	if err != nil {
+		return nil, xerrors.Errorf("loading event counter: %w", err)
+	}
+	h.next = next
+
+	seen := map[string]struct{}{}
+	for _, u := range cfg.URLs {
+		if _, ok := seen[u]; ok {
+			return nil, xerrors.Errorf("duplicate webhook url %s", u)
+		}
+		seen[u] = struct{}{}
+
+		ep := &endpoint{
+			url:  u,
+			key:  cursorsPrefix.ChildString(base64.RawURLEncoding.EncodeToString([]byte(u))),
+			wake: make(chan struct{}, 1),
+		}
+
+		has, err := h.ds.Has(ep.key)
+		if err != nil {
+			return nil, xerrors.Errorf("loading cursor of %s: %w", u, err)
+		}
+		if has {
+			if ep.next, err = h.getUint(ep.key); err != nil {
+				return nil, xerrors.Errorf("loading cursor of %s: %w", u, err)
+			}
+		} else {
+			// new endpoints only get new events, older ones can be replayed
+			ep.next = next
+			if err := h.putUint(ep.key, ep.next); err != nil {
+				return nil, xerrors.Errorf("storing cursor of %s: %w", u, err)
+			}
+		}
+
+		h.endpoints = append(h.endpoints, ep)
+	}
+
+	return h, nil
+}
+
+// Run delivers the recorded events until ctx is cancelled
+func (h *Hooks) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, ep := range h.endpoints {
+		ep := ep
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.deliver(ctx, ep)
+		}()
+	}
+	defer wg.Wait()
+
+	prune := time.NewTicker(PruneInterval)
+	defer prune.Stop()
+	reconcile := time.NewTicker(ReconcileInterval)
+	defer reconcile.Stop()
+
+	for {
+		select {
+		case <-reconcile.C:
+			if err := h.reconcile(); err != nil {
+				log.Errorw("reconciling sector events", "error", err)
+				crash.Failure(ctx, err)
+				continue
+			}
+			crash.Success(ctx)
+		case <-prune.C:
+			if err := h.prune(); err != nil {
+				log.Warnf("pruning sector events: %+v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Record persists a sector state change as an event, see
+// storage.Miner.OnSectorUpdate
+func (h *Hooks) Record(upd api.SectorUpdate) error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	return h.record(upd)
+}
+
+// record must be called with h.lk held
+func (h *Hooks) record(upd api.SectorUpdate) error {
+
+	evt := api.SectorEvent{
+		Seq:          h.next,
+		SectorUpdate: upd,
+	}
+	b, err := json.Marshal(&evt)
+	if err != nil {
+		return xerrors.Errorf("encoding event: %w", err)
+	}
+
+	batch, err := h.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(eventKey(evt.Seq), b); err != nil {
+		return err
+	}
+	if err := batch.Put(nextKey, encodeUint(evt.Seq+1)); err != nil {
+		return err
+	}
+	if err := batch.Put(stateKey(upd.Sector), []byte(upd.To)); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return xerrors.Errorf("storing event: %w", err)
+	}
+	h.next++
+
+	for _, ep := range h.endpoints {
+		select {
+		case ep.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// reconcile records events for sectors whose state differs from the last
+// recorded one in two passes in a row. A single pass can't tell a lost
+// change from one recorded just before the FSM persisted it.
+func (h *Hooks) reconcile() error {
+	if h.sectors == nil {
+		return nil
+	}
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	current, err := h.sectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+	if current == nil {
+		return nil
+	}
+
+	recorded := map[abi.SectorNumber]api.SectorState{}
+	res, err := h.ds.Query(query.Query{Prefix: statesPrefix.String()})
+	if err != nil {
+		return xerrors.Errorf("querying sector states: %w", err)
+	}
+	for r := range res.Next() {
+		if r.Error != nil {
+			_ = res.Close()
+			return xerrors.Errorf("reading sector states: %w", r.Error)
+		}
+		var n abi.SectorNumber
+		if _, err := fmt.Sscanf(datastore.RawKey(r.Key).BaseNamespace(), "%d", &n); err != nil {
+			_ = res.Close()
+			return xerrors.Errorf("parsing sector state key %s: %w", r.Key, err)
+		}
+		recorded[n] = api.SectorState(r.Value)
+	}
+	_ = res.Close()
+
+	seeded, err := h.ds.Has(seededKey)
+	if err != nil {
+		return err
+	}
+	if !seeded {
+		// first pass, the states of existing sectors aren't news
+		for n, st := range current {
+			if err := h.ds.Put(stateKey(n), []byte(st)); err != nil {
+				return xerrors.Errorf("storing sector state: %w", err)
+			}
+		}
+		return h.ds.Put(seededKey, []byte{1})
+	}
+
+	prev := h.mismatches
+	h.mismatches = map[abi.SectorNumber]mismatch{}
+	for n, st := range current {
+		mm := mismatch{recorded: recorded[n], current: st}
+		if mm.recorded == mm.current {
+			continue
+		}
+		if prev[n] != mm {
+			h.mismatches[n] = mm
+			continue
+		}
+
+		log.Warnw("recording missed sector state change", "sector", n, "from", mm.recorded, "to", mm.current)
+		if err := h.record(api.SectorUpdate{Sector: n, From: mm.recorded, To: mm.current, Time: build.Clock.Now()}); err != nil {
+			return xerrors.Errorf("recording sector %d: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// deliver sends the events of an endpoint in order, retrying with exponential
+// backoff until each is accepted
+func (h *Hooks) deliver(ctx context.Context, ep *endpoint) {
+	var backoff time.Duration
+
+	for {
+		h.lk.Lock()
+		seq, next := ep.next, h.next
+		h.lk.Unlock()
+
+		if seq >= next {
+			select {
+			case <-ep.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		b, err := h.ds.Get(eventKey(seq))
+		switch {
+		case err == datastore.ErrNotFound:
+			log.Errorw("sector event missing, skipping it", "url", ep.url, "seq", seq)
+		case err != nil:
+			log.Errorw("loading sector event", "seq", seq, "error", err)
+		default:
+			err = h.post(ctx, ep.url, b)
+		}
+
+		h.lk.Lock()
+		ep.lastAttempt = build.Clock.Now()
+		if err == nil || err == datastore.ErrNotFound {
+			ep.lastErr = ""
+			// a replay may have moved the cursor meanwhile
+			if ep.next == seq {
+				ep.next++
+				if perr := h.putUint(ep.key, ep.next); perr != nil {
+					log.Errorw("storing webhook cursor", "url", ep.url, "error", perr)
+				}
+			}
+			h.lk.Unlock()
+
+			backoff = 0
+			continue
+		}
+		ep.lastErr = err.Error()
+		h.lk.Unlock()
+
+		if backoff *= 2; backoff < MinBackoff {
+			backoff = MinBackoff
+		}
+		if h.cfg.MaxBackoff > 0 && backoff > h.cfg.MaxBackoff {
+			backoff = h.cfg.MaxBackoff
+		}
+		log.Warnw("sector webhook delivery failed", "url", ep.url, "seq", seq, "retry", backoff, "error", err)
+
+		select {
+		case <-build.Clock.After(backoff):
+		case <-ep.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Hooks) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return xerrors.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Status returns the delivery state of the endpoints
+func (h *Hooks) Status() []api.SectorWebhookStatus {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	out := make([]api.SectorWebhookStatus, len(h.endpoints))
+	for i, ep := range h.endpoints {
+		out[i] = api.SectorWebhookStatus{
+			URL:         ep.url,
+			Next:        ep.next,
+			Pending:     h.next - ep.next,
+			LastAttempt: ep.lastAttempt,
+			LastError:   ep.lastErr,
+		}
+	}
+	return out
+}
+
+// Replay moves the cursor of the endpoint url, or of all endpoints when url
+// is empty, back to the first retained event at or after since. Events the
+// endpoint didn't receive yet are still sent. It returns the largest number
+// of events queued for an endpoint.
+func (h *Hooks) Replay(since time.Time, url string) (uint64, error) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	var eps []*endpoint
+	for _, ep := range h.endpoints {
+		if url == "" || ep.url == url {
+			eps = append(eps, ep)
+		}
+	}
+	if len(eps) == 0 {
+		if url == "" {
+			return 0, xerrors.New("no webhook endpoints configured")
+		}
+		return 0, xerrors.Errorf("webhook endpoint %s not configured", url)
+	}
+
+	from, err := h.firstSince(since)
+	if err != nil {
+		return 0, err
+	}
+
+	var queued uint64
+	for _, ep := range eps {
+		if from < ep.next {
+			ep.next = from
+			if err := h.putUint(ep.key, ep.next); err != nil {
+				return 0, xerrors.Errorf("storing cursor of %s: %w", ep.url, err)
+			}
+			select {
+			case ep.wake <- struct{}{}:
+			default:
+			}
+		}
+
+		if n := h.next - ep.next; n > queued {
+			queued = n
+		}
+	}
+
+	return queued, nil
+}
+
+// firstSince returns the Seq of the first retained event at or after since,
+// must be called with h.lk held
+func (h *Hooks) firstSince(since time.Time) (uint64, error) {
+	res, err := h.ds.Query(query.Query{
+		Prefix: eventsPrefix.String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("querying events: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return 0, xerrors.Errorf("reading events: %w", r.Error)
+		}
+
+		var evt api.SectorEvent
+		if err := json.Unmarshal(r.Value, &evt); err != nil {
+			return 0, xerrors.Errorf("decoding event %s: %w", r.Key, err)
+		}
+		if !evt.Time.Before(since) {
+			return evt.Seq, nil
+		}
+	}
+
+	return h.next, nil
+}
+
+// prune removes events older than the retention period which were delivered
+// to all endpoints
+func (h *Hooks) prune() error {
+	h.lk.Lock()
+	keep := h.next
+	for _, ep := range h.endpoints {
+		if ep.next < keep {
+			keep = ep.next
+		}
+	}
+	h.lk.Unlock()
+
+	cutoff := build.Clock.Now().Add(-h.cfg.Retention)
+
+	res, err := h.ds.Query(query.Query{
+		Prefix: eventsPrefix.String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return xerrors.Errorf("querying events: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var pruned int
+	for r := range res.Next() {
+		if r.Error != nil {
+			return xerrors.Errorf("reading events: %w", r.Error)
+		}
+
+		var evt api.SectorEvent
+		if err := json.Unmarshal(r.Value, &evt); err != nil {
+			return xerrors.Errorf("decoding event %s: %w", r.Key, err)
+		}
+		if evt.Seq >= keep || !evt.Time.Before(cutoff) {
+			break
+		}
+
+		if err := h.ds.Delete(datastore.NewKey(r.Key)); err != nil {
+			return xerrors.Errorf("deleting event %d: %w", evt.Seq, err)
+		}
+		pruned++
+	}
+
+	if pruned > 0 {
+		log.Infow("pruned sector events", "count", pruned)
+	}
+	return nil
+}
+
+func (h *Hooks) getUint(k datastore.Key) (uint64, error) {
+	b, err := h.ds.Get(k)
+	if err == datastore.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, xerrors.Errorf("invalid value for %s", k)
+	}
+	return v, nil
+}
+
+func (h *Hooks) putUint(k datastore.Key, v uint64) error {
+	return h.ds.Put(k, encodeUint(v))
+}
+
+func encodeUint(v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, v)]
+}
+
+func stateKey(n abi.SectorNumber) datastore.Key {
+	return statesPrefix.ChildString(fmt.Sprint(uint64(n)))
+}
+
+// eventKey pads the Seq, so events are listed in order
+func eventKey(seq uint64) datastore.Key {
+	return eventsPrefix.ChildString(fmt.Sprintf("%020d", seq))
+}
@@ -0,0 +1,155 @@
+package sectorhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+func TestDeliveryAndReplay(t *testing.T) {
+	MinBackoff = 10 * time.Millisecond
+
+	var lk sync.Mutex
+	var got []uint64
+	failures := 2
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var evt api.SectorEvent
+		if err := json.NewDecoder(r.Body).Decode(&evt); err != nil {
+			t.Error(err)
+		}
+
+		lk.Lock()
+		defer lk.Unlock()
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		got = append(got, evt.Seq)
+	}))
+	defer srv.Close()
+
+	delivered := func(n int) func() bool {
+		return func() bool {
+			lk.Lock()
+			defer lk.Unlock()
+			return len(got) == n
+		}
+	}
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	cfg := Config{URLs: []string{srv.URL}, Retention: time.Hour}
+
+	h, err := New(ds, cfg, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- h.Run(ctx)
+	}()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, h.Record(api.SectorUpdate{Sector: abi.SectorNumber(i), To: api.SectorState("Proving"), Time: start.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	require.Eventually(t, delivered(3), 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{0, 1, 2}, got, "failed events are retried in order")
+
+	n, err := h.Replay(start.Add(time.Minute), "")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+
+	require.Eventually(t, delivered(5), 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []uint64{0, 1, 2, 1, 2}, got)
+
+	_, err = h.Replay(start, "http://unknown")
+	require.Error(t, err)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// the counter and cursors survive restarts
+	h, err = New(ds, cfg, nil)
+	require.NoError(t, err)
+	st := h.Status()
+	require.Len(t, st, 1)
+	require.Equal(t, uint64(3), st[0].Next)
+	require.Equal(t, uint64(0), st[0].Pending)
+
+	// new endpoints only get new events
+	h, err = New(ds, Config{URLs: []string{srv.URL, "http://other"}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), h.Status()[1].Next)
+}
+
+func TestReconcile(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+
+	var lk sync.Mutex
+	states := map[abi.SectorNumber]api.SectorState{1: "Proving", 2: "PreCommit1"}
+	sectors := func() (map[abi.SectorNumber]api.SectorState, error) {
+		lk.Lock()
+		defer lk.Unlock()
+
+		out := map[abi.SectorNumber]api.SectorState{}
+		for n, st := range states {
+			out[n] = st
+		}
+		return out, nil
+	}
+	setState := func(n abi.SectorNumber, st api.SectorState) {
+		lk.Lock()
+		defer lk.Unlock()
+		states[n] = st
+	}
+
+	h, err := New(ds, Config{Retention: time.Hour}, sectors)
+	require.NoError(t, err)
+
+	// existing sectors are seeded without events
+	require.NoError(t, h.reconcile())
+	require.NoError(t, h.reconcile())
+	require.Equal(t, uint64(0), h.next)
+
+	// a recorded change the FSM didn't persist yet isn't reverted
+	require.NoError(t, h.Record(api.SectorUpdate{Sector: 2, From: "PreCommit1", To: "PreCommit2"}))
+	require.NoError(t, h.reconcile())
+	setState(2, "PreCommit2")
+	require.NoError(t, h.reconcile())
+	require.NoError(t, h.reconcile())
+	require.Equal(t, uint64(1), h.next)
+
+	// a change which wasn't recorded is, once seen twice
+	setState(1, "Removing")
+	require.NoError(t, h.reconcile())
+	require.Equal(t, uint64(1), h.next)
+	require.NoError(t, h.reconcile())
+	require.Equal(t, uint64(2), h.next)
+
+	b, err := h.ds.Get(eventKey(1))
+	require.NoError(t, err)
+	var evt api.SectorEvent
+	require.NoError(t, json.Unmarshal(b, &evt))
+	require.Equal(t, abi.SectorNumber(1), evt.Sector)
+	require.Equal(t, api.SectorState("Proving"), evt.From)
+	require.Equal(t, api.SectorState("Removing"), evt.To)
+
+	require.NoError(t, h.reconcile())
+	require.Equal(t, uint64(2), h.next)
+}
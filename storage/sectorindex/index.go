@@ -0,0 +1,419 @@
+package sectorindex
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+	"github.com/filecoin-project/lotus/storage/labels"
+)
+
+var log = logging.Logger("sectorindex")
+
+// MaxAge is how old the index can get before a query starts rebuilding it in
+// the background
+var MaxAge = 30 * time.Second
+
+// rebuildTimeout bounds background rebuilds
+var rebuildTimeout = 5 * time.Minute
+
+// dealRetry is how long deals whose client couldn't be looked up, usually
+// deals which expired, are left alone
+var dealRetry = time.Hour
+
+// Sectors lists the sectors of the sealing state machines
+type Sectors interface {
+	ListSectors() ([]sealing.SectorInfo, error)
+}
+
+// Labels lists the labels of sectors
+type Labels interface {
+	Sectors(selector map[string]string) ([]api.SectorLabels, error)
+}
+
+// Storage lists the sector files in storage paths
+type Storage interface {
+	StorageList(ctx context.Context) (map[stores.ID][]stores.Decl, error)
+}
+
+// ChainAPI is the full node API the index uses
+type ChainAPI interface {
+	StateMinerSectors(context.Context, address.Address, *bitfield.BitField, types.TipSetKey) ([]*miner.SectorOnChainInfo, error)
+	StateMarketStorageDeal(context.Context, abi.DealID, types.TipSetKey) (*api.MarketDeal, error)
+}
+
+type set map[abi.SectorNumber]struct{}
+
+func (s set) add(n abi.SectorNumber) {
+	s[n] = struct{}{}
+}
+
+// index maps the values of a field to the sectors with the value
+type index map[string]set
+
+func (idx index) add(key string, n abi.SectorNumber) {
+	if idx[key] == nil {
+		idx[key] = set{}
+	}
+	idx[key].add(n)
+}
+
+// Index answers filtered, sorted and paginated queries over sector metadata
+// from the sealing state machines, the chain, storage paths and labels. Queries
+// are answered from the last built index, which is rebuilt in the background
+// when it's older than MaxAge, or before the query on request. Rebuilds don't
+// block queries, the new index is swapped in once it's built.
+type Index struct {
+	chain   ChainAPI
+	maddr   address.Address
+	sectors Sectors
+	labels  Labels
+	storage Storage
+
+	lk         sync.Mutex
+	built      time.Time
+	rebuilding bool
+	snap       *snapshot
+
+	// buildLk serialises rebuilds, and guards the deal clients. Deal clients
+	// don't change, so they are looked up once and rebuilds only look up
+	// deals which are new.
+	buildLk sync.Mutex
+	clients map[abi.DealID]address.Address
+	missing map[abi.DealID]time.Time
+}
+
+type snapshot struct {
+	recs     map[abi.SectorNumber]*api.SectorMeta
+	byState  index
+	byClient index
+	byPath   index
+	byLabel  index
+}
+
+func New(chain ChainAPI, maddr address.Address, sectors Sectors, labels Labels, storage Storage) *Index {
+	return &Index{
+		chain:   chain,
+		maddr:   maddr,
+		sectors: sectors,
+		labels:  labels,
+		storage: storage,
+		clients: map[abi.DealID]address.Address{},
+		missing: map[abi.DealID]time.Time{},
+	}
+}
+
+// Query returns the sectors matching q
+func (ix *Index) Query(ctx context.Context, q api.SectorQuery) (api.SectorQueryResult, error) {
+	var less func(a, b *api.SectorMeta) bool
+	switch q.SortBy {
+	case "", "number":
+		less = func(a, b *api.SectorMeta) bool { return a.Sector < b.Sector }
+	case "expiration":
+		less = func(a, b *api.SectorMeta) bool {
+			if a.Expiration != b.Expiration {
+				return a.Expiration < b.Expiration
+			}
+			return a.Sector < b.Sector
+		}
+	case "state":
+		less = func(a, b *api.SectorMeta) bool {
+			if a.State != b.State {
+				return a.State < b.State
+			}
+			return a.Sector < b.Sector
+		}
+	default:
+		return api.SectorQueryResult{}, xerrors.Errorf("can't sort sectors by %q, expected number, expiration or state", q.SortBy)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return api.SectorQueryResult{}, xerrors.New("offset and limit can't be negative")
+	}
+
+	ix.lk.Lock()
+	build := q.Refresh || ix.snap == nil
+	if !build && time.Since(ix.built) > MaxAge && !ix.rebuilding {
+		ix.rebuilding = true
+		go ix.rebuildBackground()
+	}
+	ix.lk.Unlock()
+
+	if build {
+		if err := ix.rebuild(ctx); err != nil {
+			return api.SectorQueryResult{}, xerrors.Errorf("building sector index: %w", err)
+		}
+	}
+
+	ix.lk.Lock()
+	snap := ix.snap
+	ix.lk.Unlock()
+
+	var match []*api.SectorMeta
+	for n := range snap.candidates(q) {
+		rec := snap.recs[n]
+		if matches(rec, q) {
+			match = append(match, rec)
+		}
+	}
+
+	sort.Slice(match, func(i, j int) bool {
+		if q.Desc {
+			return less(match[j], match[i])
+		}
+		return less(match[i], match[j])
+	})
+
+	out := api.SectorQueryResult{Total: len(match), Sectors: []api.SectorMeta{}}
+	if q.Offset >= len(match) {
+		return out, nil
+	}
+	match = match[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(match) {
+		match = match[:q.Limit]
+	}
+	for _, rec := range match {
+		out.Sectors = append(out.Sectors, *rec)
+	}
+	return out, nil
+}
+
+// candidates intersects the indexes for the filters of q
+func (snap *snapshot) candidates(q api.SectorQuery) set {
+	var sets []set
+
+	if len(q.States) > 0 {
+		states := set{}
+		for _, st := range q.States {
+			for n := range snap.byState[string(st)] {
+				states.add(n)
+			}
+		}
+		sets = append(sets, states)
+	}
+	if q.DealClient != nil {
+		sets = append(sets, snap.byClient[q.DealClient.String()])
+	}
+	if q.StoragePath != "" {
+		sets = append(sets, snap.byPath[string(q.StoragePath)])
+	}
+	for k := range q.Labels {
+		sets = append(sets, snap.byLabel[k])
+	}
+
+	if len(sets) == 0 {
+		all := make(set, len(snap.recs))
+		for n := range snap.recs {
+			all.add(n)
+		}
+		return all
+	}
+
+	sort.Slice(sets, func(i, j int) bool {
+		return len(sets[i]) < len(sets[j])
+	})
+
+	out := set{}
+	for n := range sets[0] {
+		in := true
+		for _, s := range sets[1:] {
+			if _, ok := s[n]; !ok {
+				in = false
+				break
+			}
+		}
+		if in {
+			out.add(n)
+		}
+	}
+	return out
+}
+
+// matches applies the filters of q which aren't indexed
+func matches(rec *api.SectorMeta, q api.SectorQuery) bool {
+	if q.ExpirationFrom > 0 && rec.Expiration < q.ExpirationFrom {
+		return false
+	}
+	if q.ExpirationTo > 0 && (rec.Expiration == 0 || rec.Expiration > q.ExpirationTo) {
+		return false
+	}
+	if !labels.Matches(rec.Labels, q.Labels) {
+		return false
+	}
+
+	if q.Text == "" {
+		return true
+	}
+	text := strings.ToLower(q.Text)
+	if strings.Contains(strconv.FormatUint(uint64(rec.Sector), 10), text) ||
+		strings.Contains(strings.ToLower(string(rec.State)), text) {
+		return true
+	}
+	for k, v := range rec.Labels {
+		if strings.Contains(strings.ToLower(k), text) || strings.Contains(strings.ToLower(v), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ix *Index) rebuildBackground() {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+	defer cancel()
+
+	if err := ix.rebuild(ctx); err != nil {
+		log.Warnf("rebuilding sector index: %+v", err)
+	}
+
+	ix.lk.Lock()
+	ix.rebuilding = false
+	ix.lk.Unlock()
+}
+
+// rebuild loads the sector metadata and swaps in the new index
+func (ix *Index) rebuild(ctx context.Context) error {
+	ix.buildLk.Lock()
+	defer ix.buildLk.Unlock()
+
+	start := time.Now()
+
+	sectors, err := ix.sectors.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	onChain, err := ix.chain.StateMinerSectors(ctx, ix.maddr, nil, types.EmptyTSK)
+	if err != nil {
+		return xerrors.Errorf("getting on-chain sectors: %w", err)
+	}
+	expiration := make(map[abi.SectorNumber]abi.ChainEpoch, len(onChain))
+	for _, info := range onChain {
+		expiration[info.SectorNumber] = info.Expiration
+	}
+
+	decls, err := ix.storage.StorageList(ctx)
+	if err != nil {
+		return xerrors.Errorf("listing storage paths: %w", err)
+	}
+	paths := map[abi.SectorNumber][]stores.ID{}
+	for id, ds := range decls {
+		seen := set{}
+		for _, d := range ds {
+			if _, ok := seen[d.Number]; ok {
+				continue
+			}
+			seen.add(d.Number)
+			paths[d.Number] = append(paths[d.Number], id)
+		}
+	}
+
+	labelled, err := ix.labels.Sectors(nil)
+	if err != nil {
+		return xerrors.Errorf("listing labels: %w", err)
+	}
+	sectorLabels := make(map[abi.SectorNumber]map[string]string, len(labelled))
+	for _, l := range labelled {
+		sectorLabels[l.Sector] = l.Labels
+	}
+
+	snap := &snapshot{
+		recs:     make(map[abi.SectorNumber]*api.SectorMeta, len(sectors)),
+		byState:  index{},
+		byClient: index{},
+		byPath:   index{},
+		byLabel:  index{},
+	}
+
+	for _, s := range sectors {
+		rec := &api.SectorMeta{
+			Sector:       s.SectorNumber,
+			State:        api.SectorState(s.State),
+			Expiration:   expiration[s.SectorNumber],
+			StoragePaths: paths[s.SectorNumber],
+			Labels:       sectorLabels[s.SectorNumber],
+			LastErr:      s.LastErr,
+		}
+		if len(s.Log) > 0 {
+			rec.Updated = time.Unix(int64(s.Log[len(s.Log)-1].Timestamp), 0)
+		}
+		snap.recs[s.SectorNumber] = rec
+		snap.byState.add(string(rec.State), s.SectorNumber)
+
+		clients := map[address.Address]struct{}{}
+		for _, p := range s.Pieces {
+			if p.DealInfo == nil {
+				continue
+			}
+			rec.Deals = append(rec.Deals, p.DealInfo.DealID)
+
+			client := ix.dealClient(ctx, p.DealInfo.DealID)
+			if client == address.Undef {
+				continue
+			}
+			if _, ok := clients[client]; !ok {
+				clients[client] = struct{}{}
+				rec.DealClients = append(rec.DealClients, client)
+				snap.byClient.add(client.String(), s.SectorNumber)
+			}
+		}
+
+		for _, id := range rec.StoragePaths {
+			snap.byPath.add(string(id), s.SectorNumber)
+		}
+		for k := range rec.Labels {
+			snap.byLabel.add(k, s.SectorNumber)
+		}
+	}
+
+	// deal clients missing because the rebuild was cancelled aren't known
+	// to be missing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ix.lk.Lock()
+	ix.snap = snap
+	ix.built = time.Now()
+	ix.lk.Unlock()
+
+	log.Debugw("built sector index", "sectors", len(snap.recs), "took", time.Since(start))
+	return nil
+}
+
+// dealClient looks up the client of a deal, deals which aren't on chain
+// anymore have no client. Must be called with buildLk held.
+func (ix *Index) dealClient(ctx context.Context, deal abi.DealID) address.Address {
+	if c, ok := ix.clients[deal]; ok {
+		return c
+	}
+	if t, ok := ix.missing[deal]; ok && time.Since(t) < dealRetry {
+		return address.Undef
+	}
+
+	md, err := ix.chain.StateMarketStorageDeal(ctx, deal, types.EmptyTSK)
+	if err != nil {
+		log.Debugw("looking up deal client", "deal", deal, "error", err)
+		if ctx.Err() == nil {
+			ix.missing[deal] = time.Now()
+		}
+		return address.Undef
+	}
+
+	delete(ix.missing, deal)
+	ix.clients[deal] = md.Proposal.Client
+	return md.Proposal.Client
+}
@@ -0,0 +1,213 @@
+package sectorindex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-state-types/abi"
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/market"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/extern/sector-storage/stores"
+	sealing "github.com/filecoin-project/lotus/extern/storage-sealing"
+)
+
+type testNode struct {
+	sectors []sealing.SectorInfo
+	onChain []*miner.SectorOnChainInfo
+	clients map[abi.DealID]address.Address
+	labels  []api.SectorLabels
+	decls   map[stores.ID][]stores.Decl
+	lookups int
+
+	// listing sectors waits on block when it's set
+	block chan struct{}
+}
+
+func (n *testNode) ListSectors() ([]sealing.SectorInfo, error) {
+	if n.block != nil {
+		<-n.block
+	}
+	return n.sectors, nil
+}
+
+func (n *testNode) Sectors(selector map[string]string) ([]api.SectorLabels, error) {
+	return n.labels, nil
+}
+
+func (n *testNode) StorageList(ctx context.Context) (map[stores.ID][]stores.Decl, error) {
+	return n.decls, nil
+}
+
+func (n *testNode) StateMinerSectors(context.Context, address.Address, *bitfield.BitField, types.TipSetKey) ([]*miner.SectorOnChainInfo, error) {
+	return n.onChain, nil
+}
+
+func (n *testNode) StateMarketStorageDeal(ctx context.Context, deal abi.DealID, tsk types.TipSetKey) (*api.MarketDeal, error) {
+	n.lookups++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, ok := n.clients[deal]
+	if !ok {
+		return nil, xerrors.New("deal not found")
+	}
+	return &api.MarketDeal{Proposal: market.DealProposal{Client: c}}, nil
+}
+
+func sector(n abi.SectorNumber, state sealing.SectorState, deals ...abi.DealID) sealing.SectorInfo {
+	si := sealing.SectorInfo{SectorNumber: n, State: state}
+	for _, d := range deals {
+		si.Pieces = append(si.Pieces, sealing.Piece{DealInfo: &sealing.DealInfo{DealID: d}})
+	}
+	return si
+}
+
+func sectorNumbers(res api.SectorQueryResult) []abi.SectorNumber {
+	out := []abi.SectorNumber{}
+	for _, s := range res.Sectors {
+		out = append(out, s.Sector)
+	}
+	return out
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+
+	alice := tutils.NewIDAddr(t, 1000)
+	bob := tutils.NewIDAddr(t, 1001)
+
+	node := &testNode{
+		sectors: []sealing.SectorInfo{
+			sector(1, sealing.Proving, 10),
+			sector(2, sealing.Proving, 11, 12),
+			sector(3, sealing.PreCommit1),
+			sector(4, sealing.Proving, 13),
+		},
+		onChain: []*miner.SectorOnChainInfo{
+			{SectorNumber: 1, Expiration: 3000},
+			{SectorNumber: 2, Expiration: 1000},
+			{SectorNumber: 4, Expiration: 2000},
+		},
+		clients: map[abi.DealID]address.Address{10: alice, 11: bob, 12: alice},
+		labels: []api.SectorLabels{
+			{Sector: 1, Labels: map[string]string{"tier": "hot"}},
+			{Sector: 4, Labels: map[string]string{"tier": "cold", "owner": "archive"}},
+		},
+		decls: map[stores.ID][]stores.Decl{
+			"fast": {
+				{SectorID: abi.SectorID{Number: 1}, SectorFileType: stores.FTSealed},
+				{SectorID: abi.SectorID{Number: 1}, SectorFileType: stores.FTCache},
+				{SectorID: abi.SectorID{Number: 3}, SectorFileType: stores.FTUnsealed},
+			},
+			"slow": {
+				{SectorID: abi.SectorID{Number: 2}, SectorFileType: stores.FTSealed},
+				{SectorID: abi.SectorID{Number: 4}, SectorFileType: stores.FTSealed},
+			},
+		},
+	}
+	node.sectors[2].LastErr = "boom"
+	node.sectors[2].Log = []sealing.Log{{Timestamp: 100}, {Timestamp: 200}}
+	ix := New(node, tutils.NewIDAddr(t, 100), node, node, node)
+
+	res, err := ix.Query(ctx, api.SectorQuery{})
+	require.NoError(t, err)
+	require.Equal(t, 4, res.Total)
+	require.Equal(t, []abi.SectorNumber{1, 2, 3, 4}, sectorNumbers(res))
+	require.Equal(t, []stores.ID{"fast"}, res.Sectors[0].StoragePaths)
+	require.Equal(t, "boom", res.Sectors[2].LastErr)
+	require.Equal(t, time.Unix(200, 0), res.Sectors[2].Updated)
+	require.Equal(t, []address.Address{bob, alice}, res.Sectors[1].DealClients)
+
+	for _, tc := range []struct {
+		q   api.SectorQuery
+		exp []abi.SectorNumber
+	}{
+		{api.SectorQuery{States: []api.SectorState{api.SectorState(sealing.Proving)}}, []abi.SectorNumber{1, 2, 4}},
+		{api.SectorQuery{DealClient: &alice}, []abi.SectorNumber{1, 2}},
+		{api.SectorQuery{DealClient: &alice, StoragePath: "slow"}, []abi.SectorNumber{2}},
+		{api.SectorQuery{ExpirationFrom: 1500, ExpirationTo: 3000}, []abi.SectorNumber{1, 4}},
+		{api.SectorQuery{Labels: map[string]string{"tier": ""}}, []abi.SectorNumber{1, 4}},
+		{api.SectorQuery{Labels: map[string]string{"tier": "cold"}}, []abi.SectorNumber{4}},
+		{api.SectorQuery{Text: "ARCH"}, []abi.SectorNumber{4}},
+		{api.SectorQuery{Text: "precommit"}, []abi.SectorNumber{3}},
+		{api.SectorQuery{StoragePath: "none"}, []abi.SectorNumber{}},
+		{api.SectorQuery{SortBy: "expiration", States: []api.SectorState{api.SectorState(sealing.Proving)}}, []abi.SectorNumber{2, 4, 1}},
+		{api.SectorQuery{SortBy: "number", Desc: true}, []abi.SectorNumber{4, 3, 2, 1}},
+	} {
+		res, err := ix.Query(ctx, tc.q)
+		require.NoError(t, err)
+		require.Equal(t, tc.exp, sectorNumbers(res), "%+v", tc.q)
+	}
+
+	// pagination
+	res, err = ix.Query(ctx, api.SectorQuery{Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 4, res.Total)
+	require.Equal(t, []abi.SectorNumber{2, 3}, sectorNumbers(res))
+
+	res, err = ix.Query(ctx, api.SectorQuery{Offset: 10})
+	require.NoError(t, err)
+	require.Equal(t, 4, res.Total)
+	require.Empty(t, res.Sectors)
+
+	_, err = ix.Query(ctx, api.SectorQuery{SortBy: "size"})
+	require.Error(t, err)
+
+	// deals are looked up once, missing ones aren't retried right away
+	lookups := node.lookups
+	node.sectors = append(node.sectors, sector(5, sealing.WaitDeals, 10))
+	res, err = ix.Query(ctx, api.SectorQuery{Refresh: true, DealClient: &alice})
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{1, 2, 5}, sectorNumbers(res))
+	require.Equal(t, lookups, node.lookups)
+}
+
+func TestRebuild(t *testing.T) {
+	alice := tutils.NewIDAddr(t, 1000)
+
+	node := &testNode{
+		sectors: []sealing.SectorInfo{sector(1, sealing.Proving, 10)},
+		clients: map[abi.DealID]address.Address{10: alice},
+	}
+	ix := New(node, tutils.NewIDAddr(t, 100), node, node, node)
+
+	// cancelled lookups don't mark deals missing
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ix.Query(cctx, api.SectorQuery{})
+	require.Error(t, err)
+
+	ctx := context.Background()
+	res, err := ix.Query(ctx, api.SectorQuery{DealClient: &alice})
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{1}, sectorNumbers(res))
+
+	// stale indexes are rebuilt in the background, queries don't wait
+	defer func(age time.Duration) {
+		MaxAge = age
+	}(MaxAge)
+	MaxAge = 0
+
+	node.sectors = append(node.sectors, sector(2, sealing.Proving))
+	node.block = make(chan struct{})
+
+	res, err = ix.Query(ctx, api.SectorQuery{})
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{1}, sectorNumbers(res))
+
+	close(node.block)
+	require.Eventually(t, func() bool {
+		res, err := ix.Query(ctx, api.SectorQuery{})
+		return err == nil && len(res.Sectors) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,356 @@
+package sweep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-storedcounter"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/crash"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("sweep")
+
+var dsPrefix = datastore.NewKey("/actor/sweep")
+
+// MaxHistory is the number of sweeps kept in the history
+const MaxHistory = 500
+
+type sweepAPI interface {
+	StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error)
+	StateMinerAvailableBalance(context.Context, address.Address, types.TipSetKey) (types.BigInt, error)
+	StateWaitMsg(ctx context.Context, cid cid.Cid, confidence uint64) (*api.MsgLookup, error)
+	WalletBalance(context.Context, address.Address) (types.BigInt, error)
+	MpoolPushMessage(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error)
+}
+
+// Config controls the sweep, see config.SweepConfig
+type Config struct {
+	Cold        address.Address
+	Interval    time.Duration
+	MinerFloat  abi.TokenAmount
+	OwnerFloat  abi.TokenAmount
+	WorkerFloat abi.TokenAmount
+	MinAmount   abi.TokenAmount
+	MaxFee      abi.TokenAmount
+	DryRun      bool
+	Hook        string
+}
+
+// Sweeper moves funds above a float from the miner actor, owner and worker
+// to a cold address. Every sweep is recorded in the history, including dry
+// runs and sweeps rejected by the approval hook.
+type Sweeper struct {
+	api     sweepAPI
+	ds      datastore.Batching
+	counter *storedcounter.StoredCounter
+	maddr   address.Address
+	cfg     Config
+}
+
+func NewSweeper(sapi sweepAPI, ds dtypes.MetadataDS, maddr address.Address, cfg Config) *Sweeper {
+	return &Sweeper{
+		api:     sapi,
+		ds:      namespace.Wrap(ds, dsPrefix),
+		counter: storedcounter.New(ds, datastore.NewKey("/actor/sweep-counter")),
+		maddr:   maddr,
+		cfg:     cfg,
+	}
+}
+
+// Run sweeps every interval. Scheduled sweeps are dry runs when DryRun is set.
+func (s *Sweeper) Run(ctx context.Context) error {
+	if s.cfg.Cold == address.Undef || s.cfg.Interval <= 0 {
+		return nil
+	}
+
+	tick := build.Clock.Ticker(s.cfg.Interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		rec, err := s.Sweep(ctx, s.cfg.DryRun)
+		if err != nil {
+			crash.Failure(ctx, err)
+			log.Errorf("sweeping rewards: %+v", err)
+			continue
+		}
+		log.Infow("swept rewards", "id", rec.ID, "transfers", len(rec.Transfers), "dryRun", rec.DryRun, "approved", rec.Approved)
+		crash.Success(ctx)
+	}
+}
+
+// Plan returns the transfers a sweep would send now
+func (s *Sweeper) Plan(ctx context.Context) ([]api.SweepTransfer, error) {
+	if s.cfg.Cold == address.Undef {
+		return nil, xerrors.Errorf("no cold address configured (Sweep.ColdAddress)")
+	}
+
+	mi, err := s.api.StateMinerInfo(ctx, s.maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	var out []api.SweepTransfer
+
+	// every message may burn up to MaxFee from its sender, the sends leave
+	// it in the wallet on top of the float
+	fee := s.cfg.MaxFee
+	if fee.Nil() {
+		fee = big.Zero()
+	}
+
+	avail, err := s.api.StateMinerAvailableBalance(ctx, s.maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting available miner balance: %w", err)
+	}
+	withdraw := big.Sub(avail, s.cfg.MinerFloat)
+	if withdraw.GreaterThanEqual(s.cfg.MinAmount) && withdraw.GreaterThan(big.Zero()) {
+		out = append(out, api.SweepTransfer{
+			Kind:   api.SweepWithdraw,
+			From:   s.maddr,
+			To:     mi.Owner,
+			Amount: withdraw,
+		})
+	} else {
+		withdraw = big.Zero()
+	}
+
+	ownerFees := fee
+	if !withdraw.IsZero() {
+		ownerFees = big.Mul(fee, big.NewInt(2))
+	}
+
+	ownerBal, err := s.api.WalletBalance(ctx, mi.Owner)
+	if err != nil {
+		return nil, xerrors.Errorf("getting owner balance: %w", err)
+	}
+	if send := big.Sub(big.Add(ownerBal, withdraw), big.Add(s.cfg.OwnerFloat, ownerFees)); send.GreaterThanEqual(s.cfg.MinAmount) && send.GreaterThan(big.Zero()) {
+		out = append(out, api.SweepTransfer{
+			Kind:   api.SweepSend,
+			From:   mi.Owner,
+			To:     s.cfg.Cold,
+			Amount: send,
+		})
+	}
+
+	if mi.Worker != mi.Owner {
+		workerBal, err := s.api.WalletBalance(ctx, mi.Worker)
+		if err != nil {
+			return nil, xerrors.Errorf("getting worker balance: %w", err)
+		}
+		if send := big.Sub(workerBal, big.Add(s.cfg.WorkerFloat, fee)); send.GreaterThanEqual(s.cfg.MinAmount) && send.GreaterThan(big.Zero()) {
+			out = append(out, api.SweepTransfer{
+				Kind:   api.SweepSend,
+				From:   mi.Worker,
+				To:     s.cfg.Cold,
+				Amount: send,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// Sweep plans transfers, asks the approval hook, and sends them unless
+// dryRun is set. Withdrawals are waited for before the owner sends the
+// withdrawn funds on.
+func (s *Sweeper) Sweep(ctx context.Context, dryRun bool) (api.SweepRecord, error) {
+	transfers, err := s.Plan(ctx)
+	if err != nil {
+		return api.SweepRecord{}, err
+	}
+
+	id, err := s.counter.Next()
+	if err != nil {
+		return api.SweepRecord{}, xerrors.Errorf("getting sweep id: %w", err)
+	}
+
+	rec := api.SweepRecord{
+		ID:        id,
+		Time:      build.Clock.Now(),
+		DryRun:    dryRun,
+		Transfers: transfers,
+	}
+
+	if len(transfers) == 0 {
+		rec.Approved = true
+		return rec, s.save(rec)
+	}
+
+	if err := s.approve(ctx, rec); err != nil {
+		rec.Error = err.Error()
+		return rec, s.save(rec)
+	}
+	rec.Approved = true
+
+	if !dryRun {
+		if err := s.send(ctx, &rec); err != nil {
+			rec.Error = err.Error()
+			if serr := s.save(rec); serr != nil {
+				log.Errorf("saving sweep record: %+v", serr)
+			}
+			return rec, err
+		}
+	}
+
+	return rec, s.save(rec)
+}
+
+func (s *Sweeper) approve(ctx context.Context, rec api.SweepRecord) error {
+	if s.cfg.Hook == "" {
+		return nil
+	}
+
+	j, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+
+	c := exec.CommandContext(ctx, "sh", "-c", s.cfg.Hook)
+	c.Stdin = bytes.NewReader(j)
+	c.Stdout = &out
+	c.Stderr = &out
+
+	switch err := c.Run().(type) {
+	case nil:
+		return nil
+	case *exec.ExitError:
+		return xerrors.Errorf("rejected by approval hook: %s", out.String())
+	default:
+		return xerrors.Errorf("running approval hook: %w", err)
+	}
+}
+
+func (s *Sweeper) send(ctx context.Context, rec *api.SweepRecord) error {
+	for i := range rec.Transfers {
+		t := &rec.Transfers[i]
+
+		msg := &types.Message{
+			From:  t.From,
+			To:    t.To,
+			Value: t.Amount,
+		}
+		if t.Kind == api.SweepWithdraw {
+			params, err := actors.SerializeParams(&miner0.WithdrawBalanceParams{
+				AmountRequested: t.Amount,
+			})
+			if err != nil {
+				return err
+			}
+
+			// withdrawals are sent by the owner, to the miner actor
+			msg = &types.Message{
+				From:   t.To,
+				To:     t.From,
+				Value:  big.Zero(),
+				Method: builtin.MethodsMiner.WithdrawBalance,
+				Params: params,
+			}
+		}
+
+		var spec *api.MessageSendSpec
+		if !s.cfg.MaxFee.Nil() && !s.cfg.MaxFee.IsZero() {
+			spec = &api.MessageSendSpec{MaxFee: s.cfg.MaxFee}
+		}
+
+		smsg, err := s.api.MpoolPushMessage(ctx, msg, spec)
+		if err != nil {
+			return xerrors.Errorf("pushing %s of %s from %s: %w", t.Kind, types.FIL(t.Amount), t.From, err)
+		}
+		mcid := smsg.Cid()
+		t.Message = &mcid
+
+		if t.Kind != api.SweepWithdraw {
+			continue
+		}
+
+		// the owner can only send withdrawn funds once they arrived
+		ml, err := s.api.StateWaitMsg(ctx, mcid, build.MessageConfidence)
+		if err != nil {
+			return xerrors.Errorf("waiting for withdrawal %s: %w", mcid, err)
+		}
+		if ml.Receipt.ExitCode != 0 {
+			return xerrors.Errorf("withdrawal %s failed with exit code %d", mcid, ml.Receipt.ExitCode)
+		}
+	}
+
+	return nil
+}
+
+func (s *Sweeper) save(rec api.SweepRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ds.Put(datastore.NewKey(fmt.Sprint(rec.ID)), b); err != nil {
+		return xerrors.Errorf("saving sweep record: %w", err)
+	}
+
+	if rec.ID > MaxHistory {
+		if err := s.ds.Delete(datastore.NewKey(fmt.Sprint(rec.ID - MaxHistory))); err != nil && err != datastore.ErrNotFound {
+			log.Warnf("removing old sweep record: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// History returns recorded sweeps, oldest first
+func (s *Sweeper) History() ([]api.SweepRecord, error) {
+	res, err := s.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying sweep history: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.SweepRecord
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("reading sweep history: %w", r.Error)
+		}
+
+		var rec api.SweepRecord
+		if err := json.Unmarshal(r.Value, &rec); err != nil {
+			log.Errorw("decoding sweep record", "key", r.Key, "error", err)
+			continue
+		}
+		out = append(out, rec)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
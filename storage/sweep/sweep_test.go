@@ -0,0 +1,131 @@
+package sweep
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	tutils "github.com/filecoin-project/specs-actors/support/testing"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type fakeAPI struct {
+	info     miner.MinerInfo
+	avail    types.BigInt
+	balances map[address.Address]types.BigInt
+	sent     []*types.Message
+	specs    []*api.MessageSendSpec
+}
+
+func (f *fakeAPI) StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error) {
+	return f.info, nil
+}
+
+func (f *fakeAPI) StateMinerAvailableBalance(context.Context, address.Address, types.TipSetKey) (types.BigInt, error) {
+	return f.avail, nil
+}
+
+func (f *fakeAPI) StateWaitMsg(ctx context.Context, c cid.Cid, confidence uint64) (*api.MsgLookup, error) {
+	return &api.MsgLookup{}, nil
+}
+
+func (f *fakeAPI) WalletBalance(_ context.Context, a address.Address) (types.BigInt, error) {
+	return f.balances[a], nil
+}
+
+func (f *fakeAPI) MpoolPushMessage(_ context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	f.sent = append(f.sent, msg)
+	f.specs = append(f.specs, spec)
+	return &types.SignedMessage{Message: *msg}, nil
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	maddr := tutils.NewIDAddr(t, 1000)
+	owner := tutils.NewIDAddr(t, 101)
+	worker := tutils.NewIDAddr(t, 102)
+	cold := tutils.NewIDAddr(t, 103)
+
+	fil := func(n int64) types.BigInt {
+		return types.FromFil(uint64(n))
+	}
+
+	newSweeper := func(hook string) (*fakeAPI, *Sweeper) {
+		fapi := &fakeAPI{
+			info:  miner.MinerInfo{Owner: owner, Worker: worker},
+			avail: fil(100),
+			balances: map[address.Address]types.BigInt{
+				owner:  fil(2),
+				worker: fil(60),
+			},
+		}
+		s := NewSweeper(fapi, dss.MutexWrap(datastore.NewMapDatastore()), maddr, Config{
+			Cold:        cold,
+			MinerFloat:  fil(10),
+			OwnerFloat:  fil(1),
+			WorkerFloat: fil(50),
+			MinAmount:   fil(1),
+			MaxFee:      fil(1),
+			Hook:        hook,
+		})
+		return fapi, s
+	}
+
+	fapi, s := newSweeper("")
+
+	// dry runs don't send anything
+	rec, err := s.Sweep(ctx, true)
+	require.NoError(t, err)
+	require.True(t, rec.Approved)
+	require.Empty(t, fapi.sent)
+	// the owner keeps the fees of the withdrawal and the send
+	require.Equal(t, []api.SweepTransfer{
+		{Kind: api.SweepWithdraw, From: maddr, To: owner, Amount: fil(90)},
+		{Kind: api.SweepSend, From: owner, To: cold, Amount: fil(89)},
+		{Kind: api.SweepSend, From: worker, To: cold, Amount: fil(9)},
+	}, rec.Transfers)
+
+	rec, err = s.Sweep(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, fapi.sent, 3)
+	require.Equal(t, builtin.MethodsMiner.WithdrawBalance, fapi.sent[0].Method)
+	require.Equal(t, owner, fapi.sent[0].From)
+	require.Equal(t, maddr, fapi.sent[0].To)
+	require.True(t, big.Zero().Equals(fapi.sent[0].Value))
+	require.Equal(t, fil(89), fapi.sent[1].Value)
+	for _, spec := range fapi.specs {
+		require.Equal(t, fil(1), spec.MaxFee)
+	}
+	for _, tr := range rec.Transfers {
+		require.NotNil(t, tr.Message)
+	}
+
+	hist, err := s.History()
+	require.NoError(t, err)
+	require.Len(t, hist, 2)
+	require.True(t, hist[0].DryRun)
+	require.False(t, hist[1].DryRun)
+
+	// the approval hook can reject sweeps
+	fapi, s = newSweeper("exit 1")
+	rec, err = s.Sweep(ctx, false)
+	require.NoError(t, err)
+	require.False(t, rec.Approved)
+	require.Empty(t, fapi.sent)
+
+	fapi, s = newSweeper("grep -q withdraw")
+	rec, err = s.Sweep(ctx, false)
+	require.NoError(t, err)
+	require.True(t, rec.Approved)
+	require.Len(t, fapi.sent, 3)
+}
@@ -0,0 +1,210 @@
+package syncgate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var log = logging.Logger("syncgate")
+
+// WaitTimeout is how long messages sent with a Wait context wait for the full
+// node to catch up before they fail
+var WaitTimeout = 10 * time.Minute
+
+type headAPI interface {
+	ChainHead(context.Context) (*types.TipSet, error)
+	ChainGetGenesis(context.Context) (*types.TipSet, error)
+}
+
+// Gate tracks how far the chain head of the full node is behind the current
+// epoch, and refuses messages while it's more than MaxLag epochs behind. The
+// miner starts with a lagging full node, sealing and deals which need to send
+// messages wait until it catches up.
+type Gate struct {
+	full headAPI
+	// maxLag is negative when messages are never refused
+	maxLag abi.ChainEpoch
+	now    func() time.Time
+	// poll is how often waiting messages check the lag
+	poll time.Duration
+
+	lk      sync.Mutex
+	last    api.SyncLag
+	genesis uint64
+}
+
+func New(full headAPI, maxLag abi.ChainEpoch) *Gate {
+	return &Gate{
+		full:   full,
+		maxLag: maxLag,
+		now:    time.Now,
+		poll:   time.Duration(build.BlockDelaySecs) * time.Second,
+	}
+}
+
+type waitKey struct{}
+
+// Wait returns a context for messages which wait for the full node to catch
+// up, for up to WaitTimeout, rather than failing right away. PoSt and sealing
+// messages have deadlines, failing them would lose more than sending them a
+// bit later.
+func Wait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, waitKey{}, true)
+}
+
+// Lag returns the number of epochs head is behind the epoch expected at now,
+// given the genesis timestamp. Epochs are counted by height, null rounds
+// before head aren't lag.
+func Lag(head *types.TipSet, genesis uint64, now time.Time) abi.ChainEpoch {
+	if now.Unix() < int64(genesis) {
+		return 0
+	}
+	expected := abi.ChainEpoch((now.Unix() - int64(genesis)) / int64(build.BlockDelaySecs))
+	if expected <= head.Height() {
+		return 0
+	}
+	return expected - head.Height()
+}
+
+func (g *Gate) genesisTime(ctx context.Context) (uint64, error) {
+	g.lk.Lock()
+	gen := g.genesis
+	g.lk.Unlock()
+	if gen != 0 {
+		return gen, nil
+	}
+
+	ts, err := g.full.ChainGetGenesis(ctx)
+	if err != nil {
+		return 0, xerrors.Errorf("getting genesis: %w", err)
+	}
+
+	g.lk.Lock()
+	g.genesis = ts.MinTimestamp()
+	g.lk.Unlock()
+	return ts.MinTimestamp(), nil
+}
+
+// Check gets the chain head of the full node and returns its lag
+func (g *Gate) Check(ctx context.Context) (api.SyncLag, error) {
+	gen, err := g.genesisTime(ctx)
+	if err != nil {
+		return api.SyncLag{}, err
+	}
+	head, err := g.full.ChainHead(ctx)
+	if err != nil {
+		return api.SyncLag{}, xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	lag := Lag(head, gen, g.now())
+	out := api.SyncLag{
+		Head:   head.Height(),
+		Lag:    lag,
+		MaxLag: g.maxLag,
+		InSync: g.maxLag < 0 || lag <= g.maxLag,
+	}
+
+	g.lk.Lock()
+	prev := g.last
+	g.last = out
+	g.lk.Unlock()
+
+	switch {
+	case prev.InSync && !out.InSync:
+		log.Warnw("full node fell behind, refusing to send messages", "head", out.Head, "lag", lag, "max-lag", g.maxLag)
+	case !prev.InSync && out.InSync && prev.Head != 0:
+		log.Infow("full node caught up, sending messages again", "head", out.Head, "lag", lag)
+	}
+	return out, nil
+}
+
+// Run checks the lag every epoch, so changes get logged as they happen
+func (g *Gate) Run(ctx context.Context) {
+	t := time.NewTicker(time.Duration(build.BlockDelaySecs) * time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if _, err := g.Check(ctx); err != nil {
+			log.Warnf("checking sync lag: %s", err)
+		}
+	}
+}
+
+// Err returns an error while the full node is more than MaxLag epochs behind
+func (g *Gate) Err(ctx context.Context) error {
+	sl, err := g.Check(ctx)
+	if err != nil {
+		return err
+	}
+	if !sl.InSync {
+		return xerrors.Errorf("full node is %d epochs behind (head %d), more than the max sync lag of %d (Startup.MaxSyncLag)", sl.Lag, sl.Head, sl.MaxLag)
+	}
+	return nil
+}
+
+// admit returns Err, after waiting for up to WaitTimeout for the full node to
+// catch up when ctx is a Wait context
+func (g *Gate) admit(ctx context.Context) error {
+	err := g.Err(ctx)
+	if err == nil || ctx.Value(waitKey{}) == nil {
+		return err
+	}
+
+	log.Infow("waiting for the full node to catch up before sending message", "error", err)
+
+	ctx, cancel := context.WithTimeout(ctx, WaitTimeout)
+	defer cancel()
+
+	t := time.NewTicker(g.poll)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return xerrors.Errorf("waiting for the full node to catch up: %w", err)
+		}
+
+		if err = g.Err(ctx); err == nil {
+			return nil
+		}
+	}
+}
+
+// FullNode refuses to send messages while the full node lags behind, messages
+// sent with a Wait context wait for it to catch up
+type FullNode struct {
+	api.FullNode
+	Gate *Gate
+}
+
+func (n *FullNode) MpoolPushMessage(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) (*types.SignedMessage, error) {
+	if err := n.Gate.admit(ctx); err != nil {
+		return nil, err
+	}
+	return n.FullNode.MpoolPushMessage(ctx, msg, spec)
+}
+
+func (n *FullNode) MpoolPush(ctx context.Context, smsg *types.SignedMessage) (cid.Cid, error) {
+	if err := n.Gate.admit(ctx); err != nil {
+		return cid.Undef, err
+	}
+	return n.FullNode.MpoolPush(ctx, smsg)
+}
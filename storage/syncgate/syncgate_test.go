@@ -0,0 +1,151 @@
+package syncgate
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-state-types/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+type fakeHead struct {
+	lk      sync.Mutex
+	head    *types.TipSet
+	genesis *types.TipSet
+}
+
+func (f *fakeHead) ChainHead(context.Context) (*types.TipSet, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.head, nil
+}
+
+func (f *fakeHead) ChainGetGenesis(context.Context) (*types.TipSet, error) {
+	return f.genesis, nil
+}
+
+func (f *fakeHead) setHead(ts *types.TipSet) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.head = ts
+}
+
+type fakeFull struct {
+	api.FullNode
+	pushed int
+}
+
+func (f *fakeFull) MpoolPushMessage(context.Context, *types.Message, *api.MessageSendSpec) (*types.SignedMessage, error) {
+	f.pushed++
+	return &types.SignedMessage{}, nil
+}
+
+func epochs(n int) time.Duration {
+	return time.Duration(n) * time.Duration(build.BlockDelaySecs) * time.Second
+}
+
+// testChain returns a chain head at height 100 and its genesis
+func testChain() *fakeHead {
+	gen := mock.MkBlock(nil, 1, 1)
+	gen.Height = 0
+	gen.Timestamp = 1000000
+
+	blk := mock.MkBlock(nil, 1, 1)
+	blk.Height = 100
+	blk.Timestamp = gen.Timestamp + 100*build.BlockDelaySecs
+
+	return &fakeHead{head: mock.TipSet(blk), genesis: mock.TipSet(gen)}
+}
+
+func TestGate(t *testing.T) {
+	ctx := context.Background()
+
+	fh := testChain()
+	blk := fh.head.Blocks()[0]
+
+	now := time.Unix(int64(blk.Timestamp), 0)
+	g := New(fh, 3)
+	g.now = func() time.Time { return now }
+
+	ff := &fakeFull{}
+	full := &FullNode{FullNode: ff, Gate: g}
+
+	sl, err := g.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, api.SyncLag{Head: 100, Lag: 0, MaxLag: 3, InSync: true}, sl)
+
+	now = now.Add(epochs(3) + time.Second)
+	sl, err = g.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, abi.ChainEpoch(3), sl.Lag)
+	require.True(t, sl.InSync)
+	_, err = full.MpoolPushMessage(ctx, &types.Message{}, nil)
+	require.NoError(t, err)
+
+	now = now.Add(epochs(1))
+	_, err = full.MpoolPushMessage(ctx, &types.Message{}, nil)
+	require.Error(t, err)
+	require.Equal(t, 1, ff.pushed)
+
+	// the node catches up, after null rounds
+	blk2 := mock.MkBlock(fh.head, 1, 1)
+	blk2.Height = 104
+	blk2.Timestamp = uint64(now.Unix())
+	fh.head = mock.TipSet(blk2)
+	_, err = full.MpoolPushMessage(ctx, &types.Message{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, ff.pushed)
+
+	// a negative max lag never refuses
+	g.maxLag = -1
+	now = now.Add(epochs(100))
+	sl, err = g.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, abi.ChainEpoch(100), sl.Lag)
+	require.True(t, sl.InSync)
+}
+
+func TestGateWait(t *testing.T) {
+	ctx := context.Background()
+
+	fh := testChain()
+	blk := fh.head.Blocks()[0]
+
+	now := time.Unix(int64(blk.Timestamp), 0).Add(epochs(10))
+	g := New(fh, 3)
+	g.now = func() time.Time { return now }
+	g.poll = time.Millisecond
+
+	ff := &fakeFull{}
+	full := &FullNode{FullNode: ff, Gate: g}
+
+	defer func(timeout time.Duration) {
+		WaitTimeout = timeout
+	}(WaitTimeout)
+	WaitTimeout = 50 * time.Millisecond
+
+	// waiting messages time out
+	_, err := full.MpoolPushMessage(Wait(ctx), &types.Message{}, nil)
+	require.Error(t, err)
+	require.Equal(t, 0, ff.pushed)
+
+	// and are sent once the node catches up
+	WaitTimeout = time.Minute
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		blk2 := mock.MkBlock(fh.head, 1, 1)
+		blk2.Height = 110
+		fh.setHead(mock.TipSet(blk2))
+	}()
+	_, err = full.MpoolPushMessage(Wait(ctx), &types.Message{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, ff.pushed)
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/filecoin-project/lotus/journal"
+)
+
+// urgentFeeMultiplier raises the default fee limit and the estimated gas
+// premium of forced PoSts, so they are included in the next blocks
+const urgentFeeMultiplier = 4
+
+type forceSubmitReq struct {
+	deadline uint64
+	maxFee   abi.TokenAmount
+	out      chan forceSubmitRes
+}
+
+type forceSubmitRes struct {
+	msgs []cid.Cid
+	err  error
+}
+
+// ForceSubmit immediately computes and submits proofs for all partitions of
+// the open deadline which weren't proven yet, without waiting for
+// StartConfidence. A PoSt the scheduler is computing for the deadline is
+// aborted, so the forced one has the hardware. It's meant for recovering from
+// outages right before challenge windows close, the fee is limited to maxFee,
+// or urgentFeeMultiplier times MaxWindowPoStGasFee when it's 0.
+func (s *WindowPoStScheduler) ForceSubmit(ctx context.Context, dlIdx uint64, maxFee abi.TokenAmount) ([]cid.Cid, error) {
+	if maxFee.Nil() || maxFee.IsZero() {
+		maxFee = abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)
+		maxFee = big.Mul(maxFee, big.NewInt(urgentFeeMultiplier))
+	}
+
+	req := forceSubmitReq{
+		deadline: dlIdx,
+		maxFee:   maxFee,
+		out:      make(chan forceSubmitRes, 1),
+	}
+
+	select {
+	case s.force <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-req.out:
+		return res.msgs, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forceSubmit starts a forced PoSt, it's called from the Run loop
+func (s *WindowPoStScheduler) forceSubmit(ctx context.Context, req forceSubmitReq) {
+	fail := func(err error) {
+		req.out <- forceSubmitRes{err: err}
+	}
+
+	ts := s.cur
+	if ts == nil {
+		fail(xerrors.New("window post scheduler didn't get the chain head yet"))
+		return
+	}
+
+	di, err := s.api.StateMinerProvingDeadline(ctx, s.actor, ts.Key())
+	if err != nil {
+		fail(xerrors.Errorf("getting proving deadline: %w", err))
+		return
+	}
+	if di.Index != req.deadline || !di.IsOpen() {
+		fail(xerrors.Errorf("deadline %d isn't open, the open deadline is %d (epochs %d-%d, head at %d)", req.deadline, di.Index, di.Open, di.Close, ts.Height()))
+		return
+	}
+
+	deadlines, err := s.api.StateMinerDeadlines(ctx, s.actor, ts.Key())
+	if err != nil {
+		fail(xerrors.Errorf("getting deadlines: %w", err))
+		return
+	}
+	if di.Index >= uint64(len(deadlines)) {
+		fail(xerrors.Errorf("deadline %d not in miner state", di.Index))
+		return
+	}
+	proven := deadlines[di.Index].PostSubmissions
+
+	s.abortActivePoSt()
+
+	ctx, abort := context.WithCancel(ctx)
+	s.abort = abort
+	s.activeDeadline = di
+
+	log.Warnw("forcing window post", "deadline", di.Index, "height", ts.Height(), "close", di.Close, "maxFee", req.maxFee)
+
+	journal.J.RecordEvent(s.evtTypes[evtTypeWdPoStScheduler], func() interface{} {
+		return WdPoStSchedulerEvt{
+			evtCommon: s.getEvtCommon(nil),
+			State:     SchedulerStateStarted,
+		}
+	})
+
+	go func() {
+		defer abort()
+
+		posts, err := s.generateDuePosts(ctx, *di, ts, proven)
+		if err != nil {
+			s.failPost(err, di)
+			fail(xerrors.Errorf("computing window post: %w", err))
+			return
+		}
+
+		var res forceSubmitRes
+		for i := range posts {
+			post := &posts[i]
+			sm, err := s.pushPost(ctx, post, 0, req.maxFee)
+			if err != nil {
+				s.failPost(err, di)
+				res.err = xerrors.Errorf("submitting window post: %w", err)
+				continue
+			}
+			res.msgs = append(res.msgs, sm.Cid())
+
+			journal.J.RecordEvent(s.evtTypes[evtTypeWdPoStProofs], func() interface{} {
+				return &WdPoStProofsProcessedEvt{
+					evtCommon:  s.getEvtCommon(nil),
+					Partitions: post.Partitions,
+					MessageCID: sm.Cid(),
+				}
+			})
+
+			go s.watchPost(*di, post, sm, 0)
+		}
+
+		req.out <- res
+	}()
+}
+
+// ForceWindowPoSt submits the proofs of the open deadline now, see
+// WindowPoStScheduler.ForceSubmit
+func (m *Miner) ForceWindowPoSt(ctx context.Context, dlIdx uint64, maxFee abi.TokenAmount) ([]cid.Cid, error) {
+	return m.wdpost.ForceSubmit(ctx, dlIdx, maxFee)
+}
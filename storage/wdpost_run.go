@@ -12,8 +12,11 @@ import (
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/go-state-types/dline"
+	"github.com/filecoin-project/go-state-types/exitcode"
 	"github.com/ipfs/go-cid"
 
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 	"golang.org/x/xerrors"
 
@@ -27,6 +30,8 @@ import (
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/journal"
+	"github.com/filecoin-project/lotus/metrics"
+	"github.com/filecoin-project/lotus/storage/syncgate"
 )
 
 func (s *WindowPoStScheduler) failPost(err error, deadline *dline.Info) {
@@ -90,7 +95,7 @@ func (s *WindowPoStScheduler) doPost(ctx context.Context, deadline *dline.Info,
 
 		for i := range posts {
 			post := &posts[i]
-			sm, err := s.submitPost(ctx, post)
+			sm, err := s.submitPost(ctx, *deadline, post)
 			if err != nil {
 				log.Errorf("submit window post failed: %+v", err)
 				s.failPost(err, deadline)
@@ -225,7 +230,7 @@ func (s *WindowPoStScheduler) checkNextRecoveries(ctx context.Context, dlIdx uin
 	spec := &api.MessageSendSpec{MaxFee: abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)}
 	s.setSender(ctx, msg, spec)
 
-	sm, err := s.api.MpoolPushMessage(ctx, msg, &api.MessageSendSpec{MaxFee: abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)})
+	sm, err := s.api.MpoolPushMessage(syncgate.Wait(ctx), msg, &api.MessageSendSpec{MaxFee: abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)})
 	if err != nil {
 		return recoveries, sm, xerrors.Errorf("pushing message to mpool: %w", err)
 	}
@@ -304,7 +309,7 @@ func (s *WindowPoStScheduler) checkNextFaults(ctx context.Context, dlIdx uint64,
 	spec := &api.MessageSendSpec{MaxFee: abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)}
 	s.setSender(ctx, msg, spec)
 
-	sm, err := s.api.MpoolPushMessage(ctx, msg, spec)
+	sm, err := s.api.MpoolPushMessage(syncgate.Wait(ctx), msg, spec)
 	if err != nil {
 		return faults, sm, xerrors.Errorf("pushing message to mpool: %w", err)
 	}
@@ -389,6 +394,17 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di dline.Info, ts *ty
 		})
 	}()
 
+	return s.generatePosts(ctx, di, ts)
+}
+
+// generatePosts computes proofs for all partitions of the deadline
+func (s *WindowPoStScheduler) generatePosts(ctx context.Context, di dline.Info, ts *types.TipSet) ([]miner.SubmitWindowedPoStParams, error) {
+	return s.generateDuePosts(ctx, di, ts, bitfield.New())
+}
+
+// generateDuePosts computes proofs for the partitions of the deadline which
+// aren't in proven
+func (s *WindowPoStScheduler) generateDuePosts(ctx context.Context, di dline.Info, ts *types.TipSet, proven bitfield.BitField) ([]miner.SubmitWindowedPoStParams, error) {
 	buf := new(bytes.Buffer)
 	if err := s.actor.MarshalCBOR(buf); err != nil {
 		return nil, xerrors.Errorf("failed to marshal address to cbor: %w", err)
@@ -429,12 +445,21 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di dline.Info, ts *ty
 		skipCount := uint64(0)
 		postSkipped := bitfield.New()
 		var postOut []proof.PoStProof
+		var badProof error
 		somethingToProve := true
 
 		for retries := 0; retries < 5; retries++ {
 			var partitions []miner.PoStPartition
 			var sinfos []proof.SectorInfo
 			for partIdx, partition := range batch {
+				done, err := proven.IsSet(uint64(batchPartitionStartIdx + partIdx))
+				if err != nil {
+					return nil, xerrors.Errorf("checking proven partitions: %w", err)
+				}
+				if done {
+					continue
+				}
+
 				// TODO: Can do this in parallel
 				toProve, err := bitfield.MergeBitFields(partition.ActiveSectors, partition.RecoveringSectors)
 				if err != nil {
@@ -505,6 +530,16 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di dline.Info, ts *ty
 
 			log.Infow("computing window post", "batch", batchIdx, "elapsed", elapsed)
 
+			if err == nil && s.verifyPoSt {
+				if verr := s.verifyPost(ctx, abi.ActorID(mid), abi.PoStRandomness(rand), postOut, sinfos); verr != nil {
+					// not caused by particular sectors, so just recompute
+					log.Errorw("generated window post failed local verification, retrying", "batch", batchIdx, "error", verr, "try", retries)
+					badProof = verr
+					postOut = nil
+					continue
+				}
+			}
+
 			if err == nil {
 				// Proof generation successful, stop retrying
 				params.Partitions = append(params.Partitions, partitions...)
@@ -532,6 +567,9 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di dline.Info, ts *ty
 		}
 
 		if len(postOut) == 0 {
+			if badProof != nil {
+				return nil, xerrors.Errorf("no valid window post generated: %w", badProof)
+			}
 			return nil, xerrors.Errorf("received no proofs back from generate window post")
 		}
 
@@ -556,6 +594,23 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di dline.Info, ts *ty
 	return posts, nil
 }
 
+// verifyPost checks a generated proof like the miner actor would
+func (s *WindowPoStScheduler) verifyPost(ctx context.Context, mid abi.ActorID, rand abi.PoStRandomness, proofs []proof.PoStProof, sinfos []proof.SectorInfo) error {
+	ok, err := s.verifier.VerifyWindowPoSt(ctx, proof.WindowPoStVerifyInfo{
+		Randomness:        rand,
+		Proofs:            proofs,
+		ChallengedSectors: sinfos,
+		Prover:            mid,
+	})
+	if err != nil {
+		return xerrors.Errorf("verifying window post: %w", err)
+	}
+	if !ok {
+		return xerrors.Errorf("invalid window post proof (compute error?)")
+	}
+	return nil
+}
+
 func (s *WindowPoStScheduler) batchPartitions(partitions []api.Partition) ([][]api.Partition, error) {
 	// Get the number of sectors allowed in a partition, for this proof size
 	sectorsPerPartition, err := builtin0.PoStProofWindowPoStPartitionSectors(s.proofType)
@@ -636,7 +691,21 @@ func (s *WindowPoStScheduler) sectorsForProof(ctx context.Context, goodSectors,
 	return proofSectors, nil
 }
 
-func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.SubmitWindowedPoStParams) (*types.SignedMessage, error) {
+func (s *WindowPoStScheduler) submitPost(ctx context.Context, di dline.Info, proof *miner.SubmitWindowedPoStParams) (*types.SignedMessage, error) {
+	sm, err := s.pushPost(ctx, proof, 0, abi.TokenAmount{})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.watchPost(di, proof, sm, 0)
+
+	return sm, nil
+}
+
+// pushPost sends a SubmitWindowedPoSt message, the gas limit is estimated
+// when gasLimit is 0. The fee is limited to MaxWindowPoStGasFee unless maxFee
+// is set, which marks the PoSt as urgent and raises the gas premium.
+func (s *WindowPoStScheduler) pushPost(ctx context.Context, proof *miner.SubmitWindowedPoStParams, gasLimit int64, maxFee abi.TokenAmount) (*types.SignedMessage, error) {
 	ctx, span := trace.StartSpan(ctx, "storage.commitPost")
 	defer span.End()
 
@@ -648,39 +717,193 @@ func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.Submi
 	}
 
 	msg := &types.Message{
-		To:     s.actor,
-		From:   s.worker,
-		Method: builtin0.MethodsMiner.SubmitWindowedPoSt,
-		Params: enc,
-		Value:  types.NewInt(0),
-	}
-	spec := &api.MessageSendSpec{MaxFee: abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)}
+		To:       s.actor,
+		From:     s.worker,
+		Method:   builtin0.MethodsMiner.SubmitWindowedPoSt,
+		Params:   enc,
+		Value:    types.NewInt(0),
+		GasLimit: gasLimit,
+	}
+	urgent := !maxFee.Nil()
+	if !urgent {
+		maxFee = abi.TokenAmount(s.feeCfg.MaxWindowPoStGasFee)
+	}
+	spec := &api.MessageSendSpec{MaxFee: maxFee}
 	s.setSender(ctx, msg, spec)
 
+	if urgent && !msg.GasPremium.Nil() {
+		msg.GasPremium = big.Mul(msg.GasPremium, big.NewInt(urgentFeeMultiplier))
+		msg.GasFeeCap = big.Max(big.Mul(msg.GasFeeCap, big.NewInt(urgentFeeMultiplier)), msg.GasPremium)
+	}
+
 	// TODO: consider maybe caring about the output
-	sm, err := s.api.MpoolPushMessage(ctx, msg, spec)
+	sm, err := s.api.MpoolPushMessage(syncgate.Wait(ctx), msg, spec)
 
 	if err != nil {
+		s.recordPost(ctx, "push_failed")
 		return nil, xerrors.Errorf("pushing message to mpool: %w", err)
 	}
 
 	log.Infof("Submitted window post: %s", sm.Cid())
 
-	go func() {
-		rec, err := s.api.StateWaitMsg(context.TODO(), sm.Cid(), build.MessageConfidence)
+	return sm, nil
+}
+
+const (
+	// maxPostResubmits limits how often a PoSt message which failed on chain
+	// is resubmitted
+	maxPostResubmits = 3
+	// postResubmitMargin is the number of epochs a resubmitted PoSt needs
+	// to land before the challenge window closes
+	postResubmitMargin = abi.ChainEpoch(2 * build.MessageConfidence)
+)
+
+// postFailure is what can be done about a PoSt message which failed on chain
+type postFailure int
+
+const (
+	postFailureFatal    postFailure = iota // retrying won't help
+	postFailureGas                         // the message ran out of gas
+	postFailureState                       // partition state changed since the proof was generated
+	postFailureResubmit                    // the message can be sent again as-is
+)
+
+func diagnosePostFailure(code exitcode.ExitCode) postFailure {
+	switch code {
+	case exitcode.SysErrOutOfGas:
+		return postFailureGas
+	case exitcode.ErrIllegalArgument, exitcode.ErrIllegalState, exitcode.ErrNotFound:
+		// sectors faulted, recovered or were terminated since the proof was
+		// generated, or a partition was already proven
+		return postFailureState
+	case exitcode.SysErrInsufficientFunds, exitcode.ErrInsufficientFunds:
+		// setSender picks a funded address again
+		return postFailureResubmit
+	default:
+		return postFailureFatal
+	}
+}
+
+// recordPost counts a window PoSt message in MinerPoStSubmissions
+func (s *WindowPoStScheduler) recordPost(ctx context.Context, result string) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(metrics.MinerID, s.actor.String()),
+		tag.Upsert(metrics.PoStResult, result),
+	}, metrics.MinerPoStSubmissions.M(1))
+}
+
+// watchPost waits for a PoSt message to land. When it failed, the failure is
+// diagnosed from the receipt and the PoSt is resubmitted, as long as there
+// is time left in the challenge window.
+func (s *WindowPoStScheduler) watchPost(di dline.Info, proof *miner.SubmitWindowedPoStParams, sm *types.SignedMessage, attempt int) {
+	ctx := context.TODO()
+
+	rec, err := s.api.StateWaitMsg(ctx, sm.Cid(), build.MessageConfidence)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if rec.Receipt.ExitCode == 0 {
+		s.recordPost(ctx, "success")
+		return
+	}
+	s.recordPost(ctx, "failed")
+
+	log.Errorf("Submitting window post %s failed: exit %d", sm.Cid(), rec.Receipt.ExitCode)
+
+	failure := diagnosePostFailure(rec.Receipt.ExitCode)
+	if failure == postFailureFatal {
+		return
+	}
+	if attempt >= maxPostResubmits {
+		log.Errorw("not resubmitting window post, too many attempts", "deadline", di.Index, "attempts", attempt+1)
+		return
+	}
+
+	ts, err := s.api.ChainHead(ctx)
+	if err != nil {
+		log.Errorf("getting chain head: %+v", err)
+		return
+	}
+	if ts.Height()+postResubmitMargin >= di.Close {
+		log.Errorw("not resubmitting window post, challenge window closing", "deadline", di.Index, "height", ts.Height(), "close", di.Close)
+		return
+	}
+
+	var gasLimit int64
+	posts := []miner.SubmitWindowedPoStParams{*proof}
+
+	switch failure {
+	case postFailureGas:
+		// the estimate was too low, make sure the new one is higher
+		gasLimit = sm.Message.GasLimit + sm.Message.GasLimit/4
+		log.Warnw("window post ran out of gas, resubmitting with more gas", "deadline", di.Index, "gasLimit", gasLimit)
+	case postFailureState:
+		log.Warnw("window post failed, re-scanning partitions", "deadline", di.Index, "exit", rec.Receipt.ExitCode)
+
+		// partitions proven by another message in the meantime are skipped
+		deadlines, err := s.api.StateMinerDeadlines(ctx, s.actor, ts.Key())
 		if err != nil {
-			log.Error(err)
+			log.Errorf("getting miner deadlines: %+v", err)
+			return
+		}
+		if di.Index >= uint64(len(deadlines)) {
+			log.Errorf("deadline %d out of range (%d deadlines)", di.Index, len(deadlines))
 			return
 		}
 
-		if rec.Receipt.ExitCode == 0 {
+		all, err := s.generateDuePosts(ctx, di, ts, deadlines[di.Index].PostSubmissions)
+		if err != nil {
+			log.Errorf("re-generating window post: %+v", err)
+			return
+		}
+		posts = postsForPartitions(all, proof.Partitions)
+		if len(posts) == 0 {
+			log.Warnw("nothing left to prove in failed window post partitions", "deadline", di.Index)
 			return
 		}
+	case postFailureResubmit:
+		log.Warnw("window post failed, resubmitting", "deadline", di.Index, "exit", rec.Receipt.ExitCode)
+	}
 
-		log.Errorf("Submitting window post %s failed: exit %d", sm.Cid(), rec.Receipt.ExitCode)
-	}()
+	for i := range posts {
+		post := &posts[i]
+		nsm, err := s.pushPost(ctx, post, gasLimit, abi.TokenAmount{})
+		if err != nil {
+			log.Errorf("resubmitting window post: %+v", err)
+			continue
+		}
 
-	return sm, nil
+		journal.J.RecordEvent(s.evtTypes[evtTypeWdPoStProofs], func() interface{} {
+			return &WdPoStProofsProcessedEvt{
+				evtCommon:  s.getEvtCommon(nil),
+				Partitions: post.Partitions,
+				MessageCID: nsm.Cid(),
+			}
+		})
+
+		go s.watchPost(di, post, nsm, attempt+1)
+	}
+}
+
+// postsForPartitions returns the posts proving any of the given partitions
+func postsForPartitions(posts []miner.SubmitWindowedPoStParams, partitions []miner.PoStPartition) []miner.SubmitWindowedPoStParams {
+	want := map[uint64]struct{}{}
+	for _, p := range partitions {
+		want[p.Index] = struct{}{}
+	}
+
+	var out []miner.SubmitWindowedPoStParams
+	for _, post := range posts {
+		for _, p := range post.Partitions {
+			if _, ok := want[p.Index]; ok {
+				out = append(out, post)
+				break
+			}
+		}
+	}
+	return out
 }
 
 func (s *WindowPoStScheduler) setSender(ctx context.Context, msg *types.Message, spec *api.MessageSendSpec) {
@@ -3,7 +3,9 @@ package storage
 import (
 	"bytes"
 	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/go-state-types/dline"
+	"github.com/filecoin-project/go-state-types/exitcode"
 	"github.com/filecoin-project/go-state-types/network"
 	builtin0 "github.com/filecoin-project/specs-actors/actors/builtin"
 	miner0 "github.com/filecoin-project/specs-actors/actors/builtin/miner"
@@ -24,11 +27,18 @@ import (
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
 )
 
 type mockStorageMinerAPI struct {
 	partitions     []api.Partition
 	pushedMessages chan *types.Message
+
+	// exit codes of waited messages, in order, 0 once used up
+	lk        sync.Mutex
+	exitCodes []exitcode.ExitCode
+	head      *types.TipSet
+	deadlines []api.Deadline
 }
 
 func newMockStorageMinerAPI() *mockStorageMinerAPI {
@@ -60,6 +70,31 @@ func (m *mockStorageMinerAPI) setPartitions(ps []api.Partition) {
 	m.partitions = append(m.partitions, ps...)
 }
 
+// setProven marks partitions of the deadline as proven
+func (m *mockStorageMinerAPI) setProven(dlIdx uint64, partitions ...uint64) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for len(m.deadlines) <= int(dlIdx) {
+		m.deadlines = append(m.deadlines, api.Deadline{PostSubmissions: bitfield.New()})
+	}
+	for _, p := range partitions {
+		m.deadlines[dlIdx].PostSubmissions.Set(p)
+	}
+}
+
+func (m *mockStorageMinerAPI) StateMinerDeadlines(ctx context.Context, maddr address.Address, tok types.TipSetKey) ([]api.Deadline, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := make([]api.Deadline, miner0.WPoStPeriodDeadlines)
+	for i := range out {
+		out[i].PostSubmissions = bitfield.New()
+	}
+	copy(out, m.deadlines)
+	return out, nil
+}
+
 func (m *mockStorageMinerAPI) StateMinerPartitions(ctx context.Context, a address.Address, dlIdx uint64, tsk types.TipSetKey) ([]api.Partition, error) {
 	return m.partitions, nil
 }
@@ -85,14 +120,32 @@ func (m *mockStorageMinerAPI) MpoolPushMessage(ctx context.Context, message *typ
 	}, nil
 }
 
+func (m *mockStorageMinerAPI) setExitCodes(codes ...exitcode.ExitCode) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.exitCodes = codes
+}
+
 func (m *mockStorageMinerAPI) StateWaitMsg(ctx context.Context, cid cid.Cid, confidence uint64) (*api.MsgLookup, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	var code exitcode.ExitCode
+	if len(m.exitCodes) > 0 {
+		code, m.exitCodes = m.exitCodes[0], m.exitCodes[1:]
+	}
+
 	return &api.MsgLookup{
 		Receipt: types.MessageReceipt{
-			ExitCode: 0,
+			ExitCode: code,
 		},
 	}, nil
 }
 
+func (m *mockStorageMinerAPI) ChainHead(ctx context.Context) (*types.TipSet, error) {
+	return m.head, nil
+}
+
 type mockProver struct {
 }
 
@@ -197,6 +250,216 @@ func TestWDPostDoPost(t *testing.T) {
 	}
 }
 
+type mockVerifier struct {
+	ffiwrapper.Verifier
+	failures int
+	calls    int
+}
+
+func (m *mockVerifier) VerifyWindowPoSt(ctx context.Context, info proof0.WindowPoStVerifyInfo) (bool, error) {
+	m.calls++
+	return m.calls > m.failures, nil
+}
+
+// TestWDPostVerify checks that proofs which fail local verification are
+// recomputed, and aren't submitted
+func TestWDPostVerify(t *testing.T) {
+	ctx := context.Background()
+
+	proofType := abi.RegisteredPoStProof_StackedDrgWindow2KiBV1
+	sectors := bitfield.New()
+	sectors.Set(0)
+
+	mockStgMinerAPI := newMockStorageMinerAPI()
+	mockStgMinerAPI.setPartitions([]api.Partition{{
+		AllSectors:        sectors,
+		FaultySectors:     bitfield.New(),
+		RecoveringSectors: bitfield.New(),
+		LiveSectors:       sectors,
+		ActiveSectors:     sectors,
+	}})
+
+	newScheduler := func(verif *mockVerifier) *WindowPoStScheduler {
+		return &WindowPoStScheduler{
+			api:          mockStgMinerAPI,
+			prover:       &mockProver{},
+			verifier:     verif,
+			verifyPoSt:   true,
+			faultTracker: &mockFaultTracker{},
+			proofType:    proofType,
+			actor:        tutils.NewIDAddr(t, 100),
+			worker:       tutils.NewIDAddr(t, 101),
+		}
+	}
+
+	di := dline.Info{
+		WPoStPeriodDeadlines:   miner0.WPoStPeriodDeadlines,
+		WPoStProvingPeriod:     miner0.WPoStProvingPeriod,
+		WPoStChallengeWindow:   miner0.WPoStChallengeWindow,
+		WPoStChallengeLookback: miner0.WPoStChallengeLookback,
+		FaultDeclarationCutoff: miner0.FaultDeclarationCutoff,
+	}
+
+	verif := &mockVerifier{failures: 2}
+	posts, err := newScheduler(verif).runPost(ctx, di, mockTipSet(t))
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	require.Len(t, posts[0].Partitions, 1)
+	require.Equal(t, 3, verif.calls)
+
+	verif = &mockVerifier{failures: 100}
+	_, err = newScheduler(verif).runPost(ctx, di, mockTipSet(t))
+	require.Error(t, err)
+	require.Equal(t, 5, verif.calls)
+}
+
+// TestWDPostDuePartitions checks that partitions which were proven already
+// are skipped when forcing a PoSt
+func TestWDPostDuePartitions(t *testing.T) {
+	ctx := context.Background()
+
+	sectors := bitfield.New()
+	sectors.Set(0)
+	partition := api.Partition{
+		AllSectors:        sectors,
+		FaultySectors:     bitfield.New(),
+		RecoveringSectors: bitfield.New(),
+		LiveSectors:       sectors,
+		ActiveSectors:     sectors,
+	}
+
+	mockStgMinerAPI := newMockStorageMinerAPI()
+	mockStgMinerAPI.setPartitions([]api.Partition{partition, partition, partition})
+
+	scheduler := &WindowPoStScheduler{
+		api:          mockStgMinerAPI,
+		prover:       &mockProver{},
+		faultTracker: &mockFaultTracker{},
+		proofType:    abi.RegisteredPoStProof_StackedDrgWindow2KiBV1,
+		actor:        tutils.NewIDAddr(t, 100),
+		worker:       tutils.NewIDAddr(t, 101),
+	}
+
+	di := dline.Info{
+		WPoStPeriodDeadlines:   miner0.WPoStPeriodDeadlines,
+		WPoStProvingPeriod:     miner0.WPoStProvingPeriod,
+		WPoStChallengeWindow:   miner0.WPoStChallengeWindow,
+		WPoStChallengeLookback: miner0.WPoStChallengeLookback,
+		FaultDeclarationCutoff: miner0.FaultDeclarationCutoff,
+	}
+
+	proven := bitfield.New()
+	proven.Set(0)
+	proven.Set(2)
+
+	posts, err := scheduler.generateDuePosts(ctx, di, mockTipSet(t), proven)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	require.Len(t, posts[0].Partitions, 1)
+	require.Equal(t, uint64(1), posts[0].Partitions[0].Index)
+
+	proven.Set(1)
+	posts, err = scheduler.generateDuePosts(ctx, di, mockTipSet(t), proven)
+	require.NoError(t, err)
+	require.Empty(t, posts)
+}
+
+func TestWDPostResubmit(t *testing.T) {
+	ctx := context.Background()
+
+	proofType := abi.RegisteredPoStProof_StackedDrgWindow2KiBV1
+	sectors := bitfield.New()
+	sectors.Set(0)
+
+	mockStgMinerAPI := newMockStorageMinerAPI()
+	mockStgMinerAPI.head = mockTipSet(t)
+	mockStgMinerAPI.setPartitions([]api.Partition{{
+		AllSectors:        sectors,
+		FaultySectors:     bitfield.New(),
+		RecoveringSectors: bitfield.New(),
+		LiveSectors:       sectors,
+		ActiveSectors:     sectors,
+	}})
+
+	scheduler := &WindowPoStScheduler{
+		api:          mockStgMinerAPI,
+		prover:       &mockProver{},
+		faultTracker: &mockFaultTracker{},
+		proofType:    proofType,
+		actor:        tutils.NewIDAddr(t, 100),
+		worker:       tutils.NewIDAddr(t, 101),
+	}
+
+	di := dline.Info{
+		Close:                  100,
+		WPoStPeriodDeadlines:   miner0.WPoStPeriodDeadlines,
+		WPoStProvingPeriod:     miner0.WPoStProvingPeriod,
+		WPoStChallengeWindow:   miner0.WPoStChallengeWindow,
+		WPoStChallengeLookback: miner0.WPoStChallengeLookback,
+		FaultDeclarationCutoff: miner0.FaultDeclarationCutoff,
+	}
+
+	posts, err := scheduler.generatePosts(ctx, di, mockTipSet(t))
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+
+	noMorePushes := func() {
+		select {
+		case msg := <-mockStgMinerAPI.pushedMessages:
+			t.Fatalf("unexpected message pushed: %v", msg)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// out of gas, then partition state changed, then a failure which can't
+	// be fixed by resubmitting
+	mockStgMinerAPI.setExitCodes(exitcode.SysErrOutOfGas, exitcode.ErrIllegalState, exitcode.ErrForbidden)
+
+	go func() {
+		_, err := scheduler.submitPost(ctx, di, &posts[0])
+		require.NoError(t, err)
+	}()
+
+	msg := <-mockStgMinerAPI.pushedMessages
+	require.Equal(t, int64(100), msg.GasLimit)
+
+	msg = <-mockStgMinerAPI.pushedMessages
+	require.Equal(t, int64(125), msg.GasLimit) // bumped
+
+	msg = <-mockStgMinerAPI.pushedMessages
+	require.Equal(t, int64(100), msg.GasLimit) // re-generated and re-estimated
+	var params miner.SubmitWindowedPoStParams
+	require.NoError(t, params.UnmarshalCBOR(bytes.NewReader(msg.Params)))
+	require.Len(t, params.Partitions, 1)
+
+	noMorePushes()
+
+	// no time left in the challenge window
+	di.Close = 2
+	mockStgMinerAPI.setExitCodes(exitcode.SysErrOutOfGas)
+
+	go func() {
+		_, err := scheduler.submitPost(ctx, di, &posts[0])
+		require.NoError(t, err)
+	}()
+
+	<-mockStgMinerAPI.pushedMessages
+	noMorePushes()
+
+	// the partition was proven by another message, nothing to resubmit
+	di.Close = 100
+	mockStgMinerAPI.setProven(di.Index, 0)
+	mockStgMinerAPI.setExitCodes(exitcode.ErrIllegalState)
+
+	go func() {
+		_, err := scheduler.submitPost(ctx, di, &posts[0])
+		require.NoError(t, err)
+	}()
+
+	<-mockStgMinerAPI.pushedMessages
+	noMorePushes()
+}
+
 func mockTipSet(t *testing.T) *types.TipSet {
 	minerAct := tutils.NewActorAddr(t, "miner")
 	c, err := cid.Decode("QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH")
@@ -223,10 +486,6 @@ func (m *mockStorageMinerAPI) StateCall(ctx context.Context, message *types.Mess
 	panic("implement me")
 }
 
-func (m *mockStorageMinerAPI) StateMinerDeadlines(ctx context.Context, maddr address.Address, tok types.TipSetKey) ([]api.Deadline, error) {
-	panic("implement me")
-}
-
 func (m *mockStorageMinerAPI) StateSectorPreCommitInfo(ctx context.Context, address address.Address, number abi.SectorNumber, key types.TipSetKey) (miner.SectorPreCommitOnChainInfo, error) {
 	panic("implement me")
 }
@@ -298,14 +557,12 @@ func (m *mockStorageMinerAPI) GasEstimateMessageGas(ctx context.Context, message
 	msg := *message
 	msg.GasFeeCap = big.NewInt(1)
 	msg.GasPremium = big.NewInt(1)
-	msg.GasLimit = 2
+	if msg.GasLimit == 0 {
+		msg.GasLimit = 100
+	}
 	return &msg, nil
 }
 
-func (m *mockStorageMinerAPI) ChainHead(ctx context.Context) (*types.TipSet, error) {
-	panic("implement me")
-}
-
 func (m *mockStorageMinerAPI) ChainNotify(ctx context.Context) (<-chan []*api.HeadChange, error) {
 	panic("implement me")
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	sectorstorage "github.com/filecoin-project/lotus/extern/sector-storage"
+	"github.com/filecoin-project/lotus/extern/sector-storage/ffiwrapper"
 	"github.com/filecoin-project/lotus/journal"
 	"github.com/filecoin-project/lotus/node/config"
 
@@ -28,6 +29,8 @@ type WindowPoStScheduler struct {
 	api              storageMinerApi
 	feeCfg           config.MinerFeeConfig
 	prover           storage.Prover
+	verifier         ffiwrapper.Verifier
+	verifyPoSt       bool
 	faultTracker     sectorstorage.FaultTracker
 	proofType        abi.RegisteredPoStProof
 	partitionSectors uint64
@@ -43,11 +46,13 @@ type WindowPoStScheduler struct {
 
 	evtTypes [4]journal.EventType
 
+	force chan forceSubmitReq
+
 	// failed abi.ChainEpoch // eps
 	// failLk sync.Mutex
 }
 
-func NewWindowedPoStScheduler(api storageMinerApi, fc config.MinerFeeConfig, sb storage.Prover, ft sectorstorage.FaultTracker, actor address.Address, worker address.Address) (*WindowPoStScheduler, error) {
+func NewWindowedPoStScheduler(api storageMinerApi, fc config.MinerFeeConfig, pc config.ProvingConfig, sb storage.Prover, verif ffiwrapper.Verifier, ft sectorstorage.FaultTracker, actor address.Address, worker address.Address) (*WindowPoStScheduler, error) {
 	mi, err := api.StateMinerInfo(context.TODO(), actor, types.EmptyTSK)
 	if err != nil {
 		return nil, xerrors.Errorf("getting sector size: %w", err)
@@ -62,12 +67,15 @@ func NewWindowedPoStScheduler(api storageMinerApi, fc config.MinerFeeConfig, sb
 		api:              api,
 		feeCfg:           fc,
 		prover:           sb,
+		verifier:         verif,
+		verifyPoSt:       pc.VerifyWindowPoSt,
 		faultTracker:     ft,
 		proofType:        rt,
 		partitionSectors: mi.WindowPoStPartitionSectors,
 
 		actor:  actor,
 		worker: worker,
+		force:  make(chan forceSubmitReq),
 		evtTypes: [...]journal.EventType{
 			evtTypeWdPoStScheduler:  journal.J.RegisterEventType("wdpost", "scheduler"),
 			evtTypeWdPoStProofs:     journal.J.RegisterEventType("wdpost", "proofs_processed"),
@@ -157,6 +165,8 @@ func (s *WindowPoStScheduler) Run(ctx context.Context) {
 			}
 
 			span.End()
+		case req := <-s.force:
+			s.forceSubmit(ctx, req)
 		case <-ctx.Done():
 			return
 		}
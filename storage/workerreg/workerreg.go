@@ -0,0 +1,234 @@
+package workerreg
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("workerreg")
+
+var dsPrefix = datastore.NewKey("/workerreg")
+
+var validID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-]{0,63}$`)
+
+// Registry keeps the workers which announced themselves to the miner. With
+// approval required, a worker only connects once it's accepted, e.g. with
+// 'lotus-miner sealing registrations accept', and is disconnected when it's
+// denied.
+type Registry struct {
+	ds              datastore.Batching
+	requireApproval bool
+
+	lk    sync.Mutex
+	conns map[string][]io.Closer
+}
+
+func New(ds dtypes.MetadataDS, requireApproval bool) *Registry {
+	return &Registry{
+		ds:              namespace.Wrap(ds, dsPrefix),
+		requireApproval: requireApproval,
+		conns:           map[string][]io.Closer{},
+	}
+}
+
+// RequireApproval returns whether workers have to be accepted to connect, they
+// then connect by their registration ID, see Accepted
+func (r *Registry) RequireApproval() bool {
+	return r.requireApproval
+}
+
+// Register records or updates the registration of a worker and returns its
+// state. New workers are pending when approval is required, and accepted
+// otherwise.
+func (r *Registry) Register(reg api.WorkerRegistration) (api.WorkerRegState, error) {
+	if !validID.MatchString(reg.ID) {
+		return "", xerrors.Errorf("invalid worker ID %q", reg.ID)
+	}
+	if reg.URL == "" {
+		return "", xerrors.New("worker registration without a URL")
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	now := time.Now()
+	prev, err := r.get(reg.ID)
+	switch {
+	case err == datastore.ErrNotFound:
+		reg.Registered = now
+		reg.State = api.WorkerRegPending
+		if !r.requireApproval {
+			reg.State = api.WorkerRegAccepted
+		}
+		log.Infow("worker registered", "id", reg.ID, "hostname", reg.Hostname, "url", reg.URL, "state", reg.State)
+	case err != nil:
+		return "", err
+	default:
+		reg.Registered = prev.Registered
+		reg.State = prev.State
+	}
+	reg.LastSeen = now
+
+	if err := r.put(reg); err != nil {
+		return "", err
+	}
+	return reg.State, nil
+}
+
+// List returns the registered workers, oldest first
+func (r *Registry) List() ([]api.WorkerRegistration, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	return r.list()
+}
+
+// Accept lets a worker connect
+func (r *Registry) Accept(id string) error {
+	return r.setState(id, api.WorkerRegAccepted)
+}
+
+// Deny stops a worker from connecting, and closes its connections, which drops
+// it from the scheduler. It exits on its next registration.
+func (r *Registry) Deny(id string) error {
+	if err := r.setState(id, api.WorkerRegDenied); err != nil {
+		return err
+	}
+
+	r.lk.Lock()
+	conns := r.conns[id]
+	delete(r.conns, id)
+	r.lk.Unlock()
+
+	for _, c := range conns {
+		if err := c.Close(); err != nil {
+			log.Warnf("closing connection of a denied worker: %s", err)
+		}
+	}
+	return nil
+}
+
+// Accepted returns the registration with the ID, or an error when the worker
+// isn't accepted
+func (r *Registry) Accepted(id string) (api.WorkerRegistration, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	reg, err := r.get(id)
+	if err == datastore.ErrNotFound {
+		return api.WorkerRegistration{}, xerrors.Errorf("no worker registration %s", id)
+	}
+	if err != nil {
+		return api.WorkerRegistration{}, err
+	}
+	if reg.State != api.WorkerRegAccepted {
+		return api.WorkerRegistration{}, xerrors.Errorf("worker %s is %s, see 'lotus-miner sealing registrations'", id, reg.State)
+	}
+	return reg, nil
+}
+
+// Track records a connection to the registered worker, which is closed when
+// the worker is denied
+func (r *Registry) Track(id string, c io.Closer) {
+	r.lk.Lock()
+	reg, err := r.get(id)
+	if err != nil || reg.State != api.WorkerRegDenied {
+		r.conns[id] = append(r.conns[id], c)
+		r.lk.Unlock()
+		return
+	}
+	r.lk.Unlock()
+
+	// denied while the worker connected
+	if err := c.Close(); err != nil {
+		log.Warnf("closing connection of a denied worker: %s", err)
+	}
+}
+
+func (r *Registry) setState(id string, st api.WorkerRegState) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	reg, err := r.get(id)
+	if err == datastore.ErrNotFound {
+		return xerrors.Errorf("no worker registration %s", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	reg.State = st
+	if err := r.put(reg); err != nil {
+		return err
+	}
+	log.Infow("worker registration changed", "id", id, "hostname", reg.Hostname, "state", st)
+	return nil
+}
+
+// list must be called with r.lk held
+func (r *Registry) list() ([]api.WorkerRegistration, error) {
+	res, err := r.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying worker registrations: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.WorkerRegistration
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, xerrors.Errorf("reading worker registrations: %w", e.Error)
+		}
+
+		var reg api.WorkerRegistration
+		if err := json.Unmarshal(e.Value, &reg); err != nil {
+			log.Errorw("decoding worker registration", "key", e.Key, "error", err)
+			continue
+		}
+		out = append(out, reg)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Registered.Before(out[j].Registered)
+	})
+	return out, nil
+}
+
+// get must be called with r.lk held, it returns datastore.ErrNotFound for
+// unknown workers
+func (r *Registry) get(id string) (api.WorkerRegistration, error) {
+	b, err := r.ds.Get(datastore.NewKey(id))
+	if err != nil {
+		return api.WorkerRegistration{}, err
+	}
+
+	var reg api.WorkerRegistration
+	if err := json.Unmarshal(b, &reg); err != nil {
+		return api.WorkerRegistration{}, xerrors.Errorf("decoding worker registration %s: %w", id, err)
+	}
+	return reg, nil
+}
+
+// put must be called with r.lk held
+func (r *Registry) put(reg api.WorkerRegistration) error {
+	b, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	if err := r.ds.Put(datastore.NewKey(reg.ID), b); err != nil {
+		return xerrors.Errorf("saving worker registration %s: %w", reg.ID, err)
+	}
+	return nil
+}
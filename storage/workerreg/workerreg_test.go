@@ -0,0 +1,86 @@
+package workerreg
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New(dss.MutexWrap(datastore.NewMapDatastore()), true)
+
+	reg := api.WorkerRegistration{
+		ID:       "3b0d6c4e-8a6f-4c1b-9e55-0c1f3e9f2a11",
+		Hostname: "worker1",
+		URL:      "ws://10.0.0.2:3456/rpc/v0",
+		Tasks:    []sealtasks.TaskType{sealtasks.TTPreCommit1},
+	}
+
+	_, err := r.Register(api.WorkerRegistration{ID: "../x", URL: reg.URL})
+	require.Error(t, err)
+
+	st, err := r.Register(reg)
+	require.NoError(t, err)
+	require.Equal(t, api.WorkerRegPending, st)
+	_, err = r.Accepted(reg.ID)
+	require.Error(t, err)
+
+	require.NoError(t, r.Accept(reg.ID))
+	acc, err := r.Accepted(reg.ID)
+	require.NoError(t, err)
+	require.Equal(t, reg.URL, acc.URL)
+	_, err = r.Accepted("unknown")
+	require.Error(t, err)
+
+	c := &testConn{}
+	r.Track(reg.ID, c)
+
+	// registering again keeps the state, and updates the info
+	reg.Hostname = "worker1.local"
+	st, err = r.Register(reg)
+	require.NoError(t, err)
+	require.Equal(t, api.WorkerRegAccepted, st)
+
+	// denying closes the connections of the worker
+	require.False(t, c.closed)
+	require.NoError(t, r.Deny(reg.ID))
+	require.True(t, c.closed)
+	st, err = r.Register(reg)
+	require.NoError(t, err)
+	require.Equal(t, api.WorkerRegDenied, st)
+	_, err = r.Accepted(reg.ID)
+	require.Error(t, err)
+
+	late := &testConn{}
+	r.Track(reg.ID, late)
+	require.True(t, late.closed)
+
+	regs, err := r.List()
+	require.NoError(t, err)
+	require.Len(t, regs, 1)
+	require.Equal(t, "worker1.local", regs[0].Hostname)
+	require.False(t, regs[0].Registered.IsZero())
+
+	require.Error(t, r.Accept("unknown"))
+
+	// without approval new workers are accepted right away
+	open := New(dss.MutexWrap(datastore.NewMapDatastore()), false)
+	st, err = open.Register(reg)
+	require.NoError(t, err)
+	require.Equal(t, api.WorkerRegAccepted, st)
+	require.False(t, open.RequireApproval())
+}
+
+type testConn struct {
+	closed bool
+}
+
+func (c *testConn) Close() error {
+	c.closed = true
+	return nil
+}
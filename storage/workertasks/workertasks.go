@@ -0,0 +1,172 @@
+package workertasks
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("workertasks")
+
+var overridesKey = datastore.NewKey("/workertasks/overrides")
+
+// Scheduler is where the task affinity applies, a *sectorstorage.Manager
+type Scheduler interface {
+	SetTaskAffinity(storiface.TaskAffinity)
+}
+
+// Affinity pins task types to workers with Workers.Tasks from the config,
+// and keeps the task types enabled or disabled on single workers with
+// 'lotus-miner sealing workers tasks'
+type Affinity struct {
+	ds    datastore.Batching
+	sched Scheduler
+
+	groups map[string][]string
+	tasks  map[sealtasks.TaskType][]string
+
+	lk        sync.Mutex
+	overrides map[string]map[sealtasks.TaskType]bool
+}
+
+// New applies the configured task affinity with the saved overrides to the
+// scheduler. Groups are named sets of hostnames, tasks maps task type names
+// to hostnames or groups.
+func New(ds dtypes.MetadataDS, sched Scheduler, groups map[string][]string, tasks map[string][]string) (*Affinity, error) {
+	a := &Affinity{
+		ds:        ds,
+		sched:     sched,
+		groups:    groups,
+		tasks:     map[sealtasks.TaskType][]string{},
+		overrides: map[string]map[sealtasks.TaskType]bool{},
+	}
+
+	for name, hosts := range tasks {
+		tt, err := sealtasks.ParseTask(name)
+		if err != nil {
+			return nil, xerrors.Errorf("Workers.Tasks: %w", err)
+		}
+		a.tasks[tt] = hosts
+	}
+
+	b, err := ds.Get(overridesKey)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(b, &a.overrides); err != nil {
+			return nil, xerrors.Errorf("decoding worker task overrides: %w", err)
+		}
+	case datastore.ErrNotFound:
+	default:
+		return nil, xerrors.Errorf("loading worker task overrides: %w", err)
+	}
+
+	a.apply()
+	return a, nil
+}
+
+// Affinity returns the configured affinity with the overrides
+func (a *Affinity) Affinity() api.WorkerTaskAffinity {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	out := api.WorkerTaskAffinity{
+		Groups:    a.groups,
+		Tasks:     a.tasks,
+		Overrides: map[string]map[sealtasks.TaskType]bool{},
+	}
+	for host, tasks := range a.overrides {
+		out.Overrides[host] = map[sealtasks.TaskType]bool{}
+		for tt, enabled := range tasks {
+			out.Overrides[host][tt] = enabled
+		}
+	}
+	return out
+}
+
+// Set enables or disables task types on the workers with the hostname
+func (a *Affinity) Set(hostname string, tasks []sealtasks.TaskType, enabled bool) error {
+	if hostname == "" || len(tasks) == 0 {
+		return xerrors.New("expected a worker hostname and task types")
+	}
+
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if a.overrides[hostname] == nil {
+		a.overrides[hostname] = map[sealtasks.TaskType]bool{}
+	}
+	for _, tt := range tasks {
+		a.overrides[hostname][tt] = enabled
+	}
+	log.Infow("worker task types changed", "hostname", hostname, "tasks", tasks, "enabled", enabled)
+
+	return a.save()
+}
+
+// Reset removes the overrides of the task types on the workers with the
+// hostname, or all of them when no task types are given
+func (a *Affinity) Reset(hostname string, tasks []sealtasks.TaskType) error {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if len(tasks) == 0 {
+		delete(a.overrides, hostname)
+	}
+	for _, tt := range tasks {
+		delete(a.overrides[hostname], tt)
+	}
+	if len(a.overrides[hostname]) == 0 {
+		delete(a.overrides, hostname)
+	}
+
+	return a.save()
+}
+
+// save must be called with a.lk held
+func (a *Affinity) save() error {
+	b, err := json.Marshal(a.overrides)
+	if err != nil {
+		return err
+	}
+	if err := a.ds.Put(overridesKey, b); err != nil {
+		return xerrors.Errorf("saving worker task overrides: %w", err)
+	}
+
+	a.apply()
+	return nil
+}
+
+// apply must be called with a.lk held, or before a is shared
+func (a *Affinity) apply() {
+	ta := storiface.TaskAffinity{
+		Tasks:     map[sealtasks.TaskType][]string{},
+		Overrides: map[string]map[sealtasks.TaskType]bool{},
+	}
+	for tt, names := range a.tasks {
+		hosts := []string{}
+		for _, name := range names {
+			if group, ok := a.groups[name]; ok {
+				hosts = append(hosts, group...)
+				continue
+			}
+			hosts = append(hosts, name)
+		}
+		ta.Tasks[tt] = hosts
+	}
+	for host, tasks := range a.overrides {
+		ta.Overrides[host] = map[sealtasks.TaskType]bool{}
+		for tt, enabled := range tasks {
+			ta.Overrides[host][tt] = enabled
+		}
+	}
+
+	a.sched.SetTaskAffinity(ta)
+}
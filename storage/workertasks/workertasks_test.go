@@ -0,0 +1,59 @@
+package workertasks
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/lotus/extern/sector-storage/sealtasks"
+	"github.com/filecoin-project/lotus/extern/sector-storage/storiface"
+)
+
+type fakeSched struct {
+	affinity storiface.TaskAffinity
+}
+
+func (f *fakeSched) SetTaskAffinity(a storiface.TaskAffinity) {
+	f.affinity = a
+}
+
+func TestAffinity(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	groups := map[string][]string{"gpu": {"gpu1", "gpu2"}}
+
+	_, err := New(ds, &fakeSched{}, groups, map[string][]string{"PC3": {"gpu"}})
+	require.Error(t, err)
+
+	fs := &fakeSched{}
+	a, err := New(ds, fs, groups, map[string][]string{"C2": {"gpu"}, "pc1": {"storage1"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"gpu1", "gpu2"}, fs.affinity.Tasks[sealtasks.TTCommit2])
+	require.Equal(t, []string{"storage1"}, fs.affinity.Tasks[sealtasks.TTPreCommit1])
+
+	ok, _ := fs.affinity.Allowed("storage1", sealtasks.TTCommit2)
+	require.False(t, ok)
+	ok, _ = fs.affinity.Allowed("storage1", sealtasks.TTAddPiece)
+	require.True(t, ok, "task types which aren't pinned run anywhere")
+
+	require.NoError(t, a.Set("gpu2", []sealtasks.TaskType{sealtasks.TTCommit2}, false))
+	require.NoError(t, a.Set("storage1", []sealtasks.TaskType{sealtasks.TTCommit2}, true))
+	ok, _ = fs.affinity.Allowed("gpu2", sealtasks.TTCommit2)
+	require.False(t, ok)
+	ok, _ = fs.affinity.Allowed("storage1", sealtasks.TTCommit2)
+	require.True(t, ok)
+
+	// the overrides are kept across restarts
+	fs2 := &fakeSched{}
+	a2, err := New(ds, fs2, groups, map[string][]string{"C2": {"gpu"}})
+	require.NoError(t, err)
+	require.Equal(t, fs.affinity.Overrides, fs2.affinity.Overrides)
+
+	require.NoError(t, a2.Reset("gpu2", nil))
+	require.NoError(t, a2.Reset("storage1", []sealtasks.TaskType{sealtasks.TTCommit2}))
+	require.Empty(t, fs2.affinity.Overrides)
+	require.Empty(t, a2.Affinity().Overrides)
+
+	require.Error(t, a2.Set("", []sealtasks.TaskType{sealtasks.TTCommit2}, true))
+}
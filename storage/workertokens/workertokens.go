@@ -0,0 +1,299 @@
+package workertokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+)
+
+var log = logging.Logger("workertokens")
+
+var dsPrefix = datastore.NewKey("/workertokens")
+
+var ErrRevoked = xerrors.New("worker token was revoked")
+
+// Tokens keeps the API tokens issued to seal workers. Unlike the shared admin
+// token, each worker token can be revoked on its own, which also drops the
+// workers connected with it and fails further calls made with it, see Proxy.
+type Tokens struct {
+	ds datastore.Batching
+
+	lk       sync.Mutex
+	tokens   map[string]api.WorkerToken // by ID
+	lastUsed map[string]time.Time
+	conns    map[string][]io.Closer
+}
+
+func New(ds dtypes.MetadataDS) (*Tokens, error) {
+	t := &Tokens{
+		ds:       namespace.Wrap(ds, dsPrefix),
+		tokens:   map[string]api.WorkerToken{},
+		lastUsed: map[string]time.Time{},
+		conns:    map[string][]io.Closer{},
+	}
+
+	res, err := t.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying worker tokens: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("iterating worker tokens: %w", r.Error)
+		}
+		var wt api.WorkerToken
+		if err := json.Unmarshal(r.Value, &wt); err != nil {
+			return nil, xerrors.Errorf("decoding worker token %s: %w", r.Key, err)
+		}
+		t.tokens[wt.ID] = wt
+	}
+
+	return t, nil
+}
+
+// Create records a new token for the named worker, the token itself is
+// signed by the caller with the returned ID
+func (t *Tokens) Create(name string, perms []auth.Permission) (api.WorkerToken, error) {
+	if strings.TrimSpace(name) == "" {
+		return api.WorkerToken{}, xerrors.New("worker tokens need a name")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return api.WorkerToken{}, xerrors.Errorf("generating token ID: %w", err)
+	}
+
+	wt := api.WorkerToken{
+		ID:      hex.EncodeToString(id),
+		Name:    name,
+		Perms:   perms,
+		Created: time.Now(),
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if err := t.put(wt); err != nil {
+		return api.WorkerToken{}, err
+	}
+	log.Infow("worker token created", "id", wt.ID, "name", name, "perms", perms)
+	return wt, nil
+}
+
+// Check returns an error for tokens which were revoked, or which aren't
+// known, e.g. created for another miner with the same API secret
+func (t *Tokens) Check(id string) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	wt, ok := t.tokens[id]
+	if !ok {
+		return xerrors.Errorf("unknown worker token %s", id)
+	}
+	if !wt.Revoked.IsZero() {
+		return ErrRevoked
+	}
+	t.lastUsed[id] = time.Now()
+	return nil
+}
+
+// Track records a worker connection made with the token, which is closed
+// when the token is revoked
+func (t *Tokens) Track(id string, c io.Closer) {
+	t.lk.Lock()
+	if wt, ok := t.tokens[id]; !ok || wt.Revoked.IsZero() {
+		t.conns[id] = append(t.conns[id], c)
+		t.lk.Unlock()
+		return
+	}
+	t.lk.Unlock()
+
+	// revoked while the worker connected
+	if err := c.Close(); err != nil {
+		log.Warnf("closing connection of a revoked worker: %s", err)
+	}
+}
+
+// List returns the tokens by creation time, revoked ones included
+func (t *Tokens) List() []api.WorkerToken {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	out := make([]api.WorkerToken, 0, len(t.tokens))
+	for id, wt := range t.tokens {
+		wt.LastUsed = t.lastUsed[id]
+		out = append(out, wt)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Created.Before(out[j].Created)
+	})
+	return out
+}
+
+// Revoke revokes the tokens with the ID, or all tokens of the worker with
+// the name, and closes the connections of the workers connected with them
+func (t *Tokens) Revoke(nameOrID string) (int, error) {
+	n, conns, err := t.revoke(nameOrID)
+	for _, c := range conns {
+		if err := c.Close(); err != nil {
+			log.Warnf("closing connection of a revoked worker: %s", err)
+		}
+	}
+	return n, err
+}
+
+func (t *Tokens) revoke(nameOrID string) (int, []io.Closer, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	var n int
+	var conns []io.Closer
+	for id, wt := range t.tokens {
+		if id != nameOrID && wt.Name != nameOrID {
+			continue
+		}
+		if wt.Revoked.IsZero() {
+			wt.Revoked = time.Now()
+			if err := t.put(wt); err != nil {
+				return n, conns, err
+			}
+			log.Infow("worker token revoked", "id", id, "name", wt.Name)
+		}
+		n++
+
+		conns = append(conns, t.conns[id]...)
+		delete(t.conns, id)
+	}
+
+	if n == 0 {
+		return 0, nil, xerrors.Errorf("no worker token with the name or ID %q", nameOrID)
+	}
+	return n, conns, nil
+}
+
+// put must be called with t.lk held
+func (t *Tokens) put(wt api.WorkerToken) error {
+	b, err := json.Marshal(wt)
+	if err != nil {
+		return err
+	}
+	if err := t.ds.Put(datastore.NewKey(wt.ID), b); err != nil {
+		return xerrors.Errorf("saving worker token: %w", err)
+	}
+	t.tokens[wt.ID] = wt
+	return nil
+}
+
+type ctxKey struct{}
+
+// WithID returns a context carrying the ID of the worker token a request was
+// made with
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// IDFromContext returns the ID of the worker token a request was made with,
+// false for other tokens
+func IDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok
+}
+
+// noWorkerCalls are the methods which mint tokens. Workers can't call them,
+// a token they created wouldn't be revoked with their own.
+var noWorkerCalls = map[string]bool{
+	"AuthNew":           true,
+	"AuthNewWithQuota":  true,
+	"WorkerTokenCreate": true,
+}
+
+// Proxy checks the worker token of every call made with one, so calls over
+// connections opened before the token was revoked fail too, and it refuses
+// the methods minting tokens to workers
+func Proxy(t *Tokens, in interface{}, out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+	ra := reflect.ValueOf(in)
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := ra.MethodByName(field.Name)
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			ctx := args[0].Interface().(context.Context)
+			id, ok := IDFromContext(ctx)
+			if !ok {
+				return fn.Call(args)
+			}
+
+			err := t.Check(id)
+			if err == nil && noWorkerCalls[field.Name] {
+				err = xerrors.New("not allowed with worker tokens")
+			}
+			if err == nil {
+				return fn.Call(args)
+			}
+
+			err = xerrors.Errorf("calling '%s': %w", field.Name, err)
+			rerr := reflect.ValueOf(&err).Elem()
+
+			if field.Type.NumOut() == 2 {
+				return []reflect.Value{
+					reflect.Zero(field.Type.Out(0)),
+					rerr,
+				}
+			}
+			return []reflect.Value{rerr}
+		}))
+	}
+}
+
+// Handler puts the ID of the worker token a request was made with into the
+// request context. It is meant to run behind auth.Handler, which already
+// rejected invalid and revoked tokens.
+type Handler struct {
+	// Parse returns the worker token ID, false for other tokens
+	Parse func(ctx context.Context, token string) (string, bool, error)
+	Next  http.Handler
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.FormValue("token")
+	}
+	token = strings.TrimPrefix(token, "Bearer ")
+
+	if token != "" {
+		id, ok, err := h.Parse(r.Context(), token)
+		if err != nil {
+			log.Warnf("parsing worker token (originating from %s): %s", r.RemoteAddr, err)
+			w.WriteHeader(401)
+			return
+		}
+		if ok {
+			r = r.WithContext(WithID(r.Context(), id))
+		}
+	}
+
+	h.Next.ServeHTTP(w, r)
+}
@@ -0,0 +1,128 @@
+package workertokens
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+)
+
+type testAPI struct{}
+
+func (testAPI) AuthNew(ctx context.Context, perms []auth.Permission) ([]byte, error) {
+	return []byte("token"), nil
+}
+
+func (testAPI) WorkerJobs(ctx context.Context) error {
+	return nil
+}
+
+type testStruct struct {
+	Internal struct {
+		AuthNew    func(ctx context.Context, perms []auth.Permission) ([]byte, error)
+		WorkerJobs func(ctx context.Context) error
+	}
+}
+
+type closer struct {
+	closed int
+}
+
+func (c *closer) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestTokens(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	tokens, err := New(ds)
+	require.NoError(t, err)
+
+	_, err = tokens.Create(" ", []auth.Permission{"admin"})
+	require.Error(t, err)
+
+	a1, err := tokens.Create("worker1", []auth.Permission{"read", "write", "sign", "admin"})
+	require.NoError(t, err)
+	a2, err := tokens.Create("worker1", []auth.Permission{"read"})
+	require.NoError(t, err)
+	b, err := tokens.Create("worker2", []auth.Permission{"admin"})
+	require.NoError(t, err)
+	require.NotEqual(t, a1.ID, a2.ID)
+
+	require.NoError(t, tokens.Check(a1.ID))
+	require.Error(t, tokens.Check("unknown"))
+
+	var c1, c2 closer
+	tokens.Track(a1.ID, &c1)
+	tokens.Track(b.ID, &c2)
+
+	_, err = tokens.Revoke("worker3")
+	require.Error(t, err)
+
+	n, err := tokens.Revoke("worker1")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 1, c1.closed)
+	require.Equal(t, 0, c2.closed)
+
+	require.Equal(t, ErrRevoked, tokens.Check(a1.ID))
+	require.Equal(t, ErrRevoked, tokens.Check(a2.ID))
+	require.NoError(t, tokens.Check(b.ID))
+
+	// connections made while the token was revoked are closed right away
+	var c3 closer
+	tokens.Track(a2.ID, &c3)
+	require.Equal(t, 1, c3.closed)
+
+	// revocations are kept across restarts
+	tokens, err = New(ds)
+	require.NoError(t, err)
+	require.Equal(t, ErrRevoked, tokens.Check(a1.ID))
+	require.NoError(t, tokens.Check(b.ID))
+
+	list := tokens.List()
+	require.Len(t, list, 3)
+	require.Equal(t, a1.ID, list[0].ID)
+	require.False(t, list[0].Revoked.IsZero())
+	require.Equal(t, b.ID, list[2].ID)
+	require.True(t, list[2].Revoked.IsZero())
+	require.False(t, list[2].LastUsed.IsZero())
+
+	n, err = tokens.Revoke(b.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, ErrRevoked, tokens.Check(b.ID))
+}
+
+func TestProxy(t *testing.T) {
+	tokens, err := New(dss.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+
+	wt, err := tokens.Create("worker1", []auth.Permission{"read", "write", "sign", "admin"})
+	require.NoError(t, err)
+
+	var out testStruct
+	Proxy(tokens, testAPI{}, &out.Internal)
+
+	ctx := context.Background()
+	wctx := WithID(ctx, wt.ID)
+
+	// other tokens aren't affected
+	_, err = out.Internal.AuthNew(ctx, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, out.Internal.WorkerJobs(wctx))
+	_, err = out.Internal.AuthNew(wctx, nil)
+	require.Error(t, err, "workers can't mint tokens")
+
+	// connections opened before the revocation fail on their next call
+	_, err = tokens.Revoke(wt.ID)
+	require.NoError(t, err)
+	require.True(t, xerrors.Is(out.Internal.WorkerJobs(wctx), ErrRevoked))
+	require.NoError(t, out.Internal.WorkerJobs(ctx))
+}